@@ -0,0 +1,150 @@
+// users imports and exports users of a running quickshare server through the admin API, e.g.
+//
+//	users import -a http://127.0.0.1:8686 -u admin -f users.csv --dry-run
+//	users export -a http://127.0.0.1:8686 -u admin --format csv -o users.csv
+//
+// The admin password is read from the QS_PWD environment variable if it is not set by --pwd.
+// Admins with 2FA can not login by the password, they use a personal API token without scopes instead:
+//
+//	QS_TOKEN=<token> users export -a http://127.0.0.1:8686 -o users.csv
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	goflags "github.com/jessevdk/go-flags"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+type ServerOpts struct {
+	Addr  string `short:"a" long:"addr" default:"http://127.0.0.1:8686" description:"server address"`
+	User  string `short:"u" long:"user" description:"admin name"`
+	Pwd   string `short:"p" long:"pwd" env:"QS_PWD" description:"admin password"`
+	Token string `short:"t" long:"token" env:"QS_TOKEN" description:"admin's API token, it is used instead of the name and password"`
+}
+
+func (opts *ServerOpts) login() (*client.UsersClient, error) {
+	cl := client.NewUsersClient(opts.Addr)
+	if opts.Token != "" {
+		cl.SetAPIToken(opts.Token)
+		return cl, nil
+	} else if opts.User == "" {
+		return nil, errors.New("--user or --token is required")
+	}
+
+	resp, body, errs := cl.Login(opts.User, opts.Pwd)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to login(%d): %s", resp.StatusCode, body)
+	}
+	loginResp := &multiusers.LoginResp{}
+	if err := json.Unmarshal([]byte(body), loginResp); err != nil {
+		return nil, err
+	} else if loginResp.MFARequired {
+		return nil, fmt.Errorf("2FA is required for %s, use an API token by --token or QS_TOKEN instead", opts.User)
+	}
+	return cl, nil
+}
+
+type ImportCmd struct {
+	ServerOpts
+	File   string `short:"f" long:"file" required:"true" description:"CSV or JSON file of users"`
+	Format string `long:"format" choice:"csv" choice:"json" description:"file format, it is detected by the extension if it is empty"`
+	DryRun bool   `long:"dry-run" description:"only show what would be changed"`
+}
+
+func (cmd *ImportCmd) Execute(args []string) error {
+	data, err := os.ReadFile(cmd.File)
+	if err != nil {
+		return err
+	}
+	format := cmd.Format
+	if format == "" {
+		format = multiusers.FormatJSON
+		if strings.EqualFold(filepath.Ext(cmd.File), ".csv") {
+			format = multiusers.FormatCSV
+		}
+	}
+
+	cl, err := cmd.login()
+	if err != nil {
+		return err
+	}
+	resp, importResp, errs := cl.ImportUsers(format, data, cmd.DryRun)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	} else if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to import(%d)", resp.StatusCode)
+	}
+
+	failed := 0
+	for _, result := range importResp.Results {
+		line := fmt.Sprintf("%d\t%s\t%s", result.Row, result.Name, result.Action)
+		if result.Pwd != "" {
+			line += "\tpassword: " + result.Pwd
+		} else if result.ResetMailed {
+			line += "\treset link is mailed"
+		}
+		if result.Error != "" {
+			line += "\terror: " + result.Error
+			failed++
+		}
+		fmt.Println(line)
+	}
+	if importResp.DryRun {
+		fmt.Println("dry run: nothing is changed")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d users failed to import", failed)
+	}
+	return nil
+}
+
+type ExportCmd struct {
+	ServerOpts
+	Format string `long:"format" default:"csv" choice:"csv" choice:"json" description:"export format"`
+	Out    string `short:"o" long:"out" description:"output file, it is stdout if it is empty"`
+}
+
+func (cmd *ExportCmd) Execute(args []string) error {
+	cl, err := cmd.login()
+	if err != nil {
+		return err
+	}
+	resp, body, errs := cl.ExportUsers(cmd.Format)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	} else if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to export(%d): %s", resp.StatusCode, body)
+	}
+
+	if cmd.Out == "" {
+		_, err = fmt.Print(body)
+		return err
+	}
+	return os.WriteFile(cmd.Out, []byte(body), 0600)
+}
+
+func main() {
+	parser := goflags.NewParser(nil, goflags.Default)
+	_, err := parser.AddCommand("import", "import users", "create or update users from a CSV or JSON file", &ImportCmd{})
+	if err != nil {
+		panic(err)
+	}
+	_, err = parser.AddCommand("export", "export users", "export users with their usages", &ExportCmd{})
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err = parser.Parse(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -7,11 +7,13 @@ toolchain go1.23.8
 require (
 	github.com/boltdb/bolt v1.3.1
 	github.com/dchest/captcha v0.0.0-20200903113550-03f5f0333e1f
+	github.com/gin-contrib/cors v1.7.5
 	github.com/gin-contrib/static v0.0.0-20200916080430-d45d9a37d28e
 	github.com/gin-gonic/gin v1.10.0
 	github.com/ihexxa/fsearch v0.1.2
 	github.com/ihexxa/gocfg v0.0.1
 	github.com/ihexxa/multipart v0.0.0-20210916083128-8584a3f00d1d
+	github.com/ihexxa/q-radix/v3 v3.0.5
 	github.com/ihexxa/randstr v0.3.0
 	github.com/jessevdk/go-flags v1.4.0
 	github.com/mattn/go-sqlite3 v1.14.15
@@ -21,6 +23,8 @@ require (
 	github.com/robfig/cron/v3 v3.0.1
 	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.38.0
+	golang.org/x/sys v0.31.0
 	modernc.org/sqlite v1.20.4
 )
 
@@ -32,14 +36,12 @@ require (
 	github.com/dustin/go-humanize v1.0.0 // indirect
 	github.com/elazarl/goproxy v0.0.0-20201021153353-00ad82a08272 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.8 // indirect
-	github.com/gin-contrib/cors v1.7.5 // indirect
 	github.com/gin-contrib/sse v1.0.0 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/go-playground/validator/v10 v10.26.0 // indirect
 	github.com/goccy/go-json v0.10.5 // indirect
 	github.com/google/uuid v1.3.0 // indirect
-	github.com/ihexxa/q-radix/v3 v3.0.5 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
@@ -57,9 +59,7 @@ require (
 	go.uber.org/multierr v1.5.0 // indirect
 	golang.org/x/arch v0.15.0 // indirect
 	golang.org/x/mod v0.17.0 // indirect
-	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
-	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
@@ -0,0 +1,59 @@
+// Package audit persists audit logs of security and data relevant actions, e.g. logins and downloads
+package audit
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/idgen"
+)
+
+type IAuditor interface {
+	// Record adds the log, its ID and creating time are set here, errors are only logged
+	Record(ctx context.Context, log *db.AuditLog)
+	// Clean removes logs older than the kept days
+	Clean()
+}
+
+type Config struct {
+	KeepDays int
+}
+
+type Auditor struct {
+	cfg    *Config
+	store  db.IAuditLogDB
+	ider   idgen.IIDGen
+	logger *zap.SugaredLogger
+	now    func() time.Time
+}
+
+func NewAuditor(cfg *Config, store db.IAuditLogDB, ider idgen.IIDGen, logger *zap.SugaredLogger) *Auditor {
+	return &Auditor{
+		cfg:    cfg,
+		store:  store,
+		ider:   ider,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+func (a *Auditor) Record(ctx context.Context, log *db.AuditLog) {
+	log.ID = a.ider.Gen()
+	log.CreatedAt = a.now().Unix()
+	if err := a.store.AddAuditLog(ctx, log); err != nil {
+		a.logger.Errorf("failed to add audit log %s %s by %s: %s", log.Action, log.Target, log.Actor, err)
+	}
+}
+
+func (a *Auditor) Clean() {
+	if a.cfg.KeepDays <= 0 {
+		return
+	}
+	before := a.now().Unix() - int64(a.cfg.KeepDays)*24*3600
+	if err := a.store.DelAuditLogs(context.TODO(), before); err != nil {
+		a.logger.Errorf("failed to clean audit logs: %s", err)
+	}
+}
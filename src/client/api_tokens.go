@@ -0,0 +1,51 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) AddAPIToken(req *multiusers.AddAPITokenReq) (*http.Response, *multiusers.AddAPITokenResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/my/tokens/")).
+		AddCookie(cl.token).
+		Send(req).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	atResp := &multiusers.AddAPITokenResp{}
+	err := json.Unmarshal([]byte(body), atResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, atResp, errs
+}
+
+func (cl *UsersClient) DelAPIToken(id string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/my/tokens/")).
+		AddCookie(cl.token).
+		Param(handlers.APITokenIDParam, id).
+		End()
+}
+
+func (cl *UsersClient) ListAPITokens() (*http.Response, *multiusers.ListAPITokensResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/tokens/list")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListAPITokensResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/settings"
+)
+
+// ListAuditLogs lists audit logs, filters are queries like settings.ActorQuery, settings.CursorQuery, etc.
+func (cl *SettingsClient) ListAuditLogs(filters map[string]string) (*http.Response, *settings.ListAuditLogsResp, []error) {
+	req := cl.r.Get(cl.url("/v2/admin/audit/logs")).
+		AddCookie(cl.token)
+	for name, val := range filters {
+		req = req.Param(name, val)
+	}
+	resp, body, errs := req.End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &settings.ListAuditLogsResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, lsResp, nil
+}
+
+func (cl *SettingsClient) ExportAuditLogs(format string, filters map[string]string) (*http.Response, string, []error) {
+	req := cl.r.Get(cl.url("/v2/admin/audit/export")).
+		AddCookie(cl.token).
+		Param(handlers.FormatParam, format)
+	for name, val := range filters {
+		req = req.Param(name, val)
+	}
+	return req.End()
+}
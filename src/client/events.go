@@ -0,0 +1,76 @@
+package client
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/handlers/fileshdr"
+)
+
+// StreamEvent is an event read from the event stream, Data is the JSON of the event
+type StreamEvent struct {
+	Type string
+	Data string
+}
+
+type EventStream struct {
+	resp   *http.Response
+	reader *bufio.Reader
+}
+
+// Next blocks until the next event is received, comments (e.g. heartbeats) are skipped
+func (s *EventStream) Next() (*StreamEvent, error) {
+	event := &StreamEvent{}
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if event.Type != "" || event.Data != "" {
+				return event, nil
+			}
+		case strings.HasPrefix(line, "event:"):
+			event.Type = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			event.Data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func (s *EventStream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// Events opens the event stream, events of the folders are also received, the stream must be closed by the caller
+func (cl *FilesClient) Events(dirPaths ...string) (*http.Response, *EventStream, error) {
+	values := url.Values{}
+	for _, dirPath := range dirPaths {
+		values.Add(fileshdr.ListDirQuery, dirPath)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, cl.url("/v2/my/fs/events")+"?"+values.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.AddCookie(cl.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	} else if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return resp, nil, nil
+	}
+	return resp, &EventStream{resp: resp, reader: bufio.NewReader(resp.Body)}, nil
+}
+
+func (cl *FilesClient) Broadcast(message string) (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/admin/broadcasts")).
+		AddCookie(cl.token).
+		Send(fileshdr.BroadcastReq{Message: message}).
+		End()
+}
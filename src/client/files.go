@@ -29,6 +29,10 @@ func (cl *FilesClient) url(urlpath string) string {
 	return fmt.Sprintf("%s%s", cl.addr, urlpath)
 }
 
+func (cl *FilesClient) Token() *http.Cookie {
+	return cl.token
+}
+
 func (cl *FilesClient) Create(filepath string, size int64) (*http.Response, string, []error) {
 	return cl.r.Post(cl.url("/v2/my/fs/files")).
 		AddCookie(cl.token).
@@ -131,6 +135,38 @@ func (cl *FilesClient) List(dirPath string) (*http.Response, *fileshdr.ListResp,
 	return resp, lResp, nil
 }
 
+// ListPage lists a page of items in the folder, empty arguments take default values
+func (cl *FilesClient) ListPage(dirPath, itemType, sortBy, order, cursor string, limit int) (*http.Response, *fileshdr.ListResp, []error) {
+	values := url.Values{}
+	values.Set(fileshdr.ListDirQuery, dirPath)
+	values.Set("limit", fmt.Sprint(limit))
+	for name, val := range map[string]string{
+		"type":   itemType,
+		"sort":   sortBy,
+		"order":  order,
+		"cursor": cursor,
+	} {
+		if val != "" {
+			values.Set(name, val)
+		}
+	}
+
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/fs/dirs")).
+		AddCookie(cl.token).
+		Query(values.Encode()).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lResp := &fileshdr.ListResp{}
+	err := json.Unmarshal([]byte(body), lResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, lResp, nil
+}
+
 func (cl *FilesClient) ListHome() (*http.Response, *fileshdr.ListResp, []error) {
 	resp, body, errs := cl.r.Get(cl.url("/v2/my/fs/dirs/home")).
 		AddCookie(cl.token).
@@ -224,6 +260,60 @@ func (cl *FilesClient) ListSharingIDs() (*http.Response, *fileshdr.SharingIDsRes
 	return resp, shResp, nil
 }
 
+func (cl *FilesClient) SetACL(dirpath, subjectType string, subjectID uint64, perm string) (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/my/fs/acls")).
+		AddCookie(cl.token).
+		Send(fileshdr.SetACLReq{
+			Path:        dirpath,
+			SubjectType: subjectType,
+			SubjectID:   subjectID,
+			Perm:        perm,
+		}).
+		End()
+}
+
+func (cl *FilesClient) DelACL(dirpath, subjectType, subjectID string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/my/fs/acls")).
+		AddCookie(cl.token).
+		Param(fileshdr.FilePathQuery, dirpath).
+		Param(fileshdr.SubjectTypeQuery, subjectType).
+		Param(fileshdr.SubjectIDQuery, subjectID).
+		End()
+}
+
+func (cl *FilesClient) ListACLs(dirpath string) (*http.Response, *fileshdr.ACLsResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/fs/acls")).
+		AddCookie(cl.token).
+		Param(fileshdr.FilePathQuery, dirpath).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	aclsResp := &fileshdr.ACLsResp{}
+	err := json.Unmarshal([]byte(body), aclsResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, aclsResp, nil
+}
+
+func (cl *FilesClient) ListSharedWithMe() (*http.Response, *fileshdr.ACLsResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/fs/acls/shared")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	aclsResp := &fileshdr.ACLsResp{}
+	err := json.Unmarshal([]byte(body), aclsResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, aclsResp, nil
+}
+
 func (cl *FilesClient) GenerateHash(filepath string) (*http.Response, string, []error) {
 	return cl.r.Post(cl.url("/v2/my/fs/hashes/sha1")).
 		AddCookie(cl.token).
@@ -270,6 +360,84 @@ func (cl *FilesClient) SearchItems(keywords []string) (*http.Response, *fileshdr
 	return resp, searchResp, nil
 }
 
+// QueryItems searches items by the query, sortBy, order and cursor could be empty
+func (cl *FilesClient) QueryItems(query, sortBy, order, cursor string, limit int) (*http.Response, *fileshdr.QueryItemsResp, []error) {
+	values := url.Values{}
+	values.Set("q", query)
+	values.Set("limit", fmt.Sprint(limit))
+	if sortBy != "" {
+		values.Set("sort", sortBy)
+	}
+	if order != "" {
+		values.Set("order", order)
+	}
+	if cursor != "" {
+		values.Set("cursor", cursor)
+	}
+
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/fs/search/query")).
+		AddCookie(cl.token).
+		Query(values.Encode()).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	queryResp := &fileshdr.QueryItemsResp{}
+	err := json.Unmarshal([]byte(body), queryResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, queryResp, nil
+}
+
+// SearchContents searches texts of documents, results could be limited in the folders
+func (cl *FilesClient) SearchContents(query string, limit int, dirPaths ...string) (*http.Response, *fileshdr.SearchContentsResp, []error) {
+	values := url.Values{}
+	values.Set("q", query)
+	values.Set("limit", fmt.Sprint(limit))
+	for _, dirPath := range dirPaths {
+		values.Add("in", dirPath)
+	}
+
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/fs/search/content")).
+		AddCookie(cl.token).
+		Query(values.Encode()).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	searchResp := &fileshdr.SearchContentsResp{}
+	err := json.Unmarshal([]byte(body), searchResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, searchResp, nil
+}
+
+func (cl *FilesClient) ListChanges(cursor string, limit, wait int) (*http.Response, *fileshdr.ListChangesResp, []error) {
+	values := url.Values{}
+	values.Set("cursor", cursor)
+	values.Set("limit", fmt.Sprint(limit))
+	values.Set("wait", fmt.Sprint(wait))
+
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/fs/changes")).
+		AddCookie(cl.token).
+		Query(values.Encode()).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	changesResp := &fileshdr.ListChangesResp{}
+	err := json.Unmarshal([]byte(body), changesResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, changesResp, nil
+}
+
 func (cl *FilesClient) Reindex() (*http.Response, string, []error) {
 	return cl.r.Put(cl.url("/v2/my/fs/reindex")).
 		AddCookie(cl.token).
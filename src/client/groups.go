@@ -0,0 +1,119 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) AddGroup(name string, quota *db.GroupQuota) (*http.Response, *multiusers.AddGroupResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/admin/groups/")).
+		AddCookie(cl.token).
+		Send(multiusers.AddGroupReq{
+			Name:  name,
+			Quota: quota,
+		}).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	agResp := &multiusers.AddGroupResp{}
+	err := json.Unmarshal([]byte(body), agResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, agResp, errs
+}
+
+func (cl *UsersClient) DelGroup(id string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/admin/groups/")).
+		AddCookie(cl.token).
+		Param(handlers.GroupIDParam, id).
+		End()
+}
+
+func (cl *UsersClient) ListGroups() (*http.Response, *multiusers.ListGroupsResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/groups/list")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListGroupsResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) SetGroupQuota(id uint64, quota *db.GroupQuota) (*http.Response, string, []error) {
+	return cl.r.Patch(cl.url("/v2/admin/groups/")).
+		AddCookie(cl.token).
+		Send(multiusers.SetGroupQuotaReq{
+			ID:    id,
+			Quota: quota,
+		}).
+		End()
+}
+
+func (cl *UsersClient) SetGroupMember(groupID, userID uint64, perm string) (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/admin/groups/members")).
+		AddCookie(cl.token).
+		Send(multiusers.SetGroupMemberReq{
+			GroupID: groupID,
+			UserID:  userID,
+			Perm:    perm,
+		}).
+		End()
+}
+
+func (cl *UsersClient) DelGroupMember(groupID, userID string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/admin/groups/members")).
+		AddCookie(cl.token).
+		Param(handlers.GroupIDParam, groupID).
+		Param(handlers.UserIDParam, userID).
+		End()
+}
+
+func (cl *UsersClient) ListGroupMembers(groupID string) (*http.Response, *multiusers.ListGroupMembersResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/groups/members")).
+		AddCookie(cl.token).
+		Param(handlers.GroupIDParam, groupID).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListGroupMembersResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) ListMyGroups() (*http.Response, *multiusers.ListMyGroupsResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/groups")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListMyGroupsResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
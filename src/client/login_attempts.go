@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) ListLoginAttempts(userName string, limit int) (*http.Response, *multiusers.ListLoginAttemptsResp, []error) {
+	req := cl.r.Get(cl.url("/v2/admin/users/login-attempts")).
+		AddCookie(cl.token)
+	if userName != "" {
+		req = req.Param(handlers.UserParam, userName)
+	}
+	if limit > 0 {
+		req = req.Param("limit", fmt.Sprint(limit))
+	}
+	resp, body, errs := req.End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListLoginAttemptsResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) UnlockUser(userID string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/admin/users/lockout")).
+		AddCookie(cl.token).
+		Param(handlers.UserIDParam, userID).
+		End()
+}
+
+func (cl *UsersClient) GetCaptchaID() (*http.Response, *multiusers.GetCaptchaIDResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/public/captchas/")).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	captchaResp := &multiusers.GetCaptchaIDResp{}
+	err := json.Unmarshal([]byte(body), captchaResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, captchaResp, errs
+}
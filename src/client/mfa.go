@@ -0,0 +1,133 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+// LoginMFA starts logging in, the returned MFA token is used in the second step if 2FA is required
+func (cl *UsersClient) LoginMFA(user, pwd string) (*http.Response, *multiusers.LoginResp, []error) {
+	resp, body, errs := cl.Login(user, pwd)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	loginResp := &multiusers.LoginResp{}
+	err := json.Unmarshal([]byte(body), loginResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, loginResp, errs
+}
+
+func (cl *UsersClient) MFALogin(mfaToken, code, recoveryCode string) (*http.Response, *multiusers.MFALoginResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/public/2fa/login")).
+		Send(multiusers.MFALoginReq{
+			MFAToken:     mfaToken,
+			Code:         code,
+			RecoveryCode: recoveryCode,
+		}).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	if resp.StatusCode == 200 {
+		httpResp := (*http.Response)(resp)
+		cl.token = GetCookie(httpResp.Cookies(), handlers.TokenCookie)
+	}
+	loginResp := &multiusers.MFALoginResp{}
+	err := json.Unmarshal([]byte(body), loginResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, loginResp, errs
+}
+
+func (cl *UsersClient) EnrollMFAForLogin(mfaToken string) (*http.Response, *multiusers.MFAEnrollResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/public/2fa/enroll")).
+		Send(multiusers.MFATokenReq{MFAToken: mfaToken}).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	enrollResp := &multiusers.MFAEnrollResp{}
+	err := json.Unmarshal([]byte(body), enrollResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, enrollResp, errs
+}
+
+func (cl *UsersClient) EnrollMFA() (*http.Response, *multiusers.MFAEnrollResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/my/2fa/enroll")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	enrollResp := &multiusers.MFAEnrollResp{}
+	err := json.Unmarshal([]byte(body), enrollResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, enrollResp, errs
+}
+
+func (cl *UsersClient) VerifyMFA(code string) (*http.Response, *multiusers.MFAVerifyResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/my/2fa/verify")).
+		Send(multiusers.MFAVerifyReq{Code: code}).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	verifyResp := &multiusers.MFAVerifyResp{}
+	err := json.Unmarshal([]byte(body), verifyResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, verifyResp, errs
+}
+
+func (cl *UsersClient) GetMFAStatus() (*http.Response, *multiusers.MFAStatusResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/2fa")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	statusResp := &multiusers.MFAStatusResp{}
+	err := json.Unmarshal([]byte(body), statusResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, statusResp, errs
+}
+
+func (cl *UsersClient) DisableMFA(pwd, code string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/my/2fa")).
+		Send(multiusers.DisableMFAReq{Pwd: pwd, Code: code}).
+		AddCookie(cl.token).
+		End()
+}
+
+func (cl *UsersClient) ResetUserMFA(userID string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/admin/users/2fa")).
+		AddCookie(cl.token).
+		Param(handlers.UserIDParam, userID).
+		End()
+}
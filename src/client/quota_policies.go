@@ -0,0 +1,68 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) SetQuotaPolicy(subjectType, subject string, quota *db.Quota) (*http.Response, *multiusers.QuotaPolicyResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/admin/quotas/")).
+		AddCookie(cl.token).
+		Send(multiusers.SetQuotaPolicyReq{
+			SubjectType: subjectType,
+			Subject:     subject,
+			Quota:       quota,
+		}).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	qpResp := &multiusers.QuotaPolicyResp{}
+	err := json.Unmarshal([]byte(body), qpResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, qpResp, errs
+}
+
+func (cl *UsersClient) DelQuotaPolicy(subjectType, subject string) (*http.Response, *multiusers.QuotaPolicyResp, []error) {
+	resp, body, errs := cl.r.Delete(cl.url("/v2/admin/quotas/")).
+		AddCookie(cl.token).
+		Param(handlers.SubjectTypeParam, subjectType).
+		Param(handlers.SubjectParam, subject).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	qpResp := &multiusers.QuotaPolicyResp{}
+	err := json.Unmarshal([]byte(body), qpResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, qpResp, errs
+}
+
+func (cl *UsersClient) ListQuotaPolicies() (*http.Response, *multiusers.ListQuotaPoliciesResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/quotas/list")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListQuotaPoliciesResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
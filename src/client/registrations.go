@@ -0,0 +1,117 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) GetRegistration() (*http.Response, *multiusers.GetRegistrationResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/public/registration")).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	regResp := &multiusers.GetRegistrationResp{}
+	err := json.Unmarshal([]byte(body), regResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, regResp, errs
+}
+
+func (cl *UsersClient) Register(req *multiusers.RegisterReq) (*http.Response, *multiusers.RegisterResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/public/registration")).
+		Send(req).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	regResp := &multiusers.RegisterResp{}
+	err := json.Unmarshal([]byte(body), regResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, regResp, errs
+}
+
+func (cl *UsersClient) AddInvite(role string, quota *db.Quota, maxUses int, expireAt int64) (*http.Response, *multiusers.AddInviteResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/admin/invites/")).
+		AddCookie(cl.token).
+		Send(multiusers.AddInviteReq{
+			Role:     role,
+			Quota:    quota,
+			MaxUses:  maxUses,
+			ExpireAt: expireAt,
+		}).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	aiResp := &multiusers.AddInviteResp{}
+	err := json.Unmarshal([]byte(body), aiResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, aiResp, errs
+}
+
+func (cl *UsersClient) DelInvite(inviteID string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/admin/invites/")).
+		AddCookie(cl.token).
+		Param(handlers.InviteIDParam, inviteID).
+		End()
+}
+
+func (cl *UsersClient) ListInvites() (*http.Response, *multiusers.ListInvitesResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/invites/list")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListInvitesResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) ListPendingUsers() (*http.Response, *multiusers.ListUsersResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/users/pending")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListUsersResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) ApproveUser(userID uint64, role string) (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/admin/users/approve")).
+		AddCookie(cl.token).
+		Send(multiusers.ApproveUserReq{
+			ID:   userID,
+			Role: role,
+		}).
+		End()
+}
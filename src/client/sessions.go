@@ -0,0 +1,46 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) ListSessions() (*http.Response, *multiusers.ListSessionsResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/sessions/")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListSessionsResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) DelSession(sessionID string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/my/sessions/")).
+		AddCookie(cl.token).
+		Param(handlers.SessionIDParam, sessionID).
+		End()
+}
+
+func (cl *UsersClient) DelAllSessions() (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/my/sessions/all")).
+		AddCookie(cl.token).
+		End()
+}
+
+func (cl *UsersClient) DelUserSessions(userID string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/admin/users/sessions")).
+		AddCookie(cl.token).
+		Param(handlers.UserIDParam, userID).
+		End()
+}
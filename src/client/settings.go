@@ -74,3 +74,30 @@ func (cl *SettingsClient) WorkerQueueLen() (*http.Response, *settings.WorkerQueu
 	}
 	return resp, mResp, nil
 }
+
+// Metrics returns metrics in the Prometheus text exposition format
+func (cl *SettingsClient) Metrics() (*http.Response, string, []error) {
+	return cl.r.Get(cl.url("/v2/admin/metrics")).
+		AddCookie(cl.token).
+		End()
+}
+
+func (cl *SettingsClient) GetHealth() (*http.Response, *settings.HealthResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/public/settings/health")).
+		End()
+
+	mResp := &settings.HealthResp{}
+	err := json.Unmarshal([]byte(body), mResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, mResp, nil
+}
+
+func (cl *SettingsClient) SetMaintenance(readOnly bool) (*http.Response, string, []error) {
+	return cl.r.Put(cl.url("/v2/admin/maintenance")).
+		AddCookie(cl.token).
+		Send(&settings.MaintenanceReq{ReadOnly: readOnly}).
+		End()
+}
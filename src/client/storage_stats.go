@@ -0,0 +1,127 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/fileshdr"
+)
+
+func (cl *FilesClient) ListUserUsages() (*http.Response, *fileshdr.UserUsagesResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/storage/users")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	uResp := &fileshdr.UserUsagesResp{}
+	err := json.Unmarshal([]byte(body), uResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, uResp, nil
+}
+
+func (cl *FilesClient) ListFolderUsages(dirPath string) (*http.Response, *fileshdr.FolderUsagesResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/storage/folders")).
+		AddCookie(cl.token).
+		Param(fileshdr.ListDirQuery, dirPath).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	fResp := &fileshdr.FolderUsagesResp{}
+	err := json.Unmarshal([]byte(body), fResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, fResp, nil
+}
+
+func (cl *FilesClient) ListLargestFiles(limit int) (*http.Response, *fileshdr.LargestFilesResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/storage/largest")).
+		AddCookie(cl.token).
+		Param("limit", fmt.Sprint(limit)).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lResp := &fileshdr.LargestFilesResp{}
+	err := json.Unmarshal([]byte(body), lResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, lResp, nil
+}
+
+func (cl *FilesClient) ListDuplicateFiles(limit int) (*http.Response, *fileshdr.DuplicateFilesResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/storage/duplicates")).
+		AddCookie(cl.token).
+		Param("limit", fmt.Sprint(limit)).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	dResp := &fileshdr.DuplicateFilesResp{}
+	err := json.Unmarshal([]byte(body), dResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, dResp, nil
+}
+
+func (cl *FilesClient) ListStaleUploadings(hours int) (*http.Response, *fileshdr.StaleUploadingsResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/storage/uploadings/stale")).
+		AddCookie(cl.token).
+		Param("hours", fmt.Sprint(hours)).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	sResp := &fileshdr.StaleUploadingsResp{}
+	err := json.Unmarshal([]byte(body), sResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, sResp, nil
+}
+
+// GetStorageGrowth returns the total usages of snapshots, only the user's usages are summed if userID is not empty
+func (cl *FilesClient) GetStorageGrowth(days int, userID string) (*http.Response, *fileshdr.StorageGrowthResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/admin/storage/growth")).
+		AddCookie(cl.token).
+		Param("days", fmt.Sprint(days)).
+		Param(handlers.UserIDParam, userID).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	gResp := &fileshdr.StorageGrowthResp{}
+	err := json.Unmarshal([]byte(body), gResp)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	return resp, gResp, nil
+}
+
+func (cl *FilesClient) TakeStorageSnapshots() (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/admin/storage/snapshots")).
+		AddCookie(cl.token).
+		End()
+}
+
+// ExportStorageStats returns the CSV export of the report, e.g. "users", "folders" or "growth"
+func (cl *FilesClient) ExportStorageStats(report string) (*http.Response, string, []error) {
+	return cl.r.Get(cl.url(fmt.Sprintf("/v2/admin/storage/%s", report))).
+		AddCookie(cl.token).
+		Param(handlers.FormatParam, "csv").
+		End()
+}
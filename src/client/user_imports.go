@@ -0,0 +1,38 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) ImportUsers(format string, data []byte, dryRun bool) (*http.Response, *multiusers.ImportUsersResp, []error) {
+	req := cl.withAuth(cl.r.Post(cl.url("/v2/admin/users/import"))).
+		Param(handlers.FormatParam, format)
+	if dryRun {
+		req = req.Param(handlers.DryRunParam, "true")
+	}
+	resp, body, errs := req.Type("text").
+		Send(string(data)).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	importResp := &multiusers.ImportUsersResp{}
+	err := json.Unmarshal([]byte(body), importResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, importResp, errs
+}
+
+// ExportUsers returns the raw export in the format, it is "json" or "csv"
+func (cl *UsersClient) ExportUsers(format string) (*http.Response, string, []error) {
+	return cl.withAuth(cl.r.Get(cl.url("/v2/admin/users/export"))).
+		Param(handlers.FormatParam, format).
+		End()
+}
@@ -14,7 +14,9 @@ import (
 type UsersClient struct {
 	addr  string
 	token *http.Cookie
-	r     *gorequest.SuperAgent
+	// apiToken is sent as the bearer token instead of the cookie if it is set
+	apiToken string
+	r        *gorequest.SuperAgent
 }
 
 func NewUsersClient(addr string) *UsersClient {
@@ -37,11 +39,30 @@ func (cl *UsersClient) Token() *http.Cookie {
 	return cl.token
 }
 
+// SetAPIToken authenticates requests by a personal API token, it is not needed to login
+func (cl *UsersClient) SetAPIToken(apiToken string) {
+	cl.apiToken = apiToken
+}
+
+func (cl *UsersClient) withAuth(req *gorequest.SuperAgent) *gorequest.SuperAgent {
+	if cl.apiToken != "" {
+		return req.Set("Authorization", "Bearer "+cl.apiToken)
+	}
+	return req.AddCookie(cl.token)
+}
+
 func (cl *UsersClient) Login(user, pwd string) (*http.Response, string, []error) {
+	return cl.LoginWithCaptcha(user, pwd, "", "")
+}
+
+// LoginWithCaptcha is used when the captcha is required after failures
+func (cl *UsersClient) LoginWithCaptcha(user, pwd, captchaID, captchaInput string) (*http.Response, string, []error) {
 	resp, body, errs := cl.r.Post(cl.url("/v2/public/login")).
 		Send(multiusers.LoginReq{
-			User: user,
-			Pwd:  pwd,
+			User:         user,
+			Pwd:          pwd,
+			CaptchaID:    captchaID,
+			CaptchaInput: captchaInput,
 		}).
 		End()
 
@@ -62,13 +83,20 @@ func (cl *UsersClient) Logout() (*http.Response, string, []error) {
 }
 
 func (cl *UsersClient) SetPwd(oldPwd, newPwd string) (*http.Response, string, []error) {
-	return cl.r.Patch(cl.url("/v2/my/pwd")).
+	resp, body, errs := cl.r.Patch(cl.url("/v2/my/pwd")).
 		Send(multiusers.SetPwdReq{
 			OldPwd: oldPwd,
 			NewPwd: newPwd,
 		}).
 		AddCookie(cl.token).
 		End()
+
+	if len(errs) == 0 && resp.StatusCode == 200 {
+		// other sessions are revoked and a new token is issued
+		httpResp := (*http.Response)(resp)
+		cl.token = GetCookie(httpResp.Cookies(), handlers.TokenCookie)
+	}
+	return resp, body, errs
 }
 
 func (cl *UsersClient) ForceSetPwd(userID, newPwd string) (*http.Response, string, []error) {
@@ -139,23 +167,34 @@ func (cl *UsersClient) ListUsers() (*http.Response, *multiusers.ListUsersResp, [
 	return resp, lsResp, errs
 }
 
-// func (cl *UsersClient) AddRole(role string) (*http.Response, string, []error) {
-// 	return cl.r.Post(cl.url("/v1/roles/")).
-// 		AddCookie(cl.token).
-// 		Send(multiusers.AddRoleReq{
-// 			Role: role,
-// 		}).
-// 		End()
-// }
-
-// func (cl *UsersClient) DelRole(role string) (*http.Response, string, []error) {
-// 	return cl.r.Delete(cl.url("/v1/roles/")).
-// 		AddCookie(cl.token).
-// 		Send(multiusers.DelRoleReq{
-// 			Role: role,
-// 		}).
-// 		End()
-// }
+func (cl *UsersClient) AddRole(role string, rules []*db.APIRule) (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/admin/roles/")).
+		AddCookie(cl.token).
+		Send(multiusers.AddRoleReq{
+			Role:  role,
+			Rules: rules,
+		}).
+		End()
+}
+
+func (cl *UsersClient) DelRole(role string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/admin/roles/")).
+		AddCookie(cl.token).
+		Send(multiusers.DelRoleReq{
+			Role: role,
+		}).
+		End()
+}
+
+func (cl *UsersClient) SetRoleRules(role string, rules []*db.APIRule) (*http.Response, string, []error) {
+	return cl.r.Patch(cl.url("/v2/admin/roles/")).
+		AddCookie(cl.token).
+		Send(multiusers.SetRoleRulesReq{
+			Role:  role,
+			Rules: rules,
+		}).
+		End()
+}
 
 func (cl *UsersClient) ListRoles() (*http.Response, *multiusers.ListRolesResp, []error) {
 	resp, body, errs := cl.r.Get(cl.url("/v2/admin/roles/list")).
@@ -205,3 +244,20 @@ func (cl *UsersClient) IsAuthed() (*http.Response, string, []error) {
 		AddCookie(cl.token).
 		End()
 }
+
+func (cl *UsersClient) ForgetPwd(name string) (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/public/pwd/forget")).
+		Send(multiusers.ForgetPwdReq{
+			Name: name,
+		}).
+		End()
+}
+
+func (cl *UsersClient) ResetPwd(token, newPwd string) (*http.Response, string, []error) {
+	return cl.r.Post(cl.url("/v2/public/pwd/reset")).
+		Send(multiusers.ResetPwdReq{
+			Token:  token,
+			NewPwd: newPwd,
+		}).
+		End()
+}
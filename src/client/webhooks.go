@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func (cl *UsersClient) AddWebhook(req *multiusers.AddWebhookReq) (*http.Response, *multiusers.AddWebhookResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/my/webhooks/")).
+		AddCookie(cl.token).
+		Send(req).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	hookResp := &multiusers.AddWebhookResp{}
+	err := json.Unmarshal([]byte(body), hookResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, hookResp, errs
+}
+
+func (cl *UsersClient) DelWebhook(id string) (*http.Response, string, []error) {
+	return cl.r.Delete(cl.url("/v2/my/webhooks/")).
+		AddCookie(cl.token).
+		Param(multiusers.WebhookIDParam, id).
+		End()
+}
+
+func (cl *UsersClient) ListWebhooks() (*http.Response, *multiusers.ListWebhooksResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/webhooks/list")).
+		AddCookie(cl.token).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListWebhooksResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) ListWebhookDeliveries(hookID string, limit int) (*http.Response, *multiusers.ListWebhookDeliveriesResp, []error) {
+	resp, body, errs := cl.r.Get(cl.url("/v2/my/webhooks/deliveries")).
+		AddCookie(cl.token).
+		Param(multiusers.WebhookIDParam, hookID).
+		Param("limit", fmt.Sprint(limit)).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	lsResp := &multiusers.ListWebhookDeliveriesResp{}
+	err := json.Unmarshal([]byte(body), lsResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, lsResp, errs
+}
+
+func (cl *UsersClient) ReplayWebhookDelivery(deliveryID string) (*http.Response, *multiusers.ReplayWebhookDeliveryResp, []error) {
+	resp, body, errs := cl.r.Post(cl.url("/v2/my/webhooks/deliveries/replay")).
+		AddCookie(cl.token).
+		Send(&multiusers.ReplayWebhookDeliveryReq{DeliveryID: deliveryID}).
+		End()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	replayResp := &multiusers.ReplayWebhookDeliveryResp{}
+	err := json.Unmarshal([]byte(body), replayResp)
+	if err != nil {
+		errs = append(errs, err)
+		return nil, nil, errs
+	}
+	return resp, replayResp, errs
+}
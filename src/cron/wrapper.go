@@ -17,3 +17,14 @@ func NewMyCron() *MyCron {
 		Cron: cronv3.New(),
 	}
 }
+
+// AddFun runs cmd on the schedule of spec, e.g. "@daily" or "0 3 * * *"
+func (c *MyCron) AddFun(spec string, cmd func()) error {
+	_, err := c.Cron.AddFunc(spec, cmd)
+	return err
+}
+
+// Stop stops the scheduler, running jobs are not waited
+func (c *MyCron) Stop() {
+	c.Cron.Stop()
+}
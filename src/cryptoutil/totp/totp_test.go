@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// test vectors from RFC 6238 with the last 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	t.Run("codes match test vectors", func(t *testing.T) {
+		for unixTime, expected := range vectors {
+			code, err := CodeAt(secret, Step(time.Unix(unixTime, 0)))
+			if err != nil {
+				t.Fatal(err)
+			} else if code != expected {
+				t.Fatalf("code at %d not matched: %s %s", unixTime, code, expected)
+			}
+		}
+	})
+
+	t.Run("validate with skew", func(t *testing.T) {
+		now := time.Unix(1111111109, 0)
+		step, ok := Validate(secret, "081804", now, 1)
+		if !ok || step != Step(now) {
+			t.Fatalf("code should be valid (%d, %t)", step, ok)
+		}
+
+		prevCode, err := CodeAt(secret, Step(now)-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok = Validate(secret, prevCode, now, 1); !ok {
+			t.Fatal("previous code should be valid with skew")
+		}
+		if _, ok = Validate(secret, prevCode, now, 0); ok {
+			t.Fatal("previous code should be invalid without skew")
+		}
+		if _, ok = Validate(secret, "12345", now, 1); ok {
+			t.Fatal("short code should be invalid")
+		}
+	})
+
+	t.Run("generate secrets and uris", func(t *testing.T) {
+		secret, err := GenerateSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := CodeAt(secret, Step(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		} else if _, ok := Validate(secret, code, time.Now(), 0); !ok {
+			t.Fatal("generated code should be valid")
+		}
+
+		uri := URI("Quickshare", "alice", secret)
+		if !strings.HasPrefix(uri, "otpauth://totp/Quickshare:alice?") || !strings.Contains(uri, "secret="+secret) {
+			t.Fatalf("incorrect uri %s", uri)
+		}
+	})
+}
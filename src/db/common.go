@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"path"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -24,9 +28,30 @@ const (
 	UserRole    = "user"
 	VisitorRole = "visitor"
 	BannedRole  = "banned"
+	// PendingRole is assigned to registered users who are waiting for approvals
+	PendingRole = "pending"
 
+	// RootID is the ID of the root admin created in initialization
+	RootID      = uint64(0)
 	VisitorID   = uint64(1)
 	VisitorName = "visitor"
+
+	// team folders are placed under this location: <GroupsLocation>/<groupName>/...
+	GroupsLocation = "_groups"
+
+	GroupPermRead  = "read"
+	GroupPermWrite = "write"
+
+	ACLSubjectUser  = "user"
+	ACLSubjectGroup = "group"
+
+	ACLPermRead   = "read"
+	ACLPermWrite  = "write"
+	ACLPermManage = "manage"
+
+	// scopes of api tokens, tokens without scopes have full access of their owners
+	APITokenScopeRead   = "read"
+	APITokenScopeUpload = "upload"
 )
 
 var (
@@ -48,6 +73,54 @@ var (
 	ErrGreaterThanSize = errors.New("uploaded is greater than file size")
 	ErrUploadNotFound  = errors.New("upload info not found")
 
+	// groups
+	ErrGroupNotFound       = errors.New("group not found")
+	ErrGroupMemberNotFound = errors.New("group member not found")
+	ErrInvalidGroup        = errors.New("invalid group")
+	ErrInvalidGroupPerm    = errors.New("invalid group permission")
+
+	// acls
+	ErrInvalidACL = errors.New("invalid acl")
+
+	// two-factor authentication
+	ErrMFANotFound         = errors.New("two-factor authentication not found")
+	ErrMFACodeUsed         = errors.New("one-time password is used")
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+
+	// invites
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteExpired  = errors.New("invite is expired")
+	ErrInviteUsedUp   = errors.New("invite is used up")
+	ErrInvalidInvite  = errors.New("invalid invite")
+
+	// quota policies
+	ErrQuotaPolicyNotFound = errors.New("quota policy not found")
+	ErrInvalidQuotaPolicy  = errors.New("invalid quota policy")
+
+	// password resets
+	ErrPwdResetNotFound = errors.New("password reset token not found")
+	ErrPwdResetExpired  = errors.New("password reset token is expired")
+
+	// sessions
+	ErrSessionNotFound = errors.New("session not found")
+
+	// identities
+	ErrIdentityNotFound = errors.New("identity not found")
+
+	// api tokens
+	ErrAPITokenNotFound = errors.New("api token not found")
+	ErrInvalidAPIToken  = errors.New("invalid api token")
+
+	// webhooks
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidWebhook          = errors.New("invalid webhook")
+
+	// roles
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleInUse    = errors.New("role is assigned to users")
+	ErrInvalidRole  = errors.New("invalid role")
+
 	// site
 	ErrConfigNotFound = errors.New("site config not found")
 
@@ -56,6 +129,9 @@ var (
 	ErrKeyExisting    = errors.New("key is existing")
 	ErrCreateExisting = errors.New("create upload info which already exists")
 	ErrQuota          = errors.New("quota limit reached")
+	ErrFileCountLimit = errors.New("file count limit reached")
+	ErrFileSizeLimit  = errors.New("file size limit exceeded")
+	ErrFileTypeDenied = errors.New("file type is not allowed")
 
 	DefaultSiteName = "Quickshare"
 	DefaultSiteDesc = "Quickshare"
@@ -120,6 +196,59 @@ type FileInfo struct {
 	ShareID string `json:"shareID" yaml:"shareID"`
 	Sha1    string `json:"sha1" yaml:"sha1"`
 	Size    int64  `json:"size" yaml:"size"`
+	// ModTime is the time (unix nanoseconds) when the file is uploaded, it is 0 if it is unknown
+	ModTime int64 `json:"modTime" yaml:"modTime"`
+}
+
+// DirStat is the recursive size and file count of a folder, only files recorded in the db are counted
+type DirStat struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	FileCount int64  `json:"fileCount"`
+	// ModTime is the latest ModTime of files in the folder
+	ModTime int64 `json:"modTime"`
+}
+
+const (
+	FileSortByPath    = "path"
+	FileSortByName    = "name"
+	FileSortBySize    = "size"
+	FileSortByModTime = "modTime"
+)
+
+// FileQuery filters files in t_file_info and folders in t_dir_stat,
+// folders without recorded files are not searched, zero values mean no limits
+type FileQuery struct {
+	// DirPaths are folders to search in, items under one of them are searched
+	DirPaths []string
+	// Names are lower-cased globs (containing "*", "?" or "[") or substrings of names, all of them must be matched
+	Names []string
+	// Exts are lower-cased extensions without dots, one of them must be matched
+	Exts []string
+	// size range (inclusive) of files, -1 means no limit
+	MinSize int64
+	MaxSize int64
+	// modification time range (unix nanoseconds): [ModifiedAfter, ModifiedBefore)
+	ModifiedAfter  int64
+	ModifiedBefore int64
+	IsDir          *bool
+	Sha1           string
+	// items are sorted by SortBy and then paths
+	SortBy string
+	Desc   bool
+	// After is the last item of the previous page
+	After *FileItem
+	Limit int
+}
+
+// FileItem is a file or a folder matched by FileQuery, sizes of folders are total sizes of files in them
+type FileItem struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	IsDir   bool   `json:"isDir"`
+	Sha1    string `json:"sha1"`
 }
 
 type UserCfg struct {
@@ -132,6 +261,15 @@ type Quota struct {
 	SpaceLimit         int64 `json:"spaceLimit,string" yaml:"spaceLimit,string"`
 	UploadSpeedLimit   int   `json:"uploadSpeedLimit" yaml:"uploadSpeedLimit"`
 	DownloadSpeedLimit int   `json:"downloadSpeedLimit" yaml:"downloadSpeedLimit"`
+	// limits of files in users' homes, 0 means unlimited
+	MaxFileCount int64 `json:"maxFileCount,string,omitempty" yaml:"maxFileCount,string,omitempty"`
+	MaxFileSize  int64 `json:"maxFileSize,string,omitempty" yaml:"maxFileSize,string,omitempty"`
+	// extensions (e.g. "exe") and MIME types (e.g. "image/*") of files,
+	// files are allowed if the allowed list is empty or it is matched, and the blocked list is not matched
+	AllowedExts  []string `json:"allowedExts,omitempty" yaml:"allowedExts,omitempty"`
+	BlockedExts  []string `json:"blockedExts,omitempty" yaml:"blockedExts,omitempty"`
+	AllowedTypes []string `json:"allowedTypes,omitempty" yaml:"allowedTypes,omitempty"`
+	BlockedTypes []string `json:"blockedTypes,omitempty" yaml:"blockedTypes,omitempty"`
 }
 
 type Preferences struct {
@@ -174,6 +312,341 @@ type User struct {
 	Preferences *Preferences `json:"preferences" yaml:"preferences"`
 }
 
+type GroupQuota struct {
+	SpaceLimit int64 `json:"spaceLimit,string" yaml:"spaceLimit,string"`
+}
+
+type Group struct {
+	ID        uint64      `json:"id,string" yaml:"id,string"`
+	Name      string      `json:"name" yaml:"name"`
+	UsedSpace int64       `json:"usedSpace,string" yaml:"usedSpace,string"`
+	Quota     *GroupQuota `json:"quota" yaml:"quota"`
+}
+
+type GroupMember struct {
+	GroupID  uint64 `json:"groupID,string" yaml:"groupID,string"`
+	UserID   uint64 `json:"userID,string" yaml:"userID,string"`
+	UserName string `json:"userName" yaml:"userName"`
+	Perm     string `json:"perm" yaml:"perm"`
+}
+
+// UserGroup is a group seen from one of its members
+type UserGroup struct {
+	Group *Group `json:"group" yaml:"group"`
+	Perm  string `json:"perm" yaml:"perm"`
+}
+
+// ACL grants a user or a group access to a directory and all its children
+type ACL struct {
+	Path        string `json:"path" yaml:"path"`
+	SubjectType string `json:"subjectType" yaml:"subjectType"`
+	SubjectID   uint64 `json:"subjectID,string" yaml:"subjectID,string"`
+	SubjectName string `json:"subjectName" yaml:"subjectName"`
+	Perm        string `json:"perm" yaml:"perm"`
+}
+
+// MFA is the TOTP two-factor authentication of a user, it is pending until it is enabled
+type MFA struct {
+	UserID  uint64 `json:"userID,string" yaml:"userID,string"`
+	Secret  string `json:"-" yaml:"-"`
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	// RecoveryCodes are hashes of one-time recovery codes
+	RecoveryCodes []string `json:"-" yaml:"-"`
+	// LastStep is the time step of the last used code to prevent replays
+	LastStep int64 `json:"-" yaml:"-"`
+}
+
+// Session is a login session, the token is invalid once its session is deleted
+type Session struct {
+	ID        string `json:"id" yaml:"id"`
+	UserID    uint64 `json:"userID,string" yaml:"userID,string"`
+	Device    string `json:"device" yaml:"device"`
+	IP        string `json:"ip" yaml:"ip"`
+	CreatedAt int64  `json:"createdAt,string" yaml:"createdAt,string"`
+	LastSeen  int64  `json:"lastSeen,string" yaml:"lastSeen,string"`
+	ExpireAt  int64  `json:"expireAt,string" yaml:"expireAt,string"`
+}
+
+// Invite allows registering users with the preset role and quota
+type Invite struct {
+	ID       uint64 `json:"id,string" yaml:"id,string"`
+	CodeHash string `json:"-" yaml:"-"`
+	Role     string `json:"role" yaml:"role"`
+	// Quota is nil if default quotas are used
+	Quota   *Quota `json:"quota" yaml:"quota"`
+	MaxUses int    `json:"maxUses" yaml:"maxUses"`
+	Used    int    `json:"used" yaml:"used"`
+	// ExpireAt is a unix timestamp, 0 means the invite never expires
+	ExpireAt  int64  `json:"expireAt,string" yaml:"expireAt,string"`
+	CreatedBy uint64 `json:"createdBy,string" yaml:"createdBy,string"`
+	CreatedAt int64  `json:"createdAt,string" yaml:"createdAt,string"`
+}
+
+const (
+	QuotaPolicyRole  = "role"
+	QuotaPolicyGroup = "group"
+	// QuotaPolicyUser is the explicit override of a user
+	QuotaPolicyUser = "user"
+)
+
+// QuotaPolicy is the quota inherited by users of the role or members of the group.
+// A user's effective quota is the user override, or the most generous group policy of the user's groups,
+// or the policy of the user's role, or the default quota in order.
+type QuotaPolicy struct {
+	SubjectType string `json:"subjectType" yaml:"subjectType"`
+	// Subject is the role name, the group ID or the user ID
+	Subject string `json:"subject" yaml:"subject"`
+	Quota   *Quota `json:"quota" yaml:"quota"`
+}
+
+// UserUsage is the storage usage of a user's home,
+// UsedSpace also includes uploading files while FileSize is the size of uploaded files
+type UserUsage struct {
+	ID         uint64 `json:"id,string" yaml:"id,string"`
+	Name       string `json:"name" yaml:"name"`
+	UsedSpace  int64  `json:"usedSpace,string" yaml:"usedSpace,string"`
+	SpaceLimit int64  `json:"spaceLimit,string" yaml:"spaceLimit,string"`
+	FileCount  int64  `json:"fileCount,string" yaml:"fileCount,string"`
+	FileSize   int64  `json:"fileSize,string" yaml:"fileSize,string"`
+}
+
+type FolderUsage struct {
+	Path      string `json:"path" yaml:"path"`
+	FileCount int64  `json:"fileCount,string" yaml:"fileCount,string"`
+	Size      int64  `json:"size,string" yaml:"size,string"`
+}
+
+type FileUsage struct {
+	Path string `json:"path" yaml:"path"`
+	// Creator is the ID of the user who uploaded the file
+	Creator uint64 `json:"creator,string" yaml:"creator,string"`
+	Size    int64  `json:"size,string" yaml:"size,string"`
+	Sha1    string `json:"sha1" yaml:"sha1"`
+}
+
+type DuplicateFiles struct {
+	Sha1  string   `json:"sha1" yaml:"sha1"`
+	Size  int64    `json:"size,string" yaml:"size,string"`
+	Paths []string `json:"paths" yaml:"paths"`
+	// Wasted is the space which could be saved by keeping only one copy
+	Wasted int64 `json:"wasted,string" yaml:"wasted,string"`
+}
+
+type UploadingInfo struct {
+	UserID       uint64 `json:"userID,string" yaml:"userID,string"`
+	RealFilePath string `json:"realFilePath" yaml:"realFilePath"`
+	TmpFilePath  string `json:"tmpFilePath" yaml:"tmpFilePath"`
+	Size         int64  `json:"size,string" yaml:"size,string"`
+	Uploaded     int64  `json:"uploaded,string" yaml:"uploaded,string"`
+}
+
+// markers around matched terms in snippets of content matches
+const (
+	SnippetMatchStart = "\ue000"
+	SnippetMatchEnd   = "\ue001"
+)
+
+// ContentMatch is a file whose extracted text matches a full-text query
+type ContentMatch struct {
+	Path string `json:"path" yaml:"path"`
+	// Snippet is a fragment of the text, matched terms are wrapped by SnippetMatchStart and SnippetMatchEnd
+	Snippet string `json:"snippet" yaml:"snippet"`
+	// Score is greater for better matches
+	Score float64 `json:"score" yaml:"score"`
+}
+
+const (
+	FileChangeCreate  = "create"
+	FileChangeUpload  = "upload"
+	FileChangeMove    = "move"
+	FileChangeDelete  = "delete"
+	FileChangeShare   = "share"
+	FileChangeUnshare = "unshare"
+)
+
+// FileChange is a mutation of files recorded in the change journal, changes are ordered by Seq
+type FileChange struct {
+	Seq uint64 `json:"seq,string" yaml:"seq,string"`
+	// UserID is the user who made the change
+	UserID uint64 `json:"userID,string" yaml:"userID,string"`
+	Op     string `json:"op" yaml:"op"`
+	Path   string `json:"path" yaml:"path"`
+	// NewPath is the destination of moving
+	NewPath   string `json:"newPath,omitempty" yaml:"newPath,omitempty"`
+	IsDir     bool   `json:"isDir" yaml:"isDir"`
+	Size      int64  `json:"size" yaml:"size"`
+	CreatedAt int64  `json:"createdAt" yaml:"createdAt"`
+}
+
+const (
+	WebhookEventFileUploaded    = "file.uploaded"
+	WebhookEventFileDeleted     = "file.deleted"
+	WebhookEventSharingCreated  = "sharing.created"
+	WebhookEventSharingAccessed = "sharing.accessed"
+	WebhookEventUserCreated     = "user.created"
+
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+const (
+	AuditActionLogin       = "login"
+	AuditActionSetPwd      = "pwd.set"
+	AuditActionForceSetPwd = "pwd.forceSet"
+	AuditActionResetPwd    = "pwd.reset"
+	AuditActionSetUser     = "user.set"
+	AuditActionAddUser     = "user.add"
+	AuditActionDelUser     = "user.delete"
+	AuditActionUpload      = "file.upload"
+	AuditActionDownload    = "file.download"
+	AuditActionDelete      = "file.delete"
+	AuditActionMove        = "file.move"
+	AuditActionAddSharing  = "sharing.add"
+	AuditActionDelSharing  = "sharing.delete"
+	AuditActionSetConfig   = "config.set"
+
+	AuditResultSucceeded = "succeeded"
+	AuditResultFailed    = "failed"
+)
+
+var WebhookEvents = []string{
+	WebhookEventFileUploaded,
+	WebhookEventFileDeleted,
+	WebhookEventSharingCreated,
+	WebhookEventSharingAccessed,
+	WebhookEventUserCreated,
+}
+
+// Webhook posts signed payloads of the Events to the URL,
+// a global webhook receives all events while others only receive events of their owners
+type Webhook struct {
+	ID     uint64 `json:"id,string" yaml:"id,string"`
+	UserID uint64 `json:"userID,string" yaml:"userID,string"`
+	URL    string `json:"url" yaml:"url"`
+	// Secret is the HMAC key of signing payloads
+	Secret    string   `json:"-" yaml:"-"`
+	Events    []string `json:"events" yaml:"events"`
+	Global    bool     `json:"global" yaml:"global"`
+	CreatedAt int64    `json:"createdAt,string" yaml:"createdAt,string"`
+}
+
+func (hook *Webhook) Subscribes(event string) bool {
+	for _, hookEvent := range hook.Events {
+		if hookEvent == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an attempt of posting a payload to a webhook, it is retried until it succeeds or it fails too many times
+type WebhookDelivery struct {
+	ID           uint64 `json:"id,string" yaml:"id,string"`
+	HookID       uint64 `json:"hookID,string" yaml:"hookID,string"`
+	Event        string `json:"event" yaml:"event"`
+	Payload      string `json:"payload" yaml:"payload"`
+	Status       string `json:"status" yaml:"status"`
+	Attempts     int    `json:"attempts" yaml:"attempts"`
+	ResponseCode int    `json:"responseCode" yaml:"responseCode"`
+	Error        string `json:"error" yaml:"error"`
+	// pending deliveries are retried after NextRetryAt
+	NextRetryAt int64 `json:"nextRetryAt,string" yaml:"nextRetryAt,string"`
+	CreatedAt   int64 `json:"createdAt,string" yaml:"createdAt,string"`
+	UpdatedAt   int64 `json:"updatedAt,string" yaml:"updatedAt,string"`
+}
+
+// StorageSnapshot is a user's usage recorded periodically for reporting the growth
+type StorageSnapshot struct {
+	UserID    uint64 `json:"userID,string" yaml:"userID,string"`
+	UsedSpace int64  `json:"usedSpace,string" yaml:"usedSpace,string"`
+	FileCount int64  `json:"fileCount,string" yaml:"fileCount,string"`
+	CreatedAt int64  `json:"createdAt,string" yaml:"createdAt,string"`
+}
+
+// LoginAttempt records a failed login for admins to review
+type LoginAttempt struct {
+	ID        uint64 `json:"id,string" yaml:"id,string"`
+	UserName  string `json:"userName" yaml:"userName"`
+	IP        string `json:"ip" yaml:"ip"`
+	Reason    string `json:"reason" yaml:"reason"`
+	CreatedAt int64  `json:"createdAt,string" yaml:"createdAt,string"`
+}
+
+// AuditLog records who did what to which target, e.g. who downloaded a file
+type AuditLog struct {
+	ID uint64 `json:"id,string" yaml:"id,string"`
+	// Actor is the name of the user, it is empty for visitors
+	Actor  string `json:"actor" yaml:"actor"`
+	IP     string `json:"ip" yaml:"ip"`
+	Action string `json:"action" yaml:"action"`
+	// Target is the path of files, the ID of users, or the name of users logging in
+	Target string `json:"target" yaml:"target"`
+	// Detail is extra information of the action, e.g. the destination of moving
+	Detail string `json:"detail" yaml:"detail"`
+	Result string `json:"result" yaml:"result"`
+	// Status is the HTTP status code of the response
+	Status    int   `json:"status" yaml:"status"`
+	CreatedAt int64 `json:"createdAt,string" yaml:"createdAt,string"`
+}
+
+// AuditLogFilter filters audit logs, empty fields are ignored
+type AuditLogFilter struct {
+	Actor  string
+	Action string
+	// Target matches the path and items inside it
+	Target string
+	Result string
+	// From and To are unix timestamps, logs in [From, To) are listed
+	From int64
+	To   int64
+	// BeforeID is the cursor, logs older than it are listed
+	BeforeID uint64
+}
+
+// Identity links an account of an external identity provider to a user
+type Identity struct {
+	Issuer  string `json:"issuer" yaml:"issuer"`
+	Subject string `json:"subject" yaml:"subject"`
+	UserID  uint64 `json:"userID,string" yaml:"userID,string"`
+}
+
+// APIToken is a personal access token, only the hash of the token is stored
+type APIToken struct {
+	ID         uint64   `json:"id,string" yaml:"id,string"`
+	UserID     uint64   `json:"userID,string" yaml:"userID,string"`
+	Name       string   `json:"name" yaml:"name"`
+	TokenHash  string   `json:"-" yaml:"-"`
+	Scopes     []string `json:"scopes" yaml:"scopes"`
+	PathPrefix string   `json:"pathPrefix" yaml:"pathPrefix"`
+	// ExpireAt is a unix timestamp, 0 means the token never expires
+	ExpireAt   int64 `json:"expireAt,string" yaml:"expireAt,string"`
+	CreatedAt  int64 `json:"createdAt,string" yaml:"createdAt,string"`
+	LastUsedAt int64 `json:"lastUsedAt,string" yaml:"lastUsedAt,string"`
+}
+
+// APIRule allows a role to call Method on Path,
+// a Path ending with "*" matches all paths with the same prefix
+type APIRule struct {
+	Method string `json:"method" yaml:"method"`
+	Path   string `json:"path" yaml:"path"`
+}
+
+func (rule *APIRule) Match(method, accessPath string) bool {
+	if rule.Method != method {
+		return false
+	}
+	if strings.HasSuffix(rule.Path, "*") {
+		return strings.HasPrefix(accessPath, strings.TrimSuffix(rule.Path, "*"))
+	}
+	return rule.Path == accessPath
+}
+
+type Role struct {
+	Name  string     `json:"name" yaml:"name"`
+	Rules []*APIRule `json:"rules" yaml:"rules"`
+}
+
 type UploadInfo struct {
 	RealFilePath string `json:"realFilePath" yaml:"realFilePath"`
 	Size         int64  `json:"size" yaml:"size"`
@@ -290,9 +763,139 @@ func CheckQuota(quota *Quota) error {
 	if quota.DownloadSpeedLimit < 0 {
 		return ErrInvalidQuota
 	}
+	if quota.MaxFileCount < 0 || quota.MaxFileSize < 0 {
+		return ErrInvalidQuota
+	}
+	for _, exts := range [][]string{quota.AllowedExts, quota.BlockedExts} {
+		for _, ext := range exts {
+			if strings.Trim(ext, ". ") == "" {
+				return fmt.Errorf("invalid extension(%s): %w", ext, ErrInvalidQuota)
+			}
+		}
+	}
+	for _, types := range [][]string{quota.AllowedTypes, quota.BlockedTypes} {
+		for _, mimeType := range types {
+			if parts := strings.Split(mimeType, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("invalid MIME type(%s): %w", mimeType, ErrInvalidQuota)
+			}
+		}
+	}
+	return nil
+}
+
+func CompareQuotas(q1, q2 *Quota) bool {
+	return reflect.DeepEqual(q1, q2)
+}
+
+// CheckFile checks if a file is allowed by the quota, the MIME type is not checked if it is empty
+func CheckFile(quota *Quota, fileName string, size int64, mimeType string) error {
+	if quota.MaxFileSize > 0 && size > quota.MaxFileSize {
+		return fmt.Errorf("%s is larger than %d bytes: %w", fileName, quota.MaxFileSize, ErrFileSizeLimit)
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(fileName), "."))
+	if len(quota.AllowedExts) > 0 && !matchExt(quota.AllowedExts, ext) {
+		return fmt.Errorf("extension(%s) is not allowed: %w", ext, ErrFileTypeDenied)
+	} else if matchExt(quota.BlockedExts, ext) {
+		return fmt.Errorf("extension(%s) is blocked: %w", ext, ErrFileTypeDenied)
+	}
+
+	if mimeType == "" {
+		return nil
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	if len(quota.AllowedTypes) > 0 && !matchMIMEType(quota.AllowedTypes, mimeType) {
+		return fmt.Errorf("type(%s) is not allowed: %w", mimeType, ErrFileTypeDenied)
+	} else if matchMIMEType(quota.BlockedTypes, mimeType) {
+		return fmt.Errorf("type(%s) is blocked: %w", mimeType, ErrFileTypeDenied)
+	}
 	return nil
 }
 
+func matchExt(exts []string, ext string) bool {
+	for _, pattern := range exts {
+		if strings.ToLower(strings.Trim(pattern, ". ")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMIMEType matches the type with patterns like "text/plain" or "image/*"
+func matchMIMEType(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == mimeType ||
+			(strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxQuota returns the most generous quota of each field, q1 can be nil
+func MaxQuota(q1, q2 *Quota) *Quota {
+	if q1 == nil {
+		quota := *q2
+		return &quota
+	}
+	quota := *q1
+	if q2.SpaceLimit > quota.SpaceLimit {
+		quota.SpaceLimit = q2.SpaceLimit
+	}
+	if q2.UploadSpeedLimit > quota.UploadSpeedLimit {
+		quota.UploadSpeedLimit = q2.UploadSpeedLimit
+	}
+	if q2.DownloadSpeedLimit > quota.DownloadSpeedLimit {
+		quota.DownloadSpeedLimit = q2.DownloadSpeedLimit
+	}
+	// 0 means unlimited
+	if quota.MaxFileCount != 0 && (q2.MaxFileCount == 0 || q2.MaxFileCount > quota.MaxFileCount) {
+		quota.MaxFileCount = q2.MaxFileCount
+	}
+	if quota.MaxFileSize != 0 && (q2.MaxFileSize == 0 || q2.MaxFileSize > quota.MaxFileSize) {
+		quota.MaxFileSize = q2.MaxFileSize
+	}
+	// an empty allowed list allows everything, and items are blocked only if they are blocked by both
+	quota.AllowedExts = unionAllowed(quota.AllowedExts, q2.AllowedExts)
+	quota.AllowedTypes = unionAllowed(quota.AllowedTypes, q2.AllowedTypes)
+	quota.BlockedExts = intersect(quota.BlockedExts, q2.BlockedExts)
+	quota.BlockedTypes = intersect(quota.BlockedTypes, q2.BlockedTypes)
+	return &quota
+}
+
+func unionAllowed(list1, list2 []string) []string {
+	if len(list1) == 0 || len(list2) == 0 {
+		return nil
+	}
+	union := append([]string{}, list1...)
+	for _, item := range list2 {
+		if !contains(list1, item) {
+			union = append(union, item)
+		}
+	}
+	return union
+}
+
+func intersect(list1, list2 []string) []string {
+	var intersection []string
+	for _, item := range list1 {
+		if contains(list2, item) {
+			intersection = append(intersection, item)
+		}
+	}
+	return intersection
+}
+
+func contains(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
 func CheckPreferences(prefers *Preferences, fillDefault bool) error {
 	if prefers.CSSURL == "" {
 		prefers.CSSURL = DefaultCSSURL
@@ -381,6 +984,150 @@ func CheckUser(user *User, fillDefault bool) error {
 	return nil
 }
 
+func CheckGroup(group *Group) error {
+	if group.Name == "" || strings.ContainsAny(group.Name, "/\\") {
+		return fmt.Errorf("invalid Name: (%w)", ErrInvalidGroup)
+	}
+	if group.UsedSpace < 0 {
+		return fmt.Errorf("invalid UsedSpace: (%w)", ErrInvalidGroup)
+	}
+	if group.Quota == nil || group.Quota.SpaceLimit < 0 {
+		return fmt.Errorf("invalid Quota: (%w)", ErrInvalidGroup)
+	}
+	return nil
+}
+
+func CheckGroupPerm(perm string) error {
+	if perm != GroupPermRead && perm != GroupPermWrite {
+		return ErrInvalidGroupPerm
+	}
+	return nil
+}
+
+func IsPredefinedRole(role string) bool {
+	return role == AdminRole || role == UserRole || role == VisitorRole || role == BannedRole || role == PendingRole
+}
+
+var ruleMethods = map[string]bool{
+	"GET":     true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"OPTIONS": true,
+}
+
+func CheckAPIRules(rules []*APIRule) error {
+	for _, rule := range rules {
+		if rule == nil || !ruleMethods[rule.Method] {
+			return fmt.Errorf("invalid rule method: (%w)", ErrInvalidRole)
+		}
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("invalid rule path: (%w)", ErrInvalidRole)
+		}
+	}
+	return nil
+}
+
+func CheckRole(role *Role) error {
+	if role.Name == "" || IsPredefinedRole(role.Name) {
+		return fmt.Errorf("invalid Name: (%w)", ErrInvalidRole)
+	}
+	return CheckAPIRules(role.Rules)
+}
+
+var aclPermLevels = map[string]int{
+	ACLPermRead:   1,
+	ACLPermWrite:  2,
+	ACLPermManage: 3,
+}
+
+// ACLPermLevel returns 0 for unknown perms, stronger perms have greater levels
+func ACLPermLevel(perm string) int {
+	return aclPermLevels[perm]
+}
+
+func CheckACL(acl *ACL) error {
+	if acl.Path == "" {
+		return fmt.Errorf("invalid Path: (%w)", ErrInvalidACL)
+	}
+	if acl.SubjectType != ACLSubjectUser && acl.SubjectType != ACLSubjectGroup {
+		return fmt.Errorf("invalid SubjectType: (%w)", ErrInvalidACL)
+	}
+	if ACLPermLevel(acl.Perm) == 0 {
+		return fmt.Errorf("invalid Perm: (%w)", ErrInvalidACL)
+	}
+	return nil
+}
+
+func CheckAPIToken(token *APIToken) error {
+	if token.Name == "" || token.TokenHash == "" {
+		return fmt.Errorf("invalid Name: (%w)", ErrInvalidAPIToken)
+	}
+	for _, scope := range token.Scopes {
+		if scope != APITokenScopeRead && scope != APITokenScopeUpload {
+			return fmt.Errorf("invalid Scopes: (%w)", ErrInvalidAPIToken)
+		}
+	}
+	if token.ExpireAt < 0 {
+		return fmt.Errorf("invalid ExpireAt: (%w)", ErrInvalidAPIToken)
+	}
+	return nil
+}
+
+func CheckWebhook(hook *Webhook) error {
+	hookURL, err := url.Parse(hook.URL)
+	if err != nil || (hookURL.Scheme != "http" && hookURL.Scheme != "https") || hookURL.Host == "" {
+		return fmt.Errorf("invalid URL: (%w)", ErrInvalidWebhook)
+	}
+	if hook.Secret == "" {
+		return fmt.Errorf("invalid Secret: (%w)", ErrInvalidWebhook)
+	}
+	if len(hook.Events) == 0 {
+		return fmt.Errorf("invalid Events: (%w)", ErrInvalidWebhook)
+	}
+	for _, event := range hook.Events {
+		valid := false
+		for _, knownEvent := range WebhookEvents {
+			if event == knownEvent {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid Events %s: (%w)", event, ErrInvalidWebhook)
+		}
+	}
+	return nil
+}
+
+func CheckInvite(invite *Invite) error {
+	if invite.CodeHash == "" || invite.Role == "" {
+		return fmt.Errorf("invalid CodeHash/Role: (%w)", ErrInvalidInvite)
+	}
+	if invite.Role == VisitorRole || invite.Role == PendingRole {
+		return fmt.Errorf("invalid Role: (%w)", ErrInvalidInvite)
+	}
+	if invite.MaxUses <= 0 || invite.Used < 0 || invite.ExpireAt < 0 {
+		return fmt.Errorf("invalid MaxUses/Used/ExpireAt: (%w)", ErrInvalidInvite)
+	}
+	if invite.Quota != nil {
+		if err := CheckQuota(invite.Quota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GroupOfPath returns the group name if itemPath is inside a team folder
+func GroupOfPath(itemPath string) (string, bool) {
+	parts := strings.Split(itemPath, "/")
+	if len(parts) < 2 || parts[0] != GroupsLocation || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
 // TODO: auto trigger hash generating
 func CheckFileInfo(info *FileInfo, fillDefault bool) error {
 	if (info.Shared && info.ShareID == "") || (!info.Shared && info.ShareID != "") {
@@ -391,3 +1138,23 @@ func CheckFileInfo(info *FileInfo, fillDefault bool) error {
 	}
 	return nil
 }
+
+func CheckQuotaPolicy(policy *QuotaPolicy) error {
+	switch policy.SubjectType {
+	case QuotaPolicyRole:
+		if policy.Subject == "" || policy.Subject == VisitorRole {
+			return fmt.Errorf("invalid role: (%w)", ErrInvalidQuotaPolicy)
+		}
+	case QuotaPolicyGroup, QuotaPolicyUser:
+		id, err := strconv.ParseUint(policy.Subject, 10, 64)
+		if err != nil || (policy.SubjectType == QuotaPolicyUser && id == VisitorID) {
+			return fmt.Errorf("invalid subject ID: (%w)", ErrInvalidQuotaPolicy)
+		}
+	default:
+		return fmt.Errorf("invalid subject type: (%w)", ErrInvalidQuotaPolicy)
+	}
+	if policy.Quota == nil {
+		return fmt.Errorf("quota is missing: (%w)", ErrInvalidQuotaPolicy)
+	}
+	return CheckQuota(policy.Quota)
+}
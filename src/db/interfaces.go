@@ -30,9 +30,43 @@ type IDBQuickshare interface {
 	InitUserTable(ctx context.Context, tx *sql.Tx, rootName, rootPwd string) error
 	InitFileTables(ctx context.Context, tx *sql.Tx) error
 	InitConfigTable(ctx context.Context, tx *sql.Tx, cfg *SiteConfig) error
+	InitGroupTables(ctx context.Context, tx *sql.Tx) error
+	InitRoleTable(ctx context.Context, tx *sql.Tx) error
+	InitACLTable(ctx context.Context, tx *sql.Tx) error
+	InitAPITokenTable(ctx context.Context, tx *sql.Tx) error
+	InitIdentityTable(ctx context.Context, tx *sql.Tx) error
+	InitSessionTable(ctx context.Context, tx *sql.Tx) error
+	InitMFATable(ctx context.Context, tx *sql.Tx) error
+	InitLoginAttemptTable(ctx context.Context, tx *sql.Tx) error
+	InitInviteTable(ctx context.Context, tx *sql.Tx) error
+	InitPwdResetTable(ctx context.Context, tx *sql.Tx) error
+	InitQuotaPolicyTable(ctx context.Context, tx *sql.Tx) error
+	InitStorageSnapshotTable(ctx context.Context, tx *sql.Tx) error
+	InitFileContentTable(ctx context.Context, tx *sql.Tx) error
+	InitDirStatTable(ctx context.Context, tx *sql.Tx) error
+	InitFileChangeTable(ctx context.Context, tx *sql.Tx) error
+	InitWebhookTables(ctx context.Context, tx *sql.Tx) error
+	InitAuditLogTable(ctx context.Context, tx *sql.Tx) error
+	// Upgrade creates tables introduced after the db was initialized
+	Upgrade(ctx context.Context) error
 	Close() error
 	IDBLockable
 	IUserDB
+	IGroupDB
+	IACLDB
+	IAPITokenDB
+	IIdentityDB
+	ISessionDB
+	IMFADB
+	ILoginAttemptDB
+	IInviteDB
+	IPwdResetDB
+	IQuotaPolicyDB
+	IStorageStatsDB
+	IFileContentDB
+	IFileChangeDB
+	IWebhookDB
+	IAuditLogDB
 	IFileDB
 	IUploadDB
 	ISharingDB
@@ -58,9 +92,175 @@ type IUserDB interface {
 	ResetUsed(ctx context.Context, id uint64, used int64) error
 	ListUsers(ctx context.Context) ([]*User, error)
 	ListUserIDs(ctx context.Context) (map[string]string, error)
-	AddRole(role string) error
-	DelRole(role string) error
-	ListRoles() (map[string]bool, error)
+	AddRole(ctx context.Context, role *Role) error
+	DelRole(ctx context.Context, name string) error
+	GetRole(ctx context.Context, name string) (*Role, error)
+	SetRoleRules(ctx context.Context, name string, rules []*APIRule) error
+	ListRoles(ctx context.Context) ([]*Role, error)
+}
+
+type IACLDB interface {
+	SetACL(ctx context.Context, acl *ACL) error
+	DelACL(ctx context.Context, itemPath, subjectType string, subjectId uint64) error
+	ListACLs(ctx context.Context, itemPath string) ([]*ACL, error)
+	// GetUserPerm returns the strongest permission granted to the user (or the user's groups)
+	// on itemPath or its ancestors, it returns "" if nothing is granted
+	GetUserPerm(ctx context.Context, userId uint64, itemPath string) (string, error)
+	ListUserACLs(ctx context.Context, userId uint64) ([]*ACL, error)
+}
+
+type IAPITokenDB interface {
+	AddAPIToken(ctx context.Context, token *APIToken) error
+	DelAPIToken(ctx context.Context, userId, id uint64) error
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error)
+	SetAPITokenUsed(ctx context.Context, id uint64, usedAt int64) error
+	ListAPITokens(ctx context.Context, userId uint64) ([]*APIToken, error)
+}
+
+type IMFADB interface {
+	// SetMFASecret resets the user's two-factor authentication to pending with the new secret
+	SetMFASecret(ctx context.Context, userId uint64, secret string) error
+	EnableMFA(ctx context.Context, userId uint64, recoveryCodes []string, step int64) error
+	GetMFA(ctx context.Context, userId uint64) (*MFA, error)
+	DelMFA(ctx context.Context, userId uint64) error
+	// UseMFAStep fails with ErrMFACodeUsed if the step is not later than the last used one
+	UseMFAStep(ctx context.Context, userId uint64, step int64) error
+	UseRecoveryCode(ctx context.Context, userId uint64, recoveryCode string) error
+}
+
+type IInviteDB interface {
+	AddInvite(ctx context.Context, invite *Invite) error
+	DelInvite(ctx context.Context, id uint64) error
+	ListInvites(ctx context.Context) ([]*Invite, error)
+	// UseInvite increases the used count if the invite is not expired or used up
+	UseInvite(ctx context.Context, codeHash string, now int64) (*Invite, error)
+	// ReleaseInvite reverts UseInvite when the registration fails
+	ReleaseInvite(ctx context.Context, id uint64) error
+}
+
+// IQuotaPolicyDB keeps users' effective quotas in t_user up to date with quota policies,
+// fallback is the default quota, users' current quotas are kept if it is nil
+type IQuotaPolicyDB interface {
+	// SetQuotaPolicy upserts the policy and returns the number of updated users
+	SetQuotaPolicy(ctx context.Context, policy *QuotaPolicy, fallback *Quota) (int, error)
+	// DelQuotaPolicy deletes the policy and returns the number of updated users
+	DelQuotaPolicy(ctx context.Context, subjectType, subject string, fallback *Quota) (int, error)
+	GetQuotaPolicy(ctx context.Context, subjectType, subject string) (*QuotaPolicy, error)
+	ListQuotaPolicies(ctx context.Context) ([]*QuotaPolicy, error)
+	// RefreshQuotas resolves the effective quotas of users, e.g. after their roles or groups are changed
+	RefreshQuotas(ctx context.Context, userIDs []uint64, fallback *Quota) (int, error)
+}
+
+// IStorageStatsDB aggregates file infos for storage reports
+type IStorageStatsDB interface {
+	ListUserUsages(ctx context.Context) ([]*UserUsage, error)
+	// ListFolderUsages lists usages of sub folders of the dir, usages of homes are listed if dirPath is empty
+	ListFolderUsages(ctx context.Context, dirPath string) ([]*FolderUsage, error)
+	ListLargestFiles(ctx context.Context, limit int) ([]*FileUsage, error)
+	// ListDuplicateFiles groups files by sha1 and size, groups wasting more space are listed first
+	ListDuplicateFiles(ctx context.Context, limit int) ([]*DuplicateFiles, error)
+	ListAllUploadInfos(ctx context.Context) ([]*UploadingInfo, error)
+	// AddStorageSnapshots records the usages of all users at the time
+	AddStorageSnapshots(ctx context.Context, createdAt int64) error
+	ListStorageSnapshots(ctx context.Context, since int64) ([]*StorageSnapshot, error)
+	DelStorageSnapshots(ctx context.Context, before int64) error
+}
+
+// IFileContentDB keeps extracted texts of files for full-text search,
+// texts are removed or moved together with file infos
+type IFileContentDB interface {
+	// SetFileContent replaces the text of the file, it is ignored if the file info does not exist (e.g. it is deleted)
+	SetFileContent(ctx context.Context, itemPath, content string) error
+	// SearchFileContents lists files matching the query under one of the dirs, better matches are listed first,
+	// all files are searched if dirPaths is nil
+	SearchFileContents(ctx context.Context, query string, dirPaths []string, limit int) ([]*ContentMatch, error)
+}
+
+// IFileChangeDB is the journal of file changes, changes of file infos are recorded in the same transactions
+type IFileChangeDB interface {
+	// AddFileChange records changes which do not update file infos, e.g. creating folders
+	AddFileChange(ctx context.Context, change *FileChange) error
+	// ListFileChanges lists changes after the seq under one of the dirs, all changes are listed if dirPaths is nil,
+	// it also returns the last checked seq, from which the next listing starts
+	ListFileChanges(ctx context.Context, afterSeq uint64, dirPaths []string, limit int) ([]*FileChange, uint64, error)
+	// GetFileChangeSeqs returns the first kept seq and the last seq ever recorded,
+	// the first seq is the last seq + 1 if no change is kept (e.g. all changes are removed)
+	GetFileChangeSeqs(ctx context.Context) (uint64, uint64, error)
+	// DelFileChanges removes changes created before the time
+	DelFileChanges(ctx context.Context, before int64) error
+}
+
+type IWebhookDB interface {
+	AddWebhook(ctx context.Context, hook *Webhook) error
+	// DelWebhook only removes the webhook owned by the user, its deliveries are also removed
+	DelWebhook(ctx context.Context, userId, id uint64) error
+	GetWebhook(ctx context.Context, id uint64) (*Webhook, error)
+	ListWebhooks(ctx context.Context, userId uint64) ([]*Webhook, error)
+	// ListEventWebhooks lists webhooks subscribing the event
+	ListEventWebhooks(ctx context.Context, event string) ([]*Webhook, error)
+	AddWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, id uint64) (*WebhookDelivery, error)
+	// SetWebhookDeliveryResult updates the status, attempts, response, error and retrying time of the delivery
+	SetWebhookDeliveryResult(ctx context.Context, delivery *WebhookDelivery) error
+	// ListWebhookDeliveries lists the latest deliveries of the webhook
+	ListWebhookDeliveries(ctx context.Context, hookId uint64, limit int) ([]*WebhookDelivery, error)
+	// ListDueWebhookDeliveries lists pending deliveries which should be retried before the time
+	ListDueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]*WebhookDelivery, error)
+	// DelWebhookDeliveries removes finished deliveries created before the time
+	DelWebhookDeliveries(ctx context.Context, before int64) error
+}
+
+type IAuditLogDB interface {
+	AddAuditLog(ctx context.Context, log *AuditLog) error
+	// ListAuditLogs lists logs matching the filter, the latest comes first
+	ListAuditLogs(ctx context.Context, filter *AuditLogFilter, limit int) ([]*AuditLog, error)
+	// DelAuditLogs removes logs created before the time
+	DelAuditLogs(ctx context.Context, before int64) error
+}
+
+type IPwdResetDB interface {
+	// AddPwdReset replaces the user's previous tokens, expired tokens are also cleaned
+	AddPwdReset(ctx context.Context, tokenHash string, userID uint64, expireAt, now int64) error
+	// UsePwdReset deletes the token and returns its user ID, tokens can be used only once
+	UsePwdReset(ctx context.Context, tokenHash string, now int64) (uint64, error)
+}
+
+type ILoginAttemptDB interface {
+	AddLoginAttempt(ctx context.Context, attempt *LoginAttempt) error
+	// ListLoginAttempts lists the latest attempts, all users' attempts are listed if userName is empty
+	ListLoginAttempts(ctx context.Context, userName string, limit int) ([]*LoginAttempt, error)
+	DelLoginAttempts(ctx context.Context, before int64) error
+}
+
+type ISessionDB interface {
+	AddSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, id string) (*Session, error)
+	SetSessionSeen(ctx context.Context, id, ip string, lastSeen int64) error
+	ListSessions(ctx context.Context, userId uint64) ([]*Session, error)
+	DelSession(ctx context.Context, userId uint64, id string) error
+	// DelSessions deletes all sessions of the user except exceptId
+	DelSessions(ctx context.Context, userId uint64, exceptId string) error
+	DelExpiredSessions(ctx context.Context, now int64) error
+}
+
+type IIdentityDB interface {
+	AddIdentity(ctx context.Context, identity *Identity) error
+	GetIdentity(ctx context.Context, issuer, subject string) (*Identity, error)
+	ListIdentities(ctx context.Context, userId uint64) ([]*Identity, error)
+}
+
+type IGroupDB interface {
+	AddGroup(ctx context.Context, group *Group) error
+	DelGroup(ctx context.Context, id uint64) error
+	GetGroup(ctx context.Context, id uint64) (*Group, error)
+	GetGroupByName(ctx context.Context, name string) (*Group, error)
+	SetGroupQuota(ctx context.Context, id uint64, quota *GroupQuota) error
+	ListGroups(ctx context.Context) ([]*Group, error)
+	SetGroupMember(ctx context.Context, groupId, userId uint64, perm string) error
+	DelGroupMember(ctx context.Context, groupId, userId uint64) error
+	GetGroupMember(ctx context.Context, groupId, userId uint64) (*GroupMember, error)
+	ListGroupMembers(ctx context.Context, groupId uint64) ([]*GroupMember, error)
+	ListUserGroups(ctx context.Context, userId uint64) ([]*UserGroup, error)
 }
 
 type IFilesFunctions interface {
@@ -76,6 +276,12 @@ type IFileDB interface {
 	SetSha1(ctx context.Context, itemPath, sign string) error
 	MoveFileInfo(ctx context.Context, userId uint64, oldPath, newPath string, isDir bool) error
 	ListFileInfos(ctx context.Context, itemPaths []string) (map[string]*FileInfo, error)
+	// ListDirStats returns stats of sub folders of the dir by their paths
+	ListDirStats(ctx context.Context, dirPath string) (map[string]*DirStat, error)
+	// QueryFiles lists at most query.Limit items matched by the query in the order of query.SortBy
+	QueryFiles(ctx context.Context, query *FileQuery) ([]*FileItem, error)
+	// SetModTimes sets mod times of recorded files by their paths, e.g. files recorded before mod times are kept
+	SetModTimes(ctx context.Context, modTimes map[string]int64) error
 }
 type IUploadDB interface {
 	AddUploadInfos(ctx context.Context, uploadId, userId uint64, tmpPath, filePath string, info *FileInfo) error
@@ -0,0 +1,251 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+const aclColumns = `a.path, a.subject_type, a.subject_id, coalesce(u.name, g.name, ''), a.perm
+		from t_acl a
+		left join t_user u on a.subject_type='user' and u.id=a.subject_id
+		left join t_group g on a.subject_type='group' and g.id=a.subject_id`
+
+// acls of the user and the user's groups
+const aclUserSubjects = `((a.subject_type='user' and a.subject_id=?) or
+		(a.subject_type='group' and a.subject_id in (
+			select group_id from t_group_member where user_id=?
+		)))`
+
+func scanACLs(rows *sql.Rows) ([]*db.ACL, error) {
+	acls := []*db.ACL{}
+	for rows.Next() {
+		acl := &db.ACL{}
+		err := rows.Scan(
+			&acl.Path,
+			&acl.SubjectType,
+			&acl.SubjectID,
+			&acl.SubjectName,
+			&acl.Perm,
+		)
+		if err != nil {
+			return nil, err
+		}
+		acls = append(acls, acl)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return acls, nil
+}
+
+func (st *BaseStore) SetACL(ctx context.Context, acl *db.ACL) error {
+	if err := db.CheckACL(acl); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if acl.SubjectType == db.ACLSubjectUser {
+		_, err = st.getUser(ctx, tx, acl.SubjectID)
+	} else {
+		_, err = st.getGroup(ctx, tx, acl.SubjectID)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_acl (path, subject_type, subject_id, perm) values (?, ?, ?, ?)
+		on conflict(path, subject_type, subject_id) do update set perm=excluded.perm`,
+		acl.Path,
+		acl.SubjectType,
+		acl.SubjectID,
+		acl.Perm,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) DelACL(ctx context.Context, itemPath, subjectType string, subjectId uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_acl
+		where path=? and subject_type=? and subject_id=?`,
+		itemPath,
+		subjectType,
+		subjectId,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListACLs(ctx context.Context, itemPath string) ([]*db.ACL, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`select %s
+			where a.path=?
+			order by a.subject_type, a.subject_id`,
+			aclColumns,
+		),
+		itemPath,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acls, err := scanACLs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return acls, nil
+}
+
+func (st *BaseStore) GetUserPerm(ctx context.Context, userId uint64, itemPath string) (string, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// acls are inherited from ancestors
+	parts := strings.Split(itemPath, "/")
+	placeholders := []string{}
+	values := []any{}
+	for i := 1; i <= len(parts); i++ {
+		placeholders = append(placeholders, "?")
+		values = append(values, strings.Join(parts[:i], "/"))
+	}
+	values = append(values, userId, userId)
+
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`select a.perm
+			from t_acl a
+			where a.path in (%s) and %s`,
+			strings.Join(placeholders, ","),
+			aclUserSubjects,
+		),
+		values...,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var perm, grantedPerm string
+	for rows.Next() {
+		err = rows.Scan(&perm)
+		if err != nil {
+			return "", err
+		}
+		if db.ACLPermLevel(perm) > db.ACLPermLevel(grantedPerm) {
+			grantedPerm = perm
+		}
+	}
+	if rows.Err() != nil {
+		return "", rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	return grantedPerm, nil
+}
+
+func (st *BaseStore) ListUserACLs(ctx context.Context, userId uint64) ([]*db.ACL, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`select %s
+			where %s
+			order by a.path`,
+			aclColumns,
+			aclUserSubjects,
+		),
+		userId,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acls, err := scanACLs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return acls, nil
+}
+
+// delACLsUnder removes acls on the item and its children
+func (st *BaseStore) delACLsUnder(ctx context.Context, tx *sql.Tx, itemPath string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`delete from t_acl
+		where path=? or path like ?`,
+		itemPath,
+		fmt.Sprintf("%s/%%", itemPath),
+	)
+	return err
+}
+
+// moveACLsUnder re-keys acls on the item and its children to the new path
+func (st *BaseStore) moveACLsUnder(ctx context.Context, tx *sql.Tx, oldPath, newPath string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`update t_acl
+		set path=? || substr(path, ?)
+		where path=? or path like ?`,
+		newPath,
+		len(oldPath)+1,
+		oldPath,
+		fmt.Sprintf("%s/%%", oldPath),
+	)
+	return err
+}
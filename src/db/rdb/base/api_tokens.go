@@ -0,0 +1,197 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func scanAPIToken(scan func(dest ...any) error) (*db.APIToken, error) {
+	token := &db.APIToken{}
+	var scopesStr string
+	err := scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		&scopesStr,
+		&token.PathPrefix,
+		&token.ExpireAt,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(scopesStr), &token.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (st *BaseStore) AddAPIToken(ctx context.Context, token *db.APIToken) error {
+	if err := db.CheckAPIToken(token); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getUser(ctx, tx, token.UserID); err != nil {
+		return err
+	}
+
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+	scopesStr, err := json.Marshal(token.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_api_token (
+			id, user_id, name, token_hash, scopes, path_prefix, expire_at, created_at, last_used_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		scopesStr,
+		token.PathPrefix,
+		token.ExpireAt,
+		token.CreatedAt,
+		token.LastUsedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DelAPIToken only removes the token owned by the user
+func (st *BaseStore) DelAPIToken(ctx context.Context, userId, id uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`delete from t_api_token
+		where id=? and user_id=?`,
+		id,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return db.ErrAPITokenNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*db.APIToken, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	token, err := scanAPIToken(
+		tx.QueryRowContext(
+			ctx,
+			`select id, user_id, name, token_hash, scopes, path_prefix, expire_at, created_at, last_used_at
+			from t_api_token
+			where token_hash=?`,
+			tokenHash,
+		).Scan,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (st *BaseStore) SetAPITokenUsed(ctx context.Context, id uint64, usedAt int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_api_token
+		set last_used_at=?
+		where id=?`,
+		usedAt,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListAPITokens(ctx context.Context, userId uint64) ([]*db.APIToken, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select id, user_id, name, token_hash, scopes, path_prefix, expire_at, created_at, last_used_at
+		from t_api_token
+		where user_id=?
+		order by created_at, id`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*db.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
@@ -0,0 +1,147 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) AddAuditLog(ctx context.Context, log *db.AuditLog) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_audit_log (
+			id, actor, ip, action, target, detail, result, status, created_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		log.ID,
+		log.Actor,
+		log.IP,
+		log.Action,
+		log.Target,
+		log.Detail,
+		log.Result,
+		log.Status,
+		log.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListAuditLogs(ctx context.Context, filter *db.AuditLogFilter, limit int) ([]*db.AuditLog, error) {
+	conds := []string{}
+	args := []interface{}{}
+	if filter.Actor != "" {
+		conds = append(conds, "actor=?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conds = append(conds, "action=?")
+		args = append(args, filter.Action)
+	}
+	if filter.Target != "" {
+		conds = append(conds, "(target=? or target like ?)")
+		args = append(args, filter.Target, fmt.Sprintf("%s/%%", filter.Target))
+	}
+	if filter.Result != "" {
+		conds = append(conds, "result=?")
+		args = append(args, filter.Result)
+	}
+	if filter.From > 0 {
+		conds = append(conds, "created_at>=?")
+		args = append(args, filter.From)
+	}
+	if filter.To > 0 {
+		conds = append(conds, "created_at<?")
+		args = append(args, filter.To)
+	}
+	if filter.BeforeID > 0 {
+		conds = append(conds, "id<?")
+		args = append(args, filter.BeforeID)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "where " + strings.Join(conds, " and ")
+	}
+	args = append(args, limit)
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`select id, actor, ip, action, target, detail, result, status, created_at
+			from t_audit_log
+			%s
+			order by id desc
+			limit ?`,
+			where,
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*db.AuditLog{}
+	for rows.Next() {
+		log := &db.AuditLog{}
+		err = rows.Scan(
+			&log.ID,
+			&log.Actor,
+			&log.IP,
+			&log.Action,
+			&log.Target,
+			&log.Detail,
+			&log.Result,
+			&log.Status,
+			&log.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (st *BaseStore) DelAuditLogs(ctx context.Context, before int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_audit_log
+		where created_at<?`,
+		before,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,171 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"path"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+// dirStatDeltas accumulates changes of folders' stats, a file's change is applied to all its ancestors,
+// mod times of folders are the latest mod times of added files
+type dirStatDeltas map[string]*db.DirStat
+
+func (deltas dirStatDeltas) add(filePath string, size, fileCount, modTime int64) {
+	for dirPath := path.Dir(filePath); dirPath != "." && dirPath != "/"; dirPath = path.Dir(dirPath) {
+		delta, ok := deltas[dirPath]
+		if !ok {
+			delta = &db.DirStat{Path: dirPath}
+			deltas[dirPath] = delta
+		}
+		delta.Size += size
+		delta.FileCount += fileCount
+		if modTime > delta.ModTime {
+			delta.ModTime = modTime
+		}
+	}
+}
+
+// applyDirStats updates stats of folders, stats of folders without files are removed
+func (st *BaseStore) applyDirStats(ctx context.Context, tx *sql.Tx, deltas dirStatDeltas) error {
+	for dirPath, delta := range deltas {
+		if delta.Size == 0 && delta.FileCount == 0 {
+			continue
+		}
+
+		parent, _ := path.Split(dirPath)
+		_, err := tx.ExecContext(
+			ctx,
+			`insert into t_dir_stat (path, parent, size, file_count, mod_time)
+			values (?, ?, ?, ?, ?)
+			on conflict(path) do update
+			set size=size+excluded.size,
+				file_count=file_count+excluded.file_count,
+				mod_time=max(mod_time, excluded.mod_time)`,
+			dirPath, parent, delta.Size, delta.FileCount, delta.ModTime,
+		)
+		if err != nil {
+			return err
+		}
+
+		if delta.FileCount < 0 {
+			_, err = tx.ExecContext(
+				ctx,
+				`delete from t_dir_stat
+				where path=? and file_count<=0`,
+				dirPath,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dirStatDeltasUnder returns the deltas of removing files under the dir
+func (st *BaseStore) dirStatDeltasUnder(ctx context.Context, tx *sql.Tx, dirPath string) (dirStatDeltas, error) {
+	lower, upper := pathRange(dirPath)
+	rows, err := tx.QueryContext(
+		ctx,
+		`select path, size
+		from t_file_info
+		where is_dir=false and (path=? or (path>? and path<?))`,
+		dirPath,
+		lower,
+		upper,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var filePath string
+	var size int64
+	deltas := dirStatDeltas{}
+	for rows.Next() {
+		if err = rows.Scan(&filePath, &size); err != nil {
+			return nil, err
+		}
+		deltas.add(filePath, -size, -1, 0)
+	}
+	return deltas, rows.Err()
+}
+
+// rebuildDirStats computes stats of all folders from t_file_info, e.g. the table is created in upgrading
+func (st *BaseStore) rebuildDirStats(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `delete from t_dir_stat`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select path, size, mod_time
+		from t_file_info
+		where is_dir=false`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var filePath string
+	var size, modTime int64
+	deltas := dirStatDeltas{}
+	for rows.Next() {
+		if err = rows.Scan(&filePath, &size, &modTime); err != nil {
+			return err
+		}
+		deltas.add(filePath, size, 1, modTime)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	return st.applyDirStats(ctx, tx, deltas)
+}
+
+// ListDirStats returns stats of sub folders of the dir, folders without recorded files are not returned
+func (st *BaseStore) ListDirStats(ctx context.Context, dirPath string) (map[string]*db.DirStat, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// parents end with "/", and items in the root have no parents
+	parent := ""
+	if dirPath != "" && dirPath != "." && dirPath != "/" {
+		parent = dirPath + "/"
+	}
+	rows, err := tx.QueryContext(
+		ctx,
+		`select path, size, file_count, mod_time
+		from t_dir_stat
+		where parent=?`,
+		parent,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := map[string]*db.DirStat{}
+	for rows.Next() {
+		stat := &db.DirStat{}
+		if err = rows.Scan(&stat.Path, &stat.Size, &stat.FileCount, &stat.ModTime); err != nil {
+			return nil, err
+		}
+		stats[stat.Path] = stat
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
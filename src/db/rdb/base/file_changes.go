@@ -0,0 +1,190 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) addFileChange(ctx context.Context, tx *sql.Tx, change *db.FileChange) error {
+	if change.CreatedAt == 0 {
+		change.CreatedAt = time.Now().Unix()
+	}
+	result, err := tx.ExecContext(
+		ctx,
+		`insert into t_file_change (
+			user, op, path, new_path,
+			is_dir, size, created_at
+		)
+		values (
+			?, ?, ?, ?,
+			?, ?, ?
+		)`,
+		change.UserID, change.Op, change.Path, change.NewPath,
+		change.IsDir, change.Size, change.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	seq, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	change.Seq = uint64(seq)
+	return nil
+}
+
+func (st *BaseStore) AddFileChange(ctx context.Context, change *db.FileChange) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = st.addFileChange(ctx, tx, change)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getFileChangeSeqs reads the last seq from sqlite_sequence (the high-water mark of autoincrement),
+// so that it is kept after all changes are removed, and the first seq is the last seq + 1 then
+func (st *BaseStore) getFileChangeSeqs(ctx context.Context, tx *sql.Tx) (uint64, uint64, error) {
+	var last uint64
+	err := tx.QueryRowContext(
+		ctx,
+		`select coalesce(max(seq), 0)
+		from sqlite_sequence
+		where name='t_file_change'`,
+	).Scan(&last)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var first uint64
+	err = tx.QueryRowContext(
+		ctx,
+		`select coalesce(min(seq), ?)
+		from t_file_change`,
+		last+1,
+	).Scan(&first)
+	return first, last, err
+}
+
+func (st *BaseStore) GetFileChangeSeqs(ctx context.Context) (uint64, uint64, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	first, last, err := st.getFileChangeSeqs(ctx, tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+	return first, last, nil
+}
+
+func (st *BaseStore) ListFileChanges(ctx context.Context, afterSeq uint64, dirPaths []string, limit int) ([]*db.FileChange, uint64, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	// changes are checked till the last seq, so that they are not checked again if none of them is matched
+	_, lastSeq, err := st.getFileChangeSeqs(ctx, tx)
+	if err != nil {
+		return nil, 0, err
+	} else if lastSeq < afterSeq || (dirPaths != nil && len(dirPaths) == 0) {
+		return []*db.FileChange{}, lastSeq, tx.Commit()
+	}
+
+	values := []any{afterSeq, lastSeq}
+	conditions := []string{}
+	for _, dirPath := range dirPaths {
+		lower, upper := pathRange(dirPath)
+		conditions = append(
+			conditions,
+			"path=? or (path>? and path<?)",
+			"new_path=? or (new_path>? and new_path<?)",
+		)
+		values = append(values, dirPath, lower, upper, dirPath, lower, upper)
+	}
+	pathCondition := ""
+	if len(conditions) > 0 {
+		pathCondition = fmt.Sprintf("and (%s)", strings.Join(conditions, " or "))
+	}
+	values = append(values, limit)
+
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`select seq, user, op, path, new_path, is_dir, size, created_at
+			from t_file_change
+			where seq>? and seq<=? %s
+			order by seq
+			limit ?`,
+			pathCondition,
+		),
+		values...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	changes := []*db.FileChange{}
+	for rows.Next() {
+		change := &db.FileChange{}
+		err = rows.Scan(
+			&change.Seq, &change.UserID, &change.Op, &change.Path, &change.NewPath,
+			&change.IsDir, &change.Size, &change.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, change)
+	}
+	if rows.Err() != nil {
+		return nil, 0, rows.Err()
+	}
+
+	if len(changes) == limit {
+		// there could be more changes after the page
+		lastSeq = changes[len(changes)-1].Seq
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+	return changes, lastSeq, nil
+}
+
+func (st *BaseStore) DelFileChanges(ctx context.Context, before int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_file_change
+		where created_at<?`,
+		before,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,222 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+// pathRange returns the bounds of paths under the dir: "dir/" < path < "dir0" ('0' follows '/'),
+// unlike "like" it is not affected by wildcards in paths and it uses the index
+func pathRange(dirPath string) (string, string) {
+	return dirPath + "/", dirPath + "0"
+}
+
+// ftsQuery converts the user's query into a fts5 query which matches all terms,
+// terms are quoted so that they are not parsed as operators, quoted phrases and prefixes (e.g. "budg*") are kept
+func ftsQuery(query string) string {
+	terms := []string{}
+	term := &strings.Builder{}
+	quoted := false
+	addTerm := func() {
+		termStr := term.String()
+		term.Reset()
+		prefix := false
+		if !quoted && strings.HasSuffix(termStr, "*") {
+			termStr, prefix = strings.TrimRight(termStr, "*"), true
+		}
+		if strings.TrimSpace(termStr) == "" {
+			return
+		}
+		termStr = `"` + termStr + `"`
+		if prefix {
+			termStr += "*"
+		}
+		terms = append(terms, termStr)
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			addTerm()
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			addTerm()
+		default:
+			term.WriteRune(r)
+		}
+	}
+	addTerm()
+	return strings.Join(terms, " ")
+}
+
+func (st *BaseStore) SetFileContent(ctx context.Context, itemPath, content string) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the file could be deleted before its text is extracted
+	var count int
+	err = tx.QueryRowContext(
+		ctx,
+		`select count(*)
+		from t_file_info
+		where path=?`,
+		itemPath,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 || content == "" {
+		_, err = tx.ExecContext(
+			ctx,
+			`delete from t_file_content
+			where path=?`,
+			itemPath,
+		)
+	} else {
+		_, err = tx.ExecContext(
+			ctx,
+			`insert into t_file_content (path, content)
+			values (?, ?)
+			on conflict(path) do update set content=excluded.content`,
+			itemPath,
+			content,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) SearchFileContents(ctx context.Context, query string, dirPaths []string, limit int) ([]*db.ContentMatch, error) {
+	matchQuery := ftsQuery(query)
+	if matchQuery == "" || (dirPaths != nil && len(dirPaths) == 0) {
+		return []*db.ContentMatch{}, nil
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	values := []any{db.SnippetMatchStart, db.SnippetMatchEnd, matchQuery}
+	conditions := []string{}
+	for _, dirPath := range dirPaths {
+		lower, upper := pathRange(dirPath)
+		conditions = append(conditions, "c.path=? or (c.path>? and c.path<?)")
+		values = append(values, dirPath, lower, upper)
+	}
+	pathCondition := ""
+	if len(conditions) > 0 {
+		pathCondition = fmt.Sprintf("and (%s)", strings.Join(conditions, " or "))
+	}
+	values = append(values, limit)
+
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`select c.path, snippet(t_file_content_fts, 0, ?, ?, '...', 16), bm25(t_file_content_fts)
+			from t_file_content_fts
+			join t_file_content c on c.id=t_file_content_fts.rowid
+			where t_file_content_fts match ? %s
+			order by bm25(t_file_content_fts), c.path
+			limit ?`,
+			pathCondition,
+		),
+		values...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []*db.ContentMatch{}
+	for rows.Next() {
+		match := &db.ContentMatch{}
+		var rank float64
+		if err = rows.Scan(&match.Path, &match.Snippet, &rank); err != nil {
+			return nil, err
+		}
+		// bm25 is negative and smaller for better matches
+		match.Score = -rank
+		matches = append(matches, match)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+func (st *BaseStore) delFileContentsUnder(ctx context.Context, tx *sql.Tx, itemPath string) error {
+	lower, upper := pathRange(itemPath)
+	_, err := tx.ExecContext(
+		ctx,
+		`delete from t_file_content
+		where path=? or (path>? and path<?)`,
+		itemPath,
+		lower,
+		upper,
+	)
+	return err
+}
+
+// moveFileContentsUnder re-keys texts of the item and its children to the new path
+func (st *BaseStore) moveFileContentsUnder(ctx context.Context, tx *sql.Tx, oldPath, newPath string) error {
+	lower, upper := pathRange(oldPath)
+	rows, err := tx.QueryContext(
+		ctx,
+		`select id, path
+		from t_file_content
+		where path=? or (path>? and path<?)`,
+		oldPath,
+		lower,
+		upper,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var id uint64
+	var itemPath string
+	movedPaths := map[uint64]string{}
+	for rows.Next() {
+		if err = rows.Scan(&id, &itemPath); err != nil {
+			return err
+		}
+		movedPaths[id] = newPath + strings.TrimPrefix(itemPath, oldPath)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	for id, movedPath := range movedPaths {
+		_, err = tx.ExecContext(
+			ctx,
+			`update t_file_content
+			set path=?
+			where id=?`,
+			movedPath,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
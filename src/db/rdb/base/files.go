@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"path"
 	"strings"
 
@@ -17,11 +18,11 @@ func (st *BaseStore) getFileInfo(ctx context.Context, tx *sql.Tx, itemPath strin
 	fInfo := &db.FileInfo{}
 	var id uint64
 	var isDir bool
-	var size int64
+	var size, modTime int64
 	var shareId string
 	err := tx.QueryRowContext(
 		ctx,
-		`select id, is_dir, size, share_id, info
+		`select id, is_dir, size, share_id, info, mod_time
 		from t_file_info
 		where path=?`,
 		itemPath,
@@ -31,6 +32,7 @@ func (st *BaseStore) getFileInfo(ctx context.Context, tx *sql.Tx, itemPath strin
 		&size,
 		&shareId,
 		&infoStr,
+		&modTime,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -46,6 +48,7 @@ func (st *BaseStore) getFileInfo(ctx context.Context, tx *sql.Tx, itemPath strin
 	fInfo.Id = id
 	fInfo.IsDir = isDir
 	fInfo.Size = size
+	fInfo.ModTime = modTime
 	fInfo.ShareID = shareId
 	fInfo.Shared = shareId != ""
 	return fInfo, nil
@@ -87,7 +90,7 @@ func (st *BaseStore) ListFileInfos(ctx context.Context, itemPaths []string) (map
 	rows, err := tx.QueryContext(
 		ctx,
 		fmt.Sprintf(
-			`select id, path, is_dir, size, share_id, info
+			`select id, path, is_dir, size, share_id, info, mod_time
 			from t_file_info
 			where path in (%s)
 			`,
@@ -102,13 +105,13 @@ func (st *BaseStore) ListFileInfos(ctx context.Context, itemPaths []string) (map
 
 	var fInfoStr, itemPath, shareId string
 	var isDir bool
-	var size int64
+	var size, modTime int64
 	var id uint64
 	fInfos := map[string]*db.FileInfo{}
 	for rows.Next() {
 		fInfo := &db.FileInfo{}
 
-		err = rows.Scan(&id, &itemPath, &isDir, &size, &shareId, &fInfoStr)
+		err = rows.Scan(&id, &itemPath, &isDir, &size, &shareId, &fInfoStr, &modTime)
 		if err != nil {
 			return nil, err
 		}
@@ -120,6 +123,7 @@ func (st *BaseStore) ListFileInfos(ctx context.Context, itemPaths []string) (map
 		fInfo.Id = id
 		fInfo.IsDir = isDir
 		fInfo.Size = size
+		fInfo.ModTime = modTime
 		fInfo.ShareID = shareId
 		fInfo.Shared = shareId != ""
 		fInfos[itemPath] = fInfo
@@ -151,14 +155,14 @@ func (st *BaseStore) addFileInfo(ctx context.Context, tx *sql.Tx, infoId, userId
 		ctx,
 		`insert into t_file_info (
 			id, path, user, location, parent, name,
-			is_dir, size, share_id, info
+			is_dir, size, share_id, info, mod_time
 		)
 		values (
 			?, ?, ?, ?, ?, ?,
-			?, ?, ?, ?
+			?, ?, ?, ?, ?
 		)`,
 		infoId, itemPath, userId, location, dirPath, itemName,
-		info.IsDir, info.Size, info.ShareID, infoStr,
+		info.IsDir, info.Size, info.ShareID, infoStr, info.ModTime,
 	)
 	return err
 }
@@ -176,11 +180,19 @@ func (st *BaseStore) AddFileInfo(ctx context.Context, infoId, userId uint64, ite
 	}
 
 	// increase used space
-	err = st.setUsed(ctx, tx, userId, true, info.Size)
+	err = st.setUsedByPath(ctx, tx, userId, itemPath, true, info.Size)
 	if err != nil {
 		return err
 	}
 
+	if !info.IsDir {
+		deltas := dirStatDeltas{}
+		deltas.add(itemPath, info.Size, 1, info.ModTime)
+		if err = st.applyDirStats(ctx, tx, deltas); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -237,7 +249,7 @@ func (st *BaseStore) DelFileInfo(ctx context.Context, userID uint64, itemPath st
 	// get all children and size
 	rows, err := tx.QueryContext(
 		ctx,
-		`select path, size
+		`select path, is_dir, size
 		from t_file_info
 		where path = ? or path like ?
 		`,
@@ -250,22 +262,58 @@ func (st *BaseStore) DelFileInfo(ctx context.Context, userID uint64, itemPath st
 	defer rows.Close()
 
 	var childrenPath string
+	var isDir bool
 	var itemSize int64
 	placeholders := []string{}
 	values := []any{}
 	decrSize := int64(0)
+	deltas := dirStatDeltas{}
+	// folders usually have no infos, so that the item is a folder if it has children
+	itemIsDir := false
 	for rows.Next() {
-		err = rows.Scan(&childrenPath, &itemSize)
+		err = rows.Scan(&childrenPath, &isDir, &itemSize)
 		if err != nil {
 			return err
 		}
 		placeholders = append(placeholders, "?")
 		values = append(values, childrenPath)
 		decrSize += itemSize
+		if !isDir {
+			deltas.add(childrenPath, -itemSize, -1, 0)
+		}
+		if isDir || childrenPath != itemPath {
+			itemIsDir = true
+		}
 	}
 
 	// decrease used space
-	err = st.setUsed(ctx, tx, userID, false, decrSize)
+	err = st.setUsedByPath(ctx, tx, userID, itemPath, false, decrSize)
+	if err != nil {
+		return err
+	}
+
+	err = st.delACLsUnder(ctx, tx, itemPath)
+	if err != nil {
+		return err
+	}
+
+	err = st.delFileContentsUnder(ctx, tx, itemPath)
+	if err != nil {
+		return err
+	}
+
+	err = st.applyDirStats(ctx, tx, deltas)
+	if err != nil {
+		return err
+	}
+
+	err = st.addFileChange(ctx, tx, &db.FileChange{
+		UserID: userID,
+		Op:     db.FileChangeDelete,
+		Path:   itemPath,
+		IsDir:  itemIsDir,
+		Size:   decrSize,
+	})
 	if err != nil {
 		return err
 	}
@@ -294,28 +342,275 @@ func (st *BaseStore) MoveFileInfo(ctx context.Context, userId uint64, oldPath, n
 	}
 	defer tx.Rollback()
 
-	info, err := st.getFileInfo(ctx, tx, oldPath)
+	err = st.moveACLsUnder(ctx, tx, oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	err = st.moveFileContentsUnder(ctx, tx, oldPath, newPath)
 	if err != nil {
-		if errors.Is(err, db.ErrFileInfoNotFound) {
-			// info for file does not exist so no need to move it
-			// e.g. folder info is not created before
-			// TODO: but sometimes it could be a bug
-			return nil
-		}
 		return err
 	}
-	err = st.delFileInfo(ctx, tx, oldPath)
+
+	err = st.addFileChange(ctx, tx, &db.FileChange{
+		UserID:  userId,
+		Op:      db.FileChangeMove,
+		Path:    oldPath,
+		NewPath: newPath,
+		IsDir:   isDir,
+	})
 	if err != nil {
 		return err
 	}
-	err = st.addFileInfo(ctx, tx, info.Id, userId, newPath, info)
+
+	infos, err := st.listFileInfosUnder(ctx, tx, oldPath)
 	if err != nil {
 		return err
+	} else if len(infos) == 0 {
+		// info for file does not exist so no need to move it
+		// e.g. folder info is not created before
+		// TODO: but sometimes it could be a bug
+		return tx.Commit()
+	}
+
+	if err = st.checkMovedFiles(ctx, tx, userId, oldPath, newPath, infos); err != nil {
+		return err
 	}
 
+	// used space is transferred when items are moved between homes and team folders
+	if spaceOwner(oldPath) != spaceOwner(newPath) {
+		movedSize := int64(0)
+		for _, info := range infos {
+			movedSize += info.Size
+		}
+		err = st.setUsedByLocation(ctx, tx, oldPath, false, movedSize)
+		if err != nil {
+			return err
+		}
+		err = st.setUsedByLocation(ctx, tx, newPath, true, movedSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	deltas := dirStatDeltas{}
+	for itemPath, info := range infos {
+		err = st.delFileInfo(ctx, tx, itemPath)
+		if err != nil {
+			return err
+		}
+		movedPath := newPath + strings.TrimPrefix(itemPath, oldPath)
+		err = st.addFileInfo(ctx, tx, info.Id, userId, movedPath, info)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir {
+			deltas.add(itemPath, -info.Size, -1, 0)
+			deltas.add(movedPath, info.Size, 1, info.ModTime)
+		}
+	}
+
+	err = st.applyDirStats(ctx, tx, deltas)
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
+// listFileInfosUnder returns infos of the item and all its children
+func (st *BaseStore) listFileInfosUnder(ctx context.Context, tx *sql.Tx, itemPath string) (map[string]*db.FileInfo, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`select id, path, is_dir, size, share_id, info, mod_time
+		from t_file_info
+		where path=? or path like ?`,
+		itemPath,
+		fmt.Sprintf("%s/%%", itemPath),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fInfoStr, childPath, shareId string
+	var isDir bool
+	var size, modTime int64
+	var id uint64
+	fInfos := map[string]*db.FileInfo{}
+	for rows.Next() {
+		fInfo := &db.FileInfo{}
+
+		err = rows.Scan(&id, &childPath, &isDir, &size, &shareId, &fInfoStr, &modTime)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(fInfoStr), fInfo)
+		if err != nil {
+			return nil, err
+		}
+		fInfo.Id = id
+		fInfo.IsDir = isDir
+		fInfo.Size = size
+		fInfo.ModTime = modTime
+		fInfo.ShareID = shareId
+		fInfo.Shared = shareId != ""
+		fInfos[childPath] = fInfo
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return fInfos, nil
+}
+
+// setUsedByPath updates the group's used space if itemPath is in a team folder,
+// or it updates the used space of the home's owner
+func (st *BaseStore) setUsedByPath(ctx context.Context, tx *sql.Tx, userId uint64, itemPath string, incr bool, capacity int64) error {
+	if groupName, ok := db.GroupOfPath(itemPath); ok {
+		return st.setGroupUsed(ctx, tx, groupName, incr, capacity)
+	}
+	ownerId, err := st.getHomeOwnerId(ctx, tx, userId, itemPath)
+	if err != nil {
+		return err
+	}
+	return st.setUsed(ctx, tx, ownerId, incr, capacity)
+}
+
+// getHomeOwnerId returns id of the user whose home contains itemPath,
+// items could be written by others (e.g. admins or users granted by ACLs)
+// it falls back to userId if the location is not a user's home
+func (st *BaseStore) getHomeOwnerId(ctx context.Context, tx *sql.Tx, userId uint64, itemPath string) (uint64, error) {
+	location, err := getLocation(itemPath)
+	if err != nil {
+		return 0, err
+	}
+	ownerId, err := st.getUserIdByName(ctx, tx, location)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			return userId, nil
+		}
+		return 0, err
+	}
+	return ownerId, nil
+}
+
+func (st *BaseStore) getUserIdByName(ctx context.Context, tx *sql.Tx, name string) (uint64, error) {
+	var userId uint64
+	err := tx.QueryRowContext(
+		ctx,
+		`select id
+		from t_user
+		where name=?`,
+		name,
+	).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, db.ErrUserNotFound
+		}
+		return 0, err
+	}
+	return userId, nil
+}
+
+// setUsedByLocation updates used space of the owner of the location (a group or a user)
+func (st *BaseStore) setUsedByLocation(ctx context.Context, tx *sql.Tx, itemPath string, incr bool, capacity int64) error {
+	if groupName, ok := db.GroupOfPath(itemPath); ok {
+		return st.setGroupUsed(ctx, tx, groupName, incr, capacity)
+	}
+
+	location, err := getLocation(itemPath)
+	if err != nil {
+		return err
+	}
+	userId, err := st.getUserIdByName(ctx, tx, location)
+	if err != nil {
+		return err
+	}
+	return st.setUsed(ctx, tx, userId, incr, capacity)
+}
+
+// countFiles counts files in the user's home, including files being uploaded
+func (st *BaseStore) countFiles(ctx context.Context, tx *sql.Tx, userName string) (int64, error) {
+	var fileCount, uploadingCount int64
+	err := tx.QueryRowContext(
+		ctx,
+		`select count(*)
+		from t_file_info
+		where location=? and is_dir=false`,
+		userName,
+	).Scan(&fileCount)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRowContext(
+		ctx,
+		`select count(*)
+		from t_file_uploading
+		where real_path like ?`,
+		fmt.Sprintf("%s/%%", userName),
+	).Scan(&uploadingCount)
+	if err != nil {
+		return 0, err
+	}
+	return fileCount + uploadingCount, nil
+}
+
+func (st *BaseStore) checkFileCount(ctx context.Context, tx *sql.Tx, user *db.User, newFiles int64) error {
+	if user.Quota.MaxFileCount <= 0 || newFiles == 0 {
+		return nil
+	}
+	fileCount, err := st.countFiles(ctx, tx, user.Name)
+	if err != nil {
+		return err
+	} else if fileCount+newFiles > user.Quota.MaxFileCount {
+		return fmt.Errorf("%s can have at most %d files: %w", user.Name, user.Quota.MaxFileCount, db.ErrFileCountLimit)
+	}
+	return nil
+}
+
+// checkMovedFiles checks if files moved into a user's home are allowed by the owner's quota
+func (st *BaseStore) checkMovedFiles(ctx context.Context, tx *sql.Tx, userId uint64, oldPath, newPath string, infos map[string]*db.FileInfo) error {
+	if _, ok := db.GroupOfPath(newPath); ok {
+		return nil
+	}
+	ownerId, err := st.getHomeOwnerId(ctx, tx, userId, newPath)
+	if err != nil {
+		return err
+	}
+	owner, err := st.getUser(ctx, tx, ownerId)
+	if err != nil {
+		return err
+	}
+
+	newFiles := int64(0)
+	for itemPath, info := range infos {
+		if info.IsDir {
+			continue
+		}
+		newFiles++
+		movedPath := newPath + strings.TrimPrefix(itemPath, oldPath)
+		err = db.CheckFile(owner.Quota, path.Base(movedPath), info.Size, mime.TypeByExtension(path.Ext(movedPath)))
+		if err != nil {
+			return err
+		}
+	}
+
+	// files moved inside the home are counted already
+	if spaceOwner(oldPath) == spaceOwner(newPath) {
+		return nil
+	}
+	return st.checkFileCount(ctx, tx, owner, newFiles)
+}
+
+func spaceOwner(itemPath string) string {
+	if groupName, ok := db.GroupOfPath(itemPath); ok {
+		return path.Join(db.GroupsLocation, groupName)
+	}
+	location, _ := getLocation(itemPath)
+	return location
+}
+
 func getLocation(itemPath string) (string, error) {
 	// location is taken from item path
 	itemPathParts := strings.Split(itemPath, "/")
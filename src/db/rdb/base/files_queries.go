@@ -0,0 +1,231 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+// fileItemsView lists files in t_file_info and folders in t_dir_stat as items,
+// folder rows in t_file_info (e.g. shared folders) are not listed as they are not always recorded
+const fileItemsView = `select path, name, size, mod_time, false as is_dir,
+		lower(coalesce(json_extract(info, '$.sha1'), '')) as sha1
+	from t_file_info
+	where is_dir=false
+	union all
+	select path, substr(path, length(parent)+1) as name, size, mod_time, true as is_dir, '' as sha1
+	from t_dir_stat`
+
+// globEscape quotes wildcards of glob in brackets, e.g. "a*" becomes "a[*]"
+func globEscape(pattern string) string {
+	escaped := &strings.Builder{}
+	for _, r := range pattern {
+		if r == '*' || r == '?' || r == '[' || r == ']' {
+			escaped.WriteString("[" + string(r) + "]")
+		} else {
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+// fileSortKey returns the column of the sorting key, items with the same key are sorted by paths
+func fileSortKey(sortBy string) (string, error) {
+	switch sortBy {
+	case "", db.FileSortByPath:
+		return "", nil
+	case db.FileSortByName:
+		return "lower(name)", nil
+	case db.FileSortBySize:
+		return "size", nil
+	case db.FileSortByModTime:
+		return "mod_time", nil
+	}
+	return "", fmt.Errorf("unknown sorting key %s", sortBy)
+}
+
+func (st *BaseStore) QueryFiles(ctx context.Context, query *db.FileQuery) ([]*db.FileItem, error) {
+	items := []*db.FileItem{}
+	if len(query.DirPaths) == 0 || query.Limit <= 0 {
+		return items, nil
+	}
+	sortKey, err := fileSortKey(query.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{}
+	values := []any{}
+	dirConditions := []string{}
+	for _, dirPath := range query.DirPaths {
+		lower, upper := pathRange(dirPath)
+		dirConditions = append(dirConditions, "(path>? and path<?)")
+		values = append(values, lower, upper)
+	}
+	conditions = append(conditions, "("+strings.Join(dirConditions, " or ")+")")
+
+	for _, name := range query.Names {
+		if strings.ContainsAny(name, "*?[") {
+			conditions = append(conditions, "lower(name) glob ?")
+			values = append(values, name)
+		} else {
+			conditions = append(conditions, "instr(lower(name), ?)>0")
+			values = append(values, name)
+		}
+	}
+	if len(query.Exts) > 0 {
+		extConditions := []string{}
+		for _, ext := range query.Exts {
+			extConditions = append(extConditions, "lower(name) glob ?")
+			values = append(values, "*."+globEscape(ext))
+		}
+		conditions = append(conditions, "is_dir=false and ("+strings.Join(extConditions, " or ")+")")
+	}
+	// sizes of folders are not counted
+	if query.MinSize >= 0 {
+		conditions = append(conditions, "is_dir=false and size>=?")
+		values = append(values, query.MinSize)
+	}
+	if query.MaxSize >= 0 {
+		conditions = append(conditions, "is_dir=false and size<=?")
+		values = append(values, query.MaxSize)
+	}
+	if query.ModifiedAfter != 0 {
+		conditions = append(conditions, "mod_time>=?")
+		values = append(values, query.ModifiedAfter)
+	}
+	if query.ModifiedBefore != 0 {
+		conditions = append(conditions, "mod_time<?")
+		values = append(values, query.ModifiedBefore)
+	}
+	if query.IsDir != nil {
+		conditions = append(conditions, "is_dir=?")
+		values = append(values, *query.IsDir)
+	}
+	if query.Sha1 != "" {
+		conditions = append(conditions, "is_dir=false and sha1=?")
+		values = append(values, strings.ToLower(query.Sha1))
+	}
+
+	op, order := ">", "asc"
+	if query.Desc {
+		op, order = "<", "desc"
+	}
+	orderBy := fmt.Sprintf("path %s", order)
+	if sortKey != "" {
+		orderBy = fmt.Sprintf("%s %s, path %s", sortKey, order, order)
+	}
+	if query.After != nil {
+		if sortKey == "" {
+			conditions = append(conditions, fmt.Sprintf("path%s?", op))
+			values = append(values, query.After.Path)
+		} else {
+			var afterKey any
+			switch query.SortBy {
+			case db.FileSortByName:
+				afterKey = strings.ToLower(query.After.Name)
+			case db.FileSortBySize:
+				afterKey = query.After.Size
+			case db.FileSortByModTime:
+				afterKey = query.After.ModTime
+			}
+			conditions = append(conditions, fmt.Sprintf("(%s%s? or (%s=? and path%s?))", sortKey, op, sortKey, op))
+			values = append(values, afterKey, afterKey, query.After.Path)
+		}
+	}
+	values = append(values, query.Limit)
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`select path, name, size, mod_time, is_dir, sha1
+			from (%s)
+			where %s
+			order by %s
+			limit ?`,
+			fileItemsView,
+			strings.Join(conditions, " and "),
+			orderBy,
+		),
+		values...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &db.FileItem{}
+		err = rows.Scan(&item.Path, &item.Name, &item.Size, &item.ModTime, &item.IsDir, &item.Sha1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (st *BaseStore) SetModTimes(ctx context.Context, modTimes map[string]int64) error {
+	if len(modTimes) == 0 {
+		return nil
+	}
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deltas := dirStatDeltas{}
+	for filePath, modTime := range modTimes {
+		result, err := tx.ExecContext(
+			ctx,
+			`update t_file_info
+			set mod_time=?
+			where path=? and is_dir=false and mod_time<>?`,
+			modTime,
+			filePath,
+			modTime,
+		)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		} else if updated > 0 {
+			deltas.add(filePath, 0, 0, modTime)
+		}
+	}
+
+	// mod times of folders are only increased
+	for dirPath, delta := range deltas {
+		_, err = tx.ExecContext(
+			ctx,
+			`update t_dir_stat
+			set mod_time=max(mod_time, ?)
+			where path=?`,
+			delta.ModTime,
+			dirPath,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -154,6 +154,16 @@ func (st *BaseStore) AddSharing(ctx context.Context, infoId, userId uint64, dirP
 	if err != nil {
 		return err
 	}
+
+	err = st.addFileChange(ctx, tx, &db.FileChange{
+		UserID: userId,
+		Op:     db.FileChangeShare,
+		Path:   dirPath,
+		IsDir:  true,
+	})
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -175,6 +185,16 @@ func (st *BaseStore) DelSharing(ctx context.Context, userId uint64, dirPath stri
 		return err
 	}
 
+	err = st.addFileChange(ctx, tx, &db.FileChange{
+		UserID: userId,
+		Op:     db.FileChangeUnshare,
+		Path:   dirPath,
+		IsDir:  true,
+	})
+	if err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
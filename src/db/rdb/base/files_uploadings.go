@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"mime"
+	"path"
+	"time"
 
 	"github.com/ihexxa/quickshare/src/db"
 )
@@ -29,24 +32,53 @@ func (st *BaseStore) AddUploadInfos(ctx context.Context, uploadId, userId uint64
 	}
 	defer tx.Rollback()
 
-	userInfo, err := st.getUser(ctx, tx, userId)
-	if err != nil {
-		return err
-	} else if userInfo.UsedSpace+info.Size > int64(userInfo.Quota.SpaceLimit) {
-		return db.ErrQuota
-	}
+	if groupName, ok := db.GroupOfPath(filePath); ok {
+		// uploading to a team folder is charged to the group
+		_, _, _, err = st.getUploadInfo(ctx, tx, userId, filePath)
+		if err == nil {
+			return db.ErrKeyExisting
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
 
-	_, _, _, err = st.getUploadInfo(ctx, tx, userId, filePath)
-	if err == nil {
-		return db.ErrKeyExisting
-	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return err
-	}
+		err = st.setGroupUsed(ctx, tx, groupName, true, info.Size)
+		if err != nil {
+			if errors.Is(err, db.ErrReachedLimit) {
+				return db.ErrQuota
+			}
+			return err
+		}
+	} else {
+		ownerId, err := st.getHomeOwnerId(ctx, tx, userId, filePath)
+		if err != nil {
+			return err
+		}
+		userInfo, err := st.getUser(ctx, tx, ownerId)
+		if err != nil {
+			return err
+		} else if userInfo.UsedSpace+info.Size > int64(userInfo.Quota.SpaceLimit) {
+			return db.ErrQuota
+		}
+		err = db.CheckFile(userInfo.Quota, path.Base(filePath), info.Size, mime.TypeByExtension(path.Ext(filePath)))
+		if err != nil {
+			return err
+		}
+		if err = st.checkFileCount(ctx, tx, userInfo, 1); err != nil {
+			return err
+		}
 
-	userInfo.UsedSpace += info.Size
-	err = st.setUser(ctx, tx, userInfo)
-	if err != nil {
-		return err
+		_, _, _, err = st.getUploadInfo(ctx, tx, userId, filePath)
+		if err == nil {
+			return db.ErrKeyExisting
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		userInfo.UsedSpace += info.Size
+		err = st.setUser(ctx, tx, userInfo)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = st.addUploadInfoOnly(ctx, tx, uploadId, userId, tmpPath, filePath, info.Size)
@@ -84,7 +116,14 @@ func (st *BaseStore) delUploadingInfos(ctx context.Context, tx *sql.Tx, userId u
 		return err
 	}
 
-	userInfo, err := st.getUser(ctx, tx, userId)
+	if groupName, ok := db.GroupOfPath(realPath); ok {
+		return st.setGroupUsed(ctx, tx, groupName, false, size)
+	}
+	ownerId, err := st.getHomeOwnerId(ctx, tx, userId, realPath)
+	if err != nil {
+		return err
+	}
+	userInfo, err := st.getUser(ctx, tx, ownerId)
 	if err != nil {
 		return err
 	}
@@ -117,13 +156,31 @@ func (st *BaseStore) MoveUploadingInfos(ctx context.Context, infoId, userId uint
 	if err != nil {
 		return err
 	}
+	modTime := time.Now().UnixNano()
 	err = st.addFileInfo(ctx, tx, infoId, userId, itemPath, &db.FileInfo{
-		Size: size,
+		Size:    size,
+		ModTime: modTime,
 	})
 	if err != nil {
 		return err
 	}
 
+	deltas := dirStatDeltas{}
+	deltas.add(itemPath, size, 1, modTime)
+	err = st.applyDirStats(ctx, tx, deltas)
+	if err != nil {
+		return err
+	}
+
+	err = st.addFileChange(ctx, tx, &db.FileChange{
+		UserID: userId,
+		Op:     db.FileChangeUpload,
+		Path:   itemPath,
+		Size:   size,
+	})
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -0,0 +1,511 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) getGroup(ctx context.Context, tx *sql.Tx, id uint64) (*db.Group, error) {
+	group := &db.Group{}
+	var quotaStr string
+	err := tx.QueryRowContext(
+		ctx,
+		`select id, name, used_space, quota
+		from t_group
+		where id=?`,
+		id,
+	).Scan(
+		&group.ID,
+		&group.Name,
+		&group.UsedSpace,
+		&quotaStr,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrGroupNotFound
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(quotaStr), &group.Quota)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (st *BaseStore) getGroupByName(ctx context.Context, tx *sql.Tx, name string) (*db.Group, error) {
+	var id uint64
+	err := tx.QueryRowContext(
+		ctx,
+		`select id
+		from t_group
+		where name=?`,
+		name,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrGroupNotFound
+		}
+		return nil, err
+	}
+
+	return st.getGroup(ctx, tx, id)
+}
+
+func (st *BaseStore) AddGroup(ctx context.Context, group *db.Group) error {
+	if err := db.CheckGroup(group); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	quotaStr, err := json.Marshal(group.Quota)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_group (id, name, used_space, quota) values (?, ?, ?, ?)`,
+		group.ID,
+		group.Name,
+		group.UsedSpace,
+		quotaStr,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) DelGroup(ctx context.Context, id uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	group, err := st.getGroup(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_group_member where group_id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_acl where subject_type=? and subject_id=?`,
+		db.ACLSubjectGroup,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_quota_policy where subject_type=? and subject=?`,
+		db.QuotaPolicyGroup,
+		fmt.Sprint(id),
+	)
+	if err != nil {
+		return err
+	}
+
+	// file infos, texts and acls in the team folder are removed with the group
+	groupPath := path.Join(db.GroupsLocation, group.Name)
+	err = st.delACLsUnder(ctx, tx, groupPath)
+	if err != nil {
+		return err
+	}
+	err = st.delFileContentsUnder(ctx, tx, groupPath)
+	if err != nil {
+		return err
+	}
+	deltas, err := st.dirStatDeltasUnder(ctx, tx, groupPath)
+	if err != nil {
+		return err
+	}
+	err = st.applyDirStats(ctx, tx, deltas)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_file_info
+		where location=? and (path=? or path like ?)`,
+		db.GroupsLocation,
+		groupPath,
+		fmt.Sprintf("%s/%%", groupPath),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_group where id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetGroup(ctx context.Context, id uint64) (*db.Group, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	group, err := st.getGroup(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (st *BaseStore) GetGroupByName(ctx context.Context, name string) (*db.Group, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	group, err := st.getGroupByName(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (st *BaseStore) SetGroupQuota(ctx context.Context, id uint64, quota *db.GroupQuota) error {
+	if quota == nil || quota.SpaceLimit < 0 {
+		return db.ErrInvalidQuota
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = st.getGroup(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	quotaStr, err := json.Marshal(quota)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_group
+		set quota=?
+		where id=?`,
+		quotaStr,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListGroups(ctx context.Context) ([]*db.Group, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select id, name, used_space, quota
+		from t_group
+		order by name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*db.Group{}
+	for rows.Next() {
+		group := &db.Group{}
+		var quotaStr string
+		err = rows.Scan(
+			&group.ID,
+			&group.Name,
+			&group.UsedSpace,
+			&quotaStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(quotaStr), &group.Quota)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (st *BaseStore) setGroupUsed(ctx context.Context, tx *sql.Tx, groupName string, incr bool, capacity int64) error {
+	group, err := st.getGroupByName(ctx, tx, groupName)
+	if err != nil {
+		return err
+	}
+
+	if incr && group.UsedSpace+capacity > group.Quota.SpaceLimit {
+		return db.ErrReachedLimit
+	}
+
+	if incr {
+		group.UsedSpace = group.UsedSpace + capacity
+	} else {
+		if group.UsedSpace-capacity < 0 {
+			return db.ErrNegtiveUsedSpace
+		}
+		group.UsedSpace = group.UsedSpace - capacity
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_group
+		set used_space=?
+		where id=?`,
+		group.UsedSpace,
+		group.ID,
+	)
+	return err
+}
+
+func (st *BaseStore) SetGroupMember(ctx context.Context, groupId, userId uint64, perm string) error {
+	if err := db.CheckGroupPerm(perm); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getGroup(ctx, tx, groupId); err != nil {
+		return err
+	}
+	if _, err = st.getUser(ctx, tx, userId); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_group_member (group_id, user_id, perm) values (?, ?, ?)
+		on conflict(group_id, user_id) do update set perm=excluded.perm`,
+		groupId,
+		userId,
+		perm,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) DelGroupMember(ctx context.Context, groupId, userId uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_group_member
+		where group_id=? and user_id=?`,
+		groupId,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetGroupMember(ctx context.Context, groupId, userId uint64) (*db.GroupMember, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	member := &db.GroupMember{}
+	err = tx.QueryRowContext(
+		ctx,
+		`select m.group_id, m.user_id, u.name, m.perm
+		from t_group_member m
+		join t_user u on u.id=m.user_id
+		where m.group_id=? and m.user_id=?`,
+		groupId,
+		userId,
+	).Scan(
+		&member.GroupID,
+		&member.UserID,
+		&member.UserName,
+		&member.Perm,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrGroupMemberNotFound
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (st *BaseStore) ListGroupMembers(ctx context.Context, groupId uint64) ([]*db.GroupMember, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select m.group_id, m.user_id, u.name, m.perm
+		from t_group_member m
+		join t_user u on u.id=m.user_id
+		where m.group_id=?
+		order by u.name`,
+		groupId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*db.GroupMember{}
+	for rows.Next() {
+		member := &db.GroupMember{}
+		err = rows.Scan(
+			&member.GroupID,
+			&member.UserID,
+			&member.UserName,
+			&member.Perm,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (st *BaseStore) ListUserGroups(ctx context.Context, userId uint64) ([]*db.UserGroup, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select g.id, g.name, g.used_space, g.quota, m.perm
+		from t_group_member m
+		join t_group g on g.id=m.group_id
+		where m.user_id=?
+		order by g.name`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userGroups := []*db.UserGroup{}
+	for rows.Next() {
+		group := &db.Group{}
+		var quotaStr, perm string
+		err = rows.Scan(
+			&group.ID,
+			&group.Name,
+			&group.UsedSpace,
+			&quotaStr,
+			&perm,
+		)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(quotaStr), &group.Quota)
+		if err != nil {
+			return nil, err
+		}
+		userGroups = append(userGroups, &db.UserGroup{Group: group, Perm: perm})
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return userGroups, nil
+}
@@ -0,0 +1,108 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) AddIdentity(ctx context.Context, identity *db.Identity) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getUser(ctx, tx, identity.UserID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_user_identity (issuer, subject, user_id) values (?, ?, ?)`,
+		identity.Issuer,
+		identity.Subject,
+		identity.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetIdentity(ctx context.Context, issuer, subject string) (*db.Identity, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	identity := &db.Identity{}
+	err = tx.QueryRowContext(
+		ctx,
+		`select issuer, subject, user_id
+		from t_user_identity
+		where issuer=? and subject=?`,
+		issuer,
+		subject,
+	).Scan(
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.UserID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrIdentityNotFound
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (st *BaseStore) ListIdentities(ctx context.Context, userId uint64) ([]*db.Identity, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select issuer, subject, user_id
+		from t_user_identity
+		where user_id=?
+		order by issuer, subject`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*db.Identity{}
+	for rows.Next() {
+		identity := &db.Identity{}
+		err = rows.Scan(&identity.Issuer, &identity.Subject, &identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
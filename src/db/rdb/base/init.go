@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ihexxa/quickshare/src/db"
@@ -58,9 +59,106 @@ func (st *BaseStore) Init(ctx context.Context, rootName, rootPwd string, cfg *db
 		return err
 	}
 
+	if err = st.initNewTables(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Upgrade creates tables which are introduced after the db was initialized
+func (st *BaseStore) Upgrade(ctx context.Context) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = st.initNewTables(ctx, tx); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
+// addColumn adds the column if the table is created by previous versions without it
+func (st *BaseStore) addColumn(ctx context.Context, tx *sql.Tx, table, column, definition string) error {
+	var count int
+	err := tx.QueryRowContext(
+		ctx,
+		`select count(*)
+		from pragma_table_info(?)
+		where name=?`,
+		table,
+		column,
+	).Scan(&count)
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`alter table %s add column %s %s`, table, column, definition))
+	return err
+}
+
+// initNewTables must be idempotent
+func (st *BaseStore) initNewTables(ctx context.Context, tx *sql.Tx) error {
+	if err := st.InitGroupTables(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitRoleTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitACLTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitAPITokenTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitIdentityTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitSessionTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitMFATable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitLoginAttemptTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitInviteTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitPwdResetTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitQuotaPolicyTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitStorageSnapshotTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitFileContentTable(ctx, tx); err != nil {
+		return err
+	}
+	// mod times are added to t_file_info before stats of folders are computed from it
+	if err := st.addColumn(ctx, tx, "t_file_info", "mod_time", "bigint not null default 0"); err != nil {
+		return err
+	}
+	if err := st.InitDirStatTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitFileChangeTable(ctx, tx); err != nil {
+		return err
+	}
+	if err := st.InitWebhookTables(ctx, tx); err != nil {
+		return err
+	}
+	return st.InitAuditLogTable(ctx, tx)
+}
+
 func (st *BaseStore) InitUserTable(ctx context.Context, tx *sql.Tx, rootName, rootPwd string) error {
 	_, err := tx.ExecContext(
 		ctx,
@@ -88,7 +186,7 @@ func (st *BaseStore) InitUserTable(ctx context.Context, tx *sql.Tx, rootName, ro
 	}
 
 	admin := &db.User{
-		ID:   0,
+		ID:   db.RootID,
 		Name: rootName,
 		Pwd:  rootPwd,
 		Role: db.AdminRole,
@@ -142,6 +240,7 @@ func (st *BaseStore) InitFileTables(ctx context.Context, tx *sql.Tx) error {
 			size bigint not null,
 			share_id varchar not null,
 			info varchar not null,
+			mod_time bigint not null default 0,
 			primary key(id)
 		)`,
 	)
@@ -231,3 +330,414 @@ func (st *BaseStore) InitConfigTable(ctx context.Context, tx *sql.Tx, cfg *db.Si
 
 	return nil
 }
+
+func (st *BaseStore) InitGroupTables(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_group (
+			id bigint not null,
+			name varchar not null unique,
+			used_space bigint not null,
+			quota varchar not null,
+			primary key(id)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create table if not exists t_group_member (
+			group_id bigint not null,
+			user_id bigint not null,
+			perm varchar not null,
+			primary key(group_id, user_id)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_group_member_user on t_group_member (user_id)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitRoleTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_role (
+			name varchar not null,
+			rules varchar not null,
+			primary key(name)
+		)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitACLTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_acl (
+			path varchar not null,
+			subject_type varchar not null,
+			subject_id bigint not null,
+			perm varchar not null,
+			primary key(path, subject_type, subject_id)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_acl_subject on t_acl (subject_type, subject_id)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitAPITokenTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_api_token (
+			id bigint not null,
+			user_id bigint not null,
+			name varchar not null,
+			token_hash varchar not null unique,
+			scopes varchar not null,
+			path_prefix varchar not null,
+			expire_at bigint not null,
+			created_at bigint not null,
+			last_used_at bigint not null,
+			primary key(id)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_api_token_user on t_api_token (user_id)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitIdentityTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_user_identity (
+			issuer varchar not null,
+			subject varchar not null,
+			user_id bigint not null,
+			primary key(issuer, subject)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_user_identity_user on t_user_identity (user_id)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitSessionTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_session (
+			id varchar not null,
+			user_id bigint not null,
+			device varchar not null,
+			ip varchar not null,
+			created_at bigint not null,
+			last_seen bigint not null,
+			expire_at bigint not null,
+			primary key(id)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_session_user on t_session (user_id)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitMFATable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_user_mfa (
+			user_id bigint not null,
+			secret varchar not null,
+			enabled boolean not null,
+			recovery_codes varchar not null,
+			last_step bigint not null,
+			primary key(user_id)
+		)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitLoginAttemptTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_login_attempt (
+			id bigint not null,
+			user_name varchar not null,
+			ip varchar not null,
+			reason varchar not null,
+			created_at bigint not null,
+			primary key(id)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_login_attempt_user on t_login_attempt (user_name, created_at)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_login_attempt_created on t_login_attempt (created_at)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitInviteTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_invite (
+			id bigint not null,
+			code_hash varchar not null unique,
+			role varchar not null,
+			quota varchar not null,
+			max_uses integer not null,
+			used integer not null,
+			expire_at bigint not null,
+			created_by bigint not null,
+			created_at bigint not null,
+			primary key(id)
+		)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitPwdResetTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_pwd_reset (
+			token_hash varchar not null,
+			user_id bigint not null,
+			expire_at bigint not null,
+			created_at bigint not null,
+			primary key(token_hash)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_pwd_reset_user on t_pwd_reset (user_id)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitQuotaPolicyTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_quota_policy (
+			subject_type varchar not null,
+			subject varchar not null,
+			quota varchar not null,
+			primary key(subject_type, subject)
+		)`,
+	)
+	return err
+}
+
+func (st *BaseStore) InitStorageSnapshotTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`create table if not exists t_storage_snapshot (
+			user bigint not null,
+			used_space bigint not null,
+			file_count bigint not null,
+			created_at bigint not null,
+			primary key(user, created_at)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`create index if not exists i_storage_snapshot_created on t_storage_snapshot (created_at)`,
+	)
+	return err
+}
+
+// InitFileContentTable creates t_file_content and its fts5 index, the index is synced by triggers
+func (st *BaseStore) InitFileContentTable(ctx context.Context, tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`create table if not exists t_file_content (
+			id integer primary key autoincrement,
+			path varchar(4096) not null unique,
+			content text not null
+		)`,
+		`create virtual table if not exists t_file_content_fts using fts5 (
+			content,
+			content='t_file_content',
+			content_rowid='id',
+			tokenize='unicode61 remove_diacritics 2'
+		)`,
+		`create trigger if not exists t_file_content_ai after insert on t_file_content begin
+			insert into t_file_content_fts(rowid, content) values (new.id, new.content);
+		end`,
+		`create trigger if not exists t_file_content_ad after delete on t_file_content begin
+			insert into t_file_content_fts(t_file_content_fts, rowid, content) values ('delete', old.id, old.content);
+		end`,
+		`create trigger if not exists t_file_content_au after update of content on t_file_content begin
+			insert into t_file_content_fts(t_file_content_fts, rowid, content) values ('delete', old.id, old.content);
+			insert into t_file_content_fts(rowid, content) values (new.id, new.content);
+		end`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitDirStatTable creates t_dir_stat which keeps recursive sizes and file counts of folders,
+// stats are computed from t_file_info if the table is empty (e.g. it is created in upgrading)
+func (st *BaseStore) InitDirStatTable(ctx context.Context, tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`create table if not exists t_dir_stat (
+			path varchar(4096) not null,
+			parent varchar(4096) not null,
+			size bigint not null,
+			file_count bigint not null,
+			mod_time bigint not null default 0,
+			primary key(path)
+		)`,
+		`create index if not exists i_dir_stat_parent on t_dir_stat (parent)`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if err := st.addColumn(ctx, tx, "t_dir_stat", "mod_time", "bigint not null default 0"); err != nil {
+		return err
+	}
+
+	var statCount int64
+	err := tx.QueryRowContext(ctx, `select count(*) from t_dir_stat`).Scan(&statCount)
+	if err != nil {
+		return err
+	} else if statCount > 0 {
+		return nil
+	}
+	return st.rebuildDirStats(ctx, tx)
+}
+
+func (st *BaseStore) InitFileChangeTable(ctx context.Context, tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`create table if not exists t_file_change (
+			seq integer primary key autoincrement,
+			user bigint not null,
+			op varchar(32) not null,
+			path varchar(4096) not null,
+			new_path varchar(4096) not null,
+			is_dir boolean not null,
+			size bigint not null,
+			created_at bigint not null
+		)`,
+		`create index if not exists i_file_change_created on t_file_change (created_at)`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *BaseStore) InitWebhookTables(ctx context.Context, tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`create table if not exists t_webhook (
+			id bigint not null,
+			user_id bigint not null,
+			url varchar(4096) not null,
+			secret varchar not null,
+			events varchar not null,
+			global boolean not null,
+			created_at bigint not null,
+			primary key(id)
+		)`,
+		`create index if not exists i_webhook_user on t_webhook (user_id)`,
+		`create table if not exists t_webhook_delivery (
+			id bigint not null,
+			hook_id bigint not null,
+			event varchar(64) not null,
+			payload text not null,
+			status varchar(32) not null,
+			attempts integer not null,
+			response_code integer not null,
+			error varchar not null,
+			next_retry_at bigint not null,
+			created_at bigint not null,
+			updated_at bigint not null,
+			primary key(id)
+		)`,
+		`create index if not exists i_webhook_delivery_hook on t_webhook_delivery (hook_id, created_at)`,
+		`create index if not exists i_webhook_delivery_retry on t_webhook_delivery (status, next_retry_at)`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *BaseStore) InitAuditLogTable(ctx context.Context, tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`create table if not exists t_audit_log (
+			id bigint not null,
+			actor varchar not null,
+			ip varchar not null,
+			action varchar not null,
+			target varchar not null,
+			detail varchar not null,
+			result varchar not null,
+			status integer not null,
+			created_at bigint not null,
+			primary key(id)
+		)`,
+		`create index if not exists i_audit_log_actor on t_audit_log (actor, id)`,
+		`create index if not exists i_audit_log_target on t_audit_log (target)`,
+		`create index if not exists i_audit_log_created on t_audit_log (created_at)`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
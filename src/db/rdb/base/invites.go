@@ -0,0 +1,206 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func scanInvite(scan func(dest ...any) error) (*db.Invite, error) {
+	invite := &db.Invite{}
+	var quotaStr string
+	err := scan(
+		&invite.ID,
+		&invite.CodeHash,
+		&invite.Role,
+		&quotaStr,
+		&invite.MaxUses,
+		&invite.Used,
+		&invite.ExpireAt,
+		&invite.CreatedBy,
+		&invite.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// quota is "null" if default quotas are used
+	err = json.Unmarshal([]byte(quotaStr), &invite.Quota)
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (st *BaseStore) AddInvite(ctx context.Context, invite *db.Invite) error {
+	if err := db.CheckInvite(invite); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = st.checkRoleExisting(ctx, tx, invite.Role); err != nil {
+		return err
+	}
+
+	quotaStr, err := json.Marshal(invite.Quota)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_invite (
+			id, code_hash, role, quota, max_uses, used, expire_at, created_by, created_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		invite.ID,
+		invite.CodeHash,
+		invite.Role,
+		quotaStr,
+		invite.MaxUses,
+		invite.Used,
+		invite.ExpireAt,
+		invite.CreatedBy,
+		invite.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) DelInvite(ctx context.Context, id uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`delete from t_invite where id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return db.ErrInviteNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListInvites(ctx context.Context) ([]*db.Invite, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select id, code_hash, role, quota, max_uses, used, expire_at, created_by, created_at
+		from t_invite
+		order by created_at desc, id desc`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*db.Invite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (st *BaseStore) UseInvite(ctx context.Context, codeHash string, now int64) (*db.Invite, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	invite, err := scanInvite(
+		tx.QueryRowContext(
+			ctx,
+			`select id, code_hash, role, quota, max_uses, used, expire_at, created_by, created_at
+			from t_invite
+			where code_hash=?`,
+			codeHash,
+		).Scan,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrInviteNotFound
+		}
+		return nil, err
+	}
+	if invite.ExpireAt != 0 && invite.ExpireAt <= now {
+		return nil, db.ErrInviteExpired
+	} else if invite.Used >= invite.MaxUses {
+		return nil, db.ErrInviteUsedUp
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_invite
+		set used=used+1
+		where id=?`,
+		invite.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	invite.Used++
+	return invite, nil
+}
+
+func (st *BaseStore) ReleaseInvite(ctx context.Context, id uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_invite
+		set used=used-1
+		where id=? and used>0`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,103 @@
+package base
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) AddLoginAttempt(ctx context.Context, attempt *db.LoginAttempt) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_login_attempt (
+			id, user_name, ip, reason, created_at
+		) values (?, ?, ?, ?, ?)`,
+		attempt.ID,
+		attempt.UserName,
+		attempt.IP,
+		attempt.Reason,
+		attempt.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListLoginAttempts(ctx context.Context, userName string, limit int) ([]*db.LoginAttempt, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `select id, user_name, ip, reason, created_at
+		from t_login_attempt
+		order by created_at desc, id desc
+		limit ?`
+	args := []interface{}{limit}
+	if userName != "" {
+		query = `select id, user_name, ip, reason, created_at
+		from t_login_attempt
+		where user_name=?
+		order by created_at desc, id desc
+		limit ?`
+		args = []interface{}{userName, limit}
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*db.LoginAttempt{}
+	for rows.Next() {
+		attempt := &db.LoginAttempt{}
+		err = rows.Scan(
+			&attempt.ID,
+			&attempt.UserName,
+			&attempt.IP,
+			&attempt.Reason,
+			&attempt.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (st *BaseStore) DelLoginAttempts(ctx context.Context, before int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_login_attempt where created_at<?`,
+		before,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,215 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) getMFA(ctx context.Context, tx *sql.Tx, userId uint64) (*db.MFA, error) {
+	mfa := &db.MFA{}
+	var recoveryCodesStr string
+	err := tx.QueryRowContext(
+		ctx,
+		`select user_id, secret, enabled, recovery_codes, last_step
+		from t_user_mfa
+		where user_id=?`,
+		userId,
+	).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.Enabled,
+		&recoveryCodesStr,
+		&mfa.LastStep,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrMFANotFound
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(recoveryCodesStr), &mfa.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+func (st *BaseStore) setRecoveryCodes(ctx context.Context, tx *sql.Tx, userId uint64, recoveryCodes []string) error {
+	if recoveryCodes == nil {
+		recoveryCodes = []string{}
+	}
+	recoveryCodesStr, err := json.Marshal(recoveryCodes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_user_mfa
+		set recovery_codes=?
+		where user_id=?`,
+		recoveryCodesStr,
+		userId,
+	)
+	return err
+}
+
+func (st *BaseStore) SetMFASecret(ctx context.Context, userId uint64, secret string) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getUser(ctx, tx, userId); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_user_mfa (user_id, secret, enabled, recovery_codes, last_step)
+		values (?, ?, false, '[]', 0)
+		on conflict(user_id) do update set secret=?, enabled=false, recovery_codes='[]', last_step=0`,
+		userId,
+		secret,
+		secret,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) EnableMFA(ctx context.Context, userId uint64, recoveryCodes []string, step int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getMFA(ctx, tx, userId); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_user_mfa
+		set enabled=true, last_step=?
+		where user_id=?`,
+		step,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+	if err = st.setRecoveryCodes(ctx, tx, userId, recoveryCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetMFA(ctx context.Context, userId uint64) (*db.MFA, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	mfa, err := st.getMFA(ctx, tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+func (st *BaseStore) DelMFA(ctx context.Context, userId uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_user_mfa where user_id=?`,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) UseMFAStep(ctx context.Context, userId uint64, step int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`update t_user_mfa
+		set last_step=?
+		where user_id=? and last_step<?`,
+		step,
+		userId,
+		step,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return db.ErrMFACodeUsed
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode removes the recovery code so that it can be used only once
+func (st *BaseStore) UseRecoveryCode(ctx context.Context, userId uint64, recoveryCode string) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	mfa, err := st.getMFA(ctx, tx, userId)
+	if err != nil {
+		return err
+	} else if !mfa.Enabled {
+		return db.ErrInvalidRecoveryCode
+	}
+
+	found := false
+	remaining := []string{}
+	for _, code := range mfa.RecoveryCodes {
+		if !found && code == recoveryCode {
+			found = true
+			continue
+		}
+		remaining = append(remaining, code)
+	}
+	if !found {
+		return db.ErrInvalidRecoveryCode
+	}
+
+	if err = st.setRecoveryCodes(ctx, tx, userId, remaining); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,92 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) AddPwdReset(ctx context.Context, tokenHash string, userID uint64, expireAt, now int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = st.getUser(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_pwd_reset
+		where user_id=? or expire_at<=?`,
+		userID,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_pwd_reset (
+			token_hash, user_id, expire_at, created_at
+		) values (?, ?, ?, ?)`,
+		tokenHash,
+		userID,
+		expireAt,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) UsePwdReset(ctx context.Context, tokenHash string, now int64) (uint64, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID uint64
+	var expireAt int64
+	err = tx.QueryRowContext(
+		ctx,
+		`select user_id, expire_at
+		from t_pwd_reset
+		where token_hash=?`,
+		tokenHash,
+	).Scan(&userID, &expireAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, db.ErrPwdResetNotFound
+		}
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_pwd_reset
+		where token_hash=?`,
+		tokenHash,
+	)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	if expireAt <= now {
+		return 0, db.ErrPwdResetExpired
+	}
+	return userID, nil
+}
@@ -0,0 +1,328 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) getQuotaPolicy(ctx context.Context, tx *sql.Tx, subjectType, subject string) (*db.QuotaPolicy, error) {
+	policy := &db.QuotaPolicy{}
+	var quotaStr string
+	err := tx.QueryRowContext(
+		ctx,
+		`select subject_type, subject, quota
+		from t_quota_policy
+		where subject_type=? and subject=?`,
+		subjectType,
+		subject,
+	).Scan(&policy.SubjectType, &policy.Subject, &quotaStr)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrQuotaPolicyNotFound
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(quotaStr), &policy.Quota)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// resolveQuota returns nil if nothing is inherited and fallback is nil
+func (st *BaseStore) resolveQuota(ctx context.Context, tx *sql.Tx, user *db.User, fallback *db.Quota) (*db.Quota, error) {
+	policy, err := st.getQuotaPolicy(ctx, tx, db.QuotaPolicyUser, fmt.Sprint(user.ID))
+	if err == nil {
+		return policy.Quota, nil
+	} else if !errors.Is(err, db.ErrQuotaPolicyNotFound) {
+		return nil, err
+	}
+
+	groupIDs, err := st.listUserGroupIDs(ctx, tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var groupQuota *db.Quota
+	for _, groupID := range groupIDs {
+		policy, err = st.getQuotaPolicy(ctx, tx, db.QuotaPolicyGroup, fmt.Sprint(groupID))
+		if err != nil {
+			if errors.Is(err, db.ErrQuotaPolicyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		groupQuota = db.MaxQuota(groupQuota, policy.Quota)
+	}
+	if groupQuota != nil {
+		return groupQuota, nil
+	}
+
+	policy, err = st.getQuotaPolicy(ctx, tx, db.QuotaPolicyRole, user.Role)
+	if err == nil {
+		return policy.Quota, nil
+	} else if !errors.Is(err, db.ErrQuotaPolicyNotFound) {
+		return nil, err
+	}
+	return fallback, nil
+}
+
+func (st *BaseStore) listUserGroupIDs(ctx context.Context, tx *sql.Tx, userID uint64) ([]uint64, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`select group_id
+		from t_group_member
+		where user_id=?`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groupIDs := []uint64{}
+	for rows.Next() {
+		var groupID uint64
+		if err = rows.Scan(&groupID); err != nil {
+			return nil, err
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	return groupIDs, rows.Err()
+}
+
+// affectedUserIDs lists users who may inherit the policy
+func (st *BaseStore) affectedUserIDs(ctx context.Context, tx *sql.Tx, subjectType, subject string) ([]uint64, error) {
+	var query string
+	switch subjectType {
+	case db.QuotaPolicyRole:
+		query = `select id from t_user where role=?`
+	case db.QuotaPolicyGroup:
+		query = `select user_id from t_group_member where group_id=?`
+	case db.QuotaPolicyUser:
+		query = `select id from t_user where id=?`
+	default:
+		return nil, db.ErrInvalidQuotaPolicy
+	}
+
+	rows, err := tx.QueryContext(ctx, query, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []uint64{}
+	for rows.Next() {
+		var userID uint64
+		if err = rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+func (st *BaseStore) refreshQuotas(ctx context.Context, tx *sql.Tx, userIDs []uint64, fallback *db.Quota) (int, error) {
+	updated := 0
+	for _, userID := range userIDs {
+		if userID == db.VisitorID {
+			continue
+		}
+		user, err := st.getUser(ctx, tx, userID)
+		if err != nil {
+			if errors.Is(err, db.ErrUserNotFound) {
+				continue
+			}
+			return 0, err
+		}
+
+		quota, err := st.resolveQuota(ctx, tx, user, fallback)
+		if err != nil {
+			return 0, err
+		} else if quota == nil || db.CompareQuotas(quota, user.Quota) {
+			continue
+		}
+
+		quotaStr, err := json.Marshal(quota)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`update t_user
+			set quota=?
+			where id=?`,
+			quotaStr,
+			userID,
+		)
+		if err != nil {
+			return 0, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+func (st *BaseStore) SetQuotaPolicy(ctx context.Context, policy *db.QuotaPolicy, fallback *db.Quota) (int, error) {
+	if err := db.CheckQuotaPolicy(policy); err != nil {
+		return 0, err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	switch policy.SubjectType {
+	case db.QuotaPolicyRole:
+		err = st.checkRoleExisting(ctx, tx, policy.Subject)
+	case db.QuotaPolicyGroup:
+		groupID, _ := strconv.ParseUint(policy.Subject, 10, 64)
+		_, err = st.getGroup(ctx, tx, groupID)
+	case db.QuotaPolicyUser:
+		userID, _ := strconv.ParseUint(policy.Subject, 10, 64)
+		_, err = st.getUser(ctx, tx, userID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	quotaStr, err := json.Marshal(policy.Quota)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_quota_policy (
+			subject_type, subject, quota
+		) values (?, ?, ?)
+		on conflict(subject_type, subject) do update set quota=excluded.quota`,
+		policy.SubjectType,
+		policy.Subject,
+		quotaStr,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	userIDs, err := st.affectedUserIDs(ctx, tx, policy.SubjectType, policy.Subject)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := st.refreshQuotas(ctx, tx, userIDs, fallback)
+	if err != nil {
+		return 0, err
+	}
+	return updated, tx.Commit()
+}
+
+func (st *BaseStore) DelQuotaPolicy(ctx context.Context, subjectType, subject string, fallback *db.Quota) (int, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`delete from t_quota_policy
+		where subject_type=? and subject=?`,
+		subjectType,
+		subject,
+	)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	} else if affected == 0 {
+		return 0, db.ErrQuotaPolicyNotFound
+	}
+
+	userIDs, err := st.affectedUserIDs(ctx, tx, subjectType, subject)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := st.refreshQuotas(ctx, tx, userIDs, fallback)
+	if err != nil {
+		return 0, err
+	}
+	return updated, tx.Commit()
+}
+
+func (st *BaseStore) GetQuotaPolicy(ctx context.Context, subjectType, subject string) (*db.QuotaPolicy, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	policy, err := st.getQuotaPolicy(ctx, tx, subjectType, subject)
+	if err != nil {
+		return nil, err
+	}
+	return policy, tx.Commit()
+}
+
+func (st *BaseStore) ListQuotaPolicies(ctx context.Context) ([]*db.QuotaPolicy, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select subject_type, subject, quota
+		from t_quota_policy
+		order by subject_type, subject`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []*db.QuotaPolicy{}
+	for rows.Next() {
+		policy := &db.QuotaPolicy{}
+		var quotaStr string
+		if err = rows.Scan(&policy.SubjectType, &policy.Subject, &quotaStr); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(quotaStr), &policy.Quota); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (st *BaseStore) RefreshQuotas(ctx context.Context, userIDs []uint64, fallback *db.Quota) (int, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	updated, err := st.refreshQuotas(ctx, tx, userIDs, fallback)
+	if err != nil {
+		return 0, err
+	}
+	return updated, tx.Commit()
+}
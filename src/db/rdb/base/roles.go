@@ -0,0 +1,225 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) getRole(ctx context.Context, tx *sql.Tx, name string) (*db.Role, error) {
+	role := &db.Role{}
+	var rulesStr string
+	err := tx.QueryRowContext(
+		ctx,
+		`select name, rules
+		from t_role
+		where name=?`,
+		name,
+	).Scan(&role.Name, &rulesStr)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(rulesStr), &role.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// checkRoleExisting returns nil if the role is predefined or added by admins
+func (st *BaseStore) checkRoleExisting(ctx context.Context, tx *sql.Tx, name string) error {
+	if db.IsPredefinedRole(name) {
+		return nil
+	}
+	_, err := st.getRole(ctx, tx, name)
+	return err
+}
+
+func (st *BaseStore) AddRole(ctx context.Context, role *db.Role) error {
+	if err := db.CheckRole(role); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = st.getRole(ctx, tx, role.Name)
+	if err == nil {
+		return db.ErrKeyExisting
+	} else if !errors.Is(err, db.ErrRoleNotFound) {
+		return err
+	}
+
+	if role.Rules == nil {
+		role.Rules = []*db.APIRule{}
+	}
+	rulesStr, err := json.Marshal(role.Rules)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_role (name, rules) values (?, ?)`,
+		role.Name,
+		rulesStr,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) DelRole(ctx context.Context, name string) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getRole(ctx, tx, name); err != nil {
+		return err
+	}
+
+	var userCount int64
+	err = tx.QueryRowContext(
+		ctx,
+		`select count(*)
+		from t_user
+		where role=?`,
+		name,
+	).Scan(&userCount)
+	if err != nil {
+		return err
+	} else if userCount > 0 {
+		return db.ErrRoleInUse
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_role where name=?`,
+		name,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_quota_policy where subject_type=? and subject=?`,
+		db.QuotaPolicyRole,
+		name,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetRole(ctx context.Context, name string) (*db.Role, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	role, err := st.getRole(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (st *BaseStore) SetRoleRules(ctx context.Context, name string, rules []*db.APIRule) error {
+	if err := db.CheckAPIRules(rules); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getRole(ctx, tx, name); err != nil {
+		return err
+	}
+
+	if rules == nil {
+		rules = []*db.APIRule{}
+	}
+	rulesStr, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_role
+		set rules=?
+		where name=?`,
+		rulesStr,
+		name,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListRoles(ctx context.Context) ([]*db.Role, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select name, rules
+		from t_role
+		order by name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*db.Role{}
+	for rows.Next() {
+		role := &db.Role{}
+		var rulesStr string
+		err = rows.Scan(&role.Name, &rulesStr)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(rulesStr), &role.Rules)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
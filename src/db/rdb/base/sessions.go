@@ -0,0 +1,218 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) AddSession(ctx context.Context, session *db.Session) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getUser(ctx, tx, session.UserID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_session (
+			id, user_id, device, ip, created_at, last_seen, expire_at
+		) values (?, ?, ?, ?, ?, ?, ?)`,
+		session.ID,
+		session.UserID,
+		session.Device,
+		session.IP,
+		session.CreatedAt,
+		session.LastSeen,
+		session.ExpireAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetSession(ctx context.Context, id string) (*db.Session, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session := &db.Session{}
+	err = tx.QueryRowContext(
+		ctx,
+		`select id, user_id, device, ip, created_at, last_seen, expire_at
+		from t_session
+		where id=?`,
+		id,
+	).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeen,
+		&session.ExpireAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (st *BaseStore) SetSessionSeen(ctx context.Context, id, ip string, lastSeen int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`update t_session
+		set ip=?, last_seen=?
+		where id=?`,
+		ip,
+		lastSeen,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListSessions(ctx context.Context, userId uint64) ([]*db.Session, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select id, user_id, device, ip, created_at, last_seen, expire_at
+		from t_session
+		where user_id=?
+		order by last_seen desc`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*db.Session{}
+	for rows.Next() {
+		session := &db.Session{}
+		err = rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.Device,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeen,
+			&session.ExpireAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DelSession only removes the session owned by the user
+func (st *BaseStore) DelSession(ctx context.Context, userId uint64, id string) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`delete from t_session
+		where id=? and user_id=?`,
+		id,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return db.ErrSessionNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) DelSessions(ctx context.Context, userId uint64, exceptId string) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = st.delSessions(ctx, tx, userId, exceptId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *BaseStore) delSessions(ctx context.Context, tx *sql.Tx, userId uint64, exceptId string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`delete from t_session
+		where user_id=? and id<>?`,
+		userId,
+		exceptId,
+	)
+	return err
+}
+
+func (st *BaseStore) DelExpiredSessions(ctx context.Context, now int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_session
+		where expire_at<=?`,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
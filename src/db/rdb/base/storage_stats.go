@@ -0,0 +1,423 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *BaseStore) ListUserUsages(ctx context.Context) ([]*db.UserUsage, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select u.id, u.name, u.used_space, u.quota, count(f.id), coalesce(sum(f.size), 0)
+		from t_user u
+		left join t_file_info f on f.location=u.name and f.is_dir=false
+		where u.id!=?
+		group by u.id, u.name, u.used_space, u.quota
+		order by u.used_space desc, u.id`,
+		db.VisitorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quotaStr string
+	usages := []*db.UserUsage{}
+	for rows.Next() {
+		usage := &db.UserUsage{}
+		err = rows.Scan(
+			&usage.ID,
+			&usage.Name,
+			&usage.UsedSpace,
+			&quotaStr,
+			&usage.FileCount,
+			&usage.FileSize,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		quota := &db.Quota{}
+		if err = json.Unmarshal([]byte(quotaStr), quota); err != nil {
+			return nil, err
+		}
+		usage.SpaceLimit = quota.SpaceLimit
+		usages = append(usages, usage)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+func (st *BaseStore) ListFolderUsages(ctx context.Context, dirPath string) ([]*db.FolderUsage, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	dirPath = strings.Trim(path.Clean(dirPath), "/.")
+	query := `select location, count(*), coalesce(sum(size), 0)
+		from t_file_info
+		where is_dir=false
+		group by location`
+	args := []interface{}{}
+	if dirPath != "" {
+		// parents end with "/"
+		query = `select parent, count(*), coalesce(sum(size), 0)
+		from t_file_info
+		where is_dir=false and parent like ?
+		group by parent`
+		args = append(args, fmt.Sprintf("%s/%%", dirPath))
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parent string
+	var fileCount, size int64
+	usageMap := map[string]*db.FolderUsage{}
+	for rows.Next() {
+		err = rows.Scan(&parent, &fileCount, &size)
+		if err != nil {
+			return nil, err
+		}
+
+		// parents are rolled up to the children of the dir
+		folderPath := strings.TrimSuffix(parent, "/")
+		if dirPath != "" {
+			relPath := strings.TrimPrefix(folderPath, dirPath)
+			if relPath != "" && !strings.HasPrefix(relPath, "/") {
+				// "_" in the pattern matches any character
+				continue
+			}
+			relPath = strings.TrimPrefix(relPath, "/")
+			folderPath = dirPath
+			if relPath != "" {
+				folderPath = path.Join(dirPath, strings.Split(relPath, "/")[0])
+			}
+		}
+
+		usage, ok := usageMap[folderPath]
+		if !ok {
+			usage = &db.FolderUsage{Path: folderPath}
+			usageMap[folderPath] = usage
+		}
+		usage.FileCount += fileCount
+		usage.Size += size
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	usages := []*db.FolderUsage{}
+	for _, usage := range usageMap {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Size != usages[j].Size {
+			return usages[i].Size > usages[j].Size
+		}
+		return usages[i].Path < usages[j].Path
+	})
+	return usages, nil
+}
+
+func (st *BaseStore) ListLargestFiles(ctx context.Context, limit int) ([]*db.FileUsage, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select path, user, size, info
+		from t_file_info
+		where is_dir=false
+		order by size desc, path
+		limit ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infoStr string
+	files := []*db.FileUsage{}
+	for rows.Next() {
+		file := &db.FileUsage{}
+		err = rows.Scan(&file.Path, &file.Creator, &file.Size, &infoStr)
+		if err != nil {
+			return nil, err
+		}
+
+		info := &db.FileInfo{}
+		if err = json.Unmarshal([]byte(infoStr), info); err != nil {
+			return nil, err
+		}
+		file.Sha1 = info.Sha1
+		files = append(files, file)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (st *BaseStore) ListDuplicateFiles(ctx context.Context, limit int) ([]*db.DuplicateFiles, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// info could be stored as blob which is not accepted by json functions
+	rows, err := tx.QueryContext(
+		ctx,
+		`select json_extract(cast(info as text), '$.sha1') as sha1, size, count(*)
+		from t_file_info
+		where is_dir=false and json_extract(cast(info as text), '$.sha1')!=''
+		group by sha1, size
+		having count(*)>1
+		order by size*(count(*)-1) desc, sha1
+		limit ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var count int64
+	dups := []*db.DuplicateFiles{}
+	for rows.Next() {
+		dup := &db.DuplicateFiles{}
+		err = rows.Scan(&dup.Sha1, &dup.Size, &count)
+		if err != nil {
+			return nil, err
+		}
+		dup.Wasted = dup.Size * (count - 1)
+		dups = append(dups, dup)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	rows.Close()
+
+	for _, dup := range dups {
+		dup.Paths, err = st.listPathsBySha1(ctx, tx, dup.Sha1, dup.Size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return dups, nil
+}
+
+func (st *BaseStore) listPathsBySha1(ctx context.Context, tx *sql.Tx, sha1 string, size int64) ([]string, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`select path
+		from t_file_info
+		where is_dir=false and size=? and json_extract(cast(info as text), '$.sha1')=?
+		order by path`,
+		size,
+		sha1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var itemPath string
+	paths := []string{}
+	for rows.Next() {
+		if err = rows.Scan(&itemPath); err != nil {
+			return nil, err
+		}
+		paths = append(paths, itemPath)
+	}
+	return paths, rows.Err()
+}
+
+func (st *BaseStore) ListAllUploadInfos(ctx context.Context) ([]*db.UploadingInfo, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select user, real_path, tmp_path, size, uploaded
+		from t_file_uploading
+		order by user, real_path`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := []*db.UploadingInfo{}
+	for rows.Next() {
+		info := &db.UploadingInfo{}
+		err = rows.Scan(
+			&info.UserID,
+			&info.RealFilePath,
+			&info.TmpFilePath,
+			&info.Size,
+			&info.Uploaded,
+		)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+func (st *BaseStore) AddStorageSnapshots(ctx context.Context, createdAt int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// snapshots could be taken twice in the same second
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_storage_snapshot where created_at=?`,
+		createdAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_storage_snapshot (
+			user, used_space, file_count, created_at
+		)
+		select u.id, u.used_space, count(f.id), ?
+		from t_user u
+		left join t_file_info f on f.location=u.name and f.is_dir=false
+		where u.id!=?
+		group by u.id, u.used_space`,
+		createdAt,
+		db.VisitorID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) ListStorageSnapshots(ctx context.Context, since int64) ([]*db.StorageSnapshot, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`select user, used_space, file_count, created_at
+		from t_storage_snapshot
+		where created_at>=?
+		order by created_at, user`,
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []*db.StorageSnapshot{}
+	for rows.Next() {
+		snapshot := &db.StorageSnapshot{}
+		err = rows.Scan(
+			&snapshot.UserID,
+			&snapshot.UsedSpace,
+			&snapshot.FileCount,
+			&snapshot.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (st *BaseStore) DelStorageSnapshots(ctx context.Context, before int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_storage_snapshot where created_at<?`,
+		before,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -106,6 +106,9 @@ func (st *BaseStore) AddUser(ctx context.Context, user *db.User) error {
 	}
 	defer tx.Rollback()
 
+	if err = st.checkRoleExisting(ctx, tx, user.Role); err != nil {
+		return err
+	}
 	err = st.addUser(ctx, tx, user)
 	if err != nil {
 		return err
@@ -121,6 +124,21 @@ func (st *BaseStore) DelUser(ctx context.Context, id uint64) error {
 	}
 	defer tx.Rollback()
 
+	user, err := st.getUser(ctx, tx, id)
+	if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+		return err
+	} else if err == nil {
+		// acls granted on the user's home and texts of the user's files
+		err = st.delACLsUnder(ctx, tx, user.Name)
+		if err != nil {
+			return err
+		}
+		err = st.delFileContentsUnder(ctx, tx, user.Name)
+		if err != nil {
+			return err
+		}
+	}
+
 	_, err = tx.ExecContext(
 		ctx,
 		`delete from t_user where id=?`,
@@ -129,6 +147,79 @@ func (st *BaseStore) DelUser(ctx context.Context, id uint64) error {
 	if err != nil {
 		return err
 	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_group_member where user_id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_acl where subject_type=? and subject_id=?`,
+		db.ACLSubjectUser,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_api_token where user_id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_user_identity where user_id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = st.delUserWebhooks(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if err = st.delSessions(ctx, tx, id, ""); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_user_mfa where user_id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_pwd_reset where user_id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_quota_policy where subject_type=? and subject=?`,
+		db.QuotaPolicyUser,
+		fmt.Sprint(id),
+	)
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -216,6 +307,11 @@ func (st *BaseStore) SetPwd(ctx context.Context, id uint64, pwd string) error {
 		return err
 	}
 
+	// tokens issued with the old password are revoked
+	if err = st.delSessions(ctx, tx, id, ""); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
@@ -227,6 +323,13 @@ func (st *BaseStore) SetInfo(ctx context.Context, id uint64, user *db.User) erro
 	}
 	defer tx.Rollback()
 
+	if err = st.checkRoleExisting(ctx, tx, user.Role); err != nil {
+		return err
+	}
+	oldUser, err := st.getUser(ctx, tx, id)
+	if err != nil {
+		return err
+	}
 	quotaStr, err := json.Marshal(user.Quota)
 	if err != nil {
 		return err
@@ -244,6 +347,13 @@ func (st *BaseStore) SetInfo(ctx context.Context, id uint64, user *db.User) erro
 		return err
 	}
 
+	// roles are kept in tokens, so they are revoked once the role is changed
+	if oldUser.Role != user.Role {
+		if err = st.delSessions(ctx, tx, id, ""); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -407,18 +517,3 @@ func (st *BaseStore) ListUserIDs(ctx context.Context) (map[string]string, error)
 	}
 	return nameToId, nil
 }
-
-func (st *BaseStore) AddRole(role string) error {
-	// TODO: implement this after adding grant/revoke
-	panic("not implemented")
-}
-
-func (st *BaseStore) DelRole(role string) error {
-	// TODO: implement this after adding grant/revoke
-	panic("not implemented")
-}
-
-func (st *BaseStore) ListRoles() (map[string]bool, error) {
-	// TODO: implement this after adding grant/revoke
-	panic("not implemented")
-}
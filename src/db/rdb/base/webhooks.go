@@ -0,0 +1,421 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func scanWebhook(scan func(dest ...any) error) (*db.Webhook, error) {
+	hook := &db.Webhook{}
+	var eventsStr string
+	err := scan(
+		&hook.ID,
+		&hook.UserID,
+		&hook.URL,
+		&hook.Secret,
+		&eventsStr,
+		&hook.Global,
+		&hook.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(eventsStr), &hook.Events)
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func scanWebhookDelivery(scan func(dest ...any) error) (*db.WebhookDelivery, error) {
+	delivery := &db.WebhookDelivery{}
+	err := scan(
+		&delivery.ID,
+		&delivery.HookID,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.ResponseCode,
+		&delivery.Error,
+		&delivery.NextRetryAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (st *BaseStore) AddWebhook(ctx context.Context, hook *db.Webhook) error {
+	if err := db.CheckWebhook(hook); err != nil {
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = st.getUser(ctx, tx, hook.UserID); err != nil {
+		return err
+	}
+
+	eventsStr, err := json.Marshal(hook.Events)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_webhook (
+			id, user_id, url, secret, events, global, created_at
+		) values (?, ?, ?, ?, ?, ?, ?)`,
+		hook.ID,
+		hook.UserID,
+		hook.URL,
+		hook.Secret,
+		eventsStr,
+		hook.Global,
+		hook.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) DelWebhook(ctx context.Context, userId, id uint64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`delete from t_webhook
+		where id=? and user_id=?`,
+		id,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return db.ErrWebhookNotFound
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_webhook_delivery
+		where hook_id=?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) delUserWebhooks(ctx context.Context, tx *sql.Tx, userId uint64) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`delete from t_webhook_delivery
+		where hook_id in (select id from t_webhook where user_id=?)`,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_webhook
+		where user_id=?`,
+		userId,
+	)
+	return err
+}
+
+func (st *BaseStore) GetWebhook(ctx context.Context, id uint64) (*db.Webhook, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hook, err := scanWebhook(
+		tx.QueryRowContext(
+			ctx,
+			`select id, user_id, url, secret, events, global, created_at
+			from t_webhook
+			where id=?`,
+			id,
+		).Scan,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (st *BaseStore) listWebhooks(ctx context.Context, query string, args ...any) ([]*db.Webhook, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []*db.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (st *BaseStore) ListWebhooks(ctx context.Context, userId uint64) ([]*db.Webhook, error) {
+	return st.listWebhooks(
+		ctx,
+		`select id, user_id, url, secret, events, global, created_at
+		from t_webhook
+		where user_id=?
+		order by created_at, id`,
+		userId,
+	)
+}
+
+// ListEventWebhooks filters webhooks by events after listing, there should not be many webhooks
+func (st *BaseStore) ListEventWebhooks(ctx context.Context, event string) ([]*db.Webhook, error) {
+	hooks, err := st.listWebhooks(
+		ctx,
+		`select id, user_id, url, secret, events, global, created_at
+		from t_webhook
+		order by created_at, id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []*db.Webhook{}
+	for _, hook := range hooks {
+		if hook.Subscribes(event) {
+			matched = append(matched, hook)
+		}
+	}
+	return matched, nil
+}
+
+func (st *BaseStore) AddWebhookDelivery(ctx context.Context, delivery *db.WebhookDelivery) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into t_webhook_delivery (
+			id, hook_id, event, payload, status, attempts, response_code,
+			error, next_retry_at, created_at, updated_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.ID,
+		delivery.HookID,
+		delivery.Event,
+		delivery.Payload,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseCode,
+		delivery.Error,
+		delivery.NextRetryAt,
+		delivery.CreatedAt,
+		delivery.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) GetWebhookDelivery(ctx context.Context, id uint64) (*db.WebhookDelivery, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	delivery, err := scanWebhookDelivery(
+		tx.QueryRowContext(
+			ctx,
+			`select id, hook_id, event, payload, status, attempts, response_code,
+				error, next_retry_at, created_at, updated_at
+			from t_webhook_delivery
+			where id=?`,
+			id,
+		).Scan,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (st *BaseStore) SetWebhookDeliveryResult(ctx context.Context, delivery *db.WebhookDelivery) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`update t_webhook_delivery
+		set status=?, attempts=?, response_code=?, error=?, next_retry_at=?, updated_at=?
+		where id=?`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseCode,
+		delivery.Error,
+		delivery.NextRetryAt,
+		delivery.UpdatedAt,
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return db.ErrWebhookDeliveryNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (st *BaseStore) listWebhookDeliveries(ctx context.Context, query string, args ...any) ([]*db.WebhookDelivery, error) {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*db.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (st *BaseStore) ListWebhookDeliveries(ctx context.Context, hookId uint64, limit int) ([]*db.WebhookDelivery, error) {
+	return st.listWebhookDeliveries(
+		ctx,
+		`select id, hook_id, event, payload, status, attempts, response_code,
+			error, next_retry_at, created_at, updated_at
+		from t_webhook_delivery
+		where hook_id=?
+		order by created_at desc, id desc
+		limit ?`,
+		hookId,
+		limit,
+	)
+}
+
+func (st *BaseStore) ListDueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]*db.WebhookDelivery, error) {
+	return st.listWebhookDeliveries(
+		ctx,
+		`select id, hook_id, event, payload, status, attempts, response_code,
+			error, next_retry_at, created_at, updated_at
+		from t_webhook_delivery
+		where status=? and next_retry_at<=?
+		order by next_retry_at, id
+		limit ?`,
+		db.WebhookDeliveryPending,
+		now,
+		limit,
+	)
+}
+
+func (st *BaseStore) DelWebhookDeliveries(ctx context.Context, before int64) error {
+	tx, err := st.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`delete from t_webhook_delivery
+		where status<>? and created_at<?`,
+		db.WebhookDeliveryPending,
+		before,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) SetACL(ctx context.Context, acl *db.ACL) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetACL(ctx, acl)
+}
+
+func (st *SQLiteStore) DelACL(ctx context.Context, itemPath, subjectType string, subjectId uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelACL(ctx, itemPath, subjectType, subjectId)
+}
+
+func (st *SQLiteStore) ListACLs(ctx context.Context, itemPath string) ([]*db.ACL, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListACLs(ctx, itemPath)
+}
+
+func (st *SQLiteStore) GetUserPerm(ctx context.Context, userId uint64, itemPath string) (string, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetUserPerm(ctx, userId, itemPath)
+}
+
+func (st *SQLiteStore) ListUserACLs(ctx context.Context, userId uint64) ([]*db.ACL, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListUserACLs(ctx, userId)
+}
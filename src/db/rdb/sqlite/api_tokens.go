@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddAPIToken(ctx context.Context, token *db.APIToken) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddAPIToken(ctx, token)
+}
+
+func (st *SQLiteStore) DelAPIToken(ctx context.Context, userId, id uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelAPIToken(ctx, userId, id)
+}
+
+func (st *SQLiteStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*db.APIToken, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetAPITokenByHash(ctx, tokenHash)
+}
+
+func (st *SQLiteStore) SetAPITokenUsed(ctx context.Context, id uint64, usedAt int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetAPITokenUsed(ctx, id, usedAt)
+}
+
+func (st *SQLiteStore) ListAPITokens(ctx context.Context, userId uint64) ([]*db.APIToken, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListAPITokens(ctx, userId)
+}
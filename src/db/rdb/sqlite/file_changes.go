@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddFileChange(ctx context.Context, change *db.FileChange) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddFileChange(ctx, change)
+}
+
+func (st *SQLiteStore) ListFileChanges(ctx context.Context, afterSeq uint64, dirPaths []string, limit int) ([]*db.FileChange, uint64, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListFileChanges(ctx, afterSeq, dirPaths, limit)
+}
+
+func (st *SQLiteStore) GetFileChangeSeqs(ctx context.Context) (uint64, uint64, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetFileChangeSeqs(ctx)
+}
+
+func (st *SQLiteStore) DelFileChanges(ctx context.Context, before int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelFileChanges(ctx, before)
+}
@@ -0,0 +1,21 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) SetFileContent(ctx context.Context, itemPath, content string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetFileContent(ctx, itemPath, content)
+}
+
+func (st *SQLiteStore) SearchFileContents(ctx context.Context, query string, dirPaths []string, limit int) ([]*db.ContentMatch, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.SearchFileContents(ctx, query, dirPaths, limit)
+}
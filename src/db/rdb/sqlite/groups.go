@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddGroup(ctx context.Context, group *db.Group) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddGroup(ctx, group)
+}
+
+func (st *SQLiteStore) DelGroup(ctx context.Context, id uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelGroup(ctx, id)
+}
+
+func (st *SQLiteStore) GetGroup(ctx context.Context, id uint64) (*db.Group, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetGroup(ctx, id)
+}
+
+func (st *SQLiteStore) GetGroupByName(ctx context.Context, name string) (*db.Group, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetGroupByName(ctx, name)
+}
+
+func (st *SQLiteStore) SetGroupQuota(ctx context.Context, id uint64, quota *db.GroupQuota) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetGroupQuota(ctx, id, quota)
+}
+
+func (st *SQLiteStore) ListGroups(ctx context.Context) ([]*db.Group, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListGroups(ctx)
+}
+
+func (st *SQLiteStore) SetGroupMember(ctx context.Context, groupId, userId uint64, perm string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetGroupMember(ctx, groupId, userId, perm)
+}
+
+func (st *SQLiteStore) DelGroupMember(ctx context.Context, groupId, userId uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelGroupMember(ctx, groupId, userId)
+}
+
+func (st *SQLiteStore) GetGroupMember(ctx context.Context, groupId, userId uint64) (*db.GroupMember, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetGroupMember(ctx, groupId, userId)
+}
+
+func (st *SQLiteStore) ListGroupMembers(ctx context.Context, groupId uint64) ([]*db.GroupMember, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListGroupMembers(ctx, groupId)
+}
+
+func (st *SQLiteStore) ListUserGroups(ctx context.Context, userId uint64) ([]*db.UserGroup, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListUserGroups(ctx, userId)
+}
@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddIdentity(ctx context.Context, identity *db.Identity) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddIdentity(ctx, identity)
+}
+
+func (st *SQLiteStore) GetIdentity(ctx context.Context, issuer, subject string) (*db.Identity, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetIdentity(ctx, issuer, subject)
+}
+
+func (st *SQLiteStore) ListIdentities(ctx context.Context, userId uint64) ([]*db.Identity, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListIdentities(ctx, userId)
+}
@@ -10,6 +10,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// DriverName is the name of the registered sqlite driver
+const DriverName = "sqlite"
+
 type SQLite struct {
 	db.IDB
 	dbPath string
@@ -17,15 +20,20 @@ type SQLite struct {
 
 func NewSQLite(dbPath string) (*SQLite, error) {
 	println("SQLite path", dbPath)
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open(DriverName, dbPath)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewSQLiteFromDB(db, dbPath), nil
+}
+
+// NewSQLiteFromDB wraps an opened DB, e.g. the one opened by a wrapped driver
+func NewSQLiteFromDB(db db.IDB, dbPath string) *SQLite {
 	return &SQLite{
 		IDB:    db,
 		dbPath: dbPath,
-	}, nil
+	}
 }
 
 type SQLiteStore struct {
@@ -83,3 +91,78 @@ func (st *SQLiteStore) InitFileTables(ctx context.Context, tx *sql.Tx) error {
 func (st *SQLiteStore) InitConfigTable(ctx context.Context, tx *sql.Tx, cfg *db.SiteConfig) error {
 	return st.store.InitConfigTable(ctx, tx, cfg)
 }
+
+func (st *SQLiteStore) InitGroupTables(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitGroupTables(ctx, tx)
+}
+
+func (st *SQLiteStore) Upgrade(ctx context.Context) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.Upgrade(ctx)
+}
+
+func (st *SQLiteStore) InitRoleTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitRoleTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitACLTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitACLTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitAPITokenTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitAPITokenTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitIdentityTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitIdentityTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitSessionTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitSessionTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitMFATable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitMFATable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitLoginAttemptTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitLoginAttemptTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitInviteTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitInviteTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitPwdResetTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitPwdResetTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitQuotaPolicyTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitQuotaPolicyTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitStorageSnapshotTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitStorageSnapshotTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitFileContentTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitFileContentTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitDirStatTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitDirStatTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitFileChangeTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitFileChangeTable(ctx, tx)
+}
+
+func (st *SQLiteStore) InitWebhookTables(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitWebhookTables(ctx, tx)
+}
+
+func (st *SQLiteStore) InitAuditLogTable(ctx context.Context, tx *sql.Tx) error {
+	return st.store.InitAuditLogTable(ctx, tx)
+}
@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddLoginAttempt(ctx context.Context, attempt *db.LoginAttempt) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddLoginAttempt(ctx, attempt)
+}
+
+func (st *SQLiteStore) ListLoginAttempts(ctx context.Context, userName string, limit int) ([]*db.LoginAttempt, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListLoginAttempts(ctx, userName, limit)
+}
+
+func (st *SQLiteStore) DelLoginAttempts(ctx context.Context, before int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelLoginAttempts(ctx, before)
+}
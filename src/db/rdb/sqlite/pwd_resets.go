@@ -0,0 +1,19 @@
+package sqlite
+
+import (
+	"context"
+)
+
+func (st *SQLiteStore) AddPwdReset(ctx context.Context, tokenHash string, userID uint64, expireAt, now int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddPwdReset(ctx, tokenHash, userID, expireAt, now)
+}
+
+func (st *SQLiteStore) UsePwdReset(ctx context.Context, tokenHash string, now int64) (uint64, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.UsePwdReset(ctx, tokenHash, now)
+}
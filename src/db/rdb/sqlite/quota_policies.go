@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) SetQuotaPolicy(ctx context.Context, policy *db.QuotaPolicy, fallback *db.Quota) (int, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetQuotaPolicy(ctx, policy, fallback)
+}
+
+func (st *SQLiteStore) DelQuotaPolicy(ctx context.Context, subjectType, subject string, fallback *db.Quota) (int, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelQuotaPolicy(ctx, subjectType, subject, fallback)
+}
+
+func (st *SQLiteStore) GetQuotaPolicy(ctx context.Context, subjectType, subject string) (*db.QuotaPolicy, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetQuotaPolicy(ctx, subjectType, subject)
+}
+
+func (st *SQLiteStore) ListQuotaPolicies(ctx context.Context) ([]*db.QuotaPolicy, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListQuotaPolicies(ctx)
+}
+
+func (st *SQLiteStore) RefreshQuotas(ctx context.Context, userIDs []uint64, fallback *db.Quota) (int, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.RefreshQuotas(ctx, userIDs, fallback)
+}
@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddSession(ctx context.Context, session *db.Session) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddSession(ctx, session)
+}
+
+func (st *SQLiteStore) GetSession(ctx context.Context, id string) (*db.Session, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetSession(ctx, id)
+}
+
+func (st *SQLiteStore) SetSessionSeen(ctx context.Context, id, ip string, lastSeen int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetSessionSeen(ctx, id, ip, lastSeen)
+}
+
+func (st *SQLiteStore) ListSessions(ctx context.Context, userId uint64) ([]*db.Session, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListSessions(ctx, userId)
+}
+
+func (st *SQLiteStore) DelSession(ctx context.Context, userId uint64, id string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelSession(ctx, userId, id)
+}
+
+func (st *SQLiteStore) DelSessions(ctx context.Context, userId uint64, exceptId string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelSessions(ctx, userId, exceptId)
+}
+
+func (st *SQLiteStore) DelExpiredSessions(ctx context.Context, now int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelExpiredSessions(ctx, now)
+}
@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) ListUserUsages(ctx context.Context) ([]*db.UserUsage, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListUserUsages(ctx)
+}
+
+func (st *SQLiteStore) ListFolderUsages(ctx context.Context, dirPath string) ([]*db.FolderUsage, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListFolderUsages(ctx, dirPath)
+}
+
+func (st *SQLiteStore) ListLargestFiles(ctx context.Context, limit int) ([]*db.FileUsage, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListLargestFiles(ctx, limit)
+}
+
+func (st *SQLiteStore) ListDuplicateFiles(ctx context.Context, limit int) ([]*db.DuplicateFiles, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListDuplicateFiles(ctx, limit)
+}
+
+func (st *SQLiteStore) ListAllUploadInfos(ctx context.Context) ([]*db.UploadingInfo, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListAllUploadInfos(ctx)
+}
+
+func (st *SQLiteStore) AddStorageSnapshots(ctx context.Context, createdAt int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddStorageSnapshots(ctx, createdAt)
+}
+
+func (st *SQLiteStore) ListStorageSnapshots(ctx context.Context, since int64) ([]*db.StorageSnapshot, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListStorageSnapshots(ctx, since)
+}
+
+func (st *SQLiteStore) DelStorageSnapshots(ctx context.Context, before int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelStorageSnapshots(ctx, before)
+}
@@ -0,0 +1,28 @@
+package sqlitecgo
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddAuditLog(ctx context.Context, log *db.AuditLog) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddAuditLog(ctx, log)
+}
+
+func (st *SQLiteStore) ListAuditLogs(ctx context.Context, filter *db.AuditLogFilter, limit int) ([]*db.AuditLog, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListAuditLogs(ctx, filter, limit)
+}
+
+func (st *SQLiteStore) DelAuditLogs(ctx context.Context, before int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelAuditLogs(ctx, before)
+}
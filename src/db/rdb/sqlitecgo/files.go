@@ -20,6 +20,27 @@ func (st *SQLiteStore) ListFileInfos(ctx context.Context, itemPaths []string) (m
 	return st.store.ListFileInfos(ctx, itemPaths)
 }
 
+func (st *SQLiteStore) ListDirStats(ctx context.Context, dirPath string) (map[string]*db.DirStat, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListDirStats(ctx, dirPath)
+}
+
+func (st *SQLiteStore) QueryFiles(ctx context.Context, query *db.FileQuery) ([]*db.FileItem, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.QueryFiles(ctx, query)
+}
+
+func (st *SQLiteStore) SetModTimes(ctx context.Context, modTimes map[string]int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetModTimes(ctx, modTimes)
+}
+
 func (st *SQLiteStore) AddFileInfo(ctx context.Context, infoId, userId uint64, itemPath string, info *db.FileInfo) error {
 	st.Lock()
 	defer st.Unlock()
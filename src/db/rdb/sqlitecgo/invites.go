@@ -0,0 +1,42 @@
+package sqlitecgo
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddInvite(ctx context.Context, invite *db.Invite) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddInvite(ctx, invite)
+}
+
+func (st *SQLiteStore) DelInvite(ctx context.Context, id uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelInvite(ctx, id)
+}
+
+func (st *SQLiteStore) ListInvites(ctx context.Context) ([]*db.Invite, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListInvites(ctx)
+}
+
+func (st *SQLiteStore) UseInvite(ctx context.Context, codeHash string, now int64) (*db.Invite, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.UseInvite(ctx, codeHash, now)
+}
+
+func (st *SQLiteStore) ReleaseInvite(ctx context.Context, id uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.ReleaseInvite(ctx, id)
+}
@@ -0,0 +1,49 @@
+package sqlitecgo
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) SetMFASecret(ctx context.Context, userId uint64, secret string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetMFASecret(ctx, userId, secret)
+}
+
+func (st *SQLiteStore) EnableMFA(ctx context.Context, userId uint64, recoveryCodes []string, step int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.EnableMFA(ctx, userId, recoveryCodes, step)
+}
+
+func (st *SQLiteStore) GetMFA(ctx context.Context, userId uint64) (*db.MFA, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetMFA(ctx, userId)
+}
+
+func (st *SQLiteStore) DelMFA(ctx context.Context, userId uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelMFA(ctx, userId)
+}
+
+func (st *SQLiteStore) UseMFAStep(ctx context.Context, userId uint64, step int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.UseMFAStep(ctx, userId, step)
+}
+
+func (st *SQLiteStore) UseRecoveryCode(ctx context.Context, userId uint64, recoveryCode string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.UseRecoveryCode(ctx, userId, recoveryCode)
+}
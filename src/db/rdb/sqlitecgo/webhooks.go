@@ -0,0 +1,84 @@
+package sqlitecgo
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func (st *SQLiteStore) AddWebhook(ctx context.Context, hook *db.Webhook) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddWebhook(ctx, hook)
+}
+
+func (st *SQLiteStore) DelWebhook(ctx context.Context, userId, id uint64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelWebhook(ctx, userId, id)
+}
+
+func (st *SQLiteStore) GetWebhook(ctx context.Context, id uint64) (*db.Webhook, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetWebhook(ctx, id)
+}
+
+func (st *SQLiteStore) ListWebhooks(ctx context.Context, userId uint64) ([]*db.Webhook, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListWebhooks(ctx, userId)
+}
+
+func (st *SQLiteStore) ListEventWebhooks(ctx context.Context, event string) ([]*db.Webhook, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListEventWebhooks(ctx, event)
+}
+
+func (st *SQLiteStore) AddWebhookDelivery(ctx context.Context, delivery *db.WebhookDelivery) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.AddWebhookDelivery(ctx, delivery)
+}
+
+func (st *SQLiteStore) GetWebhookDelivery(ctx context.Context, id uint64) (*db.WebhookDelivery, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.GetWebhookDelivery(ctx, id)
+}
+
+func (st *SQLiteStore) SetWebhookDeliveryResult(ctx context.Context, delivery *db.WebhookDelivery) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.SetWebhookDeliveryResult(ctx, delivery)
+}
+
+func (st *SQLiteStore) ListWebhookDeliveries(ctx context.Context, hookId uint64, limit int) ([]*db.WebhookDelivery, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListWebhookDeliveries(ctx, hookId, limit)
+}
+
+func (st *SQLiteStore) ListDueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]*db.WebhookDelivery, error) {
+	st.RLock()
+	defer st.RUnlock()
+
+	return st.store.ListDueWebhookDeliveries(ctx, now, limit)
+}
+
+func (st *SQLiteStore) DelWebhookDeliveries(ctx context.Context, before int64) error {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.store.DelWebhookDeliveries(ctx, before)
+}
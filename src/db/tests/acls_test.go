@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestACLStore(t *testing.T) {
+	testACLMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		newUser := func(id uint64, name string) *db.User {
+			return &db.User{
+				ID:   id,
+				Name: name,
+				Pwd:  "666",
+				Role: db.UserRole,
+				Quota: &db.Quota{
+					SpaceLimit:         1024,
+					UploadSpeedLimit:   1024,
+					DownloadSpeedLimit: 1024,
+				},
+				Preferences: &db.DefaultPreferences,
+			}
+		}
+		ownerId, granteeId, memberId := uint64(2), uint64(3), uint64(4)
+		for id, name := range map[uint64]string{ownerId: "owner", granteeId: "grantee", memberId: "member"} {
+			if err := store.AddUser(ctx, newUser(id, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		groupId := uint64(10)
+		err := store.AddGroup(ctx, &db.Group{ID: groupId, Name: "team", Quota: &db.GroupQuota{SpaceLimit: 10}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.SetGroupMember(ctx, groupId, memberId, db.GroupPermRead)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.SetACL(ctx, &db.ACL{
+			Path:        "owner/files/docs",
+			SubjectType: db.ACLSubjectUser,
+			SubjectID:   granteeId,
+			Perm:        "owner",
+		})
+		if !errors.Is(err, db.ErrInvalidACL) {
+			t.Fatalf("invalid perm should be rejected: %v", err)
+		}
+		err = store.SetACL(ctx, &db.ACL{
+			Path:        "owner/files/docs",
+			SubjectType: db.ACLSubjectUser,
+			SubjectID:   100,
+			Perm:        db.ACLPermRead,
+		})
+		if !errors.Is(err, db.ErrUserNotFound) {
+			t.Fatalf("unknown subject should be rejected: %v", err)
+		}
+
+		acls := []*db.ACL{
+			{Path: "owner/files/docs", SubjectType: db.ACLSubjectUser, SubjectID: granteeId, Perm: db.ACLPermRead},
+			{Path: "owner/files/docs/drafts", SubjectType: db.ACLSubjectUser, SubjectID: granteeId, Perm: db.ACLPermWrite},
+			{Path: "owner/files/docs", SubjectType: db.ACLSubjectGroup, SubjectID: groupId, Perm: db.ACLPermManage},
+		}
+		for _, acl := range acls {
+			if err = store.SetACL(ctx, acl); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// perms are inherited and the strongest one wins
+		for _, tc := range []struct {
+			userId   uint64
+			itemPath string
+			perm     string
+		}{
+			{granteeId, "owner/files/docs", db.ACLPermRead},
+			{granteeId, "owner/files/docs/a/b", db.ACLPermRead},
+			{granteeId, "owner/files/docs/drafts/c", db.ACLPermWrite},
+			{granteeId, "owner/files/docs2", ""},
+			{granteeId, "owner/files", ""},
+			{memberId, "owner/files/docs/drafts", db.ACLPermManage},
+			{ownerId, "owner/files/docs", ""},
+		} {
+			perm, err := store.GetUserPerm(ctx, tc.userId, tc.itemPath)
+			if err != nil {
+				t.Fatal(err)
+			} else if perm != tc.perm {
+				t.Fatalf("perm of user(%d) on (%s) not matched: got(%s) expected(%s)", tc.userId, tc.itemPath, perm, tc.perm)
+			}
+		}
+
+		docsACLs, err := store.ListACLs(ctx, "owner/files/docs")
+		if err != nil {
+			t.Fatal(err)
+		} else if len(docsACLs) != 2 {
+			t.Fatalf("incorrect acls size (%d)", len(docsACLs))
+		}
+		for _, acl := range docsACLs {
+			if acl.SubjectType == db.ACLSubjectGroup && acl.SubjectName != "team" ||
+				acl.SubjectType == db.ACLSubjectUser && acl.SubjectName != "grantee" {
+				t.Fatalf("incorrect subject name %+v", acl)
+			}
+		}
+		sharedACLs, err := store.ListUserACLs(ctx, granteeId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(sharedACLs) != 2 {
+			t.Fatalf("incorrect shared acls size (%d)", len(sharedACLs))
+		}
+
+		// acls follow moved items
+		err = store.MoveFileInfo(ctx, ownerId, "owner/files/docs", "owner/files/moved", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		perm, err := store.GetUserPerm(ctx, granteeId, "owner/files/moved/drafts")
+		if err != nil {
+			t.Fatal(err)
+		} else if perm != db.ACLPermWrite {
+			t.Fatalf("acls are not moved (%s)", perm)
+		}
+
+		err = store.DelACL(ctx, "owner/files/moved/drafts", db.ACLSubjectUser, granteeId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		perm, err = store.GetUserPerm(ctx, granteeId, "owner/files/moved/drafts")
+		if err != nil {
+			t.Fatal(err)
+		} else if perm != db.ACLPermRead {
+			t.Fatalf("acl is not deleted (%s)", perm)
+		}
+
+		// acls are removed with items
+		err = store.DelFileInfo(ctx, ownerId, "owner/files/moved")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sharedACLs, err = store.ListUserACLs(ctx, memberId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(sharedACLs) != 0 {
+			t.Fatalf("acls are not deleted %+v", sharedACLs)
+		}
+	}
+
+	t.Run("acl store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_aclstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testACLMethods(t, store)
+	})
+}
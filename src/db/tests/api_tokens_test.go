@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestAPITokenStore(t *testing.T) {
+	testAPITokenMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		userId, otherId := uint64(2), uint64(3)
+		for id, name := range map[uint64]string{userId: "tokenuser", otherId: "otheruser"} {
+			err := store.AddUser(ctx, &db.User{
+				ID:   id,
+				Name: name,
+				Pwd:  "666",
+				Role: db.UserRole,
+				Quota: &db.Quota{
+					SpaceLimit:         1024,
+					UploadSpeedLimit:   1024,
+					DownloadSpeedLimit: 1024,
+				},
+				Preferences: &db.DefaultPreferences,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := store.AddAPIToken(ctx, &db.APIToken{
+			ID:        1,
+			UserID:    userId,
+			Name:      "bad",
+			TokenHash: "hash0",
+			Scopes:    []string{"delete"},
+		})
+		if !errors.Is(err, db.ErrInvalidAPIToken) {
+			t.Fatalf("invalid scope should be rejected: %v", err)
+		}
+		err = store.AddAPIToken(ctx, &db.APIToken{
+			ID:        1,
+			UserID:    404,
+			Name:      "nouser",
+			TokenHash: "hash0",
+		})
+		if !errors.Is(err, db.ErrUserNotFound) {
+			t.Fatalf("token of missing user should be rejected: %v", err)
+		}
+
+		tokens := []*db.APIToken{
+			{
+				ID:         1,
+				UserID:     userId,
+				Name:       "ci",
+				TokenHash:  "hash1",
+				Scopes:     []string{db.APITokenScopeUpload},
+				PathPrefix: "tokenuser/files/ci",
+				ExpireAt:   1000,
+				CreatedAt:  1,
+			},
+			{
+				ID:        2,
+				UserID:    userId,
+				Name:      "full",
+				TokenHash: "hash2",
+				CreatedAt: 2,
+			},
+			{
+				ID:        3,
+				UserID:    otherId,
+				Name:      "other",
+				TokenHash: "hash3",
+				CreatedAt: 3,
+			},
+		}
+		for _, token := range tokens {
+			if err = store.AddAPIToken(ctx, token); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := store.GetAPITokenByHash(ctx, "hash1")
+		if err != nil {
+			t.Fatal(err)
+		} else if got.Name != "ci" ||
+			got.UserID != userId ||
+			len(got.Scopes) != 1 || got.Scopes[0] != db.APITokenScopeUpload ||
+			got.PathPrefix != "tokenuser/files/ci" ||
+			got.ExpireAt != 1000 {
+			t.Fatalf("token not matched %+v", got)
+		}
+		if _, err = store.GetAPITokenByHash(ctx, "hash404"); !errors.Is(err, db.ErrAPITokenNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if err = store.SetAPITokenUsed(ctx, 2, 100); err != nil {
+			t.Fatal(err)
+		}
+		listed, err := store.ListAPITokens(ctx, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(listed) != 2 || listed[0].ID != 1 || listed[1].ID != 2 {
+			t.Fatalf("tokens not matched %+v", listed)
+		} else if listed[1].LastUsedAt != 100 || len(listed[1].Scopes) != 0 {
+			t.Fatalf("token not matched %+v", listed[1])
+		}
+
+		// tokens can only be revoked by their owners
+		if err = store.DelAPIToken(ctx, otherId, 1); !errors.Is(err, db.ErrAPITokenNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err = store.DelAPIToken(ctx, userId, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetAPITokenByHash(ctx, "hash1"); !errors.Is(err, db.ErrAPITokenNotFound) {
+			t.Fatalf("token is not deleted: %v", err)
+		}
+
+		// tokens are removed with users
+		if err = store.DelUser(ctx, otherId); err != nil {
+			t.Fatal(err)
+		}
+		listed, err = store.ListAPITokens(ctx, otherId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(listed) != 0 {
+			t.Fatalf("tokens are not deleted %+v", listed)
+		}
+	}
+
+	t.Run("api token store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_apitokenstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testAPITokenMethods(t, store)
+	})
+}
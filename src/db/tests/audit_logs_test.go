@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestAuditLogStore(t *testing.T) {
+	testAuditLogMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		targets := []string{"user0/files/a.txt", "user0/files/dir/b.txt", "user0/files/dir2", "user1/files/c.txt"}
+		for i := 0; i < 8; i++ {
+			result := db.AuditResultSucceeded
+			if i%4 == 3 {
+				result = db.AuditResultFailed
+			}
+			err := store.AddAuditLog(ctx, &db.AuditLog{
+				ID:        uint64(i + 1),
+				Actor:     fmt.Sprintf("user%d", i%2),
+				IP:        "1.1.1.1",
+				Action:    db.AuditActionDownload,
+				Target:    targets[i%4],
+				Result:    result,
+				Status:    200,
+				CreatedAt: int64(i * 10),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		logs, err := store.ListAuditLogs(ctx, &db.AuditLogFilter{}, 3)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(logs) != 3 || logs[0].ID != 8 || logs[2].ID != 6 {
+			t.Fatalf("logs not matched %+v", logs)
+		}
+		logs, err = store.ListAuditLogs(ctx, &db.AuditLogFilter{BeforeID: 6}, 3)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(logs) != 3 || logs[0].ID != 5 || logs[2].ID != 3 {
+			t.Fatalf("logs of the next page not matched %+v", logs)
+		}
+
+		testCases := []struct {
+			filter   *db.AuditLogFilter
+			expected []uint64
+		}{
+			{&db.AuditLogFilter{Actor: "user1"}, []uint64{8, 6, 4, 2}},
+			{&db.AuditLogFilter{Target: "user0/files/dir"}, []uint64{6, 2}},
+			{&db.AuditLogFilter{Result: db.AuditResultFailed}, []uint64{8, 4}},
+			{&db.AuditLogFilter{From: 20, To: 50}, []uint64{5, 4, 3}},
+			{&db.AuditLogFilter{Actor: "user0", Action: db.AuditActionLogin}, []uint64{}},
+		}
+		for _, tc := range testCases {
+			logs, err = store.ListAuditLogs(ctx, tc.filter, 10)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(logs) != len(tc.expected) {
+				t.Fatalf("logs not matched %+v %+v", tc.filter, logs)
+			}
+			for i, log := range logs {
+				if log.ID != tc.expected[i] {
+					t.Fatalf("logs not matched %+v %+v", tc.filter, logs)
+				}
+			}
+		}
+
+		if err = store.DelAuditLogs(ctx, 30); err != nil {
+			t.Fatal(err)
+		}
+		logs, err = store.ListAuditLogs(ctx, &db.AuditLogFilter{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(logs) != 5 || logs[4].CreatedAt != 30 {
+			t.Fatalf("old logs are not deleted %+v", logs)
+		}
+	}
+
+	t.Run("audit log store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_auditlogstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testAuditLogMethods(t, store)
+	})
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestDirStatsStore(t *testing.T) {
+	testDirStatsMethods := func(t *testing.T, store db.IDBQuickshare, sqliteDB *sqlite.SQLite) {
+		ctx := context.TODO()
+
+		files := map[string]int64{
+			"admin/files/logs/2024/01.log": 100,
+			"admin/files/logs/2024/02.log": 200,
+			"admin/files/logs/2025/01.log": 400,
+			"admin/files/logs/readme.txt":  8,
+			"admin/files/a.txt":            1,
+		}
+		id := uint64(10)
+		for filePath, size := range files {
+			err := store.AddFileInfo(ctx, id, 0, filePath, &db.FileInfo{Size: size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			id++
+		}
+		// folder infos (e.g. shared folders) are not counted
+		if err := store.AddFileInfo(ctx, id, 0, "admin/files/logs/2025", &db.FileInfo{IsDir: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		assertStats := func(dirPath string, expected map[string][2]int64) {
+			stats, err := store.ListDirStats(ctx, dirPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stats) != len(expected) {
+				t.Fatalf("stats of %s not matched %+v %v", dirPath, stats, expected)
+			}
+			for statPath, stat := range expected {
+				got, ok := stats[statPath]
+				if !ok || got.Size != stat[0] || got.FileCount != stat[1] {
+					t.Fatalf("stat of %s not matched %+v %v", statPath, got, stat)
+				}
+			}
+		}
+
+		assertStats("", map[string][2]int64{"admin": {709, 5}})
+		assertStats("admin/files", map[string][2]int64{"admin/files/logs": {708, 4}})
+		assertStats("admin/files/logs", map[string][2]int64{
+			"admin/files/logs/2024": {300, 2},
+			"admin/files/logs/2025": {400, 1},
+		})
+		assertStats("admin/files/logs/2024", map[string][2]int64{})
+
+		// stats are moved with folders
+		if err := store.MoveFileInfo(ctx, 0, "admin/files/logs/2024", "admin/files/archive", true); err != nil {
+			t.Fatal(err)
+		}
+		assertStats("admin/files", map[string][2]int64{
+			"admin/files/logs":    {408, 2},
+			"admin/files/archive": {300, 2},
+		})
+		assertStats("admin/files/logs", map[string][2]int64{
+			"admin/files/logs/2025": {400, 1},
+		})
+
+		// stats of empty folders are removed
+		if err := store.DelFileInfo(ctx, 0, "admin/files/logs/2025"); err != nil {
+			t.Fatal(err)
+		}
+		assertStats("admin/files/logs", map[string][2]int64{})
+		if err := store.DelFileInfo(ctx, 0, "admin/files/archive/01.log"); err != nil {
+			t.Fatal(err)
+		}
+		assertStats("admin/files", map[string][2]int64{
+			"admin/files/logs":    {8, 1},
+			"admin/files/archive": {200, 1},
+		})
+
+		// stats are rebuilt if they are missing, e.g. the db is upgraded
+		if _, err := sqliteDB.ExecContext(ctx, `delete from t_dir_stat`); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Upgrade(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assertStats("", map[string][2]int64{"admin": {209, 3}})
+		assertStats("admin/files", map[string][2]int64{
+			"admin/files/logs":    {8, 1},
+			"admin/files/archive": {200, 1},
+		})
+	}
+
+	t.Run("dir stats - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_dirstats_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testDirStatsMethods(t, store, sqliteDB)
+	})
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestFileChangesStore(t *testing.T) {
+	testFileChangesMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		first, last, err := store.GetFileChangeSeqs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if first != 1 || last != 0 {
+			t.Fatalf("journal should be empty %d %d", first, last)
+		}
+
+		// mutations of file infos are recorded
+		err = store.AddFileChange(ctx, &db.FileChange{UserID: 1, Op: db.FileChangeCreate, Path: "admin/files/docs", IsDir: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.AddUploadInfos(ctx, 10, 0, "admin/uploadings/a.txt", "admin/files/docs/a.txt", &db.FileInfo{Size: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.MoveUploadingInfos(ctx, 10, 0, "admin/uploadings/a.txt", "admin/files/docs/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.AddSharing(ctx, 11, 0, "admin/files/docs"); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.MoveFileInfo(ctx, 0, "admin/files/docs", "admin/files/archive", true); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.DelFileInfo(ctx, 0, "admin/files/archive/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		err = store.AddFileChange(ctx, &db.FileChange{UserID: 2, Op: db.FileChangeCreate, Path: "user/files/b", IsDir: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertOps := func(changes []*db.FileChange, expected ...string) {
+			if len(changes) != len(expected) {
+				t.Fatalf("changes not matched %+v %v", changes, expected)
+			}
+			for i, change := range changes {
+				if change.Op != expected[i] || (i > 0 && change.Seq <= changes[i-1].Seq) {
+					t.Fatalf("changes not matched %+v %v", changes, expected)
+				}
+			}
+		}
+
+		changes, lastSeq, err := store.ListFileChanges(ctx, 0, nil, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOps(changes,
+			db.FileChangeCreate, db.FileChangeUpload, db.FileChangeShare,
+			db.FileChangeMove, db.FileChangeDelete, db.FileChangeCreate,
+		)
+		if lastSeq != changes[5].Seq {
+			t.Fatalf("incorrect last seq %d", lastSeq)
+		}
+		if changes[1].Path != "admin/files/docs/a.txt" || changes[1].Size != 5 ||
+			changes[3].NewPath != "admin/files/archive" || !changes[3].IsDir ||
+			changes[4].Size != 5 || changes[4].IsDir {
+			t.Fatalf("changes not matched %+v %+v %+v", changes[1], changes[3], changes[4])
+		}
+
+		// changes are paginated and filtered by dirs, moving into the dir is also matched
+		changes, lastSeq, err = store.ListFileChanges(ctx, 0, []string{"admin/files/archive"}, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOps(changes, db.FileChangeMove, db.FileChangeDelete)
+		if lastSeq != 6 {
+			t.Fatalf("all changes should be checked %d", lastSeq)
+		}
+		changes, lastSeq, err = store.ListFileChanges(ctx, 1, []string{"admin"}, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOps(changes, db.FileChangeUpload, db.FileChangeShare)
+		if lastSeq != changes[1].Seq {
+			t.Fatalf("incorrect last seq %d", lastSeq)
+		}
+		changes, _, err = store.ListFileChanges(ctx, 0, []string{}, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOps(changes)
+
+		// retention purges everything, and the last seq is kept
+		if err = store.DelFileChanges(ctx, lastChangeCreatedAt(t, store)+1); err != nil {
+			t.Fatal(err)
+		}
+		first, last, err = store.GetFileChangeSeqs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if first != 7 || last != 6 {
+			t.Fatalf("incorrect seqs %d %d", first, last)
+		}
+		changes, lastSeq, err = store.ListFileChanges(ctx, 6, nil, 100)
+		if err != nil {
+			t.Fatal(err)
+		} else if lastSeq != 6 {
+			t.Fatalf("incorrect last seq %d", lastSeq)
+		}
+		assertOps(changes)
+
+		err = store.AddFileChange(ctx, &db.FileChange{UserID: 2, Op: db.FileChangeCreate, Path: "user/files/c", IsDir: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, last, err = store.GetFileChangeSeqs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if first != 7 || last != 7 {
+			t.Fatalf("incorrect seqs %d %d", first, last)
+		}
+	}
+
+	t.Run("file changes - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_filechanges_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testFileChangesMethods(t, store)
+	})
+}
+
+// lastChangeCreatedAt returns the creating time of the last change
+func lastChangeCreatedAt(t *testing.T, store db.IDBQuickshare) int64 {
+	changes, _, err := store.ListFileChanges(context.TODO(), 0, nil, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes[len(changes)-1].CreatedAt
+}
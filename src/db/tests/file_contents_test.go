@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestFileContentsStore(t *testing.T) {
+	testFileContentsMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		contents := map[string]string{
+			"admin/files/docs/plan.md":   "The budget plan of 2024, the budget is approved",
+			"admin/files/docs/notes.txt": "Meeting notes: budgeting and hiring",
+			"admin/files/docs_old/a.txt": "an early draft which mentions the budget once among many other words",
+			"admin/files/misc.txt":       "nothing related",
+		}
+		id := uint64(10)
+		for itemPath, content := range contents {
+			err := store.AddFileInfo(ctx, id, 0, itemPath, &db.FileInfo{Size: int64(len(content))})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = store.SetFileContent(ctx, itemPath, content); err != nil {
+				t.Fatal(err)
+			}
+			id++
+		}
+		// texts of missing files are ignored
+		if err := store.SetFileContent(ctx, "admin/files/deleted.txt", "budget"); err != nil {
+			t.Fatal(err)
+		}
+
+		searchPaths := func(query string, dirPaths []string) []string {
+			matches, err := store.SearchFileContents(ctx, query, dirPaths, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths := []string{}
+			for _, match := range matches {
+				paths = append(paths, match.Path)
+			}
+			return paths
+		}
+		assertPaths := func(paths []string, expected ...string) {
+			if len(paths) != len(expected) {
+				t.Fatalf("paths not matched %v %v", paths, expected)
+			}
+			for i := range paths {
+				if paths[i] != expected[i] {
+					t.Fatalf("paths not matched %v %v", paths, expected)
+				}
+			}
+		}
+
+		// better matches go first
+		assertPaths(searchPaths("budget", nil), "admin/files/docs/plan.md", "admin/files/docs_old/a.txt")
+		assertPaths(searchPaths("budget", []string{"admin/files/docs"}), "admin/files/docs/plan.md")
+		assertPaths(searchPaths("budg*", []string{"admin/files/docs"}), "admin/files/docs/plan.md", "admin/files/docs/notes.txt")
+		assertPaths(searchPaths(`"budget plan"`, nil), "admin/files/docs/plan.md")
+		assertPaths(searchPaths(`budget OR nothing`, nil))
+		assertPaths(searchPaths("budget", []string{}))
+		assertPaths(searchPaths(`"`, nil))
+
+		matches, err := store.SearchFileContents(ctx, "approved", nil, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(matches) != 1 || matches[0].Score <= 0 ||
+			matches[0].Snippet != "The budget plan of 2024, the budget is "+db.SnippetMatchStart+"approved"+db.SnippetMatchEnd {
+			t.Fatalf("matches not matched %+v", matches)
+		}
+
+		// texts are updated, moved and deleted with files
+		if err = store.SetFileContent(ctx, "admin/files/misc.txt", "budget summary"); err != nil {
+			t.Fatal(err)
+		}
+		assertPaths(searchPaths("summary", nil), "admin/files/misc.txt")
+		assertPaths(searchPaths("related", nil))
+
+		if err = store.MoveFileInfo(ctx, 0, "admin/files/docs", "admin/files/archive", true); err != nil {
+			t.Fatal(err)
+		}
+		assertPaths(searchPaths("approved", nil), "admin/files/archive/plan.md")
+
+		if err = store.DelFileInfo(ctx, 0, "admin/files/archive"); err != nil {
+			t.Fatal(err)
+		}
+		assertPaths(searchPaths("approved OR hiring", nil))
+		assertPaths(searchPaths("hiring", nil))
+		assertPaths(searchPaths("draft", nil), "admin/files/docs_old/a.txt")
+	}
+
+	t.Run("file contents - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_filecontents_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testFileContentsMethods(t, store)
+	})
+}
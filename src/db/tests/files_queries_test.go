@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestFileQueriesStore(t *testing.T) {
+	testFileQueriesMethods := func(t *testing.T, store db.IDBQuickshare, sqliteDB *sqlite.SQLite) {
+		ctx := context.TODO()
+
+		files := []*struct {
+			path    string
+			size    int64
+			modTime int64
+		}{
+			{"admin/files/docs/Report.pdf", 300, 30},
+			{"admin/files/docs/notes.txt", 20, 10},
+			{"admin/files/docs/2024/plan.pdf", 100, 40},
+			{"admin/files/a*b.txt", 5, 20},
+			{"admin_2/files/other.pdf", 1, 50},
+		}
+		for i, file := range files {
+			err := store.AddFileInfo(ctx, uint64(10+i), 0, file.path, &db.FileInfo{Size: file.size, ModTime: file.modTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.SetSha1(ctx, "admin/files/docs/notes.txt", "ABC"); err != nil {
+			t.Fatal(err)
+		}
+		// folder infos (e.g. shared folders) are not listed as items
+		if err := store.AddFileInfo(ctx, 20, 0, "admin/files/docs/2024", &db.FileInfo{IsDir: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		isDir, isFile := true, false
+		newQuery := func() *db.FileQuery {
+			return &db.FileQuery{
+				DirPaths: []string{"admin/files"},
+				MinSize:  -1,
+				MaxSize:  -1,
+				Limit:    10,
+			}
+		}
+		queryPaths := func(query *db.FileQuery) []string {
+			items, err := store.QueryFiles(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths := []string{}
+			for _, item := range items {
+				paths = append(paths, item.Path)
+			}
+			return paths
+		}
+		assertPaths := func(paths []string, expected ...string) {
+			if len(paths) != len(expected) {
+				t.Fatalf("paths not matched %v %v", paths, expected)
+			}
+			for i := range paths {
+				if paths[i] != expected[i] {
+					t.Fatalf("paths not matched %v %v", paths, expected)
+				}
+			}
+		}
+
+		assertPaths(queryPaths(newQuery()),
+			"admin/files/a*b.txt",
+			"admin/files/docs",
+			"admin/files/docs/2024",
+			"admin/files/docs/2024/plan.pdf",
+			"admin/files/docs/Report.pdf",
+			"admin/files/docs/notes.txt",
+		)
+
+		query := newQuery()
+		query.Names = []string{"report"}
+		assertPaths(queryPaths(query), "admin/files/docs/Report.pdf")
+		query.Names = []string{"*.txt"}
+		assertPaths(queryPaths(query), "admin/files/a*b.txt", "admin/files/docs/notes.txt")
+		query.Names = []string{"a*b"}
+		assertPaths(queryPaths(query))
+		query.Names = []string{"*[*]*"}
+		assertPaths(queryPaths(query), "admin/files/a*b.txt")
+
+		query = newQuery()
+		query.Exts = []string{"pdf", "*"}
+		assertPaths(queryPaths(query), "admin/files/docs/2024/plan.pdf", "admin/files/docs/Report.pdf")
+		query.MinSize, query.MaxSize = 100, 200
+		assertPaths(queryPaths(query), "admin/files/docs/2024/plan.pdf")
+
+		query = newQuery()
+		query.ModifiedAfter, query.ModifiedBefore = 20, 40
+		assertPaths(queryPaths(query), "admin/files/a*b.txt", "admin/files/docs/Report.pdf")
+		query.IsDir = &isDir
+		assertPaths(queryPaths(query))
+		query.ModifiedBefore = 0
+		// mod times of folders are the latest mod times of files in them
+		assertPaths(queryPaths(query), "admin/files/docs", "admin/files/docs/2024")
+
+		query = newQuery()
+		query.IsDir, query.Sha1 = &isFile, "abc"
+		assertPaths(queryPaths(query), "admin/files/docs/notes.txt")
+
+		query = newQuery()
+		query.DirPaths = []string{"admin/files/docs", "admin_2/files"}
+		assertPaths(queryPaths(query),
+			"admin/files/docs/2024",
+			"admin/files/docs/2024/plan.pdf",
+			"admin/files/docs/Report.pdf",
+			"admin/files/docs/notes.txt",
+			"admin_2/files/other.pdf",
+		)
+		query.DirPaths = []string{}
+		assertPaths(queryPaths(query))
+
+		// items are paginated by the last item of the previous page
+		for _, testCase := range []struct {
+			sortBy   string
+			desc     bool
+			expected []string
+		}{
+			{
+				db.FileSortByName, false,
+				[]string{"2024", "a*b.txt", "docs", "notes.txt", "plan.pdf", "Report.pdf"},
+			},
+			{
+				db.FileSortBySize, true,
+				[]string{"docs", "Report.pdf", "plan.pdf", "2024", "notes.txt", "a*b.txt"},
+			},
+			{
+				db.FileSortByModTime, false,
+				[]string{"notes.txt", "a*b.txt", "Report.pdf", "docs", "2024", "plan.pdf"},
+			},
+		} {
+			names := []string{}
+			query = newQuery()
+			query.SortBy, query.Desc, query.Limit = testCase.sortBy, testCase.desc, 4
+			for {
+				items, err := store.QueryFiles(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, item := range items {
+					names = append(names, item.Name)
+				}
+				if len(items) < query.Limit {
+					break
+				}
+				query.After = items[len(items)-1]
+			}
+			assertPaths(names, testCase.expected...)
+		}
+
+		query = newQuery()
+		query.SortBy = "owner"
+		if _, err := store.QueryFiles(ctx, query); err == nil {
+			t.Fatal("unknown sorting key should be rejected")
+		}
+
+		// mod times are added in upgrading and they are filled by reindexing
+		if _, err := sqliteDB.ExecContext(ctx, `alter table t_file_info drop column mod_time`); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Upgrade(ctx); err != nil {
+			t.Fatal(err)
+		}
+		err := store.SetModTimes(ctx, map[string]int64{
+			"admin/files/docs/notes.txt": 60,
+			"admin/files/missing.txt":    70,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		query = newQuery()
+		query.ModifiedAfter = 1
+		assertPaths(queryPaths(query), "admin/files/docs", "admin/files/docs/2024", "admin/files/docs/notes.txt")
+		info, err := store.GetFileInfo(ctx, "admin/files/docs/notes.txt")
+		if err != nil {
+			t.Fatal(err)
+		} else if info.ModTime != 60 || info.Sha1 != "ABC" {
+			t.Fatalf("info not matched %+v", info)
+		}
+	}
+
+	t.Run("file queries - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_filequeries_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testFileQueriesMethods(t, store, sqliteDB)
+	})
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestGroupStore(t *testing.T) {
+	testGroupMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		userId, userName := uint64(2), "group_user"
+		err := store.AddUser(ctx, &db.User{
+			ID:   userId,
+			Name: userName,
+			Pwd:  "666",
+			Role: db.UserRole,
+			Quota: &db.Quota{
+				SpaceLimit:         1024,
+				UploadSpeedLimit:   1024,
+				DownloadSpeedLimit: 1024,
+			},
+			Preferences: &db.DefaultPreferences,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// add groups
+		groupId, groupName := uint64(10), "team"
+		err = store.AddGroup(ctx, &db.Group{
+			ID:    groupId,
+			Name:  groupName,
+			Quota: &db.GroupQuota{SpaceLimit: 10},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.AddGroup(ctx, &db.Group{
+			ID:    11,
+			Name:  "a/b",
+			Quota: &db.GroupQuota{SpaceLimit: 10},
+		})
+		if !errors.Is(err, db.ErrInvalidGroup) {
+			t.Fatalf("invalid group name should be rejected: %v", err)
+		}
+
+		group, err := store.GetGroupByName(ctx, groupName)
+		if err != nil {
+			t.Fatal(err)
+		} else if group.ID != groupId || group.Quota.SpaceLimit != 10 || group.UsedSpace != 0 {
+			t.Fatalf("group not matched %+v", group)
+		}
+
+		// members
+		err = store.SetGroupMember(ctx, groupId, userId, "owner")
+		if !errors.Is(err, db.ErrInvalidGroupPerm) {
+			t.Fatalf("invalid perm should be rejected: %v", err)
+		}
+		err = store.SetGroupMember(ctx, groupId, userId, db.GroupPermRead)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.SetGroupMember(ctx, groupId, userId, db.GroupPermWrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		member, err := store.GetGroupMember(ctx, groupId, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if member.Perm != db.GroupPermWrite || member.UserName != userName {
+			t.Fatalf("member not matched %+v", member)
+		}
+		userGroups, err := store.ListUserGroups(ctx, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(userGroups) != 1 || userGroups[0].Group.Name != groupName {
+			t.Fatalf("user groups not matched %+v", userGroups)
+		}
+
+		// used space is charged to the group
+		itemPath := "_groups/team/files/f1"
+		err = store.AddUploadInfos(ctx, 100, userId, "group_user/uploadings/f1", itemPath, &db.FileInfo{Size: 11})
+		if !errors.Is(err, db.ErrQuota) {
+			t.Fatalf("group quota should be checked: %v", err)
+		}
+		err = store.AddUploadInfos(ctx, 100, userId, "group_user/uploadings/f1", itemPath, &db.FileInfo{Size: 6})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.MoveUploadingInfos(ctx, 100, userId, "group_user/uploadings/f1", itemPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUsed := func(groupUsed, userUsed int64) {
+			t.Helper()
+			group, err := store.GetGroup(ctx, groupId)
+			if err != nil {
+				t.Fatal(err)
+			} else if group.UsedSpace != groupUsed {
+				t.Fatalf("group used space not matched (%d) (%d)", group.UsedSpace, groupUsed)
+			}
+			user, err := store.GetUser(ctx, userId)
+			if err != nil {
+				t.Fatal(err)
+			} else if user.UsedSpace != userUsed {
+				t.Fatalf("user used space not matched (%d) (%d)", user.UsedSpace, userUsed)
+			}
+		}
+		assertUsed(6, 0)
+
+		// moving items between the team folder and the home transfers used space
+		err = store.MoveFileInfo(ctx, userId, itemPath, "group_user/files/f1", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUsed(0, 6)
+		err = store.MoveFileInfo(ctx, userId, "group_user/files/f1", itemPath, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUsed(6, 0)
+
+		err = store.DelFileInfo(ctx, userId, itemPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUsed(0, 0)
+
+		// delete
+		err = store.DelGroupMember(ctx, groupId, userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = store.GetGroupMember(ctx, groupId, userId)
+		if !errors.Is(err, db.ErrGroupMemberNotFound) {
+			t.Fatalf("member should be removed: %v", err)
+		}
+		err = store.DelGroup(ctx, groupId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups, err := store.ListGroups(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(groups) != 0 {
+			t.Fatalf("groups should be empty %+v", groups)
+		}
+	}
+
+	t.Run("group store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_groupstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+		// upgrading an initialized db should be a no-op
+		if err = store.Upgrade(context.TODO()); err != nil {
+			t.Fatalf("fail to upgrade sqlite store: %s", err)
+		}
+
+		testGroupMethods(t, store)
+	})
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestIdentityStore(t *testing.T) {
+	testIdentityMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		userId := uint64(2)
+		err := store.AddUser(ctx, &db.User{
+			ID:   userId,
+			Name: "ssouser",
+			Pwd:  "666",
+			Role: db.UserRole,
+			Quota: &db.Quota{
+				SpaceLimit:         1024,
+				UploadSpeedLimit:   1024,
+				DownloadSpeedLimit: 1024,
+			},
+			Preferences: &db.DefaultPreferences,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.AddIdentity(ctx, &db.Identity{Issuer: "https://idp", Subject: "sub1", UserID: 404})
+		if !errors.Is(err, db.ErrUserNotFound) {
+			t.Fatalf("identity of missing user should be rejected: %v", err)
+		}
+		for _, identity := range []*db.Identity{
+			{Issuer: "https://idp", Subject: "sub1", UserID: userId},
+			{Issuer: "https://idp2", Subject: "sub1", UserID: userId},
+		} {
+			if err = store.AddIdentity(ctx, identity); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = store.AddIdentity(ctx, &db.Identity{Issuer: "https://idp", Subject: "sub1", UserID: 0})
+		if err == nil {
+			t.Fatal("identity can be linked only once")
+		}
+
+		identity, err := store.GetIdentity(ctx, "https://idp", "sub1")
+		if err != nil {
+			t.Fatal(err)
+		} else if identity.UserID != userId {
+			t.Fatalf("identity not matched %+v", identity)
+		}
+		if _, err = store.GetIdentity(ctx, "https://idp", "sub2"); !errors.Is(err, db.ErrIdentityNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		identities, err := store.ListIdentities(ctx, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(identities) != 2 {
+			t.Fatalf("identities not matched %+v", identities)
+		}
+
+		// identities are removed with users
+		if err = store.DelUser(ctx, userId); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetIdentity(ctx, "https://idp", "sub1"); !errors.Is(err, db.ErrIdentityNotFound) {
+			t.Fatalf("identity is not deleted: %v", err)
+		}
+	}
+
+	t.Run("identity store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_identitystore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testIdentityMethods(t, store)
+	})
+}
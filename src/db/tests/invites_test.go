@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestInviteStore(t *testing.T) {
+	testInviteMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		quota := &db.Quota{SpaceLimit: 2048, UploadSpeedLimit: 1024, DownloadSpeedLimit: 1024}
+		for _, invite := range []*db.Invite{
+			{ID: 1, CodeHash: "h1", Role: db.UserRole, Quota: quota, MaxUses: 2, CreatedBy: 0, CreatedAt: 1},
+			{ID: 2, CodeHash: "h2", Role: db.AdminRole, MaxUses: 1, ExpireAt: 100, CreatedBy: 0, CreatedAt: 2},
+		} {
+			if err := store.AddInvite(ctx, invite); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for desc, invite := range map[string]*db.Invite{
+			"duplicated code":   {ID: 3, CodeHash: "h1", Role: db.UserRole, MaxUses: 1},
+			"pending role":      {ID: 4, CodeHash: "h4", Role: db.PendingRole, MaxUses: 1},
+			"non-existing role": {ID: 5, CodeHash: "h5", Role: "nobody", MaxUses: 1},
+			"no uses":           {ID: 6, CodeHash: "h6", Role: db.UserRole},
+		} {
+			if err := store.AddInvite(ctx, invite); err == nil {
+				t.Fatalf("invite with %s should be rejected", desc)
+			}
+		}
+
+		invite, err := store.UseInvite(ctx, "h1", 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if invite.ID != 1 || invite.Role != db.UserRole || invite.Quota.SpaceLimit != 2048 {
+			t.Fatalf("invite not matched %+v", invite)
+		}
+		if _, err = store.UseInvite(ctx, "h1", 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.UseInvite(ctx, "h1", 10); !errors.Is(err, db.ErrInviteUsedUp) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err = store.ReleaseInvite(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.UseInvite(ctx, "h1", 10); err != nil {
+			t.Fatalf("released invite should be usable: %v", err)
+		}
+
+		if _, err = store.UseInvite(ctx, "h2", 200); !errors.Is(err, db.ErrInviteExpired) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if invite, err = store.UseInvite(ctx, "h2", 50); err != nil {
+			t.Fatal(err)
+		} else if invite.Quota != nil {
+			t.Fatalf("default quota should be nil %+v", invite.Quota)
+		}
+		if _, err = store.UseInvite(ctx, "unknown", 50); !errors.Is(err, db.ErrInviteNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		// newest invites are listed first
+		invites, err := store.ListInvites(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(invites) != 2 || invites[0].ID != 2 || invites[0].Used != 1 || invites[1].Used != 2 {
+			t.Fatalf("invites not matched %+v", invites)
+		}
+
+		if err = store.DelInvite(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.DelInvite(ctx, 1); !errors.Is(err, db.ErrInviteNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if _, err = store.UseInvite(ctx, "h1", 10); !errors.Is(err, db.ErrInviteNotFound) {
+			t.Fatalf("deleted invite is used: %v", err)
+		}
+	}
+
+	t.Run("invite store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_invitestore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testInviteMethods(t, store)
+	})
+}
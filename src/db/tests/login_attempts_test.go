@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestLoginAttemptStore(t *testing.T) {
+	testLoginAttemptMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		for i := 0; i < 6; i++ {
+			err := store.AddLoginAttempt(ctx, &db.LoginAttempt{
+				ID:        uint64(i),
+				UserName:  fmt.Sprintf("user%d", i%2),
+				IP:        "1.1.1.1",
+				Reason:    "invalid_password",
+				CreatedAt: int64(i * 10),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		attempts, err := store.ListLoginAttempts(ctx, "", 4)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(attempts) != 4 || attempts[0].ID != 5 || attempts[3].ID != 2 {
+			t.Fatalf("attempts not matched %+v", attempts)
+		}
+
+		attempts, err = store.ListLoginAttempts(ctx, "user1", 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(attempts) != 3 {
+			t.Fatalf("attempts not matched %+v", attempts)
+		}
+		for _, attempt := range attempts {
+			if attempt.UserName != "user1" || attempt.IP != "1.1.1.1" || attempt.Reason != "invalid_password" {
+				t.Fatalf("attempt not matched %+v", attempt)
+			}
+		}
+
+		if err = store.DelLoginAttempts(ctx, 30); err != nil {
+			t.Fatal(err)
+		}
+		attempts, err = store.ListLoginAttempts(ctx, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(attempts) != 3 || attempts[2].CreatedAt != 30 {
+			t.Fatalf("old attempts are not deleted %+v", attempts)
+		}
+	}
+
+	t.Run("login attempt store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_loginattemptstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testLoginAttemptMethods(t, store)
+	})
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestMFAStore(t *testing.T) {
+	testMFAMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		userId := uint64(2)
+		err := store.AddUser(ctx, &db.User{
+			ID:   userId,
+			Name: "mfauser",
+			Pwd:  "666",
+			Role: db.UserRole,
+			Quota: &db.Quota{
+				SpaceLimit:         1024,
+				UploadSpeedLimit:   1024,
+				DownloadSpeedLimit: 1024,
+			},
+			Preferences: &db.DefaultPreferences,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = store.GetMFA(ctx, userId); !errors.Is(err, db.ErrMFANotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err = store.SetMFASecret(ctx, 404, "secret"); !errors.Is(err, db.ErrUserNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		// the enrollment is pending until it is enabled
+		if err = store.SetMFASecret(ctx, userId, "secret"); err != nil {
+			t.Fatal(err)
+		}
+		mfa, err := store.GetMFA(ctx, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if mfa.Secret != "secret" || mfa.Enabled || len(mfa.RecoveryCodes) != 0 {
+			t.Fatalf("mfa not matched %+v", mfa)
+		}
+		if err = store.UseRecoveryCode(ctx, userId, "code1"); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if err = store.EnableMFA(ctx, userId, []string{"code1", "code2"}, 10); err != nil {
+			t.Fatal(err)
+		}
+		mfa, err = store.GetMFA(ctx, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if !mfa.Enabled || mfa.LastStep != 10 || len(mfa.RecoveryCodes) != 2 {
+			t.Fatalf("mfa not matched %+v", mfa)
+		}
+
+		// steps can not be reused
+		if err = store.UseMFAStep(ctx, userId, 10); !errors.Is(err, db.ErrMFACodeUsed) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err = store.UseMFAStep(ctx, userId, 11); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.UseMFAStep(ctx, userId, 9); !errors.Is(err, db.ErrMFACodeUsed) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		// recovery codes can be used only once
+		if err = store.UseRecoveryCode(ctx, userId, "code1"); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.UseRecoveryCode(ctx, userId, "code1"); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		mfa, err = store.GetMFA(ctx, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(mfa.RecoveryCodes) != 1 || mfa.RecoveryCodes[0] != "code2" {
+			t.Fatalf("recovery codes not matched %+v", mfa.RecoveryCodes)
+		}
+
+		if err = store.DelMFA(ctx, userId); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetMFA(ctx, userId); !errors.Is(err, db.ErrMFANotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		// mfa is deleted with the user
+		if err = store.SetMFASecret(ctx, userId, "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.DelUser(ctx, userId); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetMFA(ctx, userId); !errors.Is(err, db.ErrMFANotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	t.Run("mfa store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_mfastore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testMFAMethods(t, store)
+	})
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestPwdResetStore(t *testing.T) {
+	testPwdResetMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		userId := uint64(2)
+		err := store.AddUser(ctx, &db.User{
+			ID:   userId,
+			Name: "resetuser",
+			Pwd:  "666",
+			Role: db.UserRole,
+			Quota: &db.Quota{
+				SpaceLimit:         1024,
+				UploadSpeedLimit:   1024,
+				DownloadSpeedLimit: 1024,
+			},
+			Preferences: &db.DefaultPreferences,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = store.AddPwdReset(ctx, "t0", 404, 100, 1); !errors.Is(err, db.ErrUserNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err = store.AddPwdReset(ctx, "t1", userId, 100, 1); err != nil {
+			t.Fatal(err)
+		}
+		// the previous token is replaced
+		if err = store.AddPwdReset(ctx, "t2", userId, 100, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.UsePwdReset(ctx, "t1", 10); !errors.Is(err, db.ErrPwdResetNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		uid, err := store.UsePwdReset(ctx, "t2", 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if uid != userId {
+			t.Fatalf("incorrect user id (%d)", uid)
+		}
+		if _, err = store.UsePwdReset(ctx, "t2", 10); !errors.Is(err, db.ErrPwdResetNotFound) {
+			t.Fatalf("token is used twice: %v", err)
+		}
+
+		if err = store.AddPwdReset(ctx, "t3", userId, 100, 20); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.UsePwdReset(ctx, "t3", 100); !errors.Is(err, db.ErrPwdResetExpired) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if err = store.AddPwdReset(ctx, "t4", userId, 100, 20); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.DelUser(ctx, userId); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.UsePwdReset(ctx, "t4", 30); !errors.Is(err, db.ErrPwdResetNotFound) {
+			t.Fatalf("token is not deleted with the user: %v", err)
+		}
+	}
+
+	t.Run("password reset store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_pwdresetstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testPwdResetMethods(t, store)
+	})
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestQuotaPolicyStore(t *testing.T) {
+	testQuotaPolicyMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		fallback := &db.Quota{SpaceLimit: 100, UploadSpeedLimit: 100, DownloadSpeedLimit: 100}
+		for _, userID := range []uint64{2, 3} {
+			err := store.AddUser(ctx, &db.User{
+				ID:          userID,
+				Name:        fmt.Sprintf("user%d", userID),
+				Pwd:         "pwd",
+				Role:        db.UserRole,
+				Quota:       fallback,
+				Preferences: &db.DefaultPreferences,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := store.AddGroup(ctx, &db.Group{ID: 10, Name: "team", Quota: &db.GroupQuota{SpaceLimit: 10}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.SetGroupMember(ctx, 10, 3, db.GroupPermRead); err != nil {
+			t.Fatal(err)
+		}
+
+		assertQuota := func(userID uint64, spaceLimit int64) {
+			user, err := store.GetUser(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			} else if user.Quota.SpaceLimit != spaceLimit {
+				t.Fatalf("user(%d) space limit not matched %d %d", userID, user.Quota.SpaceLimit, spaceLimit)
+			}
+		}
+
+		for desc, policy := range map[string]*db.QuotaPolicy{
+			"visitor role":      {SubjectType: db.QuotaPolicyRole, Subject: db.VisitorRole, Quota: fallback},
+			"non-existing role": {SubjectType: db.QuotaPolicyRole, Subject: "nobody", Quota: fallback},
+			"invalid group ID":  {SubjectType: db.QuotaPolicyGroup, Subject: "team", Quota: fallback},
+			"visitor user":      {SubjectType: db.QuotaPolicyUser, Subject: "1", Quota: fallback},
+			"unknown type":      {SubjectType: "site", Subject: "1", Quota: fallback},
+			"missing quota":     {SubjectType: db.QuotaPolicyRole, Subject: db.UserRole},
+		} {
+			if _, err = store.SetQuotaPolicy(ctx, policy, fallback); err == nil {
+				t.Fatalf("policy with %s should be rejected", desc)
+			}
+		}
+
+		// users inherit the role policy
+		updated, err := store.SetQuotaPolicy(ctx, &db.QuotaPolicy{
+			SubjectType: db.QuotaPolicyRole,
+			Subject:     db.UserRole,
+			Quota:       &db.Quota{SpaceLimit: 200, UploadSpeedLimit: 200, DownloadSpeedLimit: 200},
+		}, fallback)
+		if err != nil {
+			t.Fatal(err)
+		} else if updated != 2 {
+			t.Fatalf("updated users not matched %d", updated)
+		}
+		assertQuota(2, 200)
+		assertQuota(3, 200)
+		assertQuota(0, db.DefaultSpaceLimit)
+
+		// group policies take precedence over role policies
+		updated, err = store.SetQuotaPolicy(ctx, &db.QuotaPolicy{
+			SubjectType: db.QuotaPolicyGroup,
+			Subject:     "10",
+			Quota:       &db.Quota{SpaceLimit: 50, UploadSpeedLimit: 50, DownloadSpeedLimit: 50},
+		}, fallback)
+		if err != nil {
+			t.Fatal(err)
+		} else if updated != 1 {
+			t.Fatalf("updated users not matched %d", updated)
+		}
+		assertQuota(2, 200)
+		assertQuota(3, 50)
+
+		// overrides take precedence over all policies
+		_, err = store.SetQuotaPolicy(ctx, &db.QuotaPolicy{
+			SubjectType: db.QuotaPolicyUser,
+			Subject:     "3",
+			Quota:       &db.Quota{SpaceLimit: 300, UploadSpeedLimit: 300, DownloadSpeedLimit: 300},
+		}, fallback)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertQuota(3, 300)
+
+		policies, err := store.ListQuotaPolicies(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(policies) != 3 {
+			t.Fatalf("policies not matched %+v", policies)
+		}
+		policy, err := store.GetQuotaPolicy(ctx, db.QuotaPolicyGroup, "10")
+		if err != nil {
+			t.Fatal(err)
+		} else if policy.Quota.SpaceLimit != 50 {
+			t.Fatalf("policy not matched %+v", policy)
+		}
+
+		if _, err = store.DelQuotaPolicy(ctx, db.QuotaPolicyUser, "3", fallback); err != nil {
+			t.Fatal(err)
+		}
+		assertQuota(3, 50)
+		if _, err = store.DelQuotaPolicy(ctx, db.QuotaPolicyUser, "3", fallback); !errors.Is(err, db.ErrQuotaPolicyNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		// members inherit the role policy after leaving the group
+		if err = store.DelGroupMember(ctx, 10, 3); err != nil {
+			t.Fatal(err)
+		}
+		if updated, err = store.RefreshQuotas(ctx, []uint64{3}, fallback); err != nil {
+			t.Fatal(err)
+		} else if updated != 1 {
+			t.Fatalf("updated users not matched %d", updated)
+		}
+		assertQuota(3, 200)
+
+		// the fallback is used if no policy is matched
+		if _, err = store.DelQuotaPolicy(ctx, db.QuotaPolicyRole, db.UserRole, fallback); err != nil {
+			t.Fatal(err)
+		}
+		assertQuota(2, 100)
+		assertQuota(3, 100)
+
+		// policies are removed with their subjects
+		if err = store.DelGroup(ctx, 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetQuotaPolicy(ctx, db.QuotaPolicyGroup, "10"); !errors.Is(err, db.ErrQuotaPolicyNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	t.Run("quota policy store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_quotapolicystore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testQuotaPolicyMethods(t, store)
+	})
+}
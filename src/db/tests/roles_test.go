@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestRoleStore(t *testing.T) {
+	testRoleMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		roleName := "uploader"
+		rules := []*db.APIRule{
+			{Method: "POST", Path: "/v2/my/fs/files"},
+			{Method: "GET", Path: "/v2/my/fs/dirs*"},
+		}
+
+		err := store.AddRole(ctx, &db.Role{Name: db.AdminRole, Rules: rules})
+		if !errors.Is(err, db.ErrInvalidRole) {
+			t.Fatalf("predefined role should be rejected: %v", err)
+		}
+		err = store.AddRole(ctx, &db.Role{Name: roleName, Rules: []*db.APIRule{{Method: "FETCH", Path: "/"}}})
+		if !errors.Is(err, db.ErrInvalidRole) {
+			t.Fatalf("invalid method should be rejected: %v", err)
+		}
+		err = store.AddRole(ctx, &db.Role{Name: roleName, Rules: rules})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.AddRole(ctx, &db.Role{Name: roleName, Rules: rules})
+		if !errors.Is(err, db.ErrKeyExisting) {
+			t.Fatalf("duplicated role should be rejected: %v", err)
+		}
+
+		role, err := store.GetRole(ctx, roleName)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(role.Rules) != 2 ||
+			!role.Rules[0].Match("POST", "/v2/my/fs/files") ||
+			!role.Rules[1].Match("GET", "/v2/my/fs/dirs/home") ||
+			role.Rules[1].Match("DELETE", "/v2/my/fs/dirs") {
+			t.Fatalf("rules not matched %+v", role.Rules)
+		}
+
+		// users can only be assigned with existing roles
+		newUser := func(id uint64, name, roleName string) *db.User {
+			return &db.User{
+				ID:   id,
+				Name: name,
+				Pwd:  "666",
+				Role: roleName,
+				Quota: &db.Quota{
+					SpaceLimit:         1024,
+					UploadSpeedLimit:   1024,
+					DownloadSpeedLimit: 1024,
+				},
+				Preferences: &db.DefaultPreferences,
+			}
+		}
+		err = store.AddUser(ctx, newUser(2, "user2", "not-existing"))
+		if !errors.Is(err, db.ErrRoleNotFound) {
+			t.Fatalf("unknown role should be rejected: %v", err)
+		}
+		err = store.AddUser(ctx, newUser(2, "user2", roleName))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.SetRoleRules(ctx, roleName, rules[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		roles, err := store.ListRoles(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(roles) != 1 || roles[0].Name != roleName || len(roles[0].Rules) != 1 {
+			t.Fatalf("roles not matched %+v", roles)
+		}
+
+		err = store.DelRole(ctx, roleName)
+		if !errors.Is(err, db.ErrRoleInUse) {
+			t.Fatalf("role in use should not be deleted: %v", err)
+		}
+		err = store.DelUser(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.DelRole(ctx, roleName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = store.GetRole(ctx, roleName)
+		if !errors.Is(err, db.ErrRoleNotFound) {
+			t.Fatalf("role should be deleted: %v", err)
+		}
+	}
+
+	t.Run("role store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_rolestore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testRoleMethods(t, store)
+	})
+}
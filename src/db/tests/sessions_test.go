@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestSessionStore(t *testing.T) {
+	testSessionMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		userId, otherId := uint64(2), uint64(3)
+		for id, name := range map[uint64]string{userId: "sessionuser", otherId: "otheruser"} {
+			err := store.AddUser(ctx, &db.User{
+				ID:   id,
+				Name: name,
+				Pwd:  "666",
+				Role: db.UserRole,
+				Quota: &db.Quota{
+					SpaceLimit:         1024,
+					UploadSpeedLimit:   1024,
+					DownloadSpeedLimit: 1024,
+				},
+				Preferences: &db.DefaultPreferences,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		addSessions := func() {
+			for _, session := range []*db.Session{
+				{ID: "s1", UserID: userId, Device: "phone", IP: "1.1.1.1", LastSeen: 1, ExpireAt: 100},
+				{ID: "s2", UserID: userId, Device: "laptop", IP: "1.1.1.2", LastSeen: 2, ExpireAt: 200},
+				{ID: "s3", UserID: otherId, Device: "laptop", IP: "1.1.1.3", LastSeen: 3, ExpireAt: 300},
+			} {
+				if err := store.AddSession(ctx, session); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		addSessions()
+
+		if err := store.SetSessionSeen(ctx, "s1", "2.2.2.2", 10); err != nil {
+			t.Fatal(err)
+		}
+		session, err := store.GetSession(ctx, "s1")
+		if err != nil {
+			t.Fatal(err)
+		} else if session.IP != "2.2.2.2" || session.LastSeen != 10 || session.Device != "phone" {
+			t.Fatalf("session not matched %+v", session)
+		}
+
+		sessions, err := store.ListSessions(ctx, userId)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(sessions) != 2 || sessions[0].ID != "s1" || sessions[1].ID != "s2" {
+			t.Fatalf("sessions not matched %+v", sessions)
+		}
+
+		// sessions can only be revoked by their owners
+		if err = store.DelSession(ctx, otherId, "s1"); !errors.Is(err, db.ErrSessionNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err = store.DelSessions(ctx, userId, "s2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetSession(ctx, "s1"); !errors.Is(err, db.ErrSessionNotFound) {
+			t.Fatalf("session is not deleted: %v", err)
+		}
+		if _, err = store.GetSession(ctx, "s2"); err != nil {
+			t.Fatalf("session should be kept: %v", err)
+		}
+
+		if err = store.DelExpiredSessions(ctx, 250); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetSession(ctx, "s2"); !errors.Is(err, db.ErrSessionNotFound) {
+			t.Fatalf("expired session is not deleted: %v", err)
+		}
+		if _, err = store.GetSession(ctx, "s3"); err != nil {
+			t.Fatalf("session should be kept: %v", err)
+		}
+
+		// sessions are revoked when passwords or roles are changed
+		if err = store.DelSessions(ctx, otherId, ""); err != nil {
+			t.Fatal(err)
+		}
+		addSessions()
+		if err = store.SetPwd(ctx, userId, "777"); err != nil {
+			t.Fatal(err)
+		}
+		if sessions, err = store.ListSessions(ctx, userId); err != nil {
+			t.Fatal(err)
+		} else if len(sessions) != 0 {
+			t.Fatalf("sessions are not revoked %+v", sessions)
+		}
+
+		quota := &db.Quota{SpaceLimit: 2048}
+		if err = store.SetInfo(ctx, otherId, &db.User{Role: db.UserRole, Quota: quota}); err != nil {
+			t.Fatal(err)
+		} else if _, err = store.GetSession(ctx, "s3"); err != nil {
+			t.Fatalf("session should be kept if the role is not changed: %v", err)
+		}
+		if err = store.SetInfo(ctx, otherId, &db.User{Role: db.BannedRole, Quota: quota}); err != nil {
+			t.Fatal(err)
+		} else if _, err = store.GetSession(ctx, "s3"); !errors.Is(err, db.ErrSessionNotFound) {
+			t.Fatalf("session is not revoked: %v", err)
+		}
+	}
+
+	t.Run("session store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_sessionstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testSessionMethods(t, store)
+	})
+}
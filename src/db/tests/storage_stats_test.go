@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestStorageStatsStore(t *testing.T) {
+	testStorageStatsMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+
+		err := store.AddUser(ctx, &db.User{
+			ID:          2,
+			Name:        "user2",
+			Pwd:         "pwd",
+			Role:        db.UserRole,
+			Quota:       &db.Quota{SpaceLimit: 1000, UploadSpeedLimit: 100, DownloadSpeedLimit: 100},
+			Preferences: &db.DefaultPreferences,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := []struct {
+			id     uint64
+			userID uint64
+			path   string
+			size   int64
+			sha1   string
+		}{
+			{id: 10, userID: 0, path: "admin/files/a/f1", size: 10, sha1: "s1"},
+			{id: 11, userID: 0, path: "admin/files/a/b/f2", size: 20, sha1: "s2"},
+			{id: 12, userID: 0, path: "admin/files/f3", size: 30, sha1: "s1"},
+			{id: 13, userID: 2, path: "user2/files/f4", size: 10, sha1: "s1"},
+			{id: 14, userID: 2, path: "user2/files/f5", size: 20, sha1: "s2"},
+			{id: 15, userID: 2, path: "user2/files/f6", size: 5},
+		}
+		for _, file := range files {
+			err = store.AddFileInfo(ctx, file.id, file.userID, file.path, &db.FileInfo{Size: file.size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.sha1 != "" {
+				if err = store.SetSha1(ctx, file.path, file.sha1); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		err = store.AddUploadInfos(ctx, 20, 2, "user2/uploadings/f7", "user2/files/f7", &db.FileInfo{Size: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		usages, err := store.ListUserUsages(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(usages) != 2 {
+			t.Fatalf("usages not matched %+v", usages)
+		}
+		if usages[0].Name != "user2" || usages[0].UsedSpace != 135 || usages[0].FileSize != 35 || usages[0].FileCount != 3 || usages[0].SpaceLimit != 1000 {
+			t.Fatalf("user2's usage not matched %+v", usages[0])
+		}
+		if usages[1].Name != "admin" || usages[1].FileSize != 60 || usages[1].FileCount != 3 {
+			t.Fatalf("admin's usage not matched %+v", usages[1])
+		}
+
+		folders, err := store.ListFolderUsages(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		} else if len(folders) != 2 || folders[0].Path != "admin" || folders[0].Size != 60 {
+			t.Fatalf("homes not matched %+v", folders)
+		}
+		folders, err = store.ListFolderUsages(ctx, "admin/files/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedFolders := map[string]*db.FolderUsage{
+			"admin/files":   {Path: "admin/files", FileCount: 1, Size: 30},
+			"admin/files/a": {Path: "admin/files/a", FileCount: 2, Size: 30},
+		}
+		if len(folders) != len(expectedFolders) {
+			t.Fatalf("folders not matched %+v", folders)
+		}
+		for _, folder := range folders {
+			if *folder != *expectedFolders[folder.Path] {
+				t.Fatalf("folder not matched %+v", folder)
+			}
+		}
+
+		largest, err := store.ListLargestFiles(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(largest) != 2 || largest[0].Path != "admin/files/f3" || largest[0].Sha1 != "s1" || largest[1].Path != "admin/files/a/b/f2" {
+			t.Fatalf("largest files not matched %+v", largest)
+		}
+
+		dups, err := store.ListDuplicateFiles(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(dups) != 2 {
+			t.Fatalf("duplicates not matched %+v", dups)
+		}
+		if dups[0].Sha1 != "s2" || dups[0].Wasted != 20 || len(dups[0].Paths) != 2 || dups[0].Paths[0] != "admin/files/a/b/f2" {
+			t.Fatalf("duplicates not matched %+v", dups[0])
+		}
+		if dups[1].Sha1 != "s1" || dups[1].Size != 10 || len(dups[1].Paths) != 2 {
+			t.Fatalf("duplicates not matched %+v", dups[1])
+		}
+
+		uploadings, err := store.ListAllUploadInfos(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(uploadings) != 1 || uploadings[0].UserID != 2 || uploadings[0].TmpFilePath != "user2/uploadings/f7" {
+			t.Fatalf("uploadings not matched %+v", uploadings)
+		}
+
+		for _, createdAt := range []int64{100, 200, 200} {
+			if err = store.AddStorageSnapshots(ctx, createdAt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		snapshots, err := store.ListStorageSnapshots(ctx, 150)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(snapshots) != 2 {
+			t.Fatalf("snapshots not matched %+v", snapshots)
+		}
+		if snapshots[1].UserID != 2 || snapshots[1].UsedSpace != 135 || snapshots[1].FileCount != 3 || snapshots[1].CreatedAt != 200 {
+			t.Fatalf("snapshot not matched %+v", snapshots[1])
+		}
+		if err = store.DelStorageSnapshots(ctx, 200); err != nil {
+			t.Fatal(err)
+		}
+		if snapshots, err = store.ListStorageSnapshots(ctx, 0); err != nil {
+			t.Fatal(err)
+		} else if len(snapshots) != 2 {
+			t.Fatalf("snapshots not matched %+v", snapshots)
+		}
+	}
+
+	t.Run("storage stats - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_storagestats_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testStorageStatsMethods(t, store)
+	})
+}
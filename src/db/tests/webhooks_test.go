@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/db/rdb/sqlite"
+)
+
+func TestWebhookStore(t *testing.T) {
+	testWebhookMethods := func(t *testing.T, store db.IDBQuickshare) {
+		ctx := context.TODO()
+		adminID := uint64(0)
+
+		err := store.AddWebhook(ctx, &db.Webhook{
+			ID:     1,
+			UserID: adminID,
+			URL:    "ftp://example.com",
+			Secret: "secret",
+			Events: []string{db.WebhookEventFileUploaded},
+		})
+		if !errors.Is(err, db.ErrInvalidWebhook) {
+			t.Fatalf("invalid webhook should not be added: %v", err)
+		}
+
+		hooks := []*db.Webhook{
+			{
+				ID:        1,
+				UserID:    adminID,
+				URL:       "https://example.com/hook1",
+				Secret:    "secret1",
+				Events:    []string{db.WebhookEventFileUploaded, db.WebhookEventFileDeleted},
+				CreatedAt: 1,
+			},
+			{
+				ID:        2,
+				UserID:    adminID,
+				URL:       "https://example.com/hook2",
+				Secret:    "secret2",
+				Events:    []string{db.WebhookEventUserCreated},
+				Global:    true,
+				CreatedAt: 2,
+			},
+		}
+		for _, hook := range hooks {
+			if err = store.AddWebhook(ctx, hook); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		listed, err := store.ListWebhooks(ctx, adminID)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(listed) != 2 || listed[0].URL != hooks[0].URL || listed[1].Secret != "secret2" || !listed[1].Global {
+			t.Fatalf("webhooks not matched %+v", listed)
+		}
+		listed, err = store.ListEventWebhooks(ctx, db.WebhookEventFileDeleted)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(listed) != 1 || listed[0].ID != 1 {
+			t.Fatalf("webhooks of event not matched %+v", listed)
+		}
+
+		for i := 0; i < 4; i++ {
+			err = store.AddWebhookDelivery(ctx, &db.WebhookDelivery{
+				ID:          uint64(i + 1),
+				HookID:      1,
+				Event:       db.WebhookEventFileUploaded,
+				Payload:     "{}",
+				Status:      db.WebhookDeliveryPending,
+				NextRetryAt: int64(i * 10),
+				CreatedAt:   int64(i * 10),
+				UpdatedAt:   int64(i * 10),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		due, err := store.ListDueWebhookDeliveries(ctx, 15, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(due) != 2 || due[0].ID != 1 || due[1].ID != 2 {
+			t.Fatalf("due deliveries not matched %+v", due)
+		}
+
+		delivery := due[0]
+		delivery.Status = db.WebhookDeliverySucceeded
+		delivery.Attempts = 1
+		delivery.ResponseCode = 200
+		delivery.NextRetryAt = 0
+		if err = store.SetWebhookDeliveryResult(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetWebhookDelivery(ctx, delivery.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if got.Status != db.WebhookDeliverySucceeded || got.Attempts != 1 || got.ResponseCode != 200 {
+			t.Fatalf("delivery not matched %+v", got)
+		}
+
+		deliveries, err := store.ListWebhookDeliveries(ctx, 1, 3)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(deliveries) != 3 || deliveries[0].ID != 4 {
+			t.Fatalf("deliveries not matched %+v", deliveries)
+		}
+
+		// only finished deliveries are deleted
+		if err = store.DelWebhookDeliveries(ctx, 25); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetWebhookDelivery(ctx, 1); !errors.Is(err, db.ErrWebhookDeliveryNotFound) {
+			t.Fatalf("finished delivery is not deleted: %v", err)
+		}
+		if _, err = store.GetWebhookDelivery(ctx, 2); err != nil {
+			t.Fatalf("pending delivery should not be deleted: %v", err)
+		}
+
+		if err = store.DelWebhook(ctx, 1234, 1); !errors.Is(err, db.ErrWebhookNotFound) {
+			t.Fatalf("others' webhook should not be deleted: %v", err)
+		}
+		if err = store.DelWebhook(ctx, adminID, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.GetWebhook(ctx, 1); !errors.Is(err, db.ErrWebhookNotFound) {
+			t.Fatalf("webhook is not deleted: %v", err)
+		}
+		deliveries, err = store.ListWebhookDeliveries(ctx, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(deliveries) != 0 {
+			t.Fatalf("deliveries are not deleted %+v", deliveries)
+		}
+	}
+
+	t.Run("webhook store crud - sqlite", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("./", "quickshare_webhookstore_test_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		dbPath := filepath.Join(rootPath, "quickshare.sqlite")
+		sqliteDB, err := sqlite.NewSQLite(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqliteDB.Close()
+
+		store, err := sqlite.NewSQLiteStore(sqliteDB)
+		if err != nil {
+			t.Fatalf("fail to new sqlite store: %s", err)
+		}
+		if err = store.Init(context.TODO(), "admin", "1234", testSiteConfig); err != nil {
+			t.Fatalf("fail to init sqlite store: %s", err)
+		}
+
+		testWebhookMethods(t, store)
+	})
+}
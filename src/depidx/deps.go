@@ -4,14 +4,22 @@ import (
 	"github.com/ihexxa/gocfg"
 	"go.uber.org/zap"
 
+	"github.com/ihexxa/quickshare/src/audit"
 	"github.com/ihexxa/quickshare/src/cron"
 	"github.com/ihexxa/quickshare/src/cryptoutil"
 	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/diskguard"
+	"github.com/ihexxa/quickshare/src/events"
 	"github.com/ihexxa/quickshare/src/fs"
 	"github.com/ihexxa/quickshare/src/idgen"
 	"github.com/ihexxa/quickshare/src/iolimiter"
 	"github.com/ihexxa/quickshare/src/kvstore"
+	"github.com/ihexxa/quickshare/src/loginlimiter"
+	"github.com/ihexxa/quickshare/src/mailer"
+	"github.com/ihexxa/quickshare/src/metrics"
 	"github.com/ihexxa/quickshare/src/search/fileindex"
+	"github.com/ihexxa/quickshare/src/tracing"
+	"github.com/ihexxa/quickshare/src/webhook"
 	"github.com/ihexxa/quickshare/src/worker"
 )
 
@@ -30,9 +38,17 @@ type Deps struct {
 	id        idgen.IIDGen
 	logger    *zap.SugaredLogger
 	limiter   iolimiter.ILimiter
+	loginLim  loginlimiter.ILoginLimiter
+	mailer    mailer.IMailer
+	diskGuard diskguard.IDiskGuard
 	workers   worker.IWorkerPool
 	cron      cron.ICron
 	fileIndex fileindex.IFileIndex
+	events    events.IEventHub
+	webhooks  webhook.IWebhooks
+	auditor   audit.IAuditor
+	metrics   metrics.IMetrics
+	tracer    tracing.ITracer
 	db        db.IDBQuickshare
 }
 
@@ -92,6 +108,58 @@ func (deps *Deps) SiteStore() db.IConfigDB {
 	return deps.db
 }
 
+func (deps *Deps) Groups() db.IGroupDB {
+	return deps.db
+}
+
+func (deps *Deps) ACLs() db.IACLDB {
+	return deps.db
+}
+
+func (deps *Deps) APITokens() db.IAPITokenDB {
+	return deps.db
+}
+
+func (deps *Deps) Identities() db.IIdentityDB {
+	return deps.db
+}
+
+func (deps *Deps) Sessions() db.ISessionDB {
+	return deps.db
+}
+
+func (deps *Deps) MFA() db.IMFADB {
+	return deps.db
+}
+
+func (deps *Deps) Invites() db.IInviteDB {
+	return deps.db
+}
+
+func (deps *Deps) PwdResets() db.IPwdResetDB {
+	return deps.db
+}
+
+func (deps *Deps) QuotaPolicies() db.IQuotaPolicyDB {
+	return deps.db
+}
+
+func (deps *Deps) StorageStats() db.IStorageStatsDB {
+	return deps.db
+}
+
+func (deps *Deps) FileContents() db.IFileContentDB {
+	return deps.db
+}
+
+func (deps *Deps) FileChanges() db.IFileChangeDB {
+	return deps.db
+}
+
+func (deps *Deps) LoginAttempts() db.ILoginAttemptDB {
+	return deps.db
+}
+
 func (deps *Deps) Limiter() iolimiter.ILimiter {
 	return deps.limiter
 }
@@ -100,6 +168,30 @@ func (deps *Deps) SetLimiter(limiter iolimiter.ILimiter) {
 	deps.limiter = limiter
 }
 
+func (deps *Deps) LoginLimiter() loginlimiter.ILoginLimiter {
+	return deps.loginLim
+}
+
+func (deps *Deps) SetLoginLimiter(limiter loginlimiter.ILoginLimiter) {
+	deps.loginLim = limiter
+}
+
+func (deps *Deps) Mailer() mailer.IMailer {
+	return deps.mailer
+}
+
+func (deps *Deps) SetMailer(m mailer.IMailer) {
+	deps.mailer = m
+}
+
+func (deps *Deps) DiskGuard() diskguard.IDiskGuard {
+	return deps.diskGuard
+}
+
+func (deps *Deps) SetDiskGuard(guard diskguard.IDiskGuard) {
+	deps.diskGuard = guard
+}
+
 func (deps *Deps) Workers() worker.IWorkerPool {
 	return deps.workers
 }
@@ -108,6 +200,54 @@ func (deps *Deps) SetWorkers(workers worker.IWorkerPool) {
 	deps.workers = workers
 }
 
+func (deps *Deps) Events() events.IEventHub {
+	return deps.events
+}
+
+func (deps *Deps) SetEvents(hub events.IEventHub) {
+	deps.events = hub
+}
+
+func (deps *Deps) Webhooks() webhook.IWebhooks {
+	return deps.webhooks
+}
+
+func (deps *Deps) SetWebhooks(hooks webhook.IWebhooks) {
+	deps.webhooks = hooks
+}
+
+func (deps *Deps) WebhookStore() db.IWebhookDB {
+	return deps.db
+}
+
+func (deps *Deps) Auditor() audit.IAuditor {
+	return deps.auditor
+}
+
+func (deps *Deps) SetAuditor(auditor audit.IAuditor) {
+	deps.auditor = auditor
+}
+
+func (deps *Deps) Metrics() metrics.IMetrics {
+	return deps.metrics
+}
+
+func (deps *Deps) SetMetrics(m metrics.IMetrics) {
+	deps.metrics = m
+}
+
+func (deps *Deps) Tracer() tracing.ITracer {
+	return deps.tracer
+}
+
+func (deps *Deps) SetTracer(tracer tracing.ITracer) {
+	deps.tracer = tracer
+}
+
+func (deps *Deps) AuditLogs() db.IAuditLogDB {
+	return deps.db
+}
+
 func (deps *Deps) Cron() cron.ICron {
 	return deps.cron
 }
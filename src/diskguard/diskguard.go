@@ -0,0 +1,152 @@
+// Package diskguard watches free space of the volumes used by quickshare,
+// the site becomes read-only when the free space is low
+package diskguard
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLowSpace = errors.New("free disk space is low")
+	ErrReadOnly = errors.New("site is in read-only maintenance mode")
+)
+
+type IDiskGuard interface {
+	// CanWrite returns ErrLowSpace if writing size bytes leaves less free space than the threshold,
+	// or ErrReadOnly if the read-only mode is set by admins
+	CanWrite(size int64) error
+	// SetReadOnly switches the manual read-only maintenance mode
+	SetReadOnly(readOnly bool)
+	Status() *Status
+}
+
+type DiskStatus struct {
+	Path  string `json:"path"`
+	Free  uint64 `json:"free,string"`
+	Total uint64 `json:"total,string"`
+	Error string `json:"error,omitempty"`
+}
+
+type Status struct {
+	// ReadOnly is true if LowSpace or Maintenance is true
+	ReadOnly    bool          `json:"readOnly"`
+	LowSpace    bool          `json:"lowSpace"`
+	Maintenance bool          `json:"maintenance"`
+	MinFree     int64         `json:"minFree,string"`
+	Disks       []*DiskStatus `json:"disks"`
+	CheckedAt   int64         `json:"checkedAt,string"`
+}
+
+type Config struct {
+	// Paths are checked, e.g. the root of files and the folder of the db
+	Paths []string
+	// MinFree is the free space in bytes below which writes are refused, 0 disables checks
+	MinFree int64
+	// Interval is the minimum interval between checks
+	Interval time.Duration
+}
+
+type DiskGuard struct {
+	mtx         *sync.Mutex
+	cfg         *Config
+	maintenance bool
+	disks       []*DiskStatus
+	checkedAt   time.Time
+	lowSpace    bool
+	onChange    func(lowSpace bool)
+	freeSpace   func(path string) (uint64, uint64, error)
+	now         func() time.Time
+}
+
+// NewDiskGuard returns a guard, onChange is called when the site enters or leaves the low space state
+func NewDiskGuard(cfg *Config, onChange func(lowSpace bool)) *DiskGuard {
+	return &DiskGuard{
+		mtx:       &sync.Mutex{},
+		cfg:       cfg,
+		disks:     []*DiskStatus{},
+		onChange:  onChange,
+		freeSpace: freeSpace,
+		now:       time.Now,
+	}
+}
+
+// refresh checks disks if the last check is older than the interval, the lock must be held
+func (dg *DiskGuard) refresh() {
+	now := dg.now()
+	if !dg.checkedAt.IsZero() && now.Sub(dg.checkedAt) < dg.cfg.Interval {
+		return
+	}
+	dg.checkedAt = now
+
+	disks := []*DiskStatus{}
+	lowSpace := false
+	for _, diskPath := range dg.cfg.Paths {
+		free, total, err := dg.freeSpace(diskPath)
+		disk := &DiskStatus{Path: diskPath, Free: free, Total: total}
+		if err != nil {
+			disk.Error = err.Error()
+		} else if dg.cfg.MinFree > 0 && free < uint64(dg.cfg.MinFree) {
+			lowSpace = true
+		}
+		disks = append(disks, disk)
+	}
+	dg.disks = disks
+
+	if lowSpace != dg.lowSpace {
+		dg.lowSpace = lowSpace
+		if dg.onChange != nil {
+			dg.onChange(lowSpace)
+		}
+	}
+}
+
+func (dg *DiskGuard) CanWrite(size int64) error {
+	dg.mtx.Lock()
+	defer dg.mtx.Unlock()
+
+	dg.refresh()
+	if dg.maintenance {
+		return ErrReadOnly
+	} else if dg.lowSpace {
+		return ErrLowSpace
+	} else if dg.cfg.MinFree <= 0 || size <= 0 {
+		return nil
+	}
+
+	for _, disk := range dg.disks {
+		if disk.Error == "" && int64(disk.Free)-size < dg.cfg.MinFree {
+			return fmt.Errorf("%d bytes can not be written: %w", size, ErrLowSpace)
+		}
+	}
+	return nil
+}
+
+func (dg *DiskGuard) SetReadOnly(readOnly bool) {
+	dg.mtx.Lock()
+	defer dg.mtx.Unlock()
+
+	dg.maintenance = readOnly
+}
+
+func (dg *DiskGuard) Status() *Status {
+	dg.mtx.Lock()
+	defer dg.mtx.Unlock()
+
+	dg.refresh()
+	disks := []*DiskStatus{}
+	for _, disk := range dg.disks {
+		diskCopy := *disk
+		disks = append(disks, &diskCopy)
+	}
+	return &Status{
+		ReadOnly:    dg.lowSpace || dg.maintenance,
+		LowSpace:    dg.lowSpace,
+		Maintenance: dg.maintenance,
+		MinFree:     dg.cfg.MinFree,
+		Disks:       disks,
+		CheckedAt:   dg.checkedAt.Unix(),
+	}
+}
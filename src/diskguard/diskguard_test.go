@@ -0,0 +1,71 @@
+package diskguard
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiskGuard(t *testing.T) {
+	now := time.Unix(1000, 0)
+	free := map[string]uint64{"files": 1000, "db": 1000}
+	changes := []bool{}
+	dg := NewDiskGuard(&Config{
+		Paths:    []string{"files", "db"},
+		MinFree:  100,
+		Interval: 10 * time.Second,
+	}, func(lowSpace bool) {
+		changes = append(changes, lowSpace)
+	})
+	dg.now = func() time.Time { return now }
+	dg.freeSpace = func(diskPath string) (uint64, uint64, error) {
+		return free[diskPath], 2000, nil
+	}
+
+	t.Run("writes are refused if the free space is low", func(t *testing.T) {
+		if err := dg.CanWrite(800); err != nil {
+			t.Fatal(err)
+		}
+		if err := dg.CanWrite(901); !errors.Is(err, ErrLowSpace) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		// disks are checked again after the interval
+		free["db"] = 50
+		if err := dg.CanWrite(1); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * time.Second)
+		if err := dg.CanWrite(0); !errors.Is(err, ErrLowSpace) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		status := dg.Status()
+		if !status.ReadOnly || !status.LowSpace || status.Maintenance || len(status.Disks) != 2 || status.Disks[1].Free != 50 {
+			t.Fatalf("unexpected status %+v", status)
+		}
+
+		free["db"] = 1000
+		now = now.Add(10 * time.Second)
+		if err := dg.CanWrite(0); err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 2 || !changes[0] || changes[1] {
+			t.Fatalf("unexpected changes %+v", changes)
+		}
+	})
+
+	t.Run("writes are refused in maintenance", func(t *testing.T) {
+		dg.SetReadOnly(true)
+		if err := dg.CanWrite(0); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if status := dg.Status(); !status.ReadOnly || !status.Maintenance || status.LowSpace {
+			t.Fatalf("unexpected status %+v", status)
+		}
+
+		dg.SetReadOnly(false)
+		if err := dg.CanWrite(0); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
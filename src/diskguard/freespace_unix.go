@@ -0,0 +1,14 @@
+//go:build !windows
+
+package diskguard
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the free space available to unprivileged users and the total space in bytes
+func freeSpace(diskPath string) (uint64, uint64, error) {
+	stat := &unix.Statfs_t{}
+	if err := unix.Statfs(diskPath, stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
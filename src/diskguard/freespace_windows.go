@@ -0,0 +1,18 @@
+//go:build windows
+
+package diskguard
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the free space available to the caller and the total space in bytes
+func freeSpace(diskPath string) (uint64, uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(diskPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	var free, total, totalFree uint64
+	if err = windows.GetDiskFreeSpaceEx(pathPtr, &free, &total, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return free, total, nil
+}
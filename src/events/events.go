@@ -0,0 +1,178 @@
+// Package events pushes events to connected clients, e.g. through server-sent events,
+// events are only kept in memory so clients connected to other instances don't receive them
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// TypeUpload is the progress of an uploading file, it is sent to the uploader
+	TypeUpload = "upload"
+	// TypeJob is sent to the user when a background job is done, e.g. the sha1 of a file is generated
+	TypeJob = "job"
+	// TypeDirChange is sent to users viewing the folder when an item in it is changed
+	TypeDirChange = "dirChange"
+	// TypeBroadcast is sent to all users
+	TypeBroadcast = "broadcast"
+)
+
+// Target decides who receives an event, user IDs are never used as sentinels since the root admin's ID is 0
+type Target int
+
+const (
+	// TargetNone is the zero value, events without targets are dropped so that they are never leaked
+	TargetNone Target = iota
+	// TargetUser sends the event to the user of UserID
+	TargetUser
+	// TargetDir sends the event to users viewing the Dir
+	TargetDir
+	// TargetAll sends the event to all users
+	TargetAll
+)
+
+var (
+	ErrTooManySubscriptions = errors.New("too many event streams")
+	ErrClosed               = errors.New("event hub is closed")
+)
+
+type Event struct {
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	CreatedAt int64       `json:"createdAt,string"`
+	Target    Target      `json:"-"`
+	// UserID is used by TargetUser and Dir is used by TargetDir
+	UserID uint64 `json:"-"`
+	Dir    string `json:"-"`
+	// Path is the item of the event, e.g. streams limited to path prefixes drop events of other paths
+	Path string `json:"-"`
+}
+
+type IEventHub interface {
+	Publish(event *Event)
+	// Subscribe receives events of the user and events of the dirs
+	Subscribe(userID uint64, dirs []string) (*Subscription, error)
+	Unsubscribe(sub *Subscription)
+	// Close ends all subscriptions, e.g. streams are ended before the server shuts down
+	Close()
+}
+
+type Subscription struct {
+	userID uint64
+	dirs   map[string]bool
+	events chan *Event
+	closed bool
+}
+
+// Events returns the channel of events, it is closed if the subscriber is too slow to receive events
+func (sub *Subscription) Events() <-chan *Event {
+	return sub.events
+}
+
+func (sub *Subscription) matches(event *Event) bool {
+	switch event.Target {
+	case TargetUser:
+		return event.UserID == sub.userID
+	case TargetDir:
+		return sub.dirs[event.Dir]
+	case TargetAll:
+		return true
+	}
+	return false
+}
+
+type Config struct {
+	// BufferSize is the number of events which are not received yet by a subscriber
+	BufferSize int
+	// MaxPerUser is the maximum number of subscriptions of a user
+	MaxPerUser int
+}
+
+type EventHub struct {
+	mtx     *sync.Mutex
+	cfg     *Config
+	subs    map[*Subscription]bool
+	perUser map[uint64]int
+	closed  bool
+}
+
+func NewEventHub(cfg *Config) *EventHub {
+	return &EventHub{
+		mtx:     &sync.Mutex{},
+		cfg:     cfg,
+		subs:    map[*Subscription]bool{},
+		perUser: map[uint64]int{},
+	}
+}
+
+// Publish never blocks, subscribers with full buffers are dropped so that they could reconnect and reload
+func (hub *EventHub) Publish(event *Event) {
+	if event.CreatedAt == 0 {
+		event.CreatedAt = time.Now().Unix()
+	}
+
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+	for sub := range hub.subs {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			hub.unsubscribe(sub)
+		}
+	}
+}
+
+func (hub *EventHub) Subscribe(userID uint64, dirs []string) (*Subscription, error) {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	if hub.closed {
+		return nil, ErrClosed
+	} else if hub.perUser[userID] >= hub.cfg.MaxPerUser {
+		return nil, ErrTooManySubscriptions
+	}
+	sub := &Subscription{
+		userID: userID,
+		dirs:   map[string]bool{},
+		events: make(chan *Event, hub.cfg.BufferSize),
+	}
+	for _, dir := range dirs {
+		sub.dirs[dir] = true
+	}
+	hub.subs[sub] = true
+	hub.perUser[userID]++
+	return sub, nil
+}
+
+func (hub *EventHub) Unsubscribe(sub *Subscription) {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+	hub.unsubscribe(sub)
+}
+
+func (hub *EventHub) Close() {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+	hub.closed = true
+	for sub := range hub.subs {
+		hub.unsubscribe(sub)
+	}
+}
+
+func (hub *EventHub) unsubscribe(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+	delete(hub.subs, sub)
+	hub.perUser[sub.userID]--
+	if hub.perUser[sub.userID] <= 0 {
+		delete(hub.perUser, sub.userID)
+	}
+}
@@ -0,0 +1,128 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := NewEventHub(&Config{BufferSize: 2, MaxPerUser: 2})
+
+	received := func(sub *Subscription) []string {
+		types := []string{}
+		for {
+			select {
+			case event, ok := <-sub.Events():
+				if !ok {
+					return append(types, "closed")
+				}
+				types = append(types, event.Type)
+			default:
+				return types
+			}
+		}
+	}
+	assertTypes := func(t *testing.T, types []string, expected ...string) {
+		if len(types) != len(expected) {
+			t.Fatalf("events not matched %v %v", types, expected)
+		}
+		for i := range types {
+			if types[i] != expected[i] {
+				t.Fatalf("events not matched %v %v", types, expected)
+			}
+		}
+	}
+
+	t.Run("events are routed to users, folders or all", func(t *testing.T) {
+		sub1, err := hub.Subscribe(1, []string{"user1/files"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hub.Unsubscribe(sub1)
+		sub2, err := hub.Subscribe(2, []string{"user1/files/docs"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hub.Unsubscribe(sub2)
+
+		hub.Publish(&Event{Type: TypeUpload, Target: TargetUser, UserID: 1})
+		hub.Publish(&Event{Type: TypeDirChange, Target: TargetDir, Dir: "user1/files/docs"})
+		assertTypes(t, received(sub1), TypeUpload)
+		assertTypes(t, received(sub2), TypeDirChange)
+
+		hub.Publish(&Event{Type: TypeBroadcast, Target: TargetAll})
+		assertTypes(t, received(sub1), TypeBroadcast)
+		assertTypes(t, received(sub2), TypeBroadcast)
+	})
+
+	t.Run("events of the root admin are not sent to others", func(t *testing.T) {
+		adminSub, err := hub.Subscribe(0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hub.Unsubscribe(adminSub)
+		userSub, err := hub.Subscribe(1, []string{"user1/files"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hub.Unsubscribe(userSub)
+
+		hub.Publish(&Event{Type: TypeUpload, Target: TargetUser, UserID: 0})
+		hub.Publish(&Event{Type: TypeJob, Target: TargetUser, UserID: 0})
+		assertTypes(t, received(adminSub), TypeUpload, TypeJob)
+		assertTypes(t, received(userSub))
+
+		// events without targets are dropped
+		hub.Publish(&Event{Type: TypeJob})
+		assertTypes(t, received(adminSub))
+		assertTypes(t, received(userSub))
+	})
+
+	t.Run("slow subscribers are dropped", func(t *testing.T) {
+		sub, err := hub.Subscribe(1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			hub.Publish(&Event{Type: TypeJob, Target: TargetUser, UserID: 1})
+		}
+		assertTypes(t, received(sub), TypeJob, TypeJob, "closed")
+
+		// it is safe to unsubscribe again
+		hub.Unsubscribe(sub)
+	})
+
+	t.Run("subscriptions of a user are limited", func(t *testing.T) {
+		subs := []*Subscription{}
+		for i := 0; i < 2; i++ {
+			sub, err := hub.Subscribe(3, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			subs = append(subs, sub)
+		}
+		if _, err := hub.Subscribe(3, nil); !errors.Is(err, ErrTooManySubscriptions) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		hub.Unsubscribe(subs[0])
+		sub, err := hub.Subscribe(3, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hub.Unsubscribe(sub)
+		hub.Unsubscribe(subs[1])
+	})
+
+	t.Run("subscriptions are ended after closing", func(t *testing.T) {
+		sub, err := hub.Subscribe(1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hub.Close()
+		assertTypes(t, received(sub), "closed")
+		if _, err = hub.Subscribe(1, nil); !errors.Is(err, ErrClosed) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+}
@@ -128,6 +128,13 @@ func (fs *LocalFS) closeInfo(key string, info *fileInfo) error {
 	return nil
 }
 
+// Opens returns the count of opened descriptors (including readers) and its limit
+func (fs *LocalFS) Opens() (int, int) {
+	fs.opensMtx.RLock()
+	defer fs.opensMtx.RUnlock()
+	return len(fs.opens) + len(fs.readers), fs.opensLimit
+}
+
 func (fs *LocalFS) Sync() error {
 	fs.opensMtx.Lock()
 	defer fs.opensMtx.Unlock()
@@ -0,0 +1,122 @@
+package tracedfs
+
+import (
+	"context"
+	"os"
+
+	"github.com/ihexxa/quickshare/src/fs"
+	"github.com/ihexxa/quickshare/src/tracing"
+)
+
+// TracedFS records spans of calls as children of the span in ctx,
+// it is created per operation since ISimpleFS methods don't accept contexts
+type TracedFS struct {
+	ctx context.Context
+	fs  fs.ISimpleFS
+}
+
+func New(ctx context.Context, filesystem fs.ISimpleFS) fs.ISimpleFS {
+	if tracing.SpanFromContext(ctx) == nil {
+		return filesystem
+	}
+	return &TracedFS{ctx: ctx, fs: filesystem}
+}
+
+func (tfs *TracedFS) start(name, path string) *tracing.Span {
+	_, span := tracing.StartSpan(tfs.ctx, name)
+	span.SetAttr("fs.path", path)
+	return span
+}
+
+func end(span *tracing.Span, err error) {
+	span.SetError(err)
+	span.End()
+}
+
+func (tfs *TracedFS) Create(path string) error {
+	span := tfs.start("fs.Create", path)
+	err := tfs.fs.Create(path)
+	end(span, err)
+	return err
+}
+
+func (tfs *TracedFS) MkdirAll(path string) error {
+	span := tfs.start("fs.MkdirAll", path)
+	err := tfs.fs.MkdirAll(path)
+	end(span, err)
+	return err
+}
+
+func (tfs *TracedFS) Remove(path string) error {
+	span := tfs.start("fs.Remove", path)
+	err := tfs.fs.Remove(path)
+	end(span, err)
+	return err
+}
+
+func (tfs *TracedFS) Rename(oldpath, newpath string) error {
+	span := tfs.start("fs.Rename", oldpath)
+	span.SetAttr("fs.newPath", newpath)
+	err := tfs.fs.Rename(oldpath, newpath)
+	end(span, err)
+	return err
+}
+
+func (tfs *TracedFS) ReadAt(path string, b []byte, off int64) (int, error) {
+	span := tfs.start("fs.ReadAt", path)
+	n, err := tfs.fs.ReadAt(path, b, off)
+	span.SetAttr("fs.offset", off)
+	span.SetAttr("fs.bytes", n)
+	end(span, err)
+	return n, err
+}
+
+func (tfs *TracedFS) WriteAt(path string, b []byte, off int64) (int, error) {
+	span := tfs.start("fs.WriteAt", path)
+	n, err := tfs.fs.WriteAt(path, b, off)
+	span.SetAttr("fs.offset", off)
+	span.SetAttr("fs.bytes", n)
+	end(span, err)
+	return n, err
+}
+
+func (tfs *TracedFS) Stat(path string) (os.FileInfo, error) {
+	span := tfs.start("fs.Stat", path)
+	info, err := tfs.fs.Stat(path)
+	end(span, err)
+	return info, err
+}
+
+func (tfs *TracedFS) Close() error {
+	return tfs.fs.Close()
+}
+
+func (tfs *TracedFS) Sync() error {
+	span := tfs.start("fs.Sync", "")
+	err := tfs.fs.Sync()
+	end(span, err)
+	return err
+}
+
+// GetFileReader only traces opening the reader, reading is traced by callers (e.g. downloading)
+func (tfs *TracedFS) GetFileReader(path string) (fs.ReadCloseSeeker, uint64, error) {
+	span := tfs.start("fs.GetFileReader", path)
+	reader, id, err := tfs.fs.GetFileReader(path)
+	end(span, err)
+	return reader, id, err
+}
+
+func (tfs *TracedFS) CloseReader(id string) error {
+	return tfs.fs.CloseReader(id)
+}
+
+func (tfs *TracedFS) Root() string {
+	return tfs.fs.Root()
+}
+
+func (tfs *TracedFS) ListDir(path string) ([]os.FileInfo, error) {
+	span := tfs.start("fs.ListDir", path)
+	infos, err := tfs.fs.ListDir(path)
+	end(span, err)
+	return infos, err
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/audit"
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+// Audit records the action of the current user, it should be deferred
+// so that the result is decided by the status of the response
+func Audit(c *gin.Context, auditor audit.IAuditor, action, target, detail string) {
+	AuditAs(c, auditor, c.GetString(UserParam), action, target, detail)
+}
+
+// AuditAs records the action of the actor, e.g. the user logging in
+func AuditAs(c *gin.Context, auditor audit.IAuditor, actor, action, target, detail string) {
+	status := c.Writer.Status()
+	result := db.AuditResultSucceeded
+	if status >= 400 {
+		result = db.AuditResultFailed
+	}
+	record(c, auditor, actor, action, target, detail, result, status)
+}
+
+// AuditItem records an item of a batch action (e.g. a row of imports) of the current user,
+// the result is decided by err as items don't have their own responses
+func AuditItem(c *gin.Context, auditor audit.IAuditor, action, target, detail string, err error) {
+	result := db.AuditResultSucceeded
+	if err != nil {
+		result = db.AuditResultFailed
+	}
+	record(c, auditor, c.GetString(UserParam), action, target, detail, result, c.Writer.Status())
+}
+
+func record(c *gin.Context, auditor audit.IAuditor, actor, action, target, detail, result string, status int) {
+	auditor.Record(c, &db.AuditLog{
+		Actor:  actor,
+		IP:     c.ClientIP(),
+		Action: action,
+		Target: target,
+		Detail: detail,
+		Result: result,
+		Status: status,
+	})
+}
@@ -0,0 +1,158 @@
+package fileshdr
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	SubjectTypeQuery = "stype"
+	SubjectIDQuery   = "sid"
+)
+
+type SetACLReq struct {
+	Path        string `json:"path"`
+	SubjectType string `json:"subjectType"`
+	SubjectID   uint64 `json:"subjectID,string"`
+	Perm        string `json:"perm"`
+}
+
+// SetACL grants a user or a group access to a directory,
+// it is allowed for owners, admins and users with the manage permission
+func (h *FileHandlers) SetACL(c *gin.Context) {
+	req := &SetACLReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	userId, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	role := c.MustGet(q.RoleParam).(string)
+	userName := c.MustGet(q.UserParam).(string)
+	dirPath := filepath.Clean(req.Path)
+	if !h.canAccess(c, userId, userName, role, "acl", dirPath) {
+		c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
+		return
+	}
+	if req.SubjectType == db.ACLSubjectUser && req.SubjectID == db.VisitorID {
+		c.JSON(q.ErrResp(c, 400, errors.New("use sharing to grant visitors access")))
+		return
+	}
+
+	info, err := h.deps.FS().Stat(dirPath)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	} else if !info.IsDir() {
+		c.JSON(q.ErrResp(c, 400, errors.New("acls can only be set on directories")))
+		return
+	}
+
+	err = h.deps.ACLs().SetACL(c, &db.ACL{
+		Path:        dirPath,
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+		Perm:        req.Perm,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidACL) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrUserNotFound) || errors.Is(err, db.ErrGroupNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+func (h *FileHandlers) DelACL(c *gin.Context) {
+	dirPath := filepath.Clean(c.Query(FilePathQuery))
+	subjectType := c.Query(SubjectTypeQuery)
+	subjectId, err := strconv.ParseUint(c.Query(SubjectIDQuery), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid subject ID %w", err)))
+		return
+	}
+
+	userId, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	role := c.MustGet(q.RoleParam).(string)
+	userName := c.MustGet(q.UserParam).(string)
+	if !h.canAccess(c, userId, userName, role, "acl", dirPath) {
+		c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
+		return
+	}
+
+	err = h.deps.ACLs().DelACL(c, dirPath, subjectType, subjectId)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type ACLsResp struct {
+	ACLs []*db.ACL `json:"acls"`
+}
+
+func (h *FileHandlers) ListACLs(c *gin.Context) {
+	dirPath := filepath.Clean(c.Query(FilePathQuery))
+
+	userId, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	role := c.MustGet(q.RoleParam).(string)
+	userName := c.MustGet(q.UserParam).(string)
+	if !h.canAccess(c, userId, userName, role, "acl", dirPath) {
+		c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
+		return
+	}
+
+	acls, err := h.deps.ACLs().ListACLs(c, dirPath)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ACLsResp{ACLs: acls})
+}
+
+// ListSharedWithMe lists directories which are granted to the user or the user's groups
+func (h *FileHandlers) ListSharedWithMe(c *gin.Context) {
+	userId, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	acls, err := h.deps.ACLs().ListUserACLs(c, userId)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	// directories out of the api token's prefix are not listed
+	limitedACLs := []*db.ACL{}
+	for _, acl := range acls {
+		if inTokenPathPrefix(c, acl.Path) {
+			limitedACLs = append(limitedACLs, acl)
+		}
+	}
+	c.JSON(200, &ACLsResp{ACLs: limitedACLs})
+}
@@ -30,7 +30,8 @@ func (h *FileHandlers) genSha1(msg worker.IMsg) error {
 		return fmt.Errorf("fail to unmarshal sha1 msg: %w", err)
 	}
 
-	f, id, err := h.deps.FS().GetFileReader(taskInputs.FilePath)
+	ctx := worker.MsgContext(msg)
+	f, id, err := h.fs(ctx).GetFileReader(taskInputs.FilePath)
 	if err != nil {
 		return fmt.Errorf("fail to get reader: %s", err)
 	}
@@ -50,11 +51,12 @@ func (h *FileHandlers) genSha1(msg worker.IMsg) error {
 
 	sha1Sign := fmt.Sprintf("%x", hasher.Sum(nil))
 	err = h.deps.FileInfos().
-		SetSha1(context.TODO(), taskInputs.FilePath, sha1Sign) // TODO: use source context
+		SetSha1(ctx, taskInputs.FilePath, sha1Sign)
 	if err != nil {
 		return fmt.Errorf("fail to set sha1: %s", err)
 	}
 
+	h.publishJobDone(taskInputs.UserId, MsgTypeSha1, taskInputs.FilePath)
 	return nil
 }
 
@@ -77,23 +79,57 @@ func (h *FileHandlers) indexingItems(msg worker.IMsg) error {
 			return err
 		}
 
+		filePaths := []string{}
+		modTimes := map[string]int64{}
 		for _, fileInfo := range infos {
 			childPath := path.Join(pathname, fileInfo.Name())
 			if fileInfo.IsDir() {
 				queue = append(queue, childPath)
 			} else {
-				err = h.deps.FileIndex().AddPath(childPath)
-				if err != nil {
-					return err
+				filePaths = append(filePaths, childPath)
+				modTimes[childPath] = fileInfo.ModTime().UnixNano()
+				if h.contentIndexEnabled() {
+					// texts could be indexed before, e.g. files are replaced outside
+					err = h.indexFileContent(context.TODO(), childPath)
+					if err != nil {
+						h.deps.Log().Errorf("failed to index content: %s", err)
+					}
 				}
 			}
 		}
+		// files in the same folder are logged in a batch
+		err = h.deps.FileIndex().AddPaths(filePaths)
+		if err != nil {
+			return err
+		}
+		// mod times in the db are used by searching, e.g. files recorded before mod times are kept
+		err = h.deps.FileInfos().SetModTimes(context.TODO(), modTimes)
+		if err != nil {
+			return err
+		}
 	}
 
+	// the log of reindexing is compacted at once
+	err = h.deps.FileIndex().Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot file index: %w", err)
+	}
 	h.deps.Log().Info("reindexing done")
 	return nil
 }
 
+// snapshotFileIndex is run by cron, it is skipped if there is no change after the last snapshot
+func (h *FileHandlers) snapshotFileIndex() {
+	changes := h.deps.FileIndex().Changes()
+	if err := h.deps.FileIndex().Snapshot(); err != nil {
+		h.deps.Log().Errorf("failed to snapshot file index: %s", err)
+		return
+	}
+	if changes > 0 {
+		h.deps.Log().Infof("file index snapshotted with %d changes", changes)
+	}
+}
+
 const (
 	MsgTypeResetUsedSpace = "reset-used-space"
 )
@@ -130,5 +166,5 @@ func (h *FileHandlers) resetUsedSpace(msg worker.IMsg) error {
 		}
 	}
 
-	return h.deps.Users().ResetUsed(context.TODO(), params.UserID, usedSpace) // TODO: use source context
+	return h.deps.Users().ResetUsed(worker.MsgContext(msg), params.UserID, usedSpace)
 }
@@ -0,0 +1,165 @@
+package fileshdr
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+	// the longest waiting seconds of polling changes
+	maxChangesWait = 60
+	// changes are checked again periodically while waiting, in case they are made by other instances
+	changesRecheckInterval = 5 * time.Second
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor expired, please list folders again")
+)
+
+// changeNotifier wakes up waiting pollers after changes are recorded
+type changeNotifier struct {
+	mtx *sync.Mutex
+	ch  chan struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{
+		mtx: &sync.Mutex{},
+		ch:  make(chan struct{}),
+	}
+}
+
+func (n *changeNotifier) notify() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// wait returns a channel which is closed after the next change
+func (n *changeNotifier) wait() <-chan struct{} {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.ch
+}
+
+type ListChangesResp struct {
+	Changes []*db.FileChange `json:"changes"`
+	Cursor  string           `json:"cursor"`
+}
+
+// ListChanges returns changes of files which the user can list after the cursor in order,
+// an empty cursor returns no change but the current cursor, so clients list folders once and then poll changes from it.
+// If "wait" seconds are specified, the request is held until there are changes or it times out.
+// 410 is returned if changes after the cursor are cleaned, then clients should list folders again.
+func (h *FileHandlers) ListChanges(c *gin.Context) {
+	limit, err := getIntQuery(c, "limit", defaultChangesLimit, 1, maxChangesLimit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	wait, err := getIntQuery(c, "wait", 0, 0, maxChangesWait)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	first, last, err := h.deps.FileChanges().GetFileChangeSeqs(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	cursorStr := c.Query("cursor")
+	if cursorStr == "" {
+		c.JSON(200, &ListChangesResp{
+			Changes: []*db.FileChange{},
+			Cursor:  strconv.FormatUint(last, 10),
+		})
+		return
+	}
+	cursor, err := strconv.ParseUint(cursorStr, 10, 64)
+	if err != nil || cursor > last {
+		c.JSON(q.ErrResp(c, 400, ErrInvalidCursor))
+		return
+	} else if cursor+1 < first {
+		// changes after the cursor are removed, e.g. all changes are removed by retention
+		c.JSON(q.ErrResp(c, 410, ErrCursorExpired))
+		return
+	}
+
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	role := c.MustGet(q.RoleParam).(string)
+	userName := c.MustGet(q.UserParam).(string)
+
+	// admins can see all changes if they are not limited
+	var dirPaths []string
+	prefix, _ := c.Value(q.TokenPathPrefixParam).(string)
+	if role != db.AdminRole || prefix != "" {
+		dirPaths, err = h.searchRoots(c, userID, userName, role, nil)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 500, err))
+			return
+		}
+	}
+
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		// it must be taken before listing, or changes made in between are missed
+		changed := h.changes.wait()
+		changes, lastSeq, err := h.deps.FileChanges().ListFileChanges(c, cursor, dirPaths, limit)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 500, err))
+			return
+		}
+		cursor = lastSeq
+
+		remaining := time.Until(deadline)
+		if len(changes) > 0 || remaining <= 0 {
+			c.JSON(200, &ListChangesResp{
+				Changes: changes,
+				Cursor:  strconv.FormatUint(cursor, 10),
+			})
+			return
+		}
+		if remaining > changesRecheckInterval {
+			remaining = changesRecheckInterval
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// cleanFileChanges is run by cron, changes older than the kept days are removed
+func (h *FileHandlers) cleanFileChanges() {
+	keepDays := h.cfg.IntOr("Fs.ChangeKeepDays", 30)
+	if keepDays <= 0 {
+		return
+	}
+	before := time.Now().Unix() - int64(keepDays)*24*3600
+	if err := h.deps.FileChanges().DelFileChanges(context.TODO(), before); err != nil {
+		h.deps.Log().Errorf("failed to clean file changes: %s", err)
+	}
+}
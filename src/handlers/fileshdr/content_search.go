@@ -0,0 +1,181 @@
+package fileshdr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/search/filequery"
+	"github.com/ihexxa/quickshare/src/search/textextract"
+	"github.com/ihexxa/quickshare/src/worker"
+)
+
+const (
+	MsgTypeContentIndex = "content-index"
+
+	defaultContentIndexMaxSize = 16 * 1024 * 1024
+	// texts longer than it are truncated
+	maxContentTextLen = 1024 * 1024
+
+	defaultContentSearchLimit = 20
+	maxContentSearchLimit     = 100
+)
+
+type ContentIndexParams struct {
+	FilePath string
+}
+
+func (h *FileHandlers) contentIndexEnabled() bool {
+	return h.cfg.BoolOr("Fs.EnableContentIndex", true)
+}
+
+// putContentIndexing adds a job of extracting the file's text if the file type is supported
+func (h *FileHandlers) putContentIndexing(ctx context.Context, filePath string) error {
+	if !h.contentIndexEnabled() || !textextract.Supported(filePath) {
+		return nil
+	}
+
+	msg, err := json.Marshal(ContentIndexParams{FilePath: filePath})
+	if err != nil {
+		return err
+	}
+	return h.deps.Workers().TryPut(h.newMsg(ctx, MsgTypeContentIndex, string(msg)))
+}
+
+func (h *FileHandlers) indexContent(msg worker.IMsg) error {
+	params := &ContentIndexParams{}
+	err := json.Unmarshal([]byte(msg.Body()), params)
+	if err != nil {
+		return fmt.Errorf("fail to unmarshal content index msg: %w", err)
+	}
+	return h.indexFileContent(worker.MsgContext(msg), params.FilePath)
+}
+
+// indexFileContent extracts the text of the file and saves it, unsupported or large files are skipped
+func (h *FileHandlers) indexFileContent(ctx context.Context, filePath string) error {
+	if !textextract.Supported(filePath) {
+		return nil
+	}
+	maxSize := h.cfg.IntOr("Fs.ContentIndexMaxSize", defaultContentIndexMaxSize)
+	if maxSize <= 0 {
+		maxSize = defaultContentIndexMaxSize
+	}
+
+	info, err := h.fs(ctx).Stat(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// it is removed before indexing
+			return nil
+		}
+		return err
+	} else if info.IsDir() || info.Size() == 0 || info.Size() > int64(maxSize) {
+		return nil
+	}
+
+	f, id, err := h.fs(ctx).GetFileReader(filePath)
+	if err != nil {
+		return fmt.Errorf("fail to get reader: %w", err)
+	}
+	defer func() {
+		err := h.deps.FS().CloseReader(fmt.Sprint(id))
+		if err != nil {
+			h.deps.Log().Errorf("failed to close file: %s", err)
+		}
+	}()
+
+	content, err := io.ReadAll(io.LimitReader(f, int64(maxSize)))
+	if err != nil {
+		return fmt.Errorf("fail to read file: %w", err)
+	}
+	text, err := textextract.Extract(path.Base(filePath), content, maxContentTextLen)
+	if err != nil {
+		if errors.Is(err, textextract.ErrUnsupported) {
+			return nil
+		}
+		return fmt.Errorf("fail to extract text of %s: %w", filePath, err)
+	}
+	return h.deps.FileContents().SetFileContent(ctx, filePath, text)
+}
+
+// ContentSearchResult is a matched file, matched terms in the html-escaped snippet are wrapped by <mark>
+type ContentSearchResult struct {
+	Path    string  `json:"path"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+type SearchContentsResp struct {
+	Results []*ContentSearchResult `json:"results"`
+}
+
+// SearchContents searches texts of documents which the user can list, better matches are listed first,
+// the "q" query contains words, quoted phrases or prefixes (e.g. budg*), results could be limited in folders by "in"
+func (h *FileHandlers) SearchContents(c *gin.Context) {
+	queryStr := strings.TrimSpace(c.Query("q"))
+	if queryStr == "" {
+		c.JSON(q.ErrResp(c, 400, errors.New("empty query")))
+		return
+	}
+	limit, err := getIntQuery(c, "limit", defaultContentSearchLimit, 1, maxContentSearchLimit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	scopes := []string{}
+	for _, val := range c.QueryArray("in") {
+		scope, err := filequery.ParseScope(val)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 400, err))
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	role := c.MustGet(q.RoleParam).(string)
+	userName := c.MustGet(q.UserParam).(string)
+
+	// admins can search all files if they are not limited
+	var dirPaths []string
+	prefix, _ := c.Value(q.TokenPathPrefixParam).(string)
+	if role != db.AdminRole || prefix != "" || len(scopes) > 0 {
+		dirPaths, err = h.searchRoots(c, userID, userName, role, scopes)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 500, err))
+			return
+		}
+	}
+
+	matches, err := h.deps.FileContents().SearchFileContents(c, queryStr, dirPaths, limit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	results := []*ContentSearchResult{}
+	for _, match := range matches {
+		snippet := html.EscapeString(match.Snippet)
+		snippet = strings.ReplaceAll(snippet, db.SnippetMatchStart, "<mark>")
+		snippet = strings.ReplaceAll(snippet, db.SnippetMatchEnd, "</mark>")
+		results = append(results, &ContentSearchResult{
+			Path:    match.Path,
+			Snippet: snippet,
+			Score:   match.Score,
+		})
+	}
+	c.JSON(200, &SearchContentsResp{Results: results})
+}
@@ -0,0 +1,225 @@
+package fileshdr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/search/filequery"
+)
+
+const (
+	// listings are refreshed after the TTL, e.g. files in the folder are overwritten outside quickshare
+	// which doesn't change the folder's mtime
+	dirListingTTL = 5 * time.Minute
+	// folders modified recently are not cached, or changes in the same tick of the mtime would be missed
+	dirListingSettle = 2 * time.Second
+)
+
+// dirListing is a snapshot of a folder's items, it is not changed after it is created except its sorted views
+type dirListing struct {
+	modTime  time.Time
+	listedAt time.Time
+	usedAt   time.Time
+	// sizes of sub folders are their total sizes in dirStats
+	items    []*filequery.Item
+	dirStats map[string]*db.DirStat
+
+	mtx   *sync.Mutex
+	views map[string][]*filequery.Item
+}
+
+func newDirListing(dirPath string, modTime time.Time, infos []os.FileInfo, dirStats map[string]*db.DirStat) *dirListing {
+	items := make([]*filequery.Item, 0, len(infos))
+	for _, info := range infos {
+		item := &filequery.Item{
+			Path:    filepath.Join(dirPath, info.Name()),
+			Name:    info.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		}
+		items = append(items, item)
+	}
+	return newDirListingOf(modTime, time.Now(), items, dirStats)
+}
+
+func newDirListingOf(modTime, listedAt time.Time, items []*filequery.Item, dirStats map[string]*db.DirStat) *dirListing {
+	for i, item := range items {
+		if !item.IsDir {
+			continue
+		}
+		size := int64(0)
+		if stat, ok := dirStats[item.Path]; ok {
+			size = stat.Size
+		}
+		if item.Size != size {
+			// items could be shared with other listings, so they are copied before changing
+			dirItem := *item
+			dirItem.Size = size
+			items[i] = &dirItem
+		}
+	}
+	return &dirListing{
+		modTime:  modTime,
+		listedAt: listedAt,
+		items:    items,
+		dirStats: dirStats,
+		mtx:      &sync.Mutex{},
+		views:    map[string][]*filequery.Item{},
+	}
+}
+
+// withDirStats returns a listing with new sizes of sub folders without listing the folder again
+func (listing *dirListing) withDirStats(dirStats map[string]*db.DirStat) *dirListing {
+	items := make([]*filequery.Item, len(listing.items))
+	copy(items, listing.items)
+	return newDirListingOf(listing.modTime, listing.listedAt, items, dirStats)
+}
+
+// view returns items of the type ("file", "dir" or "" for all) sorted by the key, views are kept for next pages
+func (listing *dirListing) view(itemType, sortBy string, desc bool) ([]*filequery.Item, error) {
+	key := fmt.Sprintf("%s:%s:%t", itemType, sortBy, desc)
+
+	listing.mtx.Lock()
+	defer listing.mtx.Unlock()
+	if view, ok := listing.views[key]; ok {
+		return view, nil
+	}
+
+	view := make([]*filequery.Item, 0, len(listing.items))
+	for _, item := range listing.items {
+		if (itemType == "file" && item.IsDir) || (itemType == "dir" && !item.IsDir) {
+			continue
+		}
+		view = append(view, item)
+	}
+	if err := filequery.Sort(view, sortBy, desc); err != nil {
+		return nil, err
+	}
+	listing.views[key] = view
+	return view, nil
+}
+
+func sameDirStats(stats1, stats2 map[string]*db.DirStat) bool {
+	if len(stats1) != len(stats2) {
+		return false
+	}
+	for dirPath, stat1 := range stats1 {
+		stat2, ok := stats2[dirPath]
+		if !ok || stat1.Size != stat2.Size || stat1.FileCount != stat2.FileCount {
+			return false
+		}
+	}
+	return true
+}
+
+// dirListings caches listings of large folders so that pages of them don't list and sort the whole folder,
+// a listing is valid while the folder's mtime is not changed, and it is removed when items are changed through handlers
+type dirListings struct {
+	mtx      *sync.Mutex
+	minItems int
+	maxItems int
+	items    int
+	listings map[string]*dirListing
+}
+
+func newDirListings(minItems, maxItems int) *dirListings {
+	return &dirListings{
+		mtx:      &sync.Mutex{},
+		minItems: minItems,
+		maxItems: maxItems,
+		listings: map[string]*dirListing{},
+	}
+}
+
+// get returns the cached listing or nil if it is missing or stale,
+// the listing is refreshed with dirStats if only sizes of sub folders are changed
+func (dl *dirListings) get(dirPath string, modTime time.Time, dirStats map[string]*db.DirStat) *dirListing {
+	dl.mtx.Lock()
+	defer dl.mtx.Unlock()
+
+	listing, ok := dl.listings[dirPath]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if !listing.modTime.Equal(modTime) || now.Sub(listing.listedAt) > dirListingTTL {
+		dl.remove(dirPath)
+		return nil
+	}
+	if !sameDirStats(listing.dirStats, dirStats) {
+		listing = listing.withDirStats(dirStats)
+		dl.listings[dirPath] = listing
+	}
+	listing.usedAt = now
+	return listing
+}
+
+func (dl *dirListings) put(dirPath string, listing *dirListing) {
+	size := len(listing.items)
+	if size < dl.minItems || size > dl.maxItems || time.Since(listing.modTime) < dirListingSettle {
+		return
+	}
+
+	dl.mtx.Lock()
+	defer dl.mtx.Unlock()
+	dl.remove(dirPath)
+	// the least recently used listings are evicted
+	for dl.items+size > dl.maxItems {
+		lruPath := ""
+		var lruAt time.Time
+		for cachedPath, cached := range dl.listings {
+			if lruPath == "" || cached.usedAt.Before(lruAt) {
+				lruPath, lruAt = cachedPath, cached.usedAt
+			}
+		}
+		dl.remove(lruPath)
+	}
+
+	listing.usedAt = time.Now()
+	dl.listings[dirPath] = listing
+	dl.items += size
+}
+
+// invalidate removes the listing of the folder, it is called when items in the folder are changed
+func (dl *dirListings) invalidate(dirPath string) {
+	dl.mtx.Lock()
+	defer dl.mtx.Unlock()
+	dl.remove(dirPath)
+}
+
+func (dl *dirListings) remove(dirPath string) {
+	if listing, ok := dl.listings[dirPath]; ok {
+		dl.items -= len(listing.items)
+		delete(dl.listings, dirPath)
+	}
+}
+
+// getDirListing lists the folder or returns its cached listing
+func (h *FileHandlers) getDirListing(ctx context.Context, dirPath string) (*dirListing, error) {
+	filesystem := h.fs(ctx)
+	info, err := filesystem.Stat(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	dirStats, err := h.deps.FileInfos().ListDirStats(ctx, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if listing := h.listings.get(dirPath, info.ModTime(), dirStats); listing != nil {
+		return listing, nil
+	}
+
+	infos, err := filesystem.ListDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	listing := newDirListing(dirPath, info.ModTime(), infos, dirStats)
+	h.listings.put(dirPath, listing)
+	return listing, nil
+}
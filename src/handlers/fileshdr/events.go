@@ -0,0 +1,229 @@
+package fileshdr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/events"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	// comments are sent periodically so that proxies don't close idle streams,
+	// the session and the user are also rechecked in each heartbeat
+	defaultEventsHeartbeat = 30
+	maxEventDirs           = 16
+)
+
+type DirChangeEvent struct {
+	Op      string `json:"op"`
+	Path    string `json:"path"`
+	NewPath string `json:"newPath,omitempty"`
+}
+
+type JobEvent struct {
+	Job  string `json:"job"`
+	Path string `json:"path"`
+}
+
+// fileChanged wakes up pollers of changes, drops cached listings of the parent folders
+// and pushes the change to users viewing the parent folders
+func (h *FileHandlers) fileChanged(op, itemPath, newPath string) {
+	h.changes.notify()
+
+	event := &DirChangeEvent{Op: op, Path: itemPath, NewPath: newPath}
+	dirPath := path.Dir(itemPath)
+	h.listings.invalidate(dirPath)
+	if newPath != "" {
+		h.listings.invalidate(path.Dir(newPath))
+	}
+	h.deps.Events().Publish(&events.Event{Type: events.TypeDirChange, Target: events.TargetDir, Dir: dirPath, Data: event})
+	if newPath != "" && path.Dir(newPath) != dirPath {
+		h.deps.Events().Publish(&events.Event{Type: events.TypeDirChange, Target: events.TargetDir, Dir: path.Dir(newPath), Data: event})
+	}
+}
+
+// Events streams events of the user as server-sent events, folders being viewed are specified by one or more "dp".
+// The stream ends when the token expires, the session is revoked, the user's role is changed,
+// or the client is too slow to receive events, then the client could reconnect.
+func (h *FileHandlers) Events(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	role := c.MustGet(q.RoleParam).(string)
+	userName := c.MustGet(q.UserParam).(string)
+
+	dirPaths := c.QueryArray(ListDirQuery)
+	if len(dirPaths) > maxEventDirs {
+		c.JSON(q.ErrResp(c, 400, errors.New("too many folders")))
+		return
+	}
+	for i, dirPath := range dirPaths {
+		dirPaths[i] = filepath.Clean(dirPath)
+		if !h.canAccess(c, userID, userName, role, "list", dirPaths[i]) {
+			c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
+			return
+		}
+	}
+
+	// tokens without expiration (e.g. auth is disabled) never end the stream
+	var expired <-chan time.Time
+	if expire, err := strconv.ParseInt(c.MustGet(q.ExpireParam).(string), 10, 64); err == nil && expire > 0 {
+		timer := time.NewTimer(time.Until(time.Unix(expire, 0)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	sub, err := h.deps.Events().Subscribe(userID, dirPaths)
+	if err != nil {
+		if errors.Is(err, events.ErrTooManySubscriptions) {
+			c.JSON(q.ErrResp(c, 429, err))
+			return
+		} else if errors.Is(err, events.ErrClosed) {
+			c.JSON(q.ErrResp(c, 503, err))
+			return
+		}
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	defer h.deps.Events().Unsubscribe(sub)
+
+	heartbeatSecs := h.cfg.IntOr("Server.EventsHeartbeat", defaultEventsHeartbeat)
+	if heartbeatSecs <= 0 {
+		heartbeatSecs = defaultEventsHeartbeat
+	}
+	heartbeat := time.NewTicker(time.Duration(heartbeatSecs) * time.Second)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	// headers are flushed with the first comment so that clients know the stream is ready
+	io.WriteString(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return false
+			}
+			if !eventInTokenPathPrefix(c, event) {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-heartbeat.C:
+			if !h.streamAlive(c, userID, role) {
+				return false
+			}
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-expired:
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// eventInTokenPathPrefix checks if the event is about a path under the api token's prefix, broadcasts are always sent
+func eventInTokenPathPrefix(c *gin.Context, event *events.Event) bool {
+	switch event.Target {
+	case events.TargetAll:
+		return true
+	case events.TargetDir:
+		return inTokenPathPrefix(c, event.Dir)
+	}
+	return inTokenPathPrefix(c, event.Path)
+}
+
+// streamAlive checks if the stream could continue since checks in middlewares only happen when it is opened,
+// while the session or the API token could be revoked, and the user could be deleted, banned or assigned another role
+func (h *FileHandlers) streamAlive(c *gin.Context, userID uint64, role string) bool {
+	if sessionID := c.GetString(q.SessionIDParam); sessionID != "" {
+		session, err := h.deps.Sessions().GetSession(c, sessionID)
+		if err != nil {
+			if !errors.Is(err, db.ErrSessionNotFound) {
+				h.deps.Log().Errorf("streamAlive: get session error: %s", err)
+			}
+			return false
+		} else if session.UserID != userID || session.ExpireAt <= time.Now().Unix() {
+			return false
+		}
+	} else if tokenID := c.GetString(q.APITokenIDParam); tokenID != "" {
+		tokens, err := h.deps.APITokens().ListAPITokens(c, userID)
+		if err != nil {
+			h.deps.Log().Errorf("streamAlive: list api tokens error: %s", err)
+			return false
+		}
+		found := false
+		for _, token := range tokens {
+			found = found || fmt.Sprint(token.ID) == tokenID
+		}
+		if !found {
+			return false
+		}
+	}
+
+	user, err := h.deps.Users().GetUser(c, userID)
+	if err != nil {
+		if !errors.Is(err, db.ErrUserNotFound) {
+			h.deps.Log().Errorf("streamAlive: get user error: %s", err)
+		}
+		return false
+	}
+	return user.Role == role
+}
+
+type BroadcastReq struct {
+	Message string `json:"message"`
+}
+
+type BroadcastEvent struct {
+	Message string `json:"message"`
+	From    string `json:"from"`
+}
+
+// Broadcast sends the message to all connected users, e.g. notices of maintenance
+func (h *FileHandlers) Broadcast(c *gin.Context) {
+	req := &BroadcastReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	} else if req.Message == "" {
+		c.JSON(q.ErrResp(c, 400, errors.New("empty message")))
+		return
+	}
+
+	h.deps.Events().Publish(&events.Event{
+		Type:   events.TypeBroadcast,
+		Target: events.TargetAll,
+		Data: &BroadcastEvent{
+			Message: req.Message,
+			From:    c.MustGet(q.UserParam).(string),
+		},
+	})
+	c.JSON(q.Resp(200))
+}
+
+func (h *FileHandlers) publishJobDone(userID uint64, job, filePath string) {
+	h.deps.Events().Publish(&events.Event{
+		Type:   events.TypeJob,
+		Target: events.TargetUser,
+		UserID: userID,
+		Path:   filePath,
+		Data:   &JobEvent{Job: job, Path: filePath},
+	})
+}
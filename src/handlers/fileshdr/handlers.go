@@ -21,8 +21,12 @@ import (
 	"github.com/ihexxa/fsearch"
 	"github.com/ihexxa/quickshare/src/db"
 	"github.com/ihexxa/quickshare/src/depidx"
+	"github.com/ihexxa/quickshare/src/events"
 	q "github.com/ihexxa/quickshare/src/handlers"
-	"github.com/ihexxa/quickshare/src/worker/localworker"
+	"github.com/ihexxa/quickshare/src/mailer"
+	"github.com/ihexxa/quickshare/src/metrics"
+	"github.com/ihexxa/quickshare/src/search/filequery"
+	"github.com/ihexxa/quickshare/src/tracing"
 )
 
 const (
@@ -44,6 +48,8 @@ type FileHandlers struct {
 	cfg         gocfg.ICfg
 	deps        *depidx.Deps
 	lockedPaths *sync.Map
+	changes     *changeNotifier
+	listings    *dirListings
 }
 
 func NewFileHandlers(cfg gocfg.ICfg, deps *depidx.Deps) (*FileHandlers, error) {
@@ -51,10 +57,34 @@ func NewFileHandlers(cfg gocfg.ICfg, deps *depidx.Deps) (*FileHandlers, error) {
 		cfg:         cfg,
 		deps:        deps,
 		lockedPaths: &sync.Map{},
+		changes:     newChangeNotifier(),
+		listings: newDirListings(
+			cfg.IntOr("Fs.ListingCacheMin", 1000),
+			cfg.IntOr("Fs.ListingCacheItems", 500000),
+		),
 	}
 	deps.Workers().AddHandler(MsgTypeSha1, handlers.genSha1)
 	deps.Workers().AddHandler(MsgTypeIndexing, handlers.indexingItems)
 	deps.Workers().AddHandler(MsgTypeResetUsedSpace, handlers.resetUsedSpace)
+	deps.Workers().AddHandler(MsgTypeContentIndex, handlers.indexContent)
+
+	snapshotSpec := cfg.StringOr("Fs.StorageSnapshotSpec", "@daily")
+	if snapshotSpec == "" {
+		snapshotSpec = "@daily"
+	}
+	if err := deps.Cron().AddFun(snapshotSpec, handlers.takeStorageSnapshots); err != nil {
+		return nil, fmt.Errorf("invalid storage snapshot spec %s: %w", snapshotSpec, err)
+	}
+	indexSnapshotSpec := cfg.StringOr("Fs.FileIndexSnapshotSpec", "@hourly")
+	if indexSnapshotSpec == "" {
+		indexSnapshotSpec = "@hourly"
+	}
+	if err := deps.Cron().AddFun(indexSnapshotSpec, handlers.snapshotFileIndex); err != nil {
+		return nil, fmt.Errorf("invalid file index snapshot spec %s: %w", indexSnapshotSpec, err)
+	}
+	if err := deps.Cron().AddFun("@daily", handlers.cleanFileChanges); err != nil {
+		return nil, err
+	}
 
 	return handlers, nil
 }
@@ -83,10 +113,21 @@ func (h *FileHandlers) lock(key string, code *int, err *error, execution func()
 
 // related elements: role, user, action(listing, downloading)/sharing
 func (h *FileHandlers) canAccess(ctx context.Context, userId uint64, userName, role, op, accessingPath string) bool {
+	if !inTokenPathPrefix(ctx, accessingPath) {
+		return false
+	}
+
 	if role == db.AdminRole {
 		return true
 	}
 
+	// team folders: _groups/<groupName>/...
+	if groupName, ok := db.GroupOfPath(accessingPath); ok {
+		if h.canAccessGroup(ctx, userId, groupName, op, accessingPath) {
+			return true
+		}
+	}
+
 	// the file path must start with userName: <userName>/...
 	parts := strings.Split(accessingPath, "/")
 	if len(parts) < 2 { // the path must be longer than <userName>/files
@@ -95,6 +136,16 @@ func (h *FileHandlers) canAccess(ctx context.Context, userId uint64, userName, r
 		return true
 	}
 
+	// check if it is granted by acls
+	if userId != db.VisitorID {
+		perm, err := h.deps.ACLs().GetUserPerm(ctx, userId, accessingPath)
+		if err != nil {
+			h.deps.Log().Errorf("canAccess: get acl perm error: %s", err)
+		} else if aclAllows(perm, op) {
+			return true
+		}
+	}
+
 	// check if it is shared
 	// TODO: find a better approach
 	if op != "list" && op != "download" {
@@ -108,6 +159,50 @@ func (h *FileHandlers) canAccess(ctx context.Context, userId uint64, userName, r
 	return isSharing
 }
 
+// inTokenPathPrefix checks if the path is under the prefix which api tokens may be limited to
+func inTokenPathPrefix(ctx context.Context, accessingPath string) bool {
+	prefix, ok := ctx.Value(q.TokenPathPrefixParam).(string)
+	if !ok || prefix == "" {
+		return true
+	}
+	return accessingPath == prefix || strings.HasPrefix(accessingPath, prefix+"/")
+}
+
+// canAccessGroup checks the member's permission on the team folder
+func (h *FileHandlers) canAccessGroup(ctx context.Context, userId uint64, groupName, op, accessingPath string) bool {
+	group, err := h.deps.Groups().GetGroupByName(ctx, groupName)
+	if err != nil {
+		return false
+	}
+	member, err := h.deps.Groups().GetGroupMember(ctx, group.ID, userId)
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case "list", "download", "metadata", "hash.gen":
+		return member.Perm == db.GroupPermRead || member.Perm == db.GroupPermWrite
+	case "acl":
+		// acls in team folders are managed by admins
+		return false
+	}
+	// the team folder itself can not be modified: _groups/<groupName>
+	parts := strings.Split(accessingPath, "/")
+	return member.Perm == db.GroupPermWrite && len(parts) >= 3 && parts[2] != ""
+}
+
+// aclAllows checks if the perm granted by acls allows the op
+func aclAllows(perm, op string) bool {
+	level := db.ACLPermLevel(perm)
+	switch op {
+	case "list", "download", "metadata", "hash.gen":
+		return level >= db.ACLPermLevel(db.ACLPermRead)
+	case "acl", "":
+		return level >= db.ACLPermLevel(db.ACLPermManage)
+	}
+	return level >= db.ACLPermLevel(db.ACLPermWrite)
+}
+
 type CreateReq struct {
 	Path     string `json:"path"`
 	FileSize int64  `json:"fileSize"`
@@ -135,6 +230,7 @@ func (h *FileHandlers) Create(c *gin.Context) {
 		}
 		return
 	}
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionUpload, fsFilePath, fmt.Sprintf("size=%d", req.FileSize))
 
 	role := c.MustGet(q.RoleParam).(string)
 	userName := c.MustGet(q.UserParam).(string)
@@ -143,6 +239,11 @@ func (h *FileHandlers) Create(c *gin.Context) {
 		return
 	}
 
+	if err = h.deps.DiskGuard().CanWrite(req.FileSize); err != nil {
+		c.JSON(q.ErrResp(c, quotaErrCode(err), err))
+		return
+	}
+
 	infoId := h.deps.ID().Gen()
 	tmpFilePath := q.UploadPath(userName, fsFilePath)
 	if req.FileSize == 0 {
@@ -151,11 +252,7 @@ func (h *FileHandlers) Create(c *gin.Context) {
 			Size: req.FileSize,
 		})
 		if err != nil {
-			if errors.Is(err, db.ErrQuota) {
-				c.JSON(q.ErrResp(c, 403, err))
-			} else {
-				c.JSON(q.ErrResp(c, 500, err))
-			}
+			c.JSON(q.ErrResp(c, quotaErrCode(err), err))
 			return
 		}
 
@@ -166,14 +263,15 @@ func (h *FileHandlers) Create(c *gin.Context) {
 			c.JSON(q.ErrResp(c, 500, err))
 			return
 		}
+		h.fileChanged(db.FileChangeUpload, fsFilePath, "")
 
-		err = h.deps.FS().MkdirAll(filepath.Dir(fsFilePath))
+		err = h.fs(c).MkdirAll(filepath.Dir(fsFilePath))
 		if err != nil {
 			c.JSON(q.ErrResp(c, 500, err))
 			return
 		}
 
-		err = h.deps.FS().Create(fsFilePath)
+		err = h.fs(c).Create(fsFilePath)
 		if err != nil {
 			if os.IsExist(err) {
 				c.JSON(q.ErrResp(c, 304, fmt.Errorf("file(%s) exists", fsFilePath)))
@@ -192,13 +290,7 @@ func (h *FileHandlers) Create(c *gin.Context) {
 			return
 		}
 
-		err = h.deps.Workers().TryPut(
-			localworker.NewMsg(
-				h.deps.ID().Gen(),
-				map[string]string{localworker.MsgTypeKey: MsgTypeSha1},
-				string(msg),
-			),
-		)
+		err = h.deps.Workers().TryPut(h.newMsg(c, MsgTypeSha1, string(msg)))
 		if err != nil {
 			c.JSON(q.ErrResp(c, 500, err))
 			return
@@ -210,6 +302,11 @@ func (h *FileHandlers) Create(c *gin.Context) {
 			return
 		}
 
+		h.notifyOwner(c, userName, mailer.TmplUploaded, fsFilePath)
+		h.fireFileWebhooks(c, db.WebhookEventFileUploaded, userID, &FileWebhookData{
+			Path:  fsFilePath,
+			Actor: userName,
+		})
 		c.JSON(q.Resp(200))
 		return
 	}
@@ -218,17 +315,14 @@ func (h *FileHandlers) Create(c *gin.Context) {
 		Size: req.FileSize,
 	})
 	if err != nil {
-		if errors.Is(err, db.ErrQuota) {
-			c.JSON(q.ErrResp(c, 403, err))
-		} else {
-			c.JSON(q.ErrResp(c, 500, err))
-		}
+		c.JSON(q.ErrResp(c, quotaErrCode(err), err))
 		return
 	}
+	h.warnQuota(c, userID, fsFilePath, req.FileSize)
 
 	var code int
 	h.lock(lockName(tmpFilePath), &code, &err, func() (int, error) {
-		err := h.deps.FS().Create(tmpFilePath)
+		err := h.fs(c).Create(tmpFilePath)
 		if err != nil {
 			if os.IsExist(err) {
 				createErr := fmt.Errorf("file(%s) exists", tmpFilePath)
@@ -237,7 +331,7 @@ func (h *FileHandlers) Create(c *gin.Context) {
 			return 500, err
 		}
 
-		err = h.deps.FS().MkdirAll(filepath.Dir(req.Path))
+		err = h.fs(c).MkdirAll(filepath.Dir(req.Path))
 		if err != nil {
 			return 500, err
 		}
@@ -257,6 +351,7 @@ func (h *FileHandlers) Delete(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 400, errors.New("invalid file path")))
 		return
 	}
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionDelete, filePath, "")
 
 	userId, err := q.GetUserId(c)
 	if err != nil {
@@ -275,7 +370,7 @@ func (h *FileHandlers) Delete(c *gin.Context) {
 	// locker := h.NewAutoLocker(c, lockName(filePath))
 	var code int
 	h.lock(lockName(filePath), &code, &err, func() (int, error) {
-		err := h.deps.FS().Remove(filePath)
+		err := h.fs(c).Remove(filePath)
 		if err != nil {
 			return 500, err
 		}
@@ -284,6 +379,7 @@ func (h *FileHandlers) Delete(c *gin.Context) {
 		if err != nil {
 			return 500, err
 		}
+		h.fileChanged(db.FileChangeDelete, filePath, "")
 
 		err = h.deps.FileIndex().DelPath(filePath)
 		if err != nil && !errors.Is(err, fsearch.ErrNotFound) {
@@ -295,6 +391,10 @@ func (h *FileHandlers) Delete(c *gin.Context) {
 		c.JSON(q.ErrResp(c, code, err))
 		return
 	}
+	h.fireFileWebhooks(c, db.WebhookEventFileDeleted, userId, &FileWebhookData{
+		Path:  filePath,
+		Actor: userName,
+	})
 	c.JSON(q.Resp(200))
 }
 
@@ -304,6 +404,8 @@ type MetadataResp struct {
 	ModTime time.Time `json:"modTime"`
 	IsDir   bool      `json:"isDir"`
 	Sha1    string    `json:"sha1"`
+	// FileCount is the number of files in the folder and its sub folders
+	FileCount int64 `json:"fileCount,omitempty"`
 }
 
 func (h *FileHandlers) Metadata(c *gin.Context) {
@@ -327,7 +429,7 @@ func (h *FileHandlers) Metadata(c *gin.Context) {
 		return
 	}
 
-	info, err := h.deps.FS().Stat(filePath)
+	info, err := h.fs(c).Stat(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			c.JSON(q.ErrResp(c, 404, os.ErrNotExist))
@@ -365,7 +467,7 @@ func (h *FileHandlers) FileMetadata(c *gin.Context) {
 		return
 	}
 
-	info, err := h.deps.FS().Stat(filePath)
+	info, err := h.fs(c).Stat(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			c.JSON(q.ErrResp(c, 404, os.ErrNotExist))
@@ -413,12 +515,24 @@ func (h *FileHandlers) Mkdir(c *gin.Context) {
 		return
 	}
 
-	err = h.deps.FS().MkdirAll(dirPath)
+	err = h.fs(c).MkdirAll(dirPath)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
 
+	err = h.deps.FileChanges().AddFileChange(c, &db.FileChange{
+		UserID: userId,
+		Op:     db.FileChangeCreate,
+		Path:   dirPath,
+		IsDir:  true,
+	})
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	h.fileChanged(db.FileChangeCreate, dirPath, "")
+
 	err = h.deps.FileIndex().AddPath(dirPath)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
@@ -448,18 +562,19 @@ func (h *FileHandlers) Move(c *gin.Context) {
 
 	oldPath := filepath.Clean(req.OldPath)
 	newPath := filepath.Clean(req.NewPath)
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionMove, oldPath, newPath)
 	if !h.canAccess(c, userId, userName, role, "move", oldPath) ||
 		!h.canAccess(c, userId, userName, role, "move", newPath) {
 		c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
 		return
 	}
 
-	itemInfo, err := h.deps.FS().Stat(oldPath)
+	itemInfo, err := h.fs(c).Stat(oldPath)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
-	_, err = h.deps.FS().Stat(newPath)
+	_, err = h.fs(c).Stat(newPath)
 	if err != nil && !os.IsNotExist(err) {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
@@ -471,11 +586,12 @@ func (h *FileHandlers) Move(c *gin.Context) {
 
 	err = h.deps.FileInfos().MoveFileInfo(c, userId, oldPath, newPath, itemInfo.IsDir())
 	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
+		c.JSON(q.ErrResp(c, quotaErrCode(err), err))
 		return
 	}
+	h.fileChanged(db.FileChangeMove, oldPath, newPath)
 
-	err = h.deps.FS().Rename(oldPath, newPath)
+	err = h.fs(c).Rename(oldPath, newPath)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
@@ -522,11 +638,18 @@ func (h *FileHandlers) UploadChunk(c *gin.Context) {
 		return
 	}
 
+	span := tracing.SpanFromContext(c)
+	span.SetAttr("upload.path", filePath)
+	span.SetAttr("upload.offset", req.Offset)
+	span.SetAttr("upload.encodedBytes", len(req.Content))
+
 	ok, err := h.deps.Limiter().CanWrite(userId, len([]byte(req.Content)))
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	} else if !ok {
+		h.deps.Metrics().Throttled(metrics.DirectionUpload)
+		span.SetAttr("io.throttled", true)
 		c.JSON(q.ErrResp(c, 429, errors.New("retry later")))
 		return
 	}
@@ -537,6 +660,7 @@ func (h *FileHandlers) UploadChunk(c *gin.Context) {
 	tmpFilePath := q.UploadPath(userName, filePath)
 	var code int
 	fsFilePath, fileSize, uploaded, wrote := "", int64(0), int64(0), 0
+	completed := false
 	h.lock(lockName(tmpFilePath), &code, &err, func() (int, error) {
 		// lockErr := locker.Exec(func() {
 		var err error
@@ -551,9 +675,31 @@ func (h *FileHandlers) UploadChunk(c *gin.Context) {
 		content, err := base64.StdEncoding.DecodeString(req.Content)
 		if err != nil {
 			return 500, err
+		} else if req.Offset+int64(len(content)) > fileSize {
+			return 400, db.ErrGreaterThanSize
+		}
+		if err = h.deps.DiskGuard().CanWrite(int64(len(content))); err != nil {
+			return quotaErrCode(err), err
+		}
+
+		if req.Offset == 0 {
+			err = h.checkContentType(c, userId, fsFilePath, fileSize, content)
+			if err != nil {
+				if errors.Is(err, db.ErrFileTypeDenied) {
+					// the denied file is dropped so that its space is released
+					if delErr := h.deps.FileInfos().DelUploadingInfos(c, userId, filePath); delErr != nil {
+						return 500, delErr
+					}
+					if delErr := h.fs(c).Remove(tmpFilePath); delErr != nil {
+						return 500, delErr
+					}
+				}
+				return quotaErrCode(err), err
+			}
 		}
 
-		wrote, err = h.deps.FS().WriteAt(tmpFilePath, []byte(content), req.Offset)
+		wrote, err = h.fs(c).WriteAt(tmpFilePath, []byte(content), req.Offset)
+		h.deps.Metrics().AddTransferred(metrics.DirectionUpload, wrote)
 		if err != nil {
 			return 500, err
 		}
@@ -570,8 +716,9 @@ func (h *FileHandlers) UploadChunk(c *gin.Context) {
 			if err != nil {
 				return 500, err
 			}
+			h.fileChanged(db.FileChangeUpload, fsFilePath, "")
 
-			err = h.deps.FS().Rename(tmpFilePath, fsFilePath)
+			err = h.fs(c).Rename(tmpFilePath, fsFilePath)
 			if err != nil {
 				return 500, fmt.Errorf("%s error: %w", fsFilePath, err)
 			}
@@ -584,13 +731,12 @@ func (h *FileHandlers) UploadChunk(c *gin.Context) {
 				return 500, err
 			}
 
-			err = h.deps.Workers().TryPut(
-				localworker.NewMsg(
-					h.deps.ID().Gen(),
-					map[string]string{localworker.MsgTypeKey: MsgTypeSha1},
-					string(msg),
-				),
-			)
+			err = h.deps.Workers().TryPut(h.newMsg(c, MsgTypeSha1, string(msg)))
+			if err != nil {
+				return 500, err
+			}
+
+			err = h.putContentIndexing(c, fsFilePath)
 			if err != nil {
 				return 500, err
 			}
@@ -599,6 +745,7 @@ func (h *FileHandlers) UploadChunk(c *gin.Context) {
 			if err != nil {
 				return 500, err
 			}
+			completed = true
 		}
 		return 200, nil
 	})
@@ -606,13 +753,23 @@ func (h *FileHandlers) UploadChunk(c *gin.Context) {
 		c.JSON(q.ErrResp(c, code, err))
 		return
 	}
+	if completed {
+		h.notifyOwner(c, userName, mailer.TmplUploaded, fsFilePath)
+		h.fireFileWebhooks(c, db.WebhookEventFileUploaded, userId, &FileWebhookData{
+			Path:  fsFilePath,
+			Size:  fileSize,
+			Actor: userName,
+		})
+	}
 
-	c.JSON(200, &UploadStatusResp{
+	status := &UploadStatusResp{
 		Path:     fsFilePath,
 		IsDir:    false,
 		FileSize: fileSize,
 		Uploaded: uploaded + int64(wrote),
-	})
+	}
+	h.deps.Events().Publish(&events.Event{Type: events.TypeUpload, Target: events.TargetUser, UserID: userId, Path: fsFilePath, Data: status})
+	c.JSON(200, status)
 }
 
 func (h *FileHandlers) getFSFilePath(userID, fsFilePath string) (string, error) {
@@ -734,6 +891,12 @@ func (h *FileHandlers) Download(c *gin.Context) {
 			return
 		}
 	}
+	// downloads of others' files are audited, e.g. visitors downloading shared files,
+	// resumed or chunked downloads are only audited once
+	owner := strings.Split(filePath, "/")[0]
+	if owner != userName && (rangeVal == "" || strings.HasPrefix(rangeVal, "bytes=0-")) {
+		defer q.Audit(c, h.deps.Auditor(), db.AuditActionDownload, filePath, "")
+	}
 
 	if !h.canAccess(c, userId, userName, role, "download", dirPath) {
 		c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
@@ -742,7 +905,7 @@ func (h *FileHandlers) Download(c *gin.Context) {
 
 	// TODO: when sharing is introduced, move following logics to a separeted method
 	// concurrently file accessing is managed by os
-	info, err := h.deps.FS().Stat(filePath)
+	info, err := h.fs(c).Stat(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			c.JSON(q.ErrResp(c, 404, os.ErrNotExist))
@@ -754,18 +917,30 @@ func (h *FileHandlers) Download(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 400, errors.New("downloading a folder is not supported")))
 		return
 	}
+	// resumed or chunked downloads are only notified once
+	if rangeVal == "" || strings.HasPrefix(rangeVal, "bytes=0-") {
+		h.notifyOwner(c, userName, mailer.TmplDownloaded, filePath)
+		// files are shared with others if they are downloaded by others
+		if owner != userName && owner != db.GroupsLocation {
+			h.fireFileWebhooks(c, db.WebhookEventSharingAccessed, userId, &FileWebhookData{
+				Path:  filePath,
+				Size:  info.Size(),
+				Actor: userName,
+			})
+		}
+	}
 
 	// https://golang.google.cn/pkg/net/http/#DetectContentType
 	// DetectContentType considers at most the first 512 bytes of data.
 	fileHeadBuf := make([]byte, 512)
-	read, err := h.deps.FS().ReadAt(filePath, fileHeadBuf, 0)
+	read, err := h.fs(c).ReadAt(filePath, fileHeadBuf, 0)
 	if err != nil && err != io.EOF {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
 	contentType := http.DetectContentType(fileHeadBuf[:read])
 
-	fd, id, err := h.deps.FS().GetFileReader(filePath)
+	fd, id, err := h.fs(c).GetFileReader(filePath)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
@@ -842,37 +1017,84 @@ func (h *FileHandlers) Download(c *gin.Context) {
 type ListResp struct {
 	Cwd       string          `json:"cwd"`
 	Metadatas []*MetadataResp `json:"metadatas"`
+	// Cursor is used for getting the next page, it is empty if there are no more items
+	Cursor string `json:"cursor,omitempty"`
+	// Total is the number of items matching the type filter
+	Total int `json:"total"`
 }
 
-func (h *FileHandlers) MergeFileInfos(ctx *gin.Context, dirPath string, infos []os.FileInfo) ([]*MetadataResp, error) {
-	filePaths := []string{}
-	metadatas := []*MetadataResp{}
-	for _, info := range infos {
-		if !info.IsDir() {
-			filePaths = append(filePaths, filepath.Join(dirPath, info.Name()))
-		}
-		metadatas = append(metadatas, &MetadataResp{
-			Name:    info.Name(),
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-			IsDir:   info.IsDir(),
-		})
+// listDir lists items in the folder, sizes of sub folders are the total sizes of their files,
+// items could be filtered by "type" (file or dir), sorted by "sort" (name, size or modTime) and "order" (asc or desc),
+// and paginated by "limit" and "cursor", all items are returned if "limit" is not set
+func (h *FileHandlers) listDir(c *gin.Context, dirPath string) {
+	itemType := c.Query("type")
+	if itemType != "" && itemType != "file" && itemType != "dir" {
+		c.JSON(q.ErrResp(c, 400, errors.New("type must be file or dir")))
+		return
+	}
+	order := c.Query("order")
+	if order != "" && order != "asc" && order != "desc" {
+		c.JSON(q.ErrResp(c, 400, errors.New("order must be asc or desc")))
+		return
+	}
+	limit, err := getIntQuery(c, "limit", 0, 1, maxQueryLimit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
 	}
 
-	dbInfos, err := h.deps.FileInfos().ListFileInfos(ctx, filePaths)
+	listing, err := h.getDirListing(c, dirPath)
 	if err != nil {
-		return nil, err
+		c.JSON(q.ErrResp(c, 500, err))
+		return
 	}
-	for _, metadata := range metadatas {
-		if !metadata.IsDir {
-			dbInfo, ok := dbInfos[filepath.Join(dirPath, metadata.Name)]
-			if ok {
-				metadata.Sha1 = dbInfo.Sha1
-			}
-		}
+	sortBy, desc := c.Query("sort"), order == "desc"
+	items, err := listing.view(itemType, sortBy, desc)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
 	}
 
-	return metadatas, nil
+	total := len(items)
+	if limit == 0 {
+		limit = total
+	}
+	pageItems, cursor, err := filequery.PageSorted(items, sortBy, desc, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	// items of listings are shared by requests, so sha1s are filled in copies
+	pageCopies := make([]*filequery.Item, 0, len(pageItems))
+	for _, item := range pageItems {
+		itemCopy := *item
+		pageCopies = append(pageCopies, &itemCopy)
+	}
+	if err = h.fillSha1(c, pageCopies); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	metadatas := []*MetadataResp{}
+	for _, item := range pageCopies {
+		metadata := &MetadataResp{
+			Name:    item.Name,
+			Size:    item.Size,
+			ModTime: item.ModTime,
+			IsDir:   item.IsDir,
+			Sha1:    item.Sha1,
+		}
+		if stat, ok := listing.dirStats[item.Path]; ok && item.IsDir {
+			metadata.FileCount = stat.FileCount
+		}
+		metadatas = append(metadatas, metadata)
+	}
+	c.JSON(200, &ListResp{
+		Cwd:       dirPath,
+		Metadatas: metadatas,
+		Cursor:    cursor,
+		Total:     total,
+	})
 }
 
 func (h *FileHandlers) List(c *gin.Context) {
@@ -895,44 +1117,18 @@ func (h *FileHandlers) List(c *gin.Context) {
 		return
 	}
 
-	infos, err := h.deps.FS().ListDir(dirPath)
-	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
-		return
-	}
-
-	metadatas, err := h.MergeFileInfos(c, dirPath, infos)
-	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
-		return
-	}
-
-	c.JSON(200, &ListResp{
-		Cwd:       dirPath,
-		Metadatas: metadatas,
-	})
+	h.listDir(c, dirPath)
 }
 
 func (h *FileHandlers) ListHome(c *gin.Context) {
 	userName := c.MustGet(q.UserParam).(string)
 	fsPath := q.FsRootPath(userName, "/")
-
-	infos, err := h.deps.FS().ListDir(fsPath)
-	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
-		return
-	}
-
-	metadatas, err := h.MergeFileInfos(c, fsPath, infos)
-	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
+	if !inTokenPathPrefix(c, fsPath) {
+		c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
 		return
 	}
 
-	c.JSON(200, &ListResp{
-		Cwd:       fsPath,
-		Metadatas: metadatas,
-	})
+	h.listDir(c, fsPath)
 }
 
 func (h *FileHandlers) Copy(c *gin.Context) {
@@ -963,10 +1159,14 @@ func (h *FileHandlers) ListUploadings(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
-	if infos == nil {
-		infos = []*db.UploadInfo{}
+	// uploadings out of the api token's prefix are not listed
+	limitedInfos := []*db.UploadInfo{}
+	for _, info := range infos {
+		if inTokenPathPrefix(c, info.RealFilePath) {
+			limitedInfos = append(limitedInfos, info)
+		}
 	}
-	c.JSON(200, &ListUploadingsResp{UploadInfos: infos})
+	c.JSON(200, &ListUploadingsResp{UploadInfos: limitedInfos})
 }
 
 func (h *FileHandlers) DelUploading(c *gin.Context) {
@@ -984,8 +1184,7 @@ func (h *FileHandlers) DelUploading(c *gin.Context) {
 	}
 	role := c.MustGet(q.RoleParam).(string)
 	userName := c.MustGet(q.UserParam).(string)
-	// op is empty, because users must be admin, or the path belongs to this user
-	if !h.canAccess(c, userId, userName, role, "", filePath) {
+	if !h.canAccess(c, userId, userName, role, "upload.delete", filePath) {
 		c.JSON(q.ErrResp(c, 403, errors.New("forbidden")))
 		return
 	}
@@ -997,7 +1196,7 @@ func (h *FileHandlers) DelUploading(c *gin.Context) {
 	// lockErr := locker.Exec(func() {
 	var code int
 	h.lock(lockName(tmpFilePath), &code, &err, func() (int, error) {
-		_, err = h.deps.FS().Stat(tmpFilePath)
+		_, err = h.fs(c).Stat(tmpFilePath)
 		if err != nil {
 			if os.IsNotExist(err) {
 				// no op
@@ -1005,7 +1204,7 @@ func (h *FileHandlers) DelUploading(c *gin.Context) {
 				return 500, err
 			}
 		}
-		err = h.deps.FS().Remove(tmpFilePath)
+		err = h.fs(c).Remove(tmpFilePath)
 		if err != nil {
 			return 500, err
 		}
@@ -1042,6 +1241,7 @@ func (h *FileHandlers) AddSharing(c *gin.Context) {
 	}
 
 	sharingPath := filepath.Clean(req.SharingPath)
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionAddSharing, sharingPath, "")
 	// TODO: move canAccess to authedFS
 	role := c.MustGet(q.RoleParam).(string)
 	userName := c.MustGet(q.UserParam).(string)
@@ -1056,7 +1256,7 @@ func (h *FileHandlers) AddSharing(c *gin.Context) {
 		return
 	}
 
-	info, err := h.deps.FS().Stat(sharingPath)
+	info, err := h.fs(c).Stat(sharingPath)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
@@ -1071,6 +1271,11 @@ func (h *FileHandlers) AddSharing(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
+	h.fileChanged(db.FileChangeShare, sharingPath, "")
+	h.fireFileWebhooks(c, db.WebhookEventSharingCreated, userId, &FileWebhookData{
+		Path:  sharingPath,
+		Actor: userName,
+	})
 	c.JSON(q.Resp(200))
 }
 
@@ -1081,6 +1286,7 @@ func (h *FileHandlers) DelSharing(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 400, errors.New("invalid file path")))
 		return
 	}
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionDelSharing, dirPath, "")
 
 	userId, err := q.GetUserId(c)
 	if err != nil {
@@ -1101,6 +1307,7 @@ func (h *FileHandlers) DelSharing(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
+	h.fileChanged(db.FileChangeUnshare, dirPath, "")
 	c.JSON(q.Resp(200))
 }
 
@@ -1142,7 +1349,9 @@ func (h *FileHandlers) ListSharings(c *gin.Context) {
 
 	dirs := []string{}
 	for sharingDir := range sharingDirs {
-		dirs = append(dirs, sharingDir)
+		if inTokenPathPrefix(c, sharingDir) {
+			dirs = append(dirs, sharingDir)
+		}
 	}
 	c.JSON(200, &SharingResp{SharingDirs: dirs})
 }
@@ -1158,6 +1367,12 @@ func (h *FileHandlers) ListSharingIDs(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
+	// sharings out of the api token's prefix are not listed
+	for sharingDir := range dirToID {
+		if !inTokenPathPrefix(c, sharingDir) {
+			delete(dirToID, sharingDir)
+		}
+	}
 	c.JSON(200, &SharingIDsResp{IDs: dirToID})
 }
 
@@ -1200,13 +1415,7 @@ func (h *FileHandlers) GenerateHash(c *gin.Context) {
 		return
 	}
 
-	err = h.deps.Workers().TryPut(
-		localworker.NewMsg(
-			h.deps.ID().Gen(),
-			map[string]string{localworker.MsgTypeKey: MsgTypeSha1},
-			string(msg),
-		),
-	)
+	err = h.deps.Workers().TryPut(h.newMsg(c, MsgTypeSha1, string(msg)))
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
@@ -1260,15 +1469,18 @@ func (h *FileHandlers) SearchItems(c *gin.Context) {
 		}
 	}
 
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
 	role := c.MustGet(q.RoleParam).(string)
 	userName := c.MustGet(q.UserParam).(string)
 	results := []string{}
 	for pathname, count := range resultsMap {
-		if count >= len(keywords) {
-			if role == db.AdminRole ||
-				(role != db.AdminRole && strings.HasPrefix(pathname, userName)) {
-				results = append(results, pathname)
-			}
+		// the name prefix also matches other users' homes (e.g. "bob" and "bobby")
+		if count >= len(keywords) && h.canAccess(c, userID, userName, role, "list", pathname) {
+			results = append(results, pathname)
 		}
 	}
 
@@ -1282,13 +1494,7 @@ func (h *FileHandlers) Reindex(c *gin.Context) {
 		return
 	}
 
-	err = h.deps.Workers().TryPut(
-		localworker.NewMsg(
-			h.deps.ID().Gen(),
-			map[string]string{localworker.MsgTypeKey: MsgTypeIndexing},
-			string(msg),
-		),
-	)
+	err = h.deps.Workers().TryPut(h.newMsg(c, MsgTypeIndexing, string(msg)))
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
@@ -1308,11 +1514,13 @@ func (h *FileHandlers) GetStreamReader(userID uint64, fd io.Reader) (io.ReadClos
 				pw.CloseWithError(err)
 				break
 			} else if !ok {
+				h.deps.Metrics().Throttled(metrics.DirectionDownload)
 				time.Sleep(time.Duration(1) * time.Second)
 				continue
 			}
 
-			_, err = io.CopyN(pw, fd, int64(q.DownloadChunkSize))
+			copied, err := io.CopyN(pw, fd, int64(q.DownloadChunkSize))
+			h.deps.Metrics().AddTransferred(metrics.DirectionDownload, int(copied))
 			if err != nil {
 				if err != io.EOF {
 					pw.CloseWithError(err)
@@ -1352,13 +1560,7 @@ func (h *FileHandlers) ResetUsedSpace(c *gin.Context) {
 		return
 	}
 
-	err = h.deps.Workers().TryPut(
-		localworker.NewMsg(
-			h.deps.ID().Gen(),
-			map[string]string{localworker.MsgTypeKey: MsgTypeResetUsedSpace},
-			string(msg),
-		),
-	)
+	err = h.deps.Workers().TryPut(h.newMsg(c, MsgTypeResetUsedSpace, string(msg)))
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
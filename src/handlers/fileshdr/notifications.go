@@ -0,0 +1,92 @@
+package fileshdr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/mailer"
+)
+
+// notify mails the user if mail is enabled and the user has an email
+func (h *FileHandlers) notify(ctx context.Context, user *db.User, tmplName string, data map[string]string) {
+	if !h.deps.Mailer().Enabled() || user.Preferences == nil || user.Preferences.Email == "" {
+		return
+	}
+
+	data["UserName"] = user.Name
+	data["SiteName"] = "Quickshare"
+	if siteCfg, err := h.deps.SiteStore().GetCfg(ctx); err == nil && siteCfg.ClientCfg != nil {
+		data["SiteName"] = siteCfg.ClientCfg.SiteName
+	}
+	mail, err := h.deps.Mailer().Render(tmplName, []string{user.Preferences.Email}, data)
+	if err != nil {
+		h.deps.Log().Errorf("notify: render mail error: %s", err)
+		return
+	}
+	// notifications are best effort, they never fail the request
+	if err = mailer.Post(h.deps.Workers(), h.deps.ID().Gen(), mail); err != nil {
+		h.deps.Log().Errorf("notify: post mail error: %s", err)
+	}
+}
+
+// notifyOwner notifies the owner of the path when others upload into or download from it
+func (h *FileHandlers) notifyOwner(ctx context.Context, actorName, tmplName, filePath string) {
+	cfgKey := "Mail.NotifyUploads"
+	if tmplName == mailer.TmplDownloaded {
+		cfgKey = "Mail.NotifyDownloads"
+	}
+	if !h.cfg.BoolOr(cfgKey, false) {
+		return
+	}
+
+	ownerName := strings.Split(filePath, "/")[0]
+	if ownerName == actorName || ownerName == db.GroupsLocation {
+		return
+	}
+	owner, err := h.deps.Users().GetUserByName(ctx, ownerName)
+	if err != nil {
+		return
+	}
+
+	if actorName == "" {
+		actorName = "a visitor"
+	}
+	h.notify(ctx, owner, tmplName, map[string]string{
+		"Actor": actorName,
+		"Path":  filePath,
+	})
+}
+
+// warnQuota warns the user charged for the upload when the used space crosses the warning line after adding size bytes,
+// uploads are charged to owners of home folders, and uploads to team folders are charged to groups which are not warned
+func (h *FileHandlers) warnQuota(ctx context.Context, uploaderID uint64, filePath string, size int64) {
+	percent := h.cfg.IntOr("Mail.QuotaWarnPercent", 0)
+	if percent <= 0 || size <= 0 {
+		return
+	}
+	if _, ok := db.GroupOfPath(filePath); ok {
+		return
+	}
+
+	ownerName := strings.Split(filePath, "/")[0]
+	user, err := h.deps.Users().GetUserByName(ctx, ownerName)
+	if errors.Is(err, db.ErrUserNotFound) {
+		user, err = h.deps.Users().GetUser(ctx, uploaderID)
+	}
+	if err != nil || user.Quota == nil || user.Quota.SpaceLimit <= 0 {
+		return
+	}
+	warnLine := user.Quota.SpaceLimit * int64(percent) / 100
+	if user.UsedSpace-size >= warnLine || user.UsedSpace < warnLine {
+		return
+	}
+
+	h.notify(ctx, user, mailer.TmplQuotaWarning, map[string]string{
+		"UsedSpace":  fmt.Sprint(user.UsedSpace),
+		"SpaceLimit": fmt.Sprint(user.Quota.SpaceLimit),
+		"Percent":    fmt.Sprint(user.UsedSpace * 100 / user.Quota.SpaceLimit),
+	})
+}
@@ -0,0 +1,49 @@
+package fileshdr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/diskguard"
+)
+
+// quotaErrCode maps quota and disk space errors to status codes, it returns 500 for other errors
+func quotaErrCode(err error) int {
+	switch {
+	case errors.Is(err, db.ErrQuota), errors.Is(err, db.ErrReachedLimit), errors.Is(err, db.ErrFileCountLimit):
+		return 403
+	case errors.Is(err, db.ErrFileSizeLimit):
+		return 413
+	case errors.Is(err, db.ErrFileTypeDenied):
+		return 415
+	case errors.Is(err, db.ErrGreaterThanSize):
+		return 400
+	case errors.Is(err, diskguard.ErrLowSpace):
+		return 507
+	case errors.Is(err, diskguard.ErrReadOnly):
+		return 503
+	}
+	return 500
+}
+
+// checkContentType checks the type sniffed from the first chunk with the quota of the home's owner,
+// files in team folders are not checked
+func (h *FileHandlers) checkContentType(ctx context.Context, userID uint64, filePath string, fileSize int64, head []byte) error {
+	if _, ok := db.GroupOfPath(filePath); ok {
+		return nil
+	}
+
+	// files could be uploaded by others (e.g. admins or users granted by ACLs)
+	owner, err := h.deps.Users().GetUserByName(ctx, strings.Split(filePath, "/")[0])
+	if errors.Is(err, db.ErrUserNotFound) {
+		owner, err = h.deps.Users().GetUser(ctx, userID)
+	}
+	if err != nil {
+		return err
+	}
+	return db.CheckFile(owner.Quota, path.Base(filePath), fileSize, http.DetectContentType(head))
+}
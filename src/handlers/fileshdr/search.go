@@ -0,0 +1,243 @@
+package fileshdr
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/search/filequery"
+)
+
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 1000
+	// sqlite limits the number of variables
+	sha1BatchSize = 500
+)
+
+// searchRoots returns folders which the user can list: the home, team folders and folders granted by ACLs,
+// folders are limited by the api token's prefix and the scopes in the query
+func (h *FileHandlers) searchRoots(ctx context.Context, userID uint64, userName, role string, scopes []string) ([]string, error) {
+	roots := []string{}
+	if role == db.AdminRole {
+		users, err := h.deps.Users().ListUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if user.ID != db.VisitorID {
+				roots = append(roots, q.FsRootPath(user.Name, "/"))
+			}
+		}
+		roots = append(roots, db.GroupsLocation)
+	} else {
+		roots = append(roots, q.FsRootPath(userName, "/"))
+
+		userGroups, err := h.deps.Groups().ListUserGroups(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, userGroup := range userGroups {
+			roots = append(roots, q.GroupRootPath(userGroup.Group.Name, "/"))
+		}
+
+		acls, err := h.deps.ACLs().ListUserACLs(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, acl := range acls {
+			if aclAllows(acl.Perm, "list") {
+				roots = append(roots, acl.Path)
+			}
+		}
+	}
+
+	if prefix, ok := ctx.Value(q.TokenPathPrefixParam).(string); ok && prefix != "" {
+		roots = narrowRoots(roots, []string{prefix})
+	}
+	if len(scopes) > 0 {
+		roots = narrowRoots(roots, scopes)
+	}
+	return dedupRoots(roots), nil
+}
+
+// narrowRoots keeps the parts of roots which are under one of the scopes
+func narrowRoots(roots, scopes []string) []string {
+	narrowed := []string{}
+	for _, root := range roots {
+		for _, scope := range scopes {
+			if filequery.InScope(scope, root) {
+				narrowed = append(narrowed, scope)
+			} else if filequery.InScope(root, scope) {
+				narrowed = append(narrowed, root)
+			}
+		}
+	}
+	return narrowed
+}
+
+// dedupRoots removes roots under other roots so that items are queried once
+func dedupRoots(roots []string) []string {
+	sort.Strings(roots)
+	deduped := []string{}
+	for _, root := range roots {
+		if len(deduped) > 0 && filequery.InScope(root, deduped[len(deduped)-1]) {
+			continue
+		}
+		deduped = append(deduped, root)
+	}
+	return deduped
+}
+
+// fileQuery converts the query into the db query which searches items under roots
+func fileQuery(query *filequery.Query, roots []string) *db.FileQuery {
+	fileQuery := &db.FileQuery{
+		DirPaths: roots,
+		Names:    query.Names,
+		Exts:     query.Exts,
+		MinSize:  query.MinSize,
+		MaxSize:  query.MaxSize,
+		IsDir:    query.IsDir,
+		Sha1:     query.Sha1,
+	}
+	if !query.ModifiedAfter.IsZero() {
+		fileQuery.ModifiedAfter = query.ModifiedAfter.UnixNano()
+	}
+	if !query.ModifiedBefore.IsZero() {
+		fileQuery.ModifiedBefore = query.ModifiedBefore.UnixNano()
+	}
+	return fileQuery
+}
+
+func (h *FileHandlers) fillSha1(ctx context.Context, items []*filequery.Item) error {
+	for start := 0; start < len(items); start += sha1BatchSize {
+		end := start + sha1BatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		filePaths := []string{}
+		for _, item := range items[start:end] {
+			if !item.IsDir {
+				filePaths = append(filePaths, item.Path)
+			}
+		}
+		if len(filePaths) == 0 {
+			continue
+		}
+
+		dbInfos, err := h.deps.FileInfos().ListFileInfos(ctx, filePaths)
+		if err != nil {
+			return err
+		}
+		for _, item := range items[start:end] {
+			if dbInfo, ok := dbInfos[item.Path]; ok && !item.IsDir {
+				item.Sha1 = dbInfo.Sha1
+			}
+		}
+	}
+	return nil
+}
+
+type QueryItemsResp struct {
+	Results []*filequery.Item `json:"results"`
+	// Cursor is used for getting the next page, it is empty if there are no more results
+	Cursor string `json:"cursor"`
+}
+
+// QueryItems searches items by the query language (see filequery.Parse) in folders which the user can list,
+// results are sorted by "sort" (path, name, size or modTime) and "order" (asc or desc), and paginated by "cursor",
+// items are queried from the db so that only files and folders recorded in the db are searched
+func (h *FileHandlers) QueryItems(c *gin.Context) {
+	queryStr := strings.TrimSpace(c.Query("q"))
+	if queryStr == "" {
+		c.JSON(q.ErrResp(c, 400, errors.New("empty query")))
+		return
+	}
+	query, err := filequery.Parse(queryStr, time.Now())
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	limit, err := getIntQuery(c, "limit", defaultQueryLimit, 1, maxQueryLimit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	order := c.Query("order")
+	if order != "" && order != "asc" && order != "desc" {
+		c.JSON(q.ErrResp(c, 400, errors.New("order must be asc or desc")))
+		return
+	}
+	sortBy, desc := c.Query("sort"), order == "desc"
+	if err = filequery.CheckSortBy(sortBy); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	role := c.MustGet(q.RoleParam).(string)
+	userName := c.MustGet(q.UserParam).(string)
+	roots, err := h.searchRoots(c, userID, userName, role, query.Scopes)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	dbQuery := fileQuery(query, roots)
+	// one more item is queried to know if there is a next page
+	dbQuery.SortBy, dbQuery.Desc, dbQuery.Limit = sortBy, desc, limit+1
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		last, err := filequery.DecodeCursor(cursorStr, sortBy, desc)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 400, err))
+			return
+		}
+		dbQuery.After = &db.FileItem{
+			Path:    last.Path,
+			Name:    last.Name,
+			Size:    last.Size,
+			ModTime: last.ModTime.UnixNano(),
+		}
+	}
+	fileItems, err := h.deps.FileInfos().QueryFiles(c, dbQuery)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	results := []*filequery.Item{}
+	for _, fileItem := range fileItems {
+		results = append(results, &filequery.Item{
+			Path:    fileItem.Path,
+			Name:    fileItem.Name,
+			Size:    fileItem.Size,
+			ModTime: time.Unix(0, fileItem.ModTime),
+			IsDir:   fileItem.IsDir,
+			Sha1:    fileItem.Sha1,
+		})
+	}
+	cursor := ""
+	if len(results) > limit {
+		results = results[:limit]
+		cursor, err = filequery.EncodeCursor(results[limit-1], sortBy, desc)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 500, err))
+			return
+		}
+	}
+	c.JSON(200, &QueryItemsResp{
+		Results: results,
+		Cursor:  cursor,
+	})
+}
@@ -0,0 +1,373 @@
+package fileshdr
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	formatCSV = "csv"
+
+	defaultStatsLimit = 100
+	maxStatsLimit     = 1000
+	// uploadings which are not written for a day are stale by default
+	defaultStaleHours = 24
+	defaultGrowthDays = 30
+)
+
+var ErrInvalidStatsFormat = errors.New("format must be json or csv")
+
+// takeStorageSnapshots is run by cron, snapshots older than the kept days are removed
+func (h *FileHandlers) takeStorageSnapshots() {
+	ctx := context.TODO()
+	now := time.Now().Unix()
+	if err := h.deps.StorageStats().AddStorageSnapshots(ctx, now); err != nil {
+		h.deps.Log().Errorf("failed to take storage snapshots: %s", err)
+		return
+	}
+
+	keepDays := h.cfg.IntOr("Fs.StorageSnapshotKeepDays", 365)
+	if keepDays > 0 {
+		if err := h.deps.StorageStats().DelStorageSnapshots(ctx, now-int64(keepDays)*24*3600); err != nil {
+			h.deps.Log().Errorf("failed to clean storage snapshots: %s", err)
+		}
+	}
+}
+
+func getStatsFormat(c *gin.Context) (string, error) {
+	format := c.Query(q.FormatParam)
+	if format != "" && format != formatCSV && format != "json" {
+		return "", ErrInvalidStatsFormat
+	}
+	return format, nil
+}
+
+func getIntQuery(c *gin.Context, name string, defaultVal, minVal, maxVal int) (int, error) {
+	valStr := c.Query(name)
+	if valStr == "" {
+		return defaultVal, nil
+	}
+	val, err := strconv.Atoi(valStr)
+	if err != nil || val < minVal || (maxVal > 0 && val > maxVal) {
+		return 0, fmt.Errorf("invalid %s: %s", name, valStr)
+	}
+	return val, nil
+}
+
+func writeCSV(c *gin.Context, fileName string, rows [][]string) {
+	buf := &bytes.Buffer{}
+	if err := csv.NewWriter(buf).WriteAll(rows); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.Data(200, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+type UserUsagesResp struct {
+	Users []*db.UserUsage `json:"users"`
+}
+
+func (h *FileHandlers) ListUserUsages(c *gin.Context) {
+	format, err := getStatsFormat(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	usages, err := h.deps.StorageStats().ListUserUsages(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	if format != formatCSV {
+		c.JSON(200, &UserUsagesResp{Users: usages})
+		return
+	}
+
+	rows := [][]string{{"id", "name", "usedSpace", "spaceLimit", "fileCount", "fileSize"}}
+	for _, usage := range usages {
+		rows = append(rows, []string{
+			fmt.Sprint(usage.ID),
+			usage.Name,
+			fmt.Sprint(usage.UsedSpace),
+			fmt.Sprint(usage.SpaceLimit),
+			fmt.Sprint(usage.FileCount),
+			fmt.Sprint(usage.FileSize),
+		})
+	}
+	writeCSV(c, "user_usages.csv", rows)
+}
+
+type FolderUsagesResp struct {
+	Folders []*db.FolderUsage `json:"folders"`
+}
+
+// ListFolderUsages lists usages of sub folders of the dir in the "dp" query, homes are listed if it is empty
+func (h *FileHandlers) ListFolderUsages(c *gin.Context) {
+	format, err := getStatsFormat(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	usages, err := h.deps.StorageStats().ListFolderUsages(c, c.Query(ListDirQuery))
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	if format != formatCSV {
+		c.JSON(200, &FolderUsagesResp{Folders: usages})
+		return
+	}
+
+	rows := [][]string{{"path", "fileCount", "size"}}
+	for _, usage := range usages {
+		rows = append(rows, []string{
+			usage.Path,
+			fmt.Sprint(usage.FileCount),
+			fmt.Sprint(usage.Size),
+		})
+	}
+	writeCSV(c, "folder_usages.csv", rows)
+}
+
+type LargestFilesResp struct {
+	Files []*db.FileUsage `json:"files"`
+}
+
+func (h *FileHandlers) ListLargestFiles(c *gin.Context) {
+	format, err := getStatsFormat(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	limit, err := getIntQuery(c, "limit", defaultStatsLimit, 1, maxStatsLimit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	files, err := h.deps.StorageStats().ListLargestFiles(c, limit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	if format != formatCSV {
+		c.JSON(200, &LargestFilesResp{Files: files})
+		return
+	}
+
+	rows := [][]string{{"path", "creator", "size", "sha1"}}
+	for _, file := range files {
+		rows = append(rows, []string{
+			file.Path,
+			fmt.Sprint(file.Creator),
+			fmt.Sprint(file.Size),
+			file.Sha1,
+		})
+	}
+	writeCSV(c, "largest_files.csv", rows)
+}
+
+type DuplicateFilesResp struct {
+	Duplicates []*db.DuplicateFiles `json:"duplicates"`
+}
+
+// ListDuplicateFiles lists files with the same sha1, files without sha1 (e.g. being hashed) are not listed
+func (h *FileHandlers) ListDuplicateFiles(c *gin.Context) {
+	format, err := getStatsFormat(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	limit, err := getIntQuery(c, "limit", defaultStatsLimit, 1, maxStatsLimit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	dups, err := h.deps.StorageStats().ListDuplicateFiles(c, limit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	if format != formatCSV {
+		c.JSON(200, &DuplicateFilesResp{Duplicates: dups})
+		return
+	}
+
+	// one row per file
+	rows := [][]string{{"sha1", "size", "wasted", "path"}}
+	for _, dup := range dups {
+		for _, filePath := range dup.Paths {
+			rows = append(rows, []string{
+				dup.Sha1,
+				fmt.Sprint(dup.Size),
+				fmt.Sprint(dup.Wasted),
+				filePath,
+			})
+		}
+	}
+	writeCSV(c, "duplicate_files.csv", rows)
+}
+
+type StaleUploading struct {
+	*db.UploadingInfo
+	// ModifiedAt is the last time of writing the temporary file, it is 0 if the file is missing
+	ModifiedAt int64 `json:"modifiedAt,string"`
+}
+
+type StaleUploadingsResp struct {
+	Uploadings []*StaleUploading `json:"uploadings"`
+}
+
+// ListStaleUploadings lists uploadings which are not written in the hours of the "hours" query
+func (h *FileHandlers) ListStaleUploadings(c *gin.Context) {
+	format, err := getStatsFormat(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	hours, err := getIntQuery(c, "hours", defaultStaleHours, 0, 0)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	infos, err := h.deps.StorageStats().ListAllUploadInfos(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	// t_file_uploading has no timestamps, the temporary files tell when they were written
+	staleBefore := time.Now().Add(-time.Duration(hours) * time.Hour)
+	uploadings := []*StaleUploading{}
+	for _, info := range infos {
+		modifiedAt := int64(0)
+		fileInfo, err := h.deps.FS().Stat(info.TmpFilePath)
+		if err == nil {
+			if !fileInfo.ModTime().Before(staleBefore) {
+				continue
+			}
+			modifiedAt = fileInfo.ModTime().Unix()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			c.JSON(q.ErrResp(c, 500, err))
+			return
+		}
+		uploadings = append(uploadings, &StaleUploading{
+			UploadingInfo: info,
+			ModifiedAt:    modifiedAt,
+		})
+	}
+	if format != formatCSV {
+		c.JSON(200, &StaleUploadingsResp{Uploadings: uploadings})
+		return
+	}
+
+	rows := [][]string{{"userID", "path", "size", "uploaded", "modifiedAt"}}
+	for _, uploading := range uploadings {
+		rows = append(rows, []string{
+			fmt.Sprint(uploading.UserID),
+			uploading.RealFilePath,
+			fmt.Sprint(uploading.Size),
+			fmt.Sprint(uploading.Uploaded),
+			fmt.Sprint(uploading.ModifiedAt),
+		})
+	}
+	writeCSV(c, "stale_uploadings.csv", rows)
+}
+
+// GrowthPoint is the total usage of a snapshot
+type GrowthPoint struct {
+	CreatedAt int64 `json:"createdAt,string"`
+	UsedSpace int64 `json:"usedSpace,string"`
+	FileCount int64 `json:"fileCount,string"`
+	Users     int   `json:"users"`
+}
+
+type StorageGrowthResp struct {
+	Points []*GrowthPoint `json:"points"`
+}
+
+// GetStorageGrowth sums up snapshots in the days of the "days" query, they are filtered if "uid" is set
+func (h *FileHandlers) GetStorageGrowth(c *gin.Context) {
+	format, err := getStatsFormat(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	days, err := getIntQuery(c, "days", defaultGrowthDays, 1, 0)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	filterUser, userID := false, uint64(0)
+	if userIDStr := c.Query(q.UserIDParam); userIDStr != "" {
+		userID, err = strconv.ParseUint(userIDStr, 10, 64)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid user ID %w", err)))
+			return
+		}
+		filterUser = true
+	}
+
+	since := time.Now().Unix() - int64(days)*24*3600
+	snapshots, err := h.deps.StorageStats().ListStorageSnapshots(c, since)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	// snapshots are ordered by the creating time
+	points := []*GrowthPoint{}
+	for _, snapshot := range snapshots {
+		if filterUser && snapshot.UserID != userID {
+			continue
+		}
+		if len(points) == 0 || points[len(points)-1].CreatedAt != snapshot.CreatedAt {
+			points = append(points, &GrowthPoint{CreatedAt: snapshot.CreatedAt})
+		}
+		point := points[len(points)-1]
+		point.UsedSpace += snapshot.UsedSpace
+		point.FileCount += snapshot.FileCount
+		point.Users++
+	}
+	if format != formatCSV {
+		c.JSON(200, &StorageGrowthResp{Points: points})
+		return
+	}
+
+	rows := [][]string{{"createdAt", "usedSpace", "fileCount", "users"}}
+	for _, point := range points {
+		rows = append(rows, []string{
+			time.Unix(point.CreatedAt, 0).UTC().Format(time.RFC3339),
+			fmt.Sprint(point.UsedSpace),
+			fmt.Sprint(point.FileCount),
+			fmt.Sprint(point.Users),
+		})
+	}
+	writeCSV(c, "storage_growth.csv", rows)
+}
+
+// TakeStorageSnapshots takes snapshots immediately besides the scheduled ones
+func (h *FileHandlers) TakeStorageSnapshots(c *gin.Context) {
+	err := h.deps.StorageStats().AddStorageSnapshots(c, time.Now().Unix())
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
@@ -0,0 +1,24 @@
+package fileshdr
+
+import (
+	"context"
+
+	"github.com/ihexxa/quickshare/src/fs"
+	"github.com/ihexxa/quickshare/src/fs/tracedfs"
+	"github.com/ihexxa/quickshare/src/tracing"
+	"github.com/ihexxa/quickshare/src/worker"
+	"github.com/ihexxa/quickshare/src/worker/localworker"
+)
+
+// fs returns the file system whose calls are traced as children of the span in ctx
+func (h *FileHandlers) fs(ctx context.Context) fs.ISimpleFS {
+	return tracedfs.New(ctx, h.deps.FS())
+}
+
+// newMsg creates an async message carrying the span context of ctx,
+// so that the job is traced as a child of the operation putting it
+func (h *FileHandlers) newMsg(ctx context.Context, msgType, body string) worker.IMsg {
+	headers := map[string]string{localworker.MsgTypeKey: msgType}
+	tracing.Inject(ctx, headers)
+	return localworker.NewMsg(h.deps.ID().Gen(), headers, body)
+}
@@ -0,0 +1,31 @@
+package fileshdr
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/webhook"
+)
+
+// FileWebhookData is the data of file and sharing events posted to webhooks
+type FileWebhookData struct {
+	Path string `json:"path"`
+	Size int64  `json:"size,omitempty"`
+	// Actor is the name of the user triggering the event, it is empty for visitors
+	Actor string `json:"actor"`
+}
+
+// fireFileWebhooks triggers webhooks of the event, webhooks of the file's owner also receive it
+func (h *FileHandlers) fireFileWebhooks(ctx context.Context, eventType string, actorID uint64, data *FileWebhookData) {
+	owner := strings.Split(data.Path, "/")[0]
+	if owner == db.GroupsLocation {
+		owner = ""
+	}
+	h.deps.Webhooks().Fire(ctx, &webhook.Event{
+		Type:    eventType,
+		ActorID: actorID,
+		Owner:   owner,
+		Data:    data,
+	})
+}
@@ -0,0 +1,244 @@
+package multiusers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	apiTokenPrefix = "qst_"
+	// last_used_at is updated at most once in this interval to avoid writing the db in each request
+	apiTokenUsedInterval = 60
+)
+
+var (
+	ErrAPITokenNotAllowed = errors.New("not allowed for api tokens")
+)
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func genAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + hex.EncodeToString(buf), nil
+}
+
+// authByAPIToken verifies the bearer token and returns claims of its owner
+func (h *MultiUsersSvc) authByAPIToken(c *gin.Context, tokenStr string) (*db.APIToken, map[string]string, int, error) {
+	if !strings.HasPrefix(tokenStr, apiTokenPrefix) {
+		return nil, nil, 401, db.ErrInvalidAPIToken
+	}
+
+	token, err := h.deps.APITokens().GetAPITokenByHash(c, hashAPIToken(tokenStr))
+	if err != nil {
+		if errors.Is(err, db.ErrAPITokenNotFound) {
+			return nil, nil, 401, db.ErrInvalidAPIToken
+		}
+		return nil, nil, 500, err
+	}
+
+	now := time.Now().Unix()
+	if token.ExpireAt != 0 && token.ExpireAt <= now {
+		return nil, nil, 401, ErrExpired
+	}
+	if !apiTokenScopesAllow(token.Scopes, c.Request.Method, c.Request.URL.Path) {
+		return nil, nil, 403, q.ErrAccessDenied
+	}
+
+	user, err := h.deps.Users().GetUser(c, token.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			return nil, nil, 401, db.ErrInvalidAPIToken
+		}
+		return nil, nil, 500, err
+	}
+
+	if now-token.LastUsedAt >= apiTokenUsedInterval {
+		if err = h.deps.APITokens().SetAPITokenUsed(c, token.ID, now); err != nil {
+			h.deps.Log().Errorf("authByAPIToken: set token used error: %s", err)
+		}
+	}
+
+	expire := ""
+	if token.ExpireAt != 0 {
+		expire = fmt.Sprint(token.ExpireAt)
+	}
+	return token, map[string]string{
+		q.UserIDParam: fmt.Sprint(user.ID),
+		q.UserParam:   user.Name,
+		q.RoleParam:   user.Role,
+		q.ExpireParam: expire,
+	}, 200, nil
+}
+
+// isFileReadPath checks if the path is an API reading files or the token owner's info
+func isFileReadPath(accessPath string) bool {
+	return strings.HasPrefix(accessPath, "/v2/my/fs/") ||
+		strings.HasPrefix(accessPath, "/v1/fs/") ||
+		accessPath == "/v2/my/self" ||
+		accessPath == "/v2/my/isauthed"
+}
+
+// apiTokenScopesAllow checks if the request is allowed by scopes,
+// tokens without scopes are able to access what their owners can access, except managing credentials and webhooks,
+// and tokens with scopes are only able to access file APIs
+func apiTokenScopesAllow(scopes []string, method, accessPath string) bool {
+	if strings.HasPrefix(accessPath, "/v2/my/tokens") ||
+		strings.HasPrefix(accessPath, "/v2/my/2fa") ||
+		strings.HasPrefix(accessPath, "/v2/my/webhooks") ||
+		accessPath == "/v2/my/pwd" {
+		return false
+	}
+	if len(scopes) == 0 {
+		return true
+	} else if strings.HasPrefix(accessPath, "/v2/admin") {
+		return false
+	}
+
+	for _, scope := range scopes {
+		switch scope {
+		case db.APITokenScopeRead:
+			if (method == http.MethodGet || method == http.MethodOptions) && isFileReadPath(accessPath) {
+				return true
+			}
+		case db.APITokenScopeUpload:
+			switch {
+			case method == http.MethodPost && accessPath == "/v2/my/fs/files",
+				method == http.MethodPatch && accessPath == "/v2/my/fs/files/chunks",
+				method == http.MethodGet && accessPath == "/v2/my/fs/files/chunks",
+				method == http.MethodPost && accessPath == "/v2/my/fs/dirs":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type AddAPITokenReq struct {
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	PathPrefix string   `json:"pathPrefix"`
+	// ExpireAt is a unix timestamp, 0 means the token never expires
+	ExpireAt int64 `json:"expireAt,string"`
+}
+
+type AddAPITokenResp struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
+func (h *MultiUsersSvc) AddAPIToken(c *gin.Context) {
+	req := &AddAPITokenReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	now := time.Now().Unix()
+	if req.ExpireAt != 0 && req.ExpireAt <= now {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("expireAt is in the past: %w", db.ErrInvalidAPIToken)))
+		return
+	}
+	pathPrefix := ""
+	if req.PathPrefix != "" {
+		pathPrefix = filepath.Clean(req.PathPrefix)
+		if filepath.IsAbs(pathPrefix) || pathPrefix == "." || strings.HasPrefix(pathPrefix, "..") {
+			c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid pathPrefix: %w", db.ErrInvalidAPIToken)))
+			return
+		}
+	}
+
+	tokenStr, err := genAPIToken()
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	tokenID := h.deps.ID().Gen()
+	err = h.deps.APITokens().AddAPIToken(c, &db.APIToken{
+		ID:         tokenID,
+		UserID:     userID,
+		Name:       req.Name,
+		TokenHash:  hashAPIToken(tokenStr),
+		Scopes:     req.Scopes,
+		PathPrefix: pathPrefix,
+		ExpireAt:   req.ExpireAt,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidAPIToken) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	// the token is only returned once, only its hash is stored
+	c.JSON(200, &AddAPITokenResp{ID: fmt.Sprint(tokenID), Token: tokenStr})
+}
+
+func (h *MultiUsersSvc) DelAPIToken(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Query(q.APITokenIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid token ID %w", err)))
+		return
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	err = h.deps.APITokens().DelAPIToken(c, userID, tokenID)
+	if err != nil {
+		if errors.Is(err, db.ErrAPITokenNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type ListAPITokensResp struct {
+	Tokens []*db.APIToken `json:"tokens"`
+}
+
+func (h *MultiUsersSvc) ListAPITokens(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	tokens, err := h.deps.APITokens().ListAPITokens(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListAPITokensResp{Tokens: tokens})
+}
@@ -0,0 +1,274 @@
+package multiusers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+type AddGroupReq struct {
+	Name  string         `json:"name"`
+	Quota *db.GroupQuota `json:"quota"`
+}
+
+type AddGroupResp struct {
+	ID string `json:"id"`
+}
+
+func (h *MultiUsersSvc) AddGroup(c *gin.Context) {
+	req := &AddGroupReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	var err error
+	if err = h.isValidGroupName(req.Name); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	quota := req.Quota
+	if quota == nil {
+		quota = &db.GroupQuota{
+			SpaceLimit: int64(h.cfg.IntOr("Users.SpaceLimit", 100*1024*1024)),
+		}
+	}
+
+	// TODO: following operations must be atomic
+	gid := h.deps.ID().Gen()
+	err = h.deps.Groups().AddGroup(c, &db.Group{
+		ID:    gid,
+		Name:  req.Name,
+		Quota: quota,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidGroup) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	if err = h.deps.FS().MkdirAll(q.GroupRootPath(req.Name, "/")); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	c.JSON(200, &AddGroupResp{ID: fmt.Sprint(gid)})
+}
+
+func (h *MultiUsersSvc) DelGroup(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Query(q.GroupIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid group ID %w", err)))
+		return
+	}
+
+	group, err := h.deps.Groups().GetGroup(c, groupID)
+	if err != nil {
+		if errors.Is(err, db.ErrGroupNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	// members may inherit quotas from the group
+	members, err := h.deps.Groups().ListGroupMembers(c, groupID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	// TODO: try to make following atomic
+	err = h.deps.Groups().DelGroup(c, groupID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	memberIDs := []uint64{}
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+	if err = h.refreshQuotas(c, memberIDs...); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	// TODO: move the folder to recycle bin when it failed to remove it
+	if err = h.deps.FS().Remove(q.GroupRootPath(group.Name, "/")); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type ListGroupsResp struct {
+	Groups []*db.Group `json:"groups"`
+}
+
+func (h *MultiUsersSvc) ListGroups(c *gin.Context) {
+	groups, err := h.deps.Groups().ListGroups(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListGroupsResp{Groups: groups})
+}
+
+type SetGroupQuotaReq struct {
+	ID    uint64         `json:"id,string"`
+	Quota *db.GroupQuota `json:"quota"`
+}
+
+func (h *MultiUsersSvc) SetGroupQuota(c *gin.Context) {
+	req := &SetGroupQuotaReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	err := h.deps.Groups().SetGroupQuota(c, req.ID, req.Quota)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidQuota) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrGroupNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type SetGroupMemberReq struct {
+	GroupID uint64 `json:"groupID,string"`
+	UserID  uint64 `json:"userID,string"`
+	Perm    string `json:"perm"`
+}
+
+func (h *MultiUsersSvc) SetGroupMember(c *gin.Context) {
+	req := &SetGroupMemberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	err := h.deps.Groups().SetGroupMember(c, req.GroupID, req.UserID, req.Perm)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidGroupPerm) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrGroupNotFound) || errors.Is(err, db.ErrUserNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	if err = h.refreshQuotas(c, req.UserID); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+func (h *MultiUsersSvc) DelGroupMember(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Query(q.GroupIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid group ID %w", err)))
+		return
+	}
+	userID, err := strconv.ParseUint(c.Query(q.UserIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid users ID %w", err)))
+		return
+	}
+
+	err = h.deps.Groups().DelGroupMember(c, groupID, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	if err = h.refreshQuotas(c, userID); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type ListGroupMembersResp struct {
+	Members []*db.GroupMember `json:"members"`
+}
+
+func (h *MultiUsersSvc) ListGroupMembers(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Query(q.GroupIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid group ID %w", err)))
+		return
+	}
+
+	members, err := h.deps.Groups().ListGroupMembers(c, groupID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListGroupMembersResp{Members: members})
+}
+
+type MyGroup struct {
+	ID        uint64         `json:"id,string"`
+	Name      string         `json:"name"`
+	Perm      string         `json:"perm"`
+	Path      string         `json:"path"`
+	UsedSpace int64          `json:"usedSpace,string"`
+	Quota     *db.GroupQuota `json:"quota"`
+}
+
+type ListMyGroupsResp struct {
+	Groups []*MyGroup `json:"groups"`
+}
+
+func (h *MultiUsersSvc) ListMyGroups(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	userGroups, err := h.deps.Groups().ListUserGroups(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	groups := []*MyGroup{}
+	for _, userGroup := range userGroups {
+		groups = append(groups, &MyGroup{
+			ID:        userGroup.Group.ID,
+			Name:      userGroup.Group.Name,
+			Perm:      userGroup.Perm,
+			Path:      q.GroupRootPath(userGroup.Group.Name, "/"),
+			UsedSpace: userGroup.Group.UsedSpace,
+			Quota:     userGroup.Group.Quota,
+		})
+	}
+	c.JSON(200, &ListMyGroupsResp{Groups: groups})
+}
+
+func (h *MultiUsersSvc) isValidGroupName(groupName string) error {
+	if groupName == "" || groupName == "." || groupName == ".." {
+		return errors.New("invalid group name")
+	} else if strings.ContainsAny(groupName, `/\`) {
+		return errors.New("group name can not contain path separators")
+	}
+	return nil
+}
@@ -7,16 +7,15 @@ import (
 	"net/http"
 	"path/filepath"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ihexxa/gocfg"
 	qradix "github.com/ihexxa/q-radix/v3"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ihexxa/quickshare/src/db"
 	"github.com/ihexxa/quickshare/src/depidx"
 	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/oidc"
 )
 
 var (
@@ -29,6 +28,10 @@ type MultiUsersSvc struct {
 	deps       *depidx.Deps
 	apiACRules map[string]bool
 	routeRules *qradix.RTree
+	// oidcProvider is nil if oidc is disabled
+	oidcProvider *oidc.Provider
+	// loginAttemptsPrunedAt is a unix timestamp which is accessed atomically
+	loginAttemptsPrunedAt int64
 }
 
 func NewMultiUsersSvc(cfg gocfg.ICfg, deps *depidx.Deps) (*MultiUsersSvc, error) {
@@ -166,10 +169,11 @@ func NewMultiUsersSvc(cfg gocfg.ICfg, deps *depidx.Deps) (*MultiUsersSvc, error)
 	}
 
 	handlers := &MultiUsersSvc{
-		cfg:        cfg,
-		deps:       deps,
-		apiACRules: apiACRules,
-		routeRules: routeRulesTree,
+		cfg:          cfg,
+		deps:         deps,
+		apiACRules:   apiACRules,
+		routeRules:   routeRulesTree,
+		oidcProvider: newOIDCProvider(cfg),
 	}
 
 	return handlers, nil
@@ -182,25 +186,34 @@ type LoginReq struct {
 	CaptchaInput string `json:"captchaInput"`
 }
 
+type LoginResp struct {
+	Token string `json:"token,omitempty"`
+	// MFAToken is returned instead of Token when the second factor is needed
+	MFARequired       bool   `json:"mfaRequired,omitempty"`
+	MFAEnrollRequired bool   `json:"mfaEnrollRequired,omitempty"`
+	MFAToken          string `json:"mfaToken,omitempty"`
+}
+
 func (h *MultiUsersSvc) Login(c *gin.Context) {
 	req := &LoginReq{}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(q.ErrResp(c, 400, err))
 		return
 	}
+	auditDetail := ""
+	defer func() {
+		q.AuditAs(c, h.deps.Auditor(), req.User, db.AuditActionLogin, req.User, auditDetail)
+	}()
 
-	// TODO: add rate limiter for verifying
-	// captchaEnabled := h.cfg.BoolOr("Users.CaptchaEnabled", true)
-	// if captchaEnabled {
-	// 	if !captcha.VerifyString(req.CaptchaID, req.CaptchaInput) {
-	// 		c.JSON(q.ErrResp(c, 403, errors.New("login failed")))
-	// 		return
-	// 	}
-	// }
+	if code, err := h.checkLoginAttempt(c, req.User, req.CaptchaID, req.CaptchaInput, true); err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
 
 	user, err := h.deps.Users().GetUserByName(c, req.User)
 	if err != nil {
 		if errors.Is(err, db.ErrUserNotFound) {
+			h.recordLoginFailure(c, req.User, loginReasonUserNotFound, true)
 			c.JSON(q.ErrResp(c, 403, err))
 			return
 		}
@@ -208,22 +221,65 @@ func (h *MultiUsersSvc) Login(c *gin.Context) {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Pwd), []byte(req.Pwd))
+	err = comparePwd(c, user.Pwd, req.Pwd)
 	if err != nil {
+		h.recordLoginFailure(c, req.User, loginReasonInvalidPwd, true)
 		c.JSON(q.ErrResp(c, 403, err))
 		return
+	} else if user.Role == db.PendingRole {
+		c.JSON(q.ErrResp(c, 403, ErrUserPending))
+		return
+	}
+
+	// the second factor is verified in MFALogin
+	mfa, err := h.getMFA(c, user.ID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	mfaEnabled := mfa != nil && mfa.Enabled
+	if mfaEnabled || h.isMFARequired(user) {
+		// the login is audited again after the second factor is verified
+		auditDetail = "2fa required"
+		mfaToken, err := h.newMFAToken(user.ID)
+		if err != nil {
+			c.JSON(q.ErrResp(c, 500, err))
+			return
+		}
+		c.JSON(200, &LoginResp{
+			MFARequired:       true,
+			MFAEnrollRequired: !mfaEnabled,
+			MFAToken:          mfaToken,
+		})
+		return
 	}
 
+	token, err := h.issueToken(c, user)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	h.deps.LoginLimiter().Succeed(user.Name, c.ClientIP())
+
+	c.JSON(200, &LoginResp{Token: token})
+}
+
+// issueToken issues the session JWT for the user and sets it in the cookie
+func (h *MultiUsersSvc) issueToken(c *gin.Context, user *db.User) (string, error) {
 	ttl := h.cfg.GrabInt("Users.CookieTTL")
+	session, err := h.newSession(c, user.ID, int64(ttl))
+	if err != nil {
+		return "", err
+	}
 	token, err := h.deps.Token().ToToken(map[string]string{
-		q.UserIDParam: fmt.Sprint(user.ID),
-		q.UserParam:   user.Name,
-		q.RoleParam:   user.Role,
-		q.ExpireParam: fmt.Sprintf("%d", time.Now().Unix()+int64(ttl)),
+		q.UserIDParam:    fmt.Sprint(user.ID),
+		q.UserParam:      user.Name,
+		q.RoleParam:      user.Role,
+		q.ExpireParam:    fmt.Sprintf("%d", session.ExpireAt),
+		q.SessionIDParam: session.ID,
 	})
 	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
-		return
+		return "", err
 	}
 
 	// secure := h.cfg.GrabBool("Users.CookieSecure")
@@ -249,14 +305,18 @@ func (h *MultiUsersSvc) Login(c *gin.Context) {
 		log.Println("Warning: SameSite=None cookie without Secure=true will likely be rejected by browsers.")
 	}
 	http.SetCookie(c.Writer, cookie)
-
-	c.JSON(200, gin.H{"token": token})
+	return token, nil
 }
 
 type LogoutReq struct{}
 
 func (h *MultiUsersSvc) Logout(c *gin.Context) {
 	// token alreay verified in the authn middleware
+	if err := h.revokeCurrentSession(c); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
 	// secure := h.cfg.GrabBool("Users.CookieSecure")
 	// httpOnly := h.cfg.GrabBool("Users.CookieHttpOnly")
 	cookie := &http.Cookie{
@@ -298,6 +358,7 @@ func (h *MultiUsersSvc) SetPwd(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 403, err))
 		return
 	}
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionSetPwd, claims[q.UserIDParam], "")
 
 	uid, err := strconv.ParseUint(claims[q.UserIDParam], 10, 64)
 	if err != nil {
@@ -311,13 +372,13 @@ func (h *MultiUsersSvc) SetPwd(c *gin.Context) {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Pwd), []byte(req.OldPwd))
+	err = comparePwd(c, user.Pwd, req.OldPwd)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 403, ErrInvalidUser))
 		return
 	}
 
-	newHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPwd), 10)
+	newHash, err := hashPwd(c, req.NewPwd)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, errors.New("fail to set password")))
 		return
@@ -329,6 +390,11 @@ func (h *MultiUsersSvc) SetPwd(c *gin.Context) {
 		return
 	}
 
+	// all sessions are revoked by the store, the current device gets a new session
+	if _, err = h.issueToken(c, user); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
 	c.JSON(q.Resp(200))
 }
 
@@ -349,6 +415,7 @@ func (h *MultiUsersSvc) ForceSetPwd(c *gin.Context) {
 		c.JSON(q.ErrResp(c, 500, err))
 		return
 	}
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionForceSetPwd, req.ID, "")
 	targetUser, err := h.deps.Users().GetUser(c, targetUID)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, err))
@@ -359,7 +426,7 @@ func (h *MultiUsersSvc) ForceSetPwd(c *gin.Context) {
 		return
 	}
 
-	newHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPwd), 10)
+	newHash, err := hashPwd(c, req.NewPwd)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 500, errors.New("fail to set password")))
 		return
@@ -391,6 +458,8 @@ func (h *MultiUsersSvc) AddUser(c *gin.Context) {
 		return
 	}
 
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionAddUser, req.Name, fmt.Sprintf("role=%s", req.Role))
+
 	// Role and duplicated name will be validated by the store
 	var err error
 	if err = h.isValidUserName(req.Name); err != nil {
@@ -401,45 +470,64 @@ func (h *MultiUsersSvc) AddUser(c *gin.Context) {
 		return
 	}
 
-	uid := h.deps.ID().Gen()
-	pwdHash, err := bcrypt.GenerateFromPassword([]byte(req.Pwd), 10)
+	uid, err := h.createUser(c, req.Name, req.Pwd, req.Role, nil)
 	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
+		if errors.Is(err, db.ErrRoleNotFound) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
 		return
 	}
 
+	c.JSON(200, &AddUserResp{ID: fmt.Sprint(uid)})
+}
+
+// createUser creates the user and prepares the home folders, default quotas are used if quota is nil
+func (h *MultiUsersSvc) createUser(c *gin.Context, name, pwd, role string, quota *db.Quota) (uint64, error) {
+	uid := h.deps.ID().Gen()
+	pwdHash, err := hashPwd(c, pwd)
+	if err != nil {
+		return 0, err
+	}
+
 	// TODO: following operations must be atomic
 	// TODO: check if the folders already exists
-	fsRootFolder := q.FsRootPath(req.Name, "/")
+	fsRootFolder := q.FsRootPath(name, "/")
 	if err = h.deps.FS().MkdirAll(fsRootFolder); err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
-		return
+		return 0, err
 	}
-	uploadFolder := q.UploadFolder(req.Name)
+	uploadFolder := q.UploadFolder(name)
 	if err = h.deps.FS().MkdirAll(uploadFolder); err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
-		return
+		return 0, err
 	}
 
 	newPreferences := db.DefaultPreferences
-	err = h.deps.Users().AddUser(c, &db.User{
-		ID:   uid,
-		Name: req.Name,
-		Pwd:  string(pwdHash),
-		Role: req.Role,
-		Quota: &db.Quota{
-			SpaceLimit:         int64(h.cfg.IntOr("Users.SpaceLimit", 100*1024*1024)), // TODO: support int64
-			UploadSpeedLimit:   h.cfg.IntOr("Users.UploadSpeedLimit", 100*1024),
-			DownloadSpeedLimit: h.cfg.IntOr("Users.DownloadSpeedLimit", 100*1024),
-		},
+	newUser := &db.User{
+		ID:          uid,
+		Name:        name,
+		Pwd:         string(pwdHash),
+		Role:        role,
+		Quota:       h.defaultQuota(),
 		Preferences: &newPreferences,
-	})
+	}
+	err = h.deps.Users().AddUser(c, newUser)
 	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
-		return
+		return 0, err
 	}
 
-	c.JSON(200, &AddUserResp{ID: fmt.Sprint(uid)})
+	// the quota is inherited from policies unless it is specified
+	if quota != nil {
+		err = h.setUserQuota(c, newUser, quota)
+	} else {
+		err = h.refreshQuotas(c, uid)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	h.fireUserCreated(c, newUser)
+	return uid, nil
 }
 
 type DelUserResp struct {
@@ -448,6 +536,8 @@ type DelUserResp struct {
 
 func (h *MultiUsersSvc) DelUser(c *gin.Context) {
 	userIDStr := c.Query(q.UserIDParam)
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionDelUser, userIDStr, "")
+
 	userID, err := strconv.ParseUint(userIDStr, 10, 64)
 	if err != nil {
 		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid users ID %w", err)))
@@ -508,7 +598,8 @@ func (h *MultiUsersSvc) ListUsers(c *gin.Context) {
 }
 
 type AddRoleReq struct {
-	Role string `json:"role"`
+	Role  string        `json:"role"`
+	Rules []*db.APIRule `json:"rules"`
 }
 
 func (h *MultiUsersSvc) AddRole(c *gin.Context) {
@@ -524,9 +615,18 @@ func (h *MultiUsersSvc) AddRole(c *gin.Context) {
 		return
 	}
 
-	err = h.deps.Users().AddRole(req.Role)
+	err = h.deps.Users().AddRole(c, &db.Role{
+		Name:  req.Role,
+		Rules: req.Rules,
+	})
 	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
+		if errors.Is(err, db.ErrInvalidRole) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrKeyExisting) {
+			c.JSON(q.ErrResp(c, 409, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
 		return
 	}
 
@@ -550,9 +650,48 @@ func (h *MultiUsersSvc) DelRole(c *gin.Context) {
 		return
 	}
 
-	err = h.deps.Users().DelRole(req.Role)
+	err = h.deps.Users().DelRole(c, req.Role)
 	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
+		if errors.Is(err, db.ErrRoleNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else if errors.Is(err, db.ErrRoleInUse) {
+			c.JSON(q.ErrResp(c, 409, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	c.JSON(q.Resp(200))
+}
+
+type SetRoleRulesReq struct {
+	Role  string        `json:"role"`
+	Rules []*db.APIRule `json:"rules"`
+}
+
+func (h *MultiUsersSvc) SetRoleRules(c *gin.Context) {
+	var err error
+	req := &SetRoleRulesReq{}
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	if err = h.isValidRole(req.Role); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	err = h.deps.Users().SetRoleRules(c, req.Role, req.Rules)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidRole) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrRoleNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
 		return
 	}
 
@@ -562,35 +701,40 @@ func (h *MultiUsersSvc) DelRole(c *gin.Context) {
 type ListRolesReq struct{}
 type ListRolesResp struct {
 	Roles map[string]bool `json:"roles"`
+	// rules of custom roles, predefined roles' rules are built-in
+	Rules map[string][]*db.APIRule `json:"rules"`
 }
 
 func (h *MultiUsersSvc) ListRoles(c *gin.Context) {
-	// TODO: currently roles are hardcoded
-	c.JSON(200, &ListRolesResp{
+	roles, err := h.deps.Users().ListRoles(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	resp := &ListRolesResp{
 		Roles: map[string]bool{
 			db.AdminRole:   true,
 			db.UserRole:    true,
 			db.VisitorRole: true,
-		}})
+		},
+		Rules: map[string][]*db.APIRule{},
+	}
+	for _, role := range roles {
+		resp.Roles[role.Name] = true
+		resp.Rules[role.Name] = role.Rules
+	}
+	c.JSON(200, resp)
 }
 
+// getUserInfo returns claims which are verified and set by AuthN,
+// they may come from the cookie or an api token
 func (h *MultiUsersSvc) getUserInfo(c *gin.Context) (map[string]string, error) {
-	tokenStr, err := c.Cookie(q.TokenCookie)
-	if err != nil {
-		return nil, err
+	claims := map[string]string{}
+	for _, key := range []string{q.UserIDParam, q.UserParam, q.RoleParam, q.ExpireParam} {
+		claims[key] = c.GetString(key)
 	}
-	claims, err := h.deps.Token().FromToken(
-		tokenStr,
-		map[string]string{
-			q.UserIDParam: "",
-			q.UserParam:   "",
-			q.RoleParam:   "",
-			q.ExpireParam: "",
-		},
-	)
-	if err != nil {
-		return nil, err
-	} else if claims[q.UserIDParam] == "" || claims[q.UserParam] == "" {
+	if claims[q.UserIDParam] == "" || claims[q.UserParam] == "" {
 		return nil, ErrInvalidConfig
 	}
 
@@ -601,6 +745,8 @@ func (h *MultiUsersSvc) isValidUserName(userName string) error {
 	minUserNameLen := h.cfg.GrabInt("Users.MinUserNameLen")
 	if len(userName) < minUserNameLen {
 		return errors.New("name is too short")
+	} else if userName == db.GroupsLocation {
+		return errors.New("name is reserved")
 	}
 	return nil
 }
@@ -614,7 +760,7 @@ func (h *MultiUsersSvc) isValidPwd(pwd string) error {
 }
 
 func (h *MultiUsersSvc) isValidRole(role string) error {
-	if role == db.AdminRole || role == db.UserRole || role == db.VisitorRole {
+	if db.IsPredefinedRole(role) {
 		return errors.New("predefined roles can not be added/deleted")
 	}
 	return h.isValidUserName(role)
@@ -671,12 +817,17 @@ func (h *MultiUsersSvc) SetUser(c *gin.Context) {
 		return
 	}
 
-	err := h.deps.Users().SetInfo(c, req.ID, &db.User{
-		Role:  req.Role,
-		Quota: req.Quota,
-	})
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionSetUser, fmt.Sprint(req.ID), fmt.Sprintf("role=%s", req.Role))
+
+	err := h.setUserInfo(c, req.ID, req.Role, req.Quota)
 	if err != nil {
-		c.JSON(q.ErrResp(c, 500, err))
+		if errors.Is(err, db.ErrRoleNotFound) || errors.Is(err, db.ErrInvalidQuota) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrUserNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
 		return
 	}
 
@@ -0,0 +1,151 @@
+package multiusers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dchest/captcha"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/loginlimiter"
+)
+
+const (
+	loginReasonInvalidPwd     = "invalid_password"
+	loginReasonUserNotFound   = "user_not_found"
+	loginReasonLocked         = "locked"
+	loginReasonInvalidCaptcha = "invalid_captcha"
+	loginReasonInvalid2FA     = "invalid_2fa"
+
+	defaultLoginAttemptsLimit = 100
+	maxLoginAttemptsLimit     = 1000
+	// old attempts are pruned at most once in this interval
+	loginAttemptsPruneInterval = 3600
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many login attempts")
+	ErrUserLocked      = errors.New("user is temporarily locked")
+	ErrCaptchaRequired = errors.New("captcha is required")
+	ErrInvalidCaptcha  = errors.New("invalid captcha")
+)
+
+// checkLoginAttempt checks throttling before verifying credentials
+func (h *MultiUsersSvc) checkLoginAttempt(c *gin.Context, userName, captchaID, captchaInput string, checkCaptcha bool) (int, error) {
+	ip := c.ClientIP()
+	status := h.deps.LoginLimiter().Attempt(userName, ip)
+
+	if status.IPLimited {
+		// rate limited attempts are not recorded to avoid flooding the log
+		c.Header("Retry-After", "60")
+		return 429, ErrTooManyAttempts
+	}
+	if status.LockedUntil != 0 {
+		h.recordLoginFailure(c, userName, loginReasonLocked, false)
+		c.Header("Retry-After", fmt.Sprint(status.LockedUntil-time.Now().Unix()))
+		return 429, ErrUserLocked
+	}
+
+	if status.Delay > 0 {
+		select {
+		case <-time.After(status.Delay):
+		case <-c.Request.Context().Done():
+			return 400, c.Request.Context().Err()
+		}
+	}
+
+	if checkCaptcha && status.CaptchaRequired && h.cfg.BoolOr("Users.CaptchaEnabled", true) {
+		if captchaID == "" {
+			return 403, ErrCaptchaRequired
+		} else if !captcha.VerifyString(captchaID, captchaInput) {
+			h.recordLoginFailure(c, userName, loginReasonInvalidCaptcha, false)
+			return 403, ErrInvalidCaptcha
+		}
+	}
+	return 200, nil
+}
+
+// recordLoginFailure logs the failure for admins, it is also counted by the limiter if counted is true
+func (h *MultiUsersSvc) recordLoginFailure(c *gin.Context, userName, reason string, counted bool) *loginlimiter.Status {
+	ip := c.ClientIP()
+	var status *loginlimiter.Status
+	if counted {
+		status = h.deps.LoginLimiter().Fail(userName, ip)
+	}
+
+	now := time.Now().Unix()
+	err := h.deps.LoginAttempts().AddLoginAttempt(c, &db.LoginAttempt{
+		ID:        h.deps.ID().Gen(),
+		UserName:  userName,
+		IP:        ip,
+		Reason:    reason,
+		CreatedAt: now,
+	})
+	if err != nil {
+		h.deps.Log().Errorf("recordLoginFailure: add login attempt error: %s", err)
+	}
+
+	prunedAt := atomic.LoadInt64(&h.loginAttemptsPrunedAt)
+	if now-prunedAt >= loginAttemptsPruneInterval &&
+		atomic.CompareAndSwapInt64(&h.loginAttemptsPrunedAt, prunedAt, now) {
+		keepDays := h.cfg.IntOr("Users.LoginAttemptsKeepDays", 30)
+		if err = h.deps.LoginAttempts().DelLoginAttempts(c, now-int64(keepDays)*24*3600); err != nil {
+			h.deps.Log().Errorf("recordLoginFailure: prune login attempts error: %s", err)
+		}
+	}
+
+	if status != nil && status.LockedUntil != 0 {
+		h.deps.Log().Warnf("user(%s) is locked until %d after failures from %s", userName, status.LockedUntil, ip)
+	}
+	return status
+}
+
+type ListLoginAttemptsResp struct {
+	Attempts []*db.LoginAttempt `json:"attempts"`
+}
+
+// ListLoginAttempts lists failed logins, they can be filtered by the user name
+func (h *MultiUsersSvc) ListLoginAttempts(c *gin.Context) {
+	limit := defaultLoginAttemptsLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxLoginAttemptsLimit {
+			c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid limit: %s", limitStr)))
+			return
+		}
+	}
+
+	attempts, err := h.deps.LoginAttempts().ListLoginAttempts(c, c.Query(q.UserParam), limit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListLoginAttemptsResp{Attempts: attempts})
+}
+
+// UnlockUser lifts the lockout of the user before it expires
+func (h *MultiUsersSvc) UnlockUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Query(q.UserIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid user ID %w", err)))
+		return
+	}
+
+	user, err := h.deps.Users().GetUser(c, userID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	h.deps.LoginLimiter().Unlock(user.Name)
+	c.JSON(q.Resp(200))
+}
@@ -0,0 +1,437 @@
+package multiusers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/cryptoutil/totp"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	mfaIssuer        = "Quickshare"
+	mfaUserIDKey     = "mfauid"
+	mfaPurposeKey    = "mfapurpose"
+	mfaPurposeLogin  = "login"
+	mfaTokenTTL      = 300 // the second factor must be provided in 5 minutes
+	mfaSkew          = 1   // codes of the previous and the next steps are accepted for clock drifts
+	recoveryCodeNum  = 10
+	recoveryCodeSize = 5
+)
+
+var (
+	ErrMFAEnabled      = errors.New("2fa is already enabled")
+	ErrMFANotEnrolled  = errors.New("2fa is not enrolled")
+	ErrMFARequired     = errors.New("2fa is required for the role")
+	ErrInvalidMFACode  = errors.New("invalid 2fa code")
+	ErrInvalidMFAToken = errors.New("invalid or expired 2fa token")
+)
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// genRecoveryCodes returns codes for users and their hashes for storing
+func genRecoveryCodes() ([]string, []string, error) {
+	codes, hashes := []string{}, []string{}
+	for i := 0; i < recoveryCodeNum; i++ {
+		code, err := randHex(recoveryCodeSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		code = fmt.Sprintf("%s-%s", code[:recoveryCodeSize], code[recoveryCodeSize:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func (h *MultiUsersSvc) isMFARequired(user *db.User) bool {
+	return user.Role == db.AdminRole && h.cfg.BoolOr("Users.Require2FAForAdmins", false)
+}
+
+// getMFA returns nil if the user has never enrolled
+func (h *MultiUsersSvc) getMFA(c *gin.Context, userID uint64) (*db.MFA, error) {
+	mfa, err := h.deps.MFA().GetMFA(c, userID)
+	if err != nil {
+		if errors.Is(err, db.ErrMFANotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// newMFAToken issues a short-lived token which proves that the password is verified,
+// it can not be used as a session token as it has no session claims
+func (h *MultiUsersSvc) newMFAToken(userID uint64) (string, error) {
+	return h.deps.Token().ToToken(map[string]string{
+		mfaUserIDKey:  fmt.Sprint(userID),
+		mfaPurposeKey: mfaPurposeLogin,
+		q.ExpireParam: fmt.Sprint(time.Now().Unix() + mfaTokenTTL),
+	})
+}
+
+func (h *MultiUsersSvc) userFromMFAToken(c *gin.Context, token string) (*db.User, int, error) {
+	claims, err := h.deps.Token().FromToken(token, map[string]string{
+		mfaUserIDKey:  "",
+		mfaPurposeKey: "",
+		q.ExpireParam: "",
+	})
+	if err != nil || claims[mfaPurposeKey] != mfaPurposeLogin {
+		return nil, 401, ErrInvalidMFAToken
+	}
+	expire, err := strconv.ParseInt(claims[q.ExpireParam], 10, 64)
+	if err != nil || expire <= time.Now().Unix() {
+		return nil, 401, ErrInvalidMFAToken
+	}
+	userID, err := strconv.ParseUint(claims[mfaUserIDKey], 10, 64)
+	if err != nil {
+		return nil, 401, ErrInvalidMFAToken
+	}
+
+	user, err := h.deps.Users().GetUser(c, userID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			return nil, 401, ErrInvalidMFAToken
+		}
+		return nil, 500, err
+	}
+	return user, 200, nil
+}
+
+// verifyTOTP checks the code and marks its step as used to prevent replaying
+func (h *MultiUsersSvc) verifyTOTP(c *gin.Context, mfa *db.MFA, code string) (int, error) {
+	step, ok := totp.Validate(mfa.Secret, code, time.Now(), mfaSkew)
+	if !ok {
+		return 403, ErrInvalidMFACode
+	}
+	if err := h.deps.MFA().UseMFAStep(c, mfa.UserID, step); err != nil {
+		if errors.Is(err, db.ErrMFACodeUsed) {
+			return 403, err
+		}
+		return 500, err
+	}
+	return 200, nil
+}
+
+type MFAEnrollResp struct {
+	Secret string `json:"secret"`
+	// URI is rendered as a QR code by the client
+	URI string `json:"uri"`
+}
+
+// enrollMFA generates a new secret, 2FA is not enabled until a code is verified
+func (h *MultiUsersSvc) enrollMFA(c *gin.Context, user *db.User) (*MFAEnrollResp, int, error) {
+	mfa, err := h.getMFA(c, user.ID)
+	if err != nil {
+		return nil, 500, err
+	} else if mfa != nil && mfa.Enabled {
+		return nil, 409, ErrMFAEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, 500, err
+	}
+	if err = h.deps.MFA().SetMFASecret(c, user.ID, secret); err != nil {
+		return nil, 500, err
+	}
+	return &MFAEnrollResp{
+		Secret: secret,
+		URI:    totp.URI(mfaIssuer, user.Name, secret),
+	}, 200, nil
+}
+
+type MFAVerifyResp struct {
+	// RecoveryCodes are only returned once, only their hashes are stored
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// activateMFA enables the pending enrollment if the code is correct
+func (h *MultiUsersSvc) activateMFA(c *gin.Context, mfa *db.MFA, code string) (*MFAVerifyResp, int, error) {
+	step, ok := totp.Validate(mfa.Secret, code, time.Now(), mfaSkew)
+	if !ok {
+		return nil, 403, ErrInvalidMFACode
+	}
+	codes, hashes, err := genRecoveryCodes()
+	if err != nil {
+		return nil, 500, err
+	}
+	if err = h.deps.MFA().EnableMFA(c, mfa.UserID, hashes, step); err != nil {
+		return nil, 500, err
+	}
+	return &MFAVerifyResp{RecoveryCodes: codes}, 200, nil
+}
+
+func (h *MultiUsersSvc) EnrollMFA(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+	user, err := h.deps.Users().GetUser(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	resp, code, err := h.enrollMFA(c, user)
+	if err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+	c.JSON(200, resp)
+}
+
+type MFAVerifyReq struct {
+	Code string `json:"code"`
+}
+
+func (h *MultiUsersSvc) VerifyMFA(c *gin.Context) {
+	req := &MFAVerifyReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	mfa, err := h.getMFA(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	} else if mfa == nil {
+		c.JSON(q.ErrResp(c, 400, ErrMFANotEnrolled))
+		return
+	} else if mfa.Enabled {
+		c.JSON(q.ErrResp(c, 409, ErrMFAEnabled))
+		return
+	}
+
+	resp, code, err := h.activateMFA(c, mfa, req.Code)
+	if err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+	c.JSON(200, resp)
+}
+
+type MFAStatusResp struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+	Required          bool `json:"required"`
+}
+
+func (h *MultiUsersSvc) GetMFAStatus(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+	user, err := h.deps.Users().GetUser(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	mfa, err := h.getMFA(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	resp := &MFAStatusResp{Required: h.isMFARequired(user)}
+	if mfa != nil && mfa.Enabled {
+		resp.Enabled = true
+		resp.RecoveryCodesLeft = len(mfa.RecoveryCodes)
+	}
+	c.JSON(200, resp)
+}
+
+type DisableMFAReq struct {
+	Pwd  string `json:"pwd"`
+	Code string `json:"code"`
+}
+
+// DisableMFA requires both the password and a current code
+func (h *MultiUsersSvc) DisableMFA(c *gin.Context) {
+	req := &DisableMFAReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+	user, err := h.deps.Users().GetUser(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	if h.isMFARequired(user) {
+		c.JSON(q.ErrResp(c, 403, ErrMFARequired))
+		return
+	}
+	if err = comparePwd(c, user.Pwd, req.Pwd); err != nil {
+		c.JSON(q.ErrResp(c, 403, ErrInvalidUser))
+		return
+	}
+
+	mfa, err := h.getMFA(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	} else if mfa == nil || !mfa.Enabled {
+		c.JSON(q.ErrResp(c, 400, ErrMFANotEnrolled))
+		return
+	}
+	if code, err := h.verifyTOTP(c, mfa, req.Code); err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+
+	if err = h.deps.MFA().DelMFA(c, userID); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+// ResetUserMFA is for admins to remove 2FA of users who lost both their devices and recovery codes
+func (h *MultiUsersSvc) ResetUserMFA(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Query(q.UserIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid user ID %w", err)))
+		return
+	}
+
+	if err = h.deps.MFA().DelMFA(c, userID); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	if err = h.deps.Sessions().DelSessions(c, userID, ""); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type MFATokenReq struct {
+	MFAToken string `json:"mfaToken"`
+}
+
+// EnrollMFAForLogin is used by users who are required to enroll 2FA before logging in
+func (h *MultiUsersSvc) EnrollMFAForLogin(c *gin.Context) {
+	req := &MFATokenReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	user, code, err := h.userFromMFAToken(c, req.MFAToken)
+	if err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+
+	resp, code, err := h.enrollMFA(c, user)
+	if err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+	c.JSON(200, resp)
+}
+
+type MFALoginReq struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type MFALoginResp struct {
+	Token string `json:"token"`
+	// RecoveryCodes is only set when the login finishes a required enrollment
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+// MFALogin is the second step of logging in
+func (h *MultiUsersSvc) MFALogin(c *gin.Context) {
+	req := &MFALoginReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	user, code, err := h.userFromMFAToken(c, req.MFAToken)
+	if err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+	defer q.AuditAs(c, h.deps.Auditor(), user.Name, db.AuditActionLogin, user.Name, "2fa")
+	// the captcha is checked in the first step
+	if code, err := h.checkLoginAttempt(c, user.Name, "", "", false); err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+
+	mfa, err := h.getMFA(c, user.ID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	} else if mfa == nil {
+		c.JSON(q.ErrResp(c, 400, ErrMFANotEnrolled))
+		return
+	}
+
+	resp := &MFALoginResp{}
+	if !mfa.Enabled {
+		// finish the required enrollment
+		verifyResp, code, err := h.activateMFA(c, mfa, req.Code)
+		if err != nil {
+			if code == 403 {
+				h.recordLoginFailure(c, user.Name, loginReasonInvalid2FA, true)
+			}
+			c.JSON(q.ErrResp(c, code, err))
+			return
+		}
+		resp.RecoveryCodes = verifyResp.RecoveryCodes
+	} else if req.RecoveryCode != "" {
+		err = h.deps.MFA().UseRecoveryCode(c, user.ID, hashRecoveryCode(req.RecoveryCode))
+		if err != nil {
+			if errors.Is(err, db.ErrInvalidRecoveryCode) {
+				h.recordLoginFailure(c, user.Name, loginReasonInvalid2FA, true)
+				c.JSON(q.ErrResp(c, 403, err))
+			} else {
+				c.JSON(q.ErrResp(c, 500, err))
+			}
+			return
+		}
+	} else if code, err := h.verifyTOTP(c, mfa, req.Code); err != nil {
+		if code == 403 {
+			h.recordLoginFailure(c, user.Name, loginReasonInvalid2FA, true)
+		}
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+
+	resp.Token, err = h.issueToken(c, user)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	h.deps.LoginLimiter().Succeed(user.Name, c.ClientIP())
+	c.JSON(200, resp)
+}
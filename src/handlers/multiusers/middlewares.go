@@ -24,15 +24,25 @@ func (h *MultiUsersSvc) AuthN() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		enableAuth := h.cfg.GrabBool("Users.EnableAuth")
 		claims := map[string]string{
-			q.UserIDParam: "",
-			q.UserParam:   "",
-			q.RoleParam:   db.VisitorRole,
-			q.ExpireParam: "",
+			q.UserIDParam:    "",
+			q.UserParam:      "",
+			q.RoleParam:      db.VisitorRole,
+			q.ExpireParam:    "",
+			q.SessionIDParam: "",
 		}
 
 		if enableAuth {
 			token, err := c.Cookie(q.TokenCookie)
-			if err != nil {
+			if bearer := c.GetHeader("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+				apiToken, apiClaims, code, err := h.authByAPIToken(c, strings.TrimPrefix(bearer, "Bearer "))
+				if err != nil {
+					c.AbortWithStatusJSON(q.ErrResp(c, code, err))
+					return
+				}
+				claims = apiClaims
+				c.Set(q.APITokenIDParam, fmt.Sprint(apiToken.ID))
+				c.Set(q.TokenPathPrefixParam, apiToken.PathPrefix)
+			} else if err != nil {
 				if err != http.ErrNoCookie {
 					c.AbortWithStatusJSON(q.ErrResp(c, 401, err))
 					return
@@ -54,6 +64,11 @@ func (h *MultiUsersSvc) AuthN() gin.HandlerFunc {
 					c.AbortWithStatusJSON(q.ErrResp(c, 401, ErrExpired))
 					return
 				}
+
+				if code, err := h.checkSession(c, claims, now); err != nil {
+					c.AbortWithStatusJSON(q.ErrResp(c, code, err))
+					return
+				}
 			}
 			// set default values if token is empty
 		} else {
@@ -80,15 +95,23 @@ func (h *MultiUsersSvc) APIAccessControl() gin.HandlerFunc {
 			c.AbortWithStatusJSON(q.ErrResp(c, 403, q.ErrAccessDenied))
 		}
 
+		// custom roles are able to access what visitors can access
+		isCustomRole := !db.IsPredefinedRole(role)
+		roles := []string{role}
+		if isCustomRole {
+			roles = append(roles, db.VisitorRole)
+		}
+
 		// v2 ac control
 		matches := h.routeRules.GetAllPrefixMatches(accessPath)
-		key := fmt.Sprintf("%s:%s", role, method)
 		matched := false
 		for _, matchedRules := range matches {
 			matchedRuleMap := matchedRules.(map[string]bool)
-			if matchedRuleMap[key] {
-				matched = true
-				break
+			for _, r := range roles {
+				if matchedRuleMap[fmt.Sprintf("%s:%s", r, method)] {
+					matched = true
+					break
+				}
 			}
 		}
 
@@ -102,7 +125,13 @@ func (h *MultiUsersSvc) APIAccessControl() gin.HandlerFunc {
 			return
 		}
 
-		if h.apiACRules[apiRuleCname(role, method, accessPath)] {
+		for _, r := range roles {
+			if h.apiACRules[apiRuleCname(r, method, accessPath)] {
+				c.Next()
+				return
+			}
+		}
+		if isCustomRole && h.customRoleAllows(c, role, method, accessPath) {
 			c.Next()
 			return
 		} else if accessPath == "/" || // TODO: temporarily allow accessing static resources
@@ -117,3 +146,21 @@ func (h *MultiUsersSvc) APIAccessControl() gin.HandlerFunc {
 		c.AbortWithStatusJSON(q.ErrResp(c, 403, q.ErrAccessDenied))
 	}
 }
+
+// customRoleAllows checks rules of the custom role which are stored in the db
+func (h *MultiUsersSvc) customRoleAllows(c *gin.Context, role, method, accessPath string) bool {
+	customRole, err := h.deps.Users().GetRole(c, role)
+	if err != nil {
+		if !errors.Is(err, db.ErrRoleNotFound) {
+			h.deps.Log().Errorf("APIAccessControl: get role(%s) error: %s", role, err)
+		}
+		return false
+	}
+
+	for _, rule := range customRole.Rules {
+		if rule.Match(method, accessPath) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package multiusers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ihexxa/gocfg"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/oidc"
+)
+
+const (
+	oidcCookie    = "oidc"
+	oidcStateKey  = "state"
+	oidcNonceKey  = "nonce"
+	oidcCookieTTL = 600 // the login must be finished in 10 minutes
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("oidc is disabled")
+	ErrOIDCState        = errors.New("oidc state not matched")
+	ErrOIDCNotLinked    = errors.New("the identity is not linked to any user")
+	ErrOIDCUserConflict = errors.New("the user name is taken")
+)
+
+// newOIDCProvider returns nil if oidc is not enabled
+func newOIDCProvider(cfg gocfg.ICfg) *oidc.Provider {
+	if !cfg.BoolOr("Users.OIDC.Enabled", false) {
+		return nil
+	}
+
+	clientSecret, ok := cfg.String("ENV.CLIENTSECRET")
+	if !ok || clientSecret == "" {
+		clientSecret = cfg.StringOr("Users.OIDC.ClientSecret", "")
+	}
+	return oidc.NewProvider(
+		cfg.StringOr("Users.OIDC.Issuer", ""),
+		cfg.StringOr("Users.OIDC.ClientID", ""),
+		clientSecret,
+		cfg.StringOr("Users.OIDC.RedirectURL", ""),
+		nil,
+	)
+}
+
+func randHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// OIDCLogin redirects the user to the identity provider
+func (h *MultiUsersSvc) OIDCLogin(c *gin.Context) {
+	if h.oidcProvider == nil {
+		c.JSON(q.ErrResp(c, 404, ErrOIDCDisabled))
+		return
+	}
+
+	state, err := randHex(16)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	nonce, err := randHex(16)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	authURL, err := h.oidcProvider.AuthCodeURL(c, state, nonce)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 502, err))
+		return
+	}
+
+	// state and nonce are kept in a signed cookie to make the flow stateless
+	flowToken, err := h.deps.Token().ToToken(map[string]string{
+		oidcStateKey:  state,
+		oidcNonceKey:  nonce,
+		q.ExpireParam: fmt.Sprint(time.Now().Unix() + oidcCookieTTL),
+	})
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    flowToken,
+		MaxAge:   oidcCookieTTL,
+		Path:     "/v2/public/oidc",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback verifies the authorization response, then logs the user in with the usual JWT
+func (h *MultiUsersSvc) OIDCCallback(c *gin.Context) {
+	if h.oidcProvider == nil {
+		c.JSON(q.ErrResp(c, 404, ErrOIDCDisabled))
+		return
+	}
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(q.ErrResp(c, 403, fmt.Errorf("oidc login failed: %s", errCode)))
+		return
+	}
+
+	flowToken, err := c.Cookie(oidcCookie)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, ErrOIDCState))
+		return
+	}
+	flow, err := h.deps.Token().FromToken(flowToken, map[string]string{
+		oidcStateKey:  "",
+		oidcNonceKey:  "",
+		q.ExpireParam: "",
+	})
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, ErrOIDCState))
+		return
+	}
+	expire, err := strconv.ParseInt(flow[q.ExpireParam], 10, 64)
+	if err != nil || expire <= time.Now().Unix() {
+		c.JSON(q.ErrResp(c, 400, ErrOIDCState))
+		return
+	} else if c.Query("state") == "" || c.Query("state") != flow[oidcStateKey] {
+		c.JSON(q.ErrResp(c, 400, ErrOIDCState))
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:   oidcCookie,
+		Value:  "",
+		MaxAge: -1,
+		Path:   "/v2/public/oidc",
+	})
+
+	rawIDToken, err := h.oidcProvider.Exchange(c, c.Query("code"))
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+	claims, err := h.oidcProvider.Verify(c, rawIDToken, flow[oidcNonceKey])
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	user, code, err := h.oidcUser(c, claims)
+	if err != nil {
+		c.JSON(q.ErrResp(c, code, err))
+		return
+	}
+	defer q.AuditAs(c, h.deps.Auditor(), user.Name, db.AuditActionLogin, user.Name, "oidc")
+
+	// 2FA is not asked here, it is delegated to the identity provider
+	if _, err = h.issueToken(c, user); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.Redirect(http.StatusFound, h.cfg.StringOr("Users.OIDC.PostLoginURL", "/"))
+}
+
+// oidcUser finds the user linked to the identity, it may link or provision the user according to configs
+func (h *MultiUsersSvc) oidcUser(c *gin.Context, claims map[string]interface{}) (*db.User, int, error) {
+	issuer := h.oidcProvider.Issuer()
+	subject, _ := claims["sub"].(string)
+	role, roleMapped := h.oidcRole(claims)
+
+	identity, err := h.deps.Identities().GetIdentity(c, issuer, subject)
+	if err == nil {
+		user, err := h.deps.Users().GetUser(c, identity.UserID)
+		if err != nil {
+			return nil, 500, err
+		}
+		return h.syncOIDCRole(c, user, role, roleMapped)
+	} else if !errors.Is(err, db.ErrIdentityNotFound) {
+		return nil, 500, err
+	}
+
+	usernameClaim := h.cfg.StringOr("Users.OIDC.UsernameClaim", "")
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	userName, _ := claims[usernameClaim].(string)
+	if err = h.isValidUserName(userName); err != nil {
+		return nil, 403, fmt.Errorf("invalid %s claim: %w", usernameClaim, err)
+	}
+
+	user, err := h.deps.Users().GetUserByName(c, userName)
+	if err == nil {
+		if !h.cfg.BoolOr("Users.OIDC.LinkExisting", false) || !canLinkOIDC(user, claims) {
+			return nil, 409, ErrOIDCUserConflict
+		}
+	} else if errors.Is(err, db.ErrUserNotFound) {
+		if !h.cfg.BoolOr("Users.OIDC.AutoProvision", false) {
+			return nil, 403, ErrOIDCNotLinked
+		}
+
+		// the password is random and unknown, the user can only log in through sso
+		pwd, err := randHex(32)
+		if err != nil {
+			return nil, 500, err
+		}
+		uid, err := h.createUser(c, userName, pwd, role, nil)
+		if err != nil {
+			if errors.Is(err, db.ErrRoleNotFound) {
+				return nil, 400, err
+			}
+			return nil, 500, err
+		}
+		if user, err = h.deps.Users().GetUser(c, uid); err != nil {
+			return nil, 500, err
+		}
+		roleMapped = false
+	} else {
+		return nil, 500, err
+	}
+
+	err = h.deps.Identities().AddIdentity(c, &db.Identity{
+		Issuer:  issuer,
+		Subject: subject,
+		UserID:  user.ID,
+	})
+	if err != nil {
+		return nil, 500, err
+	}
+	return h.syncOIDCRole(c, user, role, roleMapped)
+}
+
+// canLinkOIDC checks if the identity could be linked to the existing user of the same name,
+// names are chosen freely in some identity providers, so the email verified by the provider must match the user's email,
+// and the root admin, admins and the visitor are never linked
+func canLinkOIDC(user *db.User, claims map[string]interface{}) bool {
+	if user.ID == db.RootID || user.ID == db.VisitorID || user.Role == db.AdminRole {
+		return false
+	}
+
+	// some providers send email_verified as a string
+	verified := false
+	switch val := claims["email_verified"].(type) {
+	case bool:
+		verified = val
+	case string:
+		verified = val == "true"
+	}
+	email, _ := claims["email"].(string)
+	email = strings.TrimSpace(email)
+	return verified &&
+		email != "" &&
+		user.Preferences != nil &&
+		strings.EqualFold(email, strings.TrimSpace(user.Preferences.Email))
+}
+
+// oidcRole maps values of the role claim to a role, the first matched value wins
+func (h *MultiUsersSvc) oidcRole(claims map[string]interface{}) (string, bool) {
+	defaultRole := h.cfg.StringOr("Users.OIDC.DefaultRole", "")
+	if defaultRole == "" {
+		defaultRole = db.UserRole
+	}
+	roleClaim := h.cfg.StringOr("Users.OIDC.RoleClaim", "")
+	if roleClaim == "" {
+		return defaultRole, false
+	}
+
+	roleMapping, ok := h.cfg.MapOr("Users.OIDC.RoleMapping", map[string]string{}).(map[string]string)
+	if !ok {
+		return defaultRole, false
+	}
+	for _, val := range oidc.ClaimStrings(claims, roleClaim) {
+		if role, ok := roleMapping[val]; ok {
+			return role, true
+		}
+	}
+	return defaultRole, false
+}
+
+// syncOIDCRole updates the user's role when it is mapped from claims
+func (h *MultiUsersSvc) syncOIDCRole(c *gin.Context, user *db.User, role string, roleMapped bool) (*db.User, int, error) {
+	if user.Role == db.BannedRole {
+		return nil, 403, q.ErrAccessDenied
+	} else if user.Role == db.PendingRole {
+		return nil, 403, ErrUserPending
+	} else if !roleMapped || user.Role == role || user.ID == 0 {
+		// the root admin's role is never changed
+		return user, 200, nil
+	}
+
+	user.Role = role
+	if err := h.deps.Users().SetInfo(c, user.ID, user); err != nil {
+		if errors.Is(err, db.ErrRoleNotFound) {
+			return nil, 400, err
+		}
+		return nil, 500, err
+	}
+	if err := h.refreshQuotas(c, user.ID); err != nil {
+		return nil, 500, err
+	}
+	return user, 200, nil
+}
@@ -0,0 +1,172 @@
+package multiusers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/mailer"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *MultiUsersSvc) resetLink(token string) string {
+	resetURL := h.cfg.StringOr("Mail.ResetURL", "")
+	if resetURL == "" {
+		return token
+	}
+	sep := "?"
+	if strings.Contains(resetURL, "?") {
+		sep = "&"
+	}
+	return resetURL + sep + "token=" + url.QueryEscape(token)
+}
+
+// sendResetMail generates a single-use reset token and mails its link to the user
+func (h *MultiUsersSvc) sendResetMail(ctx context.Context, user *db.User) error {
+	token, err := randHex(24)
+	if err != nil {
+		return err
+	}
+	ttl := h.cfg.IntOr("Mail.ResetTokenTTL", 0)
+	if ttl <= 0 {
+		ttl = 1800 // 30min
+	}
+	now := time.Now()
+	err = h.deps.PwdResets().AddPwdReset(
+		ctx,
+		hashResetToken(token),
+		user.ID,
+		now.Add(time.Duration(ttl)*time.Second).Unix(),
+		now.Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	siteName := "Quickshare"
+	if siteCfg, err := h.deps.SiteStore().GetCfg(ctx); err == nil && siteCfg.ClientCfg != nil {
+		siteName = siteCfg.ClientCfg.SiteName
+	}
+	mail, err := h.deps.Mailer().Render(mailer.TmplPwdReset, []string{user.Preferences.Email}, map[string]string{
+		"SiteName":   siteName,
+		"UserName":   user.Name,
+		"Token":      token,
+		"Link":       h.resetLink(token),
+		"ExpireMins": fmt.Sprint(ttl / 60),
+	})
+	if err != nil {
+		return err
+	}
+	return mailer.Post(h.deps.Workers(), h.deps.ID().Gen(), mail)
+}
+
+type ForgetPwdReq struct {
+	Name string `json:"name"`
+}
+
+// ForgetPwd mails a reset link to the user's email, it always succeeds to avoid leaking users
+func (h *MultiUsersSvc) ForgetPwd(c *gin.Context) {
+	if !h.deps.Mailer().Enabled() {
+		c.JSON(q.ErrResp(c, 501, mailer.ErrMailDisabled))
+		return
+	}
+	req := &ForgetPwdReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	// it shares the IP limits of logins
+	if status := h.deps.LoginLimiter().Attempt("", c.ClientIP()); status.IPLimited {
+		c.Header("Retry-After", "60")
+		c.JSON(q.ErrResp(c, 429, ErrTooManyAttempts))
+		return
+	}
+
+	user, err := h.deps.Users().GetUserByName(c, req.Name)
+	if err != nil {
+		if !errors.Is(err, db.ErrUserNotFound) {
+			h.deps.Log().Errorf("ForgetPwd: get user error: %s", err)
+		}
+		c.JSON(q.Resp(200))
+		return
+	} else if user.Preferences == nil || user.Preferences.Email == "" || user.Role == db.BannedRole {
+		c.JSON(q.Resp(200))
+		return
+	}
+
+	// failures are only logged, or they would tell that the user exists
+	if err = h.sendResetMail(c, user); err != nil {
+		h.deps.Log().Errorf("ForgetPwd: send reset mail error: %s", err)
+	}
+	c.JSON(q.Resp(200))
+}
+
+type ResetPwdReq struct {
+	Token  string `json:"token"`
+	NewPwd string `json:"newPwd"`
+}
+
+func (h *MultiUsersSvc) ResetPwd(c *gin.Context) {
+	req := &ResetPwdReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	if err := h.isValidPwd(req.NewPwd); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	// the actor and the target are known after the token is used
+	actor, target := "", ""
+	defer func() {
+		q.AuditAs(c, h.deps.Auditor(), actor, db.AuditActionResetPwd, target, "token")
+	}()
+
+	userID, err := h.deps.PwdResets().UsePwdReset(c, hashResetToken(req.Token), time.Now().Unix())
+	if err != nil {
+		if errors.Is(err, db.ErrPwdResetNotFound) || errors.Is(err, db.ErrPwdResetExpired) {
+			c.JSON(q.ErrResp(c, 403, ErrInvalidResetToken))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	target = fmt.Sprint(userID)
+	user, err := h.deps.Users().GetUser(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	actor = user.Name
+
+	newHash, err := hashPwd(c, req.NewPwd)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, errors.New("fail to set password")))
+		return
+	}
+	// sessions are revoked by the store
+	err = h.deps.Users().SetPwd(c, user.ID, string(newHash))
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	h.deps.LoginLimiter().Unlock(user.Name)
+
+	c.JSON(q.Resp(200))
+}
@@ -0,0 +1,154 @@
+package multiusers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+// defaultQuota is inherited by users if no policy is matched
+func (h *MultiUsersSvc) defaultQuota() *db.Quota {
+	return &db.Quota{
+		SpaceLimit:         int64(h.cfg.IntOr("Users.SpaceLimit", 100*1024*1024)), // TODO: support int64
+		UploadSpeedLimit:   h.cfg.IntOr("Users.UploadSpeedLimit", 100*1024),
+		DownloadSpeedLimit: h.cfg.IntOr("Users.DownloadSpeedLimit", 100*1024),
+	}
+}
+
+// refreshQuotas resolves users' effective quotas, e.g. after their roles or groups are changed
+func (h *MultiUsersSvc) refreshQuotas(ctx context.Context, userIDs ...uint64) error {
+	updated, err := h.deps.QuotaPolicies().RefreshQuotas(ctx, userIDs, h.defaultQuota())
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		h.deps.Limiter().ResetQuotas()
+	}
+	return nil
+}
+
+// setUserQuota overrides the user's inherited quota
+func (h *MultiUsersSvc) setUserQuota(ctx context.Context, user *db.User, quota *db.Quota) error {
+	_, err := h.deps.QuotaPolicies().SetQuotaPolicy(
+		ctx,
+		&db.QuotaPolicy{
+			SubjectType: db.QuotaPolicyUser,
+			Subject:     fmt.Sprint(user.ID),
+			Quota:       quota,
+		},
+		h.defaultQuota(),
+	)
+	if err != nil {
+		return err
+	}
+	h.deps.Limiter().ResetQuotas()
+	return nil
+}
+
+// setUserInfo sets the user's role, the quota becomes an override if it differs from the effective one
+func (h *MultiUsersSvc) setUserInfo(ctx context.Context, userID uint64, role string, quota *db.Quota) error {
+	user, err := h.deps.Users().GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = h.deps.Users().SetInfo(ctx, userID, &db.User{
+		Role:  role,
+		Quota: user.Quota,
+	})
+	if err != nil {
+		return err
+	}
+
+	if quota != nil && !db.CompareQuotas(quota, user.Quota) {
+		return h.setUserQuota(ctx, user, quota)
+	} else if role != user.Role {
+		return h.refreshQuotas(ctx, userID)
+	}
+	return nil
+}
+
+type SetQuotaPolicyReq struct {
+	SubjectType string    `json:"subjectType"`
+	Subject     string    `json:"subject"`
+	Quota       *db.Quota `json:"quota"`
+}
+
+type QuotaPolicyResp struct {
+	// Updated is the number of users whose effective quotas are changed
+	Updated int `json:"updated"`
+}
+
+func (h *MultiUsersSvc) SetQuotaPolicy(c *gin.Context) {
+	req := &SetQuotaPolicyReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	updated, err := h.deps.QuotaPolicies().SetQuotaPolicy(
+		c,
+		&db.QuotaPolicy{
+			SubjectType: req.SubjectType,
+			Subject:     req.Subject,
+			Quota:       req.Quota,
+		},
+		h.defaultQuota(),
+	)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidQuotaPolicy) ||
+			errors.Is(err, db.ErrInvalidQuota) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrRoleNotFound) ||
+			errors.Is(err, db.ErrGroupNotFound) ||
+			errors.Is(err, db.ErrUserNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	h.deps.Limiter().ResetQuotas()
+	c.JSON(200, &QuotaPolicyResp{Updated: updated})
+}
+
+func (h *MultiUsersSvc) DelQuotaPolicy(c *gin.Context) {
+	subjectType := c.Query(q.SubjectTypeParam)
+	subject := c.Query(q.SubjectParam)
+
+	updated, err := h.deps.QuotaPolicies().DelQuotaPolicy(c, subjectType, subject, h.defaultQuota())
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidQuotaPolicy) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else if errors.Is(err, db.ErrQuotaPolicyNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	h.deps.Limiter().ResetQuotas()
+	c.JSON(200, &QuotaPolicyResp{Updated: updated})
+}
+
+type ListQuotaPoliciesResp struct {
+	Policies []*db.QuotaPolicy `json:"policies"`
+	// Default is inherited by users if no policy is matched
+	Default *db.Quota `json:"default"`
+}
+
+func (h *MultiUsersSvc) ListQuotaPolicies(c *gin.Context) {
+	policies, err := h.deps.QuotaPolicies().ListQuotaPolicies(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListQuotaPoliciesResp{Policies: policies, Default: h.defaultQuota()})
+}
@@ -0,0 +1,336 @@
+package multiusers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dchest/captcha"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	// RegistrationClosed disables registering, only admins can add users
+	RegistrationClosed = "closed"
+	// RegistrationOpen allows anyone to register
+	RegistrationOpen = "open"
+	// RegistrationInvite requires invite codes
+	RegistrationInvite = "invite"
+	// RegistrationApproval keeps users pending until admins approve them, unless invite codes are used
+	RegistrationApproval = "approval"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrInviteRequired     = errors.New("invite code is required")
+	ErrUserNameTaken      = errors.New("the user name is taken")
+	ErrUserPending        = errors.New("user is waiting for approval")
+	ErrUserNotPending     = errors.New("user is not pending")
+)
+
+func hashInviteCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *MultiUsersSvc) registrationMode() string {
+	switch mode := h.cfg.StringOr("Users.Registration", RegistrationClosed); mode {
+	case RegistrationOpen, RegistrationInvite, RegistrationApproval:
+		return mode
+	}
+	return RegistrationClosed
+}
+
+func (h *MultiUsersSvc) registrationRole() string {
+	role := h.cfg.StringOr("Users.RegistrationRole", "")
+	if role == "" {
+		return db.UserRole
+	}
+	return role
+}
+
+type GetRegistrationResp struct {
+	Mode string `json:"mode"`
+}
+
+// GetRegistration returns the registration mode for clients to show or hide the sign-up form
+func (h *MultiUsersSvc) GetRegistration(c *gin.Context) {
+	c.JSON(200, &GetRegistrationResp{Mode: h.registrationMode()})
+}
+
+type RegisterReq struct {
+	Name         string `json:"name"`
+	Pwd          string `json:"pwd"`
+	InviteCode   string `json:"inviteCode"`
+	CaptchaID    string `json:"captchaId"`
+	CaptchaInput string `json:"captchaInput"`
+}
+
+type RegisterResp struct {
+	ID string `json:"id"`
+	// Pending is true if the user can not log in until an admin approves it
+	Pending bool `json:"pending"`
+}
+
+func (h *MultiUsersSvc) Register(c *gin.Context) {
+	mode := h.registrationMode()
+	if mode == RegistrationClosed {
+		c.JSON(q.ErrResp(c, 403, ErrRegistrationClosed))
+		return
+	}
+
+	req := &RegisterReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	// registrations share the IP limits of logins
+	if status := h.deps.LoginLimiter().Attempt("", c.ClientIP()); status.IPLimited {
+		c.Header("Retry-After", "60")
+		c.JSON(q.ErrResp(c, 429, ErrTooManyAttempts))
+		return
+	}
+
+	var err error
+	if err = h.isValidUserName(req.Name); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	} else if err = h.isValidPwd(req.Pwd); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	if req.InviteCode == "" {
+		if mode == RegistrationInvite {
+			c.JSON(q.ErrResp(c, 403, ErrInviteRequired))
+			return
+		}
+		// invite codes are secrets issued by admins, captchas are only required without them
+		if h.cfg.BoolOr("Users.CaptchaEnabled", true) &&
+			!captcha.VerifyString(req.CaptchaID, req.CaptchaInput) {
+			c.JSON(q.ErrResp(c, 403, ErrInvalidCaptcha))
+			return
+		}
+	}
+
+	_, err = h.deps.Users().GetUserByName(c, req.Name)
+	if err == nil {
+		c.JSON(q.ErrResp(c, 409, ErrUserNameTaken))
+		return
+	} else if !errors.Is(err, db.ErrUserNotFound) {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	role := h.registrationRole()
+	var quota *db.Quota
+	var invite *db.Invite
+	if req.InviteCode != "" {
+		invite, err = h.deps.Invites().UseInvite(c, hashInviteCode(req.InviteCode), time.Now().Unix())
+		if err != nil {
+			if errors.Is(err, db.ErrInviteNotFound) ||
+				errors.Is(err, db.ErrInviteExpired) ||
+				errors.Is(err, db.ErrInviteUsedUp) {
+				c.JSON(q.ErrResp(c, 403, err))
+			} else {
+				c.JSON(q.ErrResp(c, 500, err))
+			}
+			return
+		}
+		role, quota = invite.Role, invite.Quota
+	} else if mode == RegistrationApproval {
+		role = db.PendingRole
+	}
+
+	uid, err := h.createUser(c, req.Name, req.Pwd, role, quota)
+	if err != nil {
+		if invite != nil {
+			if releaseErr := h.deps.Invites().ReleaseInvite(c, invite.ID); releaseErr != nil {
+				h.deps.Log().Errorf("Register: release invite error: %s", releaseErr)
+			}
+		}
+		if errors.Is(err, db.ErrRoleNotFound) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	c.JSON(200, &RegisterResp{ID: fmt.Sprint(uid), Pending: role == db.PendingRole})
+}
+
+type AddInviteReq struct {
+	Role string `json:"role"`
+	// Quota is optional, default quotas are used if it is nil
+	Quota   *db.Quota `json:"quota"`
+	MaxUses int       `json:"maxUses"`
+	// ExpireAt is a unix timestamp, 0 means the invite never expires
+	ExpireAt int64 `json:"expireAt,string"`
+}
+
+type AddInviteResp struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+}
+
+func (h *MultiUsersSvc) AddInvite(c *gin.Context) {
+	req := &AddInviteReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	now := time.Now().Unix()
+	if req.ExpireAt != 0 && req.ExpireAt <= now {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("expireAt is in the past: %w", db.ErrInvalidInvite)))
+		return
+	}
+	if req.Role == "" {
+		req.Role = h.registrationRole()
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+
+	code, err := randHex(16)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	inviteID := h.deps.ID().Gen()
+	err = h.deps.Invites().AddInvite(c, &db.Invite{
+		ID:        inviteID,
+		CodeHash:  hashInviteCode(code),
+		Role:      req.Role,
+		Quota:     req.Quota,
+		MaxUses:   req.MaxUses,
+		ExpireAt:  req.ExpireAt,
+		CreatedBy: userID,
+		CreatedAt: now,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidInvite) ||
+			errors.Is(err, db.ErrInvalidQuota) ||
+			errors.Is(err, db.ErrRoleNotFound) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	// the code is only returned once, only its hash is stored
+	c.JSON(200, &AddInviteResp{ID: fmt.Sprint(inviteID), Code: code})
+}
+
+func (h *MultiUsersSvc) DelInvite(c *gin.Context) {
+	inviteID, err := strconv.ParseUint(c.Query(q.InviteIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid invite ID %w", err)))
+		return
+	}
+
+	err = h.deps.Invites().DelInvite(c, inviteID)
+	if err != nil {
+		if errors.Is(err, db.ErrInviteNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type ListInvitesResp struct {
+	Invites []*db.Invite `json:"invites"`
+}
+
+func (h *MultiUsersSvc) ListInvites(c *gin.Context) {
+	invites, err := h.deps.Invites().ListInvites(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListInvitesResp{Invites: invites})
+}
+
+func (h *MultiUsersSvc) ListPendingUsers(c *gin.Context) {
+	users, err := h.deps.Users().ListUsers(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	pendingUsers := []*db.User{}
+	for _, user := range users {
+		if user.Role == db.PendingRole {
+			pendingUsers = append(pendingUsers, user)
+		}
+	}
+	c.JSON(200, &ListUsersResp{Users: pendingUsers})
+}
+
+type ApproveUserReq struct {
+	ID uint64 `json:"id,string"`
+	// Role is optional, the registration role is used if it is empty
+	Role string `json:"role"`
+}
+
+// ApproveUser activates the pending user, pending users are rejected by deleting them
+func (h *MultiUsersSvc) ApproveUser(c *gin.Context) {
+	req := &ApproveUserReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	if req.Role == "" {
+		req.Role = h.registrationRole()
+	} else if req.Role == db.PendingRole || req.Role == db.VisitorRole {
+		c.JSON(q.ErrResp(c, 400, db.ErrInvalidRole))
+		return
+	}
+
+	user, err := h.deps.Users().GetUser(c, req.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	} else if user.Role != db.PendingRole {
+		c.JSON(q.ErrResp(c, 400, ErrUserNotPending))
+		return
+	}
+
+	err = h.deps.Users().SetInfo(c, user.ID, &db.User{
+		Role:  req.Role,
+		Quota: user.Quota,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRoleNotFound) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	if err = h.refreshQuotas(c, user.ID); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
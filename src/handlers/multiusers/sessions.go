@@ -0,0 +1,192 @@
+package multiusers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	// last_seen is updated at most once in this interval to avoid writing the db in each request
+	sessionSeenInterval = 60
+	maxDeviceLen        = 256
+)
+
+var (
+	ErrSessionRevoked = errors.New("session is revoked")
+)
+
+func (h *MultiUsersSvc) newSession(c *gin.Context, userID uint64, ttl int64) (*db.Session, error) {
+	now := time.Now().Unix()
+	// expired sessions are cleaned in logins
+	if err := h.deps.Sessions().DelExpiredSessions(c, now); err != nil {
+		h.deps.Log().Errorf("newSession: delete expired sessions error: %s", err)
+	}
+
+	sessionID, err := randHex(16)
+	if err != nil {
+		return nil, err
+	}
+	device := c.Request.UserAgent()
+	if len(device) > maxDeviceLen {
+		device = device[:maxDeviceLen]
+	}
+	session := &db.Session{
+		ID:        sessionID,
+		UserID:    userID,
+		Device:    device,
+		IP:        c.ClientIP(),
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpireAt:  now + ttl,
+	}
+	if err = h.deps.Sessions().AddSession(c, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// checkSession checks if the session in the token is still alive
+func (h *MultiUsersSvc) checkSession(c *gin.Context, claims map[string]string, now int64) (int, error) {
+	session, err := h.deps.Sessions().GetSession(c, claims[q.SessionIDParam])
+	if err != nil {
+		if errors.Is(err, db.ErrSessionNotFound) {
+			return 401, ErrSessionRevoked
+		}
+		return 500, err
+	}
+	if fmt.Sprint(session.UserID) != claims[q.UserIDParam] {
+		return 401, ErrSessionRevoked
+	} else if session.ExpireAt <= now {
+		return 401, ErrExpired
+	}
+
+	ip := c.ClientIP()
+	if now-session.LastSeen >= sessionSeenInterval || session.IP != ip {
+		if err = h.deps.Sessions().SetSessionSeen(c, session.ID, ip, now); err != nil {
+			h.deps.Log().Errorf("checkSession: set session seen error: %s", err)
+		}
+	}
+	return 200, nil
+}
+
+func (h *MultiUsersSvc) revokeCurrentSession(c *gin.Context) error {
+	sessionID := c.GetString(q.SessionIDParam)
+	if sessionID == "" {
+		return nil
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		return err
+	}
+
+	err = h.deps.Sessions().DelSession(c, userID, sessionID)
+	if err != nil && !errors.Is(err, db.ErrSessionNotFound) {
+		return err
+	}
+	return nil
+}
+
+type SessionInfo struct {
+	*db.Session
+	Current bool `json:"current"`
+}
+
+type ListSessionsResp struct {
+	Sessions []*SessionInfo `json:"sessions"`
+}
+
+func (h *MultiUsersSvc) ListSessions(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	sessions, err := h.deps.Sessions().ListSessions(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	now := time.Now().Unix()
+	currentID := c.GetString(q.SessionIDParam)
+	infos := []*SessionInfo{}
+	for _, session := range sessions {
+		if session.ExpireAt <= now {
+			continue
+		}
+		infos = append(infos, &SessionInfo{
+			Session: session,
+			Current: session.ID == currentID,
+		})
+	}
+	c.JSON(200, &ListSessionsResp{Sessions: infos})
+}
+
+func (h *MultiUsersSvc) DelSession(c *gin.Context) {
+	sessionID := c.Query(q.SessionIDParam)
+	if sessionID == "" {
+		c.JSON(q.ErrResp(c, 400, errors.New("empty session ID")))
+		return
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	err = h.deps.Sessions().DelSession(c, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrSessionNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+// DelAllSessions logs the user out everywhere, including the current session
+func (h *MultiUsersSvc) DelAllSessions(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	if err = h.deps.Sessions().DelSessions(c, userID, ""); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:   q.TokenCookie,
+		Value:  "",
+		MaxAge: -1,
+		Path:   "/",
+	})
+	c.JSON(q.Resp(200))
+}
+
+// DelUserSessions revokes all sessions of the user for admins
+func (h *MultiUsersSvc) DelUserSessions(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Query(q.UserIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid users ID %w", err)))
+		return
+	}
+
+	if err = h.deps.Sessions().DelSessions(c, userID, ""); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(q.Resp(200))
+}
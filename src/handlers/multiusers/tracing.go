@@ -0,0 +1,22 @@
+package multiusers
+
+import (
+	"context"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ihexxa/quickshare/src/tracing"
+)
+
+// comparePwd is traced since bcrypt is slow by design
+func comparePwd(ctx context.Context, pwdHash, pwd string) error {
+	_, span := tracing.StartSpan(ctx, "multiusers.comparePwd")
+	defer span.End()
+	return bcrypt.CompareHashAndPassword([]byte(pwdHash), []byte(pwd))
+}
+
+func hashPwd(ctx context.Context, pwd string) ([]byte, error) {
+	_, span := tracing.StartSpan(ctx, "multiusers.hashPwd")
+	defer span.End()
+	return bcrypt.GenerateFromPassword([]byte(pwd), 10)
+}
@@ -0,0 +1,404 @@
+package multiusers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+
+	ImportCreate = "create"
+	ImportUpdate = "update"
+	ImportNone   = "none"
+	ImportError  = "error"
+)
+
+var (
+	ErrInvalidFormat    = errors.New("format must be json or csv")
+	ErrDuplicatedImport = errors.New("the user is duplicated in the import")
+	ErrPredefinedImport = errors.New("predefined users can not be imported")
+	importColumns       = []string{"name", "role", "pwd", "email", "spaceLimit", "uploadSpeedLimit", "downloadSpeedLimit"}
+	exportColumns       = []string{"id", "name", "role", "email", "spaceLimit", "uploadSpeedLimit", "downloadSpeedLimit", "usedSpace", "usedPercent"}
+	exportOnlyColumns   = map[string]bool{"id": true, "usedSpace": true, "usedPercent": true}
+)
+
+// ImportUser is a row of the import, quota fields are optional and 0 means the current or default value
+type ImportUser struct {
+	Name               string `json:"name"`
+	Role               string `json:"role"`
+	Pwd                string `json:"pwd"`
+	Email              string `json:"email"`
+	SpaceLimit         int64  `json:"spaceLimit"`
+	UploadSpeedLimit   int    `json:"uploadSpeedLimit"`
+	DownloadSpeedLimit int    `json:"downloadSpeedLimit"`
+}
+
+// quotaOf returns the quota with fields specified by the import, unspecified fields are from the base
+func (importUser *ImportUser) quotaOf(base *db.Quota) *db.Quota {
+	quota := *base
+	if importUser.SpaceLimit > 0 {
+		quota.SpaceLimit = importUser.SpaceLimit
+	}
+	if importUser.UploadSpeedLimit > 0 {
+		quota.UploadSpeedLimit = importUser.UploadSpeedLimit
+	}
+	if importUser.DownloadSpeedLimit > 0 {
+		quota.DownloadSpeedLimit = importUser.DownloadSpeedLimit
+	}
+	return &quota
+}
+
+type ImportResult struct {
+	// Row starts from 1, the CSV header is not counted
+	Row    int    `json:"row"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+	// Pwd is the generated password if it is not provided and it can not be reset by mail
+	Pwd         string `json:"pwd,omitempty"`
+	ResetMailed bool   `json:"resetMailed"`
+	Error       string `json:"error,omitempty"`
+}
+
+type ImportUsersResp struct {
+	DryRun  bool            `json:"dryRun"`
+	Results []*ImportResult `json:"results"`
+}
+
+func parseImportUsers(format string, data []byte) ([]*ImportUser, error) {
+	switch format {
+	case FormatJSON, "":
+		users := []*ImportUser{}
+		if err := json.Unmarshal(data, &users); err != nil {
+			return nil, err
+		}
+		return users, nil
+	case FormatCSV:
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	} else if len(rows) == 0 {
+		return nil, errors.New("the CSV header is missing")
+	}
+
+	colIndexes := map[string]int{}
+	for i, col := range rows[0] {
+		col = strings.TrimSpace(col)
+		found := false
+		for _, known := range importColumns {
+			if strings.EqualFold(col, known) {
+				colIndexes[known], found = i, true
+			}
+		}
+		if !found && !exportOnlyColumns[col] {
+			return nil, fmt.Errorf("unknown column: %s", col)
+		}
+	}
+	if _, ok := colIndexes["name"]; !ok {
+		return nil, errors.New("the name column is missing")
+	}
+
+	users := []*ImportUser{}
+	for i, row := range rows[1:] {
+		field := func(col string) string {
+			if idx, ok := colIndexes[col]; ok && idx < len(row) {
+				return strings.TrimSpace(row[idx])
+			}
+			return ""
+		}
+		number := func(col string) (int64, error) {
+			if val := field(col); val != "" {
+				num, err := strconv.ParseInt(val, 10, 64)
+				if err != nil {
+					return 0, fmt.Errorf("row %d: invalid %s: %w", i+1, col, err)
+				}
+				return num, nil
+			}
+			return 0, nil
+		}
+
+		user := &ImportUser{
+			Name:  field("name"),
+			Role:  field("role"),
+			Pwd:   field("pwd"),
+			Email: field("email"),
+		}
+		if user.SpaceLimit, err = number("spaceLimit"); err != nil {
+			return nil, err
+		}
+		uploadSpeedLimit, err := number("uploadSpeedLimit")
+		if err != nil {
+			return nil, err
+		}
+		downloadSpeedLimit, err := number("downloadSpeedLimit")
+		if err != nil {
+			return nil, err
+		}
+		user.UploadSpeedLimit, user.DownloadSpeedLimit = int(uploadSpeedLimit), int(downloadSpeedLimit)
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// ImportUsers creates or updates users by names, passwords of existing users are never changed,
+// so importing the same data again is a no-op
+func (h *MultiUsersSvc) ImportUsers(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	importUsers, err := parseImportUsers(c.Query(q.FormatParam), data)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	dryRun := c.Query(q.DryRunParam) == "true"
+
+	results := []*ImportResult{}
+	imported := map[string]bool{}
+	for i, importUser := range importUsers {
+		result := &ImportResult{Row: i + 1, Name: importUser.Name}
+		if imported[importUser.Name] {
+			result.Action, result.Error = ImportError, ErrDuplicatedImport.Error()
+		} else if err = h.importUser(c, importUser, result, dryRun); err != nil {
+			result.Action, result.Error = ImportError, err.Error()
+		}
+		imported[importUser.Name] = true
+		results = append(results, result)
+	}
+
+	c.JSON(200, &ImportUsersResp{DryRun: dryRun, Results: results})
+}
+
+func (h *MultiUsersSvc) importUser(c *gin.Context, importUser *ImportUser, result *ImportResult, dryRun bool) error {
+	if err := h.isValidUserName(importUser.Name); err != nil {
+		return err
+	}
+	if importUser.Role != "" {
+		if importUser.Role == db.VisitorRole {
+			return db.ErrInvalidRole
+		} else if !db.IsPredefinedRole(importUser.Role) {
+			if _, err := h.deps.Users().GetRole(c, importUser.Role); err != nil {
+				return err
+			}
+		}
+	}
+	quota := &db.Quota{
+		SpaceLimit:         importUser.SpaceLimit,
+		UploadSpeedLimit:   importUser.UploadSpeedLimit,
+		DownloadSpeedLimit: importUser.DownloadSpeedLimit,
+	}
+	if err := db.CheckQuota(quota); err != nil {
+		return err
+	}
+
+	user, err := h.deps.Users().GetUserByName(c, importUser.Name)
+	if err != nil {
+		if !errors.Is(err, db.ErrUserNotFound) {
+			return err
+		}
+		return h.importNewUser(c, importUser, result, dryRun)
+	} else if user.ID == 0 || user.ID == db.VisitorID { // 0=root, 1=visitor
+		return ErrPredefinedImport
+	}
+	result.ID = fmt.Sprint(user.ID)
+
+	newRole, newQuota := user.Role, importUser.quotaOf(user.Quota)
+	if importUser.Role != "" {
+		newRole = importUser.Role
+	}
+	infoChanged := newRole != user.Role || !db.CompareQuotas(newQuota, user.Quota)
+	emailChanged := importUser.Email != "" && importUser.Email != user.Preferences.Email
+
+	result.Action = ImportNone
+	if !infoChanged && !emailChanged {
+		return nil
+	}
+	result.Action = ImportUpdate
+	if dryRun {
+		return nil
+	}
+
+	if infoChanged {
+		err = h.setUserInfo(c, user.ID, newRole, newQuota)
+		q.AuditItem(c, h.deps.Auditor(), db.AuditActionSetUser, result.ID, fmt.Sprintf("role=%s; import", newRole), err)
+		if err != nil {
+			return err
+		}
+	}
+	if emailChanged {
+		prefers := *user.Preferences
+		prefers.Email = importUser.Email
+		if err = h.deps.Users().SetPreferences(c, user.ID, &prefers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *MultiUsersSvc) importNewUser(c *gin.Context, importUser *ImportUser, result *ImportResult, dryRun bool) error {
+	result.Action = ImportCreate
+	role := importUser.Role
+	if role == "" {
+		role = db.UserRole
+	}
+
+	pwd := importUser.Pwd
+	if pwd != "" {
+		if err := h.isValidPwd(pwd); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil
+	}
+
+	mailReset := false
+	if pwd == "" {
+		var err error
+		if pwd, err = randHex(8); err != nil {
+			return err
+		}
+		// users set their own passwords through the reset links if they can receive mails
+		mailReset = importUser.Email != "" && h.deps.Mailer().Enabled()
+		if !mailReset {
+			result.Pwd = pwd
+		}
+	}
+
+	// the quota is inherited from policies, and specified fields override it
+	uid, err := h.createUser(c, importUser.Name, pwd, role, nil)
+	var user *db.User
+	if err == nil {
+		result.ID = fmt.Sprint(uid)
+		user, err = h.deps.Users().GetUser(c, uid)
+	}
+	if err == nil {
+		if quota := importUser.quotaOf(user.Quota); !db.CompareQuotas(quota, user.Quota) {
+			err = h.setUserQuota(c, user, quota)
+		}
+	}
+	q.AuditItem(c, h.deps.Auditor(), db.AuditActionAddUser, importUser.Name, fmt.Sprintf("role=%s; import", role), err)
+	if err != nil {
+		return err
+	}
+
+	if importUser.Email == "" {
+		return nil
+	}
+	user.Preferences.Email = importUser.Email
+	if err = h.deps.Users().SetPreferences(c, uid, user.Preferences); err != nil {
+		return err
+	}
+	if mailReset {
+		if err = h.sendResetMail(c, user); err != nil {
+			// the user is created, admins can still reset the password
+			result.Error = fmt.Sprintf("failed to mail the reset link: %s", err)
+			return nil
+		}
+		result.ResetMailed = true
+	}
+	return nil
+}
+
+type ExportUser struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Role               string `json:"role"`
+	Email              string `json:"email"`
+	SpaceLimit         int64  `json:"spaceLimit"`
+	UploadSpeedLimit   int    `json:"uploadSpeedLimit"`
+	DownloadSpeedLimit int    `json:"downloadSpeedLimit"`
+	UsedSpace          int64  `json:"usedSpace"`
+	UsedPercent        int64  `json:"usedPercent"`
+}
+
+type ExportUsersResp struct {
+	Users []*ExportUser `json:"users"`
+}
+
+// ExportUsers exports users with their usages, the CSV export can be imported again
+func (h *MultiUsersSvc) ExportUsers(c *gin.Context) {
+	format := c.Query(q.FormatParam)
+	if format != "" && format != FormatJSON && format != FormatCSV {
+		c.JSON(q.ErrResp(c, 400, ErrInvalidFormat))
+		return
+	}
+
+	users, err := h.deps.Users().ListUsers(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	exportUsers := []*ExportUser{}
+	for _, user := range users {
+		// predefined users can not be imported
+		if user.ID == 0 || user.ID == db.VisitorID {
+			continue
+		}
+		exportUser := &ExportUser{
+			ID:        fmt.Sprint(user.ID),
+			Name:      user.Name,
+			Role:      user.Role,
+			UsedSpace: user.UsedSpace,
+		}
+		if user.Preferences != nil {
+			exportUser.Email = user.Preferences.Email
+		}
+		if user.Quota != nil {
+			exportUser.SpaceLimit = user.Quota.SpaceLimit
+			exportUser.UploadSpeedLimit = user.Quota.UploadSpeedLimit
+			exportUser.DownloadSpeedLimit = user.Quota.DownloadSpeedLimit
+			if user.Quota.SpaceLimit > 0 {
+				exportUser.UsedPercent = user.UsedSpace * 100 / user.Quota.SpaceLimit
+			}
+		}
+		exportUsers = append(exportUsers, exportUser)
+	}
+
+	if format != FormatCSV {
+		c.JSON(200, &ExportUsersResp{Users: exportUsers})
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	rows := [][]string{exportColumns}
+	for _, user := range exportUsers {
+		rows = append(rows, []string{
+			user.ID,
+			user.Name,
+			user.Role,
+			user.Email,
+			fmt.Sprint(user.SpaceLimit),
+			fmt.Sprint(user.UploadSpeedLimit),
+			fmt.Sprint(user.DownloadSpeedLimit),
+			fmt.Sprint(user.UsedSpace),
+			fmt.Sprint(user.UsedPercent),
+		})
+	}
+	if err = writer.WriteAll(rows); err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="users.csv"`)
+	c.Data(200, "text/csv; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,261 @@
+package multiusers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/webhook"
+)
+
+const (
+	WebhookIDParam = "hid"
+
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit     = 500
+)
+
+// UserWebhookData is the data of user.created posted to webhooks
+type UserWebhookData struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+func genWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// fireUserCreated triggers webhooks of user.created, the actor is the visitor if the user registers by itself
+func (h *MultiUsersSvc) fireUserCreated(c *gin.Context, user *db.User) {
+	actorID, err := q.GetUserId(c)
+	if err != nil {
+		actorID = db.VisitorID
+	}
+	h.deps.Webhooks().Fire(c, &webhook.Event{
+		Type:    db.WebhookEventUserCreated,
+		ActorID: actorID,
+		Data: &UserWebhookData{
+			ID:   fmt.Sprint(user.ID),
+			Name: user.Name,
+			Role: user.Role,
+		},
+	})
+}
+
+type AddWebhookReq struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Global webhooks receive events of all users, only admins can add them
+	Global bool `json:"global"`
+}
+
+type AddWebhookResp struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+func (h *MultiUsersSvc) AddWebhook(c *gin.Context) {
+	req := &AddWebhookReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	claims, err := h.getUserInfo(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+	userID, err := strconv.ParseUint(claims[q.UserIDParam], 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+	if req.Global && claims[q.RoleParam] != db.AdminRole {
+		c.JSON(q.ErrResp(c, 403, q.ErrAccessDenied))
+		return
+	}
+	if err = h.deps.Webhooks().CheckURL(req.URL); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	secret, err := genWebhookSecret()
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	hookID := h.deps.ID().Gen()
+	err = h.deps.WebhookStore().AddWebhook(c, &db.Webhook{
+		ID:        hookID,
+		UserID:    userID,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		Global:    req.Global,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidWebhook) {
+			c.JSON(q.ErrResp(c, 400, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+
+	// the secret is only returned once for verifying signatures
+	c.JSON(200, &AddWebhookResp{ID: fmt.Sprint(hookID), Secret: secret})
+}
+
+func (h *MultiUsersSvc) DelWebhook(c *gin.Context) {
+	hookID, err := strconv.ParseUint(c.Query(WebhookIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid webhook ID %w", err)))
+		return
+	}
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	err = h.deps.WebhookStore().DelWebhook(c, userID, hookID)
+	if err != nil {
+		if errors.Is(err, db.ErrWebhookNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	c.JSON(q.Resp(200))
+}
+
+type ListWebhooksResp struct {
+	Webhooks []*db.Webhook `json:"webhooks"`
+}
+
+func (h *MultiUsersSvc) ListWebhooks(c *gin.Context) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return
+	}
+
+	hooks, err := h.deps.WebhookStore().ListWebhooks(c, userID)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListWebhooksResp{Webhooks: hooks})
+}
+
+// getOwnWebhook returns the webhook if it belongs to the current user, or it responds the error
+func (h *MultiUsersSvc) getOwnWebhook(c *gin.Context, hookID uint64) (*db.Webhook, bool) {
+	userID, err := q.GetUserId(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 403, err))
+		return nil, false
+	}
+
+	hook, err := h.deps.WebhookStore().GetWebhook(c, hookID)
+	if err != nil {
+		if errors.Is(err, db.ErrWebhookNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return nil, false
+	} else if hook.UserID != userID {
+		// others' webhooks are reported as not found
+		c.JSON(q.ErrResp(c, 404, db.ErrWebhookNotFound))
+		return nil, false
+	}
+	return hook, true
+}
+
+type ListWebhookDeliveriesResp struct {
+	Deliveries []*db.WebhookDelivery `json:"deliveries"`
+}
+
+// ListWebhookDeliveries lists recent deliveries of the webhook, the latest comes first
+func (h *MultiUsersSvc) ListWebhookDeliveries(c *gin.Context) {
+	hookID, err := strconv.ParseUint(c.Query(WebhookIDParam), 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid webhook ID %w", err)))
+		return
+	}
+	limit := defaultWebhookDeliveriesLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxWebhookDeliveriesLimit {
+			c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid limit: %s", limitStr)))
+			return
+		}
+	}
+
+	hook, ok := h.getOwnWebhook(c, hookID)
+	if !ok {
+		return
+	}
+	deliveries, err := h.deps.WebhookStore().ListWebhookDeliveries(c, hook.ID, limit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ListWebhookDeliveriesResp{Deliveries: deliveries})
+}
+
+type ReplayWebhookDeliveryReq struct {
+	DeliveryID string `json:"deliveryID"`
+}
+
+type ReplayWebhookDeliveryResp struct {
+	ID string `json:"id"`
+}
+
+// ReplayWebhookDelivery posts the payload of the delivery again as a new delivery
+func (h *MultiUsersSvc) ReplayWebhookDelivery(c *gin.Context) {
+	req := &ReplayWebhookDeliveryReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	deliveryID, err := strconv.ParseUint(req.DeliveryID, 10, 64)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid delivery ID %w", err)))
+		return
+	}
+
+	delivery, err := h.deps.WebhookStore().GetWebhookDelivery(c, deliveryID)
+	if err != nil {
+		if errors.Is(err, db.ErrWebhookDeliveryNotFound) {
+			c.JSON(q.ErrResp(c, 404, err))
+		} else {
+			c.JSON(q.ErrResp(c, 500, err))
+		}
+		return
+	}
+	if _, ok := h.getOwnWebhook(c, delivery.HookID); !ok {
+		return
+	}
+
+	replayed, err := h.deps.Webhooks().Replay(c, delivery)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	c.JSON(200, &ReplayWebhookDeliveryResp{ID: fmt.Sprint(replayed.ID)})
+}
@@ -0,0 +1,181 @@
+package settings
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	ActorQuery  = "actor"
+	ActionQuery = "action"
+	TargetQuery = "target"
+	ResultQuery = "result"
+	FromQuery   = "from"
+	ToQuery     = "to"
+	CursorQuery = "cursor"
+	LimitQuery  = "limit"
+
+	defaultAuditLogsLimit = 100
+	maxAuditLogsLimit     = 1000
+	exportBatchSize       = 1000
+)
+
+var (
+	ErrInvalidFormat = errors.New("format must be csv or jsonl")
+
+	auditLogColumns = []string{"id", "createdAt", "actor", "ip", "action", "target", "detail", "result", "status"}
+)
+
+// getAuditLogFilter parses filters from queries, the cursor is the ID of the last listed log
+func getAuditLogFilter(c *gin.Context) (*db.AuditLogFilter, error) {
+	filter := &db.AuditLogFilter{
+		Actor:  c.Query(ActorQuery),
+		Action: c.Query(ActionQuery),
+		Target: c.Query(TargetQuery),
+		Result: c.Query(ResultQuery),
+	}
+
+	var err error
+	for name, val := range map[string]*int64{FromQuery: &filter.From, ToQuery: &filter.To} {
+		if valStr := c.Query(name); valStr != "" {
+			*val, err = strconv.ParseInt(valStr, 10, 64)
+			if err != nil || *val < 0 {
+				return nil, fmt.Errorf("invalid %s: %s", name, valStr)
+			}
+		}
+	}
+	if cursor := c.Query(CursorQuery); cursor != "" {
+		filter.BeforeID, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %s", cursor)
+		}
+	}
+	return filter, nil
+}
+
+type ListAuditLogsResp struct {
+	Logs []*db.AuditLog `json:"logs"`
+	// Cursor is used for listing the next page, it is empty if there are no more logs
+	Cursor string `json:"cursor"`
+}
+
+// ListAuditLogs lists audit logs matching filters, the latest comes first
+func (h *SettingsSvc) ListAuditLogs(c *gin.Context) {
+	filter, err := getAuditLogFilter(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+	limit := defaultAuditLogsLimit
+	if limitStr := c.Query(LimitQuery); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxAuditLogsLimit {
+			c.JSON(q.ErrResp(c, 400, fmt.Errorf("invalid limit: %s", limitStr)))
+			return
+		}
+	}
+
+	logs, err := h.deps.AuditLogs().ListAuditLogs(c, filter, limit)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+	cursor := ""
+	if len(logs) == limit {
+		cursor = fmt.Sprint(logs[len(logs)-1].ID)
+	}
+	c.JSON(200, &ListAuditLogsResp{Logs: logs, Cursor: cursor})
+}
+
+// ExportAuditLogs streams all logs matching filters as CSV or JSON lines
+func (h *SettingsSvc) ExportAuditLogs(c *gin.Context) {
+	format := c.Query(q.FormatParam)
+	if format == "" {
+		format = FormatJSONL
+	} else if format != FormatJSONL && format != FormatCSV {
+		c.JSON(q.ErrResp(c, 400, ErrInvalidFormat))
+		return
+	}
+	filter, err := getAuditLogFilter(c)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	// the first batch is listed before responding, so that errors can still be reported
+	logs, err := h.deps.AuditLogs().ListAuditLogs(c, filter, exportBatchSize)
+	if err != nil {
+		c.JSON(q.ErrResp(c, 500, err))
+		return
+	}
+
+	var writeLogs func(logs []*db.AuditLog) error
+	if format == FormatCSV {
+		c.Header("Content-Type", "text/csv")
+		writer := csv.NewWriter(c.Writer)
+		if err = writer.Write(auditLogColumns); err != nil {
+			return
+		}
+		writeLogs = func(logs []*db.AuditLog) error {
+			for _, log := range logs {
+				err := writer.Write([]string{
+					fmt.Sprint(log.ID),
+					fmt.Sprint(log.CreatedAt),
+					log.Actor,
+					log.IP,
+					log.Action,
+					log.Target,
+					log.Detail,
+					log.Result,
+					fmt.Sprint(log.Status),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		writeLogs = func(logs []*db.AuditLog) error {
+			for _, log := range logs {
+				if err := encoder.Encode(log); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit_logs.%s"`, format))
+	c.Status(200)
+
+	for {
+		if err = writeLogs(logs); err != nil {
+			h.deps.Log().Errorf("ExportAuditLogs: write error: %s", err)
+			return
+		} else if len(logs) < exportBatchSize {
+			return
+		}
+
+		filter.BeforeID = logs[len(logs)-1].ID
+		logs, err = h.deps.AuditLogs().ListAuditLogs(c, filter, exportBatchSize)
+		if err != nil {
+			// the status is sent, so the export is truncated
+			h.deps.Log().Errorf("ExportAuditLogs: list error: %s", err)
+			return
+		}
+	}
+}
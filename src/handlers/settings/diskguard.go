@@ -0,0 +1,92 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/diskguard"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+// writablePaths are still accepted in the read-only mode
+var writablePaths = map[string]bool{
+	"/v1/users/login":       true,
+	"/v1/users/logout":      true,
+	"/v2/public/login":      true,
+	"/v2/public/2fa/login":  true,
+	"/v2/my/logout":         true,
+	"/v2/admin/maintenance": true,
+}
+
+// diskGuardErrCode maps disk guard errors to status codes, it returns 500 for other errors
+func diskGuardErrCode(err error) int {
+	switch {
+	case errors.Is(err, diskguard.ErrLowSpace):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, diskguard.ErrReadOnly):
+		return http.StatusServiceUnavailable
+	}
+	return 500
+}
+
+// ReadOnlyGuard rejects write requests when the site is read-only, reading is still allowed,
+// and deleting is allowed when the space is low as it frees space, but not in the maintenance mode
+func (h *SettingsSvc) ReadOnlyGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if writablePaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		if err := h.deps.DiskGuard().CanWrite(0); err != nil {
+			if c.Request.Method == http.MethodDelete && errors.Is(err, diskguard.ErrLowSpace) {
+				c.Next()
+				return
+			}
+			c.AbortWithStatusJSON(q.ErrResp(c, diskGuardErrCode(err), err))
+			return
+		}
+		c.Next()
+	}
+}
+
+type HealthResp struct {
+	Disk *diskguard.Status `json:"disk"`
+}
+
+func (h *SettingsSvc) Health(c *gin.Context) {
+	c.JSON(200, &HealthResp{
+		Disk: h.deps.DiskGuard().Status(),
+	})
+}
+
+type MaintenanceReq struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+func (h *SettingsSvc) SetMaintenance(c *gin.Context) {
+	req := &MaintenanceReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(q.ErrResp(c, 400, err))
+		return
+	}
+
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionSetConfig, "maintenance", fmt.Sprintf("readOnly=%t", req.ReadOnly))
+
+	h.deps.DiskGuard().SetReadOnly(req.ReadOnly)
+	h.deps.Log().Infof("read-only maintenance mode is set to %t", req.ReadOnly)
+	c.JSON(q.Resp(200))
+}
+
+func (h *SettingsSvc) GetMaintenance(c *gin.Context) {
+	c.JSON(200, h.deps.DiskGuard().Status())
+}
@@ -23,11 +23,6 @@ func NewSettingsSvc(cfg gocfg.ICfg, deps *depidx.Deps) (*SettingsSvc, error) {
 	}, nil
 }
 
-func (h *SettingsSvc) Health(c *gin.Context) {
-	// TODO: currently it checks nothing
-	c.JSON(q.Resp(200))
-}
-
 type ClientCfgMsg struct {
 	ClientCfg      *db.ClientConfig `json:"clientCfg"`
 	CaptchaEnabled bool             `json:"captchaEnabled"`
@@ -55,6 +50,8 @@ func (h *SettingsSvc) SetClientCfg(c *gin.Context) {
 		return
 	}
 
+	defer q.Audit(c, h.deps.Auditor(), db.AuditActionSetConfig, "clientCfg", "")
+
 	// TODO: captchaEnabled is not persisted in db
 	clientCfg := req.ClientCfg
 	if err = validateClientCfg(clientCfg); err != nil {
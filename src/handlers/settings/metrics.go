@@ -0,0 +1,32 @@
+package settings
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihexxa/quickshare/src/metrics"
+)
+
+// otherRoute labels requests not matching any route (e.g. static files),
+// so that the cardinality of route labels is bounded
+const otherRoute = "other"
+
+// RequestMetrics observes counts and latencies of requests by route templates
+func (h *SettingsSvc) RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = otherRoute
+		}
+		h.deps.Metrics().ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// Metrics exports metrics in the Prometheus text exposition format
+func (h *SettingsSvc) Metrics(c *gin.Context) {
+	metrics.NewHandler(h.deps.Metrics(), h.deps.Log()).ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,45 @@
+package settings
+
+import (
+	"github.com/gin-gonic/gin"
+
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/tracing"
+)
+
+// RequestTracing starts the span of the request, which is the parent of spans in handlers,
+// the DB and the file system, it continues the trace if the traceparent header is provided
+func (h *SettingsSvc) RequestTracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = otherRoute
+		}
+		tracer := h.deps.Tracer()
+		ctx := tracer.Extract(c.Request.Context(), map[string]string{
+			tracing.TraceparentHeader: c.GetHeader(tracing.TraceparentHeader),
+		})
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route, tracing.SpanKindServer)
+		if span == nil {
+			c.Next()
+			return
+		}
+		defer span.End()
+
+		// handlers pass gin contexts to the DB, so the span is also set in the gin context
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(tracing.ContextKey, span)
+		c.Next()
+
+		span.SetAttr("http.method", c.Request.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("http.target", c.Request.URL.Path)
+		span.SetAttr("http.status_code", c.Writer.Status())
+		if userID := c.GetString(q.UserIDParam); userID != "" {
+			span.SetAttr("user.id", userID)
+		}
+		if err := c.Errors.Last(); err != nil {
+			span.SetError(err.Err)
+		}
+	}
+}
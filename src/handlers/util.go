@@ -20,14 +20,26 @@ var (
 	FsRootDir = "files"
 
 	UserIDParam    = "uid"
+	GroupIDParam   = "gid"
 	UserParam      = "user"
 	PwdParam       = "pwd"
 	NewPwdParam    = "newpwd"
 	RoleParam      = "role"
 	ExpireParam    = "expire"
+	SessionIDParam = "sid"
 	CaptchaIDParam = "capid"
-	TokenCookie    = "tk"
-	LastID         = "lid"
+	InviteIDParam  = "iid"
+	FormatParam    = "format"
+	DryRunParam    = "dryrun"
+	// quota policies' subjects
+	SubjectTypeParam = "type"
+	SubjectParam     = "subject"
+	TokenCookie      = "tk"
+	LastID           = "lid"
+
+	// set by AuthN when the request is authenticated by an api token
+	APITokenIDParam      = "atid"
+	TokenPathPrefixParam = "atprefix"
 
 	// DownloadChunkSize can not be greater than limiter's token count
 	// downloadSpeedLimit can not be lower than DownloadChunkSize
@@ -145,6 +157,11 @@ func UploadFolder(userName string) string {
 	return path.Join(userName, UploadDir)
 }
 
+func GroupRootPath(groupName, relFilePath string) string {
+	relFilePath = filepath.Clean(relFilePath)
+	return path.Join(db.GroupsLocation, groupName, relFilePath)
+}
+
 func GetUserInfo(tokenStr string, tokenEncDec cryptoutil.ITokenEncDec) (map[string]string, error) {
 	claims, err := tokenEncDec.FromToken(
 		tokenStr,
@@ -14,6 +14,8 @@ const cacheSizeLimit = 1024
 type ILimiter interface {
 	CanWrite(userID uint64, chunkSize int) (bool, error)
 	CanRead(userID uint64, chunkSize int) (bool, error)
+	// ResetQuotas drops cached quotas after users' quotas are changed
+	ResetQuotas()
 }
 
 type IOLimiter struct {
@@ -82,6 +84,13 @@ func (lm *IOLimiter) CanRead(id uint64, chunkSize int) (bool, error) {
 	), nil
 }
 
+func (lm *IOLimiter) ResetQuotas() {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+
+	lm.quotaCache = map[uint64]*db.Quota{}
+}
+
 func (lm *IOLimiter) clean() {
 	count := 0
 	for key := range lm.quotaCache {
@@ -0,0 +1,239 @@
+// Package loginlimiter throttles logins by user names and client IPs against brute-forcing
+package loginlimiter
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/golimiter"
+)
+
+const (
+	maxDelay = 10 * time.Second
+	// ips are limited in this cycle in millisecond
+	ipLimitCyc  = 60 * 1000
+	minCapacity = 16
+)
+
+type ILoginLimiter interface {
+	// Attempt returns the status before verifying credentials, it consumes the IP's quota
+	Attempt(user, ip string) *Status
+	// Fail records a failure and returns the updated status
+	Fail(user, ip string) *Status
+	Succeed(user, ip string)
+	Unlock(user string)
+}
+
+type Status struct {
+	// IPLimited is true if the IP makes too many attempts
+	IPLimited bool
+	// LockedUntil is a unix timestamp, it is 0 if the user is not locked
+	LockedUntil     int64
+	CaptchaRequired bool
+	Delay           time.Duration
+}
+
+type Config struct {
+	// Capacity limits numbers of tracked users, IPs and users of IPs
+	Capacity int
+	// MaxFailures is the number of failures of the user from an IP before locking the user on the IP,
+	// 0 disables lockouts
+	MaxFailures int
+	// AccountMaxFailures is the number of failures of the user from all IPs before locking the user on all IPs,
+	// it should be greater than MaxFailures so that an IP (e.g. behind NAT) can't lock out users by itself,
+	// 0 disables account lockouts
+	AccountMaxFailures int
+	// Lockout is also the window in which failures are counted
+	Lockout time.Duration
+	// CaptchaAfter is the number of failures of the user or the IP before requiring captchas, 0 disables captchas
+	CaptchaAfter int
+	// BaseDelay is doubled on each failure of the user from an IP
+	BaseDelay time.Duration
+	// IPAttempts is the number of attempts allowed for an IP in each minute
+	IPAttempts int
+}
+
+type record struct {
+	failures     int
+	lastFailedAt time.Time
+	lockedUntil  time.Time
+}
+
+// userIPKey is the key of failures of the user from the IP
+func userIPKey(user, ip string) string {
+	return user + "\x00" + ip
+}
+
+// LoginLimiter locks users and delays their logins by failures from each IP,
+// so that failures from others (e.g. guessing users' names) don't lock out users,
+// failures of users (from all IPs) and failures of IPs (for all users) only lead to captchas
+type LoginLimiter struct {
+	mtx       *sync.Mutex
+	cfg       *Config
+	ipLimiter *golimiter.Limiter
+	users     map[string]*record
+	ips       map[string]*record
+	userIPs   map[string]*record
+	now       func() time.Time
+}
+
+func NewLoginLimiter(cfg *Config) *LoginLimiter {
+	if cfg.Capacity < minCapacity {
+		cfg.Capacity = minCapacity
+	}
+	return &LoginLimiter{
+		mtx:       &sync.Mutex{},
+		cfg:       cfg,
+		ipLimiter: golimiter.New(cfg.Capacity, ipLimitCyc),
+		users:     map[string]*record{},
+		ips:       map[string]*record{},
+		userIPs:   map[string]*record{},
+		now:       time.Now,
+	}
+}
+
+func (lm *LoginLimiter) Attempt(user, ip string) *Status {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+
+	status := lm.status(user, ip)
+	if lm.cfg.IPAttempts > 0 && !lm.ipLimiter.Access(ip, lm.cfg.IPAttempts, 1) {
+		status.IPLimited = true
+	}
+	return status
+}
+
+func (lm *LoginLimiter) Fail(user, ip string) *Status {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+
+	now := lm.now()
+	userIPRecord := lm.get(lm.userIPs, userIPKey(user, ip), now, true)
+	userIPRecord.failures++
+	userIPRecord.lastFailedAt = now
+	if lm.cfg.MaxFailures > 0 && userIPRecord.failures >= lm.cfg.MaxFailures {
+		userIPRecord.lockedUntil = now.Add(lm.cfg.Lockout)
+	}
+
+	userRecord := lm.get(lm.users, user, now, true)
+	userRecord.failures++
+	userRecord.lastFailedAt = now
+	if lm.cfg.AccountMaxFailures > 0 && userRecord.failures >= lm.cfg.AccountMaxFailures {
+		userRecord.lockedUntil = now.Add(lm.cfg.Lockout)
+	}
+
+	ipRecord := lm.get(lm.ips, ip, now, true)
+	ipRecord.failures++
+	ipRecord.lastFailedAt = now
+
+	return lm.status(user, ip)
+}
+
+// Succeed resets the user's failures, failures of the IP are kept as it may try other users
+func (lm *LoginLimiter) Succeed(user, ip string) {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	delete(lm.users, user)
+	delete(lm.userIPs, userIPKey(user, ip))
+}
+
+// Unlock resets the user's failures from all IPs, e.g. after the password is reset
+func (lm *LoginLimiter) Unlock(user string) {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	delete(lm.users, user)
+	prefix := userIPKey(user, "")
+	for key := range lm.userIPs {
+		if strings.HasPrefix(key, prefix) {
+			delete(lm.userIPs, key)
+		}
+	}
+}
+
+func (lm *LoginLimiter) status(user, ip string) *Status {
+	now := lm.now()
+	status := &Status{}
+	userIPFailures, userFailures, ipFailures := 0, 0, 0
+
+	if userIPRecord := lm.get(lm.userIPs, userIPKey(user, ip), now, false); userIPRecord != nil {
+		if userIPRecord.lockedUntil.After(now) {
+			status.LockedUntil = userIPRecord.lockedUntil.Unix()
+		}
+		userIPFailures = userIPRecord.failures
+	}
+	// users attacked from many IPs are locked on all IPs
+	if userRecord := lm.get(lm.users, user, now, false); userRecord != nil {
+		if userRecord.lockedUntil.After(now) && userRecord.lockedUntil.Unix() > status.LockedUntil {
+			status.LockedUntil = userRecord.lockedUntil.Unix()
+		}
+		userFailures = userRecord.failures
+	}
+	if ipRecord := lm.get(lm.ips, ip, now, false); ipRecord != nil {
+		ipFailures = ipRecord.failures
+	}
+
+	// ips are shared by users behind NAT, so they only lead to captchas instead of delays
+	if lm.cfg.CaptchaAfter > 0 &&
+		(userFailures >= lm.cfg.CaptchaAfter || ipFailures >= lm.cfg.CaptchaAfter) {
+		status.CaptchaRequired = true
+	}
+	if userIPFailures > 0 && lm.cfg.BaseDelay > 0 {
+		status.Delay = lm.cfg.BaseDelay
+		for i := 1; i < userIPFailures && status.Delay < maxDelay; i++ {
+			status.Delay *= 2
+		}
+		if status.Delay > maxDelay {
+			status.Delay = maxDelay
+		}
+	}
+	return status
+}
+
+// get returns the record of the key, records are forgotten after lockouts or
+// if there is no failure in the lockout window
+func (lm *LoginLimiter) get(records map[string]*record, key string, now time.Time, create bool) *record {
+	rec, ok := records[key]
+	if ok && lm.isExpired(rec, now) {
+		delete(records, key)
+		rec, ok = nil, false
+	}
+	if ok || !create {
+		return rec
+	}
+
+	if len(records) >= lm.cfg.Capacity {
+		lm.clean(records, now)
+	}
+	rec = &record{}
+	records[key] = rec
+	return rec
+}
+
+func (lm *LoginLimiter) isExpired(rec *record, now time.Time) bool {
+	if !rec.lockedUntil.IsZero() {
+		return !rec.lockedUntil.After(now)
+	}
+	return rec.lastFailedAt.Add(lm.cfg.Lockout).Before(now)
+}
+
+// clean makes room for a new record, expired records (including ones whose lockouts end) are removed,
+// and the least recently failed one is evicted if all of them are alive, so the capacity is never exceeded
+func (lm *LoginLimiter) clean(records map[string]*record, now time.Time) {
+	for key, rec := range records {
+		if lm.isExpired(rec, now) {
+			delete(records, key)
+		}
+	}
+
+	for len(records) >= lm.cfg.Capacity {
+		oldestKey := ""
+		var oldest *record
+		for key, rec := range records {
+			if oldest == nil || rec.lastFailedAt.Before(oldest.lastFailedAt) {
+				oldestKey, oldest = key, rec
+			}
+		}
+		delete(records, oldestKey)
+	}
+}
@@ -0,0 +1,185 @@
+package loginlimiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(now *time.Time) *LoginLimiter {
+	lm := NewLoginLimiter(&Config{
+		Capacity:           100,
+		MaxFailures:        3,
+		AccountMaxFailures: 6,
+		Lockout:            time.Minute,
+		CaptchaAfter:       2,
+		BaseDelay:          time.Second,
+		IPAttempts:         5,
+	})
+	lm.now = func() time.Time { return *now }
+	return lm
+}
+
+func TestLoginLimiter(t *testing.T) {
+	t.Run("failures lead to delays, captchas and lockouts", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		lm := newTestLimiter(&now)
+
+		status := lm.Attempt("user", "1.1.1.1")
+		if status.Delay != 0 || status.CaptchaRequired || status.LockedUntil != 0 {
+			t.Fatalf("unexpected status %+v", status)
+		}
+
+		expects := []*Status{
+			{Delay: time.Second},
+			{Delay: 2 * time.Second, CaptchaRequired: true},
+			{Delay: 4 * time.Second, CaptchaRequired: true, LockedUntil: now.Unix() + 60},
+		}
+		for i, expected := range expects {
+			status = lm.Fail("user", "1.1.1.1")
+			if *status != *expected {
+				t.Fatalf("%d: expected %+v got %+v", i, expected, status)
+			}
+		}
+
+		// the lock is lifted after the lockout and failures are forgotten
+		now = now.Add(61 * time.Second)
+		status = lm.Attempt("user", "2.2.2.2")
+		if status.LockedUntil != 0 || status.CaptchaRequired || status.Delay != 0 {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("failures of an ip are counted across users", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		lm := newTestLimiter(&now)
+
+		for i := 0; i < 2; i++ {
+			lm.Fail(fmt.Sprintf("user%d", i), "1.1.1.1")
+		}
+		status := lm.Attempt("user9", "1.1.1.1")
+		if !status.CaptchaRequired || status.LockedUntil != 0 || status.Delay != 0 {
+			t.Fatalf("unexpected status %+v", status)
+		}
+		status = lm.Attempt("user9", "2.2.2.2")
+		if status.CaptchaRequired {
+			t.Fatalf("unexpected status %+v", status)
+		}
+
+		// succeeding does not reset the ip
+		lm.Succeed("user9", "1.1.1.1")
+		if status = lm.Attempt("user9", "1.1.1.1"); !status.CaptchaRequired {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("failures from other ips do not lock out users", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		lm := newTestLimiter(&now)
+
+		for i := 0; i < 5; i++ {
+			lm.Fail("user", fmt.Sprintf("1.1.1.%d", i))
+		}
+		status := lm.Attempt("user", "2.2.2.2")
+		if status.LockedUntil != 0 || status.Delay != 0 || !status.CaptchaRequired {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("users are locked after failures from many ips", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		lm := newTestLimiter(&now)
+
+		for i := 0; i < 6; i++ {
+			lm.Fail("user", fmt.Sprintf("1.1.1.%d", i))
+		}
+		status := lm.Attempt("user", "2.2.2.2")
+		if status.LockedUntil != now.Unix()+60 {
+			t.Fatalf("user should be locked on all ips %+v", status)
+		}
+		if status = lm.Attempt("user2", "2.2.2.2"); status.LockedUntil != 0 {
+			t.Fatalf("other users should not be locked %+v", status)
+		}
+
+		lm.Unlock("user")
+		if status = lm.Attempt("user", "2.2.2.2"); status.LockedUntil != 0 {
+			t.Fatalf("user should be unlocked %+v", status)
+		}
+
+		// the lock is lifted after the lockout
+		for i := 0; i < 6; i++ {
+			lm.Fail("user", fmt.Sprintf("1.1.1.%d", i))
+		}
+		now = now.Add(61 * time.Second)
+		if status = lm.Attempt("user", "2.2.2.2"); status.LockedUntil != 0 {
+			t.Fatalf("user should be unlocked %+v", status)
+		}
+	})
+
+	t.Run("succeeding and unlocking reset the user", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		lm := newTestLimiter(&now)
+
+		for i := 0; i < 3; i++ {
+			lm.Fail("user", "1.1.1.1")
+		}
+		if status := lm.Attempt("user", "1.1.1.1"); status.LockedUntil == 0 {
+			t.Fatalf("user should be locked %+v", status)
+		}
+		lm.Unlock("user")
+		status := lm.Attempt("user", "1.1.1.1")
+		if status.LockedUntil != 0 || status.Delay != 0 {
+			t.Fatalf("user should be unlocked %+v", status)
+		}
+
+		lm.Fail("user", "2.2.2.2")
+		lm.Succeed("user", "2.2.2.2")
+		if status := lm.Attempt("user", "2.2.2.2"); status.Delay != 0 {
+			t.Fatalf("failures should be reset %+v", status)
+		}
+	})
+
+	t.Run("attempts of an ip are limited", func(t *testing.T) {
+		now := time.Now()
+		lm := newTestLimiter(&now)
+
+		for i := 0; i < 5; i++ {
+			if status := lm.Attempt(fmt.Sprintf("user%d", i), "1.1.1.1"); status.IPLimited {
+				t.Fatalf("%d: ip should not be limited", i)
+			}
+		}
+		if status := lm.Attempt("user", "1.1.1.1"); !status.IPLimited {
+			t.Fatal("ip should be limited")
+		}
+		if status := lm.Attempt("user", "2.2.2.2"); status.IPLimited {
+			t.Fatal("other ips should not be limited")
+		}
+	})
+
+	t.Run("records are bounded by the capacity", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		lm := newTestLimiter(&now)
+
+		// locked records are also evicted by the capacity
+		for i := 0; i < 500; i++ {
+			for j := 0; j < 3; j++ {
+				lm.Fail(fmt.Sprintf("user%d", i%250), fmt.Sprintf("ip%d", i))
+			}
+		}
+		if len(lm.ips) > lm.cfg.Capacity ||
+			len(lm.users) > lm.cfg.Capacity ||
+			len(lm.userIPs) > lm.cfg.Capacity {
+			t.Fatalf("too many records %d %d %d", len(lm.ips), len(lm.users), len(lm.userIPs))
+		}
+		if status := lm.Attempt("user249", "ip499"); status.LockedUntil == 0 {
+			t.Fatalf("the latest lockout should be kept %+v", status)
+		}
+
+		// records are removed once their lockouts end
+		now = now.Add(61 * time.Second)
+		lm.Fail("user", "ip")
+		if len(lm.userIPs) != 1 {
+			t.Fatalf("expired records are not removed %d", len(lm.userIPs))
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/worker"
+	"github.com/ihexxa/quickshare/src/worker/localworker"
+)
+
+const (
+	MsgTypeMail = "mail"
+
+	TmplPwdReset     = "pwd_reset"
+	TmplUploaded     = "uploaded"
+	TmplDownloaded   = "downloaded"
+	TmplQuotaWarning = "quota_warning"
+)
+
+var ErrMailDisabled = errors.New("mail is disabled")
+
+// defaultTemplates are overridden by <name>.tmpl files in the templates dir,
+// the first line of a template is the subject and the rest is the body
+var defaultTemplates = map[string]string{
+	TmplPwdReset: `Reset your password of {{.SiteName}}
+Hi {{.UserName}},
+
+Someone requested to reset the password of your account.
+Please open the link below in {{.ExpireMins}} minutes to reset it:
+
+{{.Link}}
+
+If you did not request it, please ignore this mail.
+`,
+	TmplUploaded: `New file in {{.SiteName}}
+Hi {{.UserName}},
+
+{{.Actor}} uploaded {{.Path}}.
+`,
+	TmplDownloaded: `Your file is downloaded in {{.SiteName}}
+Hi {{.UserName}},
+
+{{.Actor}} downloaded {{.Path}}.
+`,
+	TmplQuotaWarning: `Your space is running out in {{.SiteName}}
+Hi {{.UserName}},
+
+You have used {{.UsedSpace}} of {{.SpaceLimit}} bytes ({{.Percent}}%).
+Please delete some files or ask admins for more space.
+`,
+}
+
+type Config struct {
+	Enabled bool
+	Host    string
+	Port    int
+	User    string
+	Pwd     string
+	From    string
+	// ImplicitTLS connects with TLS directly (usually port 465),
+	// otherwise STARTTLS is used if the server supports it
+	ImplicitTLS bool
+	// TemplatesDir contains <name>.tmpl files overriding the default templates
+	TemplatesDir string
+	Timeout      time.Duration
+}
+
+type Mail struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body"`
+}
+
+type IMailer interface {
+	Enabled() bool
+	Render(tmplName string, to []string, data map[string]string) (*Mail, error)
+	Send(mail *Mail) error
+}
+
+type SMTPMailer struct {
+	cfg       *Config
+	templates map[string]*template.Template
+}
+
+func NewSMTPMailer(cfg *Config) (*SMTPMailer, error) {
+	templates := map[string]*template.Template{}
+	for name, text := range defaultTemplates {
+		if cfg.TemplatesDir != "" {
+			content, err := os.ReadFile(filepath.Join(cfg.TemplatesDir, name+".tmpl"))
+			if err == nil {
+				text = string(content)
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parse template(%s): %w", name, err)
+		}
+		templates[name] = tmpl
+	}
+
+	if cfg.Port == 0 {
+		cfg.Port = 25
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &SMTPMailer{
+		cfg:       cfg,
+		templates: templates,
+	}, nil
+}
+
+func (m *SMTPMailer) Enabled() bool {
+	return m.cfg.Enabled
+}
+
+func (m *SMTPMailer) Render(tmplName string, to []string, data map[string]string) (*Mail, error) {
+	tmpl, ok := m.templates[tmplName]
+	if !ok {
+		return nil, fmt.Errorf("template(%s) not found", tmplName)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	subject, body, _ := strings.Cut(buf.String(), "\n")
+	return &Mail{
+		To:      to,
+		Subject: strings.TrimSpace(subject),
+		Body:    body,
+	}, nil
+}
+
+func (m *SMTPMailer) Send(mail *Mail) error {
+	if !m.cfg.Enabled {
+		return ErrMailDisabled
+	}
+	for _, addr := range append([]string{m.cfg.From}, mail.To...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return fmt.Errorf("invalid address: %q", addr)
+		}
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, fmt.Sprint(m.cfg.Port))
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: m.cfg.Timeout}
+	if m.cfg.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: m.cfg.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(m.cfg.Timeout))
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !m.cfg.ImplicitTLS {
+		if err = client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.User != "" {
+		if err = client.Auth(smtp.PlainAuth("", m.cfg.User, m.cfg.Pwd, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(m.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range mail.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(m.message(mail)); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) message(mail *Mail) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(mail.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", strings.ReplaceAll(mail.Subject, "\n", " "))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// NewMsgHandler sends mails posted to the worker pool
+func NewMsgHandler(mailer IMailer) worker.MsgHandler {
+	return func(msg worker.IMsg) error {
+		mail := &Mail{}
+		if err := json.Unmarshal([]byte(msg.Body()), mail); err != nil {
+			return fmt.Errorf("fail to unmarshal mail msg: %w", err)
+		}
+		return mailer.Send(mail)
+	}
+}
+
+// Post sends the mail asynchronously through the worker pool
+func Post(workers worker.IWorkerPool, msgID uint64, mail *Mail) error {
+	msg, err := json.Marshal(mail)
+	if err != nil {
+		return err
+	}
+	return workers.TryPut(
+		localworker.NewMsg(
+			msgID,
+			map[string]string{localworker.MsgTypeKey: MsgTypeMail},
+			string(msg),
+		),
+	)
+}
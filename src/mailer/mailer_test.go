@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/mailer/smtpstub"
+)
+
+func TestSMTPMailer(t *testing.T) {
+	stub, err := smtpstub.New("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stub.Close()
+
+	t.Run("render and send", func(t *testing.T) {
+		m, err := NewSMTPMailer(&Config{
+			Enabled: true,
+			Host:    "127.0.0.1",
+			Port:    stub.Addr().Port,
+			From:    "noreply@quickshare.local",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mail, err := m.Render(TmplPwdReset, []string{"user@quickshare.local"}, map[string]string{
+			"SiteName": "Quickshare",
+			"UserName": "user",
+			"Link":     "http://127.0.0.1/reset?token=abc",
+		})
+		if err != nil {
+			t.Fatal(err)
+		} else if mail.Subject != "Reset your password of Quickshare" {
+			t.Fatalf("incorrect subject (%s)", mail.Subject)
+		} else if !strings.Contains(mail.Body, "http://127.0.0.1/reset?token=abc") {
+			t.Fatalf("link not found in (%s)", mail.Body)
+		}
+
+		if err = m.Send(mail); err != nil {
+			t.Fatal(err)
+		}
+		mails, err := stub.Wait(1, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := mails[0]
+		if got.From != "noreply@quickshare.local" ||
+			len(got.To) != 1 || got.To[0] != "user@quickshare.local" ||
+			!strings.Contains(got.Data, "Subject: Reset your password of Quickshare") ||
+			!strings.Contains(got.Data, "token=abc") {
+			t.Fatalf("mail not matched %+v", got)
+		}
+	})
+
+	t.Run("templates are overridden", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(
+			filepath.Join(dir, TmplQuotaWarning+".tmpl"),
+			[]byte("Quota {{.Percent}}%\nused {{.UsedSpace}}"),
+			0600,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := NewSMTPMailer(&Config{TemplatesDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mail, err := m.Render(TmplQuotaWarning, nil, map[string]string{"Percent": "90", "UsedSpace": "9"})
+		if err != nil {
+			t.Fatal(err)
+		} else if mail.Subject != "Quota 90%" || mail.Body != "used 9" {
+			t.Fatalf("incorrect mail %+v", mail)
+		}
+
+		if err = m.Send(mail); !errors.Is(err, ErrMailDisabled) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+}
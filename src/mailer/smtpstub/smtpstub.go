@@ -0,0 +1,152 @@
+// Package smtpstub is an in-process SMTP server which keeps received mails in memory for tests.
+package smtpstub
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mail struct {
+	From string
+	To   []string
+	Data string
+}
+
+type Server struct {
+	listener net.Listener
+	mu       *sync.Mutex
+	mails    []*Mail
+	received chan struct{}
+}
+
+// New starts listening on the addr, e.g. "127.0.0.1:0"
+func New(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &Server{
+		listener: listener,
+		mu:       &sync.Mutex{},
+		mails:    []*Mail{},
+		received: make(chan struct{}, 1024),
+	}
+	go srv.serve()
+	return srv, nil
+}
+
+func (srv *Server) Addr() *net.TCPAddr {
+	return srv.listener.Addr().(*net.TCPAddr)
+}
+
+func (srv *Server) Close() error {
+	return srv.listener.Close()
+}
+
+func (srv *Server) Mails() []*Mail {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]*Mail{}, srv.mails...)
+}
+
+// Wait waits until n mails are received in total
+func (srv *Server) Wait(n int, timeout time.Duration) ([]*Mail, error) {
+	deadline := time.After(timeout)
+	for {
+		if mails := srv.Mails(); len(mails) >= n {
+			return mails, nil
+		}
+		select {
+		case <-srv.received:
+		case <-deadline:
+			return nil, fmt.Errorf("%d mails are received, expected %d", len(srv.Mails()), n)
+		}
+	}
+}
+
+func (srv *Server) serve() {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handle(conn)
+	}
+}
+
+func (srv *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		fmt.Fprintf(conn, "%s\r\n", line)
+	}
+
+	mail := &Mail{}
+	reply("220 smtpstub ready")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 smtpstub")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			mail = &Mail{From: trimAddr(line[len("MAIL FROM:"):])}
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			mail.To = append(mail.To, trimAddr(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			lines := []string{}
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				dataLine = strings.TrimRight(dataLine, "\r\n")
+				if dataLine == "." {
+					break
+				}
+				lines = append(lines, strings.TrimPrefix(dataLine, "."))
+			}
+			mail.Data = strings.Join(lines, "\n")
+
+			srv.mu.Lock()
+			srv.mails = append(srv.mails, mail)
+			srv.mu.Unlock()
+			select {
+			case srv.received <- struct{}{}:
+			default:
+			}
+			reply("250 OK")
+		case cmd == "RSET":
+			mail = &Mail{}
+			reply("250 OK")
+		case cmd == "NOOP":
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func trimAddr(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if end := strings.Index(addr, ">"); end >= 0 {
+		addr = addr[:end+1]
+	}
+	return strings.Trim(addr, "<>")
+}
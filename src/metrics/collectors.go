@@ -0,0 +1,295 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+
+	labelSep = "\xff"
+)
+
+// DefBuckets are the upper bounds (in seconds) of histogram buckets for latencies
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Sample is a value of a gauge collected when metrics are scraped,
+// LabelValues are in the same order as label names of the gauge
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type collector interface {
+	writeTo(w io.Writer) error
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// buckets, sum and count are only used by histograms
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// vec keeps series of a metric by their label values
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	mtx    *sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		mtx:    &sync.Mutex{},
+		series: map[string]*series{},
+	}
+}
+
+// get should be protected by mtx
+func (v *vec) get(labelValues []string, bucketCount int) *series {
+	if len(labelValues) != len(v.labels) {
+		// it is a programming error
+		panic(fmt.Sprintf("%s: %d label values are provided while %d are expected", v.name, len(labelValues), len(v.labels)))
+	}
+
+	key := strings.Join(labelValues, labelSep)
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string{}, labelValues...),
+			buckets:     make([]uint64, bucketCount),
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns keys of series in order so that the output is stable
+func (v *vec) sorted() []string {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeHeader(w io.Writer, name, help, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+	return err
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues []string, value float64) error {
+	_, err := fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labels, labelValues), formatValue(value))
+	return err
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{vec: newVec(name, help, typeCounter, labels)}
+}
+
+func (cv *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		// counters never decrease
+		return
+	}
+	cv.mtx.Lock()
+	defer cv.mtx.Unlock()
+	cv.get(labelValues, 0).value += delta
+}
+
+func (cv *CounterVec) Inc(labelValues ...string) {
+	cv.Add(1, labelValues...)
+}
+
+// Value returns the current value of the series, it is 0 if the series does not exist
+func (cv *CounterVec) Value(labelValues ...string) float64 {
+	cv.mtx.Lock()
+	defer cv.mtx.Unlock()
+	s, ok := cv.series[strings.Join(labelValues, labelSep)]
+	if !ok {
+		return 0
+	}
+	return s.value
+}
+
+func (cv *CounterVec) writeTo(w io.Writer) error {
+	cv.mtx.Lock()
+	defer cv.mtx.Unlock()
+
+	if err := writeHeader(w, cv.name, cv.help, cv.typ); err != nil {
+		return err
+	}
+	for _, key := range cv.sorted() {
+		s := cv.series[key]
+		if err := writeSample(w, cv.name, cv.labels, s.labelValues, s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	*vec
+	bounds []float64
+}
+
+func NewHistogramVec(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		vec:    newVec(name, help, typeHistogram, labels),
+		bounds: bounds,
+	}
+}
+
+func (hv *HistogramVec) Observe(value float64, labelValues ...string) {
+	hv.mtx.Lock()
+	defer hv.mtx.Unlock()
+
+	s := hv.get(labelValues, len(hv.bounds))
+	for i, bound := range hv.bounds {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Count returns how many values are observed in the series
+func (hv *HistogramVec) Count(labelValues ...string) uint64 {
+	hv.mtx.Lock()
+	defer hv.mtx.Unlock()
+	s, ok := hv.series[strings.Join(labelValues, labelSep)]
+	if !ok {
+		return 0
+	}
+	return s.count
+}
+
+func (hv *HistogramVec) writeTo(w io.Writer) error {
+	hv.mtx.Lock()
+	defer hv.mtx.Unlock()
+
+	if err := writeHeader(w, hv.name, hv.help, hv.typ); err != nil {
+		return err
+	}
+	bucketLabels := append(append([]string{}, hv.labels...), "le")
+	for _, key := range hv.sorted() {
+		s := hv.series[key]
+		for i, bound := range hv.bounds {
+			labelValues := append(append([]string{}, s.labelValues...), formatValue(bound))
+			err := writeSample(w, hv.name+"_bucket", bucketLabels, labelValues, float64(s.buckets[i]))
+			if err != nil {
+				return err
+			}
+		}
+		labelValues := append(append([]string{}, s.labelValues...), "+Inf")
+		if err := writeSample(w, hv.name+"_bucket", bucketLabels, labelValues, float64(s.count)); err != nil {
+			return err
+		}
+		if err := writeSample(w, hv.name+"_sum", hv.labels, s.labelValues, s.sum); err != nil {
+			return err
+		}
+		if err := writeSample(w, hv.name+"_count", hv.labels, s.labelValues, float64(s.count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFunc is a gauge whose samples are collected by fn when metrics are scraped
+type GaugeFunc struct {
+	name   string
+	help   string
+	labels []string
+	fn     func() ([]*Sample, error)
+}
+
+func NewGaugeFunc(name, help string, fn func() ([]*Sample, error), labels ...string) *GaugeFunc {
+	return &GaugeFunc{
+		name:   name,
+		help:   help,
+		labels: labels,
+		fn:     fn,
+	}
+}
+
+func (gf *GaugeFunc) writeTo(w io.Writer) error {
+	samples, err := gf.fn()
+	if err != nil {
+		return fmt.Errorf("failed to collect %s: %w", gf.name, err)
+	}
+
+	if err = writeHeader(w, gf.name, gf.help, typeGauge); err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		if len(sample.LabelValues) != len(gf.labels) {
+			return fmt.Errorf("%s: label values %v do not match labels %v", gf.name, sample.LabelValues, gf.labels)
+		}
+		if err = writeSample(w, gf.name, gf.labels, sample.LabelValues, sample.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels, labelValues []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for i, label := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escapeLabelValue(labelValues[i])))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ","))
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
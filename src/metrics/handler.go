@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// NewHandler serves metrics in the Prometheus text exposition format,
+// metrics are buffered so that collecting errors are still reported by the status
+func NewHandler(m IMetrics, logger *zap.SugaredLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bytes.Buffer{}
+		if err := m.Export(buf); err != nil {
+			logger.Errorf("failed to export metrics: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			logger.Errorf("failed to write metrics: %s", err)
+		}
+	})
+}
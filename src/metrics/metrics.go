@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// ContentType is the content type of the Prometheus text exposition format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+
+	OpExec  = "exec"
+	OpQuery = "query"
+
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+type IMetrics interface {
+	ObserveRequest(method, route string, status int, duration time.Duration)
+	// AddTransferred counts bytes uploaded or downloaded, rates are calculated by Prometheus
+	AddTransferred(direction string, bytes int)
+	// Throttled counts how many times transfers are delayed or rejected by the IO limiter
+	Throttled(direction string)
+	ObserveJob(msgType string, duration time.Duration, err error)
+	ObserveDBQuery(op string, duration time.Duration, err error)
+	// AddGaugeFunc adds a gauge whose samples are collected when metrics are exported
+	AddGaugeFunc(gauge *GaugeFunc)
+	// Export writes all metrics in the Prometheus text exposition format
+	Export(w io.Writer) error
+}
+
+type Metrics struct {
+	mtx        *sync.RWMutex
+	collectors []collector
+
+	requests      *CounterVec
+	requestsTime  *HistogramVec
+	transferred   *CounterVec
+	throttled     *CounterVec
+	jobs          *CounterVec
+	jobsTime      *HistogramVec
+	dbQueries     *CounterVec
+	dbQueriesTime *HistogramVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		mtx: &sync.RWMutex{},
+		requests: NewCounterVec(
+			"quickshare_http_requests_total",
+			"Count of HTTP requests by route and status.",
+			"method", "route", "status",
+		),
+		requestsTime: NewHistogramVec(
+			"quickshare_http_request_duration_seconds",
+			"Latency of HTTP requests by route.",
+			DefBuckets,
+			"method", "route",
+		),
+		transferred: NewCounterVec(
+			"quickshare_transferred_bytes_total",
+			"Bytes uploaded or downloaded.",
+			"direction",
+		),
+		throttled: NewCounterVec(
+			"quickshare_io_throttled_total",
+			"Count of transfers delayed or rejected by the IO limiter.",
+			"direction",
+		),
+		jobs: NewCounterVec(
+			"quickshare_worker_jobs_total",
+			"Count of finished async jobs by message type and result.",
+			"type", "result",
+		),
+		jobsTime: NewHistogramVec(
+			"quickshare_worker_job_duration_seconds",
+			"Duration of async jobs by message type.",
+			DefBuckets,
+			"type",
+		),
+		dbQueries: NewCounterVec(
+			"quickshare_db_queries_total",
+			"Count of DB statements by operation and result.",
+			"op", "result",
+		),
+		dbQueriesTime: NewHistogramVec(
+			"quickshare_db_query_duration_seconds",
+			"Latency of DB statements by operation.",
+			DefBuckets,
+			"op",
+		),
+	}
+
+	m.collectors = []collector{
+		m.requests,
+		m.requestsTime,
+		m.transferred,
+		m.throttled,
+		m.jobs,
+		m.jobsTime,
+		m.dbQueries,
+		m.dbQueriesTime,
+	}
+	return m
+}
+
+func resultOf(err error) string {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultSucceeded
+}
+
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	m.requests.Inc(method, route, fmt.Sprint(status))
+	m.requestsTime.Observe(duration.Seconds(), method, route)
+}
+
+func (m *Metrics) AddTransferred(direction string, bytes int) {
+	m.transferred.Add(float64(bytes), direction)
+}
+
+func (m *Metrics) Throttled(direction string) {
+	m.throttled.Inc(direction)
+}
+
+func (m *Metrics) ObserveJob(msgType string, duration time.Duration, err error) {
+	m.jobs.Inc(msgType, resultOf(err))
+	m.jobsTime.Observe(duration.Seconds(), msgType)
+}
+
+func (m *Metrics) ObserveDBQuery(op string, duration time.Duration, err error) {
+	m.dbQueries.Inc(op, resultOf(err))
+	m.dbQueriesTime.Observe(duration.Seconds(), op)
+}
+
+func (m *Metrics) AddGaugeFunc(gauge *GaugeFunc) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.collectors = append(m.collectors, gauge)
+}
+
+func (m *Metrics) Export(w io.Writer) error {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	for _, c := range m.collectors {
+		if err := c.writeTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestExport(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveRequest("GET", "/v2/my/fs/dirs", 200, 25*time.Millisecond)
+	m.ObserveRequest("GET", "/v2/my/fs/dirs", 200, 2*time.Second)
+	m.ObserveRequest("GET", "/v2/my/fs/dirs", 404, 0)
+	m.AddTransferred(DirectionUpload, 100)
+	m.AddTransferred(DirectionUpload, 28)
+	m.Throttled(DirectionDownload)
+	m.ObserveJob("sha1", time.Second, errors.New("failed"))
+	m.AddGaugeFunc(NewGaugeFunc(
+		"quickshare_test_gauge",
+		"A gauge\nfor tests.",
+		func() ([]*Sample, error) {
+			return []*Sample{
+				{LabelValues: []string{`a"b\c`}, Value: 1.5},
+				{LabelValues: []string{"d"}, Value: 2},
+			}, nil
+		},
+		"user",
+	))
+
+	buf := &bytes.Buffer{}
+	if err := m.Export(buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	for _, line := range []string{
+		"# HELP quickshare_http_requests_total Count of HTTP requests by route and status.",
+		"# TYPE quickshare_http_requests_total counter",
+		`quickshare_http_requests_total{method="GET",route="/v2/my/fs/dirs",status="200"} 2`,
+		`quickshare_http_requests_total{method="GET",route="/v2/my/fs/dirs",status="404"} 1`,
+		"# TYPE quickshare_http_request_duration_seconds histogram",
+		`quickshare_http_request_duration_seconds_bucket{method="GET",route="/v2/my/fs/dirs",le="0.005"} 1`,
+		`quickshare_http_request_duration_seconds_bucket{method="GET",route="/v2/my/fs/dirs",le="0.05"} 2`,
+		`quickshare_http_request_duration_seconds_bucket{method="GET",route="/v2/my/fs/dirs",le="2.5"} 3`,
+		`quickshare_http_request_duration_seconds_bucket{method="GET",route="/v2/my/fs/dirs",le="+Inf"} 3`,
+		`quickshare_http_request_duration_seconds_sum{method="GET",route="/v2/my/fs/dirs"} 2.025`,
+		`quickshare_http_request_duration_seconds_count{method="GET",route="/v2/my/fs/dirs"} 3`,
+		`quickshare_transferred_bytes_total{direction="upload"} 128`,
+		`quickshare_io_throttled_total{direction="download"} 1`,
+		`quickshare_worker_jobs_total{type="sha1",result="failed"} 1`,
+		`quickshare_worker_job_duration_seconds_count{type="sha1"} 1`,
+		`# HELP quickshare_test_gauge A gauge\nfor tests.`,
+		"# TYPE quickshare_test_gauge gauge",
+		`quickshare_test_gauge{user="a\"b\\c"} 1.5`,
+		`quickshare_test_gauge{user="d"} 2`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Fatalf("line not found: %s\n%s", line, output)
+		}
+	}
+}
+
+func TestGaugeFuncErrors(t *testing.T) {
+	m := NewMetrics()
+	m.AddGaugeFunc(NewGaugeFunc(
+		"quickshare_test_gauge",
+		"A gauge for tests.",
+		func() ([]*Sample, error) {
+			return []*Sample{{Value: 1}}, nil
+		},
+		"user",
+	))
+	if err := m.Export(&bytes.Buffer{}); err == nil {
+		t.Fatal("unmatched labels should be reported")
+	}
+
+	m = NewMetrics()
+	m.AddGaugeFunc(NewGaugeFunc(
+		"quickshare_test_gauge",
+		"A gauge for tests.",
+		func() ([]*Sample, error) {
+			return nil, errors.New("failed to collect")
+		},
+	))
+	if err := m.Export(&bytes.Buffer{}); err == nil {
+		t.Fatal("collecting errors should be reported")
+	}
+}
+
+func TestOpenDB(t *testing.T) {
+	m := NewMetrics()
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	queries := []string{}
+	observe := func(ctx context.Context, op, query string, start time.Time, err error) {
+		queries = append(queries, query)
+		m.ObserveDBQuery(op, time.Since(start), err)
+	}
+	sqlDB, err := OpenDB("sqlite", dbPath, observe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	ctx := context.TODO()
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.ExecContext(ctx, `create table t_test (id integer primary key, name text)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.ExecContext(ctx, `insert into t_test (id, name) values (?, ?)`, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := ""
+	if err = sqlDB.QueryRowContext(ctx, `select name from t_test where id=?`, 1).Scan(&name); err != nil {
+		t.Fatal(err)
+	} else if name != "a" {
+		t.Fatalf("name not matched %s", name)
+	}
+	if _, err = sqlDB.ExecContext(ctx, `insert into t_unknown (id) values (1)`); err == nil {
+		t.Fatal("inserting into an unknown table should fail")
+	}
+
+	if count := m.dbQueries.Value(OpExec, ResultSucceeded); count != 2 {
+		t.Fatalf("succeeded exec count not matched %f", count)
+	} else if count := m.dbQueries.Value(OpExec, ResultFailed); count != 1 {
+		t.Fatalf("failed exec count not matched %f", count)
+	} else if count := m.dbQueriesTime.Count(OpQuery); count != 1 {
+		t.Fatalf("query count not matched %d", count)
+	} else if len(queries) != 4 || queries[1] != `insert into t_test (id, name) values (?, ?)` {
+		t.Fatalf("queries not matched %v", queries)
+	}
+}
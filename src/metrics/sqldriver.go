@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// QueryObserver is called after a statement is executed, ctx is the one passed to the statement
+type QueryObserver func(ctx context.Context, op, query string, start time.Time, err error)
+
+// OpenDB opens the DB with a driver wrapping the registered one,
+// so that statements (including ones in transactions) are observed
+func OpenDB(driverName, dsn string, observe QueryObserver) (*sql.DB, error) {
+	// sql.Open only validates the driver name without connecting
+	rawDB, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := rawDB.Driver()
+	if err = rawDB.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close raw db: %w", err)
+	}
+
+	return sql.OpenDB(&timedConnector{
+		driver:  drv,
+		dsn:     dsn,
+		observe: observe,
+	}), nil
+}
+
+type timedConnector struct {
+	driver  driver.Driver
+	dsn     string
+	observe QueryObserver
+}
+
+func (tc *timedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var conn driver.Conn
+	var err error
+	if drvCtx, ok := tc.driver.(driver.DriverContext); ok {
+		var connector driver.Connector
+		connector, err = drvCtx.OpenConnector(tc.dsn)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = connector.Connect(ctx)
+	} else {
+		conn, err = tc.driver.Open(tc.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{Conn: conn, observe: tc.observe}, nil
+}
+
+func (tc *timedConnector) Driver() driver.Driver {
+	return tc.driver
+}
+
+// timedConn times statements executed directly by the connection,
+// optional interfaces of the wrapped connection are forwarded
+type timedConn struct {
+	driver.Conn
+	observe QueryObserver
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.observe(ctx, OpExec, query, start, err)
+	}
+	return result, err
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.observe(ctx, OpQuery, query, start, err)
+	}
+	return rows, err
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *timedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	// database/sql falls back to the default conversion
+	return driver.ErrSkip
+}
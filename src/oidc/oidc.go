@@ -0,0 +1,359 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unknown kids could be sent by anyone, so keys are refetched at most once in keysRefetchInterval
+const keysRefetchInterval = time.Minute
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrUnknownKey     = errors.New("signing key not found")
+)
+
+// Discovery is a subset of the OpenID provider metadata
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+type tokenResp struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Provider implements the authorization code flow of OpenID Connect,
+// only RS256 signed id tokens are supported
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	mtx           *sync.Mutex
+	discovery     *Discovery
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+func NewProvider(issuer, clientID, clientSecret, redirectURL string, scopes []string) *Provider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	return &Provider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		mtx:          &sync.Mutex{},
+		keys:         map[string]*rsa.PublicKey{},
+	}
+}
+
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// Discover fetches the provider metadata once, it is retried in next call if it failed
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := &Discovery{}
+	err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", discovery)
+	if err != nil {
+		return nil, err
+	} else if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("issuer not matched: %s", discovery.Issuer)
+	}
+	p.discovery = discovery
+	return discovery, nil
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange exchanges the code for tokens and returns the raw id token
+func (p *Provider) Exchange(ctx context.Context, code string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		discovery.TokenEndpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", err
+	} else if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	tokens := &tokenResp{}
+	if err = json.Unmarshal(body, tokens); err != nil {
+		return "", err
+	} else if tokens.IDToken == "" {
+		return "", fmt.Errorf("id token is not returned: %w", ErrInvalidIDToken)
+	}
+	return tokens.IDToken, nil
+}
+
+// Verify verifies the signature and standard claims of the id token and returns all claims
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token: %w", ErrInvalidIDToken)
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	} else if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported alg(%s): %w", header.Alg, ErrInvalidIDToken)
+	}
+
+	key, err := p.getKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", ErrInvalidIDToken)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("bad signature: %w", ErrInvalidIDToken)
+	}
+
+	claims := map[string]interface{}{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, fmt.Errorf("issuer not matched: %w", ErrInvalidIDToken)
+	}
+	if !hasAudience(claims["aud"], p.clientID) {
+		return nil, fmt.Errorf("audience not matched: %w", ErrInvalidIDToken)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || int64(exp) <= time.Now().Unix() {
+		return nil, fmt.Errorf("token expired: %w", ErrInvalidIDToken)
+	}
+	if gotNonce, _ := claims["nonce"].(string); gotNonce != nonce {
+		return nil, fmt.Errorf("nonce not matched: %w", ErrInvalidIDToken)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("empty subject: %w", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// getKey returns the signing key, keys are refetched when the kid is unknown for key rotation
+func (p *Provider) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	key, ok := p.keys[kid]
+	refetch := !ok && time.Since(p.keysFetchedAt) >= keysRefetchInterval
+	if refetch {
+		p.keysFetchedAt = time.Now()
+	}
+	p.mtx.Unlock()
+	if ok {
+		return key, nil
+	} else if !refetch {
+		return nil, ErrUnknownKey
+	}
+
+	jwks := &JWKS{}
+	if err = p.getJSON(ctx, discovery.JWKSURI, jwks); err != nil {
+		// failed fetches are retried in next call
+		p.mtx.Lock()
+		p.keysFetchedAt = time.Time{}
+		p.mtx.Unlock()
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		pubKey, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.Kid] = pubKey
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.keys = keys
+	if key, ok = p.keys[kid]; !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, reqURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", reqURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(v)
+}
+
+func (jwk *JWK) PublicKey() (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
+
+func NewJWK(kid string, key *rsa.PublicKey) *JWK {
+	return &JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Alg: "RS256",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// ClaimStrings returns the claim as a list of strings, it accepts both a string and an array
+func ClaimStrings(claims map[string]interface{}, name string) []string {
+	switch val := claims[name].(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		vals := []string{}
+		for _, item := range val {
+			if str, ok := item.(string); ok {
+				vals = append(vals, str)
+			}
+		}
+		return vals
+	}
+	return []string{}
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	for _, got := range ClaimStrings(map[string]interface{}{"aud": aud}, "aud") {
+		if got == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	segBytes, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("malformed segment: %w", ErrInvalidIDToken)
+	}
+	if err = json.Unmarshal(segBytes, v); err != nil {
+		return fmt.Errorf("malformed segment: %w", ErrInvalidIDToken)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/oidc"
+	"github.com/ihexxa/quickshare/src/oidc/oidctest"
+)
+
+func TestProvider(t *testing.T) {
+	clientID, clientSecret := "quickshare", "secret"
+	redirectURL := "http://127.0.0.1:8686/v2/public/oidc/callback"
+	idp, err := oidctest.NewIdP(clientID, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	ctx := context.TODO()
+	provider := oidc.NewProvider(idp.Issuer(), clientID, clientSecret, redirectURL, nil)
+
+	t.Run("authorization code flow", func(t *testing.T) {
+		idp.SetClaims(map[string]interface{}{
+			"sub":                "alice-id",
+			"preferred_username": "alice",
+			"groups":             []string{"dev", "ops"},
+		})
+		authURL, err := provider.AuthCodeURL(ctx, "state1", "nonce1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		noRedirect := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		resp, err := noRedirect.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		} else if location.Query().Get("state") != "state1" {
+			t.Fatalf("state not matched: %s", location)
+		}
+
+		rawIDToken, err := provider.Exchange(ctx, location.Query().Get("code"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := provider.Verify(ctx, rawIDToken, "nonce1")
+		if err != nil {
+			t.Fatal(err)
+		} else if claims["sub"] != "alice-id" {
+			t.Fatalf("sub not matched: %+v", claims)
+		}
+		groups := oidc.ClaimStrings(claims, "groups")
+		if len(groups) != 2 || groups[0] != "dev" || groups[1] != "ops" {
+			t.Fatalf("groups not matched: %+v", groups)
+		}
+
+		if _, err = provider.Verify(ctx, rawIDToken, "nonce2"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Fatalf("nonce should be checked: %v", err)
+		}
+		if _, err = provider.Exchange(ctx, location.Query().Get("code")); err == nil {
+			t.Fatal("code should not be used twice")
+		}
+	})
+
+	t.Run("forged tokens are rejected", func(t *testing.T) {
+		now := time.Now().Unix()
+		validClaims := func() map[string]interface{} {
+			return map[string]interface{}{
+				"iss":   idp.Issuer(),
+				"aud":   clientID,
+				"sub":   "alice-id",
+				"exp":   now + 60,
+				"nonce": "nonce",
+			}
+		}
+
+		rawIDToken, err := idp.IDToken(validClaims())
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err = provider.Verify(ctx, rawIDToken, "nonce"); err != nil {
+			t.Fatal(err)
+		}
+
+		for desc, update := range map[string]func(map[string]interface{}){
+			"issuer":   func(claims map[string]interface{}) { claims["iss"] = "http://evil" },
+			"audience": func(claims map[string]interface{}) { claims["aud"] = "other" },
+			"expired":  func(claims map[string]interface{}) { claims["exp"] = now - 1 },
+			"subject":  func(claims map[string]interface{}) { delete(claims, "sub") },
+		} {
+			claims := validClaims()
+			update(claims)
+			rawIDToken, err := idp.IDToken(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = provider.Verify(ctx, rawIDToken, "nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Fatalf("%s should be checked: %v", desc, err)
+			}
+		}
+
+		// tampered payload
+		otherToken, err := idp.IDToken(map[string]interface{}{"sub": "mallory"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(rawIDToken, ".")
+		otherParts := strings.Split(otherToken, ".")
+		tampered := parts[0] + "." + otherParts[1] + "." + parts[2]
+		if _, err = provider.Verify(ctx, tampered, "nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Fatalf("signature should be checked: %v", err)
+		}
+	})
+	t.Run("unknown keys are refetched at most once in a while", func(t *testing.T) {
+		rawIDToken, err := idp.IDToken(map[string]interface{}{"sub": "alice-id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(rawIDToken, ".")
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"unknown","typ":"JWT"}`))
+		unknownKeyToken := header + "." + parts[1] + "." + parts[2]
+
+		requests := idp.JWKSRequests()
+		for i := 0; i < 5; i++ {
+			if _, err = provider.Verify(ctx, unknownKeyToken, "nonce"); !errors.Is(err, oidc.ErrUnknownKey) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		}
+		// keys were fetched in previous cases
+		if idp.JWKSRequests() != requests {
+			t.Fatalf("keys should not be refetched (%d, %d)", requests, idp.JWKSRequests())
+		}
+	})
+}
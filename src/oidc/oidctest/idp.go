@@ -0,0 +1,201 @@
+// Package oidctest provides an in-process OpenID provider for tests
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/oidc"
+)
+
+const keyID = "oidctest-key"
+
+type authCode struct {
+	claims map[string]interface{}
+	nonce  string
+}
+
+// IdP approves every authorization request with the claims set by SetClaims
+type IdP struct {
+	srv          *httptest.Server
+	key          *rsa.PrivateKey
+	clientID     string
+	clientSecret string
+
+	mtx          *sync.Mutex
+	claims       map[string]interface{}
+	codes        map[string]*authCode
+	jwksRequests int
+}
+
+func NewIdP(clientID, clientSecret string) (*IdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	idp := &IdP{
+		key:          key,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		mtx:          &sync.Mutex{},
+		claims:       map[string]interface{}{},
+		codes:        map[string]*authCode{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+	idp.srv = httptest.NewServer(mux)
+	return idp, nil
+}
+
+func (idp *IdP) Issuer() string {
+	return idp.srv.URL
+}
+
+func (idp *IdP) Close() {
+	idp.srv.Close()
+}
+
+// SetClaims sets claims of the user who logs in next, "sub" must be included
+func (idp *IdP) SetClaims(claims map[string]interface{}) {
+	idp.mtx.Lock()
+	defer idp.mtx.Unlock()
+	idp.claims = claims
+}
+
+// IDToken signs an id token with the provider key, it is exported for forging tests
+func (idp *IdP) IDToken(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (idp *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, &oidc.Discovery{
+		Issuer:                idp.Issuer(),
+		AuthorizationEndpoint: idp.Issuer() + "/authorize",
+		TokenEndpoint:         idp.Issuer() + "/token",
+		JWKSURI:               idp.Issuer() + "/jwks",
+	})
+}
+
+func (idp *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != idp.clientID || query.Get("response_type") != "code" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	redirectURL, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURL.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	codeBytes := make([]byte, 16)
+	if _, err = rand.Read(codeBytes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	code := hex.EncodeToString(codeBytes)
+
+	idp.mtx.Lock()
+	idp.codes[code] = &authCode{claims: idp.claims, nonce: query.Get("nonce")}
+	idp.mtx.Unlock()
+
+	redirectQuery := redirectURL.Query()
+	redirectQuery.Set("code", code)
+	redirectQuery.Set("state", query.Get("state"))
+	redirectURL.RawQuery = redirectQuery.Encode()
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+func (idp *IdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != idp.clientID || clientSecret != idp.clientSecret {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, "invalid grant", http.StatusBadRequest)
+		return
+	}
+
+	// codes can be used only once
+	idp.mtx.Lock()
+	granted, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mtx.Unlock()
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Unix()
+	claims := map[string]interface{}{
+		"iss":   idp.Issuer(),
+		"aud":   idp.clientID,
+		"iat":   now,
+		"exp":   now + 300,
+		"nonce": granted.nonce,
+	}
+	for key, val := range granted.claims {
+		claims[key] = val
+	}
+	idToken, err := idp.IDToken(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{
+		"access_token": "oidctest-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// JWKSRequests returns the number of fetches of keys
+func (idp *IdP) JWKSRequests() int {
+	idp.mtx.Lock()
+	defer idp.mtx.Unlock()
+	return idp.jwksRequests
+}
+
+func (idp *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	idp.mtx.Lock()
+	idp.jwksRequests++
+	idp.mtx.Unlock()
+	writeJSON(w, &oidc.JWKS{Keys: []*oidc.JWK{oidc.NewJWK(keyID, &idp.key.PublicKey)}})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
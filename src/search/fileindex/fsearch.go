@@ -1,148 +1,175 @@
 package fileindex
 
 import (
-	"bufio"
 	"errors"
-	"fmt"
-	"io"
-	"strings"
+	"sync"
 
 	"github.com/ihexxa/fsearch"
 	"github.com/ihexxa/quickshare/src/fs"
 )
 
+var ErrClosed = errors.New("file index is closed")
+
 type IFileIndex interface {
 	Search(keyword string) ([]string, error)
 	AddPath(pathname string) error
+	// AddPaths adds paths in a batch, they are logged with one sync
+	AddPaths(pathnames []string) error
 	DelPath(pathname string) error
 	RenamePath(pathname, newName string) error
 	MovePath(pathname, dstParentPath string) error
-	WriteTo(pathname string) error
-	ReadFrom(pathname string) error
+	// Load restores the index from the snapshot and replays the changes logged after it
+	Load() error
+	// Snapshot writes the whole index atomically and removes snapshotted changes from the log
+	Snapshot() error
+	// Changes returns the number of changes which are logged but not in the snapshot
+	Changes() uint64
 	Reset() error
+	Close() error
 	String() string
 }
 
+// FileTreeIndex is a file name index, changes are appended to a log before they are returned,
+// and the log is compacted by snapshots, so that the index survives restarts and crashes
 type FileTreeIndex struct {
 	fs            fs.ISimpleFS
 	index         *fsearch.FSearch
 	pathSeparator string
 	maxResultSize int
+	// paths are relative to the fs root, the index is not persisted if they are empty
+	snapshotPath string
+	logPath      string
+
+	// mtx serializes changes, logging and accessing the index,
+	// fsearch's Search also prunes the index so searches take it too
+	mtx    *sync.Mutex
+	log    *changeLog
+	closed bool
+	// snapshotMtx serializes snapshots, changes are only blocked while the index is copied
+	snapshotMtx *sync.Mutex
 }
 
-func NewFileTreeIndex(fs fs.ISimpleFS, pathSeparator string, maxResultSize int) *FileTreeIndex {
+func NewFileTreeIndex(fs fs.ISimpleFS, pathSeparator string, maxResultSize int, snapshotPath, logPath string) *FileTreeIndex {
 	return &FileTreeIndex{
 		fs:            fs,
 		index:         fsearch.New(pathSeparator, maxResultSize),
 		pathSeparator: pathSeparator,
 		maxResultSize: maxResultSize,
+		snapshotPath:  snapshotPath,
+		logPath:       logPath,
+		mtx:           &sync.Mutex{},
+		snapshotMtx:   &sync.Mutex{},
+	}
+}
+
+func (idx *FileTreeIndex) persistent() bool {
+	return idx.snapshotPath != "" && idx.logPath != ""
+}
+
+// change applies changes and logs applied ones
+func (idx *FileTreeIndex) change(records ...*changeRecord) error {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	if idx.closed {
+		return ErrClosed
+	}
+	var err error
+	applied := make([]*changeRecord, 0, len(records))
+	for _, record := range records {
+		if err = idx.apply(record); err != nil {
+			break
+		}
+		applied = append(applied, record)
+	}
+	if idx.log != nil && len(applied) > 0 {
+		if logErr := idx.log.append(applied...); logErr != nil {
+			return logErr
+		}
+	}
+	return err
+}
+
+func (idx *FileTreeIndex) apply(record *changeRecord) error {
+	switch record.Op {
+	case opAdd:
+		return idx.index.AddPath(record.Path)
+	case opDel:
+		return idx.index.DelPath(record.Path)
+	case opRename:
+		return idx.index.RenamePath(record.Path, record.Arg)
+	case opMove:
+		return idx.index.MovePath(record.Path, record.Arg)
+	case opReset:
+		idx.index = fsearch.New(idx.pathSeparator, idx.maxResultSize)
+		return nil
 	}
+	return errors.New("unknown change: " + record.Op)
 }
 
 func (idx *FileTreeIndex) Reset() error {
-	idx.index = fsearch.New(idx.pathSeparator, idx.maxResultSize)
-	return nil
+	return idx.change(&changeRecord{Op: opReset})
 }
 
 func (idx *FileTreeIndex) Search(keyword string) ([]string, error) {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
 	return idx.index.Search(keyword)
 }
 
 func (idx *FileTreeIndex) AddPath(pathname string) error {
-	return idx.index.AddPath(pathname)
+	return idx.change(&changeRecord{Op: opAdd, Path: pathname})
+}
+
+func (idx *FileTreeIndex) AddPaths(pathnames []string) error {
+	records := make([]*changeRecord, 0, len(pathnames))
+	for _, pathname := range pathnames {
+		records = append(records, &changeRecord{Op: opAdd, Path: pathname})
+	}
+	return idx.change(records...)
 }
 
 func (idx *FileTreeIndex) DelPath(pathname string) error {
-	return idx.index.DelPath(pathname)
+	return idx.change(&changeRecord{Op: opDel, Path: pathname})
 }
 
 func (idx *FileTreeIndex) RenamePath(pathname, newName string) error {
-	return idx.index.RenamePath(pathname, newName)
+	return idx.change(&changeRecord{Op: opRename, Path: pathname, Arg: newName})
 }
 
 func (idx *FileTreeIndex) MovePath(pathname, dstParentPath string) error {
-	return idx.index.MovePath(pathname, dstParentPath)
+	return idx.change(&changeRecord{Op: opMove, Path: pathname, Arg: dstParentPath})
 }
 
-func (idx *FileTreeIndex) WriteTo(pathname string) error {
-	rowsChan := idx.index.Marshal()
-	err := idx.fs.Remove(pathname)
-	if err != nil {
-		return err
-	}
-	err = idx.fs.Create(pathname)
-	if err != nil {
-		return err
-	}
+func (idx *FileTreeIndex) Changes() uint64 {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
 
-	var row string
-	var ok bool
-	var wrote int
-	var offset int64
-	batch := []string{}
-	for {
-		row, ok = <-rowsChan
-		if ok {
-			batch = append(batch, row+"\n")
-		}
-		if !ok || len(batch) > 1024 {
-			wrote, err = idx.fs.WriteAt(pathname, []byte(strings.Join(batch, "")), offset)
-			if err != nil {
-				return err
-			}
-			offset += int64(wrote)
-			batch = batch[:0]
-		}
-		if !ok {
-			break
-		}
+	if idx.log == nil {
+		return 0
 	}
-
-	return idx.index.Error()
+	return idx.log.seq - idx.log.snapshotSeq
 }
 
-func (idx *FileTreeIndex) ReadFrom(pathname string) error {
-	f, readerId, err := idx.fs.GetFileReader(pathname)
-	if err != nil {
-		return err
-	}
-	defer idx.fs.CloseReader(fmt.Sprint(readerId))
-
-	var row string
-	rowSeparator := byte('\n')
-	reader := bufio.NewReader(f)
-	rowsChan := make(chan string, 1024)
-
-	var workerErr error
-	readWorker := func() {
-		defer close(rowsChan)
-		for {
-			row, err = reader.ReadString(rowSeparator)
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					if row != "" {
-						rowsChan <- row
-					}
-					break
-				} else {
-					workerErr = err
-					break
-				}
-			}
-			if row != "" {
-				rowsChan <- row
-			}
-		}
-	}
-	go readWorker()
+// Close closes the change log, the index should be snapshotted before closing,
+// the index is not stopped as fsearch's Stop blocks if deletions are pending
+func (idx *FileTreeIndex) Close() error {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
 
-	idx.index.Unmarshal(rowsChan)
-	if workerErr != nil {
-		return err
+	idx.closed = true
+	if idx.log == nil {
+		return nil
 	}
-	return idx.index.Error()
+	err := idx.log.close()
+	idx.log = nil
+	return err
 }
 
 func (idx *FileTreeIndex) String() string {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
 	return idx.index.String()
 }
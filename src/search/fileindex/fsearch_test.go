@@ -3,7 +3,10 @@ package fileindex
 import (
 	"math/rand"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,25 +42,229 @@ func TestFileSearch(t *testing.T) {
 
 	ider := simpleidgen.New()
 	fs := local.NewLocalFS(dirPath, 0660, 1024, 60, 60, ider)
-	fileIndex := NewFileTreeIndex(fs, "/", 0)
+	snapshotPath, logPath := "/fileindex", "/fileindex.log"
+	newIndex := func(t *testing.T) *FileTreeIndex {
+		fileIndex := NewFileTreeIndex(fs, "/", 0, snapshotPath, logPath)
+		if err := fileIndex.Load(); err != nil {
+			t.Fatal(err)
+		}
+		return fileIndex
+	}
+	assertFound := func(t *testing.T, fileIndex *FileTreeIndex, pathname string, expected bool) {
+		results, err := fileIndex.Search(path.Base(pathname))
+		if err != nil && expected {
+			t.Fatal(err)
+		}
+		found := false
+		for _, result := range results {
+			if result == pathname {
+				found = true
+				break
+			}
+		}
+		if found != expected {
+			t.Fatalf("%s: expected found(%t) results(%v)", pathname, expected, results)
+		}
+	}
 
-	paths := makePaths(8, 256)
-	for pathname := range paths {
-		err := fileIndex.AddPath(pathname)
+	t.Run("test snapshot and load", func(t *testing.T) {
+		fileIndex := newIndex(t)
+		paths := makePaths(8, 256)
+		for pathname := range paths {
+			err := fileIndex.AddPath(pathname)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if fileIndex.Changes() != uint64(len(paths)) {
+			t.Fatalf("incorrect changes %d", fileIndex.Changes())
+		}
+		err = fileIndex.Snapshot()
 		if err != nil {
 			t.Fatal(err)
 		}
-	}
+		if fileIndex.Changes() != 0 {
+			t.Fatalf("changes are not compacted %d", fileIndex.Changes())
+		}
+		if err = fileIndex.Close(); err != nil {
+			t.Fatal(err)
+		}
 
-	indexPath := "/fileindex"
-	err = fileIndex.WriteTo(indexPath)
-	if err != nil {
-		t.Fatal(err)
-	}
+		fileIndex2 := newIndex(t)
+		defer fileIndex2.Close()
+		for pathname := range paths {
+			assertFound(t, fileIndex2, pathname, true)
+		}
+	})
 
-	fileIndex2 := NewFileTreeIndex(fs, "/", 0)
-	err = fileIndex2.ReadFrom(indexPath)
-	if err != nil {
-		t.Fatal(err)
+	t.Run("test replaying changes after crashes", func(t *testing.T) {
+		err := resetFileIndex(t, newIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fileIndex := newIndex(t)
+		for _, pathname := range []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt"} {
+			if err = fileIndex.AddPath(pathname); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = fileIndex.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+		// these changes are only in the log
+		if err = fileIndex.MovePath("a/b/c.txt", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err = fileIndex.DelPath("a/b/d.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err = fileIndex.RenamePath("a/e.txt", "f.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err = fileIndex.AddPaths([]string{"g/h.txt", "g/i.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		// the server crashes without snapshotting, and the last row is partially written
+		logFile, err := os.OpenFile(filepath.Join(dirPath, logPath), os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = logFile.WriteString(`{"seq":100,"op":"add","pa`); err != nil {
+			t.Fatal(err)
+		}
+		logFile.Close()
+
+		fileIndex2 := newIndex(t)
+		if fileIndex2.Changes() != 5 {
+			t.Fatalf("incorrect changes %d", fileIndex2.Changes())
+		}
+		assertFound(t, fileIndex2, "a/c.txt", true)
+		assertFound(t, fileIndex2, "a/b/c.txt", false)
+		assertFound(t, fileIndex2, "a/b/d.txt", false)
+		assertFound(t, fileIndex2, "a/f.txt", true)
+		assertFound(t, fileIndex2, "g/h.txt", true)
+		assertFound(t, fileIndex2, "g/i.txt", true)
+
+		// the torn row is truncated, so new changes are not lost
+		if err = fileIndex2.AddPath("j/k.txt"); err != nil {
+			t.Fatal(err)
+		}
+		// crashes again
+		fileIndex3 := newIndex(t)
+		assertFound(t, fileIndex3, "j/k.txt", true)
+		if fileIndex3.Changes() != 6 {
+			t.Fatalf("incorrect changes %d", fileIndex3.Changes())
+		}
+		fileIndex3.Close()
+	})
+
+	t.Run("test crashing before truncating the log", func(t *testing.T) {
+		err := resetFileIndex(t, newIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fileIndex := newIndex(t)
+		if err = fileIndex.AddPath("a/b.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err = fileIndex.RenamePath("a/b.txt", "c.txt"); err != nil {
+			t.Fatal(err)
+		}
+		logBytes, err := os.ReadFile(filepath.Join(dirPath, logPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = fileIndex.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+		fileIndex.Close()
+		// the snapshot is renamed but the log is not truncated
+		if err = os.WriteFile(filepath.Join(dirPath, logPath), logBytes, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		fileIndex2 := newIndex(t)
+		defer fileIndex2.Close()
+		if fileIndex2.Changes() != 0 {
+			t.Fatalf("snapshotted changes are replayed %d", fileIndex2.Changes())
+		}
+		assertFound(t, fileIndex2, "a/c.txt", true)
+		assertFound(t, fileIndex2, "a/b.txt", false)
+	})
+
+	t.Run("test changing and searching in snapshotting", func(t *testing.T) {
+		err := resetFileIndex(t, newIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fileIndex := newIndex(t)
+		paths := makePaths(4, 512)
+		added := make(chan bool)
+		wg := &sync.WaitGroup{}
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			defer close(added)
+			for pathname := range paths {
+				if err := fileIndex.AddPath(pathname); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for pathname := range paths {
+				if _, err := fileIndex.Search(path.Base(pathname)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-added:
+					return
+				default:
+				}
+				if err := fileIndex.Snapshot(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		wg.Wait()
+		if t.Failed() {
+			t.FailNow()
+		}
+		changes := fileIndex.Changes()
+		if err = fileIndex.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// changes logged in snapshotting are kept in the log
+		fileIndex2 := newIndex(t)
+		defer fileIndex2.Close()
+		if fileIndex2.Changes() != changes {
+			t.Fatalf("incorrect changes %d (%d)", fileIndex2.Changes(), changes)
+		}
+		for pathname := range paths {
+			assertFound(t, fileIndex2, pathname, true)
+		}
+	})
+}
+
+// resetFileIndex resets the persisted index
+func resetFileIndex(t *testing.T, newIndex func(t *testing.T) *FileTreeIndex) error {
+	fileIndex := newIndex(t)
+	defer fileIndex.Close()
+	if err := fileIndex.Reset(); err != nil {
+		return err
 	}
+	return fileIndex.Snapshot()
 }
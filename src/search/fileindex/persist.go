@@ -0,0 +1,376 @@
+package fileindex
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ihexxa/fsearch"
+)
+
+const (
+	opAdd    = "add"
+	opDel    = "del"
+	opRename = "rename"
+	opMove   = "move"
+	opReset  = "reset"
+)
+
+// changeRecord is a row of the change log
+type changeRecord struct {
+	Seq  uint64 `json:"seq"`
+	Op   string `json:"op"`
+	Path string `json:"path,omitempty"`
+	// Arg is the new name of renaming or the destination of moving
+	Arg string `json:"arg,omitempty"`
+}
+
+// snapshotHeader is the first row of snapshots, changes with greater sequences are not in the snapshot,
+// snapshots without headers (written by previous versions) contain no logged changes
+type snapshotHeader struct {
+	SnapshotSeq *uint64 `json:"snapshotSeq"`
+}
+
+type changeLog struct {
+	file *os.File
+	path string
+	// seq is the sequence of the last logged change
+	seq         uint64
+	snapshotSeq uint64
+}
+
+// append writes changes and syncs them to the disk
+func (log *changeLog) append(records ...*changeRecord) error {
+	rows := []byte{}
+	seq := log.seq
+	for _, record := range records {
+		seq++
+		record.Seq = seq
+		recordBytes, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		rows = append(append(rows, recordBytes...), '\n')
+	}
+
+	if _, err := log.file.Write(rows); err != nil {
+		return err
+	}
+	if err := log.file.Sync(); err != nil {
+		return err
+	}
+	log.seq = seq
+	return nil
+}
+
+// compact removes changes in the snapshot from the log, changes logged after logSize (i.e. in snapshotting)
+// are written into a new log which replaces the current one, so the log is valid if the server crashes
+func (log *changeLog) compact(snapshotSeq uint64, logSize int64) error {
+	size, err := log.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if size == logSize {
+		if err = log.file.Truncate(0); err != nil {
+			return err
+		}
+		if err = log.file.Sync(); err != nil {
+			return err
+		}
+		log.snapshotSeq = snapshotSeq
+		return nil
+	}
+
+	rows := make([]byte, size-logSize)
+	if _, err = log.file.ReadAt(rows, logSize); err != nil {
+		return err
+	}
+	tmpPath := log.path + ".tmp"
+	if err = writeAndSync(tmpPath, rows); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, log.path); err != nil {
+		return err
+	}
+	if err = syncDir(filepath.Dir(log.path)); err != nil {
+		return err
+	}
+
+	logFile, err := os.OpenFile(log.path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	log.file.Close()
+	log.file = logFile
+	log.snapshotSeq = snapshotSeq
+	return nil
+}
+
+func (log *changeLog) close() error {
+	return log.file.Close()
+}
+
+func (idx *FileTreeIndex) realPath(pathname string) string {
+	return filepath.Join(idx.fs.Root(), filepath.FromSlash(pathname))
+}
+
+// Load restores the index from the snapshot and replays the change log,
+// it should be called before changing the index, otherwise changes are not logged
+func (idx *FileTreeIndex) Load() error {
+	if !idx.persistent() {
+		return nil
+	}
+
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	if idx.log != nil {
+		return errors.New("file index is loaded")
+	}
+
+	snapshotSeq, err := idx.readSnapshot()
+	if err != nil {
+		return err
+	}
+
+	// changes are always appended at the end, even after the log is truncated
+	logPath := idx.realPath(idx.logPath)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	lastSeq, err := idx.replay(logFile, snapshotSeq)
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+
+	idx.log = &changeLog{
+		file:        logFile,
+		path:        logPath,
+		seq:         lastSeq,
+		snapshotSeq: snapshotSeq,
+	}
+	return nil
+}
+
+func (idx *FileTreeIndex) readSnapshot() (uint64, error) {
+	f, err := os.Open(idx.realPath(idx.snapshotPath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	firstRow, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	} else if firstRow == "" {
+		return 0, nil
+	}
+
+	snapshotSeq := uint64(0)
+	header := &snapshotHeader{}
+	rowsChan := make(chan string, 1024)
+	if err = json.Unmarshal([]byte(firstRow), header); err == nil && header.SnapshotSeq != nil {
+		snapshotSeq = *header.SnapshotSeq
+	} else {
+		rowsChan <- firstRow
+	}
+
+	var readErr error
+	go func() {
+		defer close(rowsChan)
+		for {
+			row, err := reader.ReadString('\n')
+			if row != "" {
+				rowsChan <- row
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr = err
+				}
+				return
+			}
+		}
+	}()
+
+	index := fsearch.New(idx.pathSeparator, idx.maxResultSize)
+	err = index.Unmarshal(rowsChan)
+	// rows must be drained before checking the reading error
+	for range rowsChan {
+	}
+	if err != nil {
+		return 0, err
+	} else if readErr != nil {
+		return 0, readErr
+	} else if err = index.Error(); err != nil {
+		return 0, fmt.Errorf("invalid file index snapshot: %w", err)
+	}
+
+	idx.index = index
+	return snapshotSeq, nil
+}
+
+// replay applies changes after the snapshot, it returns the sequence of the last change,
+// an incomplete last row (e.g. the server crashed in writing it) is truncated
+func (idx *FileTreeIndex) replay(logFile *os.File, snapshotSeq uint64) (uint64, error) {
+	lastSeq := snapshotSeq
+	validSize := int64(0)
+	reader := bufio.NewReader(logFile)
+	for {
+		row, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if row == "" || row[len(row)-1] != '\n' {
+			break
+		}
+
+		record := &changeRecord{}
+		if err = json.Unmarshal([]byte(row), record); err != nil {
+			break
+		}
+		validSize += int64(len(row))
+		if record.Seq <= snapshotSeq {
+			// the server could crash after writing the snapshot and before truncating the log
+			continue
+		}
+
+		if err = idx.apply(record); err != nil &&
+			!errors.Is(err, fsearch.ErrNotFound) {
+			return 0, fmt.Errorf("failed to replay change (%d): %w", record.Seq, err)
+		}
+		lastSeq = record.Seq
+	}
+
+	return lastSeq, logFile.Truncate(validSize)
+}
+
+// Snapshot writes the index into a temporary file and renames it, so that the previous snapshot
+// is kept if it fails, then changes in the snapshot are removed from the log.
+// The index is copied under the lock and written without it, so changes are not blocked by writing.
+func (idx *FileTreeIndex) Snapshot() error {
+	if !idx.persistent() {
+		return nil
+	}
+
+	idx.snapshotMtx.Lock()
+	defer idx.snapshotMtx.Unlock()
+
+	snapshotPath := idx.realPath(idx.snapshotPath)
+	rows, seq, logSize, err := idx.copyIndex(snapshotPath)
+	if err != nil {
+		return err
+	} else if rows == nil {
+		return nil
+	}
+
+	tmpPath := snapshotPath + ".tmp"
+	err = writeSnapshot(tmpPath, seq, rows)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, snapshotPath); err != nil {
+		return err
+	}
+	if err = syncDir(filepath.Dir(snapshotPath)); err != nil {
+		return err
+	}
+
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	if idx.log == nil {
+		return ErrClosed
+	}
+	return idx.log.compact(seq, logSize)
+}
+
+// copyIndex returns rows of the index with the sequence and the log size when they are copied,
+// rows are nil if there is no change after the last snapshot
+func (idx *FileTreeIndex) copyIndex(snapshotPath string) ([]string, uint64, int64, error) {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	if idx.log == nil {
+		return nil, 0, 0, errors.New("file index is not loaded")
+	}
+	if _, err := os.Stat(snapshotPath); err == nil && idx.log.seq == idx.log.snapshotSeq {
+		return nil, 0, 0, nil
+	}
+	logSize, err := idx.log.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	rows := []string{}
+	for row := range idx.index.Marshal() {
+		rows = append(rows, row)
+	}
+	if err = idx.index.Error(); err != nil {
+		return nil, 0, 0, err
+	}
+	return rows, idx.log.seq, logSize, nil
+}
+
+func writeSnapshot(tmpPath string, seq uint64, rows []string) error {
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	writer := bufio.NewWriter(f)
+	headerBytes, err := json.Marshal(&snapshotHeader{SnapshotSeq: &seq})
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(append(headerBytes, '\n')); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err = writer.WriteString(row + "\n"); err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func writeAndSync(filePath string, content []byte) error {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = f.Write(content); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// syncDir persists renaming in the dir, it is not supported on some platforms (e.g. Windows)
+func syncDir(dirPath string) error {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err = dir.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package filequery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SortByPath    = "path"
+	SortByName    = "name"
+	SortBySize    = "size"
+	SortByModTime = "modTime"
+)
+
+// cursor is the last item of the previous page, items are ordered by the sorting key and then the path
+type cursor struct {
+	SortBy  string `json:"s"`
+	Desc    bool   `json:"d"`
+	Path    string `json:"p"`
+	Name    string `json:"n"`
+	Size    int64  `json:"z"`
+	ModTime int64  `json:"m"`
+}
+
+// EncodeCursor encodes the last item of the page, it is also used by pages queried from the db
+func EncodeCursor(item *Item, sortBy string, desc bool) (string, error) {
+	cursorBytes, err := json.Marshal(&cursor{
+		SortBy:  sortBy,
+		Desc:    desc,
+		Path:    item.Path,
+		Name:    item.Name,
+		Size:    item.Size,
+		ModTime: item.ModTime.UnixNano(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorBytes), nil
+}
+
+// DecodeCursor returns the last item of the previous page, the cursor must be for the same order
+func DecodeCursor(cursorStr, sortBy string, desc bool) (*Item, error) {
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(cursorStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor %s", ErrInvalidQuery, err)
+	}
+	cur := &cursor{}
+	if err = json.Unmarshal(cursorBytes, cur); err != nil {
+		return nil, fmt.Errorf("%w: cursor %s", ErrInvalidQuery, err)
+	} else if cur.SortBy != sortBy || cur.Desc != desc {
+		return nil, fmt.Errorf("%w: the cursor is for another order", ErrInvalidQuery)
+	}
+	return &Item{
+		Path:    cur.Path,
+		Name:    cur.Name,
+		Size:    cur.Size,
+		ModTime: time.Unix(0, cur.ModTime),
+	}, nil
+}
+
+func lessFunc(sortBy string, desc bool) (func(item1, item2 *Item) bool, error) {
+	var compare func(item1, item2 *Item) int
+	switch sortBy {
+	case "", SortByPath:
+		compare = func(item1, item2 *Item) int { return 0 }
+	case SortByName:
+		compare = func(item1, item2 *Item) int {
+			return strings.Compare(strings.ToLower(item1.Name), strings.ToLower(item2.Name))
+		}
+	case SortBySize:
+		compare = func(item1, item2 *Item) int {
+			switch {
+			case item1.Size < item2.Size:
+				return -1
+			case item1.Size > item2.Size:
+				return 1
+			}
+			return 0
+		}
+	case SortByModTime:
+		compare = func(item1, item2 *Item) int {
+			return item1.ModTime.Compare(item2.ModTime)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown sorting key %s", ErrInvalidQuery, sortBy)
+	}
+
+	return func(item1, item2 *Item) bool {
+		result := compare(item1, item2)
+		if result == 0 {
+			// paths are unique
+			result = strings.Compare(item1.Path, item2.Path)
+		}
+		if desc {
+			return result > 0
+		}
+		return result < 0
+	}, nil
+}
+
+// CheckSortBy checks if items can be sorted by the key
+func CheckSortBy(sortBy string) error {
+	_, err := lessFunc(sortBy, false)
+	return err
+}
+
+// Sort sorts items by the key and then the path, items are in the order of pages
+func Sort(items []*Item, sortBy string, desc bool) error {
+	less, err := lessFunc(sortBy, desc)
+	if err != nil {
+		return err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+	return nil
+}
+
+// Page sorts items and returns the page after the cursor,
+// the returned cursor is empty if there are no more items
+func Page(items []*Item, sortBy string, desc bool, cursorStr string, limit int) ([]*Item, string, error) {
+	if err := Sort(items, sortBy, desc); err != nil {
+		return nil, "", err
+	}
+	return PageSorted(items, sortBy, desc, cursorStr, limit)
+}
+
+// PageSorted returns the page after the cursor from items sorted by Sort,
+// the cursor is found by binary search so that paging sorted items (e.g. cached listings) is cheap
+func PageSorted(items []*Item, sortBy string, desc bool, cursorStr string, limit int) ([]*Item, string, error) {
+	less, err := lessFunc(sortBy, desc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := 0
+	if cursorStr != "" {
+		last, err := DecodeCursor(cursorStr, sortBy, desc)
+		if err != nil {
+			return nil, "", err
+		}
+		// items could be changed between pages, the page starts from the first item after the cursor
+		start = sort.Search(len(items), func(i int) bool {
+			return less(last, items[i])
+		})
+	}
+
+	end := start + limit
+	if end >= len(items) {
+		return items[start:], "", nil
+	}
+	nextCursor, err := EncodeCursor(items[end-1], sortBy, desc)
+	if err != nil {
+		return nil, "", err
+	}
+	return items[start:end], nextCursor, nil
+}
@@ -0,0 +1,362 @@
+// Package filequery parses and evaluates structured file queries, e.g.
+// `ext:pdf size:>50MB modified:2024-09-01..2024-09-30 in:alice/files/docs`
+package filequery
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+const dateLayout = "2006-01-02"
+
+// Item is a file or a folder to be matched
+type Item struct {
+	Path    string    `json:"path"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+	Sha1    string    `json:"sha1"`
+}
+
+// Query matches items satisfying all terms, zero values mean no limits
+type Query struct {
+	// Names are lower-cased globs or substrings of names, all of them must be matched
+	Names []string
+	// Exts are lower-cased extensions without dots, one of them must be matched
+	Exts []string
+	// size range (inclusive), -1 means no limit
+	MinSize int64
+	MaxSize int64
+	// modification time range: [ModifiedAfter, ModifiedBefore)
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	IsDir          *bool
+	Sha1           string
+	// Scopes are paths, items must be under one of them
+	Scopes []string
+}
+
+// Parse parses the query, terms are separated by spaces and values could be quoted:
+//
+//	report name:"*.tar.gz" ext:pdf,doc size:>50MB size:1KB..2MB modified:7d
+//	modified:>2024-01-01 modified:2024-01-01..2024-01-31 is:dir sha1:<hex> in:<path>
+//
+// words without keys match names, relative times (e.g. 7d, 12h, 2w) are the times before now
+func Parse(queryStr string, now time.Time) (*Query, error) {
+	terms, err := tokenize(queryStr)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &Query{MinSize: -1, MaxSize: -1}
+	for _, term := range terms {
+		key, val := "", term
+		if i := strings.Index(term, ":"); i > 0 && !strings.HasPrefix(term, `"`) {
+			key, val = strings.ToLower(term[:i]), unquote(term[i+1:])
+		} else {
+			val = unquote(term)
+		}
+		if val == "" {
+			return nil, fmt.Errorf("%w: empty value of %s", ErrInvalidQuery, term)
+		}
+
+		switch key {
+		case "", "name":
+			query.Names = append(query.Names, strings.ToLower(val))
+		case "ext":
+			for _, ext := range strings.Split(val, ",") {
+				ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+				if ext != "" {
+					query.Exts = append(query.Exts, ext)
+				}
+			}
+		case "size":
+			if err = query.parseSize(val); err != nil {
+				return nil, err
+			}
+		case "modified":
+			if err = query.parseModified(val, now); err != nil {
+				return nil, err
+			}
+		case "is":
+			isDir := false
+			switch strings.ToLower(val) {
+			case "dir", "folder":
+				isDir = true
+			case "file":
+			default:
+				return nil, fmt.Errorf("%w: is:%s", ErrInvalidQuery, val)
+			}
+			query.IsDir = &isDir
+		case "sha1":
+			query.Sha1 = strings.ToLower(val)
+		case "in":
+			scope, err := ParseScope(val)
+			if err != nil {
+				return nil, err
+			}
+			query.Scopes = append(query.Scopes, scope)
+		default:
+			return nil, fmt.Errorf("%w: unknown key %s", ErrInvalidQuery, key)
+		}
+	}
+
+	for _, name := range query.Names {
+		if _, err = path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("%w: name %s: %s", ErrInvalidQuery, name, err)
+		}
+	}
+	return query, nil
+}
+
+func tokenize(queryStr string) ([]string, error) {
+	terms := []string{}
+	term := &strings.Builder{}
+	quoted := false
+	for _, r := range queryStr {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("%w: unclosed quote", ErrInvalidQuery)
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+func unquote(val string) string {
+	return strings.ReplaceAll(val, `"`, "")
+}
+
+// splitRange splits ">x", ">=x", "<x", "<=x", "x..y" and "x" into operators and operands
+func splitRange(val string) (string, string, string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(val, op) {
+			return op, strings.TrimSpace(val[len(op):]), ""
+		}
+	}
+	if i := strings.Index(val, ".."); i >= 0 {
+		return "..", strings.TrimSpace(val[:i]), strings.TrimSpace(val[i+2:])
+	}
+	return "", val, ""
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"tb", 1 << 40}, {"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+	{"t", 1 << 40}, {"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10},
+	{"b", 1},
+}
+
+func parseSize(val string) (int64, error) {
+	lowerVal := strings.ToLower(val)
+	unit := int64(1)
+	for _, sizeUnit := range sizeUnits {
+		if strings.HasSuffix(lowerVal, sizeUnit.suffix) {
+			lowerVal, unit = strings.TrimSuffix(lowerVal, sizeUnit.suffix), sizeUnit.size
+			break
+		}
+	}
+	num, err := strconv.ParseFloat(strings.TrimSpace(lowerVal), 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("%w: size %s", ErrInvalidQuery, val)
+	}
+	return int64(num * float64(unit)), nil
+}
+
+func (query *Query) parseSize(val string) error {
+	op, left, right := splitRange(val)
+	leftSize, err := parseSize(left)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case ">":
+		query.MinSize = leftSize + 1
+	case ">=":
+		query.MinSize = leftSize
+	case "<":
+		if leftSize == 0 {
+			return fmt.Errorf("%w: size %s", ErrInvalidQuery, val)
+		}
+		query.MaxSize = leftSize - 1
+	case "<=":
+		query.MaxSize = leftSize
+	case "..":
+		rightSize, err := parseSize(right)
+		if err != nil {
+			return err
+		} else if rightSize < leftSize {
+			return fmt.Errorf("%w: size %s", ErrInvalidQuery, val)
+		}
+		query.MinSize, query.MaxSize = leftSize, rightSize
+	default:
+		query.MinSize, query.MaxSize = leftSize, leftSize
+	}
+	return nil
+}
+
+// parseTime returns the time and the end of the day if it is a date
+func parseTime(val string, now time.Time) (time.Time, time.Time, error) {
+	lowerVal := strings.ToLower(val)
+	for suffix, unit := range map[string]time.Duration{
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	} {
+		if strings.HasSuffix(lowerVal, suffix) {
+			num, err := strconv.Atoi(strings.TrimSuffix(lowerVal, suffix))
+			if err == nil && num >= 0 {
+				t := now.Add(-time.Duration(num) * unit)
+				return t, t, nil
+			}
+		}
+	}
+
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, t, nil
+	}
+	if t, err := time.ParseInLocation(dateLayout, val, now.Location()); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%w: time %s", ErrInvalidQuery, val)
+}
+
+func (query *Query) parseModified(val string, now time.Time) error {
+	op, left, right := splitRange(val)
+	leftStart, leftEnd, err := parseTime(left, now)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case ">", ">=":
+		query.ModifiedAfter = leftStart
+		if op == ">" {
+			query.ModifiedAfter = leftEnd
+		}
+	case "<", "<=":
+		query.ModifiedBefore = leftStart
+		if op == "<=" {
+			query.ModifiedBefore = leftEnd
+		}
+	case "..":
+		_, rightEnd, err := parseTime(right, now)
+		if err != nil {
+			return err
+		} else if rightEnd.Before(leftStart) {
+			return fmt.Errorf("%w: modified %s", ErrInvalidQuery, val)
+		}
+		query.ModifiedAfter, query.ModifiedBefore = leftStart, rightEnd
+	default:
+		if leftStart.Equal(leftEnd) {
+			// relative time: modified since then
+			query.ModifiedAfter = leftStart
+		} else {
+			query.ModifiedAfter, query.ModifiedBefore = leftStart, leftEnd
+		}
+	}
+	return nil
+}
+
+// ParseScope cleans the folder path of "in:", e.g. "/alice/files/docs/" becomes "alice/files/docs"
+func ParseScope(val string) (string, error) {
+	scope := strings.Trim(path.Clean(val), "/")
+	if scope == "." || scope == "" || strings.HasPrefix(scope, "..") {
+		return "", fmt.Errorf("%w: in:%s", ErrInvalidQuery, val)
+	}
+	return scope, nil
+}
+
+// InScope checks if the item path is the scope or under it
+func InScope(itemPath, scope string) bool {
+	return scope == "" || itemPath == scope || strings.HasPrefix(itemPath, scope+"/")
+}
+
+// Match checks the item with all terms
+func (query *Query) Match(item *Item) bool {
+	if !query.MatchMetadata(item) {
+		return false
+	}
+	return query.Sha1 == "" || (!item.IsDir && strings.ToLower(item.Sha1) == query.Sha1)
+}
+
+// MatchMetadata checks the item with all terms except sha1,
+// sha1 is stored in the db and it could be filled after matching other terms
+func (query *Query) MatchMetadata(item *Item) bool {
+	name := strings.ToLower(item.Name)
+	for _, pattern := range query.Names {
+		if strings.ContainsAny(pattern, "*?[") {
+			if ok, _ := path.Match(pattern, name); !ok {
+				return false
+			}
+		} else if !strings.Contains(name, pattern) {
+			return false
+		}
+	}
+
+	if len(query.Exts) > 0 {
+		ext := strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+		matched := false
+		for _, expected := range query.Exts {
+			if ext == expected {
+				matched = true
+				break
+			}
+		}
+		if item.IsDir || !matched {
+			return false
+		}
+	}
+
+	if query.IsDir != nil && *query.IsDir != item.IsDir {
+		return false
+	}
+	// sizes of folders are not counted
+	if (query.MinSize >= 0 || query.MaxSize >= 0) && item.IsDir {
+		return false
+	} else if query.MinSize >= 0 && item.Size < query.MinSize {
+		return false
+	} else if query.MaxSize >= 0 && item.Size > query.MaxSize {
+		return false
+	}
+
+	if !query.ModifiedAfter.IsZero() && item.ModTime.Before(query.ModifiedAfter) {
+		return false
+	} else if !query.ModifiedBefore.IsZero() && !item.ModTime.Before(query.ModifiedBefore) {
+		return false
+	}
+
+	if len(query.Scopes) > 0 {
+		for _, scope := range query.Scopes {
+			if InScope(item.Path, scope) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package filequery
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	now := time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	items := map[string]*Item{
+		"report": {Path: "alice/files/docs/Report.PDF", Name: "Report.PDF", Size: 60 << 20, ModTime: now.Add(-20 * day), Sha1: "ABC"},
+		"small":  {Path: "alice/files/docs/small.pdf", Name: "small.pdf", Size: 1 << 20, ModTime: now.Add(-20 * day)},
+		"old":    {Path: "alice/files/old.pdf", Name: "old.pdf", Size: 80 << 20, ModTime: now.Add(-90 * day)},
+		"photo":  {Path: "alice/files/my photo.jpg", Name: "my photo.jpg", Size: 2 << 20, ModTime: now.Add(-time.Hour)},
+		"docs":   {Path: "alice/files/docs", Name: "docs", IsDir: true, ModTime: now.Add(-time.Hour)},
+	}
+
+	t.Run("test matching", func(t *testing.T) {
+		for queryStr, expected := range map[string][]string{
+			"ext:pdf size:>50MB modified:2024-09-01..2024-09-30": {"report"},
+			"ext:pdf,jpg size:<=2m":                              {"small", "photo"},
+			"name:*.pdf in:alice/files/docs":                     {"report", "small"},
+			"report":                                             {"report"},
+			`"my photo"`:                                         {"photo"},
+			`name:"my *"`:                                        {"photo"},
+			"is:dir":                                             {"docs"},
+			"is:file modified:7d":                                {"photo"},
+			"modified:<2024-08-01":                               {"old"},
+			"sha1:abc":                                           {"report"},
+			"size:1MB..2MB":                                      {"small", "photo"},
+		} {
+			query, err := Parse(queryStr, now)
+			if err != nil {
+				t.Fatalf("%s: %s", queryStr, err)
+			}
+
+			expectedSet := map[string]bool{}
+			for _, key := range expected {
+				expectedSet[key] = true
+			}
+			for key, item := range items {
+				if query.Match(item) != expectedSet[key] {
+					t.Fatalf("%s: matching %s should be %t", queryStr, key, expectedSet[key])
+				}
+			}
+		}
+	})
+
+	t.Run("test invalid queries", func(t *testing.T) {
+		for _, queryStr := range []string{
+			"owner:alice",
+			"size:>abc",
+			"size:2MB..1MB",
+			"modified:yesterday",
+			"is:link",
+			`name:"unclosed`,
+			"in:../etc",
+			"name:[",
+		} {
+			if _, err := Parse(queryStr, now); !errors.Is(err, ErrInvalidQuery) {
+				t.Fatalf("%s: unexpected error %v", queryStr, err)
+			}
+		}
+	})
+
+	t.Run("test paging", func(t *testing.T) {
+		pageItems := []*Item{}
+		for i := 0; i < 10; i++ {
+			pageItems = append(pageItems, &Item{
+				Path: fmt.Sprintf("alice/files/f%d", i),
+				Name: fmt.Sprintf("f%d", i),
+				// sizes are duplicated
+				Size: int64(i / 2),
+			})
+		}
+
+		paged := []*Item{}
+		cursor := ""
+		for {
+			page, nextCursor, err := Page(pageItems, SortBySize, true, cursor, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, page...)
+			if nextCursor == "" {
+				break
+			}
+			cursor = nextCursor
+		}
+		if len(paged) != 10 {
+			t.Fatalf("paged items not matched %d", len(paged))
+		}
+		for i := 1; i < len(paged); i++ {
+			if paged[i-1].Size < paged[i].Size ||
+				(paged[i-1].Size == paged[i].Size && paged[i-1].Path < paged[i].Path) {
+				t.Fatalf("items are not sorted %+v %+v", paged[i-1], paged[i])
+			}
+		}
+
+		if _, _, err := Page(pageItems, SortByName, true, cursor, 3); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("cursor of another order should be rejected: %v", err)
+		}
+		if _, _, err := Page(pageItems, "owner", false, "", 3); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("unknown sorting key should be rejected: %v", err)
+		}
+	})
+}
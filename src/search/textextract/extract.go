@@ -0,0 +1,149 @@
+// Package textextract extracts plain texts from documents for full-text indexing,
+// it supports plain texts, Markdown, source code, HTML, Office Open XML, OpenDocument and simple PDFs
+package textextract
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrUnsupported = errors.New("unsupported file type")
+
+type kind int
+
+const (
+	kindUnknown kind = iota
+	kindText
+	kindHTML
+	kindPDF
+	kindOOXML
+	kindODF
+)
+
+var kinds = map[string]kind{
+	".html":  kindHTML,
+	".htm":   kindHTML,
+	".xhtml": kindHTML,
+	".pdf":   kindPDF,
+	".docx":  kindOOXML,
+	".pptx":  kindOOXML,
+	".xlsx":  kindOOXML,
+	".odt":   kindODF,
+	".odp":   kindODF,
+	".ods":   kindODF,
+}
+
+var textExts = []string{
+	// documents and data
+	".txt", ".text", ".md", ".markdown", ".rst", ".adoc", ".org", ".tex",
+	".csv", ".tsv", ".log", ".json", ".yaml", ".yml", ".toml", ".ini", ".cfg", ".conf", ".xml",
+	// source code
+	".go", ".py", ".js", ".mjs", ".cjs", ".jsx", ".ts", ".tsx", ".vue", ".svelte",
+	".java", ".kt", ".kts", ".scala", ".groovy", ".gradle", ".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".hh",
+	".cs", ".rs", ".rb", ".php", ".pl", ".pm", ".swift", ".m", ".mm", ".dart", ".lua", ".r",
+	".ex", ".exs", ".erl", ".hs", ".clj", ".sh", ".bash", ".zsh", ".fish", ".ps1", ".bat",
+	".sql", ".css", ".scss", ".sass", ".less", ".proto", ".graphql",
+}
+
+// textNames are names of text files without extensions
+var textNames = map[string]bool{
+	"readme":       true,
+	"license":      true,
+	"makefile":     true,
+	"dockerfile":   true,
+	"changelog":    true,
+	"authors":      true,
+	"contributing": true,
+}
+
+func init() {
+	for _, ext := range textExts {
+		kinds[ext] = kindText
+	}
+}
+
+func kindOf(name string) kind {
+	lowerName := strings.ToLower(path.Base(name))
+	ext := path.Ext(lowerName)
+	if ext == "" {
+		if textNames[lowerName] {
+			return kindText
+		}
+		return kindUnknown
+	}
+	return kinds[ext]
+}
+
+// Supported checks if texts could be extracted from the file by its name
+func Supported(name string) bool {
+	return kindOf(name) != kindUnknown
+}
+
+// Extract extracts the text of the file content, the type is decided by the name,
+// the text is truncated if it is longer than maxTextLen bytes
+func Extract(name string, content []byte, maxTextLen int) (string, error) {
+	var text string
+	var err error
+	switch kindOf(name) {
+	case kindText:
+		text, err = extractPlainText(content)
+	case kindHTML:
+		text, err = extractHTML(content)
+	case kindPDF:
+		text, err = extractPDF(content)
+	case kindOOXML:
+		text, err = extractOOXML(name, content)
+	case kindODF:
+		text, err = extractODF(content)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncate(normalizeSpaces(text), maxTextLen), nil
+}
+
+func extractPlainText(content []byte) (string, error) {
+	// NUL is not expected in text files
+	head := content
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return "", ErrUnsupported
+	}
+	return strings.ToValidUTF8(string(content), ""), nil
+}
+
+// normalizeSpaces collapses spaces in lines and removes blank lines
+func normalizeSpaces(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncate(text string, maxLen int) string {
+	if maxLen <= 0 || len(text) <= maxLen {
+		return text
+	}
+	text = text[:maxLen]
+	// the last rune could be cut
+	for len(text) > 0 {
+		r, size := utf8.DecodeLastRuneInString(text)
+		if r != utf8.RuneError || size > 1 {
+			break
+		}
+		text = text[:len(text)-1]
+	}
+	return text
+}
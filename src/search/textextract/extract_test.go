@@ -0,0 +1,154 @@
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func pdfFile(t *testing.T, contentStream string) []byte {
+	compressed := &bytes.Buffer{}
+	zlibWriter := zlib.NewWriter(compressed)
+	if _, err := zlibWriter.Write([]byte(contentStream)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zlibWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := &bytes.Buffer{}
+	pdf.WriteString("%PDF-1.4\n")
+	pdf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	pdf.WriteString("2 0 obj\n<< /Type /XObject /Subtype /Image /Length 4 >>\nstream\n(Image) Tj\nendstream\nendobj\n")
+	fmt.Fprintf(pdf, "3 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	t.Run("test extracting", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			content  []byte
+			expected string
+		}{
+			{
+				name:     "notes.md",
+				content:  []byte("# Title\n\n  quarterly   report\n"),
+				expected: "# Title\nquarterly report",
+			},
+			{
+				name:     "Makefile",
+				content:  []byte("build:\n\tgo build"),
+				expected: "build:\ngo build",
+			},
+			{
+				name: "page.html",
+				content: []byte(`<html><head><title>Home</title><style>body {color: red}</style></head>
+					<body><p>Hello <b>Wor</b>ld &amp; friends</p><script>var secret = 1</script><div>Bye</div></body></html>`),
+				expected: "Home\nHello World & friends\nBye",
+			},
+			{
+				name: "doc.docx",
+				content: zipFiles(t, map[string]string{
+					"word/document.xml": `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Budget</w:t></w:r><w:r><w:t xml:space="preserve"> plan</w:t></w:r></w:p><w:p><w:r><w:t>Second</w:t></w:r></w:p></w:body></w:document>`,
+					"word/styles.xml":   `<w:styles xmlns:w="w"><w:t>style</w:t></w:styles>`,
+					"word/header1.xml":  `<w:hdr xmlns:w="w"><w:p><w:r><w:t>Header</w:t></w:r></w:p></w:hdr>`,
+				}),
+				expected: "Budget plan\nSecond\nHeader",
+			},
+			{
+				name: "slides.pptx",
+				content: zipFiles(t, map[string]string{
+					"ppt/slides/slide10.xml": `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>Ten</a:t></a:r></a:p></p:sld>`,
+					"ppt/slides/slide2.xml":  `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>Two</a:t></a:r></a:p></p:sld>`,
+				}),
+				expected: "Two\nTen",
+			},
+			{
+				name: "sheet.xlsx",
+				content: zipFiles(t, map[string]string{
+					"xl/sharedStrings.xml": `<sst><si><t>Revenue</t></si><si><r><t>Net </t></r><r><t>income</t></r></si></sst>`,
+				}),
+				expected: "Revenue\nNet income",
+			},
+			{
+				name: "doc.odt",
+				content: zipFiles(t, map[string]string{
+					"content.xml": `<office:document-content xmlns:office="o" xmlns:text="t"><office:body><office:text><text:h>Minutes</text:h><text:p>Open<text:s/>source</text:p></office:text></office:body></office:document-content>`,
+				}),
+				expected: "Minutes\nOpen source",
+			},
+			{
+				name:     "report.pdf",
+				content:  pdfFile(t, "BT /F1 12 Tf 72 712 Td (Annual \\(draft\\)) Tj 0 -14 Td [(Re) -10 (port) -250 (2024)] TJ ET"),
+				expected: "Annual (draft)\nReport 2024",
+			},
+			{
+				name:     "unicode.pdf",
+				content:  pdfFile(t, "BT <FEFF00480069> Tj T* <0041> Tj ET"),
+				expected: "Hi\nA",
+			},
+		}
+
+		for _, tc := range testCases {
+			if !Supported(tc.name) {
+				t.Fatalf("%s should be supported", tc.name)
+			}
+			text, err := Extract(tc.name, tc.content, 0)
+			if err != nil {
+				t.Fatalf("%s: %s", tc.name, err)
+			} else if text != tc.expected {
+				t.Fatalf("%s: text not matched %q %q", tc.name, text, tc.expected)
+			}
+		}
+	})
+
+	t.Run("test unsupported files", func(t *testing.T) {
+		for name, content := range map[string][]byte{
+			"photo.jpg":     {0xff, 0xd8, 0xff},
+			"binary.txt":    {'a', 0, 'b'},
+			"encrypted.pdf": []byte("%PDF-1.4\n<< /Encrypt 5 0 R >>"),
+			"fake.pdf":      []byte("not a pdf"),
+		} {
+			if _, err := Extract(name, content, 0); !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+		}
+		if _, err := Extract("broken.docx", []byte("not a zip"), 0); err == nil {
+			t.Fatal("broken file should not be extracted")
+		}
+	})
+
+	t.Run("test truncating", func(t *testing.T) {
+		text, err := Extract("a.txt", []byte(strings.Repeat("界", 10)), 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if text != strings.Repeat("界", 3) {
+			t.Fatalf("text not truncated %q", text)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package textextract
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// texts in these elements are not displayed
+var skippedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+}
+
+// blockTags start new lines
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "td": true, "th": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"title": true, "pre": true, "blockquote": true, "section": true, "article": true,
+	"header": true, "footer": true, "table": true, "ul": true, "ol": true, "dd": true, "dt": true,
+}
+
+func extractHTML(content []byte) (string, error) {
+	text := &strings.Builder{}
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	skipped := 0
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return "", err
+			}
+			return text.String(), nil
+		case html.TextToken:
+			if skipped == 0 {
+				text.Write(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if skippedTags[tag] && tokenType != html.SelfClosingTagToken {
+				if tokenType == html.StartTagToken {
+					skipped++
+				} else if skipped > 0 {
+					skipped--
+				}
+			}
+			// inline elements (e.g. <b>) do not separate words
+			if blockTags[tag] {
+				text.WriteString("\n")
+			}
+		}
+	}
+}
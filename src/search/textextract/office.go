@@ -0,0 +1,147 @@
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxXMLSize limits the decompressed size of each xml part against zip bombs
+const maxXMLSize = 64 * 1024 * 1024
+
+// xmlText collects character data in xml elements,
+// all character data is collected if textElems is nil, elements are matched by local names
+func xmlText(r io.Reader, textElems, breakElems map[string]bool, text *strings.Builder) error {
+	decoder := xml.NewDecoder(io.LimitReader(r, maxXMLSize))
+	// it is not strict for the files generated by different softwares
+	decoder.Strict = false
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if textElems[elem.Name.Local] {
+				depth++
+			}
+		case xml.EndElement:
+			if textElems[elem.Name.Local] && depth > 0 {
+				depth--
+			}
+			if breakElems[elem.Name.Local] {
+				text.WriteString("\n")
+			} else if elem.Name.Local == "tab" || elem.Name.Local == "s" {
+				text.WriteString(" ")
+			}
+		case xml.CharData:
+			if textElems == nil || depth > 0 {
+				text.Write(elem)
+			}
+		}
+	}
+}
+
+func readZipFile(file *zip.File, textElems, breakElems map[string]bool, text *strings.Builder) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xmlText(r, textElems, breakElems, text)
+}
+
+// partNum returns the number in a part's name, e.g. 12 of "slide12.xml"
+func partNum(name string) int {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	num, _ := strconv.Atoi(strings.TrimLeft(base, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+	return num
+}
+
+// extractOOXML extracts texts of Word, PowerPoint and Excel files
+func extractOOXML(name string, content []byte) (string, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("invalid office file: %w", err)
+	}
+
+	var partPrefix string
+	switch strings.ToLower(path.Ext(name)) {
+	case ".docx":
+		partPrefix = "word/"
+	case ".pptx":
+		partPrefix = "ppt/slides/slide"
+	case ".xlsx":
+		partPrefix = "xl/sharedStrings"
+	default:
+		return "", ErrUnsupported
+	}
+
+	parts := []*zip.File{}
+	for _, file := range zipReader.File {
+		if !strings.HasPrefix(file.Name, partPrefix) || path.Ext(file.Name) != ".xml" {
+			continue
+		}
+		if partPrefix == "word/" {
+			// the document, headers, footers and notes
+			base := path.Base(file.Name)
+			if path.Dir(file.Name) != "word" ||
+				!(base == "document.xml" || base == "footnotes.xml" || base == "endnotes.xml" ||
+					strings.HasPrefix(base, "header") || strings.HasPrefix(base, "footer")) {
+				continue
+			}
+		}
+		parts = append(parts, file)
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		// the document goes first and slides are ordered by numbers
+		if path.Base(parts[i].Name) == "document.xml" {
+			return true
+		} else if path.Base(parts[j].Name) == "document.xml" {
+			return false
+		}
+		return partNum(parts[i].Name) < partNum(parts[j].Name)
+	})
+
+	// w:t, a:t and t of shared strings
+	textElems := map[string]bool{"t": true}
+	breakElems := map[string]bool{"p": true, "br": true, "si": true, "tc": true}
+	text := &strings.Builder{}
+	for _, part := range parts {
+		if err = readZipFile(part, textElems, breakElems, text); err != nil {
+			return "", err
+		}
+		text.WriteString("\n")
+	}
+	return text.String(), nil
+}
+
+// extractODF extracts texts of OpenDocument files
+func extractODF(content []byte) (string, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("invalid opendocument file: %w", err)
+	}
+
+	breakElems := map[string]bool{"p": true, "h": true, "line-break": true, "table-cell": true}
+	text := &strings.Builder{}
+	for _, file := range zipReader.File {
+		if file.Name == "content.xml" {
+			if err = readZipFile(file, nil, breakElems, text); err != nil {
+				return "", err
+			}
+			return text.String(), nil
+		}
+	}
+	return "", fmt.Errorf("invalid opendocument file: content.xml not found")
+}
@@ -0,0 +1,337 @@
+package textextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// maxStreamSize limits the decompressed size of each stream against zip bombs
+const maxStreamSize = 64 * 1024 * 1024
+
+var (
+	streamStart = regexp.MustCompile(`stream\r?\n`)
+	// dictionaries of streams which are not page contents, e.g. images and fonts
+	nonContentDict = regexp.MustCompile(`/Subtype\s*/Image|/Type\s*/(XRef|ObjStm|Metadata|EmbeddedFile)|/Length[123]\s|/FontFile|/Subtype\s*/(Type1C|CIDFontType0C|OpenType|XML)`)
+	filterPattern  = regexp.MustCompile(`/Filter\s*\[?\s*((?:/\w+\s*)+)`)
+)
+
+// extractPDF extracts texts of text operators in page contents, it is the best effort:
+// encrypted files, scanned pages and fonts with custom encodings (e.g. some CJK fonts) are not supported
+func extractPDF(content []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(content, "\r\n\t "), []byte("%PDF")) {
+		return "", ErrUnsupported
+	}
+	if bytes.Contains(content, []byte("/Encrypt")) {
+		return "", ErrUnsupported
+	}
+
+	text := &strings.Builder{}
+	offset := 0
+	for {
+		loc := streamStart.FindIndex(content[offset:])
+		if loc == nil {
+			break
+		}
+		dictEnd := offset + loc[0]
+		dataStart := offset + loc[1]
+		dataEnd := bytes.Index(content[dataStart:], []byte("endstream"))
+		if dataEnd < 0 {
+			break
+		}
+		dataEnd += dataStart
+		offset = dataEnd + len("endstream")
+
+		// "endstream" also contains "stream"
+		if dictEnd >= 3 && string(content[dictEnd-3:dictEnd]) == "end" {
+			continue
+		}
+		dictStart := bytes.LastIndex(content[:dictEnd], []byte("obj"))
+		if dictStart < 0 {
+			continue
+		}
+		dict := content[dictStart:dictEnd]
+		if nonContentDict.Match(dict) {
+			continue
+		}
+
+		data, ok := decodeStream(dict, content[dataStart:dataEnd])
+		if !ok || !bytes.Contains(data, []byte("BT")) {
+			continue
+		}
+		parseContentStream(data, text)
+	}
+	return text.String(), nil
+}
+
+func decodeStream(dict, data []byte) ([]byte, bool) {
+	match := filterPattern.FindSubmatch(dict)
+	if match == nil {
+		return data, true
+	}
+	filters := strings.Fields(strings.ReplaceAll(string(match[1]), "/", " "))
+	if len(filters) != 1 || filters[0] != "FlateDecode" {
+		return nil, false
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer r.Close()
+	decoded, err := io.ReadAll(io.LimitReader(r, maxStreamSize))
+	// streams could be followed by EOLs which are not included by /Length, decoded data is still usable
+	if err != nil && len(decoded) == 0 {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// parseContentStream writes texts shown by Tj, TJ, ' and " operators,
+// texts are separated by lines when the positions are moved
+func parseContentStream(data []byte, text *strings.Builder) {
+	operands := []string{}
+	inText := false
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			str, next := readLiteralString(data, i)
+			operands = append(operands, str)
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] != '<':
+			str, next := readHexString(data, i)
+			operands = append(operands, str)
+			i = next
+		case c == '[':
+			// the array of TJ: strings and adjustments, large negative adjustments are spaces
+			arr := &strings.Builder{}
+			i++
+			for i < len(data) && data[i] != ']' {
+				switch {
+				case data[i] == '(':
+					str, next := readLiteralString(data, i)
+					arr.WriteString(str)
+					i = next
+				case data[i] == '<':
+					str, next := readHexString(data, i)
+					arr.WriteString(str)
+					i = next
+				case data[i] == '-' || data[i] == '.' || (data[i] >= '0' && data[i] <= '9'):
+					start := i
+					for i < len(data) && (data[i] == '-' || data[i] == '.' || (data[i] >= '0' && data[i] <= '9')) {
+						i++
+					}
+					if num, err := strconv.ParseFloat(string(data[start:i]), 64); err == nil && num < -200 {
+						arr.WriteString(" ")
+					}
+				default:
+					i++
+				}
+			}
+			operands = append(operands, arr.String())
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case isPDFRegular(c):
+			start := i
+			for i < len(data) && isPDFRegular(data[i]) {
+				i++
+			}
+			token := string(data[start:i])
+			if token[0] == '/' || token[0] == '-' || token[0] == '.' || (token[0] >= '0' && token[0] <= '9') {
+				operands = append(operands, token)
+				continue
+			}
+
+			switch token {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				text.WriteString("\n")
+			case "Tj", "TJ":
+				if inText && len(operands) > 0 {
+					text.WriteString(printable(operands[len(operands)-1]))
+				}
+			case "'", `"`:
+				if inText && len(operands) > 0 {
+					text.WriteString("\n")
+					text.WriteString(printable(operands[len(operands)-1]))
+				}
+			case "Td", "TD":
+				// a new line if the vertical position is changed
+				if ty, err := strconv.ParseFloat(lastOperand(operands), 64); inText && err == nil && ty != 0 {
+					text.WriteString("\n")
+				} else if inText {
+					text.WriteString(" ")
+				}
+			case "T*", "Tm":
+				if inText {
+					text.WriteString("\n")
+				}
+			}
+			operands = operands[:0]
+		default:
+			i++
+		}
+	}
+}
+
+func lastOperand(operands []string) string {
+	if len(operands) == 0 {
+		return ""
+	}
+	return operands[len(operands)-1]
+}
+
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '%':
+		return false
+	}
+	// "/" starts names
+	return true
+}
+
+// readLiteralString reads the string started from data[start] which is '(',
+// it returns the string and the position after the string
+func readLiteralString(data []byte, start int) (string, int) {
+	buf := []byte{}
+	depth := 0
+	i := start
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+			if depth > 1 {
+				buf = append(buf, c)
+			}
+			continue
+		case ')':
+			depth--
+			if depth == 0 {
+				return decodePDFString(buf), i + 1
+			}
+			buf = append(buf, c)
+			continue
+		case '\\':
+		default:
+			buf = append(buf, c)
+			continue
+		}
+
+		// escapes
+		i++
+		if i >= len(data) {
+			break
+		}
+		switch esc := data[i]; esc {
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'b', 'f':
+		case '\r':
+			// line continuations
+			if i+1 < len(data) && data[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			if esc >= '0' && esc <= '7' {
+				val := 0
+				j := i
+				for ; j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7'; j++ {
+					val = val*8 + int(data[j]-'0')
+				}
+				buf = append(buf, byte(val))
+				i = j - 1
+			} else {
+				buf = append(buf, esc)
+			}
+		}
+	}
+	return decodePDFString(buf), i
+}
+
+func readHexString(data []byte, start int) (string, int) {
+	end := bytes.IndexByte(data[start:], '>')
+	if end < 0 {
+		return "", len(data)
+	}
+	hexDigits := []byte{}
+	for _, c := range data[start+1 : start+end] {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			hexDigits = append(hexDigits, c)
+		}
+	}
+	if len(hexDigits)%2 == 1 {
+		hexDigits = append(hexDigits, '0')
+	}
+	buf := make([]byte, 0, len(hexDigits)/2)
+	for i := 0; i < len(hexDigits); i += 2 {
+		val, _ := strconv.ParseUint(string(hexDigits[i:i+2]), 16, 8)
+		buf = append(buf, byte(val))
+	}
+	return decodePDFString(buf), start + end + 1
+}
+
+// decodePDFString decodes UTF-16BE strings with BOMs and strings of single-byte encodings,
+// two-byte strings of ASCII characters (e.g. "\x00A\x00B") are also decoded
+func decodePDFString(buf []byte) string {
+	if len(buf) >= 2 && buf[0] == 0xfe && buf[1] == 0xff {
+		return decodeUTF16BE(buf[2:])
+	}
+	if len(buf) >= 2 && len(buf)%2 == 0 {
+		twoBytes := true
+		for i := 0; i < len(buf); i += 2 {
+			if buf[i] != 0 {
+				twoBytes = false
+				break
+			}
+		}
+		if twoBytes {
+			return decodeUTF16BE(buf)
+		}
+	}
+
+	runes := make([]rune, 0, len(buf))
+	for _, b := range buf {
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
+
+func decodeUTF16BE(buf []byte) string {
+	units := make([]uint16, 0, len(buf)/2)
+	for i := 0; i+1 < len(buf); i += 2 {
+		units = append(units, uint16(buf[i])<<8|uint16(buf[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// printable drops strings which look like glyph IDs of custom encodings
+func printable(str string) string {
+	total, readable := 0, 0
+	for _, r := range str {
+		total++
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r) {
+			readable++
+		}
+	}
+	if total == 0 || readable*10 < total*9 {
+		return ""
+	}
+	return str
+}
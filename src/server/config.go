@@ -6,7 +6,10 @@ import (
 	"github.com/ihexxa/quickshare/src/db"
 )
 
-const fileIndexPath = "/fileindex.jsonl"
+const (
+	fileIndexPath    = "/fileindex.jsonl"
+	fileIndexLogPath = "/fileindex.log"
+)
 
 type DbConfig struct {
 	DbPath string `json:"dbPath" yaml:"dbPath"`
@@ -19,6 +22,23 @@ type FSConfig struct {
 	PublicPath        string `json:"publicPath" yaml:"publicPath"`
 	SearchResultLimit int    `json:"searchResultLimit" yaml:"searchResultLimit"`
 	InitFileIndex     bool   `json:"initFileIndex" yaml:"initFileIndex"`
+	MinFreeSpace      int    `json:"minFreeSpace" yaml:"minFreeSpace"`
+	DiskCheckInterval int    `json:"diskCheckInterval" yaml:"diskCheckInterval"`
+	// StorageSnapshotSpec is the cron spec of taking storage snapshots, e.g. "@daily" or "0 3 * * *"
+	StorageSnapshotSpec     string `json:"storageSnapshotSpec" yaml:"storageSnapshotSpec"`
+	StorageSnapshotKeepDays int    `json:"storageSnapshotKeepDays" yaml:"storageSnapshotKeepDays"`
+	// FileIndexSnapshotSpec is the cron spec of compacting the file index's change log into a snapshot
+	FileIndexSnapshotSpec string `json:"fileIndexSnapshotSpec" yaml:"fileIndexSnapshotSpec"`
+	// changes of files are kept for ChangeKeepDays days, clients with older cursors have to list folders again
+	ChangeKeepDays int `json:"changeKeepDays" yaml:"changeKeepDays"`
+	// EnableContentIndex enables extracting texts of uploaded documents for full-text search
+	EnableContentIndex bool `json:"enableContentIndex" yaml:"enableContentIndex"`
+	// ContentIndexMaxSize is the max size of documents to be indexed in bytes
+	ContentIndexMaxSize int `json:"contentIndexMaxSize" yaml:"contentIndexMaxSize"`
+	// sorted listings of folders with at least ListingCacheMin items are cached for paging,
+	// ListingCacheItems is the max number of cached items of all folders
+	ListingCacheMin   int `json:"listingCacheMin" yaml:"listingCacheMin"`
+	ListingCacheItems int `json:"listingCacheItems" yaml:"listingCacheItems"`
 }
 
 type UsersCfg struct {
@@ -39,6 +59,47 @@ type UsersCfg struct {
 	LimiterCapacity    int           `json:"limiterCapacity" yaml:"limiterCapacity"`
 	LimiterCyc         int           `json:"limiterCyc" yaml:"limiterCyc"`
 	PredefinedUsers    []*db.UserCfg `json:"predefinedUsers" yaml:"predefinedUsers"`
+	OIDC               *OIDCCfg      `json:"oidc,omitempty" yaml:"oidc,omitempty"`
+	// Require2FAForAdmins forces admins to enroll TOTP before they can log in
+	Require2FAForAdmins bool `json:"require2FAForAdmins" yaml:"require2FAForAdmins"`
+	// users are locked on an IP for LoginLockoutSecs after LoginMaxFailures failures from the IP in LoginLockoutSecs,
+	// and they are locked on all IPs after LoginAccountMaxFailures failures from all IPs (e.g. credential stuffing),
+	// captchas are required after LoginCaptchaAfter failures of the user or the IP if CaptchaEnabled is true
+	LoginMaxFailures        int `json:"loginMaxFailures" yaml:"loginMaxFailures"`
+	LoginAccountMaxFailures int `json:"loginAccountMaxFailures" yaml:"loginAccountMaxFailures"`
+	LoginLockoutSecs        int `json:"loginLockoutSecs" yaml:"loginLockoutSecs"`
+	LoginCaptchaAfter       int `json:"loginCaptchaAfter" yaml:"loginCaptchaAfter"`
+	// LoginDelay is the delay in millisecond after the first failure, it is doubled on each failure from the IP
+	LoginDelay int `json:"loginDelay" yaml:"loginDelay"`
+	// LoginIPAttempts is the number of login attempts allowed for an IP in each minute
+	LoginIPAttempts int `json:"loginIPAttempts" yaml:"loginIPAttempts"`
+	// failed attempts are kept for LoginAttemptsKeepDays days
+	LoginAttemptsKeepDays int `json:"loginAttemptsKeepDays" yaml:"loginAttemptsKeepDays"`
+	// Registration is "closed", "open", "invite" or "approval"
+	Registration string `json:"registration" yaml:"registration"`
+	// RegistrationRole is assigned to registered users without invite codes
+	RegistrationRole string `json:"registrationRole" yaml:"registrationRole"`
+}
+
+// OIDCCfg configures single sign-on through an OpenID Connect provider, it is disabled if it is absent
+type OIDCCfg struct {
+	Enabled      bool   `json:"enabled" yaml:"enabled"`
+	Issuer       string `json:"issuer" yaml:"issuer"`
+	ClientID     string `json:"clientID" yaml:"clientID"`
+	ClientSecret string `json:"clientSecret" yaml:"clientSecret" cfg:"env"`
+	// RedirectURL must point to /v2/public/oidc/callback
+	RedirectURL   string `json:"redirectURL" yaml:"redirectURL"`
+	UsernameClaim string `json:"usernameClaim" yaml:"usernameClaim"`
+	// RoleClaim's values are mapped to roles by RoleMapping, DefaultRole is used if nothing is matched
+	RoleClaim   string            `json:"roleClaim" yaml:"roleClaim"`
+	RoleMapping map[string]string `json:"roleMapping" yaml:"roleMapping"`
+	DefaultRole string            `json:"defaultRole" yaml:"defaultRole"`
+	// AutoProvision creates users in their first logins
+	AutoProvision bool `json:"autoProvision" yaml:"autoProvision"`
+	// LinkExisting links the identity to the existing user with the same name,
+	// only if the identity's verified email matches the user's email, admins are never linked
+	LinkExisting bool   `json:"linkExisting" yaml:"linkExisting"`
+	PostLoginURL string `json:"postLoginURL" yaml:"postLoginURL"`
 }
 
 type Secrets struct {
@@ -53,6 +114,11 @@ type ServerCfg struct {
 	WriteTimeout   int            `json:"writeTimeout" yaml:"writeTimeout"`
 	MaxHeaderBytes int            `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`
 	Dynamic        *db.SiteConfig `json:"dynamic" yaml:"dynamic"`
+	// MaxEventStreams is the maximum number of event streams of a user, e.g. opened browser tabs
+	MaxEventStreams int `json:"maxEventStreams" yaml:"maxEventStreams"`
+	// EventsHeartbeat is the interval in second of heartbeats of event streams, 30 by default,
+	// sessions and users are rechecked in heartbeats
+	EventsHeartbeat int `json:"eventsHeartbeat" yaml:"eventsHeartbeat"`
 }
 
 type WorkerPoolCfg struct {
@@ -61,6 +127,70 @@ type WorkerPoolCfg struct {
 	WorkerCount int `json:"workerCount" yaml:"workerCount"`
 }
 
+// MailCfg configures outgoing mails through a SMTP server, it is disabled if it is absent
+type MailCfg struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Host    string `json:"host" yaml:"host"`
+	Port    int    `json:"port" yaml:"port"`
+	User    string `json:"user" yaml:"user"`
+	SMTPPwd string `json:"smtpPwd" yaml:"smtpPwd" cfg:"env"`
+	From    string `json:"from" yaml:"from"`
+	// ImplicitTLS connects with TLS directly, otherwise STARTTLS is used if it is supported
+	ImplicitTLS bool `json:"implicitTLS" yaml:"implicitTLS"`
+	// TemplatesDir contains <name>.tmpl files overriding the default templates,
+	// the first line of a template is the subject
+	TemplatesDir string `json:"templatesDir" yaml:"templatesDir"`
+	// ResetURL is the page for resetting passwords, the token is appended as the "token" query
+	ResetURL string `json:"resetURL" yaml:"resetURL"`
+	// ResetTokenTTL is in seconds
+	ResetTokenTTL int `json:"resetTokenTTL" yaml:"resetTokenTTL"`
+	// owners are notified when others upload into their folders or download their files
+	NotifyUploads   bool `json:"notifyUploads" yaml:"notifyUploads"`
+	NotifyDownloads bool `json:"notifyDownloads" yaml:"notifyDownloads"`
+	// users are warned when their used space exceeds QuotaWarnPercent of the space limit, 0 disables it
+	QuotaWarnPercent int `json:"quotaWarnPercent" yaml:"quotaWarnPercent"`
+}
+
+// WebhooksCfg configures deliveries of webhooks
+type WebhooksCfg struct {
+	// a delivery fails after MaxAttempts attempts, 5 by default
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// Timeout is in seconds, 10 by default
+	Timeout int `json:"timeout" yaml:"timeout"`
+	// finished deliveries are kept for KeepDays days, 30 by default
+	KeepDays int `json:"keepDays" yaml:"keepDays"`
+	// AllowedNets are IPs or CIDRs of internal receivers, e.g. "10.0.0.0/8",
+	// loopback, private and link-local addresses are rejected by default
+	AllowedNets []string `json:"allowedNets" yaml:"allowedNets"`
+}
+
+// AuditCfg configures the retention of audit logs
+type AuditCfg struct {
+	// logs are kept for KeepDays days, 180 by default
+	KeepDays int `json:"keepDays" yaml:"keepDays"`
+}
+
+// MetricsCfg configures the separate listener of metrics
+type MetricsCfg struct {
+	// Addr (e.g. "127.0.0.1:9090") serves /metrics without authentication,
+	// metrics are only served by /v2/admin/metrics to admins if it is empty
+	Addr string `json:"addr" yaml:"addr"`
+}
+
+// TracingCfg configures exporting traces, tracing is disabled if Exporter is empty
+type TracingCfg struct {
+	// Exporter is "otlp", "stdout" or "file"
+	Exporter string `json:"exporter" yaml:"exporter"`
+	// Endpoint is the OTLP/HTTP traces endpoint, "http://127.0.0.1:4318/v1/traces" by default
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// FilePath is where the file exporter appends spans as JSON lines, "traces.jsonl" under fs.root by default
+	FilePath string `json:"filePath" yaml:"filePath"`
+	// ServiceName is "quickshare" by default
+	ServiceName string `json:"serviceName" yaml:"serviceName"`
+	// FlushInterval is in milliseconds, 1000 by default
+	FlushInterval int `json:"flushInterval" yaml:"flushInterval"`
+}
+
 type Config struct {
 	Users   *UsersCfg      `json:"users" yaml:"users"`
 	Fs      *FSConfig      `json:"fs" yaml:"fs"`
@@ -68,6 +198,15 @@ type Config struct {
 	Workers *WorkerPoolCfg `json:"workers" yaml:"workers"`
 	Db      *DbConfig      `json:"db" yaml:"db"`
 	Server  *ServerCfg     `json:"server" yaml:"server"`
+	Mail    *MailCfg       `json:"mail,omitempty" yaml:"mail,omitempty"`
+	// Webhooks are configured with default values if it is absent
+	Webhooks *WebhooksCfg `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+	// Audit is configured with default values if it is absent
+	Audit *AuditCfg `json:"audit,omitempty" yaml:"audit,omitempty"`
+	// Metrics is optional, the separate listener is disabled if it is absent
+	Metrics *MetricsCfg `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	// Tracing is optional, tracing is disabled if it is absent
+	Tracing *TracingCfg `json:"tracing,omitempty" yaml:"tracing,omitempty"`
 }
 
 func NewConfig() *Config {
@@ -82,42 +221,63 @@ func DefaultConfig() (string, error) {
 func DefaultConfigStruct() *Config {
 	return &Config{
 		Fs: &FSConfig{
-			Root:              "quickshare",
-			OpensLimit:        1024,
-			OpenTTL:           60, // 1 min
-			PublicPath:        "static/public",
-			SearchResultLimit: 16,
-			InitFileIndex:     true,
+			Root:                    "quickshare",
+			OpensLimit:              1024,
+			OpenTTL:                 60, // 1 min
+			PublicPath:              "static/public",
+			SearchResultLimit:       16,
+			InitFileIndex:           true,
+			MinFreeSpace:            256 * 1024 * 1024, // 256MB
+			DiskCheckInterval:       10,                // 10s
+			StorageSnapshotSpec:     "@daily",
+			StorageSnapshotKeepDays: 365,
+			FileIndexSnapshotSpec:   "@hourly",
+			ChangeKeepDays:          30,
+			EnableContentIndex:      true,
+			ContentIndexMaxSize:     16 * 1024 * 1024, // 16MB
+			ListingCacheMin:         1000,
+			ListingCacheItems:       500000,
 		},
 		Users: &UsersCfg{
-			EnableAuth:         true,
-			DefaultAdmin:       "",
-			DefaultAdminPwd:    "",
-			CookieTTL:          3600 * 24 * 7, // 1 week
-			CookieSecure:       false,
-			CookieHttpOnly:     true,
-			MinUserNameLen:     3,
-			MinPwdLen:          8,
-			CaptchaWidth:       256,
-			CaptchaHeight:      60,
-			CaptchaEnabled:     true,
-			UploadSpeedLimit:   1024 * 1024,       // B
-			DownloadSpeedLimit: 1024 * 1024,       // B
-			SpaceLimit:         1024 * 1024 * 100, // 100MB
-			LimiterCapacity:    1000,
-			LimiterCyc:         1000, // 1s
-			PredefinedUsers:    []*db.UserCfg{},
+			EnableAuth:              true,
+			DefaultAdmin:            "",
+			DefaultAdminPwd:         "",
+			CookieTTL:               3600 * 24 * 7, // 1 week
+			CookieSecure:            false,
+			CookieHttpOnly:          true,
+			MinUserNameLen:          3,
+			MinPwdLen:               8,
+			CaptchaWidth:            256,
+			CaptchaHeight:           60,
+			CaptchaEnabled:          true,
+			UploadSpeedLimit:        1024 * 1024,       // B
+			DownloadSpeedLimit:      1024 * 1024,       // B
+			SpaceLimit:              1024 * 1024 * 100, // 100MB
+			LimiterCapacity:         1000,
+			LimiterCyc:              1000, // 1s
+			PredefinedUsers:         []*db.UserCfg{},
+			LoginMaxFailures:        5,
+			LoginAccountMaxFailures: 20,
+			LoginLockoutSecs:        900, // 15min
+			LoginCaptchaAfter:       3,
+			LoginDelay:              500, // ms
+			LoginIPAttempts:         60,
+			LoginAttemptsKeepDays:   30,
+			Registration:            "closed",
+			RegistrationRole:        db.UserRole,
 		},
 		Secrets: &Secrets{
 			TokenSecret: "", // it will auto generated if it is left as empty
 		},
 		Server: &ServerCfg{
-			Debug:          false,
-			Host:           "0.0.0.0",
-			Port:           8686,
-			ReadTimeout:    2000,
-			WriteTimeout:   1000 * 3600 * 24, // 1 day
-			MaxHeaderBytes: 512,
+			Debug:           false,
+			Host:            "0.0.0.0",
+			Port:            8686,
+			ReadTimeout:     2000,
+			WriteTimeout:    1000 * 3600 * 24, // 1 day
+			MaxHeaderBytes:  512,
+			MaxEventStreams: 8,
+			EventsHeartbeat: 30,
 			Dynamic: &db.SiteConfig{
 				ClientCfg: &db.ClientConfig{
 					SiteName: "Quickshare",
@@ -96,30 +96,49 @@ func TestLoadCfg(t *testing.T) {
 
 	cfg1 := &Config{
 		Fs: &FSConfig{
-			Root:              "1",
-			OpensLimit:        1,
-			OpenTTL:           1,
-			PublicPath:        "1",
-			SearchResultLimit: 16,
-			InitFileIndex:     true,
+			Root:                    "1",
+			OpensLimit:              1,
+			OpenTTL:                 1,
+			PublicPath:              "1",
+			SearchResultLimit:       16,
+			InitFileIndex:           true,
+			MinFreeSpace:            256 * 1024 * 1024,
+			DiskCheckInterval:       10,
+			StorageSnapshotSpec:     "@daily",
+			StorageSnapshotKeepDays: 365,
+			FileIndexSnapshotSpec:   "@hourly",
+			ChangeKeepDays:          30,
+			EnableContentIndex:      true,
+			ContentIndexMaxSize:     16 * 1024 * 1024,
+			ListingCacheMin:         1000,
+			ListingCacheItems:       500000,
 		},
 		Users: &UsersCfg{
-			EnableAuth:         true,
-			DefaultAdmin:       "1",
-			DefaultAdminPwd:    "1",
-			CookieTTL:          1,
-			CookieSecure:       true,
-			CookieHttpOnly:     true,
-			MinUserNameLen:     1,
-			MinPwdLen:          1,
-			CaptchaWidth:       1,
-			CaptchaHeight:      1,
-			CaptchaEnabled:     true,
-			UploadSpeedLimit:   1,
-			DownloadSpeedLimit: 1,
-			SpaceLimit:         1,
-			LimiterCapacity:    1,
-			LimiterCyc:         1,
+			EnableAuth:              true,
+			DefaultAdmin:            "1",
+			DefaultAdminPwd:         "1",
+			CookieTTL:               1,
+			CookieSecure:            true,
+			CookieHttpOnly:          true,
+			MinUserNameLen:          1,
+			MinPwdLen:               1,
+			CaptchaWidth:            1,
+			CaptchaHeight:           1,
+			CaptchaEnabled:          true,
+			UploadSpeedLimit:        1,
+			DownloadSpeedLimit:      1,
+			SpaceLimit:              1,
+			LimiterCapacity:         1,
+			LimiterCyc:              1,
+			LoginMaxFailures:        5,
+			LoginAccountMaxFailures: 20,
+			LoginLockoutSecs:        900,
+			LoginCaptchaAfter:       3,
+			LoginDelay:              500,
+			LoginIPAttempts:         60,
+			LoginAttemptsKeepDays:   30,
+			Registration:            "closed",
+			RegistrationRole:        "user",
 			PredefinedUsers: []*db.UserCfg{
 				&db.UserCfg{
 					Name: "1",
@@ -132,12 +151,14 @@ func TestLoadCfg(t *testing.T) {
 			TokenSecret: "1",
 		},
 		Server: &ServerCfg{
-			Debug:          true,
-			Host:           "1",
-			Port:           1,
-			ReadTimeout:    1,
-			WriteTimeout:   1,
-			MaxHeaderBytes: 1,
+			Debug:           true,
+			Host:            "1",
+			Port:            1,
+			ReadTimeout:     1,
+			WriteTimeout:    1,
+			MaxHeaderBytes:  1,
+			MaxEventStreams: 8,
+			EventsHeartbeat: 30,
 			Dynamic: &db.SiteConfig{
 				ClientCfg: &db.ClientConfig{
 					SiteName: "Quickshare",
@@ -166,30 +187,49 @@ func TestLoadCfg(t *testing.T) {
 
 	cfg4 := &Config{
 		Fs: &FSConfig{
-			Root:              "4",
-			OpensLimit:        4,
-			OpenTTL:           4,
-			PublicPath:        "4",
-			SearchResultLimit: 16,
-			InitFileIndex:     true,
+			Root:                    "4",
+			OpensLimit:              4,
+			OpenTTL:                 4,
+			PublicPath:              "4",
+			SearchResultLimit:       16,
+			InitFileIndex:           true,
+			MinFreeSpace:            256 * 1024 * 1024,
+			DiskCheckInterval:       10,
+			StorageSnapshotSpec:     "@daily",
+			StorageSnapshotKeepDays: 365,
+			FileIndexSnapshotSpec:   "@hourly",
+			ChangeKeepDays:          30,
+			EnableContentIndex:      true,
+			ContentIndexMaxSize:     16 * 1024 * 1024,
+			ListingCacheMin:         1000,
+			ListingCacheItems:       500000,
 		},
 		Users: &UsersCfg{
-			EnableAuth:         false,
-			DefaultAdmin:       "4",
-			DefaultAdminPwd:    "4",
-			CookieTTL:          4,
-			CookieSecure:       false,
-			CookieHttpOnly:     false,
-			MinUserNameLen:     4,
-			MinPwdLen:          4,
-			CaptchaWidth:       4,
-			CaptchaHeight:      4,
-			CaptchaEnabled:     false,
-			UploadSpeedLimit:   4,
-			DownloadSpeedLimit: 4,
-			SpaceLimit:         4,
-			LimiterCapacity:    4,
-			LimiterCyc:         4,
+			EnableAuth:              false,
+			DefaultAdmin:            "4",
+			DefaultAdminPwd:         "4",
+			CookieTTL:               4,
+			CookieSecure:            false,
+			CookieHttpOnly:          false,
+			MinUserNameLen:          4,
+			MinPwdLen:               4,
+			CaptchaWidth:            4,
+			CaptchaHeight:           4,
+			CaptchaEnabled:          false,
+			UploadSpeedLimit:        4,
+			DownloadSpeedLimit:      4,
+			SpaceLimit:              4,
+			LimiterCapacity:         4,
+			LimiterCyc:              4,
+			LoginMaxFailures:        5,
+			LoginAccountMaxFailures: 20,
+			LoginLockoutSecs:        900,
+			LoginCaptchaAfter:       3,
+			LoginDelay:              500,
+			LoginIPAttempts:         60,
+			LoginAttemptsKeepDays:   30,
+			Registration:            "closed",
+			RegistrationRole:        "user",
 			PredefinedUsers: []*db.UserCfg{
 				&db.UserCfg{
 					Name: "4",
@@ -202,12 +242,14 @@ func TestLoadCfg(t *testing.T) {
 			TokenSecret: "4",
 		},
 		Server: &ServerCfg{
-			Debug:          false,
-			Host:           "4",
-			Port:           4,
-			ReadTimeout:    4,
-			WriteTimeout:   4,
-			MaxHeaderBytes: 4,
+			Debug:           false,
+			Host:            "4",
+			Port:            4,
+			ReadTimeout:     4,
+			WriteTimeout:    4,
+			MaxHeaderBytes:  4,
+			MaxEventStreams: 8,
+			EventsHeartbeat: 30,
 			Dynamic: &db.SiteConfig{
 				ClientCfg: &db.ClientConfig{
 					SiteName: "4",
@@ -236,30 +278,49 @@ func TestLoadCfg(t *testing.T) {
 
 	cfg5 := &Config{
 		Fs: &FSConfig{
-			Root:              "4",
-			OpensLimit:        4,
-			OpenTTL:           4,
-			PublicPath:        "4",
-			SearchResultLimit: 16,
-			InitFileIndex:     true,
+			Root:                    "4",
+			OpensLimit:              4,
+			OpenTTL:                 4,
+			PublicPath:              "4",
+			SearchResultLimit:       16,
+			InitFileIndex:           true,
+			MinFreeSpace:            256 * 1024 * 1024,
+			DiskCheckInterval:       10,
+			StorageSnapshotSpec:     "@daily",
+			StorageSnapshotKeepDays: 365,
+			FileIndexSnapshotSpec:   "@hourly",
+			ChangeKeepDays:          30,
+			EnableContentIndex:      true,
+			ContentIndexMaxSize:     16 * 1024 * 1024,
+			ListingCacheMin:         1000,
+			ListingCacheItems:       500000,
 		},
 		Users: &UsersCfg{
-			EnableAuth:         true,
-			DefaultAdmin:       "5",
-			DefaultAdminPwd:    "5",
-			CookieTTL:          4,
-			CookieSecure:       true,
-			CookieHttpOnly:     true,
-			MinUserNameLen:     5,
-			MinPwdLen:          5,
-			CaptchaWidth:       5,
-			CaptchaHeight:      5,
-			CaptchaEnabled:     true,
-			UploadSpeedLimit:   5,
-			DownloadSpeedLimit: 5,
-			SpaceLimit:         5,
-			LimiterCapacity:    5,
-			LimiterCyc:         5,
+			EnableAuth:              true,
+			DefaultAdmin:            "5",
+			DefaultAdminPwd:         "5",
+			CookieTTL:               4,
+			CookieSecure:            true,
+			CookieHttpOnly:          true,
+			MinUserNameLen:          5,
+			MinPwdLen:               5,
+			CaptchaWidth:            5,
+			CaptchaHeight:           5,
+			CaptchaEnabled:          true,
+			UploadSpeedLimit:        5,
+			DownloadSpeedLimit:      5,
+			SpaceLimit:              5,
+			LimiterCapacity:         5,
+			LimiterCyc:              5,
+			LoginMaxFailures:        5,
+			LoginAccountMaxFailures: 20,
+			LoginLockoutSecs:        900,
+			LoginCaptchaAfter:       3,
+			LoginDelay:              500,
+			LoginIPAttempts:         60,
+			LoginAttemptsKeepDays:   30,
+			Registration:            "closed",
+			RegistrationRole:        "user",
 			PredefinedUsers: []*db.UserCfg{
 				&db.UserCfg{
 					Name: "5",
@@ -272,12 +333,14 @@ func TestLoadCfg(t *testing.T) {
 			TokenSecret: "4",
 		},
 		Server: &ServerCfg{
-			Debug:          false,
-			Host:           "4",
-			Port:           4,
-			ReadTimeout:    4,
-			WriteTimeout:   4,
-			MaxHeaderBytes: 4,
+			Debug:           false,
+			Host:            "4",
+			Port:            4,
+			ReadTimeout:     4,
+			WriteTimeout:    4,
+			MaxHeaderBytes:  4,
+			MaxEventStreams: 8,
+			EventsHeartbeat: 30,
 			Dynamic: &db.SiteConfig{
 				ClientCfg: &db.ClientConfig{
 					SiteName: "4",
@@ -306,30 +369,49 @@ func TestLoadCfg(t *testing.T) {
 
 	cfgWithPartialCfg := &Config{
 		Fs: &FSConfig{
-			Root:              "4",
-			OpensLimit:        4,
-			OpenTTL:           4,
-			PublicPath:        "4",
-			SearchResultLimit: 16,
-			InitFileIndex:     true,
+			Root:                    "4",
+			OpensLimit:              4,
+			OpenTTL:                 4,
+			PublicPath:              "4",
+			SearchResultLimit:       16,
+			InitFileIndex:           true,
+			MinFreeSpace:            256 * 1024 * 1024,
+			DiskCheckInterval:       10,
+			StorageSnapshotSpec:     "@daily",
+			StorageSnapshotKeepDays: 365,
+			FileIndexSnapshotSpec:   "@hourly",
+			ChangeKeepDays:          30,
+			EnableContentIndex:      true,
+			ContentIndexMaxSize:     16 * 1024 * 1024,
+			ListingCacheMin:         1000,
+			ListingCacheItems:       500000,
 		},
 		Users: &UsersCfg{
-			EnableAuth:         true,
-			DefaultAdmin:       "5",
-			DefaultAdminPwd:    "5",
-			CookieTTL:          4,
-			CookieSecure:       true,
-			CookieHttpOnly:     true,
-			MinUserNameLen:     5,
-			MinPwdLen:          5,
-			CaptchaWidth:       5,
-			CaptchaHeight:      5,
-			CaptchaEnabled:     true,
-			UploadSpeedLimit:   5,
-			DownloadSpeedLimit: 5,
-			SpaceLimit:         5,
-			LimiterCapacity:    5,
-			LimiterCyc:         5,
+			EnableAuth:              true,
+			DefaultAdmin:            "5",
+			DefaultAdminPwd:         "5",
+			CookieTTL:               4,
+			CookieSecure:            true,
+			CookieHttpOnly:          true,
+			MinUserNameLen:          5,
+			MinPwdLen:               5,
+			CaptchaWidth:            5,
+			CaptchaHeight:           5,
+			CaptchaEnabled:          true,
+			UploadSpeedLimit:        5,
+			DownloadSpeedLimit:      5,
+			SpaceLimit:              5,
+			LimiterCapacity:         5,
+			LimiterCyc:              5,
+			LoginMaxFailures:        5,
+			LoginAccountMaxFailures: 20,
+			LoginLockoutSecs:        900,
+			LoginCaptchaAfter:       3,
+			LoginDelay:              500,
+			LoginIPAttempts:         60,
+			LoginAttemptsKeepDays:   30,
+			Registration:            "closed",
+			RegistrationRole:        "user",
 			PredefinedUsers: []*db.UserCfg{
 				&db.UserCfg{
 					Name: "5",
@@ -342,12 +424,14 @@ func TestLoadCfg(t *testing.T) {
 			TokenSecret: "4",
 		},
 		Server: &ServerCfg{
-			Debug:          false,
-			Host:           "4",
-			Port:           4,
-			ReadTimeout:    4,
-			WriteTimeout:   4,
-			MaxHeaderBytes: 4,
+			Debug:           false,
+			Host:            "4",
+			Port:            4,
+			ReadTimeout:     4,
+			WriteTimeout:    4,
+			MaxHeaderBytes:  4,
+			MaxEventStreams: 8,
+			EventsHeartbeat: 30,
 			Dynamic: &db.SiteConfig{
 				ClientCfg: &db.ClientConfig{
 					SiteName: "4",
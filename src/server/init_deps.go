@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ihexxa/gocfg"
@@ -19,16 +20,25 @@ import (
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/ihexxa/quickshare/src/audit"
+	"github.com/ihexxa/quickshare/src/cron"
 	"github.com/ihexxa/quickshare/src/cryptoutil"
 	"github.com/ihexxa/quickshare/src/cryptoutil/jwt"
 	"github.com/ihexxa/quickshare/src/db"
 	"github.com/ihexxa/quickshare/src/depidx"
+	"github.com/ihexxa/quickshare/src/diskguard"
+	"github.com/ihexxa/quickshare/src/events"
 	"github.com/ihexxa/quickshare/src/fs"
 	"github.com/ihexxa/quickshare/src/fs/local"
 	"github.com/ihexxa/quickshare/src/idgen"
 	"github.com/ihexxa/quickshare/src/idgen/simpleidgen"
 	"github.com/ihexxa/quickshare/src/iolimiter"
+	"github.com/ihexxa/quickshare/src/loginlimiter"
+	"github.com/ihexxa/quickshare/src/mailer"
+	"github.com/ihexxa/quickshare/src/metrics"
 	"github.com/ihexxa/quickshare/src/search/fileindex"
+	"github.com/ihexxa/quickshare/src/tracing"
+	"github.com/ihexxa/quickshare/src/webhook"
 	"github.com/ihexxa/quickshare/src/worker/localworker"
 )
 
@@ -51,17 +61,27 @@ func (it *Initer) InitDeps() *depidx.Deps {
 	ider := simpleidgen.New()
 	logger := it.initLogger()
 	jwtEncDec := it.initJWT(logger)
-	workers := it.initWorkerPool(logger)
-	filesystem, err := it.initFs(ider, logger)
+	collector := metrics.NewMetrics()
+	tracer := it.initTracer(logger)
+	workers := it.initWorkerPool(collector, tracer, logger)
+	filesystem, err := it.initFs(ider, collector, logger)
 	if err != nil {
 		logger.Fatalf("failed to init DB: %s", err)
 	}
-	quickshareDb, err := it.initDb(filesystem)
+	quickshareDb, err := it.initDb(filesystem, collector)
 	if err != nil {
 		logger.Fatalf("failed to init DB: %s", err)
 	}
+	it.initMetricsGauges(collector, workers, quickshareDb)
 	rateLimiter := it.initRateLimiter(quickshareDb)
+	loginLimiter := it.initLoginLimiter()
 	fileIndex := it.initSearchIndex(filesystem, logger)
+	mailSender := it.initMailer(workers, logger)
+	diskGuard := it.initDiskGuard(filesystem, logger)
+	scheduler := it.initCron()
+	eventHub := it.initEventHub()
+	webhooks := it.initWebhooks(quickshareDb, workers, scheduler, ider, logger)
+	auditor := it.initAuditor(quickshareDb, scheduler, ider, logger)
 
 	deps := depidx.NewDeps(it.cfg)
 	deps.SetDB(quickshareDb)
@@ -70,7 +90,16 @@ func (it *Initer) InitDeps() *depidx.Deps {
 	deps.SetID(ider)
 	deps.SetLog(logger)
 	deps.SetLimiter(rateLimiter)
+	deps.SetLoginLimiter(loginLimiter)
 	deps.SetWorkers(workers)
+	deps.SetMailer(mailSender)
+	deps.SetDiskGuard(diskGuard)
+	deps.SetCron(scheduler)
+	deps.SetEvents(eventHub)
+	deps.SetWebhooks(webhooks)
+	deps.SetAuditor(auditor)
+	deps.SetMetrics(collector)
+	deps.SetTracer(tracer)
 	deps.SetFileIndex(fileIndex)
 
 	return deps
@@ -116,44 +145,225 @@ func (it *Initer) initRateLimiter(quickshareDb db.IDBQuickshare) iolimiter.ILimi
 	return iolimiter.NewIOLimiter(limiterCap, limiterCyc, quickshareDb)
 }
 
-func (it *Initer) initWorkerPool(logger *zap.SugaredLogger) worker.IWorkerPool {
+func (it *Initer) initLoginLimiter() loginlimiter.ILoginLimiter {
+	return loginlimiter.NewLoginLimiter(&loginlimiter.Config{
+		Capacity:           it.cfg.IntOr("Users.LimiterCapacity", 10000),
+		MaxFailures:        it.cfg.IntOr("Users.LoginMaxFailures", 5),
+		AccountMaxFailures: it.cfg.IntOr("Users.LoginAccountMaxFailures", 20),
+		Lockout:            time.Duration(it.cfg.IntOr("Users.LoginLockoutSecs", 900)) * time.Second,
+		CaptchaAfter:       it.cfg.IntOr("Users.LoginCaptchaAfter", 3),
+		BaseDelay:          time.Duration(it.cfg.IntOr("Users.LoginDelay", 500)) * time.Millisecond,
+		IPAttempts:         it.cfg.IntOr("Users.LoginIPAttempts", 60),
+	})
+}
+
+func (it *Initer) initMailer(workers worker.IWorkerPool, logger *zap.SugaredLogger) mailer.IMailer {
+	smtpPwd, ok := it.cfg.String("ENV.SMTPPWD")
+	if !ok || smtpPwd == "" {
+		smtpPwd = it.cfg.StringOr("Mail.SMTPPwd", "")
+	}
+
+	mailSender, err := mailer.NewSMTPMailer(&mailer.Config{
+		Enabled:      it.cfg.BoolOr("Mail.Enabled", false),
+		Host:         it.cfg.StringOr("Mail.Host", ""),
+		Port:         it.cfg.IntOr("Mail.Port", 0),
+		User:         it.cfg.StringOr("Mail.User", ""),
+		Pwd:          smtpPwd,
+		From:         it.cfg.StringOr("Mail.From", ""),
+		ImplicitTLS:  it.cfg.BoolOr("Mail.ImplicitTLS", false),
+		TemplatesDir: it.cfg.StringOr("Mail.TemplatesDir", ""),
+	})
+	if err != nil {
+		logger.Fatalf("failed to init mailer: %s", err)
+	}
+	workers.AddHandler(mailer.MsgTypeMail, mailer.NewMsgHandler(mailSender))
+	return mailSender
+}
+
+func (it *Initer) initDiskGuard(filesystem fs.ISimpleFS, logger *zap.SugaredLogger) diskguard.IDiskGuard {
+	minFree := it.cfg.IntOr("Fs.MinFreeSpace", 256*1024*1024)
+	interval := it.cfg.IntOr("Fs.DiskCheckInterval", 10)
+	if interval <= 0 {
+		interval = 10
+	}
+
+	// the db could be placed in a different volume
+	paths := []string{filesystem.Root()}
+	dbDir := path.Dir(path.Join(filesystem.Root(), it.cfg.GrabString("Db.DbPath")))
+	if dbDir != path.Clean(filesystem.Root()) {
+		paths = append(paths, dbDir)
+	}
+
+	return diskguard.NewDiskGuard(&diskguard.Config{
+		Paths:    paths,
+		MinFree:  int64(minFree),
+		Interval: time.Duration(interval) * time.Second,
+	}, func(lowSpace bool) {
+		if lowSpace {
+			logger.Warnf("free disk space is lower than %d bytes, the site is read-only", minFree)
+		} else {
+			logger.Infof("free disk space is recovered, the site is writable")
+		}
+	})
+}
+
+func (it *Initer) initEventHub() events.IEventHub {
+	maxStreams := it.cfg.IntOr("Server.MaxEventStreams", 8)
+	if maxStreams <= 0 {
+		maxStreams = 8
+	}
+	return events.NewEventHub(&events.Config{
+		BufferSize: 64,
+		MaxPerUser: maxStreams,
+	})
+}
+
+func (it *Initer) initWebhooks(
+	store db.IDBQuickshare,
+	workers worker.IWorkerPool,
+	scheduler cron.ICron,
+	ider idgen.IIDGen,
+	logger *zap.SugaredLogger,
+) webhook.IWebhooks {
+	maxAttempts := it.cfg.IntOr("Webhooks.MaxAttempts", 5)
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	timeout := it.cfg.IntOr("Webhooks.Timeout", 10)
+	if timeout <= 0 {
+		timeout = 10
+	}
+
+	allowedAddrs, ok := it.cfg.SliceOr("Webhooks.AllowedNets", []string{}).([]string)
+	if !ok {
+		logger.Fatal("invalid webhooks.allowedNets")
+	}
+	allowedNets, err := webhook.ParseNets(allowedAddrs)
+	if err != nil {
+		logger.Fatalf("invalid webhooks.allowedNets: %s", err)
+	}
+
+	webhooks := webhook.NewWebhooks(&webhook.Config{
+		MaxAttempts: maxAttempts,
+		Timeout:     time.Duration(timeout) * time.Second,
+		KeepDays:    it.cfg.IntOr("Webhooks.KeepDays", 30),
+		AllowedNets: allowedNets,
+	}, store, workers, ider, logger)
+	workers.AddHandler(webhook.MsgTypeWebhook, webhooks.MsgHandler())
+
+	if err = scheduler.AddFun("@every 1m", webhooks.RetryDue); err != nil {
+		logger.Fatalf("failed to schedule webhook retries: %s", err)
+	}
+	if err = scheduler.AddFun("@daily", webhooks.CleanDeliveries); err != nil {
+		logger.Fatalf("failed to schedule cleaning webhook deliveries: %s", err)
+	}
+	return webhooks
+}
+
+func (it *Initer) initAuditor(
+	store db.IDBQuickshare,
+	scheduler cron.ICron,
+	ider idgen.IIDGen,
+	logger *zap.SugaredLogger,
+) audit.IAuditor {
+	keepDays := it.cfg.IntOr("Audit.KeepDays", 180)
+	if keepDays <= 0 {
+		keepDays = 180
+	}
+
+	auditor := audit.NewAuditor(&audit.Config{KeepDays: keepDays}, store, ider, logger)
+	if err := scheduler.AddFun("@daily", auditor.Clean); err != nil {
+		logger.Fatalf("failed to schedule cleaning audit logs: %s", err)
+	}
+	return auditor
+}
+
+// initTracer returns a disabled tracer if no exporter is configured
+func (it *Initer) initTracer(logger *zap.SugaredLogger) tracing.ITracer {
+	flushInterval := it.cfg.IntOr("Tracing.FlushInterval", 1000)
+	if flushInterval <= 0 {
+		flushInterval = 1000
+	}
+	cfg := &tracing.Config{
+		BatchSize:     256,
+		FlushInterval: time.Duration(flushInterval) * time.Millisecond,
+		QueueSize:     4096,
+	}
+
+	var exporter tracing.IExporter
+	var err error
+	switch exporterName := it.cfg.StringOr("Tracing.Exporter", ""); exporterName {
+	case "":
+	case tracing.ExporterOTLP:
+		endpoint := it.cfg.StringOr("Tracing.Endpoint", "")
+		if endpoint == "" {
+			endpoint = "http://127.0.0.1:4318/v1/traces"
+		}
+		serviceName := it.cfg.StringOr("Tracing.ServiceName", "")
+		if serviceName == "" {
+			serviceName = "quickshare"
+		}
+		exporter = tracing.NewOTLPExporter(endpoint, serviceName, 10*time.Second)
+	case tracing.ExporterStdout:
+		exporter = tracing.NewStdoutExporter()
+	case tracing.ExporterFile:
+		filePath := it.cfg.StringOr("Tracing.FilePath", "")
+		if filePath == "" {
+			filePath = path.Join(it.cfg.GrabString("Fs.Root"), "traces.jsonl")
+		}
+		exporter, err = tracing.NewFileExporter(filePath)
+		if err != nil {
+			logger.Fatalf("failed to create trace file: %s", err)
+		}
+	default:
+		logger.Fatalf("unknown tracing exporter: %s", exporterName)
+	}
+	return tracing.NewTracer(cfg, exporter, logger)
+}
+
+func (it *Initer) initCron() cron.ICron {
+	scheduler := cron.NewMyCron()
+	scheduler.Start()
+	return scheduler
+}
+
+func (it *Initer) initWorkerPool(collector metrics.IMetrics, tracer tracing.ITracer, logger *zap.SugaredLogger) worker.IWorkerPool {
 	queueSize := it.cfg.GrabInt("Workers.QueueSize")
 	sleepCyc := it.cfg.GrabInt("Workers.SleepCyc")
 	workerCount := it.cfg.GrabInt("Workers.WorkerCount")
 
 	workers := localworker.NewWorkerPool(queueSize, sleepCyc, workerCount, logger)
+	workers.SetJobObserver(collector.ObserveJob)
+	workers.SetTracer(tracer)
 	workers.Start()
 	return workers
 }
 
 func (it *Initer) initSearchIndex(filesystem fs.ISimpleFS, logger *zap.SugaredLogger) fileindex.IFileIndex {
 	searchResultLimit := it.cfg.GrabInt("Server.SearchResultLimit")
-	fileIndex := fileindex.NewFileTreeIndex(filesystem, "/", searchResultLimit)
+	fileIndex := fileindex.NewFileTreeIndex(filesystem, "/", searchResultLimit, fileIndexPath, fileIndexLogPath)
 
-	indexInited := false
-	indexInfo, err := filesystem.Stat(fileIndexPath)
+	// changes after the last snapshot are replayed from the log
+	err := fileIndex.Load()
 	if err != nil {
-		if !os.IsNotExist(err) {
-			logger.Warnf("detect index file error: %s", err)
-		} else {
-			logger.Warnf("index file not found")
+		logger.Errorf("failed to load file index, reindexing is required: %s", err)
+		// the broken index is dropped so that new changes can still be persisted
+		for _, indexPath := range []string{fileIndexPath, fileIndexLogPath} {
+			if err = filesystem.Remove(indexPath); err != nil {
+				logger.Errorf("failed to remove file index: %s", err)
+			}
 		}
-	} else if indexInfo.IsDir() {
-		logger.Warnf("file index is a folder, not a file: %s", fileIndexPath)
-	} else {
-		err = fileIndex.ReadFrom(fileIndexPath)
-		if err != nil {
-			logger.Warnf("failed to load file index: %s", err)
-		} else {
-			indexInited = true
+		fileIndex = fileindex.NewFileTreeIndex(filesystem, "/", searchResultLimit, fileIndexPath, fileIndexLogPath)
+		if err = fileIndex.Load(); err != nil {
+			logger.Errorf("failed to init file index: %s", err)
 		}
 	}
 
-	logger.Infof("file index inited(%t)", indexInited)
+	logger.Infof("file index loaded(%d changes after the snapshot)", fileIndex.Changes())
 	return fileIndex
 }
 
-func (it *Initer) initFs(idGenerator idgen.IIDGen, logger *zap.SugaredLogger) (fs.ISimpleFS, error) {
+func (it *Initer) initFs(idGenerator idgen.IIDGen, collector metrics.IMetrics, logger *zap.SugaredLogger) (fs.ISimpleFS, error) {
 	rootPath := it.cfg.GrabString("Fs.Root")
 	opensLimit := it.cfg.GrabInt("Fs.OpensLimit")
 	openTTL := it.cfg.GrabInt("Fs.OpenTTL")
@@ -173,17 +383,97 @@ func (it *Initer) initFs(idGenerator idgen.IIDGen, logger *zap.SugaredLogger) (f
 		logger.Fatalf("can not create %s folder: there is a file with same name", rootPath)
 	}
 
-	return local.NewLocalFS(rootPath, 0660, opensLimit, openTTL, readerTTL, idGenerator), nil
+	localFS := local.NewLocalFS(rootPath, 0660, opensLimit, openTTL, readerTTL, idGenerator)
+	collector.AddGaugeFunc(metrics.NewGaugeFunc(
+		"quickshare_fs_opens",
+		"Count of opened file descriptors.",
+		func() ([]*metrics.Sample, error) {
+			opens, _ := localFS.Opens()
+			return []*metrics.Sample{{Value: float64(opens)}}, nil
+		},
+	))
+	collector.AddGaugeFunc(metrics.NewGaugeFunc(
+		"quickshare_fs_opens_limit",
+		"Limit of opened file descriptors, idle ones are closed after it is reached.",
+		func() ([]*metrics.Sample, error) {
+			_, limit := localFS.Opens()
+			return []*metrics.Sample{{Value: float64(limit)}}, nil
+		},
+	))
+	return localFS, nil
+}
+
+// initMetricsGauges adds gauges which are collected from other dependencies when metrics are exported
+func (it *Initer) initMetricsGauges(collector metrics.IMetrics, workers worker.IWorkerPool, store db.IDBQuickshare) {
+	collector.AddGaugeFunc(metrics.NewGaugeFunc(
+		"quickshare_worker_queue_length",
+		"Count of messages waiting in the worker queue.",
+		func() ([]*metrics.Sample, error) {
+			return []*metrics.Sample{{Value: float64(workers.QueueLen())}}, nil
+		},
+	))
+
+	listUsers := func() ([]*db.User, error) {
+		return store.ListUsers(context.Background())
+	}
+	collector.AddGaugeFunc(metrics.NewGaugeFunc(
+		"quickshare_user_used_space_bytes",
+		"Space used by each user, including uploading files.",
+		func() ([]*metrics.Sample, error) {
+			users, err := listUsers()
+			if err != nil {
+				return nil, err
+			}
+			samples := []*metrics.Sample{}
+			for _, user := range users {
+				samples = append(samples, &metrics.Sample{
+					LabelValues: []string{user.Name},
+					Value:       float64(user.UsedSpace),
+				})
+			}
+			return samples, nil
+		},
+		"user",
+	))
+	collector.AddGaugeFunc(metrics.NewGaugeFunc(
+		"quickshare_user_space_limit_bytes",
+		"Space limit of each user.",
+		func() ([]*metrics.Sample, error) {
+			users, err := listUsers()
+			if err != nil {
+				return nil, err
+			}
+			samples := []*metrics.Sample{}
+			for _, user := range users {
+				if user.Quota == nil {
+					continue
+				}
+				samples = append(samples, &metrics.Sample{
+					LabelValues: []string{user.Name},
+					Value:       float64(user.Quota.SpaceLimit),
+				})
+			}
+			return samples, nil
+		},
+		"user",
+	))
 }
 
-func (it *Initer) initDb(filesystem fs.ISimpleFS) (db.IDBQuickshare, error) {
+func (it *Initer) initDb(filesystem fs.ISimpleFS, collector metrics.IMetrics) (db.IDBQuickshare, error) {
 	dbPath := it.cfg.GrabString("Db.DbPath")
 	dbDir := path.Dir(dbPath)
 
-	sqliteDB, err := sqlite.NewSQLite(path.Join(filesystem.Root(), dbPath))
+	// statements are timed and traced by the wrapped driver
+	observeQuery := func(ctx context.Context, op, query string, start time.Time, err error) {
+		collector.ObserveDBQuery(op, time.Since(start), err)
+		tracing.RecordSpan(ctx, "db."+op, start, err, map[string]interface{}{"db.statement": query})
+	}
+	fullDbPath := path.Join(filesystem.Root(), dbPath)
+	sqlDB, err := metrics.OpenDB(sqlite.DriverName, fullDbPath, observeQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create path for db: %w", err)
 	}
+	sqliteDB := sqlite.NewSQLiteFromDB(sqlDB, fullDbPath)
 	dbQuickshare, err := sqlite.NewSQLiteStore(sqliteDB)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create quickshare db: %w", err)
@@ -254,6 +544,11 @@ func (it *Initer) initDb(filesystem fs.ISimpleFS) (db.IDBQuickshare, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to init tables: %w %s", err, dbPath)
 		}
+	} else {
+		err = dbQuickshare.Upgrade(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to upgrade tables: %w %s", err, dbPath)
+		}
 	}
 
 	return dbQuickshare, nil
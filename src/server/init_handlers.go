@@ -32,6 +32,8 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 	}
 
 	// middlewares
+	router.Use(settingsSvc.RequestTracing())
+	router.Use(settingsSvc.RequestMetrics())
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "https://didactic-funicular-6r7j9rxgjgj2x66w-5173.app.github.dev"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -42,6 +44,7 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 	}))
 	router.Use(userHdrs.AuthN())
 	router.Use(userHdrs.APIAccessControl())
+	router.Use(settingsSvc.ReadOnlyGuard())
 
 	publicPath, ok := it.cfg.String("Fs.PublicPath")
 	if !ok || publicPath == "" {
@@ -74,8 +77,8 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 	usersAPI.PATCH("/preferences", userHdrs.SetPreferences)
 
 	rolesAPI := v1.Group("/roles")
-	// rolesAPI.POST("/", userHdrs.AddRole)
-	// rolesAPI.DELETE("/", userHdrs.DelRole)
+	rolesAPI.POST("/", userHdrs.AddRole)
+	rolesAPI.DELETE("/", userHdrs.DelRole)
 	rolesAPI.GET("/list", userHdrs.ListRoles)
 
 	fileHdrs, err := fileshdr.NewFileHandlers(it.cfg, deps)
@@ -135,6 +138,11 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 	adminAPI := v2.Group("/admin")
 	adminAPI.PATCH("/client", settingsSvc.SetClientCfg)
 	adminAPI.GET("/workers/queue-len", settingsSvc.WorkerQueueLen)
+	adminAPI.GET("/maintenance", settingsSvc.GetMaintenance)
+	adminAPI.PUT("/maintenance", settingsSvc.SetMaintenance)
+	adminAPI.GET("/audit/logs", settingsSvc.ListAuditLogs)
+	adminAPI.GET("/audit/export", settingsSvc.ExportAuditLogs)
+	adminAPI.GET("/metrics", settingsSvc.Metrics)
 
 	adminUsersAPI := adminAPI.Group("/users")
 	adminUsersAPI.POST("/", userHdrs.AddUser)
@@ -142,10 +150,38 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 	adminUsersAPI.GET("/list", userHdrs.ListUsers)
 	adminUsersAPI.PATCH("/", userHdrs.SetUser)
 	adminUsersAPI.PATCH("/pwd/force-set", userHdrs.ForceSetPwd)
+	adminUsersAPI.DELETE("/sessions", userHdrs.DelUserSessions)
+	adminUsersAPI.DELETE("/2fa", userHdrs.ResetUserMFA)
+	adminUsersAPI.DELETE("/lockout", userHdrs.UnlockUser)
+	adminUsersAPI.GET("/login-attempts", userHdrs.ListLoginAttempts)
+	adminUsersAPI.GET("/pending", userHdrs.ListPendingUsers)
+	adminUsersAPI.POST("/approve", userHdrs.ApproveUser)
+	adminUsersAPI.POST("/import", userHdrs.ImportUsers)
+	adminUsersAPI.GET("/export", userHdrs.ExportUsers)
+
+	adminInvitesAPI := adminAPI.Group("/invites")
+	adminInvitesAPI.POST("/", userHdrs.AddInvite)
+	adminInvitesAPI.DELETE("/", userHdrs.DelInvite)
+	adminInvitesAPI.GET("/list", userHdrs.ListInvites)
+
+	adminQuotasAPI := adminAPI.Group("/quotas")
+	adminQuotasAPI.POST("/", userHdrs.SetQuotaPolicy)
+	adminQuotasAPI.DELETE("/", userHdrs.DelQuotaPolicy)
+	adminQuotasAPI.GET("/list", userHdrs.ListQuotaPolicies)
+
+	adminGroupsAPI := adminAPI.Group("/groups")
+	adminGroupsAPI.POST("/", userHdrs.AddGroup)
+	adminGroupsAPI.DELETE("/", userHdrs.DelGroup)
+	adminGroupsAPI.GET("/list", userHdrs.ListGroups)
+	adminGroupsAPI.PATCH("/", userHdrs.SetGroupQuota)
+	adminGroupsAPI.POST("/members", userHdrs.SetGroupMember)
+	adminGroupsAPI.DELETE("/members", userHdrs.DelGroupMember)
+	adminGroupsAPI.GET("/members", userHdrs.ListGroupMembers)
 
 	adminRolesAPI := adminAPI.Group("/roles")
-	// rolesAPI.POST("/", userHdrs.AddRole)
-	// rolesAPI.DELETE("/", userHdrs.DelRole)
+	adminRolesAPI.POST("/", userHdrs.AddRole)
+	adminRolesAPI.DELETE("/", userHdrs.DelRole)
+	adminRolesAPI.PATCH("/", userHdrs.SetRoleRules)
 	adminRolesAPI.GET("/list", userHdrs.ListRoles)
 
 	// user
@@ -157,11 +193,43 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 	userAPI.POST("/errors", settingsSvc.ReportErrors)
 	userAPI.GET("/isauthed", userHdrs.IsAuthed)
 	userAPI.POST("/logout", userHdrs.Logout)
+	userAPI.GET("/groups", userHdrs.ListMyGroups)
+
+	userSessionsAPI := userAPI.Group("/sessions")
+	userSessionsAPI.GET("/", userHdrs.ListSessions)
+	userSessionsAPI.DELETE("/", userHdrs.DelSession)
+	userSessionsAPI.DELETE("/all", userHdrs.DelAllSessions)
+
+	userMFAAPI := userAPI.Group("/2fa")
+	userMFAAPI.GET("", userHdrs.GetMFAStatus)
+	userMFAAPI.DELETE("", userHdrs.DisableMFA)
+	userMFAAPI.POST("/enroll", userHdrs.EnrollMFA)
+	userMFAAPI.POST("/verify", userHdrs.VerifyMFA)
+
+	userTokensAPI := userAPI.Group("/tokens")
+	userTokensAPI.POST("/", userHdrs.AddAPIToken)
+	userTokensAPI.DELETE("/", userHdrs.DelAPIToken)
+	userTokensAPI.GET("/list", userHdrs.ListAPITokens)
+
+	userWebhooksAPI := userAPI.Group("/webhooks")
+	userWebhooksAPI.POST("/", userHdrs.AddWebhook)
+	userWebhooksAPI.DELETE("/", userHdrs.DelWebhook)
+	userWebhooksAPI.GET("/list", userHdrs.ListWebhooks)
+	userWebhooksAPI.GET("/deliveries", userHdrs.ListWebhookDeliveries)
+	userWebhooksAPI.POST("/deliveries/replay", userHdrs.ReplayWebhookDelivery)
 
 	// public
 	publicAPI := v2.Group("/public")
 
 	publicAPI.POST("/login", userHdrs.Login)
+	publicAPI.GET("/registration", userHdrs.GetRegistration)
+	publicAPI.POST("/registration", userHdrs.Register)
+	publicAPI.POST("/pwd/forget", userHdrs.ForgetPwd)
+	publicAPI.POST("/pwd/reset", userHdrs.ResetPwd)
+	publicAPI.POST("/2fa/login", userHdrs.MFALogin)
+	publicAPI.POST("/2fa/enroll", userHdrs.EnrollMFAForLogin)
+	publicAPI.GET("/oidc/login", userHdrs.OIDCLogin)
+	publicAPI.GET("/oidc/callback", userHdrs.OIDCCallback)
 
 	publicCaptchaAPI2 := publicAPI.Group("/captchas")
 	publicCaptchaAPI2.GET("/", userHdrs.GetCaptchaID)
@@ -169,11 +237,23 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 
 	publicSettingsAPI := publicAPI.Group("/settings")
 	publicSettingsAPI.OPTIONS("/health", settingsSvc.Health)
+	publicSettingsAPI.GET("/health", settingsSvc.Health)
 	publicSettingsAPI.GET("/client", settingsSvc.GetClientCfg)
 
 	if it.cfg.BoolOr("Fs.Enabled", true) {
 		adminUsersAPI.PUT("/used-space", fileHdrs.ResetUsedSpace)
 
+		adminAPI.POST("/broadcasts", fileHdrs.Broadcast)
+
+		adminStorageAPI := adminAPI.Group("/storage")
+		adminStorageAPI.GET("/users", fileHdrs.ListUserUsages)
+		adminStorageAPI.GET("/folders", fileHdrs.ListFolderUsages)
+		adminStorageAPI.GET("/largest", fileHdrs.ListLargestFiles)
+		adminStorageAPI.GET("/duplicates", fileHdrs.ListDuplicateFiles)
+		adminStorageAPI.GET("/uploadings/stale", fileHdrs.ListStaleUploadings)
+		adminStorageAPI.GET("/growth", fileHdrs.GetStorageGrowth)
+		adminStorageAPI.POST("/snapshots", fileHdrs.TakeStorageSnapshots)
+
 		userFilesAPI := userAPI.Group("/fs")
 		userFilesAPI.POST("/files", fileHdrs.Create)
 		userFilesAPI.DELETE("/files", fileHdrs.Delete)
@@ -196,9 +276,18 @@ func (it *Initer) InitHandlers(deps *depidx.Deps) (*gin.Engine, error) {
 		userFilesAPI.GET("/sharings", fileHdrs.ListSharings)
 		userFilesAPI.GET("/sharings/ids", fileHdrs.ListSharingIDs)
 
+		userFilesAPI.POST("/acls", fileHdrs.SetACL)
+		userFilesAPI.DELETE("/acls", fileHdrs.DelACL)
+		userFilesAPI.GET("/acls", fileHdrs.ListACLs)
+		userFilesAPI.GET("/acls/shared", fileHdrs.ListSharedWithMe)
+
 		userFilesAPI.GET("/metadata", fileHdrs.Metadata)
 		userFilesAPI.GET("/file/metadata", fileHdrs.FileMetadata)
 		userFilesAPI.GET("/search", fileHdrs.SearchItems)
+		userFilesAPI.GET("/search/query", fileHdrs.QueryItems)
+		userFilesAPI.GET("/search/content", fileHdrs.SearchContents)
+		userFilesAPI.GET("/changes", fileHdrs.ListChanges)
+		userFilesAPI.GET("/events", fileHdrs.Events)
 		userFilesAPI.PUT("/reindex", fileHdrs.Reindex)
 
 		userFilesAPI.POST("/hashes/sha1", fileHdrs.GenerateHash)
@@ -16,13 +16,16 @@ import (
 
 	"github.com/ihexxa/quickshare/src/depidx"
 	"github.com/ihexxa/quickshare/src/fs"
+	"github.com/ihexxa/quickshare/src/metrics"
 )
 
 type Server struct {
-	server     *http.Server
-	cfg        gocfg.ICfg
-	deps       *depidx.Deps
-	signalChan chan os.Signal
+	server *http.Server
+	// metricsServer is nil if the separate listener of metrics is disabled
+	metricsServer *http.Server
+	cfg           gocfg.ICfg
+	deps          *depidx.Deps
+	signalChan    chan os.Signal
 }
 
 func NewServer(cfg gocfg.ICfg) (*Server, error) {
@@ -55,10 +58,24 @@ func NewServer(cfg gocfg.ICfg) (*Server, error) {
 		MaxHeaderBytes: cfg.GrabInt("Server.MaxHeaderBytes"),
 	}
 
+	var metricsSrv *http.Server
+	if metricsAddr := cfg.StringOr("Metrics.Addr", ""); metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.NewHandler(deps.Metrics(), deps.Log()))
+		metricsSrv = &http.Server{
+			Addr:           metricsAddr,
+			Handler:        mux,
+			ReadTimeout:    time.Duration(cfg.GrabInt("Server.ReadTimeout")) * time.Millisecond,
+			WriteTimeout:   time.Duration(cfg.GrabInt("Server.WriteTimeout")) * time.Millisecond,
+			MaxHeaderBytes: cfg.GrabInt("Server.MaxHeaderBytes"),
+		}
+	}
+
 	return &Server{
-		server: srv,
-		deps:   deps,
-		cfg:    cfg,
+		server:        srv,
+		metricsServer: metricsSrv,
+		deps:          deps,
+		cfg:           cfg,
 	}, nil
 }
 
@@ -85,6 +102,16 @@ func (s *Server) Start() error {
 		),
 	)
 
+	if s.metricsServer != nil {
+		go func() {
+			s.deps.Log().Infow("metrics listener is starting", "addr", s.metricsServer.Addr)
+			err := s.metricsServer.ListenAndServe()
+			if err != http.ErrServerClosed {
+				s.deps.Log().Errorf("metrics listen error: %s", err)
+			}
+		}()
+	}
+
 	err := s.server.ListenAndServe()
 	if err != http.ErrServerClosed {
 		return fmt.Errorf("listen error: %w", err)
@@ -94,11 +121,19 @@ func (s *Server) Start() error {
 
 func (s *Server) Shutdown() error {
 	// TODO: add timeout
-	err := s.deps.FileIndex().WriteTo(fileIndexPath)
+	// event streams never end by themselves, they are ended so that the server could shut down
+	s.deps.Events().Close()
+	s.deps.Cron().Stop()
+	s.deps.Workers().Stop()
+	// the index is persisted after workers stop changing it
+	err := s.deps.FileIndex().Snapshot()
 	if err != nil {
 		s.deps.Log().Errorf("failed to persist file index: %s", err)
 	}
-	s.deps.Workers().Stop()
+	err = s.deps.FileIndex().Close()
+	if err != nil {
+		s.deps.Log().Errorf("failed to close file index: %s", err)
+	}
 	err = s.deps.FS().Close()
 	if err != nil {
 		s.deps.Log().Errorf("failed to close file system: %s", err)
@@ -111,6 +146,17 @@ func (s *Server) Shutdown() error {
 	if err != nil {
 		s.deps.Log().Errorf("failed to shutdown server: %s", err)
 	}
+	if s.metricsServer != nil {
+		err = s.metricsServer.Shutdown(context.Background())
+		if err != nil {
+			s.deps.Log().Errorf("failed to shutdown metrics server: %s", err)
+		}
+	}
+	// spans of requests and jobs are all finished here
+	err = s.deps.Tracer().Close()
+	if err != nil {
+		s.deps.Log().Errorf("failed to close tracer: %s", err)
+	}
 
 	s.deps.Log().Sync()
 	return nil
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestACLsHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 4, adminToken)
+	ownerName, readerName, writerName, outsiderName := getUserName(0), getUserName(1), getUserName(2), getUserName(3)
+	userID := func(userName string) uint64 {
+		id, err := strconv.ParseUint(users[userName], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	clients := map[string]*client.FilesClient{}
+	for _, userName := range []string{ownerName, readerName, writerName, outsiderName} {
+		cl, err := loginFilesClient(addr, userName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients[userName] = cl
+	}
+	ownerCl, readerCl, writerCl, outsiderCl := clients[ownerName], clients[readerName], clients[writerName], clients[outsiderName]
+
+	sharedDir := q.FsRootPath(ownerName, "shared")
+	filePath := q.FsRootPath(ownerName, "shared/doc")
+	content := "12345678"
+
+	t.Run("test granting acls", func(t *testing.T) {
+		resp, _, errs := ownerCl.Mkdir(sharedDir)
+		assertResp(t, resp, errs, 200, "owner mkdir")
+		resp, _, errs = ownerCl.Create(filePath, int64(len(content)))
+		assertResp(t, resp, errs, 200, "owner creates file")
+		resp, _, errs = ownerCl.UploadChunk(filePath, "MTIzNDU2Nzg=", 0)
+		assertResp(t, resp, errs, 200, "owner uploads file")
+
+		resp, _, errs = outsiderCl.SetACL(sharedDir, db.ACLSubjectUser, userID(outsiderName), db.ACLPermRead)
+		assertResp(t, resp, errs, 403, "outsider can not grant acls")
+		resp, _, errs = ownerCl.SetACL(filePath, db.ACLSubjectUser, userID(readerName), db.ACLPermRead)
+		assertResp(t, resp, errs, 400, "acls can not be set on files")
+		resp, _, errs = ownerCl.SetACL(sharedDir, db.ACLSubjectUser, userID(readerName), db.ACLPermRead)
+		assertResp(t, resp, errs, 200, "grant reader")
+		resp, _, errs = ownerCl.SetACL(sharedDir, db.ACLSubjectUser, userID(writerName), db.ACLPermWrite)
+		assertResp(t, resp, errs, 200, "grant writer")
+
+		resp, lsResp, errs := ownerCl.ListACLs(sharedDir)
+		assertResp(t, resp, errs, 200, "list acls")
+		if len(lsResp.ACLs) != 2 {
+			t.Fatalf("incorrect acls size (%d)", len(lsResp.ACLs))
+		}
+		resp, _, errs = readerCl.ListACLs(sharedDir)
+		assertResp(t, resp, errs, 403, "reader can not list acls")
+
+		resp, sharedResp, errs := readerCl.ListSharedWithMe()
+		assertResp(t, resp, errs, 200, "list shared with me")
+		if len(sharedResp.ACLs) != 1 ||
+			sharedResp.ACLs[0].Path != sharedDir ||
+			sharedResp.ACLs[0].Perm != db.ACLPermRead {
+			t.Fatalf("incorrect shared items %+v", sharedResp.ACLs)
+		}
+	})
+
+	t.Run("test enforcing acls", func(t *testing.T) {
+		resp, lsResp, errs := readerCl.List(sharedDir)
+		assertResp(t, resp, errs, 200, "reader lists dir")
+		if len(lsResp.Metadatas) != 1 {
+			t.Fatalf("incorrect metadata size (%d)", len(lsResp.Metadatas))
+		}
+		resp, body, errs := readerCl.Download(filePath, map[string]string{})
+		assertResp(t, resp, errs, 200, "reader downloads file")
+		if body != content {
+			t.Fatalf("content not matched (%s)", body)
+		}
+		resp, _, errs = readerCl.Create(q.FsRootPath(ownerName, "shared/new"), 1)
+		assertResp(t, resp, errs, 403, "reader can not create file")
+		resp, _, errs = readerCl.Delete(filePath)
+		assertResp(t, resp, errs, 403, "reader can not delete file")
+		resp, _, errs = outsiderCl.List(sharedDir)
+		assertResp(t, resp, errs, 403, "outsider can not list dir")
+		resp, _, errs = readerCl.List(q.FsRootPath(ownerName, "/"))
+		assertResp(t, resp, errs, 403, "acls are not applied to parents")
+
+		// space used by writers is charged to the owner
+		newFilePath := q.FsRootPath(ownerName, "shared/sub/new")
+		resp, _, errs = writerCl.Mkdir(q.FsRootPath(ownerName, "shared/sub"))
+		assertResp(t, resp, errs, 200, "writer mkdir")
+		assertUploadOK(t, newFilePath, content, addr, writerCl.Token())
+
+		ownerUsersCli := client.NewUsersClient(addr)
+		resp, _, errs = ownerUsersCli.Login(ownerName, userPwd)
+		assertResp(t, resp, errs, 200, "owner login")
+		resp, selfResp, errs := ownerUsersCli.Self()
+		assertResp(t, resp, errs, 200, "owner self")
+		if selfResp.UsedSpace != int64(2*len(content)) {
+			t.Fatalf("incorrect used space (%d)", selfResp.UsedSpace)
+		}
+
+		resp, _, errs = writerCl.Delete(newFilePath)
+		assertResp(t, resp, errs, 200, "writer deletes file")
+		resp, selfResp, errs = ownerUsersCli.Self()
+		assertResp(t, resp, errs, 200, "owner self")
+		if selfResp.UsedSpace != int64(len(content)) {
+			t.Fatalf("incorrect used space (%d)", selfResp.UsedSpace)
+		}
+	})
+
+	t.Run("test revoking acls", func(t *testing.T) {
+		resp, _, errs := ownerCl.DelACL(sharedDir, db.ACLSubjectUser, users[readerName])
+		assertResp(t, resp, errs, 200, "revoke reader")
+		resp, _, errs = readerCl.List(sharedDir)
+		assertResp(t, resp, errs, 403, "revoked reader can not list dir")
+		resp, sharedResp, errs := readerCl.ListSharedWithMe()
+		assertResp(t, resp, errs, 200, "list shared with me")
+		if len(sharedResp.ACLs) != 0 {
+			t.Fatalf("incorrect shared items %+v", sharedResp.ACLs)
+		}
+	})
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/fileshdr"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func TestAPITokensHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 2, adminToken)
+	userName, otherName := getUserName(0), getUserName(1)
+
+	usersCl := client.NewUsersClient(addr)
+	resp, _, errs = usersCl.Login(userName, userPwd)
+	assertResp(t, resp, errs, 200, "user login")
+	otherCl := client.NewUsersClient(addr)
+	resp, _, errs = otherCl.Login(otherName, userPwd)
+	assertResp(t, resp, errs, 200, "other login")
+
+	// bearerDo sends a request authenticated by the api token and returns the status code
+	bearerDo := func(method, urlpath string, query url.Values, body interface{}, token string) int {
+		reqBody := bytes.NewBuffer(nil)
+		if body != nil {
+			bodyBytes, err := json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reqBody = bytes.NewBuffer(bodyBytes)
+		}
+		reqURL := addr + urlpath
+		if query != nil {
+			reqURL = reqURL + "?" + query.Encode()
+		}
+		req, err := http.NewRequest(method, reqURL, reqBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	pathQuery := func(filePath string) url.Values {
+		return url.Values{fileshdr.FilePathQuery: []string{filePath}}
+	}
+
+	ciDir := q.FsRootPath(userName, "ci")
+	outsideDir := q.FsRootPath(userName, "outside")
+
+	t.Run("test managing api tokens", func(t *testing.T) {
+		resp, _, errs := usersCl.AddAPIToken(&multiusers.AddAPITokenReq{
+			Name:   "bad scope",
+			Scopes: []string{"delete"},
+		})
+		assertResp(t, resp, errs, 400, "invalid scope")
+		resp, _, errs = usersCl.AddAPIToken(&multiusers.AddAPITokenReq{
+			Name:     "expired",
+			ExpireAt: time.Now().Unix() - 10,
+		})
+		assertResp(t, resp, errs, 400, "expire time in the past")
+
+		resp, fullResp, errs := usersCl.AddAPIToken(&multiusers.AddAPITokenReq{Name: "full"})
+		assertResp(t, resp, errs, 200, "add full token")
+		if fullResp.Token == "" {
+			t.Fatal("token is not returned")
+		}
+
+		resp, lsResp, errs := usersCl.ListAPITokens()
+		assertResp(t, resp, errs, 200, "list tokens")
+		if len(lsResp.Tokens) != 1 || lsResp.Tokens[0].Name != "full" {
+			t.Fatalf("tokens not matched %+v", lsResp.Tokens)
+		}
+
+		code := bearerDo(http.MethodGet, "/v2/my/self", nil, nil, fullResp.Token)
+		if code != 200 {
+			t.Fatalf("full token should access self (%d)", code)
+		}
+		code = bearerDo(http.MethodPost, "/v2/my/fs/dirs", nil, &fileshdr.MkdirReq{Path: ciDir}, fullResp.Token)
+		if code != 200 {
+			t.Fatalf("full token should mkdir (%d)", code)
+		}
+		code = bearerDo(http.MethodPost, "/v2/my/fs/dirs", nil, &fileshdr.MkdirReq{Path: outsideDir}, fullResp.Token)
+		if code != 200 {
+			t.Fatalf("full token should mkdir (%d)", code)
+		}
+		code = bearerDo(http.MethodGet, "/v2/my/tokens/list", nil, nil, fullResp.Token)
+		if code != 403 {
+			t.Fatalf("tokens can not be managed by tokens (%d)", code)
+		}
+		code = bearerDo(http.MethodGet, "/v2/my/self", nil, nil, "qst_invalid")
+		if code != 401 {
+			t.Fatalf("invalid token should be rejected (%d)", code)
+		}
+
+		resp, _, errs = otherCl.DelAPIToken(fullResp.ID)
+		assertResp(t, resp, errs, 404, "others can not revoke the token")
+		resp, _, errs = usersCl.DelAPIToken(fullResp.ID)
+		assertResp(t, resp, errs, 200, "revoke token")
+		code = bearerDo(http.MethodGet, "/v2/my/self", nil, nil, fullResp.Token)
+		if code != 401 {
+			t.Fatalf("revoked token should be rejected (%d)", code)
+		}
+	})
+
+	t.Run("test scopes and path prefix", func(t *testing.T) {
+		resp, readResp, errs := usersCl.AddAPIToken(&multiusers.AddAPITokenReq{
+			Name:   "read",
+			Scopes: []string{db.APITokenScopeRead},
+		})
+		assertResp(t, resp, errs, 200, "add read token")
+		resp, uploadResp, errs := usersCl.AddAPIToken(&multiusers.AddAPITokenReq{
+			Name:       "upload",
+			Scopes:     []string{db.APITokenScopeUpload},
+			PathPrefix: ciDir,
+			ExpireAt:   time.Now().Unix() + 3600,
+		})
+		assertResp(t, resp, errs, 200, "add upload token")
+
+		code := bearerDo(http.MethodGet, "/v2/my/fs/dirs", url.Values{fileshdr.ListDirQuery: []string{ciDir}}, nil, readResp.Token)
+		if code != 200 {
+			t.Fatalf("read token should list (%d)", code)
+		}
+		code = bearerDo(http.MethodPost, "/v2/my/fs/dirs", nil, &fileshdr.MkdirReq{Path: ciDir + "/read"}, readResp.Token)
+		if code != 403 {
+			t.Fatalf("read token can not mkdir (%d)", code)
+		}
+		if code = bearerDo(http.MethodGet, "/v2/my/sessions/", nil, nil, readResp.Token); code != 403 {
+			t.Fatalf("read token can only access file APIs (%d)", code)
+		}
+
+		// admins' scoped tokens can not access admin APIs
+		resp, adminReadResp, errs := adminUsersCli.AddAPIToken(&multiusers.AddAPITokenReq{
+			Name:   "read",
+			Scopes: []string{db.APITokenScopeRead},
+		})
+		assertResp(t, resp, errs, 200, "add admin read token")
+		for _, accessPath := range []string{"/v2/admin/users/export", "/v2/admin/audit/export", "/v2/admin/metrics"} {
+			if code = bearerDo(http.MethodGet, accessPath, nil, nil, adminReadResp.Token); code != 403 {
+				t.Fatalf("admin read token can not access %s (%d)", accessPath, code)
+			}
+		}
+		if code = bearerDo(http.MethodGet, "/v2/my/fs/dirs/home", nil, nil, adminReadResp.Token); code != 200 {
+			t.Fatalf("admin read token should read files (%d)", code)
+		}
+
+		code = bearerDo(http.MethodPost, "/v2/my/fs/dirs", nil, &fileshdr.MkdirReq{Path: ciDir + "/build"}, uploadResp.Token)
+		if code != 200 {
+			t.Fatalf("upload token should mkdir in the prefix (%d)", code)
+		}
+		code = bearerDo(http.MethodPost, "/v2/my/fs/files", nil, &fileshdr.CreateReq{
+			Path:     ciDir + "/build/artifact",
+			FileSize: 5,
+		}, uploadResp.Token)
+		if code != 200 {
+			t.Fatalf("upload token should create files in the prefix (%d)", code)
+		}
+		code = bearerDo(http.MethodPost, "/v2/my/fs/files", nil, &fileshdr.CreateReq{
+			Path:     outsideDir + "/artifact",
+			FileSize: 5,
+		}, uploadResp.Token)
+		if code != 403 {
+			t.Fatalf("upload token can not create files out of the prefix (%d)", code)
+		}
+		code = bearerDo(http.MethodGet, "/v2/my/fs/dirs", url.Values{fileshdr.ListDirQuery: []string{ciDir}}, nil, uploadResp.Token)
+		if code != 403 {
+			t.Fatalf("upload token can not list (%d)", code)
+		}
+		code = bearerDo(http.MethodDelete, "/v2/my/fs/files", pathQuery(ciDir+"/build"), nil, uploadResp.Token)
+		if code != 403 {
+			t.Fatalf("upload token can not delete (%d)", code)
+		}
+
+		resp, lsResp, errs := usersCl.ListAPITokens()
+		assertResp(t, resp, errs, 200, "list tokens")
+		for _, token := range lsResp.Tokens {
+			if token.LastUsedAt == 0 {
+				t.Fatalf("last used time is not updated %+v", token)
+			}
+		}
+	})
+
+	t.Run("test path prefix in listings and events", func(t *testing.T) {
+		resp, prefixResp, errs := usersCl.AddAPIToken(&multiusers.AddAPITokenReq{
+			Name:       "prefix",
+			PathPrefix: ciDir,
+		})
+		assertResp(t, resp, errs, 200, "add prefix token")
+		bearerGet := func(urlpath string, body interface{}) {
+			req, err := http.NewRequest(http.MethodGet, addr+urlpath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+prefixResp.Token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Fatalf("failed to get %s (%d)", urlpath, resp.StatusCode)
+			} else if err = json.NewDecoder(resp.Body).Decode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// events of the user out of the prefix are not sent
+		req, err := http.NewRequest(http.MethodGet, addr+"/v2/my/fs/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+prefixResp.Token)
+		streamResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer streamResp.Body.Close()
+		if streamResp.StatusCode != 200 {
+			t.Fatalf("failed to open the stream (%d)", streamResp.StatusCode)
+		}
+		dataLines := make(chan string, 64)
+		go func() {
+			defer close(dataLines)
+			reader := bufio.NewReader(streamResp.Body)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if strings.HasPrefix(line, "data:") {
+					dataLines <- line
+				}
+			}
+		}()
+
+		userFilesCl, err := loginFilesClient(addr, userName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUploadOK(t, outsideDir+"/o.txt", "12345", addr, userFilesCl.Token())
+		assertUploadOK(t, ciDir+"/in.txt", "12345", addr, userFilesCl.Token())
+		timeout := time.After(5 * time.Second)
+		for received := false; !received; {
+			select {
+			case line, ok := <-dataLines:
+				if !ok {
+					t.Fatal("stream is closed")
+				} else if strings.Contains(line, outsideDir) {
+					t.Fatalf("event out of the prefix is sent (%s)", line)
+				}
+				received = strings.Contains(line, ciDir+"/in.txt")
+			case <-timeout:
+				t.Fatal("event in the prefix is not received")
+			}
+		}
+
+		for _, dirPath := range []string{outsideDir, ciDir} {
+			resp, _, errs := userFilesCl.AddSharing(dirPath)
+			assertResp(t, resp, errs, 200, "add sharing")
+			resp, _, errs = userFilesCl.Create(dirPath+"/uploading", 5)
+			assertResp(t, resp, errs, 200, "create uploading")
+		}
+		otherFilesCl, err := loginFilesClient(addr, otherName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherDir := q.FsRootPath(otherName, "team")
+		resp, _, errs = otherFilesCl.Mkdir(otherDir)
+		assertResp(t, resp, errs, 200, "mkdir")
+		userID, err := strconv.ParseUint(users[userName], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _, errs = otherFilesCl.SetACL(otherDir, db.ACLSubjectUser, userID, db.ACLPermRead)
+		assertResp(t, resp, errs, 200, "grant user")
+
+		uploadingsResp := &fileshdr.ListUploadingsResp{}
+		bearerGet("/v2/my/fs/uploadings", uploadingsResp)
+		found := false
+		for _, info := range uploadingsResp.UploadInfos {
+			if !strings.HasPrefix(info.RealFilePath, ciDir+"/") {
+				t.Fatalf("uploading out of the prefix is listed %+v", info)
+			}
+			found = found || info.RealFilePath == ciDir+"/uploading"
+		}
+		if !found {
+			t.Fatalf("uploading in the prefix is not listed %+v", uploadingsResp.UploadInfos)
+		}
+		sharingsResp := &fileshdr.SharingResp{}
+		bearerGet("/v2/my/fs/sharings", sharingsResp)
+		if len(sharingsResp.SharingDirs) != 1 || sharingsResp.SharingDirs[0] != ciDir {
+			t.Fatalf("sharings not matched %+v", sharingsResp.SharingDirs)
+		}
+		sharingIDsResp := &fileshdr.SharingIDsResp{}
+		bearerGet("/v2/my/fs/sharings/ids", sharingIDsResp)
+		if _, ok := sharingIDsResp.IDs[ciDir]; !ok || len(sharingIDsResp.IDs) != 1 {
+			t.Fatalf("sharing IDs not matched %+v", sharingIDsResp.IDs)
+		}
+		aclsResp := &fileshdr.ACLsResp{}
+		bearerGet("/v2/my/fs/acls/shared", aclsResp)
+		if len(aclsResp.ACLs) != 0 {
+			t.Fatalf("shared folders not matched %+v", aclsResp.ACLs)
+		}
+
+		// the user still lists all of them without the token
+		resp, cookieUploadingsResp, errs := userFilesCl.ListUploadings()
+		assertResp(t, resp, errs, 200, "list uploadings")
+		if len(cookieUploadingsResp.UploadInfos) != len(uploadingsResp.UploadInfos)+1 {
+			t.Fatalf("uploadings not matched %+v", cookieUploadingsResp.UploadInfos)
+		}
+	})
+}
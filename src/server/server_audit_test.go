@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/fileshdr"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+	"github.com/ihexxa/quickshare/src/handlers/settings"
+)
+
+func TestAuditLogHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	usersCl := client.NewUsersClient(addr)
+	resp, _, errs := usersCl.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	settingsCl := client.NewSettingsClient(addr, adminToken)
+
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 2, adminToken)
+	userName := getUserName(1)
+	userFilesCl, err := loginFilesClient(addr, userName, userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _, errs = client.NewUsersClient(addr).Login(userName, "wrong")
+	assertResp(t, resp, errs, 403, "login with wrong password")
+
+	listLogs := func(t *testing.T, filters map[string]string) *settings.ListAuditLogsResp {
+		resp, lsResp, errs := settingsCl.ListAuditLogs(filters)
+		assertResp(t, resp, errs, 200, "list audit logs")
+		return lsResp
+	}
+
+	t.Run("test recording actions", func(t *testing.T) {
+		assertUploadOK(t, "user_1/files/shared/a.txt", "12345", addr, userFilesCl.Token())
+		resp, _, errs := userFilesCl.AddSharing("user_1/files/shared")
+		assertResp(t, resp, errs, 200, "add sharing")
+
+		// visitors download shared files through v1 APIs
+		query := url.Values{}
+		query.Set(fileshdr.FilePathQuery, "user_1/files/shared/a.txt")
+		visitorResp, err := http.Get(fmt.Sprintf("%s/v1/fs/files?%s", addr, query.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		visitorResp.Body.Close()
+		if visitorResp.StatusCode != 200 {
+			t.Fatalf("visitor failed to download %d", visitorResp.StatusCode)
+		}
+		// downloads by owners are not audited
+		resp, _, errs = userFilesCl.Download("user_1/files/shared/a.txt", map[string]string{})
+		assertResp(t, resp, errs, 200, "download")
+
+		resp, _, errs = userFilesCl.Move("user_1/files/shared/a.txt", "user_1/files/b.txt")
+		assertResp(t, resp, errs, 200, "move")
+		resp, _, errs = userFilesCl.Delete("user_1/files/b.txt")
+		assertResp(t, resp, errs, 200, "delete")
+		resp, _, errs = userFilesCl.Delete("user_0/files")
+		assertResp(t, resp, errs, 403, "delete others' files")
+		resp, _, errs = userFilesCl.DelSharing("user_1/files/shared")
+		assertResp(t, resp, errs, 200, "delete sharing")
+
+		resp, _, errs = settingsCl.SetMaintenance(false)
+		assertResp(t, resp, errs, 200, "set maintenance")
+
+		logs := listLogs(t, map[string]string{}).Logs
+		expected := []struct {
+			actor  string
+			action string
+			target string
+			detail string
+			result string
+		}{
+			{adminName, db.AuditActionSetConfig, "maintenance", "readOnly=false", db.AuditResultSucceeded},
+			{userName, db.AuditActionDelSharing, "user_1/files/shared", "", db.AuditResultSucceeded},
+			{userName, db.AuditActionDelete, "user_0/files", "", db.AuditResultFailed},
+			{userName, db.AuditActionDelete, "user_1/files/b.txt", "", db.AuditResultSucceeded},
+			{userName, db.AuditActionMove, "user_1/files/shared/a.txt", "user_1/files/b.txt", db.AuditResultSucceeded},
+			{"", db.AuditActionDownload, "user_1/files/shared/a.txt", "", db.AuditResultSucceeded},
+			{userName, db.AuditActionAddSharing, "user_1/files/shared", "", db.AuditResultSucceeded},
+			{userName, db.AuditActionUpload, "user_1/files/shared/a.txt", "size=5", db.AuditResultSucceeded},
+			{userName, db.AuditActionLogin, userName, "", db.AuditResultFailed},
+			{userName, db.AuditActionLogin, userName, "", db.AuditResultSucceeded},
+		}
+		if len(logs) < len(expected) {
+			t.Fatalf("logs are missing %d", len(logs))
+		}
+		for i, exp := range expected {
+			log := logs[i]
+			if log.Actor != exp.actor ||
+				log.Action != exp.action ||
+				log.Target != exp.target ||
+				log.Detail != exp.detail ||
+				log.Result != exp.result ||
+				log.IP != "127.0.0.1" {
+				t.Fatalf("log(%d) not matched %+v %+v", i, log, exp)
+			}
+		}
+	})
+
+	t.Run("test filtering and paginating", func(t *testing.T) {
+		logs := listLogs(t, map[string]string{
+			settings.ActionQuery: db.AuditActionDownload,
+			settings.TargetQuery: "user_1/files/shared",
+		}).Logs
+		if len(logs) != 1 || logs[0].Target != "user_1/files/shared/a.txt" {
+			t.Fatalf("download logs not matched %+v", logs)
+		}
+
+		logs = listLogs(t, map[string]string{
+			settings.ActorQuery:  userName,
+			settings.ResultQuery: db.AuditResultFailed,
+		}).Logs
+		if len(logs) != 2 {
+			t.Fatalf("failed logs not matched %+v", logs)
+		}
+
+		all := listLogs(t, map[string]string{}).Logs
+		paged := []*db.AuditLog{}
+		cursor := ""
+		for {
+			lsResp := listLogs(t, map[string]string{
+				settings.LimitQuery:  "3",
+				settings.CursorQuery: cursor,
+			})
+			paged = append(paged, lsResp.Logs...)
+			if lsResp.Cursor == "" {
+				break
+			}
+			cursor = lsResp.Cursor
+		}
+		if len(paged) != len(all) {
+			t.Fatalf("paged logs not matched %d %d", len(paged), len(all))
+		}
+		for i := range all {
+			if paged[i].ID != all[i].ID {
+				t.Fatalf("paged logs not matched %+v %+v", paged[i], all[i])
+			}
+		}
+
+		resp, _, errs := settingsCl.ListAuditLogs(map[string]string{settings.LimitQuery: "0"})
+		assertResp(t, resp, errs, 400, "list with invalid limit")
+	})
+
+	t.Run("test exporting", func(t *testing.T) {
+		filters := map[string]string{settings.ActorQuery: userName}
+		expected := listLogs(t, filters).Logs
+
+		resp, body, errs := settingsCl.ExportAuditLogs(settings.FormatJSONL, filters)
+		assertResp(t, resp, errs, 200, "export jsonl")
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		if len(lines) != len(expected) {
+			t.Fatalf("exported lines not matched %d %d", len(lines), len(expected))
+		}
+		for i, line := range lines {
+			log := &db.AuditLog{}
+			if err := json.Unmarshal([]byte(line), log); err != nil {
+				t.Fatal(err)
+			} else if log.ID != expected[i].ID || log.Action != expected[i].Action {
+				t.Fatalf("exported log not matched %+v %+v", log, expected[i])
+			}
+		}
+
+		resp, body, errs = settingsCl.ExportAuditLogs(settings.FormatCSV, filters)
+		assertResp(t, resp, errs, 200, "export csv")
+		rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(rows) != len(expected)+1 || rows[0][0] != "id" {
+			t.Fatalf("exported rows not matched %v", rows)
+		}
+		if rows[1][0] != fmt.Sprint(expected[0].ID) || rows[1][4] != expected[0].Action {
+			t.Fatalf("exported row not matched %v %+v", rows[1], expected[0])
+		}
+
+		resp, _, errs = settingsCl.ExportAuditLogs("xml", filters)
+		assertResp(t, resp, errs, 400, "export invalid format")
+	})
+
+	t.Run("test recording user management", func(t *testing.T) {
+		resp, addResp, errs := usersCl.AddUser("audited", userPwd, db.UserRole)
+		assertResp(t, resp, errs, 200, "add user")
+		resp, _, errs = usersCl.AddUser("audited2", userPwd, "nobody")
+		assertResp(t, resp, errs, 400, "add user with unknown role")
+
+		csvData := "name,role\naudited,admin\nimported,user"
+		resp, _, errs = usersCl.ImportUsers(multiusers.FormatCSV, []byte(csvData), false)
+		assertResp(t, resp, errs, 200, "import users")
+		resp, _, errs = usersCl.DelUser(addResp.ID)
+		assertResp(t, resp, errs, 200, "delete user")
+
+		logs := listLogs(t, map[string]string{settings.ActorQuery: adminName}).Logs
+		expected := []struct {
+			action string
+			target string
+			detail string
+			result string
+		}{
+			{db.AuditActionDelUser, addResp.ID, "", db.AuditResultSucceeded},
+			{db.AuditActionAddUser, "imported", "role=user; import", db.AuditResultSucceeded},
+			{db.AuditActionSetUser, addResp.ID, "role=admin; import", db.AuditResultSucceeded},
+			{db.AuditActionAddUser, "audited2", "role=nobody", db.AuditResultFailed},
+			{db.AuditActionAddUser, "audited", "role=user", db.AuditResultSucceeded},
+		}
+		if len(logs) < len(expected) {
+			t.Fatalf("logs are missing %d", len(logs))
+		}
+		for i, exp := range expected {
+			log := logs[i]
+			if log.Action != exp.action ||
+				log.Target != exp.target ||
+				log.Detail != exp.detail ||
+				log.Result != exp.result {
+				t.Fatalf("log(%d) not matched %+v %+v", i, log, exp)
+			}
+		}
+	})
+
+	t.Run("test access control", func(t *testing.T) {
+		userSettingsCl := client.NewSettingsClient(addr, userFilesCl.Token())
+		resp, _, errs := userSettingsCl.ListAuditLogs(map[string]string{})
+		assertResp(t, resp, errs, 403, "list audit logs by user")
+	})
+
+	resp, _, errs = usersCl.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestChangesHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 3, adminToken)
+	userFilesCl, err := loginFilesClient(addr, getUserName(1), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFilesCl, err := loginFilesClient(addr, getUserName(2), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listChanges := func(t *testing.T, filesCl *client.FilesClient, cursor string, wait int) ([]*db.FileChange, string) {
+		resp, changesResp, errs := filesCl.ListChanges(cursor, 100, wait)
+		assertResp(t, resp, errs, 200, "list changes")
+		return changesResp.Changes, changesResp.Cursor
+	}
+	assertChanges := func(t *testing.T, changes []*db.FileChange, expected ...[2]string) {
+		if len(changes) != len(expected) {
+			t.Fatalf("changes not matched %+v %v", changes, expected)
+		}
+		for i, change := range changes {
+			if change.Op != expected[i][0] || change.Path != expected[i][1] {
+				t.Fatalf("change not matched %+v %v", change, expected[i])
+			}
+		}
+	}
+
+	_, cursor := listChanges(t, userFilesCl, "", 0)
+	_, otherCursor := listChanges(t, otherFilesCl, "", 0)
+
+	t.Run("test listing changes", func(t *testing.T) {
+		resp, _, errs := userFilesCl.Mkdir("user_1/files/docs")
+		assertResp(t, resp, errs, 200, "mkdir")
+		assertUploadOK(t, "user_1/files/docs/a.txt", "12345", addr, userFilesCl.Token())
+		resp, _, errs = userFilesCl.Move("user_1/files/docs/a.txt", "user_1/files/docs/b.txt")
+		assertResp(t, resp, errs, 200, "move")
+		resp, _, errs = userFilesCl.AddSharing("user_1/files/docs")
+		assertResp(t, resp, errs, 200, "add sharing")
+		resp, _, errs = userFilesCl.DelSharing("user_1/files/docs")
+		assertResp(t, resp, errs, 200, "del sharing")
+		resp, _, errs = userFilesCl.Delete("user_1/files/docs/b.txt")
+		assertResp(t, resp, errs, 200, "delete")
+
+		changes, nextCursor := listChanges(t, userFilesCl, cursor, 0)
+		assertChanges(t, changes,
+			[2]string{db.FileChangeCreate, "user_1/files/docs"},
+			[2]string{db.FileChangeUpload, "user_1/files/docs/a.txt"},
+			[2]string{db.FileChangeMove, "user_1/files/docs/a.txt"},
+			[2]string{db.FileChangeShare, "user_1/files/docs"},
+			[2]string{db.FileChangeUnshare, "user_1/files/docs"},
+			[2]string{db.FileChangeDelete, "user_1/files/docs/b.txt"},
+		)
+		if changes[2].NewPath != "user_1/files/docs/b.txt" || changes[5].Size != 5 {
+			t.Fatalf("changes not matched %+v %+v", changes[2], changes[5])
+		}
+
+		// no more change after the cursor
+		changes, cursor = listChanges(t, userFilesCl, nextCursor, 0)
+		assertChanges(t, changes)
+		if cursor != nextCursor {
+			t.Fatalf("cursor should not be changed %s %s", cursor, nextCursor)
+		}
+
+		// changes of other users are not visible, but the cursor still moves forward
+		changes, nextCursor = listChanges(t, otherFilesCl, otherCursor, 0)
+		assertChanges(t, changes)
+		if nextCursor != cursor {
+			t.Fatalf("cursors not matched %s %s", nextCursor, cursor)
+		}
+	})
+
+	t.Run("test long polling", func(t *testing.T) {
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			resp, _, errs := userFilesCl.Mkdir("user_1/files/polled")
+			assertResp(t, resp, errs, 200, "mkdir")
+		}()
+
+		start := time.Now()
+		changes, nextCursor := listChanges(t, userFilesCl, cursor, 10)
+		assertChanges(t, changes, [2]string{db.FileChangeCreate, "user_1/files/polled"})
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("polling is not woken up: %s", time.Since(start))
+		}
+		cursor = nextCursor
+
+		// it returns after waiting if there is no change
+		start = time.Now()
+		changes, _ = listChanges(t, userFilesCl, cursor, 1)
+		assertChanges(t, changes)
+		if time.Since(start) < time.Second {
+			t.Fatalf("polling returns too early: %s", time.Since(start))
+		}
+	})
+
+	t.Run("test invalid cursors", func(t *testing.T) {
+		for _, invalidCursor := range []string{"abc", "-1", "100000"} {
+			resp, _, errs := userFilesCl.ListChanges(invalidCursor, 100, 0)
+			assertResp(t, resp, errs, 400, "invalid cursor")
+		}
+		resp, _, errs := userFilesCl.ListChanges(cursor, 100, 100)
+		assertResp(t, resp, errs, 400, "too long waiting")
+
+		// retention purges everything, old cursors are expired and the current cursor is still valid
+		err := srv.deps.FileChanges().DelFileChanges(context.TODO(), time.Now().Unix()+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _, errs = userFilesCl.ListChanges("0", 100, 0)
+		assertResp(t, resp, errs, 410, "expired cursor")
+		lastCursor, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _, errs = userFilesCl.ListChanges(strconv.FormatUint(lastCursor-1, 10), 100, 0)
+		assertResp(t, resp, errs, 410, "expired cursor")
+		changes, nextCursor := listChanges(t, userFilesCl, cursor, 0)
+		assertChanges(t, changes)
+		if nextCursor != cursor {
+			t.Fatalf("cursor should not be changed %s %s", nextCursor, cursor)
+		}
+		resp, _, errs = userFilesCl.ListChanges(strconv.FormatUint(lastCursor+1, 10), 100, 0)
+		assertResp(t, resp, errs, 400, "invalid cursor")
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestContentSearchHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 4096,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData",
+			"enableContentIndex": true
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	adminFilesCl := client.NewFilesClient(addr, adminToken)
+
+	// "user_1" is a prefix of "user_10"
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 11, adminToken)
+	userFilesCl, err := loginFilesClient(addr, getUserName(1), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFilesCl, err := loginFilesClient(addr, getUserName(10), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertUploadOK(t, "user_1/files/docs/plan.md", "# Plan\nThe <b>budget</b> of the quarter is approved", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/page.html", "<html><body><p>Budget review</p><script>hidden()</script></body></html>", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/photo.jpg", "budget", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_10/files/secret.txt", "the secret budget", addr, otherFilesCl.Token())
+
+	searchPaths := func(t *testing.T, cl *client.FilesClient, query string, dirPaths ...string) []string {
+		resp, searchResp, errs := cl.SearchContents(query, 10, dirPaths...)
+		assertResp(t, resp, errs, 200, "search contents")
+		paths := []string{}
+		for _, result := range searchResp.Results {
+			paths = append(paths, result.Path)
+		}
+		return paths
+	}
+
+	t.Run("test searching", func(t *testing.T) {
+		// texts are extracted asynchronously
+		for i := 0; ; i++ {
+			if len(searchPaths(t, adminFilesCl, "budget")) == 3 {
+				break
+			} else if i >= 50 {
+				t.Fatalf("texts are not indexed %v", searchPaths(t, adminFilesCl, "budget"))
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		paths := searchPaths(t, userFilesCl, "budget")
+		if len(paths) != 2 {
+			t.Fatalf("paths not matched %v", paths)
+		}
+		for _, filePath := range paths {
+			if !strings.HasPrefix(filePath, "user_1/files/") {
+				t.Fatalf("other's file is found %v", paths)
+			}
+		}
+		if paths := searchPaths(t, userFilesCl, "hidden"); len(paths) != 0 {
+			t.Fatalf("scripts should not be indexed %v", paths)
+		}
+		if paths := searchPaths(t, otherFilesCl, "approved"); len(paths) != 0 {
+			t.Fatalf("other's file is found %v", paths)
+		}
+		if paths := searchPaths(t, userFilesCl, "budg*", "user_1/files/docs"); len(paths) != 1 || paths[0] != "user_1/files/docs/plan.md" {
+			t.Fatalf("paths not matched %v", paths)
+		}
+
+		resp, searchResp, errs := userFilesCl.SearchContents("approved", 10)
+		assertResp(t, resp, errs, 200, "search contents")
+		if len(searchResp.Results) != 1 ||
+			!strings.Contains(searchResp.Results[0].Snippet, "&lt;b&gt;budget&lt;/b&gt;") ||
+			!strings.Contains(searchResp.Results[0].Snippet, "<mark>approved</mark>") {
+			t.Fatalf("results not matched %+v", searchResp.Results)
+		}
+
+		resp, _, errs = userFilesCl.SearchContents("", 10)
+		assertResp(t, resp, errs, 400, "empty query")
+		resp, _, errs = userFilesCl.SearchContents("budget", 10, "../etc")
+		assertResp(t, resp, errs, 400, "invalid folder")
+	})
+
+	t.Run("test moving and deleting", func(t *testing.T) {
+		resp, _, errs := userFilesCl.Move("user_1/files/docs/plan.md", "user_1/files/plan.md")
+		assertResp(t, resp, errs, 200, "move file")
+		if paths := searchPaths(t, userFilesCl, "approved"); len(paths) != 1 || paths[0] != "user_1/files/plan.md" {
+			t.Fatalf("paths not matched %v", paths)
+		}
+
+		resp, _, errs = userFilesCl.Delete("user_1/files/plan.md")
+		assertResp(t, resp, errs, 200, "delete file")
+		if paths := searchPaths(t, userFilesCl, "approved"); len(paths) != 0 {
+			t.Fatalf("deleted file is found %v", paths)
+		}
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestDiskGuard(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	newConfig := func(minFreeSpace int64) string {
+		return fmt.Sprintf(`{
+			"users": {
+				"enableAuth": true,
+				"minUserNameLen": 2,
+				"minPwdLen": 4,
+				"captchaEnabled": false,
+				"uploadSpeedLimit": 409600,
+				"downloadSpeedLimit": 409600,
+				"spaceLimit": 1024,
+				"limiterCapacity": 1000,
+				"limiterCyc": 1000
+			},
+			"server": {
+				"debug": true,
+				"host": "127.0.0.1"
+			},
+			"fs": {
+				"root": "tmpTestData",
+				"minFreeSpace": %d,
+				"diskCheckInterval": 1
+			},
+			"db": {
+				"dbPath": "tmpTestData/quickshare"
+			}
+		}`, minFreeSpace)
+	}
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+
+	t.Run("test maintenance mode", func(t *testing.T) {
+		setUpEnv(t, rootPath, adminName, adminPwd)
+		defer os.RemoveAll(rootPath)
+
+		srv := startTestServer(newConfig(1024))
+		defer srv.Shutdown()
+		if !isServerReady(addr) {
+			t.Fatal("fail to start server")
+		}
+
+		usersCl := client.NewUsersClient(addr)
+		resp, _, errs := usersCl.Login(adminName, adminPwd)
+		assertResp(t, resp, errs, 200, "admin login")
+		token := client.GetCookie(resp.Cookies(), q.TokenCookie)
+		settingsCl := client.NewSettingsClient(addr, token)
+		filesCl := client.NewFilesClient(addr, token)
+
+		assertUploadOK(t, "qs/files/file1", "1234", addr, token)
+
+		resp, _, errs = settingsCl.SetMaintenance(true)
+		assertResp(t, resp, errs, 200, "enable maintenance")
+		resp, healthResp, errs := settingsCl.GetHealth()
+		assertResp(t, resp, errs, 200, "get health")
+		if !healthResp.Disk.ReadOnly || !healthResp.Disk.Maintenance || healthResp.Disk.LowSpace {
+			t.Fatalf("unexpected status %+v", healthResp.Disk)
+		}
+
+		resp, _, errs = filesCl.Create("qs/files/file2", 4)
+		assertResp(t, resp, errs, 503, "create in maintenance")
+		resp, _, errs = filesCl.Mkdir("qs/files/folder")
+		assertResp(t, resp, errs, 503, "mkdir in maintenance")
+		resp, _, errs = filesCl.Download("qs/files/file1", map[string]string{})
+		assertResp(t, resp, errs, 200, "download in maintenance")
+		resp, _, errs = filesCl.Delete("qs/files/file1")
+		assertResp(t, resp, errs, 503, "delete in maintenance")
+
+		// logging in is still allowed
+		resp, _, errs = usersCl.Login(adminName, adminPwd)
+		assertResp(t, resp, errs, 200, "login in maintenance")
+
+		resp, _, errs = settingsCl.SetMaintenance(false)
+		assertResp(t, resp, errs, 200, "disable maintenance")
+		assertUploadOK(t, "qs/files/file2", "1234", addr, token)
+		resp, _, errs = filesCl.Delete("qs/files/file1")
+		assertResp(t, resp, errs, 200, "delete after maintenance")
+	})
+
+	t.Run("test low space", func(t *testing.T) {
+		setUpEnv(t, rootPath, adminName, adminPwd)
+		defer os.RemoveAll(rootPath)
+
+		srv := startTestServer(newConfig(1 << 60))
+		defer srv.Shutdown()
+		if !isServerReady(addr) {
+			t.Fatal("fail to start server")
+		}
+
+		usersCl := client.NewUsersClient(addr)
+		resp, _, errs := usersCl.Login(adminName, adminPwd)
+		assertResp(t, resp, errs, 200, "admin login")
+		token := client.GetCookie(resp.Cookies(), q.TokenCookie)
+		settingsCl := client.NewSettingsClient(addr, token)
+		filesCl := client.NewFilesClient(addr, token)
+
+		resp, _, errs = filesCl.Create("qs/files/file1", 4)
+		assertResp(t, resp, errs, 507, "create with low space")
+		resp, _, errs = filesCl.Mkdir("qs/files/folder")
+		assertResp(t, resp, errs, 507, "mkdir with low space")
+		resp, _, errs = filesCl.List("qs/files")
+		assertResp(t, resp, errs, 200, "list with low space")
+		// deleting frees space so it is not rejected
+		resp, _, errs = filesCl.Delete("qs/files/file1")
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		} else if resp.StatusCode == 507 {
+			t.Fatal("delete is rejected with low space")
+		}
+
+		resp, healthResp, errs := settingsCl.GetHealth()
+		assertResp(t, resp, errs, 200, "get health")
+		if !healthResp.Disk.ReadOnly || !healthResp.Disk.LowSpace || len(healthResp.Disk.Disks) == 0 {
+			t.Fatalf("unexpected status %+v", healthResp.Disk)
+		}
+	})
+}
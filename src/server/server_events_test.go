@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/events"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/fileshdr"
+)
+
+func TestEventsHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1",
+			"maxEventStreams": 2,
+			"eventsHeartbeat": 1
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	adminFilesCl := client.NewFilesClient(addr, adminToken)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 4, adminToken)
+	userFilesCl, err := loginFilesClient(addr, getUserName(1), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFilesCl, err := loginFilesClient(addr, getUserName(2), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openStream := func(t *testing.T, filesCl *client.FilesClient, dirPaths ...string) (*client.EventStream, <-chan *client.StreamEvent) {
+		resp, stream, err := filesCl.Events(dirPaths...)
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != 200 {
+			t.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+
+		received := make(chan *client.StreamEvent, 64)
+		go func() {
+			defer close(received)
+			for {
+				event, err := stream.Next()
+				if err != nil {
+					return
+				}
+				received <- event
+			}
+		}()
+		return stream, received
+	}
+	// waitEvent skips other events until the event of the type is received
+	waitEvent := func(t *testing.T, received <-chan *client.StreamEvent, eventType string, data interface{}) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event, ok := <-received:
+				if !ok {
+					t.Fatalf("stream is closed before receiving %s", eventType)
+				} else if event.Type != eventType {
+					continue
+				}
+				wrapper := &events.Event{Data: data}
+				if err := json.Unmarshal([]byte(event.Data), wrapper); err != nil {
+					t.Fatal(err)
+				}
+				return
+			case <-timeout:
+				t.Fatalf("%s is not received", eventType)
+			}
+		}
+	}
+
+	t.Run("test upload, job and folder events", func(t *testing.T) {
+		userStream, userEvents := openStream(t, userFilesCl)
+		defer userStream.Close()
+		adminStream, adminEvents := openStream(t, adminFilesCl, "user_1/files")
+		defer adminStream.Close()
+
+		assertUploadOK(t, "user_1/files/a.txt", "12345", addr, userFilesCl.Token())
+
+		status := &fileshdr.UploadStatusResp{}
+		waitEvent(t, userEvents, events.TypeUpload, status)
+		if status.Path != "user_1/files/a.txt" || status.Uploaded != 5 || status.FileSize != 5 {
+			t.Fatalf("incorrect upload status %+v", status)
+		}
+		job := &fileshdr.JobEvent{}
+		waitEvent(t, userEvents, events.TypeJob, job)
+		if job.Job != fileshdr.MsgTypeSha1 || job.Path != "user_1/files/a.txt" {
+			t.Fatalf("incorrect job %+v", job)
+		}
+
+		change := &fileshdr.DirChangeEvent{}
+		waitEvent(t, adminEvents, events.TypeDirChange, change)
+		if change.Op != "upload" || change.Path != "user_1/files/a.txt" {
+			t.Fatalf("incorrect change %+v", change)
+		}
+		resp, _, errs := userFilesCl.Move("user_1/files/a.txt", "user_1/files/b.txt")
+		assertResp(t, resp, errs, 200, "move")
+		waitEvent(t, adminEvents, events.TypeDirChange, change)
+		if change.Op != "move" || change.NewPath != "user_1/files/b.txt" {
+			t.Fatalf("incorrect change %+v", change)
+		}
+	})
+
+	t.Run("test broadcasts", func(t *testing.T) {
+		otherStream, otherEvents := openStream(t, otherFilesCl)
+		defer otherStream.Close()
+
+		resp, _, errs := adminFilesCl.Broadcast("maintenance at 10pm")
+		assertResp(t, resp, errs, 200, "broadcast")
+		broadcast := &fileshdr.BroadcastEvent{}
+		waitEvent(t, otherEvents, events.TypeBroadcast, broadcast)
+		if broadcast.Message != "maintenance at 10pm" || broadcast.From != adminName {
+			t.Fatalf("incorrect broadcast %+v", broadcast)
+		}
+
+		resp, _, errs = userFilesCl.Broadcast("hello")
+		assertResp(t, resp, errs, 403, "broadcast by user")
+	})
+
+	t.Run("test ending streams of revoked sessions and changed roles", func(t *testing.T) {
+		waitClosed := func(t *testing.T, received <-chan *client.StreamEvent) {
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case _, ok := <-received:
+					if !ok {
+						return
+					}
+				case <-timeout:
+					t.Fatal("stream is not ended")
+				}
+			}
+		}
+
+		userName := getUserName(3)
+		usersCl := client.NewUsersClient(addr)
+		resp, _, errs := usersCl.Login(userName, userPwd)
+		assertResp(t, resp, errs, 200, "login")
+		filesCl := client.NewFilesClient(addr, client.GetCookie(resp.Cookies(), q.TokenCookie))
+		stream, received := openStream(t, filesCl)
+		defer stream.Close()
+		resp, _, errs = usersCl.DelAllSessions()
+		assertResp(t, resp, errs, 200, "log out everywhere")
+		waitClosed(t, received)
+
+		filesCl, err := loginFilesClient(addr, userName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream, received = openStream(t, filesCl)
+		defer stream.Close()
+		userID, err := strconv.ParseUint(users[userName], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _, errs = adminUsersCli.SetUser(userID, db.BannedRole, &db.Quota{
+			SpaceLimit:         1024,
+			UploadSpeedLimit:   409600,
+			DownloadSpeedLimit: 409600,
+		})
+		assertResp(t, resp, errs, 200, "ban user")
+		waitClosed(t, received)
+	})
+
+	t.Run("test invalid streams", func(t *testing.T) {
+		resp, _, err := otherFilesCl.Events("user_1/files")
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != 403 {
+			t.Fatalf("other's folder should not be watched %d", resp.StatusCode)
+		}
+
+		// streams of the other user may not be ended yet, so another user is used
+		limitedFilesCl, err := loginFilesClient(addr, getUserName(0), userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams := []*client.EventStream{}
+		for i := 0; i < 2; i++ {
+			stream, _ := openStream(t, limitedFilesCl)
+			streams = append(streams, stream)
+		}
+		resp, _, err = limitedFilesCl.Events()
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != 429 {
+			t.Fatalf("streams should be limited %d", resp.StatusCode)
+		}
+		for _, stream := range streams {
+			stream.Close()
+		}
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
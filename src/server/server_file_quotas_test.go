@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/base64"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestFileQuotas(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	adminFilesCl := client.NewFilesClient(addr, adminToken)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 1, adminToken)
+	userName := getUserName(0)
+	userID, err := strconv.ParseUint(users[userName], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _, errs = adminUsersCli.SetUser(userID, db.UserRole, &db.Quota{
+		SpaceLimit:         1024,
+		UploadSpeedLimit:   409600,
+		DownloadSpeedLimit: 409600,
+		MaxFileCount:       2,
+		MaxFileSize:        16,
+		BlockedExts:        []string{"exe"},
+		BlockedTypes:       []string{"image/*"},
+	})
+	assertResp(t, resp, errs, 200, "set user quota")
+
+	userFilesCl, err := loginFilesClient(addr, userName, userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("test file size and types", func(t *testing.T) {
+		resp, _, errs := userFilesCl.Create("user_0/files/setup.EXE", 4)
+		assertResp(t, resp, errs, 415, "create blocked extension")
+		resp, _, errs = userFilesCl.Create("user_0/files/large", 32)
+		assertResp(t, resp, errs, 413, "create large file")
+
+		// the type is sniffed from the first chunk
+		png := "\x89PNG\r\n\x1a\n"
+		resp, _, errs = userFilesCl.Create("user_0/files/image", int64(len(png)))
+		assertResp(t, resp, errs, 200, "create image")
+		resp, _, errs = userFilesCl.UploadChunk("user_0/files/image", base64.StdEncoding.EncodeToString([]byte(png)), 0)
+		assertResp(t, resp, errs, 415, "upload blocked type")
+		resp, lsResp, errs := userFilesCl.ListUploadings()
+		assertResp(t, resp, errs, 200, "list uploadings")
+		if len(lsResp.UploadInfos) != 0 {
+			t.Fatalf("denied uploading is not removed %+v", lsResp.UploadInfos)
+		}
+
+		resp, _, errs = userFilesCl.Create("user_0/files/file1", 4)
+		assertResp(t, resp, errs, 200, "create file")
+		resp, _, errs = userFilesCl.UploadChunk("user_0/files/file1", base64.StdEncoding.EncodeToString([]byte("12345678")), 0)
+		assertResp(t, resp, errs, 400, "upload more than the file size")
+		resp, _, errs = userFilesCl.UploadChunk("user_0/files/file1", base64.StdEncoding.EncodeToString([]byte("1234")), 0)
+		assertResp(t, resp, errs, 200, "upload chunk")
+
+		resp, _, errs = userFilesCl.Move("user_0/files/file1", "user_0/files/file1.exe")
+		assertResp(t, resp, errs, 415, "rename to blocked extension")
+	})
+
+	t.Run("test file count", func(t *testing.T) {
+		assertUploadOK(t, "user_0/files/file2", "1234", addr, userFilesCl.Token())
+
+		resp, _, errs := userFilesCl.Create("user_0/files/file3", 4)
+		assertResp(t, resp, errs, 403, "create more files")
+
+		// files moved into the home are counted
+		assertUploadOK(t, "qs/files/file3", "1234", addr, adminToken)
+		resp, _, errs = adminFilesCl.Move("qs/files/file3", "user_0/files/file3")
+		assertResp(t, resp, errs, 403, "move more files")
+
+		resp, _, errs = userFilesCl.Delete("user_0/files/file2")
+		assertResp(t, resp, errs, 200, "delete file")
+		resp, _, errs = adminFilesCl.Move("qs/files/file3", "user_0/files/file3")
+		assertResp(t, resp, errs, 200, "move file")
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
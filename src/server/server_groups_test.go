@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestGroupsHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+	fs := srv.depsFS()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 3, adminToken)
+	writerName, readerName, outsiderName := getUserName(0), getUserName(1), getUserName(2)
+
+	groupName := "team"
+	var groupID uint64
+
+	t.Run("test group management", func(t *testing.T) {
+		resp, _, errs := adminUsersCli.AddGroup("a/b", nil)
+		assertResp(t, resp, errs, 400, "add invalid group")
+
+		resp, agResp, errs := adminUsersCli.AddGroup(groupName, &db.GroupQuota{SpaceLimit: 16})
+		assertResp(t, resp, errs, 200, "add group")
+		var err error
+		groupID, err = strconv.ParseUint(agResp.ID, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fs.Stat(q.GroupRootPath(groupName, "/")); err != nil {
+			t.Fatal(err)
+		}
+
+		for userName, perm := range map[string]string{
+			writerName: db.GroupPermWrite,
+			readerName: db.GroupPermRead,
+		} {
+			userID, err := strconv.ParseUint(users[userName], 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _, errs = adminUsersCli.SetGroupMember(groupID, userID, perm)
+			assertResp(t, resp, errs, 200, "set group member")
+		}
+
+		resp, lsResp, errs := adminUsersCli.ListGroupMembers(agResp.ID)
+		assertResp(t, resp, errs, 200, "list group members")
+		if len(lsResp.Members) != 2 {
+			t.Fatalf("incorrect members size (%d)", len(lsResp.Members))
+		}
+
+		usersCli := client.NewUsersClient(addr)
+		resp, _, errs = usersCli.Login(readerName, userPwd)
+		assertResp(t, resp, errs, 200, "reader login")
+		resp, myResp, errs := usersCli.ListMyGroups()
+		assertResp(t, resp, errs, 200, "list my groups")
+		if len(myResp.Groups) != 1 ||
+			myResp.Groups[0].Perm != db.GroupPermRead ||
+			myResp.Groups[0].Path != q.GroupRootPath(groupName, "/") {
+			t.Fatalf("incorrect my groups %+v", myResp.Groups)
+		}
+
+		resp, _, errs = usersCli.ListGroups()
+		assertResp(t, resp, errs, 403, "users can not list groups")
+	})
+
+	t.Run("test team folder access", func(t *testing.T) {
+		writerCl, err := loginFilesClient(addr, writerName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readerCl, err := loginFilesClient(addr, readerName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outsiderCl, err := loginFilesClient(addr, outsiderName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filePath := q.GroupRootPath(groupName, "doc")
+		content := "12345678"
+		resp, _, errs := writerCl.Create(filePath, int64(len(content)))
+		assertResp(t, resp, errs, 200, "writer creates file")
+		resp, _, errs = writerCl.UploadChunk(filePath, "MTIzNDU2Nzg=", 0)
+		assertResp(t, resp, errs, 200, "writer uploads file")
+
+		resp, _, errs = readerCl.Create(q.GroupRootPath(groupName, "doc2"), 1)
+		assertResp(t, resp, errs, 403, "reader can not create file")
+		resp, _, errs = writerCl.Create(q.GroupRootPath(groupName, "big"), 9)
+		assertResp(t, resp, errs, 403, "group quota is exceeded")
+
+		resp, lsResp, errs := readerCl.List(q.GroupRootPath(groupName, "/"))
+		assertResp(t, resp, errs, 200, "reader lists team folder")
+		if len(lsResp.Metadatas) != 1 {
+			t.Fatalf("incorrect metadata size (%d)", len(lsResp.Metadatas))
+		}
+		resp, body, errs := readerCl.Download(filePath, map[string]string{})
+		assertResp(t, resp, errs, 200, "reader downloads file")
+		if body != content {
+			t.Fatalf("content not matched (%s)", body)
+		}
+
+		resp, _, errs = outsiderCl.List(q.GroupRootPath(groupName, "/"))
+		assertResp(t, resp, errs, 403, "outsider can not list team folder")
+		resp, _, errs = readerCl.Delete(filePath)
+		assertResp(t, resp, errs, 403, "reader can not delete file")
+		resp, _, errs = writerCl.Delete(q.GroupRootPath(groupName, "/"))
+		assertResp(t, resp, errs, 403, "team folder root can not be deleted")
+
+		resp, lsGroupsResp, errs := adminUsersCli.ListGroups()
+		assertResp(t, resp, errs, 200, "list groups")
+		if len(lsGroupsResp.Groups) != 1 || lsGroupsResp.Groups[0].UsedSpace != int64(len(content)) {
+			t.Fatalf("incorrect groups %+v", lsGroupsResp.Groups)
+		}
+
+		resp, _, errs = writerCl.Delete(filePath)
+		assertResp(t, resp, errs, 200, "writer deletes file")
+		resp, lsGroupsResp, errs = adminUsersCli.ListGroups()
+		assertResp(t, resp, errs, 200, "list groups")
+		if lsGroupsResp.Groups[0].UsedSpace != 0 {
+			t.Fatalf("used space is not released (%d)", lsGroupsResp.Groups[0].UsedSpace)
+		}
+	})
+
+	t.Run("test deleting group", func(t *testing.T) {
+		resp, _, errs := adminUsersCli.DelGroup(fmt.Sprint(groupID))
+		assertResp(t, resp, errs, 200, "delete group")
+
+		resp, lsResp, errs := adminUsersCli.ListGroups()
+		assertResp(t, resp, errs, 200, "list groups")
+		if len(lsResp.Groups) != 0 {
+			t.Fatalf("incorrect groups size (%d)", len(lsResp.Groups))
+		}
+		if _, err := fs.Stat(q.GroupRootPath(groupName, "/")); !os.IsNotExist(err) {
+			t.Fatalf("team folder should be removed: %v", err)
+		}
+	})
+}
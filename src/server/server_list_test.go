@@ -0,0 +1,189 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/fileshdr"
+)
+
+func TestListHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData",
+			"listingCacheMin": 1
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 2, adminToken)
+	userFilesCl, err := loginFilesClient(addr, getUserName(1), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertUploadOK(t, "user_1/files/logs/2024/01.log", "123", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/logs/2024/02.log", "12345", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/logs/x.txt", "1", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/a.txt", "12", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/b.txt", "1234", addr, userFilesCl.Token())
+	resp, _, errs = userFilesCl.Mkdir("user_1/files/empty")
+	assertResp(t, resp, errs, 200, "mkdir")
+
+	listNames := func(t *testing.T, dirPath, itemType, sortBy, order, cursor string, limit int) ([]string, *fileshdr.ListResp) {
+		resp, listResp, errs := userFilesCl.ListPage(dirPath, itemType, sortBy, order, cursor, limit)
+		assertResp(t, resp, errs, 200, "list page")
+		names := []string{}
+		for _, metadata := range listResp.Metadatas {
+			names = append(names, metadata.Name)
+		}
+		return names, listResp
+	}
+	assertNames := func(t *testing.T, names []string, expected ...string) {
+		if len(names) != len(expected) {
+			t.Fatalf("names not matched %v %v", names, expected)
+		}
+		for i := range names {
+			if names[i] != expected[i] {
+				t.Fatalf("names not matched %v %v", names, expected)
+			}
+		}
+	}
+
+	t.Run("test pagination and sorting", func(t *testing.T) {
+		names, listResp := listNames(t, "user_1/files", "", "size", "desc", "", 2)
+		assertNames(t, names, "logs", "b.txt")
+		if listResp.Total != 4 || listResp.Cursor == "" {
+			t.Fatalf("incorrect total or cursor %d %s", listResp.Total, listResp.Cursor)
+		}
+		names, listResp = listNames(t, "user_1/files", "", "size", "desc", listResp.Cursor, 2)
+		assertNames(t, names, "a.txt", "empty")
+		if listResp.Cursor != "" {
+			t.Fatalf("cursor should be empty %s", listResp.Cursor)
+		}
+
+		names, _ = listNames(t, "user_1/files", "file", "name", "desc", "", 10)
+		assertNames(t, names, "b.txt", "a.txt")
+
+		// all items are listed without limits
+		resp, listResp, errs := userFilesCl.List("user_1/files")
+		assertResp(t, resp, errs, 200, "list")
+		if len(listResp.Metadatas) != 4 || listResp.Cursor != "" {
+			t.Fatalf("incorrect items %+v", listResp)
+		}
+	})
+
+	t.Run("test folder sizes", func(t *testing.T) {
+		assertDirs := func(t *testing.T, expected map[string][2]int64) {
+			_, listResp := listNames(t, "user_1/files", "dir", "", "", "", 10)
+			if len(listResp.Metadatas) != len(expected) {
+				t.Fatalf("dirs not matched %+v %v", listResp.Metadatas, expected)
+			}
+			for _, metadata := range listResp.Metadatas {
+				stat, ok := expected[metadata.Name]
+				if !ok || !metadata.IsDir || metadata.Size != stat[0] || metadata.FileCount != stat[1] {
+					t.Fatalf("dir not matched %+v %v", metadata, stat)
+				}
+			}
+		}
+		assertDirs(t, map[string][2]int64{"logs": {9, 3}, "empty": {0, 0}})
+
+		resp, _, errs := userFilesCl.Move("user_1/files/logs/2024", "user_1/files/archive")
+		assertResp(t, resp, errs, 200, "move folder")
+		assertDirs(t, map[string][2]int64{"logs": {1, 1}, "archive": {8, 2}, "empty": {0, 0}})
+
+		resp, _, errs = userFilesCl.Delete("user_1/files/archive/01.log")
+		assertResp(t, resp, errs, 200, "delete file")
+		assertDirs(t, map[string][2]int64{"logs": {1, 1}, "archive": {5, 1}, "empty": {0, 0}})
+	})
+
+	t.Run("test cached listings", func(t *testing.T) {
+		// folders modified in the last 2 seconds are not cached
+		time.Sleep(2500 * time.Millisecond)
+		names, _ := listNames(t, "user_1/files", "file", "name", "", "", 10)
+		assertNames(t, names, "a.txt", "b.txt")
+
+		assertUploadOK(t, "user_1/files/c.txt", "123", addr, userFilesCl.Token())
+		names, _ = listNames(t, "user_1/files", "file", "name", "", "", 10)
+		assertNames(t, names, "a.txt", "b.txt", "c.txt")
+
+		// sizes of sub folders are refreshed without changes in the cached folder
+		time.Sleep(2500 * time.Millisecond)
+		_, listResp := listNames(t, "user_1/files", "dir", "name", "", "", 10)
+		if listResp.Metadatas[1].Name != "empty" || listResp.Metadatas[1].Size != 0 {
+			t.Fatalf("dir not matched %+v", listResp.Metadatas[1])
+		}
+		assertUploadOK(t, "user_1/files/empty/d.txt", "1234", addr, userFilesCl.Token())
+		_, listResp = listNames(t, "user_1/files", "dir", "name", "", "", 10)
+		if listResp.Metadatas[1].Size != 4 || listResp.Metadatas[1].FileCount != 1 {
+			t.Fatalf("dir not matched %+v", listResp.Metadatas[1])
+		}
+
+		// items added outside quickshare change the folder's mtime
+		err := os.WriteFile(filepath.Join(rootPath, "user_1/files/e.txt"), []byte("1"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names, _ = listNames(t, "user_1/files", "file", "name", "", "", 10)
+		assertNames(t, names, "a.txt", "b.txt", "c.txt", "e.txt")
+	})
+
+	t.Run("test invalid queries", func(t *testing.T) {
+		for _, args := range [][4]string{
+			{"unknown", "", "", ""},
+			{"", "unknown", "", ""},
+			{"", "", "unknown", ""},
+			{"", "", "", "unknown"},
+		} {
+			resp, _, errs := userFilesCl.ListPage("user_1/files", args[0], args[1], args[2], args[3], 10)
+			assertResp(t, resp, errs, 400, "invalid list query")
+		}
+		resp, _, errs := userFilesCl.ListPage("user_1/files", "", "", "", "", 100000)
+		assertResp(t, resp, errs, 400, "too large limit")
+		resp, _, errs = userFilesCl.ListPage("user_0/files", "", "", "", "", 10)
+		assertResp(t, resp, errs, 403, "list other's folder")
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dchest/captcha"
+
+	"github.com/ihexxa/quickshare/src/client"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func TestLoginLimits(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": true,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000,
+			"loginMaxFailures": 4,
+			"loginLockoutSecs": 60,
+			"loginCaptchaAfter": 2,
+			"loginDelay": 1,
+			"loginIPAttempts": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	// captchas are read from the store to solve them
+	captchaStore := captcha.NewMemoryStore(captcha.CollectNum, captcha.Expiration)
+	captcha.SetCustomStore(captchaStore)
+	defer captcha.SetCustomStore(captcha.NewMemoryStore(captcha.CollectNum, captcha.Expiration))
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 2, adminToken)
+	userName, otherName := getUserName(0), getUserName(1)
+
+	solveCaptcha := func() (string, string) {
+		resp, captchaResp, errs := client.NewUsersClient(addr).GetCaptchaID()
+		assertResp(t, resp, errs, 200, "get captcha")
+		digits := captchaStore.Get(captchaResp.CaptchaID, false)
+		answer := []byte{}
+		for _, digit := range digits {
+			answer = append(answer, '0'+digit)
+		}
+		return captchaResp.CaptchaID, string(answer)
+	}
+
+	assertBody := func(body string, expected error, desc string) {
+		if !strings.Contains(body, expected.Error()) {
+			t.Fatalf("%s: expected error (%s) got (%s)", desc, expected, body)
+		}
+	}
+
+	t.Run("test captchas and lockouts", func(t *testing.T) {
+		cl := client.NewUsersClient(addr)
+		for i := 0; i < 2; i++ {
+			resp, _, errs := cl.Login(userName, "wrongpwd")
+			assertResp(t, resp, errs, 403, "login with wrong password")
+		}
+
+		// captchas are required after failures
+		resp, body, errs := cl.Login(userName, userPwd)
+		assertResp(t, resp, errs, 403, "login without captcha")
+		assertBody(body, multiusers.ErrCaptchaRequired, "login without captcha")
+		captchaID, _ := solveCaptcha()
+		resp, body, errs = cl.LoginWithCaptcha(userName, userPwd, captchaID, "000000000")
+		assertResp(t, resp, errs, 403, "login with invalid captcha")
+		assertBody(body, multiusers.ErrInvalidCaptcha, "login with invalid captcha")
+
+		for i := 0; i < 2; i++ {
+			captchaID, answer := solveCaptcha()
+			resp, _, errs := cl.LoginWithCaptcha(userName, "wrongpwd", captchaID, answer)
+			assertResp(t, resp, errs, 403, "login with captcha and wrong password")
+		}
+
+		// the user is locked even if the password is correct
+		captchaID, answer := solveCaptcha()
+		resp, body, errs = cl.LoginWithCaptcha(userName, userPwd, captchaID, answer)
+		assertResp(t, resp, errs, 429, "login when locked")
+		assertBody(body, multiusers.ErrUserLocked, "login when locked")
+		if resp.Header.Get("Retry-After") == "" {
+			t.Fatal("Retry-After is not set")
+		}
+
+		// failures of the ip also lead to captchas for other users
+		resp, body, errs = cl.Login(otherName, userPwd)
+		assertResp(t, resp, errs, 403, "other user login without captcha")
+		assertBody(body, multiusers.ErrCaptchaRequired, "other user login without captcha")
+		captchaID, answer = solveCaptcha()
+		resp, _, errs = cl.LoginWithCaptcha(otherName, userPwd, captchaID, answer)
+		assertResp(t, resp, errs, 200, "other user login with captcha")
+
+		// failed attempts are recorded for admins
+		resp, lsResp, errs := adminUsersCli.ListLoginAttempts(userName, 0)
+		assertResp(t, resp, errs, 200, "list login attempts")
+		reasons := map[string]int{}
+		for _, attempt := range lsResp.Attempts {
+			if attempt.UserName != userName || attempt.IP == "" || attempt.CreatedAt == 0 {
+				t.Fatalf("incorrect attempt %+v", attempt)
+			}
+			reasons[attempt.Reason]++
+		}
+		if reasons["invalid_password"] != 4 || reasons["invalid_captcha"] != 1 || reasons["locked"] != 1 {
+			t.Fatalf("incorrect attempts %+v", reasons)
+		}
+		resp, lsResp, errs = adminUsersCli.ListLoginAttempts("", 2)
+		assertResp(t, resp, errs, 200, "list all login attempts")
+		if len(lsResp.Attempts) != 2 {
+			t.Fatalf("incorrect attempts size %d", len(lsResp.Attempts))
+		}
+
+		// admins are able to unlock users
+		resp, _, errs = cl.UnlockUser(users[userName])
+		assertResp(t, resp, errs, 403, "unlock without token")
+		resp, _, errs = adminUsersCli.UnlockUser(users[userName])
+		assertResp(t, resp, errs, 200, "unlock user")
+		captchaID, answer = solveCaptcha()
+		resp, _, errs = cl.LoginWithCaptcha(userName, userPwd, captchaID, answer)
+		assertResp(t, resp, errs, 200, "login after unlocking")
+	})
+
+	t.Run("test non-existing users are also throttled", func(t *testing.T) {
+		cl := client.NewUsersClient(addr)
+		captchaID, answer := solveCaptcha()
+		resp, _, errs := cl.LoginWithCaptcha("nobody", userPwd, captchaID, answer)
+		assertResp(t, resp, errs, 403, "login with non-existing user")
+
+		resp, lsResp, errs := adminUsersCli.ListLoginAttempts("nobody", 0)
+		assertResp(t, resp, errs, 200, "list login attempts")
+		if len(lsResp.Attempts) != 1 || lsResp.Attempts[0].Reason != "user_not_found" {
+			t.Fatalf("incorrect attempts %+v", lsResp.Attempts)
+		}
+	})
+
+	t.Run("test users can not list login attempts", func(t *testing.T) {
+		cl := client.NewUsersClient(addr)
+		captchaID, answer := solveCaptcha()
+		resp, _, errs := cl.LoginWithCaptcha(otherName, userPwd, captchaID, answer)
+		assertResp(t, resp, errs, 200, "login")
+		resp, _, errs = cl.ListLoginAttempts("", 0)
+		assertResp(t, resp, errs, 403, "users can not list login attempts")
+	})
+}
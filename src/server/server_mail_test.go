@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/settings"
+	"github.com/ihexxa/quickshare/src/mailer/smtpstub"
+)
+
+func TestMailHandlers(t *testing.T) {
+	stub, err := smtpstub.New("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stub.Close()
+
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := fmt.Sprintf(`{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		},
+		"mail": {
+			"enabled": true,
+			"host": "127.0.0.1",
+			"port": %d,
+			"from": "noreply@quickshare.local",
+			"resetURL": "http://127.0.0.1:8686/reset",
+			"notifyUploads": true,
+			"notifyDownloads": true,
+			"quotaWarnPercent": 50
+		}
+	}`, stub.Addr().Port)
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 2, adminToken)
+	ownerName, writerName := getUserName(0), getUserName(1)
+	ownerEmail := "owner@quickshare.local"
+
+	ownerUsersCl := client.NewUsersClient(addr)
+	resp, _, errs = ownerUsersCl.Login(ownerName, userPwd)
+	assertResp(t, resp, errs, 200, "owner login")
+	resp, selfResp, errs := ownerUsersCl.Self()
+	assertResp(t, resp, errs, 200, "owner self")
+	selfResp.Preferences.Email = ownerEmail
+	resp, _, errs = ownerUsersCl.SetPreferences(selfResp.Preferences)
+	assertResp(t, resp, errs, 200, "set email")
+
+	mailCount := 0
+	waitMail := func(subject string) *smtpstub.Mail {
+		mailCount++
+		mails, err := stub.Wait(mailCount, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mail := mails[mailCount-1]
+		if len(mail.To) != 1 || mail.To[0] != ownerEmail {
+			t.Fatalf("incorrect recipients %+v", mail.To)
+		} else if !strings.Contains(mail.Data, "Subject: "+subject) {
+			t.Fatalf("incorrect mail (%s)", mail.Data)
+		}
+		return mail
+	}
+
+	t.Run("test resetting passwords", func(t *testing.T) {
+		cl := client.NewUsersClient(addr)
+		resp, _, errs := cl.ForgetPwd("nobody")
+		assertResp(t, resp, errs, 200, "unknown users are not leaked")
+		resp, _, errs = cl.ForgetPwd(writerName)
+		assertResp(t, resp, errs, 200, "users without emails are not leaked")
+
+		resp, _, errs = cl.ForgetPwd(ownerName)
+		assertResp(t, resp, errs, 200, "forget password")
+		mail := waitMail("Reset your password")
+		matches := regexp.MustCompile(`reset\?token=([0-9a-f]+)`).FindStringSubmatch(mail.Data)
+		if len(matches) != 2 {
+			t.Fatalf("reset link not found (%s)", mail.Data)
+		}
+		token := matches[1]
+
+		newPwd := "12345"
+		resp, _, errs = cl.ResetPwd("wrongtoken", newPwd)
+		assertResp(t, resp, errs, 403, "wrong token")
+		resp, _, errs = cl.ResetPwd(token, newPwd)
+		assertResp(t, resp, errs, 200, "reset password")
+		resp, _, errs = cl.ResetPwd(token, userPwd)
+		assertResp(t, resp, errs, 403, "tokens can be used only once")
+
+		resp, lsResp, errs := client.NewSettingsClient(addr, adminToken).ListAuditLogs(map[string]string{
+			settings.ActionQuery: db.AuditActionResetPwd,
+		})
+		assertResp(t, resp, errs, 200, "list audit logs")
+		if len(lsResp.Logs) != 3 ||
+			lsResp.Logs[0].Result != db.AuditResultFailed ||
+			lsResp.Logs[1].Actor != ownerName ||
+			lsResp.Logs[1].Target != users[ownerName] ||
+			lsResp.Logs[1].Result != db.AuditResultSucceeded ||
+			lsResp.Logs[2].Actor != "" ||
+			lsResp.Logs[2].Result != db.AuditResultFailed {
+			t.Fatalf("reset logs not matched %+v", lsResp.Logs)
+		}
+
+		resp, _, errs = ownerUsersCl.Self()
+		assertResp(t, resp, errs, 401, "sessions are revoked after resetting")
+		resp, _, errs = cl.Login(ownerName, newPwd)
+		assertResp(t, resp, errs, 200, "login with new password")
+		resp, _, errs = cl.SetPwd(newPwd, userPwd)
+		assertResp(t, resp, errs, 200, "set password back")
+	})
+
+	t.Run("test notifying owners and quota warnings", func(t *testing.T) {
+		ownerCl, err := loginFilesClient(addr, ownerName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writerCl, err := loginFilesClient(addr, writerName, userPwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writerID, err := strconv.ParseUint(users[writerName], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dropDir := q.FsRootPath(ownerName, "drop")
+		resp, _, errs := ownerCl.Mkdir(dropDir)
+		assertResp(t, resp, errs, 200, "owner mkdir")
+		resp, _, errs = ownerCl.SetACL(dropDir, db.ACLSubjectUser, writerID, db.ACLPermWrite)
+		assertResp(t, resp, errs, 200, "grant writer")
+
+		content := "12345678"
+		filePath := q.FsRootPath(ownerName, "drop/doc")
+		resp, _, errs = writerCl.Create(filePath, int64(len(content)))
+		assertResp(t, resp, errs, 200, "writer creates file")
+		resp, _, errs = writerCl.UploadChunk(filePath, base64.StdEncoding.EncodeToString([]byte(content)), 0)
+		assertResp(t, resp, errs, 200, "writer uploads file")
+		mail := waitMail("New file in")
+		if !strings.Contains(mail.Data, writerName) || !strings.Contains(mail.Data, filePath) {
+			t.Fatalf("incorrect upload mail (%s)", mail.Data)
+		}
+
+		resp, _, errs = writerCl.Download(filePath, map[string]string{})
+		assertResp(t, resp, errs, 200, "writer downloads file")
+		waitMail("Your file is downloaded")
+		resp, _, errs = ownerCl.Download(filePath, map[string]string{})
+		assertResp(t, resp, errs, 200, "owner downloads file")
+
+		// uploads are charged to the owner of the folder, so the owner is warned
+		bigFilePath := q.FsRootPath(ownerName, "drop/big")
+		resp, _, errs = writerCl.Create(bigFilePath, 600)
+		assertResp(t, resp, errs, 200, "writer creates big file")
+		mail = waitMail("Your space is running out")
+		if !strings.Contains(mail.Data, "of 1024 bytes") {
+			t.Fatalf("incorrect quota mail (%s)", mail.Data)
+		}
+
+		time.Sleep(200 * time.Millisecond)
+		if mails := stub.Mails(); len(mails) != mailCount {
+			t.Fatalf("unexpected mails %d", len(mails))
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/metrics"
+)
+
+func TestMetricsHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	metricsAddr := "127.0.0.1:8687"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		},
+		"metrics": {
+			"addr": "127.0.0.1:8687"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	usersCl := client.NewUsersClient(addr)
+	resp, _, errs := usersCl.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	settingsCl := client.NewSettingsClient(addr, adminToken)
+
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 1, adminToken)
+	userName := getUserName(0)
+	userFilesCl, err := loginFilesClient(addr, userName, userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertUploadOK(t, "user_0/files/a.txt", "12345", addr, userFilesCl.Token())
+	resp, _, errs = userFilesCl.Download("user_0/files/a.txt", map[string]string{})
+	assertResp(t, resp, errs, 200, "download")
+	resp, _, errs = userFilesCl.ListHome()
+	assertResp(t, resp, errs, 200, "list home")
+
+	assertMetrics := func(t *testing.T, output string) {
+		for _, line := range []string{
+			`quickshare_http_requests_total{method="GET",route="/v2/my/fs/dirs/home",status="200"} 1`,
+			`quickshare_transferred_bytes_total{direction="upload"} 5`,
+			`quickshare_transferred_bytes_total{direction="download"} 5`,
+			"quickshare_worker_queue_length ",
+			"quickshare_fs_opens ",
+			"quickshare_fs_opens_limit ",
+			`quickshare_user_used_space_bytes{user="` + userName + `"} 5`,
+			`quickshare_user_space_limit_bytes{user="` + userName + `"} 1024`,
+			`quickshare_db_queries_total{op="exec",result="succeeded"} `,
+			`quickshare_worker_jobs_total{type="sha1",result="succeeded"} `,
+		} {
+			if !strings.Contains(output, line) {
+				t.Fatalf("line not found: %s\n%s", line, output)
+			}
+		}
+	}
+
+	t.Run("test exporting metrics to admins", func(t *testing.T) {
+		var output string
+		// sha1 jobs are handled asynchronously
+		for i := 0; i < 20; i++ {
+			resp, body, errs := settingsCl.Metrics()
+			assertResp(t, resp, errs, 200, "get metrics")
+			if resp.Header.Get("Content-Type") != metrics.ContentType {
+				t.Fatalf("incorrect content type %s", resp.Header.Get("Content-Type"))
+			}
+			output = body
+			if strings.Contains(output, `quickshare_worker_jobs_total{type="sha1"`) {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		assertMetrics(t, output)
+	})
+
+	t.Run("test exporting metrics on the separate listener", func(t *testing.T) {
+		resp, err := http.Get("http://" + metricsAddr + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != 200 {
+			t.Fatalf("incorrect status %d", resp.StatusCode)
+		}
+		assertMetrics(t, string(body))
+	})
+
+	t.Run("test access control", func(t *testing.T) {
+		userSettingsCl := client.NewSettingsClient(addr, userFilesCl.Token())
+		resp, _, errs := userSettingsCl.Metrics()
+		assertResp(t, resp, errs, 403, "get metrics by user")
+	})
+
+	resp, _, errs = usersCl.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
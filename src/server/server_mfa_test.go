@@ -0,0 +1,198 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/cryptoutil/totp"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestMFAHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000,
+			"require2FAForAdmins": true
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	codeAt := func(secret string, step int64) string {
+		code, err := totp.CodeAt(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	// admins are forced to enroll before logging in
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, loginResp, errs := adminUsersCli.LoginMFA(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	if !loginResp.MFARequired || !loginResp.MFAEnrollRequired || loginResp.Token != "" {
+		t.Fatalf("2fa enrollment should be required %+v", loginResp)
+	}
+	if client.GetCookie(resp.Cookies(), q.TokenCookie) != nil {
+		t.Fatal("token should not be issued before 2fa")
+	}
+
+	resp, enrollResp, errs := adminUsersCli.EnrollMFAForLogin(loginResp.MFAToken)
+	assertResp(t, resp, errs, 200, "admin enroll")
+	resp, _, errs = adminUsersCli.MFALogin(loginResp.MFAToken, "000000x", "")
+	assertResp(t, resp, errs, 403, "admin login with invalid code")
+	resp, mfaLoginResp, errs := adminUsersCli.MFALogin(
+		loginResp.MFAToken,
+		codeAt(enrollResp.Secret, totp.Step(time.Now())),
+		"",
+	)
+	assertResp(t, resp, errs, 200, "admin finishes enrollment")
+	if len(mfaLoginResp.RecoveryCodes) != 10 || mfaLoginResp.Token == "" {
+		t.Fatalf("incorrect login resp %+v", mfaLoginResp)
+	}
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	resp, _, errs = adminUsersCli.DisableMFA(adminPwd, codeAt(enrollResp.Secret, totp.Step(time.Now())+1))
+	assertResp(t, resp, errs, 403, "required 2fa can not be disabled")
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 2, adminToken)
+	userName := getUserName(0)
+
+	t.Run("test enrolling and logging in with 2fa", func(t *testing.T) {
+		cl := client.NewUsersClient(addr)
+		resp, _, errs := cl.Login(userName, userPwd)
+		assertResp(t, resp, errs, 200, "login without 2fa")
+
+		resp, _, errs = cl.VerifyMFA("123456")
+		assertResp(t, resp, errs, 400, "verify before enrolling")
+		resp, enrollResp, errs := cl.EnrollMFA()
+		assertResp(t, resp, errs, 200, "enroll")
+		if enrollResp.Secret == "" || enrollResp.URI == "" {
+			t.Fatalf("incorrect enroll resp %+v", enrollResp)
+		}
+
+		resp, statusResp, errs := cl.GetMFAStatus()
+		assertResp(t, resp, errs, 200, "get status")
+		if statusResp.Enabled || statusResp.Required {
+			t.Fatalf("2fa should be pending %+v", statusResp)
+		}
+
+		step := totp.Step(time.Now())
+		resp, _, errs = cl.VerifyMFA(codeAt(enrollResp.Secret, step+5))
+		assertResp(t, resp, errs, 403, "verify with invalid code")
+		resp, verifyResp, errs := cl.VerifyMFA(codeAt(enrollResp.Secret, step))
+		assertResp(t, resp, errs, 200, "verify")
+		if len(verifyResp.RecoveryCodes) != 10 {
+			t.Fatalf("incorrect recovery codes %+v", verifyResp.RecoveryCodes)
+		}
+		resp, _, errs = cl.EnrollMFA()
+		assertResp(t, resp, errs, 409, "enroll again")
+
+		// the password is not enough
+		loginCl := client.NewUsersClient(addr)
+		resp, loginResp, errs := loginCl.LoginMFA(userName, userPwd)
+		assertResp(t, resp, errs, 200, "login step 1")
+		if !loginResp.MFARequired || loginResp.MFAEnrollRequired || loginResp.Token != "" {
+			t.Fatalf("2fa should be required %+v", loginResp)
+		}
+
+		// the mfa token is not a session token
+		loginCl.SetToken(&http.Cookie{Name: q.TokenCookie, Value: loginResp.MFAToken})
+		resp, _, errs = loginCl.GetMFAStatus()
+		assertResp(t, resp, errs, 401, "use mfa token as session token")
+		resp, _, errs = loginCl.MFALogin(cl.Token().Value, codeAt(enrollResp.Secret, step+1), "")
+		assertResp(t, resp, errs, 401, "use session token as mfa token")
+
+		resp, _, errs = loginCl.MFALogin(loginResp.MFAToken, codeAt(enrollResp.Secret, step), "")
+		assertResp(t, resp, errs, 403, "replay the code")
+		resp, _, errs = loginCl.MFALogin(loginResp.MFAToken, codeAt(enrollResp.Secret, step+1), "")
+		assertResp(t, resp, errs, 200, "login step 2")
+		resp, _, errs = loginCl.GetMFAStatus()
+		assertResp(t, resp, errs, 200, "get status after login")
+
+		// recovery codes are normalized and can be used only once
+		recoveryCode := strings.ToUpper(strings.ReplaceAll(verifyResp.RecoveryCodes[0], "-", ""))
+		resp, _, errs = loginCl.MFALogin(loginResp.MFAToken, "", recoveryCode)
+		assertResp(t, resp, errs, 200, "login with recovery code")
+		resp, _, errs = loginCl.MFALogin(loginResp.MFAToken, "", verifyResp.RecoveryCodes[0])
+		assertResp(t, resp, errs, 403, "reuse recovery code")
+
+		resp, statusResp, errs = loginCl.GetMFAStatus()
+		assertResp(t, resp, errs, 200, "get status")
+		if !statusResp.Enabled || statusResp.RecoveryCodesLeft != 9 {
+			t.Fatalf("incorrect status %+v", statusResp)
+		}
+
+		// admins can reset 2fa for users who lost their devices
+		resp, _, errs = adminUsersCli.ResetUserMFA(users[userName])
+		assertResp(t, resp, errs, 200, "reset user 2fa")
+		resp, _, errs = loginCl.GetMFAStatus()
+		assertResp(t, resp, errs, 401, "sessions are revoked after resetting")
+		resp, loginResp, errs = loginCl.LoginMFA(userName, userPwd)
+		assertResp(t, resp, errs, 200, "login after resetting")
+		if loginResp.MFARequired || loginResp.Token == "" {
+			t.Fatalf("2fa should be removed %+v", loginResp)
+		}
+	})
+
+	t.Run("test disabling 2fa", func(t *testing.T) {
+		cl := client.NewUsersClient(addr)
+		resp, _, errs := cl.Login(getUserName(1), userPwd)
+		assertResp(t, resp, errs, 200, "login")
+
+		resp, _, errs = cl.DisableMFA(userPwd, "123456")
+		assertResp(t, resp, errs, 400, "disable before enrolling")
+		resp, enrollResp, errs := cl.EnrollMFA()
+		assertResp(t, resp, errs, 200, "enroll")
+		step := totp.Step(time.Now())
+		resp, _, errs = cl.VerifyMFA(codeAt(enrollResp.Secret, step))
+		assertResp(t, resp, errs, 200, "verify")
+
+		resp, _, errs = cl.DisableMFA("wrongpwd", codeAt(enrollResp.Secret, step+1))
+		assertResp(t, resp, errs, 403, "disable with wrong password")
+		resp, _, errs = cl.DisableMFA(userPwd, codeAt(enrollResp.Secret, step))
+		assertResp(t, resp, errs, 403, "disable with used code")
+		resp, _, errs = cl.DisableMFA(userPwd, codeAt(enrollResp.Secret, step+1))
+		assertResp(t, resp, errs, 200, "disable")
+
+		resp, statusResp, errs := cl.GetMFAStatus()
+		assertResp(t, resp, errs, 200, "get status")
+		if statusResp.Enabled {
+			t.Fatalf("2fa should be disabled %+v", statusResp)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/oidc/oidctest"
+)
+
+func TestOIDCHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	clientID, clientSecret := "quickshare", "oidc-secret"
+	postLoginPath := "/post-login"
+
+	idp, err := oidctest.NewIdP(clientID, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	config := fmt.Sprintf(`{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000,
+			"oidc": {
+				"enabled": true,
+				"issuer": "%s",
+				"clientID": "%s",
+				"clientSecret": "%s",
+				"redirectURL": "%s/v2/public/oidc/callback",
+				"roleClaim": "groups",
+				"roleMapping": {"qs-admins": "admin"},
+				"autoProvision": true,
+				"linkExisting": true,
+				"postLoginURL": "%s"
+			}
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`, idp.Issuer(), clientID, clientSecret, addr, postLoginPath)
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 1, adminToken)
+	existingName := getUserName(0)
+
+	// ssoLogin walks through the redirects and returns the last response from quickshare
+	ssoLogin := func(claims map[string]interface{}) *http.Response {
+		idp.SetClaims(claims)
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpCl := &http.Client{
+			Jar: jar,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if req.URL.Path == postLoginPath {
+					return http.ErrUseLastResponse
+				}
+				return nil
+			},
+		}
+		resp, err := httpCl.Get(addr + "/v2/public/oidc/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	selfOf := func(resp *http.Response) (string, string) {
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("sso login failed (%d)", resp.StatusCode)
+		}
+		usersCl := client.NewUsersClient(addr)
+		usersCl.SetToken(client.GetCookie(resp.Cookies(), q.TokenCookie))
+		selfResp, self, errs := usersCl.Self()
+		assertResp(t, selfResp, errs, 200, "self")
+		return self.Name, self.Role
+	}
+
+	t.Run("test provisioning and role mapping", func(t *testing.T) {
+		name, role := selfOf(ssoLogin(map[string]interface{}{
+			"sub":                "alice-id",
+			"preferred_username": "alice",
+			"groups":             []string{"staff"},
+		}))
+		if name != "alice" || role != db.UserRole {
+			t.Fatalf("user not matched (%s, %s)", name, role)
+		}
+
+		// users are identified by subjects and roles follow the claims
+		name, role = selfOf(ssoLogin(map[string]interface{}{
+			"sub":                "alice-id",
+			"preferred_username": "alice-renamed",
+			"groups":             []string{"staff", "qs-admins"},
+		}))
+		if name != "alice" || role != db.AdminRole {
+			t.Fatalf("user not matched (%s, %s)", name, role)
+		}
+
+		resp, lsResp, errs := adminUsersCli.ListUsers()
+		assertResp(t, resp, errs, 200, "list users")
+		found := 0
+		for _, user := range lsResp.Users {
+			if user.Name == "alice" || user.Name == "alice-renamed" {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Fatalf("user should be provisioned once (%d)", found)
+		}
+	})
+
+	t.Run("test linking existing users", func(t *testing.T) {
+		setEmail := func(usersCl *client.UsersClient, email string) {
+			resp, selfResp, errs := usersCl.Self()
+			assertResp(t, resp, errs, 200, "self")
+			selfResp.Preferences.Email = email
+			resp, _, errs = usersCl.SetPreferences(selfResp.Preferences)
+			assertResp(t, resp, errs, 200, "set email")
+		}
+		existingEmail := "existing@quickshare.local"
+		usersCl := client.NewUsersClient(addr)
+		resp, _, errs := usersCl.Login(existingName, userPwd)
+		assertResp(t, resp, errs, 200, "password login")
+		setEmail(usersCl, existingEmail)
+
+		// names could be taken freely in identity providers, so verified emails must match
+		for _, claims := range []map[string]interface{}{
+			{"sub": "existing-id", "preferred_username": existingName},
+			{"sub": "existing-id", "preferred_username": existingName, "email": existingEmail},
+			{"sub": "existing-id", "preferred_username": existingName, "email": existingEmail, "email_verified": false},
+			{"sub": "existing-id", "preferred_username": existingName, "email": "other@quickshare.local", "email_verified": true},
+		} {
+			resp := ssoLogin(claims)
+			if resp.StatusCode != http.StatusConflict {
+				t.Fatalf("user should not be linked (%d) %+v", resp.StatusCode, claims)
+			}
+		}
+
+		name, role := selfOf(ssoLogin(map[string]interface{}{
+			"sub":                "existing-id",
+			"preferred_username": existingName,
+			"email":              "Existing@quickshare.local",
+			"email_verified":     true,
+		}))
+		if name != existingName || role != db.UserRole {
+			t.Fatalf("user not matched (%s, %s)", name, role)
+		}
+
+		// the password login still works
+		resp, _, errs = client.NewUsersClient(addr).Login(existingName, userPwd)
+		assertResp(t, resp, errs, 200, "password login")
+
+		// admins are never linked
+		adminEmail := "admin@quickshare.local"
+		setEmail(adminUsersCli, adminEmail)
+		resp = ssoLogin(map[string]interface{}{
+			"sub":                "admin-id",
+			"preferred_username": adminName,
+			"email":              adminEmail,
+			"email_verified":     true,
+		})
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("admin should not be linked (%d)", resp.StatusCode)
+		}
+	})
+
+	t.Run("test invalid callbacks", func(t *testing.T) {
+		resp := ssoLogin(map[string]interface{}{
+			"sub":                "invalid-id",
+			"preferred_username": "x",
+		})
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("invalid user name should be rejected (%d)", resp.StatusCode)
+		}
+
+		resp, err := http.Get(addr + "/v2/public/oidc/callback?code=abc&state=forged")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("state should be verified (%d)", resp.StatusCode)
+		}
+	})
+}
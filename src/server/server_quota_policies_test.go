@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+)
+
+func TestQuotaPoliciesHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+
+	userIDs := []uint64{}
+	for i := 0; i < 3; i++ {
+		resp, addResp, errs := adminUsersCli.AddUser(getUserName(i), "1234", db.UserRole)
+		assertResp(t, resp, errs, 200, "add user")
+		userID, err := strconv.ParseUint(addResp.ID, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	getQuotas := func() map[uint64]*db.Quota {
+		resp, lsResp, errs := adminUsersCli.ListUsers()
+		assertResp(t, resp, errs, 200, "list users")
+		quotas := map[uint64]*db.Quota{}
+		for _, user := range lsResp.Users {
+			quotas[user.ID] = user.Quota
+		}
+		return quotas
+	}
+	assertSpaceLimits := func(desc string, expected []int64) {
+		quotas := getQuotas()
+		for i, userID := range userIDs {
+			if quotas[userID].SpaceLimit != expected[i] {
+				t.Fatalf("%s: user(%d) space limit not matched %d %d", desc, i, quotas[userID].SpaceLimit, expected[i])
+			}
+		}
+	}
+
+	roleQuota := &db.Quota{SpaceLimit: 4096, UploadSpeedLimit: 409600, DownloadSpeedLimit: 409600}
+	groupQuota := &db.Quota{SpaceLimit: 8192, UploadSpeedLimit: 409600, DownloadSpeedLimit: 409600}
+	userQuota := &db.Quota{SpaceLimit: 2048, UploadSpeedLimit: 409600, DownloadSpeedLimit: 409600}
+
+	t.Run("test role policies", func(t *testing.T) {
+		assertSpaceLimits("default", []int64{1024, 1024, 1024})
+
+		resp, qpResp, errs := adminUsersCli.SetQuotaPolicy(db.QuotaPolicyRole, db.UserRole, roleQuota)
+		assertResp(t, resp, errs, 200, "set role policy")
+		if qpResp.Updated != 3 {
+			t.Fatalf("updated users not matched %d", qpResp.Updated)
+		}
+		assertSpaceLimits("role policy", []int64{4096, 4096, 4096})
+
+		// new users inherit the policy
+		resp, addResp, errs := adminUsersCli.AddUser(getUserName(3), "1234", db.UserRole)
+		assertResp(t, resp, errs, 200, "add user")
+		userID, err := strconv.ParseUint(addResp.ID, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quota := getQuotas()[userID]; quota.SpaceLimit != 4096 {
+			t.Fatalf("new user's quota not matched %+v", quota)
+		}
+
+		resp, _, errs = adminUsersCli.SetQuotaPolicy(db.QuotaPolicyRole, "nobody", roleQuota)
+		assertResp(t, resp, errs, 404, "set policy for non-existing role")
+		resp, _, errs = adminUsersCli.SetQuotaPolicy("site", "", roleQuota)
+		assertResp(t, resp, errs, 400, "set policy with invalid type")
+	})
+
+	t.Run("test group policies and overrides", func(t *testing.T) {
+		resp, addResp, errs := adminUsersCli.AddGroup("team", &db.GroupQuota{SpaceLimit: 1024})
+		assertResp(t, resp, errs, 200, "add group")
+		groupID, err := strconv.ParseUint(addResp.ID, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _, errs = adminUsersCli.SetGroupMember(groupID, userIDs[1], db.GroupPermRead)
+		assertResp(t, resp, errs, 200, "set group member")
+
+		resp, _, errs = adminUsersCli.SetQuotaPolicy(db.QuotaPolicyGroup, fmt.Sprint(groupID), groupQuota)
+		assertResp(t, resp, errs, 200, "set group policy")
+		assertSpaceLimits("group policy", []int64{4096, 8192, 4096})
+
+		// quotas set by SetUser are kept as overrides
+		resp, _, errs = adminUsersCli.SetUser(userIDs[2], db.UserRole, userQuota)
+		assertResp(t, resp, errs, 200, "set user")
+		resp, _, errs = adminUsersCli.SetQuotaPolicy(db.QuotaPolicyRole, db.UserRole, &db.Quota{
+			SpaceLimit:         16384,
+			UploadSpeedLimit:   409600,
+			DownloadSpeedLimit: 409600,
+		})
+		assertResp(t, resp, errs, 200, "update role policy")
+		assertSpaceLimits("override", []int64{16384, 8192, 2048})
+
+		resp, lsResp, errs := adminUsersCli.ListQuotaPolicies()
+		assertResp(t, resp, errs, 200, "list policies")
+		if len(lsResp.Policies) != 3 || lsResp.Default.SpaceLimit != 1024 {
+			t.Fatalf("policies not matched %+v", lsResp)
+		}
+
+		resp, _, errs = adminUsersCli.DelQuotaPolicy(db.QuotaPolicyUser, fmt.Sprint(userIDs[2]))
+		assertResp(t, resp, errs, 200, "delete override")
+		resp, _, errs = adminUsersCli.DelGroup(addResp.ID)
+		assertResp(t, resp, errs, 200, "delete group")
+		assertSpaceLimits("after deleting", []int64{16384, 16384, 16384})
+
+		resp, _, errs = adminUsersCli.DelQuotaPolicy(db.QuotaPolicyRole, db.UserRole)
+		assertResp(t, resp, errs, 200, "delete role policy")
+		assertSpaceLimits("fallback", []int64{1024, 1024, 1024})
+		resp, _, errs = adminUsersCli.DelQuotaPolicy(db.QuotaPolicyRole, db.UserRole)
+		assertResp(t, resp, errs, 404, "delete deleted policy")
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func TestRegistrationHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000,
+			"registration": "approval"
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+
+	register := func(name, pwd, code string) (*multiusers.RegisterResp, int) {
+		cl := client.NewUsersClient(addr)
+		resp, regResp, errs := cl.Register(&multiusers.RegisterReq{
+			Name:       name,
+			Pwd:        pwd,
+			InviteCode: code,
+		})
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		return regResp, resp.StatusCode
+	}
+	login := func(name, pwd string) int {
+		cl := client.NewUsersClient(addr)
+		resp, _, errs := cl.Login(name, pwd)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		return resp.StatusCode
+	}
+
+	t.Run("test registration mode", func(t *testing.T) {
+		cl := client.NewUsersClient(addr)
+		resp, regResp, errs := cl.GetRegistration()
+		assertResp(t, resp, errs, 200, "get registration mode")
+		if regResp.Mode != multiusers.RegistrationApproval {
+			t.Fatalf("incorrect mode (%s)", regResp.Mode)
+		}
+	})
+
+	t.Run("test approving and rejecting registrations", func(t *testing.T) {
+		regResp, code := register("pendinguser", "1234", "")
+		if code != 200 || !regResp.Pending {
+			t.Fatalf("registration failed (%d) %+v", code, regResp)
+		}
+		rejectedResp, code := register("rejecteduser", "1234", "")
+		if code != 200 || !rejectedResp.Pending {
+			t.Fatalf("registration failed (%d) %+v", code, rejectedResp)
+		}
+		if _, code = register("pendinguser", "1234", ""); code != 409 {
+			t.Fatalf("name should be taken (%d)", code)
+		}
+		if _, code = register("x", "1234", ""); code != 400 {
+			t.Fatalf("invalid name should be rejected (%d)", code)
+		}
+
+		if code = login("pendinguser", "1234"); code != 403 {
+			t.Fatalf("pending user should not log in (%d)", code)
+		}
+
+		resp, lsResp, errs := adminUsersCli.ListPendingUsers()
+		assertResp(t, resp, errs, 200, "list pending users")
+		if len(lsResp.Users) != 2 {
+			t.Fatalf("incorrect pending users %+v", lsResp.Users)
+		}
+
+		resp, _, errs = adminUsersCli.DelUser(rejectedResp.ID)
+		assertResp(t, resp, errs, 200, "reject the user")
+		var pendingID uint64
+		for _, user := range lsResp.Users {
+			if user.Name == "pendinguser" {
+				pendingID = user.ID
+			}
+		}
+		resp, _, errs = adminUsersCli.ApproveUser(pendingID, "")
+		assertResp(t, resp, errs, 200, "approve the user")
+		resp, _, errs = adminUsersCli.ApproveUser(pendingID, "")
+		assertResp(t, resp, errs, 400, "approve the user twice")
+
+		if code = login("pendinguser", "1234"); code != 200 {
+			t.Fatalf("approved user should log in (%d)", code)
+		}
+		if code = login("rejecteduser", "1234"); code != 403 {
+			t.Fatalf("rejected user should not log in (%d)", code)
+		}
+
+		resp, lsResp, errs = adminUsersCli.ListPendingUsers()
+		assertResp(t, resp, errs, 200, "list pending users")
+		if len(lsResp.Users) != 0 {
+			t.Fatalf("pending users should be handled %+v", lsResp.Users)
+		}
+	})
+
+	t.Run("test registering with invite codes", func(t *testing.T) {
+		quota := &db.Quota{
+			SpaceLimit:         2048,
+			UploadSpeedLimit:   409600,
+			DownloadSpeedLimit: 409600,
+		}
+		resp, inviteResp, errs := adminUsersCli.AddInvite(db.UserRole, quota, 1, 0)
+		assertResp(t, resp, errs, 200, "add invite")
+		resp, _, errs = adminUsersCli.AddInvite(db.PendingRole, nil, 1, 0)
+		assertResp(t, resp, errs, 400, "pending invite")
+		resp, _, errs = adminUsersCli.AddInvite(db.UserRole, nil, 1, 1)
+		assertResp(t, resp, errs, 400, "expired invite")
+
+		if _, code := register("inviteduser", "1234", "wrongcode"); code != 403 {
+			t.Fatalf("invalid code should be rejected (%d)", code)
+		}
+		regResp, code := register("inviteduser", "1234", inviteResp.Code)
+		if code != 200 || regResp.Pending {
+			t.Fatalf("invited user should not be pending (%d) %+v", code, regResp)
+		}
+		if _, code = register("inviteduser2", "1234", inviteResp.Code); code != 403 {
+			t.Fatalf("used up code should be rejected (%d)", code)
+		}
+
+		invitedCl := client.NewUsersClient(addr)
+		resp, _, errs = invitedCl.Login("inviteduser", "1234")
+		assertResp(t, resp, errs, 200, "invited user login")
+		resp, selfResp, errs := invitedCl.Self()
+		assertResp(t, resp, errs, 200, "invited user self")
+		if selfResp.Role != db.UserRole || selfResp.Quota.SpaceLimit != 2048 {
+			t.Fatalf("invite is not applied %+v", selfResp)
+		}
+
+		resp, lsResp, errs := adminUsersCli.ListInvites()
+		assertResp(t, resp, errs, 200, "list invites")
+		if len(lsResp.Invites) != 1 || lsResp.Invites[0].Used != 1 {
+			t.Fatalf("incorrect invites %+v", lsResp.Invites)
+		}
+		resp, _, errs = adminUsersCli.DelInvite(inviteResp.ID)
+		assertResp(t, resp, errs, 200, "delete invite")
+		resp, _, errs = adminUsersCli.DelInvite(inviteResp.ID)
+		assertResp(t, resp, errs, 404, "delete invite twice")
+
+		resp, _, errs = invitedCl.AddInvite(db.UserRole, nil, 1, 0)
+		assertResp(t, resp, errs, 403, "users can not add invites")
+	})
+}
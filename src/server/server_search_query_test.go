@@ -0,0 +1,227 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestSearchQueryHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	adminFilesCl := client.NewFilesClient(addr, adminToken)
+
+	// "user_1" is a prefix of "user_10"
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 11, adminToken)
+	userName, otherName := getUserName(1), getUserName(10)
+	userFilesCl, err := loginFilesClient(addr, userName, userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFilesCl, err := loginFilesClient(addr, otherName, userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertUploadOK(t, "user_1/files/docs/a.pdf", "12345678", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/docs/b.pdf", "1234", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/c.txt", "123456", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_1/files/d.pdf", "12", addr, userFilesCl.Token())
+	assertUploadOK(t, "user_10/files/e.pdf", "123", addr, otherFilesCl.Token())
+	assertUploadOK(t, "user_10/files/shared/f.pdf", "1", addr, otherFilesCl.Token())
+
+	queryPaths := func(t *testing.T, cl *client.FilesClient, query string) []string {
+		resp, queryResp, errs := cl.QueryItems(query, "", "", "", 100)
+		assertResp(t, resp, errs, 200, "query items")
+		paths := []string{}
+		for _, item := range queryResp.Results {
+			paths = append(paths, item.Path)
+		}
+		return paths
+	}
+	assertPaths := func(t *testing.T, paths []string, expected ...string) {
+		sort.Strings(paths)
+		sort.Strings(expected)
+		if len(paths) != len(expected) {
+			t.Fatalf("paths not matched %v %v", paths, expected)
+		}
+		for i := range paths {
+			if paths[i] != expected[i] {
+				t.Fatalf("paths not matched %v %v", paths, expected)
+			}
+		}
+	}
+
+	t.Run("test filters", func(t *testing.T) {
+		assertPaths(t, queryPaths(t, userFilesCl, "ext:pdf"),
+			"user_1/files/docs/a.pdf", "user_1/files/docs/b.pdf", "user_1/files/d.pdf")
+		assertPaths(t, queryPaths(t, userFilesCl, "ext:pdf,txt size:>=4B"),
+			"user_1/files/docs/a.pdf", "user_1/files/docs/b.pdf", "user_1/files/c.txt")
+		assertPaths(t, queryPaths(t, userFilesCl, "is:dir"), "user_1/files/docs")
+		assertPaths(t, queryPaths(t, userFilesCl, "ext:pdf in:user_1/files/docs modified:1d"),
+			"user_1/files/docs/a.pdf", "user_1/files/docs/b.pdf")
+		assertPaths(t, queryPaths(t, adminFilesCl, "ext:pdf size:<=3B"),
+			"user_1/files/d.pdf", "user_10/files/e.pdf", "user_10/files/shared/f.pdf")
+
+		// sha1 is generated asynchronously
+		for i := 0; ; i++ {
+			paths := queryPaths(t, userFilesCl, "sha1:7c222fb2927d828af22f592134e8932480637c0d")
+			if len(paths) == 1 && paths[0] == "user_1/files/docs/a.pdf" {
+				break
+			} else if i >= 50 {
+				t.Fatalf("sha1 not matched %v", paths)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		for _, query := range []string{"", "owner:qs", "size:>x", `name:"a`} {
+			resp, _, errs := userFilesCl.QueryItems(query, "", "", "", 10)
+			assertResp(t, resp, errs, 400, "invalid query")
+		}
+		resp, _, errs := userFilesCl.QueryItems("ext:pdf", "owner", "", "", 10)
+		assertResp(t, resp, errs, 400, "invalid sorting key")
+	})
+
+	t.Run("test sorting and pagination", func(t *testing.T) {
+		sizes := []int64{}
+		cursor := ""
+		for {
+			resp, queryResp, errs := userFilesCl.QueryItems("is:file", "size", "desc", cursor, 3)
+			assertResp(t, resp, errs, 200, "query items")
+			for _, item := range queryResp.Results {
+				sizes = append(sizes, item.Size)
+			}
+			if queryResp.Cursor == "" {
+				break
+			}
+			cursor = queryResp.Cursor
+		}
+		expected := []int64{8, 6, 4, 2}
+		if len(sizes) != len(expected) {
+			t.Fatalf("sizes not matched %v", sizes)
+		}
+		for i := range sizes {
+			if sizes[i] != expected[i] {
+				t.Fatalf("sizes not matched %v", sizes)
+			}
+		}
+
+		resp, _, errs := userFilesCl.QueryItems("is:file", "name", "desc", cursor, 3)
+		assertResp(t, resp, errs, 400, "cursor for another order")
+
+		// files are listed in the order of uploading, folders have mod times of their latest files
+		// and they go first as their paths are smaller
+		paths := []string{}
+		cursor = ""
+		for {
+			resp, queryResp, errs := userFilesCl.QueryItems("in:user_1/files", "modTime", "asc", cursor, 2)
+			assertResp(t, resp, errs, 200, "query items")
+			for _, item := range queryResp.Results {
+				paths = append(paths, item.Path)
+			}
+			if queryResp.Cursor == "" {
+				break
+			}
+			cursor = queryResp.Cursor
+		}
+		expectedPaths := []string{
+			"user_1/files/docs/a.pdf",
+			"user_1/files/docs",
+			"user_1/files/docs/b.pdf",
+			"user_1/files/c.txt",
+			"user_1/files/d.pdf",
+		}
+		if len(paths) != len(expectedPaths) {
+			t.Fatalf("paths not matched %v", paths)
+		}
+		for i := range paths {
+			if paths[i] != expectedPaths[i] {
+				t.Fatalf("paths not matched %v", paths)
+			}
+		}
+
+		// files not uploaded through quickshare are not recorded
+		err := os.WriteFile(filepath.Join(rootPath, "user_1/files/external.pdf"), []byte("1"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPaths(t, queryPaths(t, userFilesCl, "external"))
+	})
+
+	t.Run("test access", func(t *testing.T) {
+		assertPaths(t, queryPaths(t, userFilesCl, "e.pdf"))
+		assertPaths(t, queryPaths(t, userFilesCl, "in:user_10/files"))
+		assertPaths(t, queryPaths(t, otherFilesCl, "a.pdf"))
+
+		resp, agResp, errs := adminUsersCli.AddGroup("team", nil)
+		assertResp(t, resp, errs, 200, "add group")
+		groupID, err := strconv.ParseUint(agResp.ID, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		userID, err := strconv.ParseUint(users[userName], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _, errs = adminUsersCli.SetGroupMember(groupID, userID, db.GroupPermRead)
+		assertResp(t, resp, errs, 200, "set group member")
+		assertUploadOK(t, q.GroupRootPath("team", "g.pdf"), "1", addr, adminToken)
+
+		resp, _, errs = otherFilesCl.SetACL("user_10/files/shared", db.ACLSubjectUser, userID, db.ACLPermRead)
+		assertResp(t, resp, errs, 200, "share folder")
+
+		assertPaths(t, queryPaths(t, userFilesCl, "ext:pdf size:1B"),
+			q.GroupRootPath("team", "g.pdf"), "user_10/files/shared/f.pdf")
+		assertPaths(t, queryPaths(t, otherFilesCl, "ext:pdf size:1B"), "user_10/files/shared/f.pdf")
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestSessionsHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 1, adminToken)
+	userName := getUserName(0)
+
+	login := func(desc string) *client.UsersClient {
+		cl := client.NewUsersClient(addr)
+		resp, _, errs := cl.Login(userName, userPwd)
+		assertResp(t, resp, errs, 200, desc)
+		return cl
+	}
+
+	t.Run("test listing and revoking sessions", func(t *testing.T) {
+		phoneCl, laptopCl := login("phone login"), login("laptop login")
+
+		resp, lsResp, errs := phoneCl.ListSessions()
+		assertResp(t, resp, errs, 200, "list sessions")
+		if len(lsResp.Sessions) != 2 {
+			t.Fatalf("incorrect sessions size (%d)", len(lsResp.Sessions))
+		}
+		laptopSessionID := ""
+		currentCount := 0
+		for _, session := range lsResp.Sessions {
+			if session.Current {
+				currentCount++
+			} else {
+				laptopSessionID = session.ID
+			}
+			if session.IP == "" || session.LastSeen == 0 {
+				t.Fatalf("session info is missing %+v", session)
+			}
+		}
+		if currentCount != 1 {
+			t.Fatalf("incorrect current sessions (%d)", currentCount)
+		}
+
+		resp, _, errs = adminUsersCli.DelSession(laptopSessionID)
+		assertResp(t, resp, errs, 404, "others can not revoke the session")
+		resp, _, errs = phoneCl.DelSession(laptopSessionID)
+		assertResp(t, resp, errs, 200, "revoke the laptop session")
+		resp, _, errs = laptopCl.Self()
+		assertResp(t, resp, errs, 401, "revoked session")
+		resp, _, errs = phoneCl.Self()
+		assertResp(t, resp, errs, 200, "current session is kept")
+
+		resp, _, errs = phoneCl.Logout()
+		assertResp(t, resp, errs, 200, "logout")
+		resp, _, errs = phoneCl.Self()
+		assertResp(t, resp, errs, 401, "token is revoked after logging out")
+	})
+
+	t.Run("test logging out everywhere", func(t *testing.T) {
+		phoneCl, laptopCl := login("phone login"), login("laptop login")
+
+		resp, _, errs := phoneCl.DelAllSessions()
+		assertResp(t, resp, errs, 200, "log out everywhere")
+		for desc, cl := range map[string]*client.UsersClient{"phone": phoneCl, "laptop": laptopCl} {
+			resp, _, errs = cl.Self()
+			assertResp(t, resp, errs, 401, desc)
+		}
+	})
+
+	t.Run("test invalidation on password and role changes", func(t *testing.T) {
+		phoneCl, laptopCl := login("phone login"), login("laptop login")
+
+		newPwd := "12345"
+		resp, _, errs := phoneCl.SetPwd(userPwd, newPwd)
+		assertResp(t, resp, errs, 200, "set password")
+		resp, _, errs = laptopCl.Self()
+		assertResp(t, resp, errs, 401, "other sessions are revoked")
+		resp, _, errs = phoneCl.Self()
+		assertResp(t, resp, errs, 200, "current device gets a new session")
+		resp, _, errs = phoneCl.SetPwd(newPwd, userPwd)
+		assertResp(t, resp, errs, 200, "set password back")
+
+		userID, err := strconv.ParseUint(users[userName], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		quota := &db.Quota{
+			SpaceLimit:         1024,
+			UploadSpeedLimit:   409600,
+			DownloadSpeedLimit: 409600,
+		}
+		resp, _, errs = adminUsersCli.SetUser(userID, db.UserRole, quota)
+		assertResp(t, resp, errs, 200, "set quota only")
+		resp, _, errs = phoneCl.Self()
+		assertResp(t, resp, errs, 200, "sessions are kept if the role is not changed")
+
+		resp, _, errs = adminUsersCli.SetUser(userID, db.BannedRole, quota)
+		assertResp(t, resp, errs, 200, "ban the user")
+		resp, _, errs = phoneCl.Self()
+		assertResp(t, resp, errs, 401, "banned user is logged out")
+
+		resp, _, errs = adminUsersCli.SetUser(userID, db.UserRole, quota)
+		assertResp(t, resp, errs, 200, "unban the user")
+		phoneCl = login("login again")
+		resp, _, errs = adminUsersCli.DelUserSessions(users[userName])
+		assertResp(t, resp, errs, 200, "admin revokes sessions")
+		resp, _, errs = phoneCl.Self()
+		assertResp(t, resp, errs, 401, "sessions are revoked by admin")
+	})
+}
@@ -92,13 +92,6 @@ func TestSpaceLimit(t *testing.T) {
 		users[userName] = adResp.ID
 	}
 
-	resp, _, errs = adminUsersCli.Logout()
-	if len(errs) > 0 {
-		t.Fatal(errs)
-	} else if resp.StatusCode != 200 {
-		t.Fatal(resp.StatusCode)
-	}
-
 	t.Run("test space limiting: Upload", func(t *testing.T) {
 		usersCli := client.NewUsersClient(addr)
 		resp, _, errs := usersCli.Login(getUserName(0), userPwd)
@@ -290,4 +283,12 @@ func TestSpaceLimit(t *testing.T) {
 			t.Fatalf("used space not equal %d %d", selfResp.UsedSpace, originalUsedSpace)
 		}
 	})
+
+	// logging out revokes adminToken, so it is done in the end
+	resp, _, errs = adminUsersCli.Logout()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	} else if resp.StatusCode != 200 {
+		t.Fatal(resp.StatusCode)
+	}
 }
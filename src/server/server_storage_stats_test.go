@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/csv"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	q "github.com/ihexxa/quickshare/src/handlers"
+)
+
+func TestStorageStatsHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	adminFilesCl := client.NewFilesClient(addr, adminToken)
+
+	userPwd := "1234"
+	users := addUsers(t, addr, userPwd, 1, adminToken)
+	userName := getUserName(0)
+	userFilesCl, err := loginFilesClient(addr, userName, userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertUploadOK(t, "qs/files/a/f1", "12345678", addr, adminToken)
+	assertUploadOK(t, "qs/files/f2", "1234", addr, adminToken)
+	assertUploadOK(t, "user_0/files/f3", "12345678", addr, userFilesCl.Token())
+	resp, _, errs = userFilesCl.Create("user_0/files/f4", 16)
+	assertResp(t, resp, errs, 200, "create uploading")
+
+	t.Run("test usages", func(t *testing.T) {
+		resp, usersResp, errs := adminFilesCl.ListUserUsages()
+		assertResp(t, resp, errs, 200, "list user usages")
+		usages := map[string]int64{}
+		for _, usage := range usersResp.Users {
+			usages[usage.Name] = usage.FileSize
+			if usage.Name == userName && (usage.UsedSpace != 24 || usage.FileCount != 1) {
+				t.Fatalf("user usage not matched %+v", usage)
+			}
+		}
+		if len(usages) != 2 || usages[adminName] != 12 || usages[userName] != 8 {
+			t.Fatalf("user usages not matched %+v", usages)
+		}
+
+		resp, foldersResp, errs := adminFilesCl.ListFolderUsages("qs/files")
+		assertResp(t, resp, errs, 200, "list folder usages")
+		if len(foldersResp.Folders) != 2 || foldersResp.Folders[0].Path != "qs/files/a" || foldersResp.Folders[0].Size != 8 {
+			t.Fatalf("folder usages not matched %+v", foldersResp.Folders)
+		}
+
+		resp, largestResp, errs := adminFilesCl.ListLargestFiles(2)
+		assertResp(t, resp, errs, 200, "list largest files")
+		if len(largestResp.Files) != 2 || largestResp.Files[0].Size != 8 || largestResp.Files[1].Size != 8 {
+			t.Fatalf("largest files not matched %+v", largestResp.Files)
+		}
+
+		resp, staleResp, errs := adminFilesCl.ListStaleUploadings(0)
+		assertResp(t, resp, errs, 200, "list stale uploadings")
+		if len(staleResp.Uploadings) != 1 || staleResp.Uploadings[0].RealFilePath != "user_0/files/f4" {
+			t.Fatalf("stale uploadings not matched %+v", staleResp.Uploadings)
+		}
+		resp, staleResp, errs = adminFilesCl.ListStaleUploadings(24)
+		assertResp(t, resp, errs, 200, "list stale uploadings")
+		if len(staleResp.Uploadings) != 0 {
+			t.Fatalf("stale uploadings not matched %+v", staleResp.Uploadings)
+		}
+	})
+
+	t.Run("test duplicates", func(t *testing.T) {
+		// sha1 is generated asynchronously
+		for i := 0; ; i++ {
+			resp, dupsResp, errs := adminFilesCl.ListDuplicateFiles(10)
+			assertResp(t, resp, errs, 200, "list duplicates")
+			if len(dupsResp.Duplicates) == 1 {
+				dup := dupsResp.Duplicates[0]
+				if dup.Wasted != 8 || len(dup.Paths) != 2 || dup.Paths[0] != "qs/files/a/f1" || dup.Paths[1] != "user_0/files/f3" {
+					t.Fatalf("duplicates not matched %+v", dup)
+				}
+				break
+			} else if i >= 50 {
+				t.Fatalf("duplicates not found %+v", dupsResp.Duplicates)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+
+	t.Run("test growth and exports", func(t *testing.T) {
+		resp, _, errs := adminFilesCl.TakeStorageSnapshots()
+		assertResp(t, resp, errs, 200, "take snapshots")
+		resp, growthResp, errs := adminFilesCl.GetStorageGrowth(1, "")
+		assertResp(t, resp, errs, 200, "get growth")
+		if len(growthResp.Points) != 1 || growthResp.Points[0].UsedSpace != 36 || growthResp.Points[0].Users != 2 {
+			t.Fatalf("growth not matched %+v", growthResp.Points)
+		}
+		resp, growthResp, errs = adminFilesCl.GetStorageGrowth(1, users[userName])
+		assertResp(t, resp, errs, 200, "get user's growth")
+		if len(growthResp.Points) != 1 || growthResp.Points[0].UsedSpace != 24 || growthResp.Points[0].FileCount != 1 {
+			t.Fatalf("user's growth not matched %+v", growthResp.Points)
+		}
+
+		resp, body, errs := adminFilesCl.ExportStorageStats("users")
+		assertResp(t, resp, errs, 200, "export user usages")
+		rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(rows) != 3 || rows[0][1] != "name" {
+			t.Fatalf("csv not matched %+v", rows)
+		}
+
+		resp, _, errs = userFilesCl.ListUserUsages()
+		assertResp(t, resp, errs, 403, "list usages by user")
+	})
+
+	resp, _, errs = adminUsersCli.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
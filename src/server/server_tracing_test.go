@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/tracing"
+)
+
+func readSpans(t *testing.T, filePath string) []*tracing.SpanData {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	spans := []*tracing.SpanData{}
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		span := &tracing.SpanData{}
+		if err = json.Unmarshal(scanner.Bytes(), span); err != nil {
+			// the last line may be being written
+			break
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	tracesPath := "tmpTestData/traces.jsonl"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		},
+		"tracing": {
+			"exporter": "file",
+			"filePath": "tmpTestData/traces.jsonl",
+			"flushInterval": 100
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	usersCl := client.NewUsersClient(addr)
+	resp, _, errs := usersCl.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 1, adminToken)
+	userName := getUserName(0)
+	userFilesCl, err := loginFilesClient(addr, userName, userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("test linking the sha1 job to the upload", func(t *testing.T) {
+		assertUploadOK(t, "user_0/files/traced.txt", "12345", addr, userFilesCl.Token())
+
+		// spans are exported in batches and sha1 jobs are handled asynchronously
+		var spans []*tracing.SpanData
+		var jobSpan *tracing.SpanData
+		for i := 0; i < 30 && jobSpan == nil; i++ {
+			time.Sleep(100 * time.Millisecond)
+			spans = readSpans(t, tracesPath)
+			for _, span := range spans {
+				if span.Name == "job sha1" {
+					jobSpan = span
+				}
+			}
+		}
+		if jobSpan == nil {
+			t.Fatal("sha1 job span not found")
+		}
+		if jobSpan.Kind != tracing.SpanKindConsumer || jobSpan.Error != "" {
+			t.Fatalf("job span not matched %+v", jobSpan)
+		}
+
+		var uploadSpan *tracing.SpanData
+		trace := map[string]bool{}
+		for _, span := range spans {
+			if span.TraceID != jobSpan.TraceID {
+				continue
+			}
+			if span.SpanID == jobSpan.ParentSpanID {
+				uploadSpan = span
+			}
+			trace[span.Name] = true
+			if strings.HasPrefix(span.Name, "db.") {
+				trace["db"] = true
+			}
+		}
+		if uploadSpan == nil {
+			t.Fatal("parent of the job span not found")
+		}
+		if uploadSpan.Name != "PATCH /v2/my/fs/files/chunks" ||
+			uploadSpan.Kind != tracing.SpanKindServer ||
+			uploadSpan.ParentSpanID != "" ||
+			uploadSpan.Attrs["http.status_code"] != float64(200) ||
+			uploadSpan.Attrs["upload.path"] != "user_0/files/traced.txt" {
+			t.Fatalf("upload span not matched %+v", uploadSpan)
+		}
+		for _, name := range []string{"fs.WriteAt", "fs.Rename", "fs.GetFileReader", "db"} {
+			if !trace[name] {
+				t.Fatalf("%s span not found in the trace %+v", name, trace)
+			}
+		}
+	})
+
+	t.Run("test continuing traces of clients", func(t *testing.T) {
+		traceparent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+		resp, _, errs := userFilesCl.Download(
+			"user_0/files/traced.txt",
+			map[string]string{tracing.TraceparentHeader: traceparent},
+		)
+		assertResp(t, resp, errs, 200, "download with traceparent")
+
+		var remoteChild *tracing.SpanData
+		for i := 0; i < 30 && remoteChild == nil; i++ {
+			time.Sleep(100 * time.Millisecond)
+			for _, span := range readSpans(t, tracesPath) {
+				if span.TraceID == "0af7651916cd43dd8448eb211c80319c" && span.Kind == tracing.SpanKindServer {
+					remoteChild = span
+				}
+			}
+		}
+		if remoteChild == nil {
+			t.Fatal("span of the remote trace not found")
+		}
+		if remoteChild.ParentSpanID != "b7ad6b7169203331" {
+			t.Fatalf("remote parent not matched %+v", remoteChild)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+)
+
+func TestUserImportsHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	adminUsersCli := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCli.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+
+	csvData := strings.Join([]string{
+		"name,role,pwd,email,spaceLimit",
+		"alice,user,1234,alice@quickshare.local,2048",
+		"bob,admin,,bob@quickshare.local,",
+		"x,user,1234,,",
+		"alice,user,1234,,",
+		"carol,nobody,1234,,",
+	}, "\n")
+	assertActions := func(desc string, importResp *multiusers.ImportUsersResp, expected []string) {
+		if len(importResp.Results) != len(expected) {
+			t.Fatalf("%s: incorrect results %+v", desc, importResp.Results)
+		}
+		for i, result := range importResp.Results {
+			if result.Action != expected[i] {
+				t.Fatalf("%s: row %d: expected %s, got %+v", desc, i+1, expected[i], result)
+			}
+		}
+	}
+
+	t.Run("test importing users", func(t *testing.T) {
+		resp, importResp, errs := adminUsersCli.ImportUsers(multiusers.FormatCSV, []byte(csvData), true)
+		assertResp(t, resp, errs, 200, "dry run")
+		if !importResp.DryRun {
+			t.Fatal("dry run is not set")
+		}
+		expected := []string{
+			multiusers.ImportCreate,
+			multiusers.ImportCreate,
+			multiusers.ImportError,
+			multiusers.ImportError,
+			multiusers.ImportError,
+		}
+		assertActions("dry run", importResp, expected)
+		resp, lsResp, errs := adminUsersCli.ListUsers()
+		assertResp(t, resp, errs, 200, "list users")
+		if len(lsResp.Users) != 2 {
+			t.Fatalf("users are created in dry run %+v", lsResp.Users)
+		}
+
+		resp, importResp, errs = adminUsersCli.ImportUsers(multiusers.FormatCSV, []byte(csvData), false)
+		assertResp(t, resp, errs, 200, "import")
+		assertActions("import", importResp, expected)
+		bobPwd := importResp.Results[1].Pwd
+		if bobPwd == "" || importResp.Results[0].Pwd != "" {
+			t.Fatalf("incorrect generated passwords %+v", importResp.Results)
+		}
+
+		aliceCl := client.NewUsersClient(addr)
+		resp, _, errs = aliceCl.Login("alice", "1234")
+		assertResp(t, resp, errs, 200, "alice login")
+		resp, selfResp, errs := aliceCl.Self()
+		assertResp(t, resp, errs, 200, "alice self")
+		if selfResp.Quota.SpaceLimit != 2048 ||
+			selfResp.Quota.UploadSpeedLimit != 409600 ||
+			selfResp.Preferences.Email != "alice@quickshare.local" {
+			t.Fatalf("incorrect imported user %+v", selfResp)
+		}
+		bobCl := client.NewUsersClient(addr)
+		resp, _, errs = bobCl.Login("bob", bobPwd)
+		assertResp(t, resp, errs, 200, "bob login with generated password")
+
+		// importing again changes nothing
+		resp, importResp, errs = adminUsersCli.ImportUsers(multiusers.FormatCSV, []byte(csvData), false)
+		assertResp(t, resp, errs, 200, "import again")
+		assertActions("import again", importResp, []string{
+			multiusers.ImportNone,
+			multiusers.ImportNone,
+			multiusers.ImportError,
+			multiusers.ImportError,
+			multiusers.ImportError,
+		})
+
+		jsonData := `[{"name": "alice", "spaceLimit": 4096}, {"name": "qs", "role": "user"}]`
+		resp, importResp, errs = adminUsersCli.ImportUsers(multiusers.FormatJSON, []byte(jsonData), false)
+		assertResp(t, resp, errs, 200, "import json")
+		assertActions("import json", importResp, []string{multiusers.ImportUpdate, multiusers.ImportError})
+		resp, selfResp, errs = aliceCl.Self()
+		assertResp(t, resp, errs, 200, "alice self")
+		if selfResp.Quota.SpaceLimit != 4096 || selfResp.Role != "user" {
+			t.Fatalf("incorrect updated user %+v", selfResp)
+		}
+
+		// unspecified quota fields are inherited from policies
+		resp, _, errs = adminUsersCli.SetQuotaPolicy(db.QuotaPolicyRole, db.UserRole, &db.Quota{
+			SpaceLimit:         8192,
+			UploadSpeedLimit:   204800,
+			DownloadSpeedLimit: 204800,
+		})
+		assertResp(t, resp, errs, 200, "set role policy")
+		jsonData = `[{"name": "dave", "pwd": "1234", "spaceLimit": 2048}]`
+		resp, importResp, errs = adminUsersCli.ImportUsers(multiusers.FormatJSON, []byte(jsonData), false)
+		assertResp(t, resp, errs, 200, "import with partial quota")
+		assertActions("import with partial quota", importResp, []string{multiusers.ImportCreate})
+		daveCl := client.NewUsersClient(addr)
+		resp, _, errs = daveCl.Login("dave", "1234")
+		assertResp(t, resp, errs, 200, "dave login")
+		resp, selfResp, errs = daveCl.Self()
+		assertResp(t, resp, errs, 200, "dave self")
+		if selfResp.Quota.SpaceLimit != 2048 ||
+			selfResp.Quota.UploadSpeedLimit != 204800 ||
+			selfResp.Quota.DownloadSpeedLimit != 204800 {
+			t.Fatalf("incorrect quota of the imported user %+v", selfResp.Quota)
+		}
+
+		resp, _, errs = adminUsersCli.ImportUsers("xml", []byte(jsonData), false)
+		assertResp(t, resp, errs, 400, "invalid format")
+		resp, _, errs = adminUsersCli.ImportUsers(multiusers.FormatCSV, []byte("name,age\nalice,1"), false)
+		assertResp(t, resp, errs, 400, "unknown column")
+		resp, _, errs = aliceCl.ImportUsers(multiusers.FormatJSON, []byte(jsonData), false)
+		assertResp(t, resp, errs, 403, "users can not import")
+	})
+
+	t.Run("test exporting users", func(t *testing.T) {
+		resp, body, errs := adminUsersCli.ExportUsers(multiusers.FormatCSV)
+		assertResp(t, resp, errs, 200, "export csv")
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		// predefined users are not exported
+		if len(lines) != 4 ||
+			!strings.HasPrefix(lines[0], "id,name,role,email") ||
+			strings.Contains(body, ","+adminName+",") {
+			t.Fatalf("incorrect csv export (%s)", body)
+		}
+
+		// the export can be imported again
+		resp, importResp, errs := adminUsersCli.ImportUsers(multiusers.FormatCSV, []byte(body), true)
+		assertResp(t, resp, errs, 200, "import the export")
+		for _, result := range importResp.Results {
+			if result.Action != multiusers.ImportNone {
+				t.Fatalf("export is not matched with users %+v", result)
+			}
+		}
+
+		resp, body, errs = adminUsersCli.ExportUsers(multiusers.FormatJSON)
+		assertResp(t, resp, errs, 200, "export json")
+		if !strings.Contains(body, `"usedPercent"`) || !strings.Contains(body, "alice@quickshare.local") {
+			t.Fatalf("incorrect json export (%s)", body)
+		}
+
+		// admins with 2FA export users by API tokens
+		resp, tokenResp, errs := adminUsersCli.AddAPIToken(&multiusers.AddAPITokenReq{Name: "users cli"})
+		assertResp(t, resp, errs, 200, "add api token")
+		tokenCl := client.NewUsersClient(addr)
+		tokenCl.SetAPIToken(tokenResp.Token)
+		resp, tokenBody, errs := tokenCl.ExportUsers(multiusers.FormatJSON)
+		assertResp(t, resp, errs, 200, "export by api token")
+		if tokenBody != body {
+			t.Fatalf("incorrect export by api token (%s)", tokenBody)
+		}
+	})
+}
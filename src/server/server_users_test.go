@@ -451,6 +451,81 @@ func TestUsersHandlers(t *testing.T) {
 	// 	}
 	// })
 
+	t.Run("test custom roles: AddRole-AddUser-Download-Delete-SetRoleRules-DelRole", func(t *testing.T) {
+		adminUsersCli := client.NewUsersClient(addr)
+		resp, _, errs := adminUsersCli.Login(adminName, adminNewPwd)
+		assertResp(t, resp, errs, 200, "admin login")
+		adminToken := adminUsersCli.Token()
+
+		role := "read-only"
+		rules := []*db.APIRule{
+			{Method: "GET", Path: "/v2/my/self"},
+			{Method: "GET", Path: "/v2/my/fs/files"},
+			{Method: "GET", Path: "/v2/my/fs/dirs*"},
+		}
+		resp, _, errs = adminUsersCli.AddRole(db.UserRole, rules)
+		assertResp(t, resp, errs, 400, "predefined roles can not be added")
+		resp, _, errs = adminUsersCli.AddRole(role, []*db.APIRule{{Method: "GET", Path: "v2"}})
+		assertResp(t, resp, errs, 400, "invalid rules")
+		resp, _, errs = adminUsersCli.AddRole(role, rules)
+		assertResp(t, resp, errs, 200, "add role")
+		resp, _, errs = adminUsersCli.AddRole(role, rules)
+		assertResp(t, resp, errs, 409, "add duplicated role")
+
+		resp, lsResp, errs := adminUsersCli.ListRoles()
+		assertResp(t, resp, errs, 200, "list roles")
+		if !lsResp.Roles[role] || len(lsResp.Rules[role]) != len(rules) {
+			t.Fatalf("role(%s) not found", role)
+		}
+
+		resp, _, errs = adminUsersCli.AddUser("unknown_role_user", "1234", "unknown-role")
+		assertResp(t, resp, errs, 400, "add user with unknown role")
+
+		userName, userPwd := "reader", "1234"
+		resp, auResp, errs := adminUsersCli.AddUser(userName, userPwd, role)
+		assertResp(t, resp, errs, 200, "add user with custom role")
+		filePath := q.FsRootPath(userName, "readme")
+		content := "12345678"
+		assertUploadOK(t, filePath, content, addr, adminToken)
+
+		readerUsersCli := client.NewUsersClient(addr)
+		resp, _, errs = readerUsersCli.Login(userName, userPwd)
+		assertResp(t, resp, errs, 200, "custom role can login")
+		readerFilesCli := client.NewFilesClient(addr, readerUsersCli.Token())
+
+		resp, _, errs = readerUsersCli.Self()
+		assertResp(t, resp, errs, 200, "custom role self")
+		resp, body, errs := readerFilesCli.Download(filePath, map[string]string{})
+		assertResp(t, resp, errs, 200, "custom role download")
+		if body != content {
+			t.Fatalf("content not matched (%s)", body)
+		}
+		resp, _, errs = readerFilesCli.ListHome()
+		assertResp(t, resp, errs, 200, "custom role list home")
+		resp, _, errs = readerFilesCli.Delete(filePath)
+		assertResp(t, resp, errs, 403, "custom role can not delete")
+
+		resp, _, errs = adminUsersCli.SetRoleRules(role, []*db.APIRule{
+			{Method: "GET", Path: "/v2/my/self"},
+		})
+		assertResp(t, resp, errs, 200, "set role rules")
+		resp, _, errs = readerFilesCli.Download(filePath, map[string]string{})
+		assertResp(t, resp, errs, 403, "rules are updated")
+
+		resp, _, errs = adminUsersCli.DelRole(role)
+		assertResp(t, resp, errs, 409, "role in use can not be deleted")
+		resp, _, errs = adminUsersCli.DelUser(auResp.ID)
+		assertResp(t, resp, errs, 200, "delete user")
+		resp, _, errs = adminUsersCli.DelRole(role)
+		assertResp(t, resp, errs, 200, "delete role")
+
+		resp, lsResp, errs = adminUsersCli.ListRoles()
+		assertResp(t, resp, errs, 200, "list roles")
+		if lsResp.Roles[role] {
+			t.Fatalf("role(%s) should not exist", role)
+		}
+	})
+
 	t.Run("Login, SetPreferences, Self, Logout", func(t *testing.T) {
 		adminUsersCli := client.NewUsersClient(addr)
 		resp, _, errs := adminUsersCli.Login(adminName, adminNewPwd)
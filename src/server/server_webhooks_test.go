@@ -0,0 +1,295 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ihexxa/quickshare/src/client"
+	"github.com/ihexxa/quickshare/src/db"
+	q "github.com/ihexxa/quickshare/src/handlers"
+	"github.com/ihexxa/quickshare/src/handlers/fileshdr"
+	"github.com/ihexxa/quickshare/src/handlers/multiusers"
+	"github.com/ihexxa/quickshare/src/webhook"
+)
+
+type receivedHook struct {
+	event      string
+	deliveryID string
+	signature  string
+	body       []byte
+}
+
+func TestWebhooksHandlers(t *testing.T) {
+	addr := "http://127.0.0.1:8686"
+	rootPath := "tmpTestData"
+	config := `{
+		"users": {
+			"enableAuth": true,
+			"minUserNameLen": 2,
+			"minPwdLen": 4,
+			"captchaEnabled": false,
+			"uploadSpeedLimit": 409600,
+			"downloadSpeedLimit": 409600,
+			"spaceLimit": 1024,
+			"limiterCapacity": 1000,
+			"limiterCyc": 1000
+		},
+		"server": {
+			"debug": true,
+			"host": "127.0.0.1"
+		},
+		"fs": {
+			"root": "tmpTestData"
+		},
+		"db": {
+			"dbPath": "tmpTestData/quickshare"
+		},
+		"webhooks": {
+			"maxAttempts": 1,
+			"allowedNets": ["127.0.0.1"]
+		}
+	}`
+	adminName := "qs"
+	adminPwd := "quicksh@re"
+	setUpEnv(t, rootPath, adminName, adminPwd)
+	defer os.RemoveAll(rootPath)
+
+	srv := startTestServer(config)
+	defer srv.Shutdown()
+
+	if !isServerReady(addr) {
+		t.Fatal("fail to start server")
+	}
+
+	received := make(chan *receivedHook, 64)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- &receivedHook{
+			event:      r.Header.Get(webhook.EventHeader),
+			deliveryID: r.Header.Get(webhook.DeliveryHeader),
+			signature:  r.Header.Get(webhook.SignatureHeader),
+			body:       body,
+		}
+	}))
+	defer receiver.Close()
+	failingReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer failingReceiver.Close()
+
+	adminUsersCl := client.NewUsersClient(addr)
+	resp, _, errs := adminUsersCl.Login(adminName, adminPwd)
+	assertResp(t, resp, errs, 200, "admin login")
+	adminToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	adminUsersCl.SetToken(adminToken)
+
+	userPwd := "1234"
+	addUsers(t, addr, userPwd, 2, adminToken)
+	userUsersCl := client.NewUsersClient(addr)
+	resp, _, errs = userUsersCl.Login(getUserName(1), userPwd)
+	assertResp(t, resp, errs, 200, "user login")
+	userToken := client.GetCookie(resp.Cookies(), q.TokenCookie)
+	userUsersCl.SetToken(userToken)
+	userFilesCl := client.NewFilesClient(addr, userToken)
+	otherFilesCl, err := loginFilesClient(addr, getUserName(0), userPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// waitHook skips other events until the event is received and its signature is verified
+	waitHook := func(t *testing.T, secret, event string, data interface{}) *receivedHook {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case hook := <-received:
+				if hook.event != event {
+					continue
+				}
+				if hook.signature != webhook.Sign(secret, hook.body) {
+					t.Fatalf("invalid signature %s", hook.signature)
+				}
+				payload := &webhook.Payload{Data: data}
+				if err := json.Unmarshal(hook.body, payload); err != nil {
+					t.Fatal(err)
+				} else if payload.Event != event || payload.ID == "" {
+					t.Fatalf("incorrect payload %+v", payload)
+				}
+				return hook
+			case <-timeout:
+				t.Fatalf("%s is not received", event)
+			}
+		}
+	}
+	assertNoHook := func(t *testing.T) {
+		select {
+		case hook := <-received:
+			t.Fatalf("unexpected webhook %s", hook.event)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	userHookID, userSecret := "", ""
+	t.Run("test adding webhooks", func(t *testing.T) {
+		resp, addResp, errs := userUsersCl.AddWebhook(&multiusers.AddWebhookReq{
+			URL: receiver.URL,
+			Events: []string{
+				db.WebhookEventFileUploaded,
+				db.WebhookEventFileDeleted,
+				db.WebhookEventSharingCreated,
+			},
+		})
+		assertResp(t, resp, errs, 200, "add webhook")
+		if addResp.Secret == "" {
+			t.Fatal("secret is not returned")
+		}
+		userHookID, userSecret = addResp.ID, addResp.Secret
+
+		resp, lsResp, errs := userUsersCl.ListWebhooks()
+		assertResp(t, resp, errs, 200, "list webhooks")
+		if len(lsResp.Webhooks) != 1 || lsResp.Webhooks[0].URL != receiver.URL || lsResp.Webhooks[0].Secret != "" {
+			t.Fatalf("incorrect webhooks %+v", lsResp.Webhooks)
+		}
+
+		for _, req := range []*multiusers.AddWebhookReq{
+			{URL: "ftp://127.0.0.1", Events: []string{db.WebhookEventFileUploaded}},
+			{URL: receiver.URL, Events: []string{"file.unknown"}},
+			{URL: receiver.URL},
+			{URL: "http://169.254.169.254/latest/meta-data", Events: []string{db.WebhookEventFileUploaded}},
+			{URL: "http://10.0.0.1:22", Events: []string{db.WebhookEventFileUploaded}},
+		} {
+			resp, _, errs = userUsersCl.AddWebhook(req)
+			assertResp(t, resp, errs, 400, "add invalid webhook")
+		}
+		resp, _, errs = userUsersCl.AddWebhook(&multiusers.AddWebhookReq{
+			URL:    receiver.URL,
+			Events: []string{db.WebhookEventUserCreated},
+			Global: true,
+		})
+		assertResp(t, resp, errs, 403, "add global webhook by user")
+	})
+
+	t.Run("test file and sharing events", func(t *testing.T) {
+		assertUploadOK(t, "user_1/files/a.txt", "12345", addr, userToken)
+		data := &fileshdr.FileWebhookData{}
+		waitHook(t, userSecret, db.WebhookEventFileUploaded, data)
+		if data.Path != "user_1/files/a.txt" || data.Size != 5 || data.Actor != getUserName(1) {
+			t.Fatalf("incorrect data %+v", data)
+		}
+
+		resp, _, errs := userFilesCl.Mkdir("user_1/files/shared")
+		assertResp(t, resp, errs, 200, "mkdir")
+		resp, _, errs = userFilesCl.AddSharing("user_1/files/shared")
+		assertResp(t, resp, errs, 200, "add sharing")
+		waitHook(t, userSecret, db.WebhookEventSharingCreated, data)
+		if data.Path != "user_1/files/shared" {
+			t.Fatalf("incorrect data %+v", data)
+		}
+
+		resp, _, errs = userFilesCl.Delete("user_1/files/a.txt")
+		assertResp(t, resp, errs, 200, "delete")
+		waitHook(t, userSecret, db.WebhookEventFileDeleted, data)
+		if data.Path != "user_1/files/a.txt" {
+			t.Fatalf("incorrect data %+v", data)
+		}
+
+		// events of others are not received
+		assertUploadOK(t, "user_0/files/b.txt", "12345", addr, otherFilesCl.Token())
+		assertNoHook(t)
+	})
+
+	t.Run("test deliveries and replaying", func(t *testing.T) {
+		resp, lsResp, errs := userUsersCl.ListWebhookDeliveries(userHookID, 10)
+		assertResp(t, resp, errs, 200, "list deliveries")
+		if len(lsResp.Deliveries) != 3 {
+			t.Fatalf("incorrect deliveries count %d", len(lsResp.Deliveries))
+		}
+		latest := lsResp.Deliveries[0]
+		if latest.Event != db.WebhookEventFileDeleted ||
+			latest.Status != db.WebhookDeliverySucceeded ||
+			latest.ResponseCode != 200 ||
+			latest.Attempts != 1 {
+			t.Fatalf("incorrect delivery %+v", latest)
+		}
+
+		resp, replayResp, errs := userUsersCl.ReplayWebhookDelivery(fmt.Sprint(latest.ID))
+		assertResp(t, resp, errs, 200, "replay")
+		hook := waitHook(t, userSecret, db.WebhookEventFileDeleted, &fileshdr.FileWebhookData{})
+		if hook.deliveryID != replayResp.ID {
+			t.Fatalf("incorrect delivery ID %s %s", hook.deliveryID, replayResp.ID)
+		}
+
+		// others' webhooks are not found
+		resp, _, errs = adminUsersCl.ListWebhookDeliveries(userHookID, 10)
+		assertResp(t, resp, errs, 404, "list others' deliveries")
+		resp, _, errs = adminUsersCl.ReplayWebhookDelivery(fmt.Sprint(latest.ID))
+		assertResp(t, resp, errs, 404, "replay others' delivery")
+		resp, _, errs = adminUsersCl.DelWebhook(userHookID)
+		assertResp(t, resp, errs, 404, "delete others' webhook")
+	})
+
+	t.Run("test global webhooks and failed deliveries", func(t *testing.T) {
+		resp, addResp, errs := adminUsersCl.AddWebhook(&multiusers.AddWebhookReq{
+			URL:    receiver.URL,
+			Events: []string{db.WebhookEventUserCreated},
+			Global: true,
+		})
+		assertResp(t, resp, errs, 200, "add global webhook")
+		resp, failingResp, errs := adminUsersCl.AddWebhook(&multiusers.AddWebhookReq{
+			URL:    failingReceiver.URL,
+			Events: []string{db.WebhookEventUserCreated},
+		})
+		assertResp(t, resp, errs, 200, "add failing webhook")
+
+		resp, _, errs = adminUsersCl.AddUser("new_user", userPwd, db.UserRole)
+		assertResp(t, resp, errs, 200, "add user")
+		data := &multiusers.UserWebhookData{}
+		waitHook(t, addResp.Secret, db.WebhookEventUserCreated, data)
+		if data.Name != "new_user" || data.Role != db.UserRole {
+			t.Fatalf("incorrect data %+v", data)
+		}
+
+		// maxAttempts is 1 so the delivery fails after the first attempt
+		var failed *db.WebhookDelivery
+		for i := 0; i < 50; i++ {
+			resp, lsResp, errs := adminUsersCl.ListWebhookDeliveries(failingResp.ID, 10)
+			assertResp(t, resp, errs, 200, "list deliveries")
+			if len(lsResp.Deliveries) == 1 && lsResp.Deliveries[0].Status != db.WebhookDeliveryPending {
+				failed = lsResp.Deliveries[0]
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if failed == nil {
+			t.Fatal("delivery is not finished")
+		} else if failed.Status != db.WebhookDeliveryFailed || failed.ResponseCode != 500 || failed.Error == "" {
+			t.Fatalf("incorrect delivery %+v", failed)
+		}
+
+		resp, _, errs = adminUsersCl.DelWebhook(failingResp.ID)
+		assertResp(t, resp, errs, 200, "delete webhook")
+		resp, _, errs = adminUsersCl.ListWebhookDeliveries(failingResp.ID, 10)
+		assertResp(t, resp, errs, 404, "list deliveries of deleted webhook")
+	})
+
+	t.Run("test deleting webhooks", func(t *testing.T) {
+		resp, _, errs := userUsersCl.DelWebhook(userHookID)
+		assertResp(t, resp, errs, 200, "delete webhook")
+		resp, lsResp, errs := userUsersCl.ListWebhooks()
+		assertResp(t, resp, errs, 200, "list webhooks")
+		if len(lsResp.Webhooks) != 0 {
+			t.Fatalf("webhook is not deleted %+v", lsResp.Webhooks)
+		}
+
+		assertUploadOK(t, "user_1/files/c.txt", "12345", addr, userToken)
+		assertNoHook(t)
+	})
+
+	resp, _, errs = adminUsersCl.Logout()
+	assertResp(t, resp, errs, 200, "logout")
+}
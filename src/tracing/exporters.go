@@ -0,0 +1,232 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+
+	// status codes are the same as OTLP's
+	statusCodeOK    = 1
+	statusCodeError = 2
+)
+
+type IExporter interface {
+	Export(spans []*SpanData) error
+	Close() error
+}
+
+// WriterExporter writes spans as JSON lines, it is mainly used for debugging and tests
+type WriterExporter struct {
+	mtx     *sync.Mutex
+	closer  func() error
+	encoder *json.Encoder
+}
+
+func NewStdoutExporter() *WriterExporter {
+	return &WriterExporter{
+		mtx:     &sync.Mutex{},
+		closer:  func() error { return nil },
+		encoder: json.NewEncoder(os.Stdout),
+	}
+}
+
+func NewFileExporter(filePath string) (*WriterExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return nil, err
+	}
+	fd, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{
+		mtx:     &sync.Mutex{},
+		closer:  fd.Close,
+		encoder: json.NewEncoder(fd),
+	}, nil
+}
+
+func (we *WriterExporter) Export(spans []*SpanData) error {
+	we.mtx.Lock()
+	defer we.mtx.Unlock()
+
+	for _, span := range spans {
+		if err := we.encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (we *WriterExporter) Close() error {
+	we.mtx.Lock()
+	defer we.mtx.Unlock()
+	return we.closer()
+}
+
+// OTLPExporter posts spans to the OTLP/HTTP endpoint (e.g. "http://127.0.0.1:4318/v1/traces")
+// with the JSON encoding, which is accepted by the OpenTelemetry collector, Jaeger, Tempo, etc.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+func NewOTLPExporter(endpoint, serviceName string, timeout time.Duration) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: timeout},
+	}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string     `json:"key"`
+	Value *otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              SpanKind    `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []*otlpAttr `json:"attributes,omitempty"`
+	Status            *otlpStatus `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope map[string]string `json:"scope"`
+	Spans []*otlpSpan       `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   map[string][]*otlpAttr `json:"resource"`
+	ScopeSpans []*otlpScopeSpans      `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+func toOTLPValue(value interface{}) *otlpValue {
+	switch val := value.(type) {
+	case string:
+		return &otlpValue{StringValue: &val}
+	case bool:
+		return &otlpValue{BoolValue: &val}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		// 64-bit integers are encoded as strings in OTLP JSON
+		intStr := fmt.Sprint(val)
+		return &otlpValue{IntValue: &intStr}
+	case float32:
+		double := float64(val)
+		return &otlpValue{DoubleValue: &double}
+	case float64:
+		return &otlpValue{DoubleValue: &val}
+	}
+	str := fmt.Sprint(value)
+	return &otlpValue{StringValue: &str}
+}
+
+func toOTLPAttrs(attrs map[string]interface{}) []*otlpAttr {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	otlpAttrs := make([]*otlpAttr, 0, len(attrs))
+	for _, key := range keys {
+		otlpAttrs = append(otlpAttrs, &otlpAttr{Key: key, Value: toOTLPValue(attrs[key])})
+	}
+	return otlpAttrs
+}
+
+func (oe *OTLPExporter) toRequest(spans []*SpanData) *otlpRequest {
+	otlpSpans := make([]*otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		status := &otlpStatus{Code: statusCodeOK}
+		if span.Error != "" {
+			status = &otlpStatus{Code: statusCodeError, Message: span.Error}
+		}
+		otlpSpans = append(otlpSpans, &otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: fmt.Sprint(span.Start.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprint(span.End.UnixNano()),
+			Attributes:        toOTLPAttrs(span.Attrs),
+			Status:            status,
+		})
+	}
+
+	return &otlpRequest{
+		ResourceSpans: []*otlpResourceSpans{
+			{
+				Resource: map[string][]*otlpAttr{
+					"attributes": toOTLPAttrs(map[string]interface{}{"service.name": oe.serviceName}),
+				},
+				ScopeSpans: []*otlpScopeSpans{
+					{
+						Scope: map[string]string{"name": "quickshare"},
+						Spans: otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func (oe *OTLPExporter) Export(spans []*SpanData) error {
+	body, err := json.Marshal(oe.toRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := oe.client.Post(oe.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the body is drained so that the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP endpoint responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (oe *OTLPExporter) Close() error {
+	oe.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TraceparentHeader propagates span contexts in the W3C trace context format
+	TraceparentHeader = "traceparent"
+	// ContextKey is the key of spans in gin contexts, since gin only looks up values of string keys
+	ContextKey = "quickshare.tracing.span"
+)
+
+type SpanKind int
+
+// span kinds are the same as OTLP's
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+type spanKey struct{}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func newTraceID() string {
+	return randomHex(16)
+}
+
+func newSpanID() string {
+	return randomHex(8)
+}
+
+// SpanData is a finished span passed to exporters
+type SpanData struct {
+	TraceID      string                 `json:"traceID"`
+	SpanID       string                 `json:"spanID"`
+	ParentSpanID string                 `json:"parentSpanID,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attrs        map[string]interface{} `json:"attrs,omitempty"`
+	// Error is empty if the operation succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// Span is an operation in a trace, methods of a nil span do nothing
+// so that callers don't check whether tracing is enabled
+type Span struct {
+	tracer *Tracer
+	mtx    *sync.Mutex
+	data   *SpanData
+	// remote spans are parents extracted from headers, they are not exported
+	remote bool
+	ended  bool
+}
+
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.TraceID
+}
+
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.SpanID
+}
+
+// SetAttr sets an attribute, the value should be a string, bool, integer or float
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	// ended spans may be being exported
+	if !s.ended {
+		s.data.Attrs[key] = value
+	}
+}
+
+// SetError marks the span as failed if err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.ended {
+		s.data.Error = err.Error()
+	}
+}
+
+func (s *Span) End() {
+	if s == nil || s.remote {
+		return
+	}
+	s.mtx.Lock()
+	if s.ended {
+		s.mtx.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.mtx.Unlock()
+
+	s.tracer.export(s.data)
+}
+
+func (s *Span) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.data.TraceID, s.data.SpanID)
+}
+
+// ContextWithSpan returns a copy of ctx carrying the span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx or nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	if span, ok := ctx.Value(spanKey{}).(*Span); ok {
+		return span
+	}
+	if span, ok := ctx.Value(ContextKey).(*Span); ok {
+		return span
+	}
+	return nil
+}
+
+// StartSpan starts a child span of the span in ctx,
+// it returns a nil span if ctx is not traced so that untraced operations cost little
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(parent, name, SpanKindInternal, time.Now())
+	return ContextWithSpan(ctx, span), span
+}
+
+// RecordSpan records a finished child span of the span in ctx, e.g. for operations observed after they end
+func RecordSpan(ctx context.Context, name string, start time.Time, err error, attrs map[string]interface{}) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return
+	}
+	span := parent.tracer.newSpan(parent, name, SpanKindClient, start)
+	for key, value := range attrs {
+		span.data.Attrs[key] = value
+	}
+	span.SetError(err)
+	span.End()
+}
+
+// Inject writes the span context of ctx into headers, e.g. headers of async messages
+func Inject(ctx context.Context, headers map[string]string) {
+	if span := SpanFromContext(ctx); span != nil {
+		headers[TraceparentHeader] = span.traceparent()
+	}
+}
+
+// parseTraceparent returns the trace ID and the parent span ID in the traceparent
+func parseTraceparent(traceparent string) (string, string, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", ErrInvalidTraceparent
+	}
+	traceID, spanID := strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isValidID(traceID, 16) || !isValidID(spanID, 8) {
+		return "", "", ErrInvalidTraceparent
+	}
+	return traceID, spanID, nil
+}
+
+// isValidID checks if id is hex encoded from size bytes and is not all zeros
+func isValidID(id string, size int) bool {
+	decoded, err := hex.DecodeString(id)
+	if err != nil || len(decoded) != size {
+		return false
+	}
+	for _, b := range decoded {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type ITracer interface {
+	// Start starts a span as a child of the span in ctx, or a root span if ctx is not traced
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span)
+	// Extract returns a copy of ctx carrying the remote parent in headers,
+	// ctx is returned if there is no valid traceparent
+	Extract(ctx context.Context, headers map[string]string) context.Context
+	// Close exports the remaining spans
+	Close() error
+}
+
+type Config struct {
+	// spans are exported when BatchSize spans are finished or after FlushInterval
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+}
+
+// Tracer batches finished spans and exports them in background,
+// it is disabled (spans are nil) if the exporter is nil
+type Tracer struct {
+	cfg      *Config
+	exporter IExporter
+	logger   *zap.SugaredLogger
+	spans    chan *SpanData
+	done     chan struct{}
+	mtx      *sync.RWMutex
+	closed   bool
+}
+
+func NewTracer(cfg *Config, exporter IExporter, logger *zap.SugaredLogger) *Tracer {
+	tracer := &Tracer{
+		cfg:      cfg,
+		exporter: exporter,
+		logger:   logger,
+		spans:    make(chan *SpanData, cfg.QueueSize),
+		done:     make(chan struct{}),
+		mtx:      &sync.RWMutex{},
+	}
+	if exporter == nil {
+		close(tracer.done)
+	} else {
+		go tracer.run()
+	}
+	return tracer
+}
+
+func (t *Tracer) enabled() bool {
+	return t.exporter != nil
+}
+
+func (t *Tracer) newSpan(parent *Span, name string, kind SpanKind, start time.Time) *Span {
+	data := &SpanData{
+		TraceID: newTraceID(),
+		SpanID:  newSpanID(),
+		Name:    name,
+		Kind:    kind,
+		Start:   start,
+		Attrs:   map[string]interface{}{},
+	}
+	if parent != nil {
+		data.TraceID = parent.data.TraceID
+		data.ParentSpanID = parent.data.SpanID
+	}
+	return &Span{
+		tracer: t,
+		mtx:    &sync.Mutex{},
+		data:   data,
+	}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if !t.enabled() {
+		return ctx, nil
+	}
+	span := t.newSpan(SpanFromContext(ctx), name, kind, time.Now())
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) Extract(ctx context.Context, headers map[string]string) context.Context {
+	if !t.enabled() {
+		return ctx
+	}
+	traceparent, ok := headers[TraceparentHeader]
+	if !ok {
+		return ctx
+	}
+	traceID, spanID, err := parseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+
+	return ContextWithSpan(ctx, &Span{
+		tracer: t,
+		mtx:    &sync.Mutex{},
+		data: &SpanData{
+			TraceID: traceID,
+			SpanID:  spanID,
+			Attrs:   map[string]interface{}{},
+		},
+		remote: true,
+	})
+}
+
+// export queues the finished span, it is dropped if the queue is full so that operations are not blocked
+func (t *Tracer) export(span *SpanData) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.spans <- span:
+	default:
+		t.logger.Warnf("tracing queue is full: span(%s) is dropped", span.Name)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, t.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			t.logger.Errorf("failed to export %d spans: %s", len(batch), err)
+		}
+		batch = make([]*SpanData, 0, t.cfg.BatchSize)
+	}
+
+	for {
+		select {
+		case span, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= t.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (t *Tracer) Close() error {
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.spans)
+	t.mtx.Unlock()
+
+	<-t.done
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Close()
+}
@@ -0,0 +1,195 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type memExporter struct {
+	mtx   *sync.Mutex
+	spans []*SpanData
+}
+
+func (me *memExporter) Export(spans []*SpanData) error {
+	me.mtx.Lock()
+	defer me.mtx.Unlock()
+	me.spans = append(me.spans, spans...)
+	return nil
+}
+
+func (me *memExporter) Close() error {
+	return nil
+}
+
+func newTestTracer(exporter IExporter) *Tracer {
+	return NewTracer(
+		&Config{BatchSize: 2, FlushInterval: 100 * time.Millisecond, QueueSize: 16},
+		exporter,
+		zap.NewNop().Sugar(),
+	)
+}
+
+func TestPropagation(t *testing.T) {
+	exporter := &memExporter{mtx: &sync.Mutex{}}
+	tracer := newTestTracer(exporter)
+
+	ctx, root := tracer.Start(context.TODO(), "PATCH /v2/my/fs/files/chunks", SpanKindServer)
+	childCtx, child := StartSpan(ctx, "fs.WriteAt")
+	child.SetAttr("fs.bytes", 5)
+	RecordSpan(childCtx, "db.exec", time.Now(), errors.New("failed"), map[string]interface{}{"db.statement": "update"})
+	child.End()
+
+	headers := map[string]string{}
+	Inject(ctx, headers)
+	root.End()
+
+	// the job is handled in another goroutine with headers of the message
+	jobCtx := tracer.Extract(context.Background(), headers)
+	_, job := tracer.Start(jobCtx, "job sha1", SpanKindConsumer)
+	job.End()
+
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]*SpanData{}
+	for _, span := range exporter.spans {
+		spans[span.Name] = span
+	}
+	if len(spans) != 4 {
+		t.Fatalf("spans not matched %+v", exporter.spans)
+	}
+	for name, parent := range map[string]string{
+		"fs.WriteAt": "PATCH /v2/my/fs/files/chunks",
+		"db.exec":    "fs.WriteAt",
+		"job sha1":   "PATCH /v2/my/fs/files/chunks",
+	} {
+		if spans[name].TraceID != root.TraceID() || spans[name].ParentSpanID != spans[parent].SpanID {
+			t.Fatalf("%s is not a child of %s: %+v", name, parent, spans[name])
+		}
+	}
+	if spans["PATCH /v2/my/fs/files/chunks"].ParentSpanID != "" {
+		t.Fatal("root span should not have a parent")
+	}
+	if spans["db.exec"].Error != "failed" || spans["db.exec"].Attrs["db.statement"] != "update" {
+		t.Fatalf("recorded span not matched %+v", spans["db.exec"])
+	}
+	if spans["fs.WriteAt"].Attrs["fs.bytes"] != 5 || spans["fs.WriteAt"].End.Before(spans["fs.WriteAt"].Start) {
+		t.Fatalf("span not matched %+v", spans["fs.WriteAt"])
+	}
+}
+
+func TestDisabledTracer(t *testing.T) {
+	tracer := newTestTracer(nil)
+	ctx, span := tracer.Start(context.TODO(), "GET /", SpanKindServer)
+	if span != nil {
+		t.Fatal("span should be nil if tracing is disabled")
+	}
+	// methods of nil spans are no-op
+	span.SetAttr("key", "value")
+	span.SetError(errors.New("failed"))
+	span.End()
+
+	if _, child := StartSpan(ctx, "child"); child != nil {
+		t.Fatal("child span should be nil if ctx is not traced")
+	}
+	headers := map[string]string{}
+	Inject(ctx, headers)
+	if len(headers) != 0 {
+		t.Fatalf("nothing should be injected %+v", headers)
+	}
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, err := parseTraceparent("00-0af7651916cd43dd8448eb211c80319c-B7AD6B7169203331-01")
+	if err != nil {
+		t.Fatal(err)
+	} else if traceID != "0af7651916cd43dd8448eb211c80319c" || spanID != "b7ad6b7169203331" {
+		t.Fatalf("ids not matched %s %s", traceID, spanID)
+	}
+
+	for _, traceparent := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0af7651916cd43dd-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319z-b7ad6b7169203331-01",
+	} {
+		if _, _, err = parseTraceparent(traceparent); !errors.Is(err, ErrInvalidTraceparent) {
+			t.Fatalf("%s should be invalid", traceparent)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan *otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &otlpRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(400)
+			return
+		}
+		received <- req
+	}))
+	defer collector.Close()
+
+	start := time.Unix(1, 0)
+	exporter := NewOTLPExporter(collector.URL, "quickshare-test", time.Second)
+	err := exporter.Export([]*SpanData{
+		{
+			TraceID:      "0af7651916cd43dd8448eb211c80319c",
+			SpanID:       "b7ad6b7169203331",
+			ParentSpanID: "00f067aa0ba902b7",
+			Name:         "db.exec",
+			Kind:         SpanKindClient,
+			Start:        start,
+			End:          start.Add(time.Millisecond),
+			Attrs:        map[string]interface{}{"db.statement": "update", "db.rows": 3},
+			Error:        "failed",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-received
+	resource := req.ResourceSpans[0]
+	if *resource.Resource["attributes"][0].Value.StringValue != "quickshare-test" {
+		t.Fatalf("service name not matched %+v", resource.Resource)
+	}
+	span := resource.ScopeSpans[0].Spans[0]
+	if span.TraceID != "0af7651916cd43dd8448eb211c80319c" ||
+		span.ParentSpanID != "00f067aa0ba902b7" ||
+		span.Kind != SpanKindClient ||
+		span.StartTimeUnixNano != "1000000000" ||
+		span.EndTimeUnixNano != "1001000000" ||
+		span.Status.Code != statusCodeError ||
+		span.Status.Message != "failed" {
+		t.Fatalf("span not matched %+v", span)
+	}
+	// attributes are sorted by keys and integers are encoded as strings
+	if len(span.Attributes) != 2 ||
+		span.Attributes[0].Key != "db.rows" || *span.Attributes[0].Value.IntValue != "3" ||
+		*span.Attributes[1].Value.StringValue != "update" {
+		t.Fatalf("attributes not matched %+v", span.Attributes)
+	}
+
+	failingExporter := NewOTLPExporter(collector.URL+"/unknown", "quickshare-test", time.Second)
+	collector.Config.Handler = http.NotFoundHandler()
+	if err = failingExporter.Export([]*SpanData{}); err == nil {
+		t.Fatal("failed exporting should be reported")
+	}
+}
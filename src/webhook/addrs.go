@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var ErrBlockedAddr = errors.New("address is not allowed for webhooks")
+
+// blockedNets are not covered by the checks of net.IP, e.g. the shared address space where
+// some cloud providers serve metadata (100.100.100.200)
+var blockedNets = mustParseNets([]string{
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+})
+
+func mustParseNets(cidrs []string) []*net.IPNet {
+	nets, err := ParseNets(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// ParseNets parses IPs and CIDRs, e.g. "10.0.0.5" or "10.0.0.0/8"
+func ParseNets(addrs []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %s", addr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func inNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIP rejects loopback, private, link-local (including 169.254.169.254 for cloud metadata)
+// and other internal addresses unless they are allowed by admins
+func (w *Webhooks) checkIP(ip net.IP) error {
+	if inNets(ip, w.cfg.AllowedNets) {
+		return nil
+	}
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		inNets(ip, blockedNets) {
+		return fmt.Errorf("%s: %w", ip, ErrBlockedAddr)
+	}
+	return nil
+}
+
+// checkDial is the Control of the dialer, it is called with resolved addresses
+// so that host names resolved (or rebound) to internal addresses are also rejected
+func (w *Webhooks) checkDial(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%s: %w", host, ErrBlockedAddr)
+	}
+	return w.checkIP(ip)
+}
+
+func (w *Webhooks) CheckURL(hookURL string) error {
+	parsed, err := url.Parse(hookURL)
+	if err != nil {
+		return err
+	}
+
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return w.checkIP(ip)
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%s: %w", host, ErrBlockedAddr)
+	}
+	// other host names are checked after they are resolved
+	return nil
+}
@@ -0,0 +1,342 @@
+// Package webhook posts signed payloads of events to webhooks through the worker pool,
+// deliveries are recorded and failed deliveries are retried with backoff
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ihexxa/quickshare/src/db"
+	"github.com/ihexxa/quickshare/src/idgen"
+	"github.com/ihexxa/quickshare/src/tracing"
+	"github.com/ihexxa/quickshare/src/worker"
+	"github.com/ihexxa/quickshare/src/worker/localworker"
+)
+
+const (
+	MsgTypeWebhook = "webhook"
+
+	EventHeader     = "X-Quickshare-Event"
+	DeliveryHeader  = "X-Quickshare-Delivery"
+	SignatureHeader = "X-Quickshare-Signature"
+
+	// queued deliveries are retried after the lease if they are lost, e.g. the server restarts
+	deliveryLease    = 10 * time.Minute
+	maxRetryInterval = time.Hour
+	maxErrorLen      = 1024
+	dueBatchSize     = 100
+)
+
+// Event triggers webhooks subscribing its Type
+type Event struct {
+	Type string
+	// ActorID is the user triggering the event, it is db.VisitorID for visitors
+	ActorID uint64
+	// Owner is the name of the user owning the file, e.g. the first part of the path
+	Owner string
+	Data  interface{}
+}
+
+// Payload is the JSON body posted to webhooks
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt int64       `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+type DeliveryParams struct {
+	DeliveryID uint64
+}
+
+type IStore interface {
+	db.IWebhookDB
+	GetUser(ctx context.Context, id uint64) (*db.User, error)
+}
+
+type IWebhooks interface {
+	// Fire records deliveries of the event for matched webhooks and queues them, errors are only logged
+	Fire(ctx context.Context, event *Event)
+	// Replay posts the payload of the delivery again as a new delivery
+	Replay(ctx context.Context, delivery *db.WebhookDelivery) (*db.WebhookDelivery, error)
+	// RetryDue queues pending deliveries whose retrying time is reached
+	RetryDue()
+	// CleanDeliveries removes finished deliveries older than the kept days
+	CleanDeliveries()
+	// CheckURL rejects URLs whose hosts are internal addresses before webhooks are added,
+	// host names are checked again after they are resolved in deliveries
+	CheckURL(hookURL string) error
+	MsgHandler() worker.MsgHandler
+}
+
+type Config struct {
+	// MaxAttempts is the number of attempts before a delivery is failed
+	MaxAttempts int
+	Timeout     time.Duration
+	KeepDays    int
+	// AllowedNets are internal addresses which could receive webhooks, they are rejected by default
+	AllowedNets []*net.IPNet
+}
+
+type Webhooks struct {
+	cfg     *Config
+	store   IStore
+	workers worker.IWorkerPool
+	ider    idgen.IIDGen
+	logger  *zap.SugaredLogger
+	client  *http.Client
+	now     func() time.Time
+}
+
+func NewWebhooks(cfg *Config, store IStore, workers worker.IWorkerPool, ider idgen.IIDGen, logger *zap.SugaredLogger) *Webhooks {
+	w := &Webhooks{
+		cfg:     cfg,
+		store:   store,
+		workers: workers,
+		ider:    ider,
+		logger:  logger,
+		now:     time.Now,
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout, Control: w.checkDial}
+	w.client = &http.Client{
+		Timeout: cfg.Timeout,
+		// proxies are not used, or addresses of receivers could not be checked
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		// redirects are treated as failures, or payloads could be posted to unexpected places
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return w
+}
+
+// Sign returns the signature of the body, receivers verify payloads by comparing it with the SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhooks) Fire(ctx context.Context, event *Event) {
+	hooks, err := w.store.ListEventWebhooks(ctx, event.Type)
+	if err != nil {
+		w.logger.Errorf("failed to list webhooks of %s: %s", event.Type, err)
+		return
+	} else if len(hooks) == 0 {
+		return
+	}
+
+	now := w.now().Unix()
+	body, err := json.Marshal(&Payload{
+		ID:        fmt.Sprint(w.ider.Gen()),
+		Event:     event.Type,
+		CreatedAt: now,
+		Data:      event.Data,
+	})
+	if err != nil {
+		w.logger.Errorf("failed to marshal payload of %s: %s", event.Type, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !w.matches(ctx, hook, event) {
+			continue
+		}
+		_, err = w.addDelivery(ctx, hook.ID, event.Type, string(body))
+		if err != nil {
+			w.logger.Errorf("failed to add delivery of webhook %d: %s", hook.ID, err)
+		}
+	}
+}
+
+// matches checks if the webhook receives the event: global webhooks receive all events,
+// others receive events triggered by their owners or happening in their owners' files
+func (w *Webhooks) matches(ctx context.Context, hook *db.Webhook, event *Event) bool {
+	// visitors can not own webhooks, so their events only match by owners
+	if hook.Global || hook.UserID == event.ActorID {
+		return true
+	} else if event.Owner == "" {
+		return false
+	}
+
+	owner, err := w.store.GetUser(ctx, hook.UserID)
+	if err != nil {
+		w.logger.Errorf("failed to get owner of webhook %d: %s", hook.ID, err)
+		return false
+	}
+	return owner.Name == event.Owner
+}
+
+func (w *Webhooks) addDelivery(ctx context.Context, hookID uint64, event, payload string) (*db.WebhookDelivery, error) {
+	now := w.now()
+	delivery := &db.WebhookDelivery{
+		ID:          w.ider.Gen(),
+		HookID:      hookID,
+		Event:       event,
+		Payload:     payload,
+		Status:      db.WebhookDeliveryPending,
+		NextRetryAt: now.Add(deliveryLease).Unix(),
+		CreatedAt:   now.Unix(),
+		UpdatedAt:   now.Unix(),
+	}
+	err := w.store.AddWebhookDelivery(ctx, delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	// the delivery is retried after the lease if the queue is full
+	if err = w.queue(ctx, delivery.ID); err != nil {
+		w.logger.Errorf("failed to queue delivery %d: %s", delivery.ID, err)
+	}
+	return delivery, nil
+}
+
+// queue puts the delivery into the worker queue, the job is traced as a child of the span in ctx
+func (w *Webhooks) queue(ctx context.Context, deliveryID uint64) error {
+	msg, err := json.Marshal(&DeliveryParams{DeliveryID: deliveryID})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{localworker.MsgTypeKey: MsgTypeWebhook}
+	tracing.Inject(ctx, headers)
+	return w.workers.TryPut(localworker.NewMsg(w.ider.Gen(), headers, string(msg)))
+}
+
+func (w *Webhooks) Replay(ctx context.Context, delivery *db.WebhookDelivery) (*db.WebhookDelivery, error) {
+	return w.addDelivery(ctx, delivery.HookID, delivery.Event, delivery.Payload)
+}
+
+func (w *Webhooks) RetryDue() {
+	ctx := context.TODO()
+	now := w.now()
+	deliveries, err := w.store.ListDueWebhookDeliveries(ctx, now.Unix(), dueBatchSize)
+	if err != nil {
+		w.logger.Errorf("failed to list due deliveries: %s", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		// it is not listed again while it is in the queue
+		delivery.NextRetryAt = now.Add(deliveryLease).Unix()
+		if err = w.store.SetWebhookDeliveryResult(ctx, delivery); err != nil {
+			w.logger.Errorf("failed to lease delivery %d: %s", delivery.ID, err)
+			continue
+		}
+		if err = w.queue(ctx, delivery.ID); err != nil {
+			w.logger.Errorf("failed to queue delivery %d: %s", delivery.ID, err)
+			return
+		}
+	}
+}
+
+func (w *Webhooks) CleanDeliveries() {
+	if w.cfg.KeepDays <= 0 {
+		return
+	}
+	before := w.now().Unix() - int64(w.cfg.KeepDays)*24*3600
+	if err := w.store.DelWebhookDeliveries(context.TODO(), before); err != nil {
+		w.logger.Errorf("failed to clean webhook deliveries: %s", err)
+	}
+}
+
+func (w *Webhooks) MsgHandler() worker.MsgHandler {
+	return func(msg worker.IMsg) error {
+		params := &DeliveryParams{}
+		if err := json.Unmarshal([]byte(msg.Body()), params); err != nil {
+			return fmt.Errorf("fail to unmarshal webhook msg: %w", err)
+		}
+		return w.deliver(worker.MsgContext(msg), params.DeliveryID)
+	}
+}
+
+// deliver posts the payload once, the delivery is pending for retrying if it fails and attempts are left
+func (w *Webhooks) deliver(ctx context.Context, deliveryID uint64) error {
+	delivery, err := w.store.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	} else if delivery.Status != db.WebhookDeliveryPending {
+		// it could be queued twice, e.g. it is retried after the lease
+		return nil
+	}
+	hook, err := w.store.GetWebhook(ctx, delivery.HookID)
+	if err != nil {
+		return err
+	}
+
+	code, postErr := w.post(ctx, hook, delivery)
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.UpdatedAt = w.now().Unix()
+	if postErr == nil {
+		delivery.Status = db.WebhookDeliverySucceeded
+		delivery.Error = ""
+		delivery.NextRetryAt = 0
+	} else {
+		delivery.Error = postErr.Error()
+		if len(delivery.Error) > maxErrorLen {
+			delivery.Error = delivery.Error[:maxErrorLen]
+		}
+		if delivery.Attempts < w.cfg.MaxAttempts {
+			delivery.NextRetryAt = w.now().Add(retryInterval(delivery.Attempts)).Unix()
+		} else {
+			delivery.Status = db.WebhookDeliveryFailed
+			delivery.NextRetryAt = 0
+		}
+	}
+	return w.store.SetWebhookDeliveryResult(ctx, delivery)
+}
+
+func (w *Webhooks) post(ctx context.Context, hook *db.Webhook, delivery *db.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Quickshare-Webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// the connection could be reused after the body is drained
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryInterval doubles after each attempt: 1m, 2m, 4m... and it is at most an hour
+func retryInterval(attempts int) time.Duration {
+	interval := time.Minute
+	for i := 1; i < attempts && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxRetryInterval {
+		return maxRetryInterval
+	}
+	return interval
+}
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"file.uploaded"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if Sign("secret", body) != expected {
+		t.Fatalf("incorrect signature %s", Sign("secret", body))
+	} else if Sign("other", body) == expected {
+		t.Fatal("signatures of different secrets should not match")
+	}
+}
+
+func TestRetryInterval(t *testing.T) {
+	expected := map[int]time.Duration{
+		1:   time.Minute,
+		2:   2 * time.Minute,
+		3:   4 * time.Minute,
+		7:   maxRetryInterval,
+		100: maxRetryInterval,
+	}
+	for attempts, interval := range expected {
+		if retryInterval(attempts) != interval {
+			t.Fatalf("incorrect interval of %d attempts: %s", attempts, retryInterval(attempts))
+		}
+	}
+}
+
+func TestCheckAddrs(t *testing.T) {
+	newWebhooks := func(t *testing.T, allowed ...string) *Webhooks {
+		allowedNets, err := ParseNets(allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewWebhooks(
+			&Config{Timeout: time.Second, AllowedNets: allowedNets},
+			nil, nil, nil, zap.NewNop().Sugar(),
+		)
+	}
+
+	t.Run("internal addresses are rejected", func(t *testing.T) {
+		w := newWebhooks(t)
+		for _, hookURL := range []string{
+			"http://127.0.0.1:8686/hook",
+			"http://localhost/hook",
+			"http://api.localhost./hook",
+			"http://10.0.0.5/hook",
+			"http://172.16.1.1/hook",
+			"http://192.168.1.1/hook",
+			"http://169.254.169.254/latest/meta-data",
+			"http://100.100.100.200/latest/meta-data",
+			"http://0.0.0.0/hook",
+			"http://[::1]/hook",
+			"http://[fe80::1]/hook",
+			"http://[fd00:ec2::254]/hook",
+			"http://[::ffff:127.0.0.1]/hook",
+		} {
+			if err := w.CheckURL(hookURL); !errors.Is(err, ErrBlockedAddr) {
+				t.Fatalf("%s should be rejected: %v", hookURL, err)
+			}
+		}
+		for _, hookURL := range []string{
+			"https://example.com/hook",
+			"http://93.184.216.34/hook",
+			"http://[2606:2800:220:1::]/hook",
+		} {
+			if err := w.CheckURL(hookURL); err != nil {
+				t.Fatalf("%s should be accepted: %v", hookURL, err)
+			}
+		}
+	})
+
+	t.Run("allowed addresses are accepted", func(t *testing.T) {
+		w := newWebhooks(t, "10.0.0.0/8", "192.168.1.1")
+		for _, hookURL := range []string{"http://10.1.2.3/hook", "http://192.168.1.1/hook"} {
+			if err := w.CheckURL(hookURL); err != nil {
+				t.Fatalf("%s should be accepted: %v", hookURL, err)
+			}
+		}
+		if err := w.CheckURL("http://192.168.1.2/hook"); !errors.Is(err, ErrBlockedAddr) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if _, err := ParseNets([]string{"10.0.0.0/33"}); err == nil {
+			t.Fatal("invalid CIDR should be rejected")
+		}
+	})
+
+	t.Run("resolved addresses are checked when dialing", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer receiver.Close()
+		receiverURL, err := url.Parse(receiver.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// host names are checked after they are resolved, e.g. a host name rebound to a loopback address
+		w := newWebhooks(t)
+		_, err = w.client.Post("http://localhost:"+receiverURL.Port(), "application/json", nil)
+		if !errors.Is(err, ErrBlockedAddr) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		_, err = w.client.Post(receiver.URL, "application/json", nil)
+		if !errors.Is(err, ErrBlockedAddr) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		allowed := newWebhooks(t, "127.0.0.1")
+		resp, err := allowed.client.Post(receiver.URL, "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	})
+}
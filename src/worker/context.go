@@ -0,0 +1,21 @@
+package worker
+
+import "context"
+
+type ctxMsg struct {
+	IMsg
+	ctx context.Context
+}
+
+// WithContext binds ctx (e.g. the one carrying the span of the job) to the message for its handler
+func WithContext(msg IMsg, ctx context.Context) IMsg {
+	return &ctxMsg{IMsg: msg, ctx: ctx}
+}
+
+// MsgContext returns the context bound to the message, or a background context
+func MsgContext(msg IMsg) context.Context {
+	if withCtx, ok := msg.(*ctxMsg); ok {
+		return withCtx.ctx
+	}
+	return context.Background()
+}
@@ -1,12 +1,14 @@
 package localworker
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/ihexxa/quickshare/src/tracing"
 	"github.com/ihexxa/quickshare/src/worker"
 )
 
@@ -52,8 +54,13 @@ type WorkerPool struct {
 	mtx         *sync.RWMutex
 	logger      *zap.SugaredLogger
 	msgHandlers map[string]worker.MsgHandler
+	observe     JobObserver
+	tracer      tracing.ITracer
 }
 
+// JobObserver is called after a message is handled
+type JobObserver func(msgType string, duration time.Duration, err error)
+
 func NewWorkerPool(queueSize, sleep, workerCount int, logger *zap.SugaredLogger) *WorkerPool {
 	return &WorkerPool{
 		on:          true,
@@ -64,6 +71,7 @@ func NewWorkerPool(queueSize, sleep, workerCount int, logger *zap.SugaredLogger)
 		workerCount: workerCount,
 		queue:       make(chan worker.IMsg, queueSize),
 		msgHandlers: map[string]worker.MsgHandler{},
+		observe:     func(string, time.Duration, error) {},
 	}
 }
 
@@ -155,7 +163,20 @@ func (wp *WorkerPool) startWorker() {
 				return
 			}
 
-			if err = handler(msg); err != nil {
+			// the job span is a child of the span which put the message
+			ctx := context.Background()
+			var span *tracing.Span
+			if wp.tracer != nil {
+				ctx, span = wp.tracer.Start(wp.tracer.Extract(ctx, headers), "job "+msgType, tracing.SpanKindConsumer)
+				span.SetAttr("worker.msgType", msgType)
+			}
+
+			start := time.Now()
+			err = handler(worker.WithContext(msg, ctx))
+			wp.observe(msgType, time.Since(start), err)
+			span.SetError(err)
+			span.End()
+			if err != nil {
 				wp.logger.Errorf("async task(%s) failed: %s", msgType, err)
 			}
 		}()
@@ -175,6 +196,16 @@ func (wp *WorkerPool) DelHandler(msgType string) {
 	delete(wp.msgHandlers, msgType)
 }
 
+// SetJobObserver sets the observer of handled messages, it should be called before the pool starts
+func (wp *WorkerPool) SetJobObserver(observe JobObserver) {
+	wp.observe = observe
+}
+
+// SetTracer sets the tracer of jobs, it should be called before the pool starts
+func (wp *WorkerPool) SetTracer(tracer tracing.ITracer) {
+	wp.tracer = tracer
+}
+
 func (wp *WorkerPool) QueueLen() int {
 	return len(wp.queue)
 }